@@ -0,0 +1,142 @@
+// Package client is a Go client for the OpenRobot Fleet controller API.
+//
+// Request and response types and one method per operation are generated from
+// the controller's OpenAPI document (also served at /api/openapi.json); this
+// file holds the transport they share.
+package client
+
+//go:generate go run ../cmd/openapi-gen -spec openapi.json -go zz_generated.go -pkg client -ts ../web/src/api.gen.ts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+)
+
+// Client talks to one controller. Call Login (or SetToken) before anything
+// else; the session cookie is kept in the HTTP client's jar.
+type Client struct {
+	BaseURL string
+	HTTP    *http.Client
+
+	// OnBehalfOf, if set, is sent as X-On-Behalf-Of so jobs and audit events
+	// record the user the admin is acting for.
+	OnBehalfOf string
+}
+
+// Error is a non-2xx response from the controller.
+type Error struct {
+	StatusCode int
+	Message    string
+	RequestID  string
+}
+
+func (e *Error) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("controller returned %d: %s (request %s)", e.StatusCode, e.Message, e.RequestID)
+	}
+	return fmt.Sprintf("controller returned %d: %s", e.StatusCode, e.Message)
+}
+
+// New returns a client for the controller at baseURL, e.g.
+// https://fleet.example.edu.
+func New(baseURL string) *Client {
+	jar, _ := cookiejar.New(nil)
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		HTTP:    &http.Client{Jar: jar},
+	}
+}
+
+// SetToken installs an existing session cookie instead of logging in.
+func (c *Client) SetToken(token string) error {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return err
+	}
+	if c.HTTP.Jar == nil {
+		c.HTTP.Jar, _ = cookiejar.New(nil)
+	}
+	c.HTTP.Jar.SetCookies(u, []*http.Cookie{{Name: "auth_token", Value: token, Path: "/"}})
+	return nil
+}
+
+func (c *Client) doJSON(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	rc, err := c.doJSONRaw(ctx, method, path, query, in)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if out == nil {
+		_, _ = io.Copy(io.Discard, rc)
+		return nil
+	}
+	return json.NewDecoder(rc).Decode(out)
+}
+
+// doJSONRaw sends in as JSON and returns the raw response body, for
+// operations that answer with a file.
+func (c *Client) doJSONRaw(ctx context.Context, method, path string, query url.Values, in interface{}) (io.ReadCloser, error) {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		buf, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(buf)
+		contentType = "application/json"
+	}
+	return c.doRaw(ctx, method, path, query, body, contentType)
+}
+
+// doRaw performs the request and returns the body of a 2xx response; the
+// caller closes it.
+func (c *Client) doRaw(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string) (io.ReadCloser, error) {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.OnBehalfOf != "" {
+		req.Header.Set("X-On-Behalf-Of", c.OnBehalfOf)
+	}
+	hc := c.HTTP
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		apiErr := &Error{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(msg)),
+			RequestID:  resp.Header.Get("X-Request-ID"),
+		}
+		var body struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(msg, &body) == nil && body.Error != "" {
+			apiErr.Message = body.Error
+		}
+		return nil, apiErr
+	}
+	return resp.Body, nil
+}
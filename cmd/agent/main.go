@@ -2,12 +2,19 @@ package main
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// Set at build time with -ldflags "-X main.version=... -X main.buildDate=...".
+var (
+	version   = "dev"
+	buildDate = ""
 )
 
 func main() {
@@ -15,18 +22,7 @@ func main() {
 	if cfgPath == "" {
 		cfgPath = "/etc/openrobotfleet-agent/config.yaml"
 	}
-	cfg, err := agent.LoadConfig(cfgPath)
-	if err != nil {
-		log.Fatalf("failed to load config: %v", err)
-	}
-	if cfg.AgentID == "" {
-		log.Fatalf("config missing agent_id")
-	}
-
-	log.Printf("Starting Agent %s (Behavior Tree Mode)", cfg.AgentID)
-
-	// Create Engine
-	engine := agent.NewAgentEngine(cfg)
+	logging.Setup("agent")
 
 	// Context with cancel
 	ctx, cancel := context.WithCancel(context.Background())
@@ -37,10 +33,40 @@ func main() {
 
 	go func() {
 		<-sig
-		log.Println("Shutting down...")
+		slog.Info("shutting down")
 		cancel()
 	}()
 
+	cfg, err := agent.LoadConfigWithRecovery(cfgPath)
+	if err != nil {
+		// Stay reachable instead of dying silently
+		cfg, err = agent.RunRecoveryMode(ctx, cfgPath, err)
+		if err != nil {
+			slog.Info("recovery mode ended", "err", err)
+			return
+		}
+	}
+
+	// A freshly flashed robot gets its name from the enrollment pool
+	cfg, err = agent.Enroll(ctx, cfgPath, cfg)
+	if err != nil {
+		slog.Info("enrollment ended", "err", err)
+		return
+	}
+
+	if cfg.ROSContainer == "" {
+		if name := agent.DetectROSContainer(); name != "" {
+			slog.Info("running ROS commands in detected container", "container", name)
+			cfg.ROSContainer = name
+		}
+	}
+
+	slog.Info("starting agent", "agent_id", cfg.AgentID, "version", version, "build_date", buildDate, "mode", "behavior_tree")
+
+	// Create Engine
+	engine := agent.NewAgentEngine(cfg)
+	engine.Version = version
+
 	// Start Engine
 	engine.Start(ctx)
 }
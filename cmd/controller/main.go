@@ -1,24 +1,70 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"example.com/openrobot-fleet/internal/http"
+	"example.com/openrobot-fleet/internal/logging"
 )
 
 func main() {
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "controller.db"
+	logging.Setup("controller")
+
+	dbDriver := os.Getenv("DB_DRIVER")
+	dsn := os.Getenv("DB_PATH")
+	if dbDriver == "postgres" {
+		dsn = os.Getenv("DATABASE_URL")
+	} else if dsn == "" {
+		dsn = "controller.db"
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(dbDriver, dsn, os.Args[2:]))
 	}
 
-	server, err := httpserver.NewServer(dbPath)
+	server, err := httpserver.NewServer(dbDriver, dsn)
 	if err != nil {
-		log.Fatalf("failed to init server: %v", err)
+		slog.Error("failed to init server", "err", err)
+		os.Exit(1)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Start()
+	}()
+
+	// Handle signals
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-errCh:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("server error", "err", err)
+			os.Exit(1)
+		}
+		return
+	case s := <-sig:
+		slog.Info("shutting down", "signal", s.String())
+	}
+
+	timeout := 30 * time.Second
+	if v, err := strconv.Atoi(os.Getenv("SHUTDOWN_TIMEOUT_SEC")); err == nil && v > 0 {
+		timeout = time.Duration(v) * time.Second
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	if err := server.Start(); err != nil {
-		log.Fatalf("server error: %v", err)
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("shutdown", "err", err)
 	}
+	slog.Info("controller stopped")
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"example.com/openrobot-fleet/internal/db"
+)
+
+// runMigrate implements "controller migrate [status|up|down <version>|explain]"
+// for inspecting the schema version, rolling back a bad upgrade and checking
+// that the reporting queries use their indexes. It returns the process exit
+// code.
+func runMigrate(driver, dsn string, args []string) int {
+	cmd := "status"
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+	d, err := db.Connect(driver, dsn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "connect:", err)
+		return 1
+	}
+	defer d.SQL.Close()
+	ctx := context.Background()
+
+	switch cmd {
+	case "explain":
+		return explainReports(ctx, d)
+	case "status":
+	case "up":
+		err = d.MigrateTo(ctx, db.LatestSchemaVersion())
+	case "down":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "usage: controller migrate down <version>")
+			return 2
+		}
+		target, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			fmt.Fprintln(os.Stderr, "invalid version:", args[1])
+			return 2
+		}
+		err = d.MigrateTo(ctx, target)
+	default:
+		fmt.Fprintln(os.Stderr, "usage: controller migrate [status|up|down <version>|explain]")
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+	v, err := d.SchemaVersion(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "schema version:", err)
+		return 1
+	}
+	fmt.Printf("schema version %d (latest %d)\n", v, db.LatestSchemaVersion())
+	return 0
+}
+
+// explainReports prints the plan of every reporting query and fails if any of
+// them scans a whole table.
+func explainReports(ctx context.Context, d *db.DB) int {
+	plans, err := d.ReportPlans(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "explain:", err)
+		return 1
+	}
+	code := 0
+	for _, p := range plans {
+		verdict := "ok"
+		if p.FullScan {
+			verdict, code = "FULL SCAN", 1
+		}
+		fmt.Printf("%-26s %s\n", p.Name, verdict)
+		for _, line := range p.Plan {
+			fmt.Printf("    %s\n", line)
+		}
+	}
+	return code
+}
@@ -0,0 +1,2581 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"example.com/openrobot-fleet/client"
+)
+
+const pollInterval = 2 * time.Second
+
+func cmdRobots(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	robots, err := c.ListRobots(ctx, client.ListRobotsParams{Selector: strings.Join(args, " ")})
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(robots)
+	}
+	tw := newTable("ID", "NAME", "AGENT", "TYPE", "STATUS", "IP", "TAGS", "LAST SEEN")
+	for _, r := range robots {
+		tw.row(r.ID, r.Name, r.AgentID, r.Type, r.Status, r.IP, strings.Join(r.Tags, ","), ago(r.LastSeen))
+	}
+	return tw.flush()
+}
+
+func cmdCommand(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	fs := flag.NewFlagSet("command", flag.ContinueOnError)
+	priority := fs.String("priority", "", "critical, interactive or batch (default depends on the type)")
+	atBoot := fs.Bool("at-boot", false, "run after the robot next reboots")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	args = fs.Args()
+	if len(args) < 2 || len(args) > 3 {
+		return errors.New("usage: fleetctl command [-priority p] [-at-boot] <robot|all|selector> <type> [json-data]")
+	}
+	req := client.CommandRequest{Type: args[1], Priority: *priority, RunAtBoot: *atBoot}
+	if len(args) == 3 {
+		if !json.Valid([]byte(args[2])) {
+			return fmt.Errorf("command data is not valid JSON: %s", args[2])
+		}
+		req.Data = json.RawMessage(args[2])
+	}
+
+	if isSelector(args[0]) {
+		resp, err := c.SendSelectorCommand(ctx, client.SelectorCommandRequest{Selector: args[0], Type: req.Type, Data: req.Data, Priority: req.Priority, RunAtBoot: req.RunAtBoot})
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(resp)
+		}
+		for _, job := range resp.Jobs {
+			fmt.Printf("queued job %d (%s for %s)\n", job.ID, job.Type, job.TargetRobot)
+		}
+		if len(resp.Skipped) > 0 {
+			fmt.Printf("skipped (no agent): %s\n", strings.Join(resp.Skipped, ", "))
+		}
+		return nil
+	}
+
+	var job client.Job
+	var err error
+	if args[0] == "all" {
+		job, err = c.BroadcastCommand(ctx, req)
+	} else {
+		var robot client.Robot
+		if robot, err = findRobot(ctx, c, args[0]); err != nil {
+			return err
+		}
+		job, err = c.SendRobotCommand(ctx, robot.ID, req)
+	}
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(job)
+	}
+	fmt.Printf("queued job %d (%s for %s)\n", job.ID, job.Type, job.TargetRobot)
+	return nil
+}
+
+func cmdApply(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	// -force applies to robots that don't meet the scenario's requirements.
+	force := false
+	var rest []string
+	for _, a := range args {
+		if a == "-force" || a == "--force" {
+			force = true
+			continue
+		}
+		rest = append(rest, a)
+	}
+	args = rest
+	if len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		return applyFleetFile(ctx, c, opts, args)
+	}
+	if len(args) < 2 {
+		return errors.New("usage: fleetctl apply [-force] <scenario> <robot>... | all, or fleetctl apply -f fleet.yaml")
+	}
+	scenario, err := findScenario(ctx, c, args[0])
+	if err != nil {
+		return err
+	}
+	ids, sel, err := resolveTargets(ctx, c, args[1:])
+	if err != nil {
+		return err
+	}
+	resp, err := c.ApplyScenario(ctx, scenario.ID, client.ApplyScenarioRequest{RobotIDs: ids, Selector: sel, Force: force})
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(resp)
+	}
+	fmt.Printf("applying %q to %d robot(s)\n", scenario.Name, len(resp.Jobs))
+	for _, m := range resp.Skipped {
+		fmt.Printf("skipped %s: %s\n", m.Name, strings.Join(m.Reasons, ", "))
+	}
+	for _, m := range resp.Warnings {
+		fmt.Printf("warning: %s %s\n", m.Name, strings.Join(m.Reasons, ", "))
+	}
+	tw := newTable("JOB", "ROBOT", "STATUS")
+	for _, j := range resp.Jobs {
+		tw.row(j.ID, j.TargetRobot, j.Status)
+	}
+	return tw.flush()
+}
+
+// applyFleetFile sends a fleet file as a dry run, prints the diff and applies
+// it once confirmed.
+func applyFleetFile(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	fs := flag.NewFlagSet("apply", flag.ContinueOnError)
+	file := fs.String("f", "", "fleet file to apply (- for stdin)")
+	dryRun := fs.Bool("dry-run", false, "only show what would change")
+	prune := fs.Bool("prune", false, "delete robots and scenarios missing from the file")
+	yes := fs.Bool("yes", false, "apply without asking for confirmation")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("usage: fleetctl apply -f fleet.yaml [-dry-run] [-prune] [-yes]")
+	}
+	var raw []byte
+	var err error
+	if *file == "-" {
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		return err
+	}
+
+	req := client.FleetApplyRequest{ConfigYAML: string(raw), DryRun: true, Prune: *prune}
+	plan, err := c.ApplyFleet(ctx, req)
+	if err != nil {
+		return err
+	}
+	if opts.json && (*dryRun || len(plan.Changes) == 0) {
+		return printJSON(plan)
+	}
+	if !opts.json {
+		printFleetChanges(plan.Changes)
+	}
+	if *dryRun || len(plan.Changes) == 0 {
+		return nil
+	}
+	if !*yes {
+		if *file == "-" {
+			return errors.New("refusing to prompt while reading the file from stdin; pass -yes")
+		}
+		fmt.Printf("\nApply %d change(s)? [y/N] ", len(plan.Changes))
+		var answer string
+		fmt.Scanln(&answer)
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			fmt.Println("nothing applied")
+			return nil
+		}
+	}
+
+	req.DryRun = false
+	resp, err := c.ApplyFleet(ctx, req)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(resp)
+	}
+	fmt.Printf("applied %d change(s)\n", len(resp.Changes))
+	return nil
+}
+
+func printFleetChanges(changes []client.Change) {
+	if len(changes) == 0 {
+		fmt.Println("fleet is up to date")
+		return
+	}
+	marks := map[string]string{"create": "+", "update": "~", "delete": "-"}
+	for _, ch := range changes {
+		fmt.Printf("%s %s %s\n", marks[ch.Action], ch.Kind, ch.Name)
+		for _, d := range ch.Diff {
+			fmt.Printf("    %s\n", d)
+		}
+	}
+}
+
+func cmdSensors(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	fs := flag.NewFlagSet("sensors", flag.ContinueOnError)
+	out := fs.String("o", "", "save the camera frame to this file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: fleetctl sensors [-o frame.jpg] <robot>")
+	}
+	robot, err := findRobot(ctx, c, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	snap, err := c.GetSensorSnapshot(ctx, robot.ID, client.SensorSnapshotRequest{})
+	if err != nil {
+		return err
+	}
+	if *out != "" && snap.Camera != nil {
+		if err := os.WriteFile(*out, snap.Camera.JPEG, 0o644); err != nil {
+			return err
+		}
+	}
+	if opts.json {
+		return printJSON(snap)
+	}
+
+	tw := newTable("SENSOR", "STATUS", "READING")
+	switch {
+	case snap.Scan != nil:
+		nearest := math.Inf(1)
+		for _, r := range snap.Scan.Ranges {
+			if r != nil && *r < nearest {
+				nearest = *r
+			}
+		}
+		tw.row("lidar", "ok", fmt.Sprintf("%d points, nearest %.2f m", snap.Scan.Points, nearest))
+	default:
+		tw.row("lidar", "FAIL", snap.ScanError)
+	}
+	switch {
+	case snap.Camera != nil:
+		reading := fmt.Sprintf("%d KiB jpeg", len(snap.Camera.JPEG)>>10)
+		if *out != "" {
+			reading += ", saved to " + *out
+		}
+		tw.row("camera", "ok", reading)
+	default:
+		tw.row("camera", "FAIL", snap.CameraError)
+	}
+	switch {
+	case snap.Odom != nil:
+		o := snap.Odom
+		tw.row("odom", "ok", fmt.Sprintf("x=%.2f y=%.2f yaw=%.0f° v=%.2f m/s", o.X, o.Y, o.Yaw*180/math.Pi, o.LinearX))
+	default:
+		tw.row("odom", "FAIL", snap.OdomError)
+	}
+	return tw.flush()
+}
+
+func cmdFormation(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	fs := flag.NewFlagSet("formation", flag.ContinueOnError)
+	delay := fs.Float64("delay", 0, "seconds until the robots start (default 5)")
+	distance := fs.Float64("distance", 0, "meters to drive forward (default 0.5)")
+	speed := fs.Float64("speed", 0, "speed in m/s (default 0.1)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("usage: fleetctl formation [-delay s] [-distance m] [-speed m/s] <robot|selector>... | all")
+	}
+	ids, sel, err := resolveTargets(ctx, c, fs.Args())
+	if err != nil {
+		return err
+	}
+	test, err := c.StartFormationTest(ctx, client.FormationTestRequest{RobotIDs: ids, Selector: sel, DelaySec: *delay, DistanceM: *distance, SpeedMps: *speed})
+	if err != nil {
+		return err
+	}
+	if !opts.json {
+		fmt.Printf("%d robot(s) drive %.2f m at %s\n", len(test.Robots), test.DistanceM, test.StartAt.Local().Format("15:04:05.000"))
+	}
+	for !test.Done {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+		if test, err = c.GetFormationTest(ctx, test.ID); err != nil {
+			return err
+		}
+	}
+	if opts.json {
+		if err := printJSON(test); err != nil {
+			return err
+		}
+	} else {
+		tw := newTable("ROBOT", "STATUS", "LATENCY", "START", "CLOCK", "ERROR")
+		for _, r := range test.Robots {
+			if r.Status == "skipped" || r.Status == "queued" || r.Status == "no_report" {
+				tw.row(r.Name, r.Status, "-", "-", "-", r.Error)
+				continue
+			}
+			start := "-"
+			if r.Status == "done" {
+				start = fmt.Sprintf("%+dms", r.StartOffsetMs)
+			}
+			tw.row(r.Name, r.Status, fmt.Sprintf("%dms", r.LatencyMs), start, fmt.Sprintf("%+dms", r.ClockOffsetMs), r.Error)
+		}
+		if err := tw.flush(); err != nil {
+			return err
+		}
+		fmt.Printf("max latency %dms, start spread %dms\n", test.MaxLatencyMs, test.StartSpreadMs)
+	}
+	if !test.Ready {
+		return errors.New("fleet is not ready for a synchronized run")
+	}
+	return nil
+}
+
+func cmdNav(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	fs := flag.NewFlagSet("nav", flag.ContinueOnError)
+	x := fs.Float64("x", 0, "goal x in meters")
+	y := fs.Float64("y", 0, "goal y in meters")
+	yaw := fs.Float64("yaw", 0, "goal heading in radians")
+	frame := fs.String("frame", "", "frame of the goal (default map)")
+	timeout := fs.Int("timeout", 0, "seconds before the goal is cancelled (default 300)")
+	follow := fs.Bool("f", false, "wait for the robots, printing their progress")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("usage: fleetctl nav -x m -y m [-yaw rad] [-frame f] [-timeout s] [-f] <robot|selector>... | all")
+	}
+	ids, sel, err := resolveTargets(ctx, c, fs.Args())
+	if err != nil {
+		return err
+	}
+	resp, err := c.SendNavGoals(ctx, client.NavGoalRequest{RobotIDs: ids, Selector: sel, X: *x, Y: *y, Yaw: *yaw, Frame: *frame, TimeoutSec: *timeout})
+	if err != nil {
+		return err
+	}
+	if !*follow {
+		if opts.json {
+			return printJSON(resp)
+		}
+		for _, job := range resp.Jobs {
+			fmt.Printf("queued job %d (%s for %s)\n", job.ID, job.Type, job.TargetRobot)
+		}
+	}
+	if len(resp.Skipped) > 0 && !opts.json {
+		fmt.Printf("skipped (no agent): %s\n", strings.Join(resp.Skipped, ", "))
+	}
+	if !*follow {
+		return nil
+	}
+
+	failed, err := followJobs(ctx, c, opts, resp.Jobs)
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d robot(s) did not reach the goal", failed, len(resp.Jobs))
+	}
+	return nil
+}
+
+// followJobs polls jobs until they finish, printing each change of status,
+// step or progress, and returns how many did not succeed.
+func followJobs(ctx context.Context, c *client.Client, opts globalOptions, jobs []client.Job) (int, error) {
+	pending := map[int64]string{}
+	for _, job := range jobs {
+		pending[job.ID] = ""
+	}
+	failed := 0
+	for len(pending) > 0 {
+		select {
+		case <-ctx.Done():
+			return failed, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+		list, err := c.ListJobs(ctx, client.ListJobsParams{})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "fleetctl:", err)
+			continue
+		}
+		for _, j := range list {
+			last, ok := pending[j.ID]
+			state := j.Status + "\x00" + runningStep(j) + "\x00" + j.Progress
+			if !ok || last == state {
+				continue
+			}
+			pending[j.ID] = state
+			printJobLine(opts, j)
+			switch j.Status {
+			case "queued", "pending", "running", "deferred":
+				continue
+			case "success":
+			default:
+				failed++
+			}
+			delete(pending, j.ID)
+		}
+	}
+	return failed, nil
+}
+
+func cmdMissions(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	if len(args) == 0 {
+		missions, err := c.ListMissions(ctx)
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(missions)
+		}
+		tw := newTable("ID", "NAME", "WAYPOINTS", "FRAME", "DESCRIPTION")
+		for _, m := range missions {
+			frame := m.Frame
+			if frame == "" {
+				frame = "map"
+			}
+			tw.row(m.ID, m.Name, len(m.Waypoints), frame, m.Description)
+		}
+		return tw.flush()
+	}
+	switch args[0] {
+	case "show":
+		if len(args) != 2 {
+			return errors.New("usage: fleetctl missions show <mission>")
+		}
+		m, err := findMission(ctx, c, args[1])
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(m)
+		}
+		tw := newTable("#", "NAME", "X", "Y", "YAW", "ACTION")
+		for i, wp := range m.Waypoints {
+			action := wp.Action
+			if action == "wait" {
+				action = fmt.Sprintf("wait %ds", wp.WaitSec)
+			}
+			tw.row(i+1, wp.Name, wp.X, wp.Y, wp.Yaw, action)
+		}
+		return tw.flush()
+	case "save":
+		// The file is a mission as the API returns it; one with the same name
+		// is replaced.
+		if len(args) != 2 {
+			return errors.New("usage: fleetctl missions save <file.json|->")
+		}
+		var raw []byte
+		var err error
+		if args[1] == "-" {
+			raw, err = io.ReadAll(os.Stdin)
+		} else {
+			raw, err = os.ReadFile(args[1])
+		}
+		if err != nil {
+			return err
+		}
+		var req client.MissionRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			return fmt.Errorf("%s: %w", args[1], err)
+		}
+		var m client.Mission
+		if existing, findErr := findMission(ctx, c, req.Name); findErr == nil {
+			m, err = c.UpdateMission(ctx, existing.ID, req)
+		} else {
+			m, err = c.CreateMission(ctx, req)
+		}
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(m)
+		}
+		fmt.Printf("saved mission %s (%d waypoints)\n", m.Name, len(m.Waypoints))
+		return nil
+	case "rm":
+		if len(args) != 2 {
+			return errors.New("usage: fleetctl missions rm <mission>")
+		}
+		m, err := findMission(ctx, c, args[1])
+		if err != nil {
+			return err
+		}
+		if err := c.DeleteMission(ctx, m.ID); err != nil {
+			return err
+		}
+		fmt.Printf("deleted mission %s\n", m.Name)
+		return nil
+	case "run":
+		fs := flag.NewFlagSet("missions run", flag.ContinueOnError)
+		loops := fs.Int("loops", 1, "times to drive the route")
+		timeout := fs.Int("timeout", 0, "seconds each waypoint may take (default 300)")
+		follow := fs.Bool("f", false, "wait for the robots, printing the waypoints they reach")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() < 2 {
+			return errors.New("usage: fleetctl missions run [-loops n] [-timeout s] [-f] <mission> <robot|selector>... | all")
+		}
+		m, err := findMission(ctx, c, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		ids, sel, err := resolveTargets(ctx, c, fs.Args()[1:])
+		if err != nil {
+			return err
+		}
+		resp, err := c.RunMission(ctx, m.ID, client.MissionRunRequest{RobotIDs: ids, Selector: sel, Loops: *loops, TimeoutSec: *timeout})
+		if err != nil {
+			return err
+		}
+		if opts.json && !*follow {
+			return printJSON(resp)
+		}
+		if !opts.json {
+			for _, job := range resp.Jobs {
+				fmt.Printf("queued job %d (%s for %s)\n", job.ID, m.Name, job.TargetRobot)
+			}
+			if len(resp.Skipped) > 0 {
+				fmt.Printf("skipped (no agent): %s\n", strings.Join(resp.Skipped, ", "))
+			}
+		}
+		if !*follow {
+			return nil
+		}
+		failed, err := followJobs(ctx, c, opts, resp.Jobs)
+		if err != nil {
+			return err
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d robot(s) did not finish %s", failed, len(resp.Jobs), m.Name)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown missions subcommand %q", args[0])
+	}
+}
+
+// findMission looks a mission up by ID or name.
+func findMission(ctx context.Context, c *client.Client, ref string) (client.Mission, error) {
+	missions, err := c.ListMissions(ctx)
+	if err != nil {
+		return client.Mission{}, err
+	}
+	id, idErr := strconv.ParseInt(ref, 10, 64)
+	for _, m := range missions {
+		if (idErr == nil && m.ID == id) || m.Name == ref {
+			return m, nil
+		}
+	}
+	return client.Mission{}, fmt.Errorf("no mission matches %q", ref)
+}
+
+func cmdJobs(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	fs := flag.NewFlagSet("jobs", flag.ContinueOnError)
+	robot := fs.String("robot", "", "only jobs for this agent ID")
+	follow := fs.Bool("f", false, "keep polling and print jobs as their status changes")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	params := client.ListJobsParams{Robot: *robot}
+
+	jobs, err := c.ListJobs(ctx, params)
+	if err != nil {
+		return err
+	}
+	sortJobs(jobs)
+	if !*follow {
+		if opts.json {
+			return printJSON(jobs)
+		}
+		tw := newTable("ID", "ROBOT", "TYPE", "STATUS", "ISSUED BY", "UPDATED")
+		for _, j := range jobs {
+			tw.row(j.ID, j.TargetRobot, j.Type, j.Status, issuer(j), ago(j.UpdatedAt))
+		}
+		return tw.flush()
+	}
+
+	// Follow mode prints one line per job status or progress change
+	seen := map[int64]string{}
+	state := func(j client.Job) string { return j.Status + "\x00" + j.Progress }
+	for _, j := range jobs {
+		printJobLine(opts, j)
+		seen[j.ID] = state(j)
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		jobs, err := c.ListJobs(ctx, params)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "fleetctl:", err)
+			continue
+		}
+		sortJobs(jobs)
+		for _, j := range jobs {
+			if seen[j.ID] == state(j) {
+				continue
+			}
+			seen[j.ID] = state(j)
+			printJobLine(opts, j)
+		}
+	}
+}
+
+func printJobLine(opts globalOptions, j client.Job) {
+	if opts.json {
+		b, _ := json.Marshal(j)
+		fmt.Println(string(b))
+		return
+	}
+	line := fmt.Sprintf("%s  job %-6d %-10s %-20s %s", j.UpdatedAt.Local().Format("15:04:05"), j.ID, j.Status, j.Type, j.TargetRobot)
+	if step := runningStep(j); step != "" {
+		line += "  [" + step + "]"
+	}
+	if j.Progress != "" {
+		line += "  " + j.Progress
+	}
+	fmt.Println(line)
+}
+
+// runningStep is the name of the batch step j is on, if any.
+func runningStep(j client.Job) string {
+	for _, step := range j.Steps {
+		if step.Status == "running" {
+			return step.Name
+		}
+	}
+	return ""
+}
+
+func cmdBuild(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: fleetctl build start [-profile p] [-from-cache] | refresh [-f] <build-id> | status [-f] [build-id] | cancel [-f] [build-id] | history [-profile p] [-limit n] [build-id] | get [-o file] [-key signing.pub] <build-id> | key | storage | prune | rm <build-id> | clear-cache")
+	}
+	switch args[0] {
+	case "history":
+		return cmdBuildHistory(ctx, c, opts, args[1:])
+	case "storage", "prune", "rm", "clear-cache":
+		return cmdBuildStorage(ctx, c, opts, args)
+	case "get":
+		return cmdBuildGet(ctx, c, args[1:])
+	case "key":
+		key, err := readAll(c.GetImageSigningKey(ctx))
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(key)
+		return err
+	}
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	follow := fs.Bool("f", false, "stream build logs until the build finishes")
+	fromCache := fs.Bool("from-cache", false, "start: reuse the cached base image without checking the upstream hash")
+	profileRef := fs.String("profile", "", "start: image profile to build, by name or id; needed when there is more than one")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	// buildID is the build to report on; 0 for the last one started.
+	var buildID int
+	switch args[0] {
+	case "start":
+		params := client.BuildGoldenImageParams{FromCache: *fromCache}
+		if *profileRef != "" {
+			p, err := findImageProfile(ctx, c, *profileRef)
+			if err != nil {
+				return err
+			}
+			params.ProfileID = int(p.ID)
+		}
+		res, err := c.BuildGoldenImage(ctx, params)
+		if err != nil {
+			return err
+		}
+		if res.Status == "queued" {
+			// Following the status now would show the build ahead of it.
+			fmt.Printf("build %d queued (%d waiting)\n", res.BuildID, res.Position)
+			return nil
+		}
+		fmt.Printf("build %d started\n", res.BuildID)
+		buildID = int(res.BuildID)
+	case "refresh":
+		if fs.NArg() != 1 {
+			return errors.New("usage: fleetctl build refresh [-f] <build-id>")
+		}
+		id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid build id %q", fs.Arg(0))
+		}
+		res, err := c.RefreshImageBuild(ctx, id)
+		if err != nil {
+			return err
+		}
+		if res.Status == "queued" {
+			fmt.Printf("refresh %d queued (%d waiting)\n", res.BuildID, res.Position)
+			return nil
+		}
+		fmt.Printf("refresh %d of build %d started\n", res.BuildID, id)
+		buildID = int(res.BuildID)
+	case "cancel":
+		if fs.NArg() == 1 {
+			id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid build id %q", fs.Arg(0))
+			}
+			res, err := c.CancelImageBuild(ctx, id)
+			if err != nil {
+				return err
+			}
+			if res["status"] != "cancelling" {
+				fmt.Printf("build %d cancelled\n", id)
+				return nil
+			}
+		} else if _, err := c.CancelBuild(ctx, client.CancelBuildParams{}); err != nil {
+			return err
+		}
+		fmt.Println("build cancelling")
+	case "status":
+		if fs.NArg() == 1 {
+			id, err := strconv.Atoi(fs.Arg(0))
+			if err != nil {
+				return fmt.Errorf("invalid build id %q", fs.Arg(0))
+			}
+			buildID = id
+		}
+	default:
+		return fmt.Errorf("unknown build subcommand %q", args[0])
+	}
+
+	printed := 0
+	for {
+		st, err := buildStatus(ctx, c, buildID)
+		if err != nil {
+			return err
+		}
+		if !*follow {
+			if opts.json {
+				return printJSON(st)
+			}
+			fmt.Printf("status:   %s\n", st.Status)
+			if st.ProfileName != "" {
+				fmt.Printf("profile:  %s\n", st.ProfileName)
+			}
+			fmt.Printf("progress: %d%%\nstep:     %s\n", st.Progress, st.Step)
+			if st.ImageName != "" {
+				fmt.Printf("image:    %s\n", st.ImageName)
+			}
+			if st.Error != "" {
+				fmt.Printf("error:    %s\n", st.Error)
+			}
+			if st.RetryFromCache {
+				fmt.Printf("retry with: fleetctl build start -profile %d -from-cache\n", st.ProfileID)
+			}
+			if len(st.Active) > 1 {
+				fmt.Println("running:")
+				for _, b := range st.Active {
+					fmt.Printf("  build %d  %-16s %3d%%  %s\n", b.BuildID, b.ProfileName, b.Progress, b.Step)
+				}
+			}
+			return nil
+		}
+		if printed > len(st.Logs) {
+			printed = 0 // a new build reset the log
+		}
+		for _, line := range st.Logs[printed:] {
+			fmt.Println(line)
+		}
+		printed = len(st.Logs)
+		if st.Status != "building" && st.Status != "queued" {
+			if st.Status != "success" {
+				return fmt.Errorf("build %s: %s", st.Status, st.Error)
+			}
+			fmt.Printf("build complete: %s\n", st.ImageName)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// buildStatus returns the progress of build id, or of the last build
+// started if id is 0. Once build id is no longer running its outcome comes
+// from the build history.
+func buildStatus(ctx context.Context, c *client.Client, id int) (client.BuildStatusResponse, error) {
+	st, err := c.GetBuildStatus(ctx, client.GetBuildStatusParams{BuildID: id})
+	if err != nil || id == 0 || st.BuildID == int64(id) {
+		return st, err
+	}
+	b, err := c.GetImageBuild(ctx, int64(id))
+	if err != nil {
+		return st, err
+	}
+	st = client.BuildStatusResponse{BuildID: b.ID, Status: b.Status, Error: b.Error, ImageName: b.ImageName, ProfileID: b.ProfileID, ProfileName: b.ProfileName, Logs: []string{}}
+	if b.Log != "" {
+		st.Logs = strings.Split(b.Log, "\n")
+	}
+	if b.Status == "success" {
+		st.Progress = 100
+	}
+	return st, nil
+}
+
+// cmdBuildHistory lists recent golden image builds, or shows one with its
+// log.
+func cmdBuildHistory(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	fs := flag.NewFlagSet("build history", flag.ContinueOnError)
+	limit := fs.Int("limit", 20, "how many builds to list")
+	profileRef := fs.String("profile", "", "only builds of this image profile, by name or id")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		params := client.ListImageBuildsParams{Limit: *limit}
+		if *profileRef != "" {
+			p, err := findImageProfile(ctx, c, *profileRef)
+			if err != nil {
+				return err
+			}
+			params.ProfileID = int(p.ID)
+		}
+		builds, err := c.ListImageBuilds(ctx, params)
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(builds)
+		}
+		tw := newTable("ID", "QUEUED", "PROFILE", "STATUS", "DURATION", "SIZE", "SHA256", "SMOKE", "BY")
+		for _, b := range builds {
+			size, sum, smoke := "-", "-", "-"
+			if b.ImageSize > 0 {
+				size = fmt.Sprintf("%.1f GB", float64(b.ImageSize)/(1<<30))
+			}
+			if len(b.Checksum) >= 12 {
+				sum = b.Checksum[:12]
+			}
+			if b.Status == "success" && b.DownloadURL == "" {
+				size += " (pruned)"
+			}
+			if b.SmokeTest != "" {
+				smoke = b.SmokeTest
+			}
+			tw.row(b.ID, ago(b.QueuedAt), b.ProfileName, b.Status, time.Duration(b.DurationSec)*time.Second, size, sum, smoke, b.RequestedBy)
+		}
+		return tw.flush()
+	}
+	id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		return errors.New("usage: fleetctl build history [-profile p] [-limit n] [build-id]")
+	}
+	b, err := c.GetImageBuild(ctx, id)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(b)
+	}
+	fmt.Printf("build %d of %s: %s, took %s\n", b.ID, b.ProfileName, b.Status, time.Duration(b.DurationSec)*time.Second)
+	if b.RefreshOf != 0 {
+		fmt.Printf("refresh of build %d with the current agent and user-data\n", b.RefreshOf)
+	}
+	if b.ImageName != "" {
+		fmt.Printf("image:  %s (%d bytes)\n", b.ImageName, b.ImageSize)
+	}
+	if b.Checksum != "" {
+		fmt.Printf("sha256: %s\n", b.Checksum)
+	}
+	if b.SmokeTest != "" {
+		fmt.Printf("smoke:  %s", b.SmokeTest)
+		if b.SmokeError != "" {
+			fmt.Printf(" (%s)", b.SmokeError)
+		}
+		fmt.Println()
+	}
+	if b.Error != "" {
+		fmt.Printf("error:  %s\n", b.Error)
+	}
+	if b.Log != "" {
+		fmt.Println()
+		fmt.Println(b.Log)
+	}
+	return nil
+}
+
+// cmdBuildStorage shows the disk images, the base image cache and snapshots
+// take, or frees some: prune applies each profile's retention, rm deletes
+// one build's image and clear-cache the downloaded base images.
+func cmdBuildStorage(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	gb := func(n float64) string {
+		if n < 1<<30 {
+			return fmt.Sprintf("%.0f MB", n/(1<<20))
+		}
+		return fmt.Sprintf("%.1f GB", n/(1<<30))
+	}
+	var res client.PruneImagesResponse
+	var err error
+	switch args[0] {
+	case "storage":
+		st, err := c.GetImageStorage(ctx)
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(st)
+		}
+		tw := newTable("AREA", "SIZE", "DISK USED", "PATH")
+		for _, a := range st.Areas {
+			disk := "-"
+			if a.TotalBytes > 0 {
+				disk = fmt.Sprintf("%s of %s", gb(float64(a.UsedBytes)), gb(float64(a.TotalBytes)))
+			}
+			tw.row(a.Label, gb(float64(a.ContentBytes)), disk, a.Path)
+		}
+		if err := tw.flush(); err != nil {
+			return err
+		}
+		fmt.Println()
+		tw = newTable("PROFILE", "IMAGES", "KEEPS", "SIZE")
+		for _, p := range st.Profiles {
+			tw.row(p.ProfileName, p.Images, p.KeepImages, gb(float64(p.Bytes)))
+		}
+		if err := tw.flush(); err != nil {
+			return err
+		}
+		if len(st.Untracked) > 0 {
+			fmt.Printf("\nnot from any build: %s\n", strings.Join(st.Untracked, ", "))
+		}
+		return nil
+	case "prune":
+		res, err = c.PruneImages(ctx)
+	case "clear-cache":
+		res, err = c.ClearImageCache(ctx)
+	case "rm":
+		if len(args) != 2 {
+			return errors.New("usage: fleetctl build rm <build-id>")
+		}
+		id, perr := strconv.ParseInt(args[1], 10, 64)
+		if perr != nil {
+			return errors.New("usage: fleetctl build rm <build-id>")
+		}
+		if err := c.DeleteImageBuildArtifact(ctx, id); err != nil {
+			return err
+		}
+		fmt.Printf("deleted the image of build %d\n", id)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(res)
+	}
+	for _, name := range res.Removed {
+		fmt.Printf("removed %s\n", name)
+	}
+	fmt.Printf("freed %s\n", gb(float64(res.FreedBytes)))
+	return nil
+}
+
+// cmdBuildGet downloads the image a build wrote, checking it against the
+// build's SHA-256 and, with -key, the controller's signature. The .sha256
+// file, and the signature if there is one, are saved next to it.
+func cmdBuildGet(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("build get", flag.ContinueOnError)
+	out := fs.String("o", "", "write here instead of the image's own name")
+	keyFile := fs.String("key", "", "verify the signature with this public key (from fleetctl build key)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if fs.NArg() != 1 || err != nil {
+		return errors.New("usage: fleetctl build get [-o file] [-key signing.pub] <build-id>")
+	}
+	b, err := c.GetImageBuild(ctx, id)
+	if err != nil {
+		return err
+	}
+	name := *out
+	if name == "" {
+		name = b.ImageName
+	}
+	// Images built before they were checksummed have neither file.
+	checksum, err := readAll(c.DownloadImageBuildChecksum(ctx, id))
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("checksum: %w", err)
+	}
+	sig, err := readAll(c.DownloadImageBuildSignature(ctx, id))
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("signature: %w", err)
+	}
+	if *keyFile != "" {
+		if checksum == nil || sig == nil {
+			return fmt.Errorf("build %d is not signed", id)
+		}
+		if err := verifyImageSignature(*keyFile, checksum, sig); err != nil {
+			return err
+		}
+	}
+
+	body, err := c.DownloadImageBuildArtifact(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	want := b.Checksum
+	if checksum != nil {
+		want, _, _ = strings.Cut(string(checksum), " ")
+	}
+	if want != "" && sum != want {
+		os.Remove(name)
+		return fmt.Errorf("build %d: downloaded image has sha256 %s, want %s", id, sum, want)
+	}
+	if checksum != nil {
+		if err := os.WriteFile(name+".sha256", checksum, 0644); err != nil {
+			return err
+		}
+	}
+	if sig != nil {
+		if err := os.WriteFile(name+".sha256.sig", sig, 0644); err != nil {
+			return err
+		}
+	}
+	verified := "no checksum to verify"
+	if want != "" {
+		verified = "checksum verified"
+	}
+	if *keyFile != "" {
+		verified = "checksum and signature verified"
+	}
+	fmt.Printf("saved build %d to %s (%d bytes, sha256 %s, %s)\n", id, name, n, sum, verified)
+	return nil
+}
+
+// verifyImageSignature checks sig, the controller's Ed25519 signature of an
+// image's .sha256 file, with the PEM public key in keyFile.
+func verifyImageSignature(keyFile string, checksum, sig []byte) error {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("%s is not a PEM public key", keyFile)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("%s: %w", keyFile, err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return fmt.Errorf("%s is not an Ed25519 key", keyFile)
+	}
+	if !ed25519.Verify(pub, checksum, sig) {
+		return errors.New("image signature does not match; not downloading it")
+	}
+	return nil
+}
+
+func isNotFound(err error) bool {
+	var apiErr *client.Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == 404
+}
+
+// readAll reads and closes a download.
+func readAll(body io.ReadCloser, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+func cmdImages(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	if len(args) == 0 {
+		profiles, err := c.ListImageProfiles(ctx)
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(profiles)
+		}
+		tw := newTable("ID", "NAME", "MODEL", "ROS", "IMAGE", "BUILT", "DESCRIPTION")
+		for _, p := range profiles {
+			image, built, model, ros := "-", "-", "TB3", "Humble"
+			if p.Config.RobotModel != "" {
+				model = p.Config.RobotModel
+			}
+			if p.Config.RosVersion != "" {
+				ros = p.Config.RosVersion
+			}
+			if p.ImageName != "" {
+				image = fmt.Sprintf("%s (%.1f GB)", p.ImageName, float64(p.ImageSize)/(1<<30))
+			}
+			if p.BuiltAt != nil {
+				built = p.BuiltAt.Local().Format("2006-01-02 15:04")
+			}
+			tw.row(p.ID, p.Name, model, ros, image, built, p.Description)
+		}
+		return tw.flush()
+	}
+	switch args[0] {
+	case "show":
+		if len(args) != 2 {
+			return errors.New("usage: fleetctl images show <profile>")
+		}
+		p, err := findImageProfile(ctx, c, args[1])
+		if err != nil {
+			return err
+		}
+		return printJSON(p)
+	case "save":
+		// The file is a profile as the API returns it; one with the same
+		// name is replaced.
+		if len(args) != 2 {
+			return errors.New("usage: fleetctl images save <file.json|->")
+		}
+		var raw []byte
+		var err error
+		if args[1] == "-" {
+			raw, err = io.ReadAll(os.Stdin)
+		} else {
+			raw, err = os.ReadFile(args[1])
+		}
+		if err != nil {
+			return err
+		}
+		var req client.ImageProfileRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			return fmt.Errorf("%s: %w", args[1], err)
+		}
+		var p client.ImageProfile
+		if existing, findErr := findImageProfile(ctx, c, req.Name); findErr == nil {
+			p, err = c.UpdateImageProfile(ctx, existing.ID, req)
+		} else {
+			p, err = c.CreateImageProfile(ctx, req)
+		}
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(p)
+		}
+		fmt.Printf("saved image profile %s\n", p.Name)
+		return nil
+	case "rm":
+		if len(args) != 2 {
+			return errors.New("usage: fleetctl images rm <profile>")
+		}
+		p, err := findImageProfile(ctx, c, args[1])
+		if err != nil {
+			return err
+		}
+		if err := c.DeleteImageProfile(ctx, p.ID); err != nil {
+			return err
+		}
+		fmt.Printf("deleted image profile %s\n", p.Name)
+		return nil
+	case "get":
+		fs := flag.NewFlagSet("images get", flag.ContinueOnError)
+		out := fs.String("o", "", "write here instead of the image's own name (or user-data)")
+		userData := fs.Bool("user-data", false, "download only the cloud-init user-data, or a laptop profile's autoinstall file")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return errors.New("usage: fleetctl images get [-user-data] [-o file] <profile>")
+		}
+		p, err := findImageProfile(ctx, c, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		var body io.ReadCloser
+		name := *out
+		if *userData {
+			body, err = c.DownloadImageProfileUserData(ctx, p.ID)
+			if name == "" {
+				name = "user-data"
+			}
+		} else {
+			body, err = c.DownloadImageProfileImage(ctx, p.ID)
+			if name == "" {
+				name = p.ImageName
+			}
+		}
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+		f, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(f, body)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("saved %s to %s (%d bytes)\n", p.Name, name, n)
+		return nil
+	case "flash":
+		fs := flag.NewFlagSet("images flash", flag.ContinueOnError)
+		out := fs.String("o", "user-data", "write the user-data here")
+		tags := fs.String("tags", "", "comma-separated tags for a newly registered robot")
+		notes := fs.String("notes", "", "notes for a newly registered robot")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 2 {
+			return errors.New("usage: fleetctl images flash [-tags a,b] [-notes n] [-o file] <profile> <robot-name>")
+		}
+		p, err := findImageProfile(ctx, c, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		req := client.FlashDeviceRequest{Name: fs.Arg(1), Notes: *notes}
+		if *tags != "" {
+			req.Tags = strings.Split(*tags, ",")
+		}
+		res, err := c.FlashImageProfileDevice(ctx, p.ID, req)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*out, []byte(res.UserData), 0600); err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(res.Robot)
+		}
+		if res.Created {
+			fmt.Printf("registered robot %s (id %d)\n", res.Robot.Name, res.Robot.ID)
+		} else {
+			fmt.Printf("robot %s (id %d) is already registered\n", res.Robot.Name, res.Robot.ID)
+		}
+		fmt.Printf("saved its user-data to %s; copy it over user-data on the boot partition of a card flashed with %s\n", *out, p.Name)
+		return nil
+	}
+	return fmt.Errorf("unknown images subcommand %q", args[0])
+}
+
+// findImageProfile looks a profile up by id or name.
+func findImageProfile(ctx context.Context, c *client.Client, ref string) (client.ImageProfile, error) {
+	profiles, err := c.ListImageProfiles(ctx)
+	if err != nil {
+		return client.ImageProfile{}, err
+	}
+	id, idErr := strconv.ParseInt(ref, 10, 64)
+	for _, p := range profiles {
+		if (idErr == nil && p.ID == id) || p.Name == ref {
+			return p, nil
+		}
+	}
+	return client.ImageProfile{}, fmt.Errorf("no image profile matches %q", ref)
+}
+
+func cmdSemester(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: fleetctl semester start|preflight|status|pause|resume|cancel|history|templates [flags]")
+	}
+	switch args[0] {
+	case "templates":
+		return cmdSemesterTemplates(ctx, c, opts, args[1:])
+	case "history":
+		return cmdSemesterHistory(ctx, c, opts, args[1:])
+	}
+	fs := flag.NewFlagSet("semester", flag.ContinueOnError)
+	robots := fs.String("robots", "all", "comma-separated robot IDs or names, all, or a selector")
+	reinstall := fs.Bool("reinstall", false, "reinstall the agent")
+	resetLogs := fs.Bool("reset-logs", false, "clear ROS logs")
+	repo := fs.String("repo", "", "git repository to check out (enables repo update)")
+	branch := fs.String("branch", "main", "branch for -repo")
+	path := fs.String("path", "", "workspace path for -repo")
+	selfTest := fs.Bool("self-test", false, "run the self test afterwards")
+	scenarios := fs.String("scenarios", "", "comma-separated scenario IDs or names to apply")
+	template := fs.String("template", "", "run the steps saved in this template instead of the step flags")
+	follow := fs.Bool("f", false, "poll until the batch finishes")
+	check := fs.Bool("preflight", false, "start: check the robots first and don't start if any isn't ready")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "start", "preflight":
+		refs := []string{*robots}
+		if !isSelector(*robots) {
+			refs = strings.Split(*robots, ",")
+		}
+		ids, sel, err := resolveTargets(ctx, c, refs)
+		if err != nil {
+			return err
+		}
+		req := client.SemesterRequest{
+			RobotIDs:    ids,
+			Selector:    sel,
+			Reinstall:   *reinstall,
+			ResetLogs:   *resetLogs,
+			RunSelfTest: *selfTest,
+		}
+		if *repo != "" {
+			req.UpdateRepo = true
+			req.RepoConfig = client.UpdateRepoData{Repo: *repo, Branch: *branch, Path: *path}
+		}
+		if *scenarios != "" {
+			req.ApplyScenarios = true
+			for _, ref := range strings.Split(*scenarios, ",") {
+				s, err := findScenario(ctx, c, strings.TrimSpace(ref))
+				if err != nil {
+					return err
+				}
+				req.ScenarioIDs = append(req.ScenarioIDs, s.ID)
+			}
+		}
+		if *template != "" {
+			t, err := findSemesterTemplate(ctx, c, *template)
+			if err != nil {
+				return err
+			}
+			req.TemplateID = t.ID
+		}
+		if args[0] == "preflight" || *check {
+			report, err := c.PreflightSemester(ctx, req)
+			if err != nil {
+				return err
+			}
+			if opts.json {
+				if err := printJSON(report); err != nil {
+					return err
+				}
+			} else {
+				printSemesterPreflight(report)
+			}
+			if !report.Ready {
+				return errors.New("some robots are not ready")
+			}
+			if args[0] == "preflight" {
+				return nil
+			}
+		}
+		if _, err := c.StartSemester(ctx, req); err != nil {
+			return err
+		}
+		if sel != "" {
+			fmt.Printf("semester batch started for robots matching %s\n", sel)
+		} else {
+			fmt.Printf("semester batch started for %d robot(s)\n", len(ids))
+		}
+		if !*follow {
+			return nil
+		}
+	case "status":
+	case "pause", "resume", "cancel":
+		action := map[string]func(context.Context) (client.SemesterStatusResponse, error){
+			"pause":  c.PauseSemester,
+			"resume": c.ResumeSemester,
+			"cancel": c.CancelSemester,
+		}[args[0]]
+		st, err := action(ctx)
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(st)
+		}
+		printSemesterStatus(st)
+		if !*follow {
+			return nil
+		}
+	default:
+		return fmt.Errorf("unknown semester subcommand %q", args[0])
+	}
+
+	for {
+		st, err := c.GetSemesterStatus(ctx)
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			if err := printJSON(st); err != nil {
+				return err
+			}
+		} else {
+			printSemesterStatus(st)
+		}
+		if !*follow || !st.Active {
+			if len(st.Errors) > 0 {
+				return fmt.Errorf("%d robot(s) failed", len(st.Errors))
+			}
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// cmdSemesterHistory lists past semester batches, or shows one with how
+// long each step took.
+func cmdSemesterHistory(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	fs := flag.NewFlagSet("semester history", flag.ContinueOnError)
+	limit := fs.Int("limit", 20, "how many batches to list")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		batches, err := c.ListSemesterBatches(ctx, client.ListSemesterBatchesParams{Limit: *limit})
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(batches)
+		}
+		tw := newTable("ID", "STARTED", "STATE", "DONE", "FAILED", "DURATION", "BY", "STEPS")
+		for _, b := range batches {
+			tw.row(b.ID, ago(b.CreatedAt), b.State, fmt.Sprintf("%d/%d", b.Completed, b.Total), b.Failed,
+				time.Duration(b.DurationSec)*time.Second, b.CreatedBy, strings.Join(b.Steps, ", "))
+		}
+		return tw.flush()
+	}
+	id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		return errors.New("usage: fleetctl semester history [-limit n] [batch-id]")
+	}
+	b, err := c.GetSemesterBatch(ctx, id)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(b)
+	}
+	fmt.Printf("batch %d: %s, %d/%d done, %d failed, took %s\n", b.ID, b.State, b.Completed, b.Total, b.Failed, time.Duration(b.DurationSec)*time.Second)
+	tw := newTable("#", "STEP", "OK", "FAILED", "AVG", "MAX")
+	for _, st := range b.StepStats {
+		tw.row(st.Index+1, st.Label, st.Succeeded, st.Failed,
+			time.Duration(st.AvgDurationSec*float64(time.Second)).Round(time.Second),
+			time.Duration(st.MaxDurationSec*float64(time.Second)).Round(time.Second))
+	}
+	tw.flush()
+	fmt.Println()
+	tw = newTable("ROBOT", "STATE", "ERROR")
+	for _, r := range b.Robots {
+		name := r.Name
+		if name == "" {
+			name = strconv.FormatInt(r.RobotID, 10)
+		}
+		tw.row(name, r.State, r.Error)
+	}
+	return tw.flush()
+}
+
+// cmdSemesterTemplates lists, shows, saves or removes semester templates.
+func cmdSemesterTemplates(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	if len(args) == 0 {
+		templates, err := c.ListSemesterTemplates(ctx)
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(templates)
+		}
+		tw := newTable("ID", "NAME", "STEPS", "DESCRIPTION")
+		for _, t := range templates {
+			types := make([]string, len(t.Steps))
+			for i, step := range t.Steps {
+				types[i] = semesterStepLabel(step)
+			}
+			tw.row(t.ID, t.Name, strings.Join(types, ", "), t.Description)
+		}
+		return tw.flush()
+	}
+	switch args[0] {
+	case "show":
+		if len(args) != 2 {
+			return errors.New("usage: fleetctl semester templates show <template>")
+		}
+		t, err := findSemesterTemplate(ctx, c, args[1])
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(t)
+		}
+		tw := newTable("#", "STEP", "TYPE", "TIMEOUT")
+		for i, step := range t.Steps {
+			timeout := "default"
+			if step.TimeoutSec > 0 {
+				timeout = fmt.Sprintf("%ds", step.TimeoutSec)
+			}
+			tw.row(i+1, semesterStepLabel(step), step.Type, timeout)
+		}
+		return tw.flush()
+	case "save":
+		// The file is a template as the API returns it; one with the same
+		// name is replaced.
+		if len(args) != 2 {
+			return errors.New("usage: fleetctl semester templates save <file.json|->")
+		}
+		var raw []byte
+		var err error
+		if args[1] == "-" {
+			raw, err = io.ReadAll(os.Stdin)
+		} else {
+			raw, err = os.ReadFile(args[1])
+		}
+		if err != nil {
+			return err
+		}
+		var req client.SemesterTemplateRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			return fmt.Errorf("%s: %w", args[1], err)
+		}
+		var t client.SemesterTemplate
+		if existing, findErr := findSemesterTemplate(ctx, c, req.Name); findErr == nil {
+			t, err = c.UpdateSemesterTemplate(ctx, existing.ID, req)
+		} else {
+			t, err = c.CreateSemesterTemplate(ctx, req)
+		}
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(t)
+		}
+		fmt.Printf("saved semester template %s (%d steps)\n", t.Name, len(t.Steps))
+		return nil
+	case "rm":
+		if len(args) != 2 {
+			return errors.New("usage: fleetctl semester templates rm <template>")
+		}
+		t, err := findSemesterTemplate(ctx, c, args[1])
+		if err != nil {
+			return err
+		}
+		if err := c.DeleteSemesterTemplate(ctx, t.ID); err != nil {
+			return err
+		}
+		fmt.Printf("deleted semester template %s\n", t.Name)
+		return nil
+	default:
+		return fmt.Errorf("unknown semester templates subcommand %q", args[0])
+	}
+}
+
+func semesterStepLabel(step client.SemesterStep) string {
+	switch {
+	case step.Name != "":
+		return step.Name
+	case step.Type == "command":
+		return step.Command
+	}
+	return step.Type
+}
+
+func findSemesterTemplate(ctx context.Context, c *client.Client, ref string) (client.SemesterTemplate, error) {
+	templates, err := c.ListSemesterTemplates(ctx)
+	if err != nil {
+		return client.SemesterTemplate{}, err
+	}
+	id, idErr := strconv.ParseInt(ref, 10, 64)
+	for _, t := range templates {
+		if (idErr == nil && t.ID == id) || t.Name == ref {
+			return t, nil
+		}
+	}
+	return client.SemesterTemplate{}, fmt.Errorf("no semester template matches %q", ref)
+}
+
+func printSemesterPreflight(report client.SemesterPreflight) {
+	tw := newTable("ROBOT", "CHECK", "STATUS", "DETAIL")
+	for _, r := range report.Robots {
+		for _, ch := range r.Checks {
+			tw.row(r.Name, ch.Name, ch.Status, ch.Detail)
+		}
+	}
+	tw.flush()
+	ready := 0
+	for _, r := range report.Robots {
+		if r.Ready {
+			ready++
+		}
+	}
+	fmt.Printf("%d/%d robot(s) ready\n", ready, len(report.Robots))
+}
+
+func printSemesterStatus(st client.SemesterStatusResponse) {
+	state := st.State
+	switch {
+	case state == "":
+		state = "idle"
+	case st.Active && state == "paused":
+		state = "pausing"
+	}
+	fmt.Printf("%s: %d/%d complete\n", state, st.Completed, st.Total)
+	ids := make([]string, 0, len(st.Robots))
+	for id := range st.Robots {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := strconv.Atoi(ids[i])
+		b, _ := strconv.Atoi(ids[j])
+		return a < b
+	})
+	tw := newTable("ROBOT", "STATE", "ERROR")
+	for _, id := range ids {
+		tw.row(id, st.Robots[id], st.Errors[id])
+	}
+	tw.flush()
+}
+
+func cmdScenarios(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: fleetctl scenarios export|import|repo-auth [flags] [args]")
+	}
+	fs := flag.NewFlagSet("scenarios", flag.ContinueOnError)
+	history := fs.Bool("history", false, "export: include where each scenario was applied")
+	out := fs.String("o", "", "export: write the bundle to this file instead of stdout")
+	replace := fs.Bool("replace", false, "import: overwrite scenarios that exist with a different config")
+	dryRun := fs.Bool("dry-run", false, "import: only show what would change")
+	user := fs.String("user", "", "repo-auth: username to send with the token")
+	tokenFile := fs.String("token-file", "", "repo-auth: read an HTTPS token from this file (- for stdin)")
+	sshKey := fs.String("ssh-key", "", "repo-auth: private deploy key file for an SSH repo")
+	remove := fs.Bool("remove", false, "repo-auth: remove the scenario's credentials")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "export":
+		var ids []string
+		for _, ref := range fs.Args() {
+			s, err := findScenario(ctx, c, ref)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, strconv.FormatInt(s.ID, 10))
+		}
+		bundle, err := c.ExportScenarios(ctx, client.ExportScenariosParams{IDs: strings.Join(ids, ","), History: *history})
+		if err != nil {
+			return err
+		}
+		w := os.Stdout
+		if *out != "" {
+			f, err := os.Create(*out)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(bundle); err != nil {
+			return err
+		}
+		if *out != "" {
+			fmt.Printf("exported %d scenario(s) to %s\n", len(bundle.Scenarios), *out)
+		}
+		return nil
+	case "import":
+		if fs.NArg() != 1 {
+			return errors.New("usage: fleetctl scenarios import [-replace] [-dry-run] <file|->")
+		}
+		var raw []byte
+		var err error
+		if fs.Arg(0) == "-" {
+			raw, err = io.ReadAll(os.Stdin)
+		} else {
+			raw, err = os.ReadFile(fs.Arg(0))
+		}
+		if err != nil {
+			return err
+		}
+		req := client.ScenarioImportRequest{Bundle: string(raw), DryRun: *dryRun}
+		if *replace {
+			req.OnConflict = "replace"
+		}
+		resp, err := c.ImportScenarios(ctx, req)
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(resp)
+		}
+		prefix := ""
+		if !resp.Applied {
+			prefix = "would be "
+		}
+		tw := newTable("SCENARIO", "RESULT")
+		for _, name := range resp.Created {
+			tw.row(name, prefix+"created")
+		}
+		for _, name := range resp.Replaced {
+			tw.row(name, prefix+"replaced")
+		}
+		for _, name := range resp.Skipped {
+			tw.row(name, "skipped, exists with a different config (use -replace)")
+		}
+		for _, name := range resp.Unchanged {
+			tw.row(name, "unchanged")
+		}
+		return tw.flush()
+	case "repo-auth":
+		if fs.NArg() != 1 {
+			return errors.New("usage: fleetctl scenarios repo-auth (-token-file <file> [-user <name>] | -ssh-key <file> | -remove) <scenario>")
+		}
+		s, err := findScenario(ctx, c, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		if *remove {
+			if _, err := c.DeleteScenarioRepoAuth(ctx, s.ID); err != nil {
+				return err
+			}
+			fmt.Printf("removed repo credentials from %s\n", s.Name)
+			return nil
+		}
+		var req client.RepoAuthRequest
+		switch {
+		case *tokenFile != "" && *sshKey != "":
+			return errors.New("use either -token-file or -ssh-key")
+		case *tokenFile == "-":
+			raw, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			req.Token, req.Username = strings.TrimSpace(string(raw)), *user
+		case *tokenFile != "":
+			raw, err := os.ReadFile(*tokenFile)
+			if err != nil {
+				return err
+			}
+			req.Token, req.Username = strings.TrimSpace(string(raw)), *user
+		case *sshKey != "":
+			raw, err := os.ReadFile(*sshKey)
+			if err != nil {
+				return err
+			}
+			req.SSHKey = string(raw)
+		default:
+			return errors.New("one of -token-file, -ssh-key or -remove is required")
+		}
+		if _, err := c.SetScenarioRepoAuth(ctx, s.ID, req); err != nil {
+			return err
+		}
+		fmt.Printf("stored repo credentials for %s\n", s.Name)
+		return nil
+	default:
+		return fmt.Errorf("unknown scenarios subcommand %q", args[0])
+	}
+}
+
+func cmdDeploys(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		args = append([]string{"list"}, args...)
+	}
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("deploys", flag.ContinueOnError)
+		pending := fs.Bool("pending", false, "only deploys waiting for approval")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		params := client.ListGitDeploysParams{}
+		if *pending {
+			params.Status = "pending"
+		}
+		deploys, err := c.ListGitDeploys(ctx, params)
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(deploys)
+		}
+		tw := newTable("ID", "SCENARIO", "BRANCH", "COMMIT", "PUSHER", "ROBOTS", "STATUS", "ERROR")
+		for _, d := range deploys {
+			commit := d.Commit
+			if len(commit) > 7 {
+				commit = commit[:7]
+			}
+			tw.row(d.ID, d.ScenarioName, d.Branch, commit, d.Pusher, len(d.RobotIDs), d.Status, d.Error)
+		}
+		return tw.flush()
+	case "approve", "reject":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: fleetctl deploys %s <id>", args[0])
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid deploy id %q", args[1])
+		}
+		decide := c.ApproveGitDeploy
+		if args[0] == "reject" {
+			decide = c.RejectGitDeploy
+		}
+		d, err := decide(ctx, id)
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(d)
+		}
+		fmt.Printf("deploy %d of %s is %s", d.ID, d.ScenarioName, d.Status)
+		if len(d.JobIDs) > 0 {
+			fmt.Printf(" (%d job(s))", len(d.JobIDs))
+		}
+		fmt.Println()
+		if d.Error != "" {
+			fmt.Println(d.Error)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown deploys subcommand %q", args[0])
+	}
+}
+
+func cmdEStop(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	var (
+		st  client.FleetEStopResponse
+		err error
+	)
+	switch {
+	case len(args) > 0 && args[0] == "status":
+		st, err = c.GetFleetEStop(ctx)
+	case len(args) > 0 && args[0] == "clear":
+		st, err = c.ClearFleetEStop(ctx)
+	default:
+		fs := flag.NewFlagSet("estop", flag.ContinueOnError)
+		reason := fs.String("reason", "", "why the fleet was stopped, shown to other operators")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() > 0 {
+			return fmt.Errorf("unknown estop subcommand %q", fs.Arg(0))
+		}
+		st, err = c.EngageFleetEStop(ctx, client.FleetEStopRequest{Reason: *reason})
+	}
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(st)
+	}
+	if st.Engaged {
+		fmt.Printf("fleet e-stop ENGAGED %s", ago(*st.Since))
+		if st.Reason != "" {
+			fmt.Printf(": %s", st.Reason)
+		}
+		fmt.Println()
+	} else {
+		fmt.Println("fleet e-stop clear")
+	}
+	if len(st.Robots) == 0 {
+		return nil
+	}
+	tw := newTable("ROBOT", "STOPPED", "REASON")
+	for _, r := range st.Robots {
+		tw.row(r.Name, ago(r.Since), r.Reason)
+	}
+	return tw.flush()
+}
+
+func cmdSnapshots(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: fleetctl snapshots <robot> | take <robot> | schedules | schedule add|rm|run|enable|disable")
+	}
+	switch args[0] {
+	case "take":
+		if len(args) != 2 {
+			return errors.New("usage: fleetctl snapshots take <robot>")
+		}
+		robot, err := findRobot(ctx, c, args[1])
+		if err != nil {
+			return err
+		}
+		snap, err := c.TakeRobotSnapshot(ctx, robot.ID)
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(snap)
+		}
+		return printSnapshots([]client.RobotSnapshot{snap})
+	case "schedules":
+		schedules, err := c.ListSnapshotSchedules(ctx)
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(schedules)
+		}
+		tw := newTable("ID", "NAME", "ROBOTS", "AT", "DAYS", "ENABLED", "LAST RUN")
+		for _, s := range schedules {
+			days := strings.Join(s.Days, ",")
+			if days == "" {
+				days = "daily"
+			}
+			last := "-"
+			if s.LastRunAt != nil {
+				last = ago(*s.LastRunAt)
+			}
+			tw.row(s.ID, s.Name, s.Robots, s.At, days, s.Enabled, last)
+		}
+		return tw.flush()
+	case "schedule":
+		return cmdSnapshotSchedule(ctx, c, opts, args[1:])
+	default:
+		if len(args) != 1 {
+			return fmt.Errorf("unknown snapshots subcommand %q", args[0])
+		}
+		robot, err := findRobot(ctx, c, args[0])
+		if err != nil {
+			return err
+		}
+		snaps, err := c.ListRobotSnapshots(ctx, robot.ID, client.ListRobotSnapshotsParams{})
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(snaps)
+		}
+		return printSnapshots(snaps)
+	}
+}
+
+func cmdSnapshotSchedule(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: fleetctl snapshots schedule add|rm|run|enable|disable")
+	}
+	if args[0] == "add" {
+		fs := flag.NewFlagSet("snapshots schedule add", flag.ContinueOnError)
+		name := fs.String("name", "", "schedule name")
+		robots := fs.String("robots", "", "robot selector, e.g. tag=classA or all")
+		at := fs.String("at", "", "time of day, HH:MM in the controller's time zone")
+		days := fs.String("days", "", "comma-separated weekdays, e.g. mon,wed; every day if empty")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		req := client.SnapshotScheduleRequest{Name: *name, Robots: *robots, At: *at, Days: []string{}}
+		if *days != "" {
+			req.Days = strings.Split(*days, ",")
+		}
+		s, err := c.CreateSnapshotSchedule(ctx, req)
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(s)
+		}
+		fmt.Printf("snapshot schedule %d (%s) added\n", s.ID, s.Name)
+		return nil
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("usage: fleetctl snapshots schedule %s <id>", args[0])
+	}
+	id, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid schedule id %q", args[1])
+	}
+	switch args[0] {
+	case "rm":
+		if err := c.DeleteSnapshotSchedule(ctx, id); err != nil {
+			return err
+		}
+		fmt.Printf("snapshot schedule %d removed\n", id)
+		return nil
+	case "run":
+		run, err := c.RunSnapshotSchedule(ctx, id)
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(run)
+		}
+		return printSnapshots(run.Snapshots)
+	case "enable", "disable":
+		s, err := c.GetSnapshotSchedule(ctx, id)
+		if err != nil {
+			return err
+		}
+		enabled := args[0] == "enable"
+		s, err = c.UpdateSnapshotSchedule(ctx, id, client.SnapshotScheduleRequest{Name: s.Name, Robots: s.Robots, At: s.At, Days: s.Days, Enabled: &enabled})
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(s)
+		}
+		fmt.Printf("snapshot schedule %d %sd\n", s.ID, args[0])
+		return nil
+	default:
+		return fmt.Errorf("unknown snapshots schedule subcommand %q", args[0])
+	}
+}
+
+func printSnapshots(snaps []client.RobotSnapshot) error {
+	tw := newTable("ID", "ROBOT", "TAKEN", "JOB", "STATUS", "URL", "ERROR")
+	for _, s := range snaps {
+		job := "-"
+		if s.JobID != nil {
+			job = strconv.FormatInt(*s.JobID, 10)
+		}
+		tw.row(s.ID, s.RobotID, ago(s.CreatedAt), job, s.Status, s.URL, s.Error)
+	}
+	return tw.flush()
+}
+
+func cmdBags(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	fs := flag.NewFlagSet("bags", flag.ContinueOnError)
+	experiment := fs.String("experiment", "", "only this experiment's bags; start: tag the bags with it")
+	topics := fs.String("topics", "", "start: comma-separated topics to record; every topic if empty")
+	duration := fs.Int("duration", 60, "start: seconds to record for, at most 3600")
+	out := fs.String("o", "", "get: write the bag here instead of bag-<id>.tar.gz")
+	sub := ""
+	if len(args) > 0 && (args[0] == "start" || args[0] == "stop" || args[0] == "get" || args[0] == "rm") {
+		sub, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch sub {
+	case "start":
+		if fs.NArg() == 0 {
+			return errors.New("usage: fleetctl bags start [-topics a,b] [-duration s] [-experiment e] <robot|selector>... | all")
+		}
+		ids, sel, err := resolveTargets(ctx, c, fs.Args())
+		if err != nil {
+			return err
+		}
+		req := client.BagStartRequest{RobotIDs: ids, Selector: sel, Experiment: *experiment, DurationSec: *duration}
+		if *topics != "" {
+			req.Topics = strings.Split(*topics, ",")
+		}
+		resp, err := c.StartBags(ctx, req)
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(resp)
+		}
+		if err := printBags(resp.Bags); err != nil {
+			return err
+		}
+		if len(resp.Skipped) > 0 {
+			fmt.Printf("skipped (no agent): %s\n", strings.Join(resp.Skipped, ", "))
+		}
+		return nil
+	case "stop", "get", "rm":
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: fleetctl bags %s <id>", sub)
+		}
+		id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid bag id %q", fs.Arg(0))
+		}
+		switch sub {
+		case "stop":
+			job, err := c.StopBag(ctx, id)
+			if err != nil {
+				return err
+			}
+			if opts.json {
+				return printJSON(job)
+			}
+			fmt.Printf("stopping bag %d (job %d); it is uploaded once stopped\n", id, job.ID)
+			return nil
+		case "rm":
+			if err := c.DeleteBag(ctx, id); err != nil {
+				return err
+			}
+			fmt.Printf("bag %d deleted\n", id)
+			return nil
+		}
+		body, err := c.DownloadBag(ctx, id)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+		name := *out
+		if name == "" {
+			name = fmt.Sprintf("bag-%d.tar.gz", id)
+		}
+		f, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(f, body)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("saved bag %d to %s (%d bytes)\n", id, name, n)
+		return nil
+	}
+
+	if fs.NArg() > 1 {
+		return errors.New("usage: fleetctl bags [-experiment e] [robot]")
+	}
+	var bags []client.Bag
+	var err error
+	if fs.NArg() == 1 {
+		robot, ferr := findRobot(ctx, c, fs.Arg(0))
+		if ferr != nil {
+			return ferr
+		}
+		bags, err = c.ListRobotBags(ctx, robot.ID, client.ListRobotBagsParams{Experiment: *experiment})
+	} else {
+		bags, err = c.ListBags(ctx, client.ListBagsParams{Experiment: *experiment})
+	}
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(bags)
+	}
+	return printBags(bags)
+}
+
+func printBags(bags []client.Bag) error {
+	tw := newTable("ID", "ROBOT", "EXPERIMENT", "TOPICS", "DURATION", "STARTED", "STATUS", "SIZE", "ERROR")
+	for _, b := range bags {
+		topics := strings.Join(b.Topics, ",")
+		if topics == "" {
+			topics = "all"
+		}
+		size := "-"
+		if b.SizeBytes > 0 {
+			size = fmt.Sprintf("%.1f MB", float64(b.SizeBytes)/(1<<20))
+		}
+		tw.row(b.ID, b.RobotID, b.Experiment, topics, fmt.Sprintf("%ds", b.DurationSec), ago(b.CreatedAt), b.Status, size, b.Error)
+	}
+	return tw.flush()
+}
+
+func cmdPool(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	fs := flag.NewFlagSet("pool", flag.ContinueOnError)
+	mac := fs.String("mac", "", "add: the robot's MAC address")
+	serial := fs.String("serial", "", "add: the robot's serial number")
+	rType := fs.String("type", "", "add: robot (default) or laptop")
+	tags := fs.String("tags", "", "add: comma-separated tags for the robot")
+	notes := fs.String("notes", "", "add: notes for the robot")
+	rotate := fs.Bool("rotate", false, "token, agent-token: replace the token (or key); images built with the old one stop enrolling")
+	label := fs.String("label", "", "agent-token: what the token is for")
+	ttl := fs.Int("ttl", 0, "agent-token: hours the token lets agents in (default until -rotate)")
+	sub := "list"
+	if len(args) > 0 && slices.Contains([]string{"list", "add", "rm", "reset", "token", "agent-token"}, args[0]) {
+		sub, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch sub {
+	case "add":
+		if fs.NArg() != 1 {
+			return errors.New("usage: fleetctl pool add [-mac m] [-serial s] [-type t] [-tags a,b] [-notes n] <name>")
+		}
+		req := client.EnrollmentSlotRequest{Name: fs.Arg(0), MAC: *mac, Serial: *serial, Type: *rType, Notes: *notes}
+		if *tags != "" {
+			req.Tags = strings.Split(*tags, ",")
+		}
+		slot, err := c.CreateEnrollmentSlot(ctx, req)
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(slot)
+		}
+		fmt.Printf("%s added to the enrollment pool (slot %d)\n", slot.Name, slot.ID)
+		return nil
+	case "rm":
+		if fs.NArg() != 1 {
+			return errors.New("usage: fleetctl pool rm <id>")
+		}
+		id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid slot id %q", fs.Arg(0))
+		}
+		if err := c.DeleteEnrollmentSlot(ctx, id); err != nil {
+			return err
+		}
+		fmt.Printf("slot %d removed\n", id)
+		return nil
+	case "reset":
+		if fs.NArg() != 1 {
+			return errors.New("usage: fleetctl pool reset <id>")
+		}
+		id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid slot id %q", fs.Arg(0))
+		}
+		slot, err := c.ResetEnrollmentSlot(ctx, id)
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(slot)
+		}
+		fmt.Printf("%s can enroll again\n", slot.Name)
+		return nil
+	case "token":
+		var resp client.ProvisioningTokenResponse
+		var err error
+		if *rotate {
+			resp, err = c.RotateProvisioningToken(ctx)
+		} else {
+			resp, err = c.GetProvisioningToken(ctx)
+		}
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(resp)
+		}
+		fmt.Println(resp.Token)
+		if *rotate {
+			fmt.Println("rebuild the golden image; images built with the old token can no longer enroll")
+		}
+		return nil
+	case "agent-token":
+		if *rotate {
+			if err := c.RotateEnrollmentKey(ctx); err != nil {
+				return err
+			}
+			fmt.Println("enrollment key rotated; new agents with tokens issued before need a new one")
+			return nil
+		}
+		resp, err := c.CreateEnrollmentToken(ctx, client.EnrollmentTokenRequest{Label: *label, TtlHours: *ttl})
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(resp)
+		}
+		fmt.Println(resp.Token)
+		return nil
+	}
+
+	slots, err := c.ListEnrollmentPool(ctx)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(slots)
+	}
+	tw := newTable("ID", "NAME", "MAC", "SERIAL", "TYPE", "TAGS", "ENROLLED")
+	for _, s := range slots {
+		enrolled := "-"
+		if s.EnrolledAt != nil {
+			enrolled = ago(*s.EnrolledAt)
+		}
+		tw.row(s.ID, s.Name, s.MAC, s.Serial, s.Type, strings.Join(s.Tags, ","), enrolled)
+	}
+	return tw.flush()
+}
+
+func cmdPending(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	fs := flag.NewFlagSet("pending", flag.ContinueOnError)
+	name := fs.String("name", "", "approve: name for the robot (default the agent's)")
+	sub := "list"
+	if len(args) > 0 && (args[0] == "list" || args[0] == "approve" || args[0] == "reject") {
+		sub, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch sub {
+	case "approve":
+		if fs.NArg() != 1 {
+			return errors.New("usage: fleetctl pending approve [-name n] <agent>")
+		}
+		robot, err := c.ApprovePendingAgent(ctx, fs.Arg(0), client.ApproveAgentRequest{Name: *name})
+		if err != nil {
+			return err
+		}
+		if opts.json {
+			return printJSON(robot)
+		}
+		fmt.Printf("%s approved as robot %d (%s)\n", fs.Arg(0), robot.ID, robot.Name)
+		return nil
+	case "reject":
+		if fs.NArg() != 1 {
+			return errors.New("usage: fleetctl pending reject <agent>")
+		}
+		if err := c.RejectPendingAgent(ctx, fs.Arg(0)); err != nil {
+			return err
+		}
+		fmt.Printf("%s rejected; its heartbeats are ignored\n", fs.Arg(0))
+		return nil
+	}
+
+	agents, err := c.ListPendingAgents(ctx)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(agents)
+	}
+	tw := newTable("AGENT", "NAME", "IP", "TYPE", "REASON", "FIRST SEEN", "LAST SEEN", "REJECTED")
+	for _, a := range agents {
+		tw.row(a.AgentID, a.Name, a.IP, a.Type, a.Reason, ago(a.FirstSeen), ago(a.LastSeen), a.Rejected)
+	}
+	return tw.flush()
+}
+
+func cmdHostKey(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	sub := "show"
+	if len(args) > 0 && args[0] == "reset" {
+		sub, args = args[0], args[1:]
+	}
+	if len(args) != 1 {
+		return errors.New("usage: fleetctl hostkey <robot> | reset <robot>")
+	}
+	robot, err := findRobot(ctx, c, args[0])
+	if err != nil {
+		return err
+	}
+	if sub == "reset" {
+		if err := c.ResetRobotHostKey(ctx, robot.ID); err != nil {
+			return err
+		}
+		fmt.Printf("%s: host key forgotten; the next SSH login records the one it presents\n", robot.Name)
+		return nil
+	}
+	key, err := c.GetRobotHostKey(ctx, robot.ID)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(key)
+	}
+	fmt.Printf("%s  %s  (first seen %s)\n", robot.Name, key.Fingerprint, ago(key.FirstSeen))
+	return nil
+}
+
+func cmdSSHKeygen(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	fs := flag.NewFlagSet("ssh-keygen", flag.ContinueOnError)
+	replace := fs.Bool("replace", false, "overwrite the current default key")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	key, err := c.GenerateSSHKey(ctx, client.SshKeygenRequest{Replace: *replace})
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(key)
+	}
+	fmt.Println(key.SSHPublicKey)
+	if !key.Encrypted {
+		fmt.Fprintln(os.Stderr, "fleetctl: no SECRETS_KEY on the controller; the private key is stored unencrypted")
+	}
+	return nil
+}
+
+func cmdOpenAPI(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	doc, err := c.GetOpenAPI(ctx)
+	if err != nil {
+		return err
+	}
+	return printJSON(doc)
+}
+
+// findRobot resolves a robot by ID, name or agent ID.
+func findRobot(ctx context.Context, c *client.Client, ref string) (client.Robot, error) {
+	robots, err := c.ListRobots(ctx, client.ListRobotsParams{})
+	if err != nil {
+		return client.Robot{}, err
+	}
+	return matchRobot(robots, ref)
+}
+
+func matchRobot(robots []client.Robot, ref string) (client.Robot, error) {
+	ref = strings.TrimSpace(ref)
+	id, idErr := strconv.ParseInt(ref, 10, 64)
+	for _, r := range robots {
+		if (idErr == nil && r.ID == id) || r.Name == ref || r.AgentID == ref {
+			return r, nil
+		}
+	}
+	return client.Robot{}, fmt.Errorf("no robot matches %q", ref)
+}
+
+// resolveTargets turns robot references (or the single word all) into IDs.
+// References that are selectors, like tag=classA, are or-ed together and
+// returned for the controller to evaluate.
+func resolveTargets(ctx context.Context, c *client.Client, refs []string) ([]int64, string, error) {
+	var ids []int64
+	var selectors []string
+	var plain []string
+	for _, ref := range refs {
+		if isSelector(ref) {
+			selectors = append(selectors, "("+ref+")")
+		} else {
+			plain = append(plain, ref)
+		}
+	}
+	sel := strings.Join(selectors, " or ")
+	if len(plain) == 0 {
+		return nil, sel, nil
+	}
+	robots, err := c.ListRobots(ctx, client.ListRobotsParams{})
+	if err != nil {
+		return nil, "", err
+	}
+	if len(plain) == 1 && plain[0] == "all" {
+		for _, r := range robots {
+			ids = append(ids, r.ID)
+		}
+		return ids, sel, nil
+	}
+	for _, ref := range plain {
+		r, err := matchRobot(robots, ref)
+		if err != nil {
+			return nil, "", err
+		}
+		ids = append(ids, r.ID)
+	}
+	return ids, sel, nil
+}
+
+// isSelector reports whether ref is a selector expression rather than a
+// robot name or ID. Names can't contain operators, parentheses or spaces.
+func isSelector(ref string) bool {
+	return strings.ContainsAny(strings.TrimSpace(ref), "=~() ")
+}
+
+func findScenario(ctx context.Context, c *client.Client, ref string) (client.Scenario, error) {
+	scenarios, err := c.ListScenarios(ctx)
+	if err != nil {
+		return client.Scenario{}, err
+	}
+	id, idErr := strconv.ParseInt(ref, 10, 64)
+	for _, s := range scenarios {
+		if (idErr == nil && s.ID == id) || s.Name == ref {
+			return s, nil
+		}
+	}
+	return client.Scenario{}, fmt.Errorf("no scenario matches %q", ref)
+}
+
+func sortJobs(jobs []client.Job) {
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+}
+
+func issuer(j client.Job) string {
+	if j.OnBehalfOf != "" {
+		return j.IssuedBy + " for " + j.OnBehalfOf
+	}
+	return j.IssuedBy
+}
+
+func cmdUsage(ctx context.Context, c *client.Client, opts globalOptions, args []string) error {
+	u, err := c.GetUsage(ctx)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(u)
+	}
+	gib := func(n int64) string { return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30)) }
+	of := func(limited bool, s string) string {
+		if !limited {
+			return ""
+		}
+		return " of " + s
+	}
+	fmt.Printf("since %s\n", u.PeriodStart.Local().Format("2006-01-02"))
+	fmt.Printf("robots:        %d%s\n", u.Robots, of(u.Limits.Robots > 0, strconv.Itoa(u.Limits.Robots)))
+	fmt.Printf("active agents: %d (%d online now)\n", u.ActiveAgents, u.OnlineAgents)
+	fmt.Printf("builds:        %d%s (%d in all)\n", u.Builds, of(u.Limits.BuildsPerMonth > 0, strconv.Itoa(u.Limits.BuildsPerMonth)), u.BuildsTotal)
+	fmt.Printf("storage:       %s%s\n", gib(u.StorageBytes), of(u.Limits.StorageBytes > 0, gib(u.Limits.StorageBytes)))
+	if len(u.Exceeded) > 0 {
+		verb := "reported only"
+		if u.Enforced {
+			verb = "enforced"
+		}
+		fmt.Printf("limits reached (%s): %s\n", verb, strings.Join(u.Exceeded, ", "))
+	}
+	return nil
+}
+
+func ago(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	d := time.Since(t).Round(time.Second)
+	switch {
+	case d < time.Minute:
+		return d.String() + " ago"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	}
+	return t.Local().Format("2006-01-02")
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+type table struct {
+	w *tabwriter.Writer
+}
+
+func newTable(headers ...string) *table {
+	t := &table{w: tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)}
+	fmt.Fprintln(t.w, strings.Join(headers, "\t"))
+	return t
+}
+
+func (t *table) row(cols ...interface{}) {
+	for i, c := range cols {
+		if i > 0 {
+			io.WriteString(t.w, "\t")
+		}
+		fmt.Fprint(t.w, c)
+	}
+	fmt.Fprintln(t.w)
+}
+
+func (t *table) flush() error {
+	return t.w.Flush()
+}
@@ -0,0 +1,138 @@
+// Command fleetctl drives the controller API from a terminal or script.
+//
+// Usage:
+//
+//	fleetctl [global flags] <command> [args]
+//
+// The controller URL and credentials come from -url / FLEET_URL and
+// FLEET_PASSWORD (or FLEET_TOKEN for an existing session cookie).
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"example.com/openrobot-fleet/client"
+)
+
+type globalOptions struct {
+	url        string
+	password   string
+	token      string
+	onBehalfOf string
+	json       bool
+}
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, c *client.Client, opts globalOptions, args []string) error
+}
+
+var commands = []command{
+	{"robots", "[selector]", "List robots, optionally only those matching a selector", cmdRobots},
+	{"pending", "[list] | approve [-name n] <agent> | reject <agent>", "List new agents waiting for approval, or approve or reject one", cmdPending},
+	{"hostkey", "<robot> | reset <robot>", "Show the SSH host key recorded for a robot, or forget it after a reflash", cmdHostKey},
+	{"command", "[-priority p] [-at-boot] <robot|all|selector> <type> [json-data]", "Send a command to a robot (or every robot)", cmdCommand},
+	{"apply", "[-force] <scenario> <robot|selector>... | all", "Apply a scenario to robots", cmdApply},
+	{"apply", "-f fleet.yaml [-dry-run] [-prune]", "Reconcile the fleet against a declarative file", cmdApply},
+	{"sensors", "[-o frame.jpg] <robot>", "Read every sensor once (lidar, camera, odom)", cmdSensors},
+	{"formation", "[-delay s] [-distance m] [-speed m/s] <robot|selector>... | all", "Drive robots forward together to check latency and readiness", cmdFormation},
+	{"nav", "-x m -y m [-yaw rad] [-frame f] [-timeout s] [-f] <robot|selector>... | all", "Send robots a Nav2 goal; -f waits for them to arrive", cmdNav},
+	{"missions", "| show <mission> | save <file.json> | rm <mission> | run [-loops n] [-timeout s] [-f] <mission> <robot|selector>... | all", "Manage waypoint missions and send robots along them", cmdMissions},
+	{"jobs", "[-robot agent-id] [-f]", "List jobs; -f keeps printing status changes", cmdJobs},
+	{"images", "| show <profile> | save <file.json> | rm <profile> | get [-user-data] [-o file] <profile> | flash [-tags a,b] [-o file] <profile> <robot>", "Manage golden image profiles, download their images, and pre-register a robot to flash a card for", cmdImages},
+	{"build", "start [-profile p] [-from-cache] | refresh [-f] <id> | status [-f] [id] | cancel [-f] [id] | history [-profile p] [id] | get [-o file] [-key pub] <id> | key | storage | prune | rm <id> | clear-cache", "Queue or cancel golden image builds, refresh a build's image with the current agent, show progress and past builds, download and verify a build's image, print the image signing key, or show and free the disk images take", cmdBuild},
+	{"semester", "start|preflight|status|pause|resume|cancel|history|templates [flags]", "Check the robots for, run, pause, resume or cancel a semester reset batch, show its progress or past batches, or manage saved step lists", cmdSemester},
+	{"scenarios", "export [-history] [-o file] [scenario...] | import [-replace] [-dry-run] <file> | repo-auth (-token-file f [-user u] | -ssh-key f | -remove) <scenario>", "Move scenarios between controllers; set private repo credentials", cmdScenarios},
+	{"deploys", "[-pending] | approve <id> | reject <id>", "List git webhook deploys or decide on one awaiting approval", cmdDeploys},
+	{"estop", "[-reason text] | status | clear", "Emergency stop every robot, show which are stopped, or clear it", cmdEStop},
+	{"snapshots", "<robot> | take <robot> | schedules | schedule add -name n -robots sel -at HH:MM [-days mon,wed] | schedule rm|run|enable|disable <id>", "Show or take camera snapshots; manage snapshot schedules", cmdSnapshots},
+	{"bags", "[-experiment e] [robot] | start [-topics a,b] [-duration s] [-experiment e] <robot|selector>... | all | stop|rm <id> | get [-o file] <id>", "List, record, stop or download ROS bags", cmdBags},
+	{"pool", "[list] | add [-mac m] [-serial s] [-type t] [-tags a,b] [-notes n] <name> | rm <id> | reset <id> | token [-rotate] | agent-token [-label l] [-ttl hours] [-rotate]", "Pre-register robots for zero-touch enrollment; issue agent enrollment tokens", cmdPool},
+	{"ssh-keygen", "[-replace]", "Have the controller generate its default SSH install key and print the public key", cmdSSHKeygen},
+	{"usage", "", "Show this month's robots, active agents, builds and storage against any limits", cmdUsage},
+	{"openapi", "", "Print the controller's OpenAPI document", cmdOpenAPI},
+}
+
+func main() {
+	var opts globalOptions
+	flag.StringVar(&opts.url, "url", envOr("FLEET_URL", "http://localhost:8080"), "controller base URL (FLEET_URL)")
+	flag.StringVar(&opts.onBehalfOf, "on-behalf-of", os.Getenv("FLEET_ON_BEHALF_OF"), "record commands as issued for this user")
+	flag.BoolVar(&opts.json, "json", false, "print JSON instead of tables")
+	flag.Usage = usage
+	flag.Parse()
+	opts.password = os.Getenv("FLEET_PASSWORD")
+	opts.token = os.Getenv("FLEET_TOKEN")
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	name, args := flag.Arg(0), flag.Args()[1:]
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "fleetctl: unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c, err := connect(ctx, opts)
+	if err == nil {
+		err = cmd.run(ctx, c, opts, args)
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "fleetctl:", err)
+		var apiErr *client.Error
+		if errors.As(err, &apiErr) && apiErr.StatusCode == 401 && opts.password == "" && opts.token == "" {
+			fmt.Fprintln(os.Stderr, "fleetctl: set FLEET_PASSWORD or FLEET_TOKEN to authenticate")
+		}
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: fleetctl [flags] <command> [args]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-9s %-36s %s\n", c.name, c.args, c.summary)
+	}
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+	fmt.Fprintf(out, "\nAuthentication: set FLEET_PASSWORD (the dashboard admin password) or FLEET_TOKEN.\n")
+}
+
+func connect(ctx context.Context, opts globalOptions) (*client.Client, error) {
+	c := client.New(opts.url)
+	c.OnBehalfOf = opts.onBehalfOf
+	switch {
+	case opts.token != "":
+		return c, c.SetToken(opts.token)
+	case opts.password != "":
+		if err := c.Login(ctx, client.LoginRequest{Password: opts.password}); err != nil {
+			return nil, fmt.Errorf("login: %w", err)
+		}
+	}
+	return c, nil
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
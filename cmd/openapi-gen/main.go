@@ -0,0 +1,51 @@
+// Command openapi-gen writes the controller's OpenAPI document and the
+// clients generated from it. Run it through go generate ./client.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"example.com/openrobot-fleet/internal/http"
+	"example.com/openrobot-fleet/internal/openapi"
+)
+
+func main() {
+	specPath := flag.String("spec", "openapi.json", "where to write the OpenAPI document")
+	goPath := flag.String("go", "", "where to write the Go client (skipped if empty)")
+	goPkg := flag.String("pkg", "client", "package name for the Go client")
+	tsPath := flag.String("ts", "", "where to write the TypeScript types (skipped if empty)")
+	flag.Parse()
+
+	doc := httpserver.OpenAPIDocument()
+
+	spec, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		fail(err)
+	}
+	write(*specPath, append(spec, '\n'))
+
+	if *goPath != "" {
+		src, err := openapi.GenerateGo(doc, *goPkg)
+		if err != nil {
+			fail(fmt.Errorf("format go client: %w", err))
+		}
+		write(*goPath, src)
+	}
+	if *tsPath != "" {
+		write(*tsPath, openapi.GenerateTS(doc))
+	}
+}
+
+func write(path string, data []byte) {
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "openapi-gen:", err)
+	os.Exit(1)
+}
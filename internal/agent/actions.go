@@ -2,10 +2,12 @@ package agent
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"os"
@@ -14,8 +16,6 @@ import (
 	"strings"
 	"syscall"
 	"time"
-
-	"gopkg.in/yaml.v3"
 )
 
 // HandleConfigureAgent updates the agent configuration and restarts the service.
@@ -26,6 +26,12 @@ func HandleConfigureAgent(cfg Config, data ConfigureAgentData) error {
 
 	// Update config struct
 	cfg.AgentID = data.AgentID
+	if data.Type != "" {
+		cfg.Type = data.Type
+	}
+	if data.ROSContainer != nil {
+		cfg.ROSContainer = *data.ROSContainer
+	}
 
 	// Write back to file
 	cfgPath := os.Getenv("AGENT_CONFIG_PATH")
@@ -33,24 +39,11 @@ func HandleConfigureAgent(cfg Config, data ConfigureAgentData) error {
 		cfgPath = "/etc/openrobotfleet-agent/config.yaml"
 	}
 
-	// Read existing to preserve other fields if needed, but we have full config in memory usually.
-	// Actually cfg passed here is a copy.
-	// Let's just marshal the updated cfg.
-	// Wait, cfg passed to this function might be incomplete if we don't pass the full config around.
-	// But LoadConfig returns full config.
-	// Let's re-read to be safe or just use what we have.
-	// The cfg passed to HandleConfigureAgent comes from e.Config in engine.go, which is loaded at startup.
-
-	bytes, err := yaml.Marshal(cfg)
-	if err != nil {
-		return fmt.Errorf("marshal config: %w", err)
-	}
-
-	if err := os.WriteFile(cfgPath, bytes, 0644); err != nil {
-		return fmt.Errorf("write config: %w", err)
+	if err := SaveConfig(cfgPath, cfg); err != nil {
+		return err
 	}
 
-	log.Printf("[agent] updated config with new agent_id: %s", data.AgentID)
+	slog.Info("updated config", "agent_id", data.AgentID, "type", cfg.Type, "ros_container", cfg.ROSContainer)
 
 	// Restart service
 	// We assume systemd
@@ -58,7 +51,7 @@ func HandleConfigureAgent(cfg Config, data ConfigureAgentData) error {
 		time.Sleep(1 * time.Second)
 		cmd := exec.Command("systemctl", "restart", "openrobotfleet-agent")
 		if err := cmd.Run(); err != nil {
-			log.Printf("failed to restart agent: %v", err)
+			slog.Error("failed to restart agent", "err", err)
 			// Fallback: exit and let systemd restart us
 			os.Exit(0)
 		}
@@ -67,34 +60,106 @@ func HandleConfigureAgent(cfg Config, data ConfigureAgentData) error {
 	return nil
 }
 
-// HandleUpdateRepo clones the requested git repository to the target directory.
+// HandleUpdateRepo brings the target directory to the requested repo version:
+// an existing checkout of the same repo is fetched and reset in place, keeping
+// ignored build artifacts, and anything else is deleted and cloned again.
 func HandleUpdateRepo(cfg Config, data UpdateRepoData) error {
 	if data.Repo == "" {
 		return errors.New("repo is required")
 	}
-	branch := data.Branch
-	if branch == "" {
-		branch = "main"
+	if data.Branch == "" && data.Tag == "" && data.Commit == "" {
+		data.Branch = "main"
 	}
 	target := destinationPath(cfg.WorkspacePath, data.Path, data.Repo)
 	if target == "" || target == "/" {
 		return errors.New("invalid target path")
 	}
+	clone, err := cloneArgs(data, target)
+	if err != nil {
+		return err
+	}
+	env, cleanup, err := gitAuth(context.Background(), cfg, data.Auth)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	ctx := context.Background()
+	if err := updateCheckout(ctx, cfg, env, target, data); err == nil {
+		if err := ownWorkspace(ctx, cfg, target); err != nil {
+			return err
+		}
+		recordWorkspace(target, data.Tag)
+		slog.Info("updated repo", "repo", data.Repo, "branch", data.Branch, "tag", data.Tag, "commit", data.Commit, "target", target, "container", cfg.ROSContainer)
+		return nil
+	} else if !errors.Is(err, errNoCheckout) {
+		slog.Warn("cannot update checkout in place, cloning again", "target", target, "err", err)
+	}
+	if cfg.ROSContainer != "" {
+		return updateRepoInContainer(cfg, data, clone, target, env)
+	}
 	if err := os.RemoveAll(target); err != nil {
 		return fmt.Errorf("clean target %s: %w", target, err)
 	}
 	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
 		return fmt.Errorf("prepare parent %s: %w", filepath.Dir(target), err)
 	}
-	cmd := exec.Command("git", "clone", "--branch", branch, "--single-branch", data.Repo, target)
+	cmd := exec.Command(clone[0], clone[1:]...)
+	cmd.Env = append(os.Environ(), env...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("git clone failed: %w: %s", err, strings.TrimSpace(string(output)))
 	}
-	if err := ensureOwnership(target, cfg); err != nil {
+	if err := pinCheckout(ctx, cfg, env, target, data); err != nil {
+		return fmt.Errorf("pin checkout: %w", err)
+	}
+	if err := ownWorkspace(ctx, cfg, target); err != nil {
+		return err
+	}
+	recordWorkspace(target, data.Tag)
+	slog.Info("cloned repo", "repo", data.Repo, "branch", data.Branch, "tag", data.Tag, "commit", data.Commit, "target", target)
+	return nil
+}
+
+// updateRepoInContainer is HandleUpdateRepo's fresh clone for a workspace
+// inside the ROS container; git must be installed in the image. env is passed
+// to git.
+func updateRepoInContainer(cfg Config, data UpdateRepoData, clone []string, target string, env []string) error {
+	ctx := context.Background()
+	steps := [][]string{
+		{"sh", "-c", `rm -rf "$1" && mkdir -p "$(dirname "$1")"`, "sh", target},
+		clone,
+	}
+	for _, args := range steps {
+		cmd := cfg.command(ctx, args...)
+		if args[0] == "git" {
+			cmd = cfg.commandEnv(ctx, env, args...)
+		}
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%s in %s failed: %w: %s", args[0], cfg.ROSContainer, err, strings.TrimSpace(string(output)))
+		}
+	}
+	if err := pinCheckout(ctx, cfg, env, target, data); err != nil {
+		return fmt.Errorf("pin checkout in %s: %w", cfg.ROSContainer, err)
+	}
+	if err := ownWorkspace(ctx, cfg, target); err != nil {
 		return err
 	}
-	log.Printf("[agent] cloned %s (branch %s) into %s", data.Repo, branch, target)
+	recordWorkspace(target, data.Tag)
+	slog.Info("cloned repo", "repo", data.Repo, "branch", data.Branch, "tag", data.Tag, "commit", data.Commit, "target", target, "container", cfg.ROSContainer)
+	return nil
+}
+
+// ownWorkspace gives target, a checkout or the workspace, to the workspace
+// owner, on the host or in the ROS container.
+func ownWorkspace(ctx context.Context, cfg Config, target string) error {
+	if cfg.ROSContainer == "" {
+		return ensureOwnership(target, cfg)
+	}
+	if owner := strings.TrimSpace(cfg.WorkspaceOwner); owner != "" {
+		if output, err := cfg.command(ctx, "chown", "-R", owner, target).CombinedOutput(); err != nil {
+			return fmt.Errorf("chown in %s failed: %w: %s", cfg.ROSContainer, err, strings.TrimSpace(string(output)))
+		}
+	}
 	return nil
 }
 
@@ -139,110 +204,98 @@ func HandleResetLogs(cfg Config, data ResetLogsData) error {
 			return err
 		}
 	}
-	log.Printf("[agent] reset logs for %d path(s)", len(paths))
+	slog.Info("reset logs", "paths", len(paths))
 	return nil
 }
 
 // HandleRestartROS restarts the ROS service via systemd or a custom command.
 func HandleRestartROS(cfg Config) error {
-	cmdArgs := customRestartCommand()
+	cmdArgs := customRestartCommand(cfg)
 	cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("restart ros failed: %w: %s", err, strings.TrimSpace(string(output)))
 	}
-	log.Printf("[agent] restarted ROS using %s", strings.Join(cmdArgs, " "))
-	return nil
-}
-
-// HandleTestDrive executes a short movement pattern.
-func HandleTestDrive(cfg Config, data TestDriveData) error {
-	log.Printf("[agent] starting test drive")
-
-	// Twist message for forward motion
-	// linear.x = 0.1, angular.z = 0.0
-	cmdForward := exec.Command("ros2", "topic", "pub", "--once", "/cmd_vel", "geometry_msgs/msg/Twist", "{linear: {x: 0.1, y: 0.0, z: 0.0}, angular: {x: 0.0, y: 0.0, z: 0.0}}")
-	if out, err := cmdForward.CombinedOutput(); err != nil {
-		return fmt.Errorf("forward failed: %v: %s", err, string(out))
-	}
-
-	time.Sleep(time.Duration(data.DurationSec) * time.Second)
-
-	// Stop
-	cmdStop := exec.Command("ros2", "topic", "pub", "--once", "/cmd_vel", "geometry_msgs/msg/Twist", "{linear: {x: 0.0, y: 0.0, z: 0.0}, angular: {x: 0.0, y: 0.0, z: 0.0}}")
-	if out, err := cmdStop.CombinedOutput(); err != nil {
-		return fmt.Errorf("stop failed: %v: %s", err, string(out))
-	}
-
-	log.Printf("[agent] test drive complete")
+	slog.Info("restarted ROS", "cmd", strings.Join(cmdArgs, " "))
 	return nil
 }
 
 // HandleStop publishes zero velocity.
 func HandleStop(cfg Config) error {
-	log.Printf("[agent] stopping robot")
-	cmd := exec.Command("ros2", "topic", "pub", "--once", "/cmd_vel", "geometry_msgs/msg/Twist", "{linear: {x: 0.0, y: 0.0, z: 0.0}, angular: {x: 0.0, y: 0.0, z: 0.0}}")
+	slog.Info("stopping robot")
+	cmd := cfg.rosCommand(context.Background(), "ros2", "topic", "pub", "--once", "/cmd_vel", "geometry_msgs/msg/Twist", "{linear: {x: 0.0, y: 0.0, z: 0.0}, angular: {x: 0.0, y: 0.0, z: 0.0}}")
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("stop failed: %v: %s", err, string(out))
 	}
 	return nil
 }
 
-// HandleIdentify makes the robot beep and flash LEDs to identify itself.
+// HandleIdentify makes the robot beep and flash LEDs to identify itself,
+// using whatever its hardware profile says the board has.
 func HandleIdentify(cfg Config, data IdentifyData) error {
-	log.Println("[agent] identifying robot...")
-
-	// Blink Pi LED (fire and forget)
-	blinkPiLED(data.Pattern, data.Duration)
+	hw := ResolveHardware(cfg)
+	slog.Info("identifying robot", "model", hw.Model, "audio", hw.Audio, "display", hw.Display)
+
+	// Blink board LEDs (fire and forget)
+	blinkLEDs(hw, data.Pattern, data.Duration)
+
+	switch hw.Audio {
+	case AudioROS:
+		if err := rosBeep(cfg); err != nil {
+			slog.Warn("failed to beep via ROS", "err", err)
+			// Fall back to the sound card if ROS fails
+			playTone()
+		}
+	case AudioALSA:
+		playTone()
+	}
 
-	if cfg.Type == "laptop" {
-		return identifyLaptop(data)
+	switch hw.Display {
+	case DisplayLightring:
+		flashLightring(cfg)
+	case DisplayConsole:
+		showOnConsole(data)
 	}
+	return nil
+}
 
-	// 1. Beep
+// rosBeep plays two beeps on the Create 3.
+func rosBeep(cfg Config) error {
 	// Create 3 uses /cmd_audio (irobot_create_msgs/msg/AudioNoteVector)
-	// We'll try a simple beep sequence.
 	// Note: This requires the irobot_create_msgs package to be installed/sourced.
-	// If not available, this might fail, but we'll log it.
-	// Sequence: 2 beeps
-	beepCmd := exec.Command("ros2", "topic", "pub", "--once", "/cmd_audio", "irobot_create_msgs/msg/AudioNoteVector",
+	beepCmd := cfg.rosCommand(context.Background(), "ros2", "topic", "pub", "--once", "/cmd_audio", "irobot_create_msgs/msg/AudioNoteVector",
 		`{append: false, notes: [{frequency: 880, max_runtime: {sec: 0, nanosec: 500000000}}, {frequency: 0, max_runtime: {sec: 0, nanosec: 100000000}}, {frequency: 880, max_runtime: {sec: 0, nanosec: 500000000}}]}`)
 	if out, err := beepCmd.CombinedOutput(); err != nil {
-		log.Printf("[agent] failed to beep via ROS: %v: %s", err, string(out))
-		// Fallback to laptop identification (system beep) if ROS fails
-		if err := identifyLaptop(data); err != nil {
-			log.Printf("[agent] fallback identify failed: %v", err)
-		}
+		return fmt.Errorf("%v: %s", err, string(out))
 	}
+	return nil
+}
 
-	// 2. Flash LEDs
+// flashLightring turns the Create 3 light ring red for a second.
+func flashLightring(cfg Config) {
 	// Create 3 uses /cmd_lightring (irobot_create_msgs/msg/LightringLeds)
-	// We'll flash red a few times.
-	// We need to run this in a loop or send a sequence if possible.
 	// Since 'ros2 topic pub' blocks if we don't use --once, we'll just send a "red" command, wait, then "off".
 
 	// Red
-	ledRed := exec.Command("ros2", "topic", "pub", "--once", "/cmd_lightring", "irobot_create_msgs/msg/LightringLeds",
+	ledRed := cfg.rosCommand(context.Background(), "ros2", "topic", "pub", "--once", "/cmd_lightring", "irobot_create_msgs/msg/LightringLeds",
 		`{override_system: true, leds: [{red: 255, green: 0, blue: 0}, {red: 255, green: 0, blue: 0}, {red: 255, green: 0, blue: 0}, {red: 255, green: 0, blue: 0}, {red: 255, green: 0, blue: 0}, {red: 255, green: 0, blue: 0}]}`)
 	if out, err := ledRed.CombinedOutput(); err != nil {
-		log.Printf("[agent] failed to set LEDs red: %v: %s", err, string(out))
+		slog.Warn("failed to set LEDs red", "err", err, "output", string(out))
 	}
 
 	time.Sleep(1 * time.Second)
 
 	// Off (or return to system control)
 	// To return to system control, we can set override_system to false.
-	ledOff := exec.Command("ros2", "topic", "pub", "--once", "/cmd_lightring", "irobot_create_msgs/msg/LightringLeds",
+	ledOff := cfg.rosCommand(context.Background(), "ros2", "topic", "pub", "--once", "/cmd_lightring", "irobot_create_msgs/msg/LightringLeds",
 		`{override_system: false, leds: []}`)
 	if out, err := ledOff.CombinedOutput(); err != nil {
-		log.Printf("[agent] failed to reset LEDs: %v: %s", err, string(out))
+		slog.Warn("failed to reset LEDs", "err", err, "output", string(out))
 	}
-
-	return nil
 }
 
-func identifyLaptop(data IdentifyData) error {
-	// Sound (fire and forget)
+// playTone beeps through the sound card, or the PC speaker (fire and forget).
+func playTone() {
 	go func() {
 		// Try speaker-test (ALSA)
 		cmd := exec.Command("speaker-test", "-t", "sine", "-f", "1000", "-l", "1")
@@ -251,7 +304,11 @@ func identifyLaptop(data IdentifyData) error {
 			exec.Command("beep").Run()
 		}
 	}()
+}
 
+// showOnConsole shows the robot's details on a text console and opens the
+// identify page in the desktop session, if there is one.
+func showOnConsole(data IdentifyData) {
 	// Visual: TTY takeover (works even if not logged in)
 	if data.ID != "" {
 		go func() {
@@ -293,7 +350,7 @@ func identifyLaptop(data IdentifyData) error {
 				}
 				f.Close()
 			} else {
-				log.Printf("[agent] failed to open tty6: %v", err)
+				slog.Warn("failed to open tty6", "err", err)
 			}
 
 			duration := data.Duration
@@ -333,45 +390,22 @@ func identifyLaptop(data IdentifyData) error {
 			}
 		}()
 	}
-
-	return nil
 }
 
-func blinkPiLED(pattern string, duration int) {
-	led0Path := "/sys/class/leds/led0/brightness" // Green
-	led1Path := "/sys/class/leds/led1/brightness" // Red
-	led0Trigger := "/sys/class/leds/led0/trigger"
-	led1Trigger := "/sys/class/leds/led1/trigger"
-
-	// Check if at least one LED exists
-	_, err0 := os.Stat(led0Path)
-	_, err1 := os.Stat(led1Path)
-	if os.IsNotExist(err0) && os.IsNotExist(err1) {
+// blinkLEDs blinks the profile's green and red LEDs in pattern ('g', 'r',
+// 'b' for both, anything else off) for duration seconds, then restores them.
+func blinkLEDs(hw Hardware, pattern string, duration int) {
+	green, red := hw.GreenLED, hw.RedLED
+	if green == "" && red == "" {
 		return
 	}
 
-	// Helper to get current trigger
-	getTrigger := func(path string) string {
-		data, err := os.ReadFile(path)
-		if err != nil {
-			return "none"
-		}
-		// Format is "none [mmc0] heartbeat"
-		s := string(data)
-		start := strings.Index(s, "[")
-		end := strings.Index(s, "]")
-		if start != -1 && end != -1 && end > start {
-			return s[start+1 : end]
-		}
-		return "none"
-	}
-
 	// Save current state
-	origTrig0 := getTrigger(led0Trigger)
-	origTrig1 := getTrigger(led1Trigger)
+	origGreen := ledTrigger(green)
+	origRed := ledTrigger(red)
 
 	go func() {
-		log.Printf("[agent] blinking Pi LEDs with pattern %s for %ds (orig: %s, %s)", pattern, duration, origTrig0, origTrig1)
+		slog.Info("blinking board LEDs", "pattern", pattern, "duration_sec", duration, "green", green, "red", red)
 
 		// Default pattern if empty
 		if pattern == "" {
@@ -389,52 +423,44 @@ func blinkPiLED(pattern string, duration int) {
 					break
 				}
 
-				var gVal, rVal []byte
+				gVal, rVal := "0", "0"
 				switch char {
 				case 'g':
-					gVal, rVal = []byte("1"), []byte("0")
+					gVal = "1"
 				case 'r':
-					gVal, rVal = []byte("0"), []byte("1")
+					rVal = "1"
 				case 'b':
-					gVal, rVal = []byte("1"), []byte("1")
-				default: // '0' or unknown
-					gVal, rVal = []byte("0"), []byte("0")
+					gVal, rVal = "1", "1"
 				}
 
-				_ = os.WriteFile(led0Path, gVal, 0644)
-				_ = os.WriteFile(led1Path, rVal, 0644)
+				setLED(green, "brightness", gVal)
+				setLED(red, "brightness", rVal)
 
 				time.Sleep(200 * time.Millisecond)
 			}
 		}
 
 		// Restore triggers
-		_ = os.WriteFile(led0Trigger, []byte(origTrig0), 0644)
-		_ = os.WriteFile(led1Trigger, []byte(origTrig1), 0644)
-
-		// If trigger was "none" or "input" (often default for red), ensure it's ON if it was likely ON (red usually is)
-		// Actually, restoring trigger usually restores state.
-		// But if it was "default-on", we should be good.
-		// If it was "input", it might be off.
-		// Let's just ensure Red is ON if it's the power LED (led1 usually) and trigger is input/none
-		if origTrig1 == "input" || origTrig1 == "none" {
-			_ = os.WriteFile(led1Path, []byte("1"), 0644)
+		setLED(green, "trigger", origGreen)
+		setLED(red, "trigger", origRed)
+
+		// The red LED is usually the power LED: its "input" or "none" trigger
+		// doesn't restore the on state, so turn it back on.
+		if origRed == "input" || origRed == "none" {
+			setLED(red, "brightness", "1")
 		}
 	}()
 }
 
-// HandleCaptureImage takes a photo and uploads it.
-func HandleCaptureImage(cfg Config, data CaptureImageData) error {
-	log.Printf("[agent] capturing image")
+// HandleCaptureImage takes a photo and uploads it, naming jobID, the
+// command that asked for it, so the controller can file it in the robot's
+// snapshot history.
+func HandleCaptureImage(cfg Config, data CaptureImageData, jobID string) error {
+	slog.Info("capturing image")
 	tmpPath := "/tmp/snapshot.jpg"
 
-	// Try fswebcam first
-	cmd := exec.Command("fswebcam", "-r", "640x480", "--jpeg", "85", "-D", "1", tmpPath)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		log.Printf("[agent] fswebcam failed: %v: %s", err, string(out))
-		// Fallback: create a dummy image or fail?
-		// Let's fail for now, or maybe try a different tool if needed.
-		return fmt.Errorf("capture failed: %v", err)
+	if err := captureFrame(context.Background(), tmpPath); err != nil {
+		return err
 	}
 	defer os.Remove(tmpPath)
 
@@ -454,6 +480,9 @@ func HandleCaptureImage(cfg Config, data CaptureImageData) error {
 	if _, err := io.Copy(part, file); err != nil {
 		return err
 	}
+	if jobID != "" {
+		writer.WriteField("job_id", jobID)
+	}
 	writer.Close()
 
 	req, err := http.NewRequest("POST", data.UploadURL, body)
@@ -473,19 +502,99 @@ func HandleCaptureImage(cfg Config, data CaptureImageData) error {
 		return fmt.Errorf("upload returned status: %s", resp.Status)
 	}
 
-	log.Printf("[agent] image uploaded to %s", data.UploadURL)
+	slog.Info("image uploaded", "url", data.UploadURL)
 	return nil
 }
 
-// HandleWifiProfile configures wifi (placeholder).
-func HandleWifiProfile(data WifiProfileData) error {
-	log.Printf("[agent] wifi profile received for %s (not implemented)", data.SSID)
+// captureFrame writes one 640x480 JPEG from the default camera to path.
+func captureFrame(ctx context.Context, path string) error {
+	cmd := exec.CommandContext(ctx, "fswebcam", "-r", "640x480", "--jpeg", "85", "-D", "1", path)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		slog.Error("fswebcam failed", "err", err, "output", string(out))
+		return fmt.Errorf("capture failed: %v", err)
+	}
 	return nil
 }
 
+// HandleSpeedTest measures throughput to and from the controller in both
+// directions and reports the result back.
+func HandleSpeedTest(cfg Config, data SpeedTestData) error {
+	if data.DownloadURL == "" || data.UploadURL == "" || data.ResultURL == "" {
+		return errors.New("speed test urls required")
+	}
+	if data.SizeBytes <= 0 {
+		return errors.New("speed test size required")
+	}
+	slog.Info("starting speed test", "bytes", data.SizeBytes)
+	client := &http.Client{Timeout: 5 * time.Minute}
+	result := SpeedTestResult{SizeBytes: data.SizeBytes}
+
+	start := time.Now()
+	resp, err := client.Get(data.DownloadURL)
+	if err != nil {
+		return fmt.Errorf("download failed: %v", err)
+	}
+	n, err := io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("download failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download returned status: %s", resp.Status)
+	}
+	result.DownloadSec = time.Since(start).Seconds()
+	result.DownloadMbps = mbps(n, result.DownloadSec)
+
+	start = time.Now()
+	req, err := http.NewRequest("POST", data.UploadURL, io.LimitReader(zeroReader{}, data.SizeBytes))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = data.SizeBytes
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err = client.Do(req)
+	if err != nil {
+		return fmt.Errorf("upload failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("upload returned status: %s", resp.Status)
+	}
+	result.UploadSec = time.Since(start).Seconds()
+	result.UploadMbps = mbps(data.SizeBytes, result.UploadSec)
+
+	body, _ := json.Marshal(result)
+	resp, err = client.Post(data.ResultURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("report result failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("report result returned status: %s", resp.Status)
+	}
+	slog.Info("speed test complete", "download_mbps", result.DownloadMbps, "upload_mbps", result.UploadMbps)
+	return nil
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func mbps(n int64, secs float64) float64 {
+	if secs <= 0 {
+		return 0
+	}
+	return float64(n) * 8 / secs / 1e6
+}
+
 // HandleReboot reboots the system.
 func HandleReboot(cfg Config) error {
-	log.Printf("[agent] rebooting system...")
+	slog.Info("rebooting system")
 	// Sync filesystem before reboot
 	exec.Command("sync").Run()
 
@@ -545,13 +654,16 @@ func truncateFile(path string, mode os.FileMode) error {
 	return f.Close()
 }
 
-func customRestartCommand() []string {
+func customRestartCommand(cfg Config) []string {
 	if cmd := os.Getenv("ROS_RESTART_CMD"); cmd != "" {
 		parts := strings.Fields(cmd)
 		if len(parts) >= 1 {
 			return parts
 		}
 	}
+	if cfg.ROSContainer != "" {
+		return []string{"docker", "restart", cfg.ROSContainer}
+	}
 	service := os.Getenv("ROS_SERVICE_NAME")
 	if service == "" {
 		service = "ros"
@@ -589,7 +701,7 @@ func detectOwnerFromPath(path string) string {
 		if errors.Is(err, os.ErrNotExist) {
 			return ""
 		}
-		log.Printf("owner detect stat %s: %v", path, err)
+		slog.Debug("owner detect stat failed", "path", path, "err", err)
 		return ""
 	}
 	stat, ok := info.Sys().(*syscall.Stat_t)
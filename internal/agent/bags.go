@@ -0,0 +1,264 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bags started by bag_start are recorded with ros2 bag record in their own
+// process group, like launches, on the host or in the ROS container. When
+// the recording ends, at its duration or on bag_stop, the bag directory is
+// streamed to the controller as a gzipped tar and removed.
+
+const (
+	// MaxBagDuration bounds one recording.
+	MaxBagDuration = time.Hour
+	bagRoot        = "/tmp/openrobot-bags"
+	// bagUploadTimeout bounds the upload of a finished bag.
+	bagUploadTimeout = 30 * time.Minute
+	bagPGIDPrefix    = "openrobot-bag-pgid "
+)
+
+var (
+	errNoBag = errors.New("no such recording")
+	bagName  = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+)
+
+type bagProc struct {
+	pgid     int
+	stopping bool
+	done     chan struct{}
+}
+
+// bagManager tracks recordings by name, from bag_start until their upload
+// is done.
+type bagManager struct {
+	mu   sync.Mutex
+	bags map[string]*bagProc
+}
+
+// start begins recording data's bag. It fails if ros2 bag record exits
+// straight away, e.g. on a bad topic name.
+func (m *bagManager) start(cfg Config, data BagStartData) error {
+	if !bagName.MatchString(data.Name) {
+		return fmt.Errorf("invalid bag name %q", data.Name)
+	}
+	for _, topic := range data.Topics {
+		if !rosName.MatchString(topic) {
+			return fmt.Errorf("invalid topic %q", topic)
+		}
+	}
+	duration := time.Duration(data.DurationSec) * time.Second
+	if duration <= 0 || duration > MaxBagDuration {
+		return fmt.Errorf("duration_sec must be between 1 and %d", int(MaxBagDuration.Seconds()))
+	}
+	if !strings.HasPrefix(data.UploadURL, "http://") && !strings.HasPrefix(data.UploadURL, "https://") {
+		return errors.New("upload_url is required")
+	}
+
+	p := &bagProc{done: make(chan struct{})}
+	m.mu.Lock()
+	if m.bags == nil {
+		m.bags = make(map[string]*bagProc)
+	}
+	if m.bags[data.Name] != nil {
+		m.mu.Unlock()
+		return fmt.Errorf("bag %s is still recording or uploading", data.Name)
+	}
+	m.bags[data.Name] = p
+	m.mu.Unlock()
+
+	dir := path.Join(bagRoot, data.Name)
+	record := "ros2 bag record -o " + shellQuote(dir)
+	if len(data.Topics) == 0 {
+		record += " -a"
+	}
+	for _, topic := range data.Topics {
+		record += " " + shellQuote(topic)
+	}
+	script := "echo " + bagPGIDPrefix + "$$\n" + rosSetup + "\n" +
+		"rm -rf " + shellQuote(dir) + " && mkdir -p " + bagRoot + " || exit 1\n" +
+		"exec " + record
+	cmd := cfg.command(context.Background(), "setsid", "-w", "bash", "-c", script)
+
+	pgid := make(chan int, 1)
+	var output []byte
+	var runErr error
+	go func() {
+		output, runErr = streamCommand(cmd, func(line string) {
+			if v, ok := strings.CutPrefix(line, bagPGIDPrefix); ok {
+				if n, err := strconv.Atoi(v); err == nil && n > 0 {
+					select {
+					case pgid <- n:
+					default:
+					}
+				}
+			}
+		})
+		close(p.done)
+	}()
+
+	settle := time.NewTimer(launchSettle)
+	defer settle.Stop()
+	for {
+		select {
+		case n := <-pgid:
+			m.mu.Lock()
+			p.pgid = n
+			m.mu.Unlock()
+			pgid = nil
+		case <-p.done:
+			m.forget(data.Name, p)
+			if runErr != nil {
+				return fmt.Errorf("ros2 bag record exited: %v: %s", runErr, tail(output))
+			}
+			return errors.New("ros2 bag record exited straight away")
+		case <-settle.C:
+			m.mu.Lock()
+			started := p.pgid
+			m.mu.Unlock()
+			if started == 0 {
+				m.forget(data.Name, p)
+				if cmd.Process != nil {
+					cmd.Process.Kill()
+				}
+				return errors.New("ros2 bag record did not report its process group")
+			}
+			slog.Info("recording bag", "name", data.Name, "topics", data.Topics, "duration", duration, "container", cfg.ROSContainer)
+			go m.finish(cfg, data, dir, p, duration)
+			return nil
+		}
+	}
+}
+
+// finish stops the recording once its duration is up, unless bag_stop
+// stopped it first, then uploads the bag.
+func (m *bagManager) finish(cfg Config, data BagStartData, dir string, p *bagProc, duration time.Duration) {
+	defer m.forget(data.Name, p)
+	select {
+	case <-p.done:
+	case <-time.After(duration):
+		if err := m.stop(cfg, data.Name); err != nil && !errors.Is(err, errNoBag) {
+			slog.Warn("cannot stop bag", "name", data.Name, "err", err)
+			return
+		}
+	}
+	if err := uploadBag(cfg, dir, data.UploadURL); err != nil {
+		slog.Error("bag upload failed", "name", data.Name, "err", err)
+	} else {
+		slog.Info("bag uploaded", "name", data.Name)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if out, err := cfg.command(ctx, "rm", "-rf", dir).CombinedOutput(); err != nil {
+		slog.Warn("cannot remove bag", "dir", dir, "err", err, "output", tail(out))
+	}
+}
+
+// stop interrupts the recording name, as Ctrl-C would, so ros2 bag closes
+// the bag cleanly, and kills it if it is still running after
+// launchStopTimeout. The upload carries on in the background.
+func (m *bagManager) stop(cfg Config, name string) error {
+	m.mu.Lock()
+	p := m.bags[name]
+	if p == nil {
+		m.mu.Unlock()
+		return fmt.Errorf("%w: %s", errNoBag, name)
+	}
+	p.stopping = true
+	pgid := p.pgid
+	m.mu.Unlock()
+	if closed(p.done) {
+		return nil
+	}
+	if err := signalLaunch(cfg, pgid, "INT"); err != nil && !closed(p.done) {
+		return fmt.Errorf("stop bag %s: %w", name, err)
+	}
+	select {
+	case <-p.done:
+	case <-time.After(launchStopTimeout):
+		slog.Warn("bag did not stop on SIGINT, killing it", "name", name, "pgid", pgid)
+		if err := signalLaunch(cfg, pgid, "KILL"); err != nil && !closed(p.done) {
+			return fmt.Errorf("kill bag %s: %w", name, err)
+		}
+		<-p.done
+	}
+	slog.Info("stopped bag", "name", name)
+	return nil
+}
+
+func (m *bagManager) forget(name string, p *bagProc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.bags[name] == p {
+		delete(m.bags, name)
+	}
+}
+
+// stopAll stops every recording when the agent shuts down, so none outlives
+// it in the ROS container.
+func (m *bagManager) stopAll(cfg Config) {
+	m.mu.Lock()
+	var names []string
+	for name, p := range m.bags {
+		if !closed(p.done) {
+			names = append(names, name)
+		}
+	}
+	m.mu.Unlock()
+	for _, name := range names {
+		if err := m.stop(cfg, name); err != nil && !errors.Is(err, errNoBag) {
+			slog.Warn("cannot stop bag", "name", name, "err", err)
+		}
+	}
+}
+
+// uploadBag streams dir to url as a gzipped tar. If tar fails part way the
+// request is aborted, so the controller never stores a truncated bag.
+func uploadBag(cfg Config, dir, url string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), bagUploadTimeout)
+	defer cancel()
+	pr, pw := io.Pipe()
+	tar := cfg.command(ctx, "tar", "-czf", "-", "-C", path.Dir(dir), path.Base(dir))
+	tar.Stdout = pw
+	var stderr strings.Builder
+	tar.Stderr = &stderr
+	if err := tar.Start(); err != nil {
+		return err
+	}
+	go func() {
+		err := tar.Wait()
+		if err != nil {
+			err = fmt.Errorf("tar: %v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, pr)
+	if err != nil {
+		pr.CloseWithError(err)
+		return err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		pr.CloseWithError(err)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 500))
+		return fmt.Errorf("upload returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// bootQueuePath holds commands sent with run_at_boot, and the results of
+// those that ran, until they have been reported.
+const bootQueuePath = "/var/lib/openrobotfleet-agent/boot-queue.json"
+
+// bootQueue is the persisted state. BootID is the boot the commands were
+// queued in; they run on the first start in a different one.
+type bootQueue struct {
+	BootID   string       `json:"boot_id"`
+	Commands []Command    `json:"commands,omitempty"`
+	Results  []bootResult `json:"results,omitempty"`
+}
+
+// bootResult is the outcome of a boot command, kept until it has been sent
+// to the controller.
+type bootResult struct {
+	JobID         string    `json:"job_id"`
+	Type          string    `json:"type"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	Status        JobStatus `json:"status"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// DetectBootID returns the kernel's random ID for this boot. Unlike the boot
+// time it doesn't shift when NTP corrects the clock of a board without an
+// RTC.
+func DetectBootID() string {
+	raw, err := os.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+func loadBootQueue() (bootQueue, error) {
+	var q bootQueue
+	raw, err := os.ReadFile(bootQueuePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return q, err
+	}
+	if err := json.Unmarshal(raw, &q); err != nil {
+		return q, fmt.Errorf("parse %s: %w", bootQueuePath, err)
+	}
+	return q, nil
+}
+
+func saveBootQueue(q bootQueue) error {
+	if len(q.Commands) == 0 && len(q.Results) == 0 {
+		if err := os.Remove(bootQueuePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	raw, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(bootQueuePath), 0o700); err != nil {
+		return err
+	}
+	// Commands are kept as received, so sealed payloads stay encrypted.
+	return os.WriteFile(bootQueuePath, raw, configFileMode)
+}
+
+// deferToBoot saves cmd to run after the next reboot.
+func (e *AgentEngine) deferToBoot(cmd Command) error {
+	q, err := loadBootQueue()
+	if err != nil {
+		return err
+	}
+	for _, queued := range q.Commands {
+		if cmd.ID != "" && queued.ID == cmd.ID {
+			return nil
+		}
+	}
+	q.BootID = e.bootID
+	q.Commands = append(q.Commands, cmd)
+	if err := saveBootQueue(q); err != nil {
+		return err
+	}
+	slog.Info("deferred command to next boot", "type", cmd.Type, "command_id", cmd.ID, "correlation_id", cmd.CorrelationID)
+	return nil
+}
+
+// runBootQueue runs the commands deferred in an earlier boot, in order,
+// before the agent connects: one may be what brings the network back. The
+// queue is cleared first, so a command that reboots doesn't loop.
+func (e *AgentEngine) runBootQueue() {
+	q, err := loadBootQueue()
+	if err != nil {
+		slog.Error("cannot read boot queue", "err", err)
+		return
+	}
+	e.bootResults = q.Results
+	if len(q.Commands) == 0 || q.BootID == e.bootID {
+		return
+	}
+	cmds := q.Commands
+	q.Commands = nil
+	if err := saveBootQueue(q); err != nil {
+		slog.Error("cannot clear boot queue", "err", err)
+		return
+	}
+	for _, cmd := range cmds {
+		// The controller may replay the job if it missed the deferral;
+		// marking it seen drops that copy.
+		e.commands.duplicate(cmd.ID)
+		slog.Info("running boot command", "type", cmd.Type, "command_id", cmd.ID, "correlation_id", cmd.CorrelationID)
+		res := bootResult{JobID: cmd.ID, Type: cmd.Type, CorrelationID: cmd.CorrelationID, Status: JobStatusSuccess}
+		if err := e.runNow(cmd); err != nil {
+			slog.Error("boot command failed", "type", cmd.Type, "command_id", cmd.ID, "err", err)
+			res.Status, res.Error = JobStatusFailed, err.Error()
+		}
+		e.bootResults = append(e.bootResults, res)
+	}
+	q.Results = e.bootResults
+	if err := saveBootQueue(q); err != nil {
+		slog.Error("cannot save boot results", "err", err)
+	}
+}
+
+// runNow runs cmd synchronously, outside the job manager.
+func (e *AgentEngine) runNow(cmd Command) error {
+	if cmd.Sealed != "" {
+		if err := OpenCommand(&cmd, e.Config.PayloadKey, e.Config.AgentID); err != nil {
+			return err
+		}
+	}
+	action := e.mapCommandToAction(cmd)
+	if action == nil {
+		return fmt.Errorf("unknown command type %s", cmd.Type)
+	}
+	return action()
+}
+
+// reportBootResults sends one status message per boot command result, then
+// forgets them.
+func (e *AgentEngine) reportBootResults() {
+	if len(e.bootResults) == 0 {
+		return
+	}
+	for _, res := range e.bootResults {
+		job := &Job{ID: res.JobID, Type: res.Type, CorrelationID: res.CorrelationID, Status: res.Status, Error: res.Error}
+		e.MQTTClient.Publish("lab/status/"+e.Config.AgentID, 1, false, e.statusPayload(job))
+	}
+	slog.Info("reported boot command results", "count", len(e.bootResults))
+	e.bootResults = nil
+	q, err := loadBootQueue()
+	if err == nil {
+		q.Results = nil
+		err = saveBootQueue(q)
+	}
+	if err != nil {
+		slog.Error("cannot clear boot results", "err", err)
+	}
+}
@@ -0,0 +1,163 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// The live view is an MJPEG stream from the default camera, served over
+// HTTP for the controller to proxy. camera_stream opens the listener and
+// hands out a one-time token; ffmpeg only runs while a stream is open, and
+// only one stream can hold the camera at a time.
+
+const (
+	// cameraTokenTTL is how long a camera_stream token waits for the
+	// controller to connect.
+	cameraTokenTTL = 30 * time.Second
+	// MaxCameraStream bounds one live view, so a forgotten browser tab
+	// doesn't keep the camera and the WiFi busy.
+	MaxCameraStream = 10 * time.Minute
+	cameraDevice    = "/dev/video0"
+	// cameraBoundary is the part boundary ffmpeg's mpjpeg muxer writes.
+	cameraBoundary = "ffmpeg"
+)
+
+type cameraServer struct {
+	mu        sync.Mutex
+	port      int
+	srv       *http.Server
+	tokens    map[string]time.Time
+	streaming bool
+}
+
+// allow registers data's token, listening on its port first if needed.
+func (s *cameraServer) allow(data CameraStreamData) error {
+	if len(data.Token) < 16 {
+		return errors.New("camera token required")
+	}
+	if data.Port <= 0 || data.Port > 65535 {
+		return fmt.Errorf("invalid camera port %d", data.Port)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.srv != nil && s.port != data.Port {
+		s.srv.Close()
+		s.srv = nil
+	}
+	if s.srv == nil {
+		ln, err := net.Listen("tcp", fmt.Sprintf(":%d", data.Port))
+		if err != nil {
+			return fmt.Errorf("camera listen: %w", err)
+		}
+		s.srv = &http.Server{Handler: http.HandlerFunc(s.serve), ReadHeaderTimeout: 10 * time.Second}
+		s.port = data.Port
+		go func(srv *http.Server) {
+			if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Warn("camera server stopped", "err", err)
+			}
+		}(s.srv)
+		slog.Info("camera live view listening", "port", data.Port)
+	}
+	now := time.Now()
+	if s.tokens == nil {
+		s.tokens = make(map[string]time.Time)
+	}
+	for token, expires := range s.tokens {
+		if now.After(expires) {
+			delete(s.tokens, token)
+		}
+	}
+	s.tokens[data.Token] = now.Add(cameraTokenTTL)
+	return nil
+}
+
+// serve streams the camera to a request carrying a valid token, until the
+// request goes away or MaxCameraStream is up.
+func (s *cameraServer) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/camera" || r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+	token := r.URL.Query().Get("token")
+	s.mu.Lock()
+	expires, ok := s.tokens[token]
+	if !ok || time.Now().After(expires) {
+		s.mu.Unlock()
+		http.Error(w, "unknown token", http.StatusForbidden)
+		return
+	}
+	if s.streaming {
+		s.mu.Unlock()
+		http.Error(w, "camera is busy", http.StatusConflict)
+		return
+	}
+	delete(s.tokens, token)
+	s.streaming = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.streaming = false
+		s.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(r.Context(), MaxCameraStream)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-loglevel", "error",
+		"-f", "v4l2", "-video_size", "640x480", "-framerate", "10", "-i", cameraDevice,
+		"-f", "mpjpeg", "-q:v", "7", "-")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		http.Error(w, "cannot start ffmpeg: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	slog.Info("camera live view started", "remote", r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace;boundary="+cameraBoundary)
+	w.Header().Set("Cache-Control", "no-store")
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := stdout.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				break
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	cancel()
+	if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+		slog.Warn("camera live view failed", "err", err, "output", tail(stderr.Bytes()))
+		return
+	}
+	slog.Info("camera live view ended", "remote", r.RemoteAddr)
+}
+
+// close stops listening when the agent shuts down.
+func (s *cameraServer) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.srv != nil {
+		s.srv.Close()
+		s.srv = nil
+	}
+}
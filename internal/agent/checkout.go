@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// errNoCheckout means the target isn't a checkout of the requested repo, so
+// it has to be cloned.
+var errNoCheckout = errors.New("no checkout of the repo")
+
+// updateCheckout brings an existing checkout of data.Repo at target to the
+// requested version: it fetches just the branch or tag needed, force-checks
+// it out, discards local changes and removes untracked files. Files matched
+// by .gitignore, such as build output, are kept. It returns errNoCheckout when
+// target holds something else.
+func updateCheckout(ctx context.Context, cfg Config, env []string, target string, data UpdateRepoData) error {
+	git := func(args ...string) (string, error) {
+		// The checkout belongs to the workspace owner, not root.
+		full := append([]string{"git", "-c", "safe.directory=*", "-C", target}, args...)
+		out, err := cfg.commandEnv(ctx, env, full...).CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(string(out)))
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	// rev-parse --show-toplevel keeps a checkout further up, such as a
+	// workspace that is itself a repo, from being taken for this one.
+	top, err := git("rev-parse", "--show-toplevel")
+	if err != nil || strings.TrimSuffix(top, "/") != strings.TrimSuffix(target, "/") {
+		return errNoCheckout
+	}
+	origin, err := git("remote", "get-url", "origin")
+	if err != nil || !sameRepo(origin, data.Repo) {
+		return errNoCheckout
+	}
+	switch {
+	case data.Tag != "":
+		if _, err := git("fetch", "--quiet", "--force", "origin", "+refs/tags/"+data.Tag+":refs/tags/"+data.Tag); err != nil {
+			return err
+		}
+		if _, err := git("checkout", "--quiet", "--force", "--detach", "refs/tags/"+data.Tag); err != nil {
+			return err
+		}
+	case data.Branch != "":
+		if _, err := git("fetch", "--quiet", "--force", "origin", "+refs/heads/"+data.Branch+":refs/remotes/origin/"+data.Branch); err != nil {
+			return err
+		}
+		if _, err := git("checkout", "--quiet", "--force", "-B", data.Branch, "refs/remotes/origin/"+data.Branch); err != nil {
+			return err
+		}
+	default:
+		// Only a commit is pinned; pinCheckout fetches it if this doesn't.
+		if _, err := git("fetch", "--quiet", "--force", "--tags", "origin"); err != nil {
+			return err
+		}
+	}
+	if err := pinCheckout(ctx, cfg, env, target, data); err != nil {
+		return err
+	}
+	if _, err := git("reset", "--quiet", "--hard"); err != nil {
+		return err
+	}
+	_, err = git("clean", "--quiet", "--force", "-d")
+	return err
+}
+
+// sameRepo compares remote URLs the way git itself does, so
+// https://host/org/repo and https://host/org/repo.git are the same repo.
+func sameRepo(a, b string) bool {
+	norm := func(u string) string {
+		u = strings.TrimSuffix(strings.TrimSpace(u), "/")
+		return strings.TrimSuffix(u, ".git")
+	}
+	return norm(a) == norm(b)
+}
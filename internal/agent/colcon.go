@@ -0,0 +1,211 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxParallelWorkers bounds colcon's --parallel-workers.
+const maxParallelWorkers = 64
+
+// rosPackageName is what REP 144 allows for a package name.
+var rosPackageName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// buildRoot is the workspace a colcon_build or rosdep_install acts on.
+func buildRoot(cfg Config, path string) (string, error) {
+	root := workspaceRoot(cfg)
+	if path != "" {
+		root = resolvePath(root, path)
+	}
+	if root == "" {
+		return "", errors.New("workspace_path is not configured")
+	}
+	if root == "/" {
+		return "", fmt.Errorf("invalid workspace path %q", path)
+	}
+	return root, nil
+}
+
+// HandleColconBuild builds the workspace with colcon, with ROS and the
+// scenario's env vars loaded, reporting how many packages have been built
+// through progress.
+func HandleColconBuild(cfg Config, data ColconBuildData, progress func(string)) error {
+	ctx := context.Background()
+	root, err := buildRoot(cfg, data.Path)
+	if err != nil {
+		return err
+	}
+	if data.ParallelWorkers < 0 || data.ParallelWorkers > maxParallelWorkers {
+		return fmt.Errorf("parallel_workers must be between 0 and %d", maxParallelWorkers)
+	}
+	for _, p := range data.PackagesSelect {
+		if !rosPackageName.MatchString(p) {
+			return fmt.Errorf("invalid package name %q", p)
+		}
+	}
+
+	total := len(data.PackagesSelect)
+	if total == 0 {
+		// Only to show progress against; the build runs without it.
+		if out, err := cfg.command(ctx, "bash", "-c", scenarioScript(root, "colcon list --names-only")).Output(); err == nil {
+			total = len(strings.Fields(string(out)))
+		}
+	}
+	build := []string{"colcon", "build", "--event-handlers", "console_direct-", "console_start_end+"}
+	if data.ParallelWorkers > 0 {
+		build = append(build, "--parallel-workers", strconv.Itoa(data.ParallelWorkers))
+	}
+	if len(data.PackagesSelect) > 0 {
+		build = append(build, "--packages-select")
+		build = append(build, data.PackagesSelect...)
+	}
+	slog.Info("colcon: building", "root", root, "packages", data.PackagesSelect, "parallel_workers", data.ParallelWorkers, "container", cfg.ROSContainer)
+	p := colconProgress{total: total}
+	progress(p.String())
+	output, err := streamCommand(cfg.command(ctx, "bash", "-c", scenarioScript(root, strings.Join(build, " "))), func(line string) {
+		if p.update(line) {
+			progress(p.String())
+		}
+	})
+	if err != nil {
+		if len(p.failed) > 0 {
+			return fmt.Errorf("colcon build failed in %s: %w: %s", strings.Join(p.failed, ", "), err, tail(output))
+		}
+		return fmt.Errorf("colcon build failed: %w: %s", err, tail(output))
+	}
+	slog.Info("colcon: built", "root", root, "packages", p.built)
+	return ownWorkspace(ctx, cfg, root)
+}
+
+// colconProgress follows colcon's console_start_end output.
+type colconProgress struct {
+	total, built int
+	running      []string
+	failed       []string
+}
+
+// update applies one line of output, reporting whether anything changed.
+func (p *colconProgress) update(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return false
+	}
+	pkg := fields[2]
+	switch {
+	case fields[0] == "Starting" && fields[1] == ">>>":
+		p.running = append(p.running, pkg)
+	case fields[1] == "<<<" && (fields[0] == "Finished" || fields[0] == "Failed" || fields[0] == "Aborted"):
+		for i, r := range p.running {
+			if r == pkg {
+				p.running = append(p.running[:i], p.running[i+1:]...)
+				break
+			}
+		}
+		if fields[0] == "Finished" {
+			p.built++
+		} else {
+			p.failed = append(p.failed, pkg)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func (p colconProgress) String() string {
+	s := fmt.Sprintf("%d packages built", p.built)
+	if p.total > 0 {
+		s = fmt.Sprintf("%d/%d packages built", p.built, p.total)
+	}
+	if len(p.failed) > 0 {
+		s += ", failed: " + strings.Join(p.failed, ", ")
+	}
+	if len(p.running) > 0 {
+		s += ", building " + strings.Join(p.running, ", ")
+	}
+	return s
+}
+
+// rosdepScript installs the workspace's dependencies, echoing "==> " lines
+// as it moves through the stages. The agent runs as root, so rosdep calls
+// apt-get itself rather than through sudo, which containers often lack.
+const rosdepScript = `export DEBIAN_FRONTEND=noninteractive
+if [ ! -d /etc/ros/rosdep/sources.list.d ]; then
+  echo "==> initializing rosdep"
+  rosdep init || exit 1
+fi
+echo "==> updating rosdep database"
+rosdep update --rosdistro "$ROS_DISTRO" || exit 1
+echo "==> updating package lists"
+apt-get update -q || exit 1
+echo "==> checking dependencies"
+rosdep install --from-paths src --ignore-src -y --rosdistro "$ROS_DISTRO" --as-root apt:false`
+
+// HandleRosdepInstall installs the system dependencies the packages in the
+// workspace's src directory declare, reporting the current stage, or the
+// package being installed, through progress.
+func HandleRosdepInstall(cfg Config, data RosdepInstallData, progress func(string)) error {
+	root, err := buildRoot(cfg, data.Path)
+	if err != nil {
+		return err
+	}
+	slog.Info("rosdep: installing dependencies", "root", root, "container", cfg.ROSContainer)
+	output, err := streamCommand(cfg.command(context.Background(), "bash", "-c", scenarioScript(root, rosdepScript)), func(line string) {
+		switch {
+		case strings.HasPrefix(line, "==> "):
+			progress(strings.TrimPrefix(line, "==> "))
+		case strings.HasPrefix(line, "executing command ["):
+			// e.g. executing command [apt-get install -y ros-humble-nav2-msgs]
+			cmd := strings.Fields(strings.TrimSuffix(strings.TrimPrefix(line, "executing command ["), "]"))
+			if len(cmd) > 0 {
+				progress("installing " + cmd[len(cmd)-1])
+			}
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("rosdep install failed: %w: %s", err, tail(output))
+	}
+	progress("dependencies installed")
+	return nil
+}
+
+// streamCommand runs cmd, passing each line of its combined output to line as
+// it is printed, and returns the end of the output for error messages.
+func streamCommand(cmd *exec.Cmd, line func(string)) ([]byte, error) {
+	const keep = 8 << 10
+	pr, pw := io.Pipe()
+	cmd.Stdout, cmd.Stderr = pw, pw
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sc := bufio.NewScanner(pr)
+		sc.Buffer(make([]byte, 64<<10), 1<<20)
+		for sc.Scan() {
+			out.Write(sc.Bytes())
+			out.WriteByte('\n')
+			if out.Len() > 2*keep {
+				out.Next(out.Len() - keep)
+			}
+			line(sc.Text())
+		}
+		// Keep draining if a line was too long, so the command can't block.
+		io.Copy(io.Discard, pr)
+	}()
+	err := cmd.Wait()
+	pw.Close()
+	<-done
+	return out.Bytes(), err
+}
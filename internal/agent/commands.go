@@ -1,12 +1,32 @@
 package agent
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Command represents a controller-issued instruction handled by an agent.
 type Command struct {
 	ID   string          `json:"id"`
 	Type string          `json:"type"`
 	Data json.RawMessage `json:"data"`
+	// CorrelationID is the request ID of the API call that issued the
+	// command, so agent logs and job failures can be traced back to it.
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// Priority is one of PriorityCritical, PriorityInteractive or
+	// PriorityBatch; empty means DefaultPriority(Type).
+	Priority string `json:"priority,omitempty"`
+	// Sealed replaces Data for sensitive commands: the data encrypted with
+	// the robot's payload key (see SealCommand).
+	Sealed string `json:"sealed,omitempty"`
+	// RunAtBoot saves the command to run after the robot next reboots, e.g.
+	// to verify a risky network change. Its result is reported once the
+	// agent reconnects.
+	RunAtBoot bool `json:"run_at_boot,omitempty"`
+
+	// receivedAt is when the command arrived over MQTT, before it waited in
+	// the queue.
+	receivedAt time.Time
 }
 
 // UpdateRepoData describes git repo sync instructions.
@@ -14,6 +34,21 @@ type UpdateRepoData struct {
 	Repo   string `json:"repo"`
 	Branch string `json:"branch"`
 	Path   string `json:"path"`
+	// Tag and Commit pin the checkout (see pinCheckout).
+	Tag    string `json:"tag,omitempty"`
+	Commit string `json:"commit,omitempty"`
+	// Auth is set for private repos; the command is then encrypted.
+	Auth *RepoAuth `json:"auth,omitempty"`
+}
+
+// RepoAuth are the credentials for cloning a private repo: a token for an
+// HTTPS URL, or a deploy key for an SSH one.
+type RepoAuth struct {
+	// Username goes with Token; most hosts accept any name with a token.
+	Username string `json:"username,omitempty"`
+	Token    string `json:"token,omitempty"`
+	// SSHKey is a private key in OpenSSH format.
+	SSHKey string `json:"ssh_key,omitempty"`
 }
 
 // ResetLogsData instructs the agent to truncate or remove logs.
@@ -21,10 +56,15 @@ type ResetLogsData struct {
 	Paths []string `json:"paths"`
 }
 
-// WifiProfileData describes a wifi connection profile.
+// WifiProfileData lists the wifi networks a robot roams between. Each push
+// replaces the networks the previous one configured.
 type WifiProfileData struct {
-	SSID     string `json:"ssid"`
-	Password string `json:"password"`
+	Networks []WifiNetwork `json:"networks,omitempty"`
+	// SSID and Password are a single network, as sent before Networks.
+	SSID     string `json:"ssid,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Interface is the wifi device netplan configures, wlan0 by default.
+	Interface string `json:"interface,omitempty"`
 }
 
 // CaptureImageData describes image capture instructions.
@@ -32,11 +72,78 @@ type CaptureImageData struct {
 	UploadURL string `json:"upload_url"`
 }
 
+// CameraStreamData lets the controller open one live view of the camera:
+// the agent listens on Port and streams MJPEG to the first request that
+// carries Token.
+type CameraStreamData struct {
+	Token string `json:"token"`
+	Port  int    `json:"port"`
+}
+
+// TeleopStartData opens a WebRTC teleoperation session. Offer is the
+// operator's complete SDP offer; the agent posts its TeleopAnswer to
+// AnswerURL. The session ends on teleop_stop, when the operator leaves or
+// after MaxDurationSec.
+type TeleopStartData struct {
+	Session        string `json:"session"`
+	Offer          string `json:"offer"`
+	AnswerURL      string `json:"answer_url"`
+	MaxDurationSec int    `json:"max_duration_sec,omitempty"`
+}
+
+// TeleopStopData ends a teleoperation session, or whichever is open if
+// Session is empty.
+type TeleopStopData struct {
+	Session string `json:"session,omitempty"`
+}
+
+// TeleopAnswer is the agent's SDP answer to a teleop offer, or why there is
+// none.
+type TeleopAnswer struct {
+	SDP   string `json:"sdp,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
 // TestDriveData describes test drive instructions.
 type TestDriveData struct {
 	DurationSec int `json:"duration_sec"`
 }
 
+// DriveData is a velocity to drive at, in m/s and rad/s, and for how long.
+// Negative values drive backwards and turn clockwise.
+type DriveData struct {
+	Linear      float64 `json:"linear"`
+	Angular     float64 `json:"angular"`
+	DurationSec float64 `json:"duration_sec"`
+}
+
+// NavGoalData is a pose for Nav2 to navigate to: X and Y in meters and Yaw
+// in radians, in Frame (map by default).
+type NavGoalData struct {
+	X     float64 `json:"x"`
+	Y     float64 `json:"y"`
+	Yaw   float64 `json:"yaw"`
+	Frame string  `json:"frame,omitempty"`
+	// Action is the NavigateToPose action server, /navigate_to_pose by
+	// default; namespaced robots use e.g. /robot1/navigate_to_pose.
+	Action string `json:"action,omitempty"`
+	// TimeoutSec cancels the goal if it hasn't been reached by then (default
+	// 300, at most 1800).
+	TimeoutSec int `json:"timeout_sec,omitempty"`
+}
+
+// DockData is for the dock and undock commands. Namespace prefixes the
+// Create 3's actions on robots launched with one, e.g. /robot1.
+type DockData struct {
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// WaitData pauses for Seconds, e.g. at a mission waypoint. An e-stop ends
+// the wait early.
+type WaitData struct {
+	Seconds int `json:"seconds"`
+}
+
 // IdentifyData describes identification instructions.
 type IdentifyData struct {
 	Pattern  string `json:"pattern"`
@@ -51,9 +158,232 @@ type IdentifyData struct {
 // ConfigureAgentData describes agent configuration instructions.
 type ConfigureAgentData struct {
 	AgentID string `json:"agent_id"`
+	// Type, when set, replaces the configured "robot" or "laptop" type.
+	Type string `json:"type,omitempty"`
+	// ROSContainer, when set, replaces the configured container; an empty
+	// string runs ROS on the host again.
+	ROSContainer *string `json:"ros_container,omitempty"`
+}
+
+// InstallPackagesData lists packages to install with apt. ROS packages are
+// package.xml names, installed as ros-<distro>-<name>.
+type InstallPackagesData struct {
+	Apt []string `json:"apt,omitempty"`
+	ROS []string `json:"ros,omitempty"`
+}
+
+// SetEnvData replaces the env vars exported for the scenario's build and
+// launch, and for login shells.
+type SetEnvData struct {
+	Vars map[string]string `json:"vars"`
+}
+
+// BuildWorkspaceData lists shell commands run in the ROS workspace, e.g.
+// "colcon build".
+type BuildWorkspaceData struct {
+	Steps []string `json:"steps"`
+}
+
+// ColconBuildData describes a colcon build of a ROS workspace.
+type ColconBuildData struct {
+	// Path is the workspace root, relative to workspace_path or absolute;
+	// empty means the workspace workspace_path is in.
+	Path string `json:"path,omitempty"`
+	// ParallelWorkers caps how many packages build at once; 0 leaves it to
+	// colcon, which uses every CPU.
+	ParallelWorkers int `json:"parallel_workers,omitempty"`
+	// PackagesSelect builds only these packages.
+	PackagesSelect []string `json:"packages_select,omitempty"`
+}
+
+// RosdepInstallData describes installing, with rosdep, the system
+// dependencies of the packages in a workspace's src directory.
+type RosdepInstallData struct {
+	// Path is the workspace root, as for ColconBuildData.
+	Path string `json:"path,omitempty"`
+}
+
+// ROSLaunchData describes the ros2 launch kept running as a service.
+type ROSLaunchData struct {
+	Package string            `json:"package"`
+	File    string            `json:"file"`
+	Args    map[string]string `json:"args,omitempty"`
+}
+
+// ROSLaunchStartData describes a ros2 launch the agent runs and tracks
+// itself, without a systemd unit. Name defaults to "package/file".
+type ROSLaunchStartData struct {
+	Name    string            `json:"name,omitempty"`
+	Package string            `json:"package"`
+	File    string            `json:"file"`
+	Args    map[string]string `json:"args,omitempty"`
+}
+
+// ROSLaunchStopData names the launch to stop.
+type ROSLaunchStopData struct {
+	Name string `json:"name"`
+}
+
+// BagStartData starts recording a ROS bag. Name identifies the recording for
+// bag_stop. Topics are recorded, or every topic when empty, for DurationSec
+// seconds at most; the bag is then uploaded as a gzipped tar to UploadURL.
+type BagStartData struct {
+	Name        string   `json:"name"`
+	Topics      []string `json:"topics,omitempty"`
+	DurationSec int      `json:"duration_sec"`
+	UploadURL   string   `json:"upload_url"`
+}
+
+// BagStopData names the recording to stop early.
+type BagStopData struct {
+	Name string `json:"name"`
+}
+
+// SetLogLevelData raises or lowers the logger level of running ROS nodes for
+// a while, e.g. to debug during a support session.
+type SetLogLevelData struct {
+	// Nodes are full node names, e.g. /amcl or /robot1/controller_server.
+	Nodes []string `json:"nodes"`
+	// Level is debug, info, warn, error or fatal.
+	Level string `json:"level"`
+	// DurationSec is how long until the nodes go back to their previous
+	// level (default 900, at most 14400).
+	DurationSec int `json:"duration_sec,omitempty"`
+}
+
+// EStopData says why an estop was sent.
+type EStopData struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// DockerDeployData describes a container deployment: one image run as a
+// container, or a compose project. Exactly one of Image and Compose is set.
+type DockerDeployData struct {
+	// Name is the container, or the compose project.
+	Name  string `json:"name"`
+	Image string `json:"image,omitempty"`
+	// Compose is the compose file's contents.
+	Compose string `json:"compose,omitempty"`
+	// Env is passed to the container, or to the compose file for ${VAR}
+	// interpolation.
+	Env     map[string]string `json:"env,omitempty"`
+	Volumes []string          `json:"volumes,omitempty"`
 }
 
 // BatchData describes a list of commands to execute sequentially.
 type BatchData struct {
 	Commands []Command `json:"commands"`
+	// Steps, when set, holds how to run the command at the same index.
+	// Without it each command is tried once and the first failure ends the
+	// batch.
+	Steps []BatchStep `json:"steps,omitempty"`
+}
+
+// BatchStep is how a batch runs one of its commands and decides it worked.
+type BatchStep struct {
+	// Name labels the step in the job's progress; it defaults to the type.
+	Name string `json:"name,omitempty"`
+	// TimeoutSec fails the step, and ends the batch, when the command runs
+	// longer.
+	TimeoutSec int `json:"timeout_sec,omitempty"`
+	// Retries is how many more times a failed step is tried.
+	Retries int `json:"retries,omitempty"`
+	// ContinueOnError runs the following steps even if this one fails.
+	ContinueOnError bool `json:"continue_on_error,omitempty"`
+	// Check is a shell command run in the ROS workspace after the command;
+	// the step only succeeds if it exits 0.
+	Check string `json:"check,omitempty"`
+}
+
+// FormationDriveData is one robot's part of a formation test: drive forward
+// DistanceM at SpeedMPS, starting at StartAt together with the other robots,
+// then post a FormationResult to ResultURL.
+type FormationDriveData struct {
+	// IssuedAt and StartAt are Unix milliseconds on the controller's clock.
+	IssuedAt  int64   `json:"issued_at"`
+	StartAt   int64   `json:"start_at"`
+	DistanceM float64 `json:"distance_m"`
+	SpeedMPS  float64 `json:"speed_mps"`
+	ResultURL string  `json:"result_url"`
+}
+
+// FormationResult is what the agent reports back after a formation drive.
+// Times are Unix milliseconds on the robot's clock; SentAt lets the
+// controller estimate how far that clock is off.
+type FormationResult struct {
+	ReceivedAt int64 `json:"received_at"`
+	// MovingAt is when the forward velocity was published, zero if the
+	// robot never moved.
+	MovingAt   int64  `json:"moving_at,omitempty"`
+	FinishedAt int64  `json:"finished_at,omitempty"`
+	SentAt     int64  `json:"sent_at"`
+	Error      string `json:"error,omitempty"`
+}
+
+// SpeedTestData describes a throughput test against the controller. The agent
+// downloads SizeBytes from DownloadURL, uploads the same amount to UploadURL,
+// and posts the measured rates to ResultURL.
+type SpeedTestData struct {
+	DownloadURL string `json:"download_url"`
+	UploadURL   string `json:"upload_url"`
+	ResultURL   string `json:"result_url"`
+	SizeBytes   int64  `json:"size_bytes"`
+}
+
+// SpeedTestResult is what the agent reports back after a speed test.
+type SpeedTestResult struct {
+	SizeBytes    int64   `json:"size_bytes"`
+	DownloadSec  float64 `json:"download_sec"`
+	UploadSec    float64 `json:"upload_sec"`
+	DownloadMbps float64 `json:"download_mbps"`
+	UploadMbps   float64 `json:"upload_mbps"`
+	Error        string  `json:"error,omitempty"`
+}
+
+// SensorSnapshotData asks the agent for one reading of each sensor, posted as
+// a SensorSnapshot to ResultURL. Empty topics fall back to /scan and /odom.
+type SensorSnapshotData struct {
+	ResultURL string `json:"result_url"`
+	ScanTopic string `json:"scan_topic,omitempty"`
+	OdomTopic string `json:"odom_topic,omitempty"`
+	// ScanPoints caps the number of lidar ranges sent back.
+	ScanPoints int `json:"scan_points,omitempty"`
+}
+
+// SensorSnapshot is one reading of the lidar, camera and odometry. A sensor
+// that could not be read has a nil reading and its error set.
+type SensorSnapshot struct {
+	CapturedAt  time.Time    `json:"captured_at"`
+	Scan        *LidarScan   `json:"scan,omitempty"`
+	ScanError   string       `json:"scan_error,omitempty"`
+	Camera      *CameraFrame `json:"camera,omitempty"`
+	CameraError string       `json:"camera_error,omitempty"`
+	Odom        *OdomReading `json:"odom,omitempty"`
+	OdomError   string       `json:"odom_error,omitempty"`
+}
+
+// LidarScan is a downsampled sensor_msgs/LaserScan. Each range is the nearest
+// return in its sector; nil means no return.
+type LidarScan struct {
+	AngleMin       float64    `json:"angle_min"`
+	AngleIncrement float64    `json:"angle_increment"`
+	RangeMin       float64    `json:"range_min"`
+	RangeMax       float64    `json:"range_max"`
+	Ranges         []*float64 `json:"ranges"`
+	// Points is how many ranges the full scan had.
+	Points int `json:"points"`
+}
+
+// CameraFrame is a single JPEG from the robot's camera.
+type CameraFrame struct {
+	JPEG []byte `json:"jpeg"`
+}
+
+// OdomReading is the pose and velocity from nav_msgs/Odometry.
+type OdomReading struct {
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	Yaw      float64 `json:"yaw"`
+	LinearX  float64 `json:"linear_x"`
+	AngularZ float64 `json:"angular_z"`
 }
@@ -1,9 +1,12 @@
 package agent
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
 
 	"gopkg.in/yaml.v3"
 )
@@ -15,6 +18,43 @@ type Config struct {
 	MQTTBroker     string `yaml:"mqtt_broker"`
 	WorkspacePath  string `yaml:"workspace_path"`
 	WorkspaceOwner string `yaml:"workspace_owner"`
+	// ROSContainer names the Docker container the ROS stack runs in (e.g. on
+	// Jetsons). ROS commands and repo updates then run in it with docker
+	// exec, and WorkspacePath is a path inside the container.
+	ROSContainer string `yaml:"ros_container,omitempty"`
+	// Platform and Sensors override the detected facts (see DetectFacts),
+	// e.g. platform: turtlebot4, sensors: [lidar, camera].
+	Platform string   `yaml:"platform,omitempty"`
+	Sensors  []string `yaml:"sensors,omitempty"`
+	// Hardware overrides the detected board profile used to identify the
+	// robot and show its status.
+	Hardware HardwareProfile `yaml:"hardware,omitempty"`
+	// Drive caps the velocity and duration of drive commands.
+	Drive DriveLimits `yaml:"drive,omitempty"`
+	// PayloadKey decrypts sensitive commands. It is issued by the controller
+	// when the agent is installed, which is why the file is kept private.
+	PayloadKey string `yaml:"payload_key,omitempty"`
+	// ControllerURL and ProvisionToken are baked into the golden image. On
+	// first boot the agent enrolls with the controller (see Enroll), which
+	// replaces AgentID, and the token is cleared.
+	ControllerURL  string `yaml:"controller_url,omitempty"`
+	ProvisionToken string `yaml:"provision_token,omitempty"`
+	// EnrollmentToken, issued by the controller, vouches for the agent on
+	// its first heartbeat (see NewEnrollmentProof). It is kept, so that the
+	// agent is let in again if its robot is removed.
+	EnrollmentToken string `yaml:"enrollment_token,omitempty"`
+}
+
+// configFileMode keeps the config, which may hold the payload key, readable
+// by root only.
+const configFileMode = 0o600
+
+// Validate reports whether the config is usable for a normal start.
+func (c Config) Validate() error {
+	if c.AgentID == "" {
+		return errors.New("config missing agent_id")
+	}
+	return nil
 }
 
 // LoadConfig reads and parses a YAML config file.
@@ -32,3 +72,101 @@ func LoadConfig(path string) (Config, error) {
 	}
 	return cfg, nil
 }
+
+// LastGoodPath is where the most recent config that loaded cleanly is kept.
+func LastGoodPath(path string) string {
+	return path + ".last-good"
+}
+
+// LoadConfigWithRecovery loads the config and, if it is missing or corrupt
+// (e.g. power loss mid-write), falls back to the last-known-good copy and
+// restores it. A config that loads cleanly refreshes the last-good copy.
+func LoadConfigWithRecovery(path string) (Config, error) {
+	cfg, err := LoadConfig(path)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err == nil {
+		if err := writeIfChanged(LastGoodPath(path), path); err != nil {
+			slog.Warn("could not refresh last-good config", "err", err)
+		}
+		return cfg, nil
+	}
+
+	goodPath := LastGoodPath(path)
+	good, goodErr := LoadConfig(goodPath)
+	if goodErr == nil {
+		goodErr = good.Validate()
+	}
+	if goodErr != nil {
+		return Config{}, fmt.Errorf("%v (last-good copy: %v)", err, goodErr)
+	}
+
+	slog.Warn("config unusable; falling back to last-good copy", "path", path, "err", err, "fallback", goodPath)
+	if corrupt, readErr := os.ReadFile(path); readErr == nil {
+		_ = os.WriteFile(path+".corrupt", corrupt, configFileMode)
+	}
+	if err := writeIfChanged(path, goodPath); err != nil {
+		slog.Error("could not restore config from last-good copy", "path", path, "err", err)
+	}
+	return good, nil
+}
+
+// SaveConfig writes the config atomically (temp file, fsync, rename) so a
+// power loss leaves either the old or the new file, never a torn one. The
+// last-good copy is updated as well.
+func SaveConfig(path string, cfg Config) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("marshal config: %w", err)
+	}
+	if err := writeFileAtomic(path, data, configFileMode); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	if err := writeFileAtomic(LastGoodPath(path), data, configFileMode); err != nil {
+		return fmt.Errorf("write last-good config: %w", err)
+	}
+	return nil
+}
+
+func writeIfChanged(dst, src string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if existing, err := os.ReadFile(dst); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+	return writeFileAtomic(dst, data, configFileMode)
+}
+
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
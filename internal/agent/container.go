@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// rosSetup sources every installed ROS distro.
+const rosSetup = `for f in /opt/ros/*/setup.bash; do [ -f "$f" ] && . "$f"; done`
+
+// rosShell runs its arguments with the ROS environment loaded, since docker
+// exec skips the image's entrypoint that normally sources it.
+const rosShell = rosSetup + `; exec "$@"`
+
+// DetectROSContainer returns the running Docker container that holds the ROS
+// stack, for robots whose config doesn't name one. It only looks when ros2
+// isn't installed on the host, and only answers when exactly one running
+// container has "ros" in its name or image.
+func DetectROSContainer() string {
+	if _, err := exec.LookPath("ros2"); err == nil {
+		return ""
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "docker", "ps", "--format", "{{.Names}}\t{{.Image}}").Output()
+	if err != nil {
+		slog.Warn("could not list docker containers", "err", err)
+		return ""
+	}
+	var found []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		name, image, _ := strings.Cut(line, "\t")
+		if strings.Contains(strings.ToLower(name), "ros") || strings.Contains(strings.ToLower(image), "ros") {
+			found = append(found, name)
+		}
+	}
+	if len(found) != 1 {
+		if len(found) > 1 {
+			slog.Warn("several ROS containers running; set ros_container in the agent config", "containers", found)
+		}
+		return ""
+	}
+	return found[0]
+}
+
+// command runs args on the host, or inside the ROS container when one is
+// configured.
+func (c Config) command(ctx context.Context, args ...string) *exec.Cmd {
+	if c.ROSContainer == "" {
+		return exec.CommandContext(ctx, args[0], args[1:]...)
+	}
+	return exec.CommandContext(ctx, "docker", append([]string{"exec", c.ROSContainer}, args...)...)
+}
+
+// commandEnv is command with env (NAME=value) added to the environment. In a
+// container only the names are passed to docker exec, which takes the values
+// from its own environment, so secrets don't show up in ps.
+func (c Config) commandEnv(ctx context.Context, env []string, args ...string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if c.ROSContainer == "" {
+		cmd = exec.CommandContext(ctx, args[0], args[1:]...)
+	} else {
+		dockerArgs := []string{"exec"}
+		for _, kv := range env {
+			name, _, _ := strings.Cut(kv, "=")
+			dockerArgs = append(dockerArgs, "-e", name)
+		}
+		dockerArgs = append(dockerArgs, c.ROSContainer)
+		cmd = exec.CommandContext(ctx, "docker", append(dockerArgs, args...)...)
+	}
+	cmd.Env = append(os.Environ(), env...)
+	return cmd
+}
+
+// rosCommand runs a ROS tool such as ros2, sourcing the ROS environment
+// first when it runs inside a container.
+func (c Config) rosCommand(ctx context.Context, args ...string) *exec.Cmd {
+	if c.ROSContainer == "" {
+		return exec.CommandContext(ctx, args[0], args[1:]...)
+	}
+	return c.command(ctx, append([]string{"bash", "-c", rosShell, "ros"}, args...)...)
+}
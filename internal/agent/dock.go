@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// dockTimeout bounds a dock or undock; the Create 3 gives up on its own
+	// well before this.
+	dockTimeout     = 3 * time.Minute
+	dockStatusTopic = "/dock_status"
+)
+
+// DockStatus is a TurtleBot 4's dock state, as its Create 3 base publishes
+// it on /dock_status.
+type DockStatus struct {
+	Docked      bool `json:"docked"`
+	DockVisible bool `json:"dock_visible"`
+}
+
+// HandleDock drives a TurtleBot 4 onto its dock, or off it when undock is
+// set, with the Create 3's Dock and Undock actions. It is cancelled when ctx
+// ends, as on an e-stop.
+func HandleDock(ctx context.Context, cfg Config, data DockData, undock bool, progress func(string)) error {
+	action, actionType, what := "/dock", "irobot_create_msgs/action/Dock", "docking"
+	if undock {
+		action, actionType, what = "/undock", "irobot_create_msgs/action/Undock", "undocking"
+	}
+	if data.Namespace != "" {
+		if !rosName.MatchString(data.Namespace) {
+			return fmt.Errorf("invalid namespace %q", data.Namespace)
+		}
+		action = strings.TrimSuffix(data.Namespace, "/") + action
+	}
+	slog.Info("dock: sending goal", "action", action, "container", cfg.ROSContainer)
+	progress(what)
+	outcome, err := sendActionGoal(ctx, cfg, action, actionType, "{}", dockTimeout, func(line string) {
+		if strings.TrimSpace(line) == "sees_dock: true" {
+			progress(what + ", dock in sight")
+		}
+	})
+	switch {
+	case err != nil:
+		return err
+	case outcome.status == "SUCCEEDED":
+		slog.Info("dock: done", "action", action)
+		return nil
+	case outcome.rejected:
+		return fmt.Errorf("the base rejected the %s goal", what)
+	default:
+		return fmt.Errorf("%s ended with status %s", what, outcome.status)
+	}
+}
+
+func readDockStatus(ctx context.Context, cfg Config) (DockStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, sensorReadTimeout)
+	defer cancel()
+	out, err := echoOnce(ctx, cfg, dockStatusTopic)
+	if err != nil {
+		return DockStatus{}, err
+	}
+	var msg struct {
+		DockVisible *bool `yaml:"dock_visible"`
+		IsDocked    *bool `yaml:"is_docked"`
+	}
+	if err := yaml.NewDecoder(bytes.NewReader(out)).Decode(&msg); err != nil {
+		return DockStatus{}, err
+	}
+	if msg.IsDocked == nil {
+		return DockStatus{}, errors.New("unexpected /dock_status message")
+	}
+	st := DockStatus{Docked: *msg.IsDocked}
+	if msg.DockVisible != nil {
+		st.DockVisible = *msg.DockVisible
+	}
+	return st, nil
+}
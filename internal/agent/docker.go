@@ -0,0 +1,307 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// dockerStatePath remembers the current and previous deployment, so the
+	// controller can roll back without naming the previous image again.
+	dockerStatePath = "/var/lib/openrobotfleet-agent/docker.json"
+	// dockerComposeDir holds one directory per compose project.
+	dockerComposeDir = "/var/lib/openrobotfleet-agent/compose"
+	// dockerDeployTimeout bounds pulling and starting a deployment; large
+	// images on lab wifi take a while.
+	dockerDeployTimeout = 30 * time.Minute
+	// dockerCheckInterval is how often the containers are re-read for the
+	// heartbeat. A new deployment is picked up straight away.
+	dockerCheckInterval = 30 * time.Second
+)
+
+var (
+	// dockerName is valid both as a container name and a compose project.
+	dockerName  = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	dockerImage = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/:@-]*$`)
+)
+
+// dockerState is the deployment running now and the one before it.
+type dockerState struct {
+	Current  *DockerDeployData `json:"current,omitempty"`
+	Previous *DockerDeployData `json:"previous,omitempty"`
+}
+
+// DockerStatus is the deployment the agent made and the health of its
+// containers, reported in heartbeats.
+type DockerStatus struct {
+	Name    string `json:"name"`
+	Image   string `json:"image,omitempty"`
+	Compose bool   `json:"compose,omitempty"`
+	// PreviousImage is the image a rollback returns to, empty when the
+	// previous deployment was a compose project.
+	PreviousImage string `json:"previous_image,omitempty"`
+	// CanRollback is set when there is a previous deployment.
+	CanRollback bool              `json:"can_rollback,omitempty"`
+	Containers  []ContainerStatus `json:"containers"`
+}
+
+// ContainerStatus is one container of the deployment. Health is healthy,
+// unhealthy or starting, or empty when the image has no health check.
+type ContainerStatus struct {
+	Name   string `json:"name"`
+	Image  string `json:"image"`
+	State  string `json:"state"`
+	Health string `json:"health,omitempty"`
+}
+
+func (d DockerDeployData) validate() error {
+	if !dockerName.MatchString(d.Name) {
+		return fmt.Errorf("invalid container name %q", d.Name)
+	}
+	if (d.Image == "") == (d.Compose == "") {
+		return errors.New("set either an image or a compose file")
+	}
+	if d.Image != "" && !dockerImage.MatchString(d.Image) {
+		return fmt.Errorf("invalid image %q", d.Image)
+	}
+	for k := range d.Env {
+		if !envVarName.MatchString(k) {
+			return fmt.Errorf("invalid env var name %q", k)
+		}
+	}
+	for _, v := range d.Volumes {
+		if v == "" || strings.HasPrefix(v, "-") || strings.ContainsAny(v, "\n\x00") {
+			return fmt.Errorf("invalid volume %q", v)
+		}
+	}
+	return nil
+}
+
+// HandleDockerDeploy pulls and (re)starts a deployment, replacing the one
+// made before, which is kept for HandleDockerRollback.
+func HandleDockerDeploy(data DockerDeployData) error {
+	if err := data.validate(); err != nil {
+		return err
+	}
+	state, err := loadDockerState()
+	if err != nil {
+		return err
+	}
+	if err := deployDocker(data, state.Current); err != nil {
+		return err
+	}
+	if state.Current != nil && !sameDeployment(*state.Current, data) {
+		state.Previous = state.Current
+	}
+	state.Current = &data
+	return saveDockerState(state)
+}
+
+// HandleDockerRollback redeploys the previous deployment. Rolling back twice
+// returns to where it started.
+func HandleDockerRollback() error {
+	state, err := loadDockerState()
+	if err != nil {
+		return err
+	}
+	if state.Previous == nil {
+		return errors.New("no previous docker deployment to roll back to")
+	}
+	if err := deployDocker(*state.Previous, state.Current); err != nil {
+		return err
+	}
+	state.Current, state.Previous = state.Previous, state.Current
+	return saveDockerState(state)
+}
+
+func sameDeployment(a, b DockerDeployData) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return string(x) == string(y)
+}
+
+// deployDocker starts data, first removing old if it used another name or
+// kind, so the two don't run side by side.
+func deployDocker(data DockerDeployData, old *DockerDeployData) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dockerDeployTimeout)
+	defer cancel()
+	if old != nil && (old.Name != data.Name || (old.Compose == "") != (data.Compose == "")) {
+		if err := removeDocker(ctx, *old); err != nil {
+			slog.Warn("cannot remove previous docker deployment", "name", old.Name, "err", err)
+		}
+	}
+	if data.Compose != "" {
+		return deployCompose(ctx, data)
+	}
+	run := []string{"docker", "run", "-d", "--name", data.Name, "--restart", "unless-stopped", "--network", "host"}
+	keys := make([]string, 0, len(data.Env))
+	for k := range data.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		run = append(run, "-e", k+"="+data.Env[k])
+	}
+	for _, v := range data.Volumes {
+		run = append(run, "-v", v)
+	}
+	if err := runDocker(ctx, nil, "docker", "pull", data.Image); err != nil {
+		return err
+	}
+	// Only stopped once the new image is there to replace it; a missing
+	// container is fine.
+	exec.CommandContext(ctx, "docker", "rm", "-f", data.Name).Run()
+	if err := runDocker(ctx, nil, append(run, data.Image)...); err != nil {
+		return err
+	}
+	slog.Info("deployed docker image", "name", data.Name, "image", data.Image)
+	return nil
+}
+
+func deployCompose(ctx context.Context, data DockerDeployData) error {
+	dir := filepath.Join(dockerComposeDir, data.Name)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	file := filepath.Join(dir, "compose.yaml")
+	if err := os.WriteFile(file, []byte(data.Compose), configFileMode); err != nil {
+		return fmt.Errorf("write %s: %w", file, err)
+	}
+	env := os.Environ()
+	for k, v := range data.Env {
+		env = append(env, k+"="+v)
+	}
+	compose := []string{"docker", "compose", "-p", data.Name, "-f", file}
+	for _, args := range [][]string{
+		append(compose, "pull"),
+		append(compose, "up", "-d", "--remove-orphans"),
+	} {
+		if err := runDocker(ctx, env, args...); err != nil {
+			return err
+		}
+	}
+	slog.Info("deployed compose project", "name", data.Name)
+	return nil
+}
+
+func removeDocker(ctx context.Context, data DockerDeployData) error {
+	if data.Compose != "" {
+		file := filepath.Join(dockerComposeDir, data.Name, "compose.yaml")
+		return runDocker(ctx, nil, "docker", "compose", "-p", data.Name, "-f", file, "down", "--remove-orphans")
+	}
+	return runDocker(ctx, nil, "docker", "rm", "-f", data.Name)
+}
+
+func runDocker(ctx context.Context, env []string, args ...string) error {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = env
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", strings.Join(args, " "), err, tail(output))
+	}
+	return nil
+}
+
+func loadDockerState() (dockerState, error) {
+	var state dockerState
+	raw, err := os.ReadFile(dockerStatePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(raw, &state)
+	}
+	if err != nil {
+		return state, fmt.Errorf("read docker state: %w", err)
+	}
+	return state, nil
+}
+
+func saveDockerState(state dockerState) error {
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dockerStatePath), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(dockerStatePath, raw, configFileMode)
+}
+
+// dockerWatch caches the deployment's status between heartbeats.
+type dockerWatch struct {
+	state     *DockerStatus
+	checkedAt time.Time
+	// recorded is the modification time of the state file when last read.
+	recorded time.Time
+}
+
+// current returns the deployment's status, or nil if nothing was deployed.
+func (w *dockerWatch) current() *DockerStatus {
+	info, err := os.Stat(dockerStatePath)
+	if err != nil {
+		return nil
+	}
+	if info.ModTime().Equal(w.recorded) && time.Since(w.checkedAt) < dockerCheckInterval {
+		return w.state
+	}
+	state, err := loadDockerState()
+	if err != nil || state.Current == nil {
+		if err != nil {
+			slog.Warn("cannot read docker state", "err", err)
+		}
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	w.state = inspectDocker(ctx, state)
+	w.checkedAt = time.Now()
+	w.recorded = info.ModTime()
+	return w.state
+}
+
+// inspectDocker lists the deployment's containers with their state and
+// health.
+func inspectDocker(ctx context.Context, state dockerState) *DockerStatus {
+	cur := state.Current
+	st := &DockerStatus{Name: cur.Name, Image: cur.Image, Compose: cur.Compose != "", Containers: []ContainerStatus{}}
+	if prev := state.Previous; prev != nil {
+		st.CanRollback = true
+		st.PreviousImage = prev.Image
+	}
+	filter := "name=^" + cur.Name + "$"
+	if st.Compose {
+		filter = "label=com.docker.compose.project=" + cur.Name
+	}
+	out, err := exec.CommandContext(ctx, "docker", "ps", "-a", "--filter", filter, "--format", "{{.Names}}\t{{.Image}}\t{{.State}}\t{{.Status}}").Output()
+	if err != nil {
+		slog.Warn("could not list deployed containers", "name", cur.Name, "err", err)
+		return st
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		f := strings.SplitN(line, "\t", 4)
+		if len(f) < 4 {
+			continue
+		}
+		c := ContainerStatus{Name: f[0], Image: f[1], State: f[2]}
+		switch {
+		case strings.Contains(f[3], "(unhealthy)"):
+			c.Health = "unhealthy"
+		case strings.Contains(f[3], "(healthy)"):
+			c.Health = "healthy"
+		case strings.Contains(f[3], "(health: starting)"):
+			c.Health = "starting"
+		}
+		st.Containers = append(st.Containers, c)
+	}
+	return st
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+)
+
+// Default drive caps, safe for a TurtleBot in a classroom. A robot's
+// config.yaml can set its own under drive.
+const (
+	defaultMaxLinear      = 0.22 // m/s
+	defaultMaxAngular     = 1.0  // rad/s
+	defaultMaxDurationSec = 10
+)
+
+// driveRate is how often a drive publishes its velocity, in Hz. Robots such
+// as the Create 3 stop on their own when /cmd_vel goes quiet.
+const driveRate = 10
+
+// testDriveSpeed is the forward speed of a test_drive, in m/s.
+const testDriveSpeed = 0.1
+
+// DriveLimits caps what a drive command may ask for. Zero fields use the
+// defaults. They are only set in the agent's own config, so a dashboard
+// user can't raise them.
+type DriveLimits struct {
+	MaxLinear      float64 `yaml:"max_linear,omitempty"`
+	MaxAngular     float64 `yaml:"max_angular,omitempty"`
+	MaxDurationSec float64 `yaml:"max_duration_sec,omitempty"`
+}
+
+func (l DriveLimits) withDefaults() DriveLimits {
+	if l.MaxLinear <= 0 {
+		l.MaxLinear = defaultMaxLinear
+	}
+	if l.MaxAngular <= 0 {
+		l.MaxAngular = defaultMaxAngular
+	}
+	if l.MaxDurationSec <= 0 {
+		l.MaxDurationSec = defaultMaxDurationSec
+	}
+	return l
+}
+
+// check reports why data is outside the limits, if it is.
+func (l DriveLimits) check(data DriveData) error {
+	switch {
+	case math.IsNaN(data.Linear) || math.Abs(data.Linear) > l.MaxLinear:
+		return fmt.Errorf("linear velocity %g m/s is over this robot's limit of %g m/s", data.Linear, l.MaxLinear)
+	case math.IsNaN(data.Angular) || math.Abs(data.Angular) > l.MaxAngular:
+		return fmt.Errorf("angular velocity %g rad/s is over this robot's limit of %g rad/s", data.Angular, l.MaxAngular)
+	case !(data.DurationSec > 0):
+		return errors.New("duration_sec must be positive")
+	case data.DurationSec > l.MaxDurationSec:
+		return fmt.Errorf("duration %gs is over this robot's limit of %gs", data.DurationSec, l.MaxDurationSec)
+	}
+	return nil
+}
+
+// HandleDrive drives at a fixed linear and angular velocity for a while,
+// then stops. It publishes in bursts of a second rather than in one
+// ros2 topic pub, since killing docker exec leaves the publisher running in
+// the container; an e-stop cancels ctx and the drive ends with the burst.
+func HandleDrive(ctx context.Context, cfg Config, data DriveData) error {
+	limits := cfg.Drive.withDefaults()
+	if err := limits.check(data); err != nil {
+		return err
+	}
+	slog.Info("driving", "linear", data.Linear, "angular", data.Angular, "duration_sec", data.DurationSec)
+
+	twist := fmt.Sprintf("{linear: {x: %g, y: 0.0, z: 0.0}, angular: {x: 0.0, y: 0.0, z: %g}}", data.Linear, data.Angular)
+	remaining := int(math.Round(data.DurationSec * driveRate))
+	if remaining < 1 {
+		remaining = 1
+	}
+	var driveErr error
+	for remaining > 0 && ctx.Err() == nil {
+		burst := min(remaining, driveRate)
+		cmd := cfg.rosCommand(ctx, "ros2", "topic", "pub", "--times", strconv.Itoa(burst), "--rate", strconv.Itoa(driveRate), "/cmd_vel", "geometry_msgs/msg/Twist", twist)
+		if out, err := cmd.CombinedOutput(); err != nil && ctx.Err() == nil {
+			driveErr = fmt.Errorf("drive failed: %v: %s", err, string(out))
+			break
+		}
+		remaining -= burst
+	}
+
+	if err := ctx.Err(); err != nil {
+		// The e-stop is publishing zero velocity already.
+		return errEStopped
+	}
+	if err := HandleStop(cfg); err != nil {
+		return err
+	}
+	if driveErr != nil {
+		return driveErr
+	}
+	slog.Info("drive complete")
+	return nil
+}
+
+// HandleTestDrive drives slowly forward for DurationSec, two seconds when
+// it isn't set.
+func HandleTestDrive(ctx context.Context, cfg Config, data TestDriveData) error {
+	duration := float64(data.DurationSec)
+	if duration <= 0 {
+		duration = 2
+	}
+	return HandleDrive(ctx, cfg, DriveData{Linear: testDriveSpeed, DurationSec: duration})
+}
@@ -3,8 +3,9 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"example.com/openrobot-fleet/internal/agent/behavior"
@@ -18,23 +19,55 @@ type AgentEngine struct {
 	JobManager *JobManager
 	Blackboard *behavior.Blackboard
 	Tree       behavior.Node
-
-	cmdChan                chan Command
-	lastIP                 string
-	lastHeartbeat          time.Time
+	// Version is the agent build, reported in every heartbeat.
+	Version string
+
+	commands      commandQueue
+	lastIP        string
+	lastHeartbeat time.Time
+	// lastProgress is the job progress the last heartbeat carried.
+	lastProgress           string
 	lastConnectAttempt     time.Time
 	lastProcessedCommandID string
+	bootTime               time.Time
+	firstConnectedAt       time.Time
+	battery                batterySampler
+	pose                   poseSampler
+	status                 statusIndicator
+	facts                  Facts
+	workspace              workspaceWatch
+	docker                 dockerWatch
+	launches               launchManager
+	bags                   bagManager
+	camera                 cameraServer
+	teleop                 teleopSession
+	estop                  estopLatch
+	logLevels              logLevelManager
+	// lastEStopChange is the e-stop change the last heartbeat carried.
+	lastEStopChange int
+	// badEnrollmentToken is set once a malformed enrollment token has been
+	// logged.
+	badEnrollmentToken bool
+	// bootID identifies this boot; bootResults are the outcomes of commands
+	// deferred to it that haven't been reported yet.
+	bootID      string
+	bootResults []bootResult
+	suspend     suspendWatch
 }
 
 func NewAgentEngine(cfg Config) *AgentEngine {
 	bb := behavior.NewBlackboard()
 	jm := NewJobManager()
+	hw := ResolveHardware(cfg)
+	slog.Info("hardware profile", "model", hw.Model, "green_led", hw.GreenLED, "red_led", hw.RedLED, "audio", hw.Audio, "display", hw.Display)
 
 	engine := &AgentEngine{
 		Config:     cfg,
 		JobManager: jm,
 		Blackboard: bb,
-		cmdChan:    make(chan Command, 10),
+		bootTime:   DetectBootTime(),
+		bootID:     DetectBootID(),
+		status:     statusIndicator{led: hw.RedLED},
 	}
 
 	// Initialize Blackboard
@@ -45,21 +78,39 @@ func NewAgentEngine(cfg Config) *AgentEngine {
 }
 
 func (e *AgentEngine) Start(ctx context.Context) {
+	// 0. Hold the robot if it was e-stopped, then run commands deferred to
+	// this boot
+	e.estop.restore(e.Config)
+	e.logLevels.restore(e.Config)
+	e.runBootQueue()
+
 	// 1. Connect MQTT
 	e.connectMQTT()
 
 	// 2. Build Tree
 	e.Tree = e.buildTree()
 
+	e.facts = DetectFacts(ctx, e.Config)
+	slog.Info("robot facts", "platform", e.facts.Platform, "ros_distro", e.facts.ROSDistro, "sensors", e.facts.Sensors)
+
+	if e.Config.Type != "laptop" {
+		go e.battery.run(ctx, e.Config, e.facts.Platform == "turtlebot4")
+		go e.pose.run(ctx, e.Config)
+	}
+
 	// 3. Loop
 	ticker := time.NewTicker(100 * time.Millisecond) // 10Hz Tick
 	defer ticker.Stop()
 
-	log.Println("Agent Engine started (Behavior Tree Mode)")
+	slog.Info("agent engine started", "agent_id", e.Config.AgentID)
 
 	for {
 		select {
 		case <-ctx.Done():
+			e.launches.stopAll(e.Config)
+			e.bags.stopAll(e.Config)
+			e.camera.close()
+			e.teleop.stop("")
 			return
 		case <-ticker.C:
 			e.Tree.Tick(ctx, e.Blackboard)
@@ -69,15 +120,18 @@ func (e *AgentEngine) Start(ctx context.Context) {
 
 func (e *AgentEngine) connectMQTT() {
 	onConnect := func(c mqttlib.Client) {
-		log.Printf("MQTT Connected")
+		slog.Info("MQTT connected")
 		// Subscribe
 		topic := "lab/commands/" + e.Config.AgentID
-		log.Printf("Subscribing to %s", topic)
+		slog.Info("subscribing", "topic", topic)
 		if token := c.Subscribe(topic, 0, e.mqttHandler); token.Wait() && token.Error() != nil {
-			log.Printf("subscribe error: %v", token.Error())
+			slog.Error("subscribe failed", "topic", topic, "err", token.Error())
 		}
 		if token := c.Subscribe("lab/commands/all", 0, e.mqttHandler); token.Wait() && token.Error() != nil {
-			log.Printf("subscribe all error: %v", token.Error())
+			slog.Error("subscribe failed", "topic", "lab/commands/all", "err", token.Error())
+		}
+		if token := c.Subscribe(EStopTopic, 1, e.mqttHandler); token.Wait() && token.Error() != nil {
+			slog.Error("subscribe failed", "topic", EStopTopic, "err", token.Error())
 		}
 	}
 
@@ -87,23 +141,52 @@ func (e *AgentEngine) connectMQTT() {
 }
 
 func (e *AgentEngine) mqttHandler(_ mqttlib.Client, msg mqttlib.Message) {
+	if len(msg.Payload()) == 0 {
+		// A cleared retained message, such as the fleet e-stop's.
+		return
+	}
 	var cmd Command
 	if err := json.Unmarshal(msg.Payload(), &cmd); err != nil {
-		log.Printf("invalid command JSON: %v", err)
+		slog.Warn("invalid command JSON", "topic", msg.Topic(), "err", err)
 		return
 	}
-	// Non-blocking send
-	select {
-	case e.cmdChan <- cmd:
-		log.Printf("Queued command: %s", cmd.Type)
-	default:
-		log.Printf("command queue full, dropping command: %s", cmd.Type)
+	cmd.receivedAt = time.Now()
+	// An e-stop skips the queue and the job manager, so a full queue or a
+	// busy robot can't hold it up.
+	if cmd.Type == "estop" || cmd.Type == "estop_clear" {
+		e.handleEStop(cmd)
+		return
+	}
+	if e.commands.duplicate(cmd.ID) {
+		slog.Debug("dropping duplicate command", "type", cmd.Type, "command_id", cmd.ID)
+		return
+	}
+	if e.commands.push(cmd) {
+		slog.Info("queued command", "type", cmd.Type, "priority", cmd.effectivePriority(), "command_id", cmd.ID, "correlation_id", cmd.CorrelationID)
+	} else {
+		slog.Warn("command queue full, dropping command", "type", cmd.Type, "priority", cmd.effectivePriority(), "command_id", cmd.ID, "correlation_id", cmd.CorrelationID)
+	}
+}
+
+// handleEStop engages or clears the e-stop. A command sent to this robot
+// alone is acknowledged like a job; the fleet-wide one has no job.
+func (e *AgentEngine) handleEStop(cmd Command) {
+	if cmd.Type == "estop_clear" {
+		e.estop.clear()
+	} else {
+		var data EStopData
+		_ = json.Unmarshal(cmd.Data, &data)
+		e.estop.engage(e.Config, data.Reason)
+	}
+	if cmd.ID != "" {
+		e.JobManager.Record(cmd.ID, cmd.Type, cmd.CorrelationID, nil)
 	}
 }
 
 func (e *AgentEngine) buildTree() behavior.Node {
 	return &behavior.Parallel{
 		Children: []behavior.Node{
+			&behavior.ActionNode{Action: e.watchSuspend},
 			&behavior.ActionNode{Action: e.checkNetwork},
 			&behavior.ActionNode{Action: e.maintainConnection},
 			&behavior.ActionNode{Action: e.processCommands},
@@ -117,18 +200,23 @@ func (e *AgentEngine) maintainConnection(ctx context.Context, bb *behavior.Black
 		return behavior.StatusFailure
 	}
 	if !e.MQTTClient.Client.IsConnected() {
+		e.status.connected(false)
 		if time.Since(e.lastConnectAttempt) > 5*time.Second {
-			log.Println("MQTT disconnected, attempting reconnect...")
+			slog.Warn("MQTT disconnected, attempting reconnect")
 			go func() {
 				token := e.MQTTClient.Client.Connect()
 				if token.Wait() && token.Error() != nil {
-					log.Printf("reconnect failed: %v", token.Error())
+					slog.Warn("reconnect failed", "err", token.Error())
 				}
 			}()
 			e.lastConnectAttempt = time.Now()
 		}
 		return behavior.StatusFailure
 	}
+	e.status.connected(true)
+	if e.firstConnectedAt.IsZero() {
+		e.firstConnectedAt = time.Now()
+	}
 	return behavior.StatusSuccess
 }
 
@@ -138,7 +226,7 @@ func (e *AgentEngine) checkNetwork(ctx context.Context, bb *behavior.Blackboard)
 	currentIP := DetectIPv4()
 	if currentIP != e.lastIP {
 		if e.lastIP != "" {
-			log.Printf("IP changed from %s to %s", e.lastIP, currentIP)
+			slog.Info("IP changed", "from", e.lastIP, "to", currentIP)
 		}
 		e.lastIP = currentIP
 		bb.Set(behavior.KeyIPAddress, currentIP)
@@ -146,42 +234,94 @@ func (e *AgentEngine) checkNetwork(ctx context.Context, bb *behavior.Blackboard)
 	return behavior.StatusSuccess
 }
 
+// processCommands starts the most urgent queued command. While a job runs
+// only critical commands are taken; they run alongside it.
 func (e *AgentEngine) processCommands(ctx context.Context, bb *behavior.Blackboard) behavior.Status {
-	select {
-	case cmd := <-e.cmdChan:
-		if cmd.ID != "" && cmd.ID == e.lastProcessedCommandID {
-			log.Printf("Ignoring duplicate command ID: %s", cmd.ID)
-			return behavior.StatusSuccess
-		}
-		e.lastProcessedCommandID = cmd.ID
+	cmd, ok := e.commands.pop(e.JobManager.Busy())
+	if !ok {
+		return behavior.StatusSuccess
+	}
+	if cmd.ID != "" && cmd.ID == e.lastProcessedCommandID {
+		slog.Info("ignoring duplicate command", "command_id", cmd.ID, "correlation_id", cmd.CorrelationID)
+		return behavior.StatusSuccess
+	}
+	e.lastProcessedCommandID = cmd.ID
+
+	if cmd.RunAtBoot {
+		e.JobManager.Defer(cmd.ID, cmd.Type, cmd.CorrelationID, e.deferToBoot(cmd))
+		return behavior.StatusSuccess
+	}
 
-		action := e.mapCommandToAction(cmd)
-		if action != nil {
-			jobID := fmt.Sprintf("%d", time.Now().UnixNano())
-			e.JobManager.StartJob(jobID, cmd.Type, cmd.Data, action)
+	// Report under the controller's job ID so it can record the outcome
+	if cmd.ID == "" {
+		cmd.ID = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	var action func() error
+	if cmd.Sealed != "" {
+		if err := OpenCommand(&cmd, e.Config.PayloadKey, e.Config.AgentID); err != nil {
+			slog.Error("cannot decrypt command", "type", cmd.Type, "command_id", cmd.ID, "err", err)
+			action = func() error { return err }
 		}
-	default:
-		// No commands
+	}
+	if action == nil {
+		action = e.mapCommandToAction(cmd)
+	}
+	if action == nil {
+		return behavior.StatusSuccess
+	}
+	if cmd.effectivePriority() == PriorityCritical {
+		e.JobManager.RunCritical(cmd.ID, cmd.Type, cmd.CorrelationID, cmd.Data, action)
+	} else {
+		e.JobManager.StartJob(cmd.ID, cmd.Type, cmd.CorrelationID, cmd.Data, action)
 	}
 	return behavior.StatusSuccess
 }
 
+const (
+	heartbeatInterval = 10 * time.Second
+	// progressInterval is how often heartbeats go out while a running
+	// command's progress keeps changing.
+	progressInterval = 2 * time.Second
+)
+
 func (e *AgentEngine) sendHeartbeat(ctx context.Context, bb *behavior.Blackboard) behavior.Status {
-	if time.Since(e.lastHeartbeat) < 10*time.Second {
+	job := e.JobManager.GetCurrentJob()
+	interval := heartbeatInterval
+	if job != nil && job.Progress != e.lastProgress {
+		interval = progressInterval
+	}
+	estopChange := e.estop.changed()
+	if estopChange != e.lastEStopChange {
+		interval = 0
+	}
+	if time.Since(e.lastHeartbeat) < interval {
 		return behavior.StatusSuccess
 	}
 
-	payload := e.buildStatusPayload()
 	if e.MQTTClient != nil && e.MQTTClient.Client != nil && e.MQTTClient.Client.IsConnected() {
+		e.reportBootResults()
+		payload := e.statusPayload(job)
 		topic := "lab/status/" + e.Config.AgentID
-		e.MQTTClient.Publish(topic, 0, false, payload)
+		// Suspend events are sent once, so make sure they arrive
+		if len(e.suspend.pending) > 0 {
+			if e.MQTTClient.Publish(topic, 1, false, payload) == nil {
+				e.suspend.pending = nil
+			}
+		} else {
+			e.MQTTClient.Publish(topic, 0, false, payload)
+		}
 		e.lastHeartbeat = time.Now()
+		e.lastEStopChange = estopChange
+		if job != nil {
+			e.lastProgress = job.Progress
+		}
 	}
 
 	return behavior.StatusSuccess
 }
 
-func (e *AgentEngine) buildStatusPayload() []byte {
+// statusPayload builds a heartbeat reporting job, if any.
+func (e *AgentEngine) statusPayload(job *Job) []byte {
 	type status struct {
 		Status    string `json:"status"`
 		TS        string `json:"ts"`
@@ -191,21 +331,89 @@ func (e *AgentEngine) buildStatusPayload() []byte {
 		JobID     string `json:"job_id,omitempty"`
 		JobStatus string `json:"job_status,omitempty"`
 		JobError  string `json:"job_error,omitempty"`
+		// JobSteps is the progress of each command of a batch job.
+		JobSteps []StepResult `json:"job_steps,omitempty"`
+		// JobProgress is how far a build or similar long command has got.
+		JobProgress string `json:"job_progress,omitempty"`
+		// CorrelationID ties the job back to the API request that issued it.
+		CorrelationID string `json:"correlation_id,omitempty"`
+		BootTime      string `json:"boot_time,omitempty"`
+		// BootToConnectSec is the delay from power-on until the agent first
+		// reached the broker.
+		BootToConnectSec int `json:"boot_to_connect_sec,omitempty"`
+		// Metrics are host and battery readings stored as telemetry.
+		Metrics      map[string]float64 `json:"metrics,omitempty"`
+		AgentVersion string             `json:"agent_version,omitempty"`
+		// ROSContainer is the container ROS commands run in, empty for the
+		// host.
+		ROSContainer string `json:"ros_container,omitempty"`
+		// Facts are checked against scenario requirements.
+		Facts Facts `json:"facts"`
+		// Workspace is compared with the robot's scenario to detect drift.
+		Workspace Workspace `json:"workspace"`
+		// Docker is nil until a docker_deploy has run.
+		Docker *DockerStatus `json:"docker,omitempty"`
+		// Launches are those started by ros_launch_start, empty when none
+		// are.
+		Launches []LaunchStatus `json:"launches"`
+		// EStop is set while an emergency stop is latched.
+		EStop *EStopStatus `json:"estop,omitempty"`
+		// Dock is the dock state of a TurtleBot 4, nil on other robots.
+		Dock *DockStatus `json:"dock,omitempty"`
+		// Pose is where the robot last was, sampled every 30 seconds; nil
+		// until ROS reports one.
+		Pose *Pose `json:"pose,omitempty"`
+		// Suspends are sleeps of the host not yet reported.
+		Suspends []SuspendEvent `json:"suspends,omitempty"`
+		// Enrollment proves the agent holds an enrollment token.
+		Enrollment *EnrollmentProof `json:"enrollment,omitempty"`
 	}
 
 	s := status{
-		Status: "ok",
-		TS:     time.Now().Format(time.RFC3339),
-		IP:     e.lastIP,
-		Type:   e.Config.Type,
-		Name:   e.Config.AgentID,
+		Status:       "ok",
+		TS:           time.Now().Format(time.RFC3339),
+		IP:           e.lastIP,
+		Type:         e.Config.Type,
+		Name:         e.Config.AgentID,
+		Metrics:      collectMetrics(),
+		AgentVersion: e.Version,
+		ROSContainer: e.Config.ROSContainer,
+		Facts:        e.facts.withDisk(),
+		Workspace:    e.workspace.current(e.Config),
+		Docker:       e.docker.current(),
+		Launches:     e.launches.current(),
+		EStop:        e.estop.status(),
+		Dock:         e.battery.latestDock(),
+		Pose:         e.pose.latest(),
+		Suspends:     e.suspend.pending,
+	}
+	if v, ok := e.battery.latest(); ok {
+		s.Metrics[MetricBattery] = v
+	}
+	if e.Config.EnrollmentToken != "" {
+		proof, err := NewEnrollmentProof(e.Config.EnrollmentToken, e.Config.AgentID)
+		if err != nil && !e.badEnrollmentToken {
+			slog.Warn("ignoring enrollment token", "err", err)
+			e.badEnrollmentToken = true
+		}
+		s.Enrollment = proof
+	}
+
+	if !e.bootTime.IsZero() {
+		s.BootTime = e.bootTime.UTC().Format(time.RFC3339)
+		if !e.firstConnectedAt.IsZero() {
+			s.BootToConnectSec = int(e.firstConnectedAt.Sub(e.bootTime).Seconds())
+		}
 	}
 
 	// Add Job info
-	if job := e.JobManager.GetCurrentJob(); job != nil {
+	if job != nil {
 		s.JobID = job.ID
 		s.JobStatus = string(job.Status)
 		s.JobError = job.Error
+		s.JobSteps = job.Steps
+		s.JobProgress = job.Progress
+		s.CorrelationID = job.CorrelationID
 	}
 
 	buf, _ := json.Marshal(s)
@@ -236,26 +444,145 @@ func (e *AgentEngine) mapCommandToAction(cmd Command) func() error {
 		return func() error { return HandleResetLogs(cfg, payload) }
 	case "restart_ros":
 		return func() error { return HandleRestartROS(cfg) }
+	case "formation_drive":
+		var payload FormationDriveData
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return func() error { return err }
+		}
+		receivedAt := cmd.receivedAt
+		return func() error {
+			if e.estop.engaged() {
+				return errEStopped
+			}
+			return HandleFormationDrive(cfg, payload, receivedAt)
+		}
+	case "docker_deploy":
+		var payload DockerDeployData
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return func() error { return err }
+		}
+		return func() error { return HandleDockerDeploy(payload) }
+	case "docker_rollback":
+		return HandleDockerRollback
 	case "wifi_profile":
 		var payload WifiProfileData
 		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
 			return func() error { return err }
 		}
-		return func() error { return HandleWifiProfile(payload) }
+		return func() error { return HandleWifiProfile(cfg, payload) }
 	case "test_drive":
 		var payload TestDriveData
 		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
 			return func() error { return err }
 		}
-		return func() error { return HandleTestDrive(cfg, payload) }
+		return func() error {
+			ctx, err := e.estop.motionContext()
+			if err != nil {
+				return err
+			}
+			return HandleTestDrive(ctx, cfg, payload)
+		}
+	case "drive":
+		var payload DriveData
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return func() error { return err }
+		}
+		return func() error {
+			ctx, err := e.estop.motionContext()
+			if err != nil {
+				return err
+			}
+			return HandleDrive(ctx, cfg, payload)
+		}
+	case "nav_goal":
+		var payload NavGoalData
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return func() error { return err }
+		}
+		return func() error {
+			ctx, err := e.estop.motionContext()
+			if err != nil {
+				return err
+			}
+			return HandleNavGoal(ctx, cfg, payload, e.JobManager.SetProgress)
+		}
+	case "dock", "undock":
+		var payload DockData
+		if len(cmd.Data) > 0 {
+			if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+				return func() error { return err }
+			}
+		}
+		undock := cmd.Type == "undock"
+		return func() error {
+			ctx, err := e.estop.motionContext()
+			if err != nil {
+				return err
+			}
+			if err := HandleDock(ctx, cfg, payload, undock, e.JobManager.SetProgress); err != nil {
+				return err
+			}
+			e.battery.setDock(DockStatus{Docked: !undock, DockVisible: true})
+			return nil
+		}
+	case "wait":
+		var payload WaitData
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return func() error { return err }
+		}
+		return func() error {
+			ctx, err := e.estop.motionContext()
+			if err != nil {
+				return err
+			}
+			return HandleWait(ctx, payload, e.JobManager.SetProgress)
+		}
+	case "set_log_level":
+		var payload SetLogLevelData
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return func() error { return err }
+		}
+		return func() error { return e.logLevels.set(cfg, payload) }
 	case "stop":
-		return func() error { return HandleStop(cfg) }
+		return func() error {
+			e.teleop.stop("")
+			return HandleStop(cfg)
+		}
 	case "capture_image":
 		var payload CaptureImageData
 		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
 			return func() error { return err }
 		}
-		return func() error { return HandleCaptureImage(cfg, payload) }
+		return func() error { return HandleCaptureImage(cfg, payload, cmd.ID) }
+	case "camera_stream":
+		var payload CameraStreamData
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return func() error { return err }
+		}
+		return func() error { return e.camera.allow(payload) }
+	case "teleop_start":
+		var payload TeleopStartData
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return func() error { return err }
+		}
+		return func() error {
+			ctx, err := e.estop.motionContext()
+			if err != nil {
+				return err
+			}
+			return e.teleop.start(ctx, cfg, payload)
+		}
+	case "teleop_stop":
+		var payload TeleopStopData
+		if len(cmd.Data) > 0 {
+			if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+				return func() error { return err }
+			}
+		}
+		return func() error {
+			e.teleop.stop(payload.Session)
+			return nil
+		}
 	case "identify":
 		var payload IdentifyData
 		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
@@ -264,28 +591,204 @@ func (e *AgentEngine) mapCommandToAction(cmd Command) func() error {
 		return func() error { return HandleIdentify(cfg, payload) }
 	case "reboot":
 		return func() error { return HandleReboot(cfg) }
+	case "speed_test":
+		var payload SpeedTestData
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return func() error { return err }
+		}
+		return func() error { return HandleSpeedTest(cfg, payload) }
+	case "sensor_snapshot":
+		var payload SensorSnapshotData
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return func() error { return err }
+		}
+		return func() error { return HandleSensorSnapshot(cfg, payload) }
+	case "install_packages":
+		var payload InstallPackagesData
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return func() error { return err }
+		}
+		return func() error { return HandleInstallPackages(cfg, payload) }
+	case "set_env":
+		var payload SetEnvData
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return func() error { return err }
+		}
+		return func() error { return HandleSetEnv(payload) }
+	case "build_workspace":
+		var payload BuildWorkspaceData
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return func() error { return err }
+		}
+		return func() error { return HandleBuildWorkspace(cfg, payload) }
+	case "colcon_build":
+		var payload ColconBuildData
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return func() error { return err }
+		}
+		return func() error { return HandleColconBuild(cfg, payload, e.JobManager.SetProgress) }
+	case "rosdep_install":
+		var payload RosdepInstallData
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return func() error { return err }
+		}
+		return func() error { return HandleRosdepInstall(cfg, payload, e.JobManager.SetProgress) }
+	case "ros_launch":
+		var payload ROSLaunchData
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return func() error { return err }
+		}
+		return func() error { return HandleROSLaunch(cfg, payload) }
+	case "ros_launch_start":
+		var payload ROSLaunchStartData
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return func() error { return err }
+		}
+		return func() error { return e.launches.start(cfg, payload) }
+	case "ros_launch_stop":
+		var payload ROSLaunchStopData
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return func() error { return err }
+		}
+		return func() error { return e.launches.stop(cfg, payload.Name) }
+	case "bag_start":
+		var payload BagStartData
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return func() error { return err }
+		}
+		return func() error { return e.bags.start(cfg, payload) }
+	case "bag_stop":
+		var payload BagStopData
+		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
+			return func() error { return err }
+		}
+		return func() error { return e.bags.stop(cfg, payload.Name) }
 	case "batch":
 		var payload BatchData
 		if err := json.Unmarshal(cmd.Data, &payload); err != nil {
 			return func() error { return err }
 		}
-		return func() error { return e.HandleBatch(payload) }
+		return func() error { return e.HandleBatch(cmd.ID, payload) }
 	default:
-		log.Printf("unknown command type: %s", cmd.Type)
+		slog.Warn("unknown command type", "type", cmd.Type, "correlation_id", cmd.CorrelationID)
 		return nil
 	}
 }
 
-func (e *AgentEngine) HandleBatch(data BatchData) error {
+// HandleBatch runs the commands of a batch in order, recording each step's
+// progress on job jobID for the heartbeat.
+func (e *AgentEngine) HandleBatch(jobID string, data BatchData) error {
+	results := make([]StepResult, len(data.Commands))
 	for i, cmd := range data.Commands {
-		log.Printf("batch: executing command %d/%d: %s", i+1, len(data.Commands), cmd.Type)
-		action := e.mapCommandToAction(cmd)
-		if action == nil {
-			return fmt.Errorf("unknown command in batch: %s", cmd.Type)
+		results[i] = StepResult{Name: data.step(i).Name, Type: cmd.Type, Status: JobStatusPending}
+		if results[i].Name == "" {
+			results[i].Name = cmd.Type
+		}
+	}
+	e.JobManager.SetSteps(jobID, results)
+
+	var failed error
+	for i, cmd := range data.Commands {
+		if failed != nil {
+			results[i].Status = JobStatusSkipped
+			continue
+		}
+		step := data.step(i)
+		slog.Info("batch: executing command", "step", i+1, "total", len(data.Commands), "type", cmd.Type, "name", results[i].Name)
+		results[i].Status = JobStatusRunning
+		e.JobManager.SetSteps(jobID, results)
+
+		start := time.Now()
+		stop, err := e.runBatchStep(cmd, step, &results[i])
+		results[i].Seconds = time.Since(start).Round(100 * time.Millisecond).Seconds()
+		if err == nil {
+			results[i].Status = JobStatusSuccess
+		} else {
+			results[i].Status = JobStatusFailed
+			results[i].Error = err.Error()
+			if stop || !step.ContinueOnError {
+				failed = fmt.Errorf("batch failed at %s: %w", results[i].Name, err)
+			} else {
+				slog.Warn("batch: step failed, continuing", "name", results[i].Name, "err", err)
+			}
+		}
+		e.JobManager.SetSteps(jobID, results)
+	}
+	e.JobManager.SetSteps(jobID, results)
+	return failed
+}
+
+// step returns the options of command i, or the defaults.
+func (d BatchData) step(i int) BatchStep {
+	if i < len(d.Steps) {
+		return d.Steps[i]
+	}
+	return BatchStep{}
+}
+
+// batchRetryDelay is the pause before a failed step is tried again.
+const batchRetryDelay = 5 * time.Second
+
+// runBatchStep runs one step with its retries, timeout and check. stop is
+// set when the step timed out: the command may still be running, so the
+// batch must not go on regardless of ContinueOnError.
+func (e *AgentEngine) runBatchStep(cmd Command, step BatchStep, res *StepResult) (stop bool, err error) {
+	action := e.mapCommandToAction(cmd)
+	if action == nil {
+		return true, fmt.Errorf("unknown command in batch: %s", cmd.Type)
+	}
+	timeout := time.Duration(step.TimeoutSec) * time.Second
+	for attempt := 0; attempt <= step.Retries; attempt++ {
+		if attempt > 0 {
+			slog.Info("batch: retrying step", "name", res.Name, "attempt", attempt+1, "err", err)
+			time.Sleep(batchRetryDelay)
 		}
-		if err := action(); err != nil {
-			return fmt.Errorf("batch failed at %s: %w", cmd.Type, err)
+		res.Attempts = attempt + 1
+		if err = runWithTimeout(action, timeout); errors.Is(err, errStepTimeout) {
+			return true, fmt.Errorf("timed out after %s", timeout)
 		}
+		if err == nil && step.Check != "" {
+			err = runStepCheck(e.Config, step.Check, timeout)
+		}
+		if err == nil {
+			return false, nil
+		}
+	}
+	return false, err
+}
+
+var errStepTimeout = errors.New("step timed out")
+
+// runWithTimeout waits at most timeout (if set) for action. Commands can't be
+// interrupted, so one that times out carries on in the background.
+func runWithTimeout(action func() error, timeout time.Duration) error {
+	if timeout <= 0 {
+		return action()
+	}
+	done := make(chan error, 1)
+	go func() { done <- action() }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		return errStepTimeout
+	}
+}
+
+// runStepCheck runs a step's check in the ROS workspace, in the ROS
+// container when there is one.
+func runStepCheck(cfg Config, check string, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	script := check
+	if root := workspaceRoot(cfg); root != "" {
+		script = scenarioScript(root, check)
+	}
+	if output, err := cfg.command(ctx, "bash", "-c", script).CombinedOutput(); err != nil {
+		return fmt.Errorf("check %q failed: %w: %s", check, err, tail(output))
 	}
 	return nil
 }
@@ -0,0 +1,197 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// A golden image carries a provisioning token instead of an identity. On
+// first boot the agent trades it, together with the robot's MAC addresses
+// and serial number, for the name the controller's enrollment pool has for
+// this robot, then forgets the token.
+
+const enrollRetry = 30 * time.Second
+
+// EnrollRequest is sent to the controller's /api/enroll.
+type EnrollRequest struct {
+	Token    string   `json:"token"`
+	MACs     []string `json:"macs"`
+	Serial   string   `json:"serial,omitempty"`
+	Hostname string   `json:"hostname,omitempty"`
+	IP       string   `json:"ip,omitempty"`
+	// Type is the agent's configured type, used when the robot's slot in
+	// the pool doesn't give one.
+	Type string `json:"type,omitempty"`
+}
+
+// EnrollResponse is the identity the controller assigns.
+type EnrollResponse struct {
+	AgentID    string `json:"agent_id"`
+	Type       string `json:"type"`
+	PayloadKey string `json:"payload_key,omitempty"`
+}
+
+var (
+	// errEnrollRejected means the controller refused the token, e.g. after
+	// it was rotated; retrying won't help.
+	errEnrollRejected = errors.New("provisioning token rejected")
+	// errEnrollUnused means the controller has no enrollment pool, so the
+	// robot keeps the name the image gave it.
+	errEnrollUnused = errors.New("controller has no enrollment pool")
+)
+
+// Enroll returns cfg unchanged unless it holds a provisioning token. Then it
+// asks the controller for this robot's identity, retrying until the robot is
+// in the enrollment pool, saves the config it is given and returns it. If
+// the token is rejected, or the controller has no pool, the token is dropped
+// and the agent starts under its own ID.
+func Enroll(ctx context.Context, path string, cfg Config) (Config, error) {
+	if cfg.ProvisionToken == "" {
+		return cfg, nil
+	}
+	if cfg.ControllerURL == "" {
+		slog.Warn("enroll: provisioning token without controller_url; starting unenrolled")
+		return cfg, nil
+	}
+	req := EnrollRequest{
+		Token:  cfg.ProvisionToken,
+		MACs:   DetectMACs(),
+		Serial: DetectSerial(),
+		IP:     DetectIPv4(),
+		Type:   cfg.Type,
+	}
+	req.Hostname, _ = os.Hostname()
+	slog.Info("enrolling with controller", "controller", cfg.ControllerURL, "macs", req.MACs, "serial", req.Serial)
+
+	for {
+		resp, err := requestEnrollment(ctx, cfg.ControllerURL, req)
+		if err == nil {
+			cfg.AgentID = resp.AgentID
+			if resp.Type != "" {
+				cfg.Type = resp.Type
+			}
+			if resp.PayloadKey != "" {
+				cfg.PayloadKey = resp.PayloadKey
+			}
+			cfg.ProvisionToken = ""
+			if err := SaveConfig(path, cfg); err != nil {
+				return cfg, fmt.Errorf("save enrolled config: %w", err)
+			}
+			if out, err := exec.CommandContext(ctx, "hostnamectl", "set-hostname", cfg.AgentID).CombinedOutput(); err != nil {
+				slog.Warn("enroll: set hostname", "err", err, "output", strings.TrimSpace(string(out)))
+			}
+			slog.Info("enrolled", "agent_id", cfg.AgentID, "type", cfg.Type)
+			return cfg, nil
+		}
+		if errors.Is(err, errEnrollRejected) || errors.Is(err, errEnrollUnused) {
+			slog.Warn("enroll: starting under own agent ID", "agent_id", cfg.AgentID, "reason", err)
+			cfg.ProvisionToken = ""
+			if err := SaveConfig(path, cfg); err != nil {
+				slog.Error("enroll: save config", "err", err)
+			}
+			return cfg, nil
+		}
+		// The network may not be up yet on first boot, or the robot not in
+		// the pool yet; both sort themselves out.
+		slog.Warn("enroll: not enrolled yet", "err", err, "retry_in", enrollRetry)
+		select {
+		case <-ctx.Done():
+			return cfg, ctx.Err()
+		case <-time.After(enrollRetry):
+		}
+	}
+}
+
+func requestEnrollment(ctx context.Context, controllerURL string, req EnrollRequest) (EnrollResponse, error) {
+	var out EnrollResponse
+	body, err := json.Marshal(req)
+	if err != nil {
+		return out, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(controllerURL, "/")+"/api/enroll", bytes.NewReader(body))
+	if err != nil {
+		return out, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return out, err
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return out, errEnrollRejected
+	case resp.StatusCode == http.StatusNoContent:
+		return out, errEnrollUnused
+	case resp.StatusCode != http.StatusOK:
+		return out, fmt.Errorf("controller returned %s: %s", resp.Status, strings.TrimSpace(string(raw)))
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return out, fmt.Errorf("parse enrollment: %w", err)
+	}
+	if out.AgentID == "" || strings.ContainsAny(out.AgentID, " \t\n/+#") {
+		return out, fmt.Errorf("controller assigned invalid agent id %q", out.AgentID)
+	}
+	return out, nil
+}
+
+// DetectMACs lists the MAC addresses of the physical network interfaces,
+// skipping loopback and the virtual ones Docker and bridges create.
+func DetectMACs() []string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	macs := []string{}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 || len(iface.HardwareAddr) == 0 {
+			continue
+		}
+		if strings.HasPrefix(iface.Name, "docker") || strings.HasPrefix(iface.Name, "veth") || strings.HasPrefix(iface.Name, "br-") {
+			continue
+		}
+		macs = append(macs, strings.ToLower(iface.HardwareAddr.String()))
+	}
+	return macs
+}
+
+// DetectSerial returns the board's serial number: the device tree's on a
+// Raspberry Pi or Jetson, the one in /proc/cpuinfo on older Pi kernels, or
+// the DMI product serial on a PC. It returns "" if there is none.
+func DetectSerial() string {
+	for _, p := range []string{"/sys/firmware/devicetree/base/serial-number", "/sys/class/dmi/id/product_serial"} {
+		if raw, err := os.ReadFile(p); err == nil {
+			if s := strings.ToLower(strings.Trim(string(raw), "\x00 \t\r\n")); s != "" {
+				return s
+			}
+		}
+	}
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if ok && strings.TrimSpace(key) == "Serial" {
+			return strings.ToLower(strings.TrimSpace(value))
+		}
+	}
+	return ""
+}
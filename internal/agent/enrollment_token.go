@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// An enrollment token is what lets a new agent into the fleet over MQTT,
+// where any client can publish a heartbeat. The controller signs the token's
+// claims; the agent keeps the token in its config and sends, with each
+// heartbeat, the claims and a proof that it holds the token for its agent
+// ID. The token itself never goes over the broker, and a proof seen there
+// is only good for the agent ID it was made for.
+
+const enrollmentTokenPrefix = "ort1."
+
+// EnrollmentClaims is what the controller vouches for when it issues a
+// token.
+type EnrollmentClaims struct {
+	// Label says what the token was issued for, e.g. an image profile.
+	Label    string `json:"label,omitempty"`
+	IssuedAt int64  `json:"iat"`
+	// ExpiresAt is when the token stops letting agents in; 0 for never.
+	ExpiresAt int64 `json:"exp,omitempty"`
+}
+
+// EnrollmentProof is sent in heartbeats by an agent with an enrollment
+// token.
+type EnrollmentProof struct {
+	Claims string `json:"claims"`
+	Proof  string `json:"proof"`
+}
+
+var (
+	errBadEnrollmentToken = errors.New("malformed enrollment token")
+	// ErrEnrollmentProof means the proof wasn't made with a token the
+	// controller signed, or not for this agent ID.
+	ErrEnrollmentProof = errors.New("enrollment token not signed by this controller")
+	// ErrEnrollmentExpired means the token was good but has expired.
+	ErrEnrollmentExpired = errors.New("enrollment token expired")
+)
+
+// SignEnrollmentToken returns a token for claims signed with key.
+func SignEnrollmentToken(key []byte, claims EnrollmentClaims) (string, error) {
+	raw, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(raw)
+	return enrollmentTokenPrefix + encoded + "." + base64.RawURLEncoding.EncodeToString(enrollmentMAC(key, encoded)), nil
+}
+
+// NewEnrollmentProof proves to the controller that the agent agentID holds
+// token.
+func NewEnrollmentProof(token, agentID string) (*EnrollmentProof, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(token), enrollmentTokenPrefix)
+	if !ok {
+		return nil, errBadEnrollmentToken
+	}
+	claims, sig, ok := strings.Cut(rest, ".")
+	if !ok || claims == "" {
+		return nil, errBadEnrollmentToken
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || len(secret) != sha256.Size {
+		return nil, errBadEnrollmentToken
+	}
+	return &EnrollmentProof{Claims: claims, Proof: base64.RawURLEncoding.EncodeToString(enrollmentMAC(secret, agentID))}, nil
+}
+
+// VerifyEnrollmentProof checks that p was made by agentID with a token
+// signed with key that hasn't expired by now, and returns its claims.
+func VerifyEnrollmentProof(key []byte, p EnrollmentProof, agentID string, now time.Time) (EnrollmentClaims, error) {
+	var claims EnrollmentClaims
+	proof, err := base64.RawURLEncoding.DecodeString(p.Proof)
+	if err != nil {
+		return claims, ErrEnrollmentProof
+	}
+	secret := enrollmentMAC(key, p.Claims)
+	if !hmac.Equal(proof, enrollmentMAC(secret, agentID)) {
+		return claims, ErrEnrollmentProof
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(p.Claims)
+	if err != nil || json.Unmarshal(raw, &claims) != nil {
+		return claims, ErrEnrollmentProof
+	}
+	if claims.ExpiresAt != 0 && now.Unix() > claims.ExpiresAt {
+		return claims, ErrEnrollmentExpired
+	}
+	return claims, nil
+}
+
+func enrollmentMAC(key []byte, msg string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
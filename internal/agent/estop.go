@@ -0,0 +1,186 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// EStopTopic carries the fleet-wide e-stop as a retained estop or
+// estop_clear command, so robots that connect while it is engaged stop too.
+const EStopTopic = "lab/estop"
+
+const (
+	estopStatePath = "/var/lib/openrobotfleet-agent/estop.json"
+	// estopBurst is how many zero-velocity messages each ros2 topic pub
+	// sends at 10Hz before the next one takes over. Clearing lets the
+	// current burst finish, so it is kept short.
+	estopBurst = "100"
+	zeroTwist  = "{linear: {x: 0.0, y: 0.0, z: 0.0}, angular: {x: 0.0, y: 0.0, z: 0.0}}"
+)
+
+var errEStopped = errors.New("emergency stop is engaged; send estop_clear first")
+
+// EStopStatus is a latched emergency stop.
+type EStopStatus struct {
+	Since  time.Time `json:"since"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// estopLatch keeps publishing zero velocity from an estop until estop_clear,
+// across agent restarts. It runs outside the job manager so a busy robot
+// can't delay it.
+type estopLatch struct {
+	mu     sync.Mutex
+	state  *EStopStatus
+	cancel context.CancelFunc
+	// motion ends when the stop engages, cutting short drives in progress.
+	motion     context.Context
+	stopMotion context.CancelFunc
+	// changes counts engages and clears, so a heartbeat reports them
+	// straight away.
+	changes int
+}
+
+// engage latches the stop. Engaging it again keeps the original time and
+// reason.
+func (l *estopLatch) engage(cfg Config, reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.state != nil {
+		return
+	}
+	l.state = &EStopStatus{Since: time.Now().UTC(), Reason: reason}
+	l.changes++
+	if err := saveEStop(*l.state); err != nil {
+		slog.Error("cannot save e-stop; it won't survive an agent restart", "err", err)
+	}
+	l.haltMotion()
+	l.publish(cfg)
+	slog.Warn("emergency stop engaged", "reason", reason)
+}
+
+// clear releases the stop. It reports whether one was engaged.
+func (l *estopLatch) clear() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.state == nil {
+		return false
+	}
+	l.cancel()
+	l.state = nil
+	l.changes++
+	if err := os.Remove(estopStatePath); err != nil && !os.IsNotExist(err) {
+		slog.Error("cannot remove saved e-stop", "err", err)
+	}
+	slog.Info("emergency stop cleared")
+	return true
+}
+
+// restore re-engages a stop saved before the agent restarted.
+func (l *estopLatch) restore(cfg Config) {
+	raw, err := os.ReadFile(estopStatePath)
+	if err != nil {
+		return
+	}
+	var st EStopStatus
+	if err := json.Unmarshal(raw, &st); err != nil {
+		slog.Warn("invalid saved e-stop, engaging anyway", "err", err)
+		st.Since = time.Now().UTC()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.state = &st
+	l.changes++
+	l.haltMotion()
+	l.publish(cfg)
+	slog.Warn("emergency stop still engaged from before restart", "since", st.Since, "reason", st.Reason)
+}
+
+// publish sends zero velocity at 10Hz until the stop is cleared. ros2 topic
+// pub is run in bursts rather than killed, since killing docker exec leaves
+// the publisher running in the container.
+func (l *estopLatch) publish(cfg Config) {
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	go func() {
+		for ctx.Err() == nil {
+			cmd := cfg.rosCommand(ctx, "ros2", "topic", "pub", "--times", estopBurst, "--rate", "10", "/cmd_vel", "geometry_msgs/msg/Twist", zeroTwist)
+			output, err := cmd.CombinedOutput()
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				// ROS may still be starting; keep trying.
+				slog.Warn("e-stop publisher failed", "err", err, "output", tail(output))
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Second):
+				}
+			}
+		}
+	}()
+}
+
+// motionContext returns the context a drive runs in, or errEStopped while
+// the stop is engaged.
+func (l *estopLatch) motionContext() (context.Context, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.state != nil {
+		return nil, errEStopped
+	}
+	if l.motion == nil {
+		l.motion, l.stopMotion = context.WithCancel(context.Background())
+	}
+	return l.motion, nil
+}
+
+// haltMotion cancels the drives in progress. l.mu must be held.
+func (l *estopLatch) haltMotion() {
+	if l.stopMotion != nil {
+		l.stopMotion()
+		l.motion, l.stopMotion = nil, nil
+	}
+}
+
+func (l *estopLatch) engaged() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state != nil
+}
+
+// status returns the stop, nil when clear.
+func (l *estopLatch) status() *EStopStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.state == nil {
+		return nil
+	}
+	st := *l.state
+	return &st
+}
+
+// changed counts engages and clears.
+func (l *estopLatch) changed() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.changes
+}
+
+func saveEStop(st EStopStatus) error {
+	raw, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(estopStatePath), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(estopStatePath, raw, configFileMode)
+}
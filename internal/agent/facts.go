@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"syscall"
+)
+
+// Facts describe what a robot is and has, reported in every heartbeat so
+// the controller can check scenario requirements against them.
+type Facts struct {
+	// Platform is "turtlebot4", "turtlebot3" or empty when unknown.
+	Platform  string   `json:"platform,omitempty"`
+	ROSDistro string   `json:"ros_distro,omitempty"`
+	Sensors   []string `json:"sensors,omitempty"`
+	// DiskFreeGB is the space left on /, rounded down.
+	DiskFreeGB int `json:"disk_free_gb"`
+}
+
+// Sensor names used in Facts.Sensors.
+const (
+	SensorLidar  = "lidar"
+	SensorCamera = "camera"
+)
+
+// platformPackages identify a platform by a ROS package only it installs.
+var platformPackages = []struct{ platform, pkg string }{
+	{"turtlebot4", "turtlebot4_bringup"},
+	{"turtlebot3", "turtlebot3_bringup"},
+}
+
+// platformSensors are the sensors a platform ships with, which may not show
+// up as device nodes (the TurtleBot 4 OAK-D camera, for one).
+var platformSensors = map[string][]string{
+	"turtlebot4": {SensorLidar, SensorCamera},
+	"turtlebot3": {SensorLidar},
+}
+
+// DetectFacts works out the slow-changing facts once at start, looking in
+// the ROS container when there is one. Config values override detection.
+func DetectFacts(ctx context.Context, cfg Config) Facts {
+	var f Facts
+	if distro, err := rosDistro(ctx, cfg); err == nil {
+		f.ROSDistro = distro
+		for _, p := range platformPackages {
+			dir := filepath.Join("/opt/ros", distro, "share", p.pkg)
+			if cfg.command(ctx, "test", "-d", dir).Run() == nil {
+				f.Platform = p.platform
+				break
+			}
+		}
+	}
+	if cfg.Platform != "" {
+		f.Platform = cfg.Platform
+	}
+	if len(cfg.Sensors) > 0 {
+		f.Sensors = cfg.Sensors
+		return f
+	}
+	found := map[string]bool{}
+	for _, s := range platformSensors[f.Platform] {
+		found[s] = true
+	}
+	for _, pattern := range []string{"/dev/RPLIDAR", "/dev/rplidar", "/dev/LDS*", "/dev/ttyUSB*"} {
+		if m, _ := filepath.Glob(pattern); len(m) > 0 {
+			found[SensorLidar] = true
+		}
+	}
+	if m, _ := filepath.Glob("/dev/video*"); len(m) > 0 {
+		found[SensorCamera] = true
+	}
+	for s := range found {
+		f.Sensors = append(f.Sensors, s)
+	}
+	sort.Strings(f.Sensors)
+	return f
+}
+
+// withDisk returns f with the current free space on /.
+func (f Facts) withDisk() Facts {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs("/", &st); err == nil {
+		f.DiskFreeGB = int(st.Bavail * uint64(st.Bsize) >> 30)
+	}
+	return f
+}
@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// formationMaxWait bounds how far ahead a start time may be, so a bad one
+// can't hold up the robot's other commands.
+const formationMaxWait = 2 * time.Minute
+
+// HandleFormationDrive waits for the formation's start time, drives forward
+// and reports when the command arrived and when the robot moved. A robot
+// that gets the command after the start time doesn't move, and says so.
+func HandleFormationDrive(cfg Config, data FormationDriveData, receivedAt time.Time) error {
+	if data.ResultURL == "" {
+		return errors.New("formation result url required")
+	}
+	if receivedAt.IsZero() {
+		receivedAt = time.Now()
+	}
+	result := FormationResult{ReceivedAt: receivedAt.UnixMilli()}
+	err := formationDrive(cfg, data, &result)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.SentAt = time.Now().UnixMilli()
+	body, _ := json.Marshal(result)
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, perr := client.Post(data.ResultURL, "application/json", bytes.NewReader(body))
+	if perr == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			perr = fmt.Errorf("status %s", resp.Status)
+		}
+	}
+	if perr != nil {
+		slog.Error("report formation result failed", "err", perr)
+		if err == nil {
+			err = fmt.Errorf("report formation result failed: %v", perr)
+		}
+	}
+	return err
+}
+
+func formationDrive(cfg Config, data FormationDriveData, result *FormationResult) error {
+	if data.DistanceM <= 0 || data.SpeedMPS <= 0 {
+		return errors.New("formation distance and speed must be positive")
+	}
+	wait := time.Until(time.UnixMilli(data.StartAt))
+	if wait < 0 {
+		return fmt.Errorf("start time had passed %s before the robot could start", (-wait).Round(time.Millisecond))
+	}
+	if wait > formationMaxWait {
+		return fmt.Errorf("start time is %s away, more than %s", wait.Round(time.Second), formationMaxWait)
+	}
+	slog.Info("formation drive scheduled", "in", wait.Round(time.Millisecond), "distance_m", data.DistanceM, "speed_mps", data.SpeedMPS)
+	time.Sleep(wait)
+
+	forward := fmt.Sprintf("{linear: {x: %.3f, y: 0.0, z: 0.0}, angular: {x: 0.0, y: 0.0, z: 0.0}}", data.SpeedMPS)
+	if out, err := cfg.rosCommand(context.Background(), "ros2", "topic", "pub", "--once", "/cmd_vel", "geometry_msgs/msg/Twist", forward).CombinedOutput(); err != nil {
+		return fmt.Errorf("forward failed: %v: %s", err, string(out))
+	}
+	result.MovingAt = time.Now().UnixMilli()
+
+	time.Sleep(time.Duration(data.DistanceM / data.SpeedMPS * float64(time.Second)))
+
+	if err := HandleStop(cfg); err != nil {
+		return err
+	}
+	result.FinishedAt = time.Now().UnixMilli()
+	slog.Info("formation drive complete", "late_ms", result.MovingAt-data.StartAt)
+	return nil
+}
@@ -0,0 +1,176 @@
+package agent
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ledRoot is where the kernel exposes board LEDs.
+const ledRoot = "/sys/class/leds"
+
+// Audio and display methods a hardware profile can use to identify a robot.
+const (
+	// AudioROS plays notes through the Create 3 /cmd_audio topic, falling back
+	// to AudioALSA.
+	AudioROS  = "ros"
+	AudioALSA = "alsa"
+	// DisplayLightring flashes the Create 3 light ring over ROS.
+	DisplayLightring = "lightring"
+	// DisplayConsole takes over a text console and opens the identify page in
+	// the desktop session, if there is one.
+	DisplayConsole = "console"
+	// None disables an LED, audio or display.
+	None = "none"
+)
+
+// HardwareProfile says how a board can show which robot it is. In the agent
+// config every field is optional and overrides the detected profile; Model
+// picks a built-in profile instead of detecting one. LEDs are names under
+// /sys/class/leds.
+type HardwareProfile struct {
+	Model    string `yaml:"model,omitempty"`
+	GreenLED string `yaml:"green_led,omitempty"`
+	RedLED   string `yaml:"red_led,omitempty"`
+	Audio    string `yaml:"audio,omitempty"`
+	Display  string `yaml:"display,omitempty"`
+}
+
+// builtinProfile lists LED names to try in order; kernels from 6.1 on name
+// the Raspberry Pi LEDs ACT and PWR instead of led0 and led1.
+type builtinProfile struct {
+	green, red []string
+}
+
+var builtinProfiles = map[string]builtinProfile{
+	"pi5":     {green: []string{"ACT"}, red: []string{"PWR"}},
+	"pi4":     {green: []string{"ACT", "led0"}, red: []string{"PWR", "led1"}},
+	"cm4":     {green: []string{"ACT", "led0"}, red: []string{"PWR", "led1"}},
+	"jetson":  {},
+	"generic": {green: []string{"led0"}, red: []string{"led1"}},
+}
+
+// Hardware is a resolved profile. LED fields are sysfs directories, empty
+// when the board has no such LED.
+type Hardware struct {
+	Model    string
+	GreenLED string
+	RedLED   string
+	Audio    string
+	Display  string
+}
+
+// DetectModel maps the device-tree model string to a built-in profile name.
+func DetectModel() string {
+	raw, err := os.ReadFile("/proc/device-tree/model")
+	if err != nil {
+		return "generic"
+	}
+	model := strings.TrimRight(string(raw), "\x00\n")
+	switch {
+	case strings.Contains(model, "Raspberry Pi 5"):
+		return "pi5"
+	case strings.Contains(model, "Compute Module 4"):
+		return "cm4"
+	case strings.Contains(model, "Raspberry Pi"):
+		return "pi4"
+	case strings.Contains(model, "Jetson"):
+		return "jetson"
+	}
+	return "generic"
+}
+
+// ResolveHardware combines the detected (or configured) built-in profile,
+// the defaults for the robot type and the overrides in cfg.Hardware.
+func ResolveHardware(cfg Config) Hardware {
+	o := cfg.Hardware
+	hw := Hardware{Model: o.Model}
+	if hw.Model == "" {
+		hw.Model = DetectModel()
+	}
+	builtin, ok := builtinProfiles[hw.Model]
+	if !ok {
+		slog.Warn("unknown hardware model, using generic profile", "model", hw.Model)
+		builtin = builtinProfiles["generic"]
+	}
+	hw.GreenLED = resolveLED(o.GreenLED, builtin.green)
+	hw.RedLED = resolveLED(o.RedLED, builtin.red)
+
+	hw.Audio, hw.Display = AudioROS, DisplayLightring
+	if cfg.Type == "laptop" {
+		hw.Audio, hw.Display = AudioALSA, DisplayConsole
+	}
+	if o.Audio != "" {
+		hw.Audio = o.Audio
+	}
+	if o.Display != "" {
+		hw.Display = o.Display
+	}
+	return hw
+}
+
+// resolveLED returns the sysfs directory of the configured LED, or of the
+// first candidate the board has.
+func resolveLED(configured string, candidates []string) string {
+	if configured == None {
+		return ""
+	}
+	if configured != "" {
+		candidates = []string{configured}
+	}
+	for _, name := range candidates {
+		dir := filepath.Join(ledRoot, name)
+		if _, err := os.Stat(filepath.Join(dir, "brightness")); err == nil {
+			return dir
+		}
+	}
+	return ""
+}
+
+// ledTrigger returns the active trigger of an LED, e.g. "mmc0" from
+// "none [mmc0] heartbeat".
+func ledTrigger(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "trigger"))
+	if err != nil {
+		return "none"
+	}
+	s := string(data)
+	start := strings.Index(s, "[")
+	end := strings.Index(s, "]")
+	if start != -1 && end > start {
+		return s[start+1 : end]
+	}
+	return "none"
+}
+
+func setLED(dir, file, value string) {
+	if dir != "" {
+		_ = os.WriteFile(filepath.Join(dir, file), []byte(value), 0644)
+	}
+}
+
+// statusIndicator blinks the red LED, using the kernel's heartbeat trigger,
+// while the agent can't reach the broker, and restores it once connected.
+type statusIndicator struct {
+	led      string
+	saved    string
+	signaled bool
+}
+
+func (s *statusIndicator) connected(ok bool) {
+	if s.led == "" || ok != s.signaled {
+		return
+	}
+	if !ok {
+		s.saved = ledTrigger(s.led)
+		setLED(s.led, "trigger", "heartbeat")
+		s.signaled = true
+		return
+	}
+	setLED(s.led, "trigger", s.saved)
+	if s.saved == "input" || s.saved == "none" {
+		setLED(s.led, "brightness", "1")
+	}
+	s.signaled = false
+}
@@ -1,6 +1,8 @@
 package agent
 
 import (
+	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 )
@@ -12,22 +14,43 @@ const (
 	JobStatusRunning JobStatus = "running"
 	JobStatusSuccess JobStatus = "success"
 	JobStatusFailed  JobStatus = "failed"
+	// JobStatusDeferred is a run_at_boot command saved for the next boot.
+	JobStatusDeferred JobStatus = "deferred"
+	// JobStatusSkipped is a batch step not run because an earlier one failed.
+	JobStatusSkipped JobStatus = "skipped"
 )
 
 type Job struct {
-	ID        string
-	Type      string
-	Data      []byte
-	Status    JobStatus
-	Error     string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID            string
+	Type          string
+	CorrelationID string
+	Data          []byte
+	Status        JobStatus
+	Error         string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	// Steps is the progress of a batch, one entry per command.
+	Steps []StepResult
+	// Progress is a one-line summary of how far the running command (or
+	// batch step) has got, for commands that report it, such as a build.
+	Progress string
+}
+
+// StepResult is the progress of one command in a batch.
+type StepResult struct {
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	Status   JobStatus `json:"status"`
+	Attempts int       `json:"attempts,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Seconds  float64   `json:"seconds,omitempty"`
 }
 
 type JobManager struct {
 	mu   sync.RWMutex
 	jobs map[string]*Job
-	// currentJob is a pointer to the currently running job, if any
+	// currentJob is the running job or, once it finishes, the most recent one
+	// so heartbeats can report its final status and correlation ID.
 	currentJob *Job
 }
 
@@ -37,43 +60,145 @@ func NewJobManager() *JobManager {
 	}
 }
 
-func (jm *JobManager) StartJob(id, jobType string, data []byte, action func() error) {
+func (jm *JobManager) StartJob(id, jobType, correlationID string, data []byte, action func() error) {
 	jm.mu.Lock()
 	defer jm.mu.Unlock()
 
 	if jm.currentJob != nil && jm.currentJob.Status == JobStatusRunning {
 		// For now, reject if busy.
+		slog.Warn("job rejected: another job is running", "type", jobType, "correlation_id", correlationID, "running", jm.currentJob.Type)
 		return
 	}
 
 	job := &Job{
-		ID:        id,
-		Type:      jobType,
-		Data:      data,
-		Status:    JobStatusRunning,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		ID:            id,
+		Type:          jobType,
+		CorrelationID: correlationID,
+		Data:          data,
+		Status:        JobStatusRunning,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
 	}
 	jm.jobs[id] = job
 	jm.currentJob = job
+	go jm.run(job, action)
+}
+
+// RunCritical runs a critical job (such as stop) immediately, even while
+// another job is running. It doesn't replace the current job, so heartbeats
+// keep reporting the long-running job's progress and outcome.
+func (jm *JobManager) RunCritical(id, jobType, correlationID string, data []byte, action func() error) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	job := &Job{
+		ID:            id,
+		Type:          jobType,
+		CorrelationID: correlationID,
+		Data:          data,
+		Status:        JobStatusRunning,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	jm.jobs[id] = job
+	if jm.currentJob == nil || jm.currentJob.Status != JobStatusRunning {
+		jm.currentJob = job
+	}
+	go jm.run(job, action)
+}
+
+func (jm *JobManager) run(job *Job, action func() error) {
+	err := action()
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	job.UpdatedAt = time.Now()
+	logger := slog.With("job_id", job.ID, "type", job.Type, "correlation_id", job.CorrelationID)
+	if err != nil {
+		job.Status = JobStatusFailed
+		job.Error = err.Error()
+		logger.Error("job failed", "err", err)
+	} else {
+		job.Status = JobStatusSuccess
+		logger.Info("job succeeded", "duration", job.UpdatedAt.Sub(job.CreatedAt))
+	}
+}
+
+// Defer records a command saved to run at the next boot, or the error
+// saving it, so the next heartbeat reports it unless a job is running.
+func (jm *JobManager) Defer(id, jobType, correlationID string, err error) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	job := &Job{
+		ID:            id,
+		Type:          jobType,
+		CorrelationID: correlationID,
+		Status:        JobStatusDeferred,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	if err != nil {
+		job.Status = JobStatusFailed
+		job.Error = fmt.Sprintf("defer to boot: %v", err)
+		slog.Error("cannot defer command to boot", "job_id", id, "type", jobType, "err", err)
+	}
+	jm.jobs[id] = job
+	if jm.currentJob == nil || jm.currentJob.Status != JobStatusRunning {
+		jm.currentJob = job
+	}
+}
+
+// Record reports a command handled outside the job manager, such as an
+// e-stop, so the next heartbeat acknowledges it unless a job is running.
+func (jm *JobManager) Record(id, jobType, correlationID string, err error) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	job := &Job{
+		ID:            id,
+		Type:          jobType,
+		CorrelationID: correlationID,
+		Status:        JobStatusSuccess,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	if err != nil {
+		job.Status = JobStatusFailed
+		job.Error = err.Error()
+	}
+	jm.jobs[id] = job
+	if jm.currentJob == nil || jm.currentJob.Status != JobStatusRunning {
+		jm.currentJob = job
+	}
+}
 
-	go func() {
-		err := action()
-		jm.mu.Lock()
-		defer jm.mu.Unlock()
+// SetSteps records the progress of the batch job id. Unknown jobs, such as
+// commands run at boot, are ignored. The progress line belonged to the
+// previous step, so it is cleared.
+func (jm *JobManager) SetSteps(id string, steps []StepResult) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	if job := jm.jobs[id]; job != nil {
+		job.Steps = append([]StepResult(nil), steps...)
+		job.Progress = ""
+		job.UpdatedAt = time.Now()
+	}
+}
 
+// SetProgress records how far the running job has got. It is a no-op when no
+// job is running, such as for commands run at boot.
+func (jm *JobManager) SetProgress(progress string) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	if job := jm.currentJob; job != nil && job.Status == JobStatusRunning {
+		job.Progress = progress
 		job.UpdatedAt = time.Now()
-		if err != nil {
-			job.Status = JobStatusFailed
-			job.Error = err.Error()
-		} else {
-			job.Status = JobStatusSuccess
-		}
-
-		if jm.currentJob == job {
-			jm.currentJob = nil
-		}
-	}()
+	}
+}
+
+// Busy reports whether a non-critical job is running.
+func (jm *JobManager) Busy() bool {
+	jm.mu.RLock()
+	defer jm.mu.RUnlock()
+	return jm.currentJob != nil && jm.currentJob.Status == JobStatusRunning
 }
 
 func (jm *JobManager) GetJob(id string) *Job {
@@ -82,8 +207,15 @@ func (jm *JobManager) GetJob(id string) *Job {
 	return jm.jobs[id]
 }
 
+// GetCurrentJob returns a copy of the current job, which the job's own
+// goroutine may still be updating.
 func (jm *JobManager) GetCurrentJob() *Job {
 	jm.mu.RLock()
 	defer jm.mu.RUnlock()
-	return jm.currentJob
+	if jm.currentJob == nil {
+		return nil
+	}
+	job := *jm.currentJob
+	job.Steps = append([]StepResult(nil), job.Steps...)
+	return &job
 }
@@ -0,0 +1,280 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Launches started by ros_launch_start run under the agent rather than
+// systemd. Each runs in its own process group, so stopping it signals
+// ros2 launch and every node it spawned, on the host or in the ROS container.
+
+const (
+	// launchSettle is how long a start waits for the launch to fail, so a
+	// typo in the package or file fails the command instead of the heartbeat.
+	launchSettle = 3 * time.Second
+	// launchStopTimeout is how long ros2 launch gets to shut its nodes down
+	// after SIGINT before the group is killed.
+	launchStopTimeout = 15 * time.Second
+	// launchPGIDPrefix marks the line the launch's shell prints its process
+	// group on.
+	launchPGIDPrefix = "openrobot-launch-pgid "
+	// launchErrorLimit keeps the end of a failed launch's output short
+	// enough to send in every heartbeat.
+	launchErrorLimit = 500
+)
+
+var errNoLaunch = errors.New("no such launch")
+
+// LaunchStatus is a launch the agent started and hasn't been told to stop.
+// PID is its process group, in the ROS container's PID namespace when there
+// is one.
+type LaunchStatus struct {
+	Name      string    `json:"name"`
+	Package   string    `json:"package"`
+	File      string    `json:"file"`
+	PID       int       `json:"pid,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	Running   bool      `json:"running"`
+	// ExitedAt is set once a launch exits on its own, and Error if it failed.
+	ExitedAt *time.Time `json:"exited_at,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+type launchProc struct {
+	status LaunchStatus
+	// stopping is set once a stop was asked for, so the exit isn't reported
+	// as a failure.
+	stopping bool
+	done     chan struct{}
+}
+
+// launchManager tracks the launches started by ros_launch_start by name.
+type launchManager struct {
+	mu       sync.Mutex
+	launches map[string]*launchProc
+}
+
+// start runs data's launch in the background, restarting it if one of the
+// same name is already running. It fails if the launch exits straight away.
+func (m *launchManager) start(cfg Config, data ROSLaunchStartData) error {
+	root := workspaceRoot(cfg)
+	if root == "" {
+		return errors.New("workspace_path is not configured")
+	}
+	launch, err := launchCommand(ROSLaunchData{Package: data.Package, File: data.File, Args: data.Args})
+	if err != nil {
+		return err
+	}
+	name := data.Name
+	if name == "" {
+		name = data.Package + "/" + data.File
+	}
+	if !launchTarget.MatchString(name) {
+		return fmt.Errorf("invalid launch name %q", name)
+	}
+	if err := m.stop(cfg, name); err != nil && !errors.Is(err, errNoLaunch) {
+		return err
+	}
+
+	// setsid makes the shell the leader of a new process group, which the
+	// launch and its nodes inherit, and -w keeps docker exec attached to it.
+	script := "echo " + launchPGIDPrefix + "$$\n" + scenarioScript(root, "exec "+launch)
+	cmd := cfg.command(context.Background(), "setsid", "-w", "bash", "-c", script)
+	p := &launchProc{
+		status: LaunchStatus{
+			Name:      name,
+			Package:   data.Package,
+			File:      data.File,
+			StartedAt: time.Now().UTC(),
+			Running:   true,
+		},
+		done: make(chan struct{}),
+	}
+	m.mu.Lock()
+	if m.launches == nil {
+		m.launches = make(map[string]*launchProc)
+	}
+	m.launches[name] = p
+	m.mu.Unlock()
+
+	pgid := make(chan int, 1)
+	go func() {
+		output, err := streamCommand(cmd, func(line string) {
+			if v, ok := strings.CutPrefix(line, launchPGIDPrefix); ok {
+				if n, err := strconv.Atoi(v); err == nil && n > 0 {
+					select {
+					case pgid <- n:
+					default:
+					}
+				}
+			}
+		})
+		m.exited(p, output, err)
+	}()
+
+	settle := time.NewTimer(launchSettle)
+	defer settle.Stop()
+	for {
+		select {
+		case n := <-pgid:
+			m.mu.Lock()
+			p.status.PID = n
+			m.mu.Unlock()
+			pgid = nil
+		case <-p.done:
+			// The command's failure reports it, so it isn't listed too.
+			m.forget(name, p)
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if p.status.Error == "" {
+				return fmt.Errorf("launch %s exited straight away", name)
+			}
+			return fmt.Errorf("launch %s exited: %s", name, p.status.Error)
+		case <-settle.C:
+			m.mu.Lock()
+			started := p.status.PID
+			m.mu.Unlock()
+			if started == 0 {
+				// Without its group it could never be stopped.
+				m.forget(name, p)
+				if cmd.Process != nil {
+					cmd.Process.Kill()
+				}
+				return fmt.Errorf("launch %s did not report its process group", name)
+			}
+			slog.Info("started launch", "name", name, "package", data.Package, "file", data.File, "pgid", started, "container", cfg.ROSContainer)
+			return nil
+		}
+	}
+}
+
+// exited records how p ended. A launch that fails after starting stays
+// listed, with its error, until it is stopped or started again.
+func (m *launchManager) exited(p *launchProc, output []byte, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p.status.Running = false
+	now := time.Now().UTC()
+	p.status.ExitedAt = &now
+	if err != nil && !p.stopping {
+		if _, rest, ok := bytes.Cut(output, []byte("\n")); ok && bytes.HasPrefix(output, []byte(launchPGIDPrefix)) {
+			output = rest
+		}
+		out := tail(output)
+		if len(out) > launchErrorLimit {
+			out = "..." + out[len(out)-launchErrorLimit:]
+		}
+		p.status.Error = fmt.Sprintf("%v: %s", err, out)
+		slog.Warn("launch exited", "name", p.status.Name, "err", err)
+	}
+	close(p.done)
+}
+
+// stop interrupts the launch name, as Ctrl-C would, and kills its process
+// group if it is still running after launchStopTimeout.
+func (m *launchManager) stop(cfg Config, name string) error {
+	m.mu.Lock()
+	p := m.launches[name]
+	if p == nil {
+		m.mu.Unlock()
+		return fmt.Errorf("%w: %s", errNoLaunch, name)
+	}
+	p.stopping = true
+	pgid, running := p.status.PID, p.status.Running
+	m.mu.Unlock()
+
+	if running && pgid > 0 {
+		if err := signalLaunch(cfg, pgid, "INT"); err != nil && !closed(p.done) {
+			return fmt.Errorf("stop launch %s: %w", name, err)
+		}
+		select {
+		case <-p.done:
+		case <-time.After(launchStopTimeout):
+			slog.Warn("launch did not stop on SIGINT, killing it", "name", name, "pgid", pgid)
+			if err := signalLaunch(cfg, pgid, "KILL"); err != nil && !closed(p.done) {
+				return fmt.Errorf("kill launch %s: %w", name, err)
+			}
+			select {
+			case <-p.done:
+			case <-time.After(5 * time.Second):
+				return fmt.Errorf("launch %s did not exit", name)
+			}
+		}
+		slog.Info("stopped launch", "name", name)
+	}
+	m.forget(name, p)
+	return nil
+}
+
+// forget drops p unless another launch has taken its name since.
+func (m *launchManager) forget(name string, p *launchProc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.launches[name] == p {
+		delete(m.launches, name)
+	}
+}
+
+// stopAll stops every launch, for when the agent shuts down; a launch in the
+// ROS container would otherwise outlive it untracked.
+func (m *launchManager) stopAll(cfg Config) {
+	m.mu.Lock()
+	names := make([]string, 0, len(m.launches))
+	for name := range m.launches {
+		names = append(names, name)
+	}
+	m.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.stop(cfg, name); err != nil {
+				slog.Warn("cannot stop launch", "name", name, "err", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// current lists the launches by name. It is never nil, so a heartbeat tells
+// the controller when the last one was stopped.
+func (m *launchManager) current() []LaunchStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]LaunchStatus, 0, len(m.launches))
+	for _, p := range m.launches {
+		out = append(out, p.status)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// signalLaunch sends sig to the process group pgid, where the launch runs.
+func signalLaunch(cfg Config, pgid int, sig string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// The shell's kill builtin, as the container may not have procps.
+	if output, err := cfg.command(ctx, "bash", "-c", "kill -"+sig+" -- -"+strconv.Itoa(pgid)).CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, tail(output))
+	}
+	return nil
+}
+
+func closed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
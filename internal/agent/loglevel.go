@@ -0,0 +1,235 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	logLevelStatePath = "/var/lib/openrobotfleet-agent/log_levels.json"
+	// defaultLogLevelDuration is how long a level lasts when the command
+	// doesn't say.
+	defaultLogLevelDuration = 15 * time.Minute
+	maxLogLevelDuration     = 4 * time.Hour
+	// logServiceTimeout bounds each ros2 service call, which otherwise waits
+	// forever for a node that doesn't offer the logger services.
+	logServiceTimeout = 15 * time.Second
+)
+
+// logLevels are the severities rcutils uses; unset (0) means the logger
+// follows its parent.
+var logLevels = map[string]int{
+	"debug": 10,
+	"info":  20,
+	"warn":  30,
+	"error": 40,
+	"fatal": 50,
+}
+
+// rosNodeName is a fully qualified node name, e.g. /robot1/amcl.
+var rosNodeName = regexp.MustCompile(`^(/[A-Za-z_][A-Za-z0-9_]*)+$`)
+
+var (
+	loggerLevelResult = regexp.MustCompile(`level=(\d+)`)
+	loggerSetResult   = regexp.MustCompile(`successful=(True|False), reason='([^']*)'`)
+)
+
+// LogLevelOverride is a node's logger set by set_log_level, and the level
+// it goes back to at RevertAt.
+type LogLevelOverride struct {
+	Node     string    `json:"node"`
+	Level    string    `json:"level"`
+	Previous int       `json:"previous"`
+	RevertAt time.Time `json:"revert_at"`
+}
+
+// logLevelManager reverts the levels set by set_log_level when they run
+// out, across agent restarts.
+type logLevelManager struct {
+	mu        sync.Mutex
+	overrides map[string]LogLevelOverride
+	timers    map[string]*time.Timer
+}
+
+// set sets the logger level of each node through its set_logger_levels
+// service and schedules it to go back to the level it had before. Setting a
+// node again extends the override but still reverts to the level from
+// before the first one.
+func (m *logLevelManager) set(cfg Config, data SetLogLevelData) error {
+	level, ok := logLevels[strings.ToLower(data.Level)]
+	if !ok {
+		return fmt.Errorf("unknown log level %q; use debug, info, warn, error or fatal", data.Level)
+	}
+	if len(data.Nodes) == 0 {
+		return errors.New("nodes required")
+	}
+	for _, node := range data.Nodes {
+		if !rosNodeName.MatchString(node) {
+			return fmt.Errorf("invalid node name %q; use the full name, e.g. /amcl", node)
+		}
+	}
+	duration := defaultLogLevelDuration
+	if data.DurationSec > 0 {
+		duration = time.Duration(data.DurationSec) * time.Second
+	}
+	if duration > maxLogLevelDuration {
+		return fmt.Errorf("duration_sec is over the limit of %d", int(maxLogLevelDuration.Seconds()))
+	}
+	revertAt := time.Now().Add(duration).UTC()
+
+	var failed []string
+	for _, node := range data.Nodes {
+		m.mu.Lock()
+		prev, overridden := m.overrides[node]
+		m.mu.Unlock()
+		previous := prev.Previous
+		if !overridden {
+			var err error
+			if previous, err = getLoggerLevel(cfg, node); err != nil {
+				failed = append(failed, err.Error())
+				continue
+			}
+		}
+		if err := setLoggerLevel(cfg, node, level); err != nil {
+			failed = append(failed, err.Error())
+			continue
+		}
+		slog.Info("log level set", "node", node, "level", data.Level, "revert_at", revertAt)
+		m.schedule(cfg, LogLevelOverride{Node: node, Level: strings.ToLower(data.Level), Previous: previous, RevertAt: revertAt})
+	}
+	m.save()
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// schedule records o and reverts it at o.RevertAt.
+func (m *logLevelManager) schedule(cfg Config, o LogLevelOverride) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.overrides == nil {
+		m.overrides = make(map[string]LogLevelOverride)
+		m.timers = make(map[string]*time.Timer)
+	}
+	if t := m.timers[o.Node]; t != nil {
+		t.Stop()
+	}
+	m.overrides[o.Node] = o
+	m.timers[o.Node] = time.AfterFunc(time.Until(o.RevertAt), func() { m.revert(cfg, o.Node) })
+}
+
+// revert puts a node's logger back to the level it had before its override.
+func (m *logLevelManager) revert(cfg Config, node string) {
+	m.mu.Lock()
+	o, ok := m.overrides[node]
+	delete(m.overrides, node)
+	delete(m.timers, node)
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+	// A node restarted since has its default level already, or isn't
+	// running; either way there is nothing left to undo.
+	if err := setLoggerLevel(cfg, node, o.Previous); err != nil {
+		slog.Warn("cannot revert log level", "node", node, "err", err)
+	} else {
+		slog.Info("log level reverted", "node", node, "level", o.Previous)
+	}
+	m.save()
+}
+
+// restore schedules the reverts saved before the agent restarted; those
+// already due run straight away.
+func (m *logLevelManager) restore(cfg Config) {
+	raw, err := os.ReadFile(logLevelStatePath)
+	if err != nil {
+		return
+	}
+	var saved []LogLevelOverride
+	if err := json.Unmarshal(raw, &saved); err != nil {
+		slog.Warn("invalid saved log levels", "err", err)
+		return
+	}
+	for _, o := range saved {
+		m.schedule(cfg, o)
+	}
+}
+
+func (m *logLevelManager) save() {
+	m.mu.Lock()
+	saved := make([]LogLevelOverride, 0, len(m.overrides))
+	for _, o := range m.overrides {
+		saved = append(saved, o)
+	}
+	m.mu.Unlock()
+	if len(saved) == 0 {
+		if err := os.Remove(logLevelStatePath); err != nil && !os.IsNotExist(err) {
+			slog.Warn("cannot remove saved log levels", "err", err)
+		}
+		return
+	}
+	raw, err := json.Marshal(saved)
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(logLevelStatePath), 0o700); err == nil {
+			err = os.WriteFile(logLevelStatePath, raw, configFileMode)
+		}
+	}
+	if err != nil {
+		slog.Warn("cannot save log levels; they won't be reverted after an agent restart", "err", err)
+	}
+}
+
+// loggerName is the logger a node logs to: its name with the namespace
+// joined by dots, e.g. robot1.amcl for /robot1/amcl.
+func loggerName(node string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(node, "/"), "/", ".")
+}
+
+func getLoggerLevel(cfg Config, node string) (int, error) {
+	out, err := callLoggerService(cfg, node, "get_logger_levels", "rcl_interfaces/srv/GetLoggerLevels", fmt.Sprintf("{names: [%s]}", loggerName(node)))
+	if err != nil {
+		return 0, err
+	}
+	m := loggerLevelResult.FindStringSubmatch(out)
+	if m == nil {
+		return 0, fmt.Errorf("%s: unexpected get_logger_levels response: %s", node, tail([]byte(out)))
+	}
+	return strconv.Atoi(m[1])
+}
+
+func setLoggerLevel(cfg Config, node string, level int) error {
+	out, err := callLoggerService(cfg, node, "set_logger_levels", "rcl_interfaces/srv/SetLoggerLevels", fmt.Sprintf("{levels: [{name: %s, level: %d}]}", loggerName(node), level))
+	if err != nil {
+		return err
+	}
+	if m := loggerSetResult.FindStringSubmatch(out); m != nil && m[1] == "False" {
+		return fmt.Errorf("%s: %s", node, m[2])
+	}
+	return nil
+}
+
+// callLoggerService calls one of a node's logger services. Nodes only offer
+// them from ROS 2 Iron on, and only when started with enable_logger_service.
+func callLoggerService(cfg Config, node, service, srvType, request string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), logServiceTimeout)
+	defer cancel()
+	out, err := cfg.rosCommand(ctx, "ros2", "service", "call", node+"/"+service, srvType, request).CombinedOutput()
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("%s has no %s service; is it running, with enable_logger_service set?", node, service)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: ros2 service call failed: %v: %s", node, err, tail(out))
+	}
+	return string(out), nil
+}
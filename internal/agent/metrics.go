@@ -0,0 +1,194 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Metric names sent in the heartbeat and stored by the controller as
+// telemetry.
+const (
+	MetricBattery = "battery"  // percent
+	MetricCPULoad = "cpu_load" // 1-minute load average
+	MetricMemory  = "memory"   // percent used
+	MetricDisk    = "disk"     // percent of / used
+	MetricCPUTemp = "cpu_temp" // degrees Celsius
+)
+
+const (
+	batteryTopic          = "/battery_state"
+	batterySampleInterval = time.Minute
+)
+
+// collectMetrics reads host metrics that are cheap enough to sample on every
+// heartbeat. Metrics that can't be read are left out.
+func collectMetrics() map[string]float64 {
+	m := make(map[string]float64)
+	if v, ok := readLoadAvg(); ok {
+		m[MetricCPULoad] = v
+	}
+	if v, ok := readMemoryUsed(); ok {
+		m[MetricMemory] = v
+	}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs("/", &st); err == nil && st.Blocks > 0 {
+		m[MetricDisk] = round1(100 * float64(st.Blocks-st.Bavail) / float64(st.Blocks))
+	}
+	if raw, err := os.ReadFile("/sys/class/thermal/thermal_zone0/temp"); err == nil {
+		if milli, err := strconv.ParseFloat(strings.TrimSpace(string(raw)), 64); err == nil {
+			m[MetricCPUTemp] = round1(milli / 1000)
+		}
+	}
+	// Laptops report their battery through sysfs.
+	if paths, _ := filepath.Glob("/sys/class/power_supply/BAT*/capacity"); len(paths) > 0 {
+		if raw, err := os.ReadFile(paths[0]); err == nil {
+			if v, err := strconv.ParseFloat(strings.TrimSpace(string(raw)), 64); err == nil {
+				m[MetricBattery] = v
+			}
+		}
+	}
+	return m
+}
+
+func readLoadAvg() (float64, bool) {
+	raw, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, false
+	}
+	fields := strings.Fields(string(raw))
+	if len(fields) == 0 {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	return v, err == nil
+}
+
+func readMemoryUsed() (float64, bool) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	var total, available float64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		v, _ := strconv.ParseFloat(fields[1], 64)
+		switch fields[0] {
+		case "MemTotal:":
+			total = v
+		case "MemAvailable:":
+			available = v
+		}
+	}
+	if total == 0 {
+		return 0, false
+	}
+	return round1(100 * (total - available) / total), true
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// batterySampler keeps the last battery percentage, and on a TurtleBot 4
+// the dock state, read from ROS. Reading a topic means starting the ros2
+// CLI, so it runs once a minute in the background instead of on every
+// heartbeat.
+type batterySampler struct {
+	mu     sync.Mutex
+	value  float64
+	at     time.Time
+	dock   DockStatus
+	dockAt time.Time
+}
+
+func (b *batterySampler) run(ctx context.Context, cfg Config, hasDock bool) {
+	if _, err := exec.LookPath("ros2"); err != nil && cfg.ROSContainer == "" {
+		return
+	}
+	ticker := time.NewTicker(batterySampleInterval)
+	defer ticker.Stop()
+	for {
+		if v, ok := readROSBattery(ctx, cfg); ok {
+			b.mu.Lock()
+			b.value, b.at = v, time.Now()
+			b.mu.Unlock()
+		}
+		if hasDock {
+			if st, err := readDockStatus(ctx, cfg); err == nil {
+				b.setDock(st)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// latest returns the last reading if it is recent enough to still be true.
+func (b *batterySampler) latest() (float64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.at.IsZero() || time.Since(b.at) > 3*batterySampleInterval {
+		return 0, false
+	}
+	return b.value, true
+}
+
+// setDock records the dock state, read from ROS or known from a dock or
+// undock that just finished.
+func (b *batterySampler) setDock(st DockStatus) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dock, b.dockAt = st, time.Now()
+}
+
+// latestDock returns the dock state, or nil if it isn't known.
+func (b *batterySampler) latestDock() *DockStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.dockAt.IsZero() || time.Since(b.dockAt) > 3*batterySampleInterval {
+		return nil
+	}
+	st := b.dock
+	return &st
+}
+
+func readROSBattery(ctx context.Context, cfg Config) (float64, bool) {
+	ctx, cancel := context.WithTimeout(ctx, sensorReadTimeout)
+	defer cancel()
+	out, err := echoOnce(ctx, cfg, batteryTopic)
+	if err != nil {
+		return 0, false
+	}
+	var msg struct {
+		Percentage float64 `yaml:"percentage"`
+	}
+	if err := yaml.NewDecoder(bytes.NewReader(out)).Decode(&msg); err != nil || math.IsNaN(msg.Percentage) {
+		return 0, false
+	}
+	// BatteryState says 0-1, but some drivers publish 0-100.
+	pct := msg.Percentage
+	if pct <= 1 {
+		pct *= 100
+	}
+	return round1(math.Max(0, math.Min(100, pct))), true
+}
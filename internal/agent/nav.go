@@ -0,0 +1,275 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultNavAction  = "/navigate_to_pose"
+	defaultNavFrame   = "map"
+	defaultNavTimeout = 5 * time.Minute
+	maxNavTimeout     = 30 * time.Minute
+	// actionCancelWait is how long ros2 action send_goal gets to cancel the
+	// goal after SIGINT, before it is killed.
+	actionCancelWait = 10 * time.Second
+	actionPGIDPrefix = "openrobot-action-pgid "
+	// maxWait bounds a wait command, such as a pause at a waypoint.
+	maxWait = 10 * time.Minute
+)
+
+// rosName is what a ROS action or frame name may contain.
+var rosName = regexp.MustCompile(`^/[A-Za-z_][A-Za-z0-9_/]*$`)
+
+// actionStatusPrefix starts the line ros2 action send_goal ends with, e.g.
+// "Goal finished with status: SUCCEEDED".
+const actionStatusPrefix = "Goal finished with status: "
+
+// HandleNavGoal sends a NavigateToPose goal to Nav2 with ros2 action
+// send_goal and waits for the result, reporting the distance remaining
+// through progress. The goal is cancelled when ctx ends, as on an e-stop, or
+// when it runs past its timeout.
+func HandleNavGoal(ctx context.Context, cfg Config, data NavGoalData, progress func(string)) error {
+	goal, err := navGoalYAML(data)
+	if err != nil {
+		return err
+	}
+	action := data.Action
+	if action == "" {
+		action = defaultNavAction
+	}
+	if !rosName.MatchString(action) {
+		return fmt.Errorf("invalid action name %q", action)
+	}
+	timeout := defaultNavTimeout
+	if data.TimeoutSec > 0 {
+		timeout = time.Duration(data.TimeoutSec) * time.Second
+	}
+	if timeout > maxNavTimeout {
+		return fmt.Errorf("timeout_sec is over the limit of %d", int(maxNavTimeout.Seconds()))
+	}
+	slog.Info("nav: sending goal", "action", action, "x", data.X, "y", data.Y, "yaw", data.Yaw, "frame", data.frame(), "container", cfg.ROSContainer)
+
+	var p navProgress
+	progress("goal sent")
+	outcome, err := sendActionGoal(ctx, cfg, action, "nav2_msgs/action/NavigateToPose", goal, timeout, func(line string) {
+		if p.update(line) {
+			progress(p.String())
+		}
+	})
+	switch {
+	case err != nil:
+		return err
+	case outcome.status == "SUCCEEDED":
+		progress("goal reached")
+		slog.Info("nav: goal reached", "x", data.X, "y", data.Y)
+		return nil
+	case outcome.rejected:
+		return errors.New("Nav2 rejected the goal; is navigation running and localized?")
+	default:
+		return fmt.Errorf("navigation ended with status %s", outcome.status)
+	}
+}
+
+// actionOutcome is how a goal sent with ros2 action send_goal ended.
+type actionOutcome struct {
+	// status is the goal's final status, e.g. SUCCEEDED or ABORTED.
+	status   string
+	rejected bool
+}
+
+// sendActionGoal sends goal to an action server with ros2 action send_goal
+// --feedback and waits for the result, passing each line of output to
+// onLine. The goal is cancelled when ctx ends, as on an e-stop, or when it
+// runs past timeout; either is returned as an error, as is send_goal
+// exiting without a result.
+func sendActionGoal(ctx context.Context, cfg Config, action, actionType, goal string, timeout time.Duration, onLine func(string)) (actionOutcome, error) {
+	// As with launches, setsid puts send_goal in its own process group so it
+	// can be interrupted inside a container too; on SIGINT it cancels the
+	// goal before exiting.
+	script := "echo " + actionPGIDPrefix + "$$\n" + rosSetup + "\nexec ros2 action send_goal --feedback " + shellQuote(action) + " " + actionType + " " + shellQuote(goal)
+	cmd := cfg.command(context.Background(), "setsid", "-w", "bash", "-c", script)
+
+	pgid := make(chan int, 1)
+	var outcome actionOutcome
+	var output []byte
+	var runErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		output, runErr = streamCommand(cmd, func(line string) {
+			if v, ok := strings.CutPrefix(line, actionPGIDPrefix); ok {
+				if n, err := strconv.Atoi(v); err == nil && n > 0 {
+					select {
+					case pgid <- n:
+					default:
+					}
+				}
+				return
+			}
+			switch trimmed := strings.TrimSpace(line); {
+			case trimmed == "Goal was rejected.":
+				outcome.rejected = true
+			case strings.HasPrefix(trimmed, actionStatusPrefix):
+				outcome.status = strings.TrimSpace(strings.TrimPrefix(trimmed, actionStatusPrefix))
+			}
+			onLine(line)
+		})
+	}()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	group := 0
+	var cancelled error
+wait:
+	for {
+		select {
+		case group = <-pgid:
+			pgid = nil
+		case <-done:
+			break wait
+		case <-ctx.Done():
+			cancelled = errEStopped
+			break wait
+		case <-deadline.C:
+			cancelled = fmt.Errorf("%s timed out after %s", action, timeout)
+			break wait
+		}
+	}
+	if cancelled != nil {
+		slog.Warn("cancelling action goal", "action", action, "reason", cancelled)
+		if group > 0 {
+			if err := signalLaunch(cfg, group, "INT"); err != nil {
+				slog.Warn("cannot interrupt send_goal", "action", action, "err", err)
+			}
+		}
+		select {
+		case <-done:
+		case <-time.After(actionCancelWait):
+			if cmd.Process != nil {
+				cmd.Process.Kill()
+			}
+			<-done
+		}
+		return outcome, cancelled
+	}
+
+	switch {
+	case outcome.status != "" || outcome.rejected:
+		return outcome, nil
+	case runErr != nil:
+		return outcome, fmt.Errorf("ros2 action send_goal failed: %w: %s", runErr, tail(output))
+	default:
+		return outcome, fmt.Errorf("ros2 action send_goal exited without a result: %s", tail(output))
+	}
+}
+
+// HandleWait pauses for data.Seconds, counting down through progress. It
+// returns early with an error when ctx ends, as on an e-stop, so a mission
+// doesn't go on to its next goal.
+func HandleWait(ctx context.Context, data WaitData, progress func(string)) error {
+	d := time.Duration(data.Seconds) * time.Second
+	if d <= 0 || d > maxWait {
+		return fmt.Errorf("seconds must be between 1 and %d", int(maxWait.Seconds()))
+	}
+	end := time.Now().Add(d)
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	for {
+		left := time.Until(end).Round(time.Second)
+		if left <= 0 {
+			return nil
+		}
+		progress(fmt.Sprintf("waiting, %s left", left))
+		select {
+		case <-ctx.Done():
+			return errEStopped
+		case <-tick.C:
+		}
+	}
+}
+
+// navGoalYAML is the NavigateToPose goal for data, with the yaw turned
+// into a quaternion about z.
+func navGoalYAML(data NavGoalData) (string, error) {
+	for name, v := range map[string]float64{"x": data.X, "y": data.Y, "yaw": data.Yaw} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", fmt.Errorf("%s must be a finite number", name)
+		}
+	}
+	if !rosName.MatchString("/" + data.frame()) {
+		return "", fmt.Errorf("invalid frame %q", data.Frame)
+	}
+	return fmt.Sprintf("{pose: {header: {frame_id: %s}, pose: {position: {x: %s, y: %s, z: 0.0}, orientation: {x: 0.0, y: 0.0, z: %s, w: %s}}}}",
+		data.frame(), yamlFloat(data.X), yamlFloat(data.Y), yamlFloat(math.Sin(data.Yaw/2)), yamlFloat(math.Cos(data.Yaw/2))), nil
+}
+
+// yamlFloat formats v so YAML reads it as a float even when it is whole;
+// the ros2 CLI won't put an integer in a float64 field.
+func yamlFloat(v float64) string {
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+func (d NavGoalData) frame() string {
+	if d.Frame == "" {
+		return defaultNavFrame
+	}
+	return strings.TrimPrefix(d.Frame, "/")
+}
+
+// navProgress follows the feedback ros2 action send_goal prints.
+type navProgress struct {
+	distance   float64
+	haveDist   bool
+	recoveries int
+}
+
+// update applies one line of output, reporting whether the progress shown
+// changed.
+func (p *navProgress) update(line string) bool {
+	line = strings.TrimSpace(line)
+	switch {
+	case strings.HasPrefix(line, "distance_remaining:"):
+		v, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimPrefix(line, "distance_remaining:")), 64)
+		if err != nil {
+			return false
+		}
+		// Feedback comes several times a second; centimetres are enough.
+		v = math.Round(v*100) / 100
+		changed := !p.haveDist || v != p.distance
+		p.distance, p.haveDist = v, true
+		return changed
+	case strings.HasPrefix(line, "number_of_recoveries:"):
+		n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "number_of_recoveries:")))
+		if err != nil || n == p.recoveries {
+			return false
+		}
+		p.recoveries = n
+		return true
+	case strings.HasPrefix(line, "Goal accepted"):
+		return true
+	}
+	return false
+}
+
+func (p navProgress) String() string {
+	if !p.haveDist {
+		return "goal accepted"
+	}
+	s := fmt.Sprintf("%.2f m to go", p.distance)
+	if p.recoveries > 0 {
+		s += fmt.Sprintf(", %d recoveries", p.recoveries)
+	}
+	return s
+}
@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// sensitiveTypes are the commands whose data carries secrets (Wi-Fi
+// passwords; update_repo too when it has credentials). They are sealed with the robot's payload key so the
+// broker and anyone subscribed to lab/commands/# only see ciphertext.
+var sensitiveTypes = map[string]bool{
+	"wifi_profile": true,
+}
+
+// SensitiveCommand reports whether cmd, or any command in a batch, carries
+// secrets that should be sealed.
+func SensitiveCommand(cmd Command) bool {
+	if sensitiveTypes[cmd.Type] {
+		return true
+	}
+	if cmd.Type != "batch" {
+		return HasRepoAuth(cmd)
+	}
+	var batch BatchData
+	if err := json.Unmarshal(cmd.Data, &batch); err != nil {
+		return false
+	}
+	for _, c := range batch.Commands {
+		if SensitiveCommand(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRepoAuth reports whether cmd, or any command in a batch, is an
+// update_repo carrying credentials for a private repo.
+func HasRepoAuth(cmd Command) bool {
+	switch cmd.Type {
+	case "update_repo":
+		var repo UpdateRepoData
+		return json.Unmarshal(cmd.Data, &repo) == nil && repo.Auth != nil
+	case "batch":
+		var batch BatchData
+		if err := json.Unmarshal(cmd.Data, &batch); err != nil {
+			return false
+		}
+		for _, c := range batch.Commands {
+			if HasRepoAuth(c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NewPayloadKey returns a random AES-256 key, base64 encoded as it is stored
+// in the agent config and the controller database.
+func NewPayloadKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+func payloadAEAD(key string) (cipher.AEAD, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(raw) != 32 {
+		return nil, errors.New("payload key must be 32 bytes, base64 encoded")
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// payloadAAD binds a sealed payload to the robot and command type, so it
+// can't be replayed to another robot or as a different command.
+func payloadAAD(agentID, cmdType string) []byte {
+	return []byte(agentID + "\x00" + cmdType)
+}
+
+// SealCommand encrypts cmd.Data with AES-GCM into cmd.Sealed (nonce followed
+// by ciphertext, base64) and clears Data.
+func SealCommand(cmd *Command, key, agentID string) error {
+	aead, err := payloadAEAD(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := aead.Seal(nonce, nonce, cmd.Data, payloadAAD(agentID, cmd.Type))
+	cmd.Sealed = base64.StdEncoding.EncodeToString(sealed)
+	cmd.Data = nil
+	return nil
+}
+
+// OpenCommand reverses SealCommand, restoring cmd.Data.
+func OpenCommand(cmd *Command, key, agentID string) error {
+	if key == "" {
+		return errors.New("command is encrypted but this agent has no payload_key")
+	}
+	aead, err := payloadAEAD(key)
+	if err != nil {
+		return err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(cmd.Sealed)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return errors.New("malformed encrypted command")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	data, err := aead.Open(nil, nonce, ciphertext, payloadAAD(agentID, cmd.Type))
+	if err != nil {
+		return fmt.Errorf("decrypt command: %w", err)
+	}
+	cmd.Data, cmd.Sealed = data, ""
+	return nil
+}
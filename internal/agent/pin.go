@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var commitHash = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// cloneArgs is the git clone for data: a tag is cloned like a branch, and a
+// commit with neither is checked out afterwards by pinCheckout.
+func cloneArgs(data UpdateRepoData, target string) ([]string, error) {
+	if strings.HasPrefix(data.Tag, "-") || strings.ContainsAny(data.Tag, " \t\r\n\x00") {
+		return nil, fmt.Errorf("invalid tag %q", data.Tag)
+	}
+	if data.Commit != "" && !commitHash.MatchString(data.Commit) {
+		return nil, fmt.Errorf("invalid commit %q", data.Commit)
+	}
+	switch {
+	case data.Tag != "":
+		return []string{"git", "clone", "--branch", data.Tag, "--single-branch", data.Repo, target}, nil
+	case data.Commit != "" && data.Branch == "":
+		return []string{"git", "clone", "--no-checkout", data.Repo, target}, nil
+	}
+	branch := data.Branch
+	if branch == "" {
+		branch = "main"
+	}
+	return []string{"git", "clone", "--branch", branch, "--single-branch", data.Repo, target}, nil
+}
+
+// pinCheckout moves a clone to the pinned commit, fetching it when the
+// clone didn't bring it. It fails unless HEAD ends up exactly at the pinned
+// tag and commit, on the branch if one is named. Unpinned clones are left
+// alone.
+func pinCheckout(ctx context.Context, cfg Config, env []string, target string, data UpdateRepoData) error {
+	if data.Tag == "" && data.Commit == "" {
+		return nil
+	}
+	git := func(args ...string) (string, error) {
+		full := append([]string{"git", "-c", "safe.directory=*", "-C", target}, args...)
+		out, err := cfg.commandEnv(ctx, env, full...).CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(string(out)))
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	if data.Commit != "" {
+		if _, err := git("checkout", "--quiet", "--detach", data.Commit); err != nil {
+			// Not reachable from what was cloned; servers that allow it hand
+			// out any commit by hash.
+			if _, ferr := git("fetch", "--quiet", "origin", data.Commit); ferr != nil {
+				return fmt.Errorf("commit %s not found: %w", data.Commit, ferr)
+			}
+			if _, err := git("checkout", "--quiet", "--detach", "FETCH_HEAD"); err != nil {
+				return err
+			}
+		}
+	}
+	head, err := git("rev-parse", "HEAD")
+	if err != nil {
+		return err
+	}
+	if data.Tag != "" {
+		tagged, err := git("rev-parse", "refs/tags/"+data.Tag+"^{commit}")
+		if err != nil {
+			return fmt.Errorf("tag %s not found: %w", data.Tag, err)
+		}
+		if head != tagged {
+			return fmt.Errorf("HEAD is %s, tag %s is %s", head, data.Tag, tagged)
+		}
+	}
+	if data.Commit != "" && !strings.HasPrefix(head, data.Commit) {
+		return fmt.Errorf("HEAD is %s, expected commit %s", head, data.Commit)
+	}
+	if data.Commit != "" && data.Branch != "" {
+		if _, err := git("merge-base", "--is-ancestor", head, "refs/remotes/origin/"+data.Branch); err != nil {
+			return fmt.Errorf("commit %s is not on branch %s", data.Commit, data.Branch)
+		}
+	}
+	return nil
+}
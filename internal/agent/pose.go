@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	amclPoseTopic = "/amcl_pose"
+	odomPoseTopic = "/odom"
+	// poseSampleInterval keeps position reports cheap: each one starts the
+	// ros2 CLI.
+	poseSampleInterval = 30 * time.Second
+	// amclRetryEvery is how many samples go by before a robot that isn't
+	// localizing is asked for /amcl_pose again.
+	amclRetryEvery = 10
+)
+
+// Pose is where the robot is, for the fleet map: from AMCL in the map frame
+// when Nav2 is localizing, otherwise from odometry.
+type Pose struct {
+	X      float64   `json:"x"`
+	Y      float64   `json:"y"`
+	Yaw    float64   `json:"yaw"`
+	Frame  string    `json:"frame"`
+	Source string    `json:"source"`
+	At     time.Time `json:"at"`
+}
+
+// poseSampler keeps the last pose read from ROS, sampled in the background
+// like the battery.
+type poseSampler struct {
+	mu   sync.Mutex
+	pose *Pose
+}
+
+func (p *poseSampler) run(ctx context.Context, cfg Config) {
+	if _, err := exec.LookPath("ros2"); err != nil && cfg.ROSContainer == "" {
+		return
+	}
+	ticker := time.NewTicker(poseSampleInterval)
+	defer ticker.Stop()
+	// Most robots don't run Nav2, so after AMCL stays silent only odometry
+	// is read until the next retry.
+	skipAMCL := 0
+	for {
+		var pose *Pose
+		var err error
+		if skipAMCL == 0 {
+			if pose, err = readPose(ctx, cfg, amclPoseTopic, "amcl"); err != nil {
+				skipAMCL = amclRetryEvery
+			}
+		} else {
+			skipAMCL--
+		}
+		if pose == nil {
+			pose, _ = readPose(ctx, cfg, odomPoseTopic, "odom")
+		}
+		if pose != nil {
+			p.mu.Lock()
+			p.pose = pose
+			p.mu.Unlock()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// latest returns the last pose if it is recent enough to still be true.
+func (p *poseSampler) latest() *Pose {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pose == nil || time.Since(p.pose.At) > 3*poseSampleInterval {
+		return nil
+	}
+	pose := *p.pose
+	return &pose
+}
+
+// readPose reads one pose from topic, a PoseWithCovarianceStamped or an
+// Odometry; both keep it in pose.pose.
+func readPose(ctx context.Context, cfg Config, topic, source string) (*Pose, error) {
+	ctx, cancel := context.WithTimeout(ctx, sensorReadTimeout)
+	defer cancel()
+	out, err := echoOnce(ctx, cfg, topic)
+	if err != nil {
+		return nil, err
+	}
+	type vec struct{ X, Y, Z, W float64 }
+	var msg struct {
+		Header struct {
+			FrameID string `yaml:"frame_id"`
+		} `yaml:"header"`
+		Pose struct {
+			Pose struct {
+				Position    vec `yaml:"position"`
+				Orientation vec `yaml:"orientation"`
+			} `yaml:"pose"`
+		} `yaml:"pose"`
+	}
+	if err := yaml.NewDecoder(bytes.NewReader(out)).Decode(&msg); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", topic, err)
+	}
+	pos, q := msg.Pose.Pose.Position, msg.Pose.Pose.Orientation
+	if math.IsNaN(pos.X) || math.IsNaN(pos.Y) || math.IsInf(pos.X, 0) || math.IsInf(pos.Y, 0) {
+		return nil, errors.New("pose is not a number")
+	}
+	return &Pose{
+		X:      pos.X,
+		Y:      pos.Y,
+		Yaw:    math.Atan2(2*(q.W*q.Z+q.X*q.Y), 1-2*(q.Y*q.Y+q.Z*q.Z)),
+		Frame:  msg.Header.FrameID,
+		Source: source,
+		At:     time.Now().UTC(),
+	}, nil
+}
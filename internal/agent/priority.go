@@ -0,0 +1,170 @@
+package agent
+
+import (
+	"container/heap"
+	"sync"
+)
+
+// Command priorities, highest first. Critical commands (stop) run even while
+// another job is busy; the rest wait for the running job and are taken in
+// priority order, so a click in the dashboard never queues behind a repo
+// update.
+const (
+	PriorityCritical    = "critical"
+	PriorityInteractive = "interactive"
+	PriorityBatch       = "batch"
+)
+
+// DefaultPriority is used when a command doesn't set one.
+func DefaultPriority(cmdType string) string {
+	switch cmdType {
+	case "stop", "estop", "estop_clear", "teleop_stop":
+		return PriorityCritical
+	case "update_repo", "reset_logs", "wifi_profile", "configure_agent", "batch",
+		"install_packages", "set_env", "build_workspace", "colcon_build", "rosdep_install", "ros_launch", "docker_deploy", "docker_rollback":
+		return PriorityBatch
+	default:
+		return PriorityInteractive
+	}
+}
+
+// ValidPriority reports whether p is a known priority (or empty).
+func ValidPriority(p string) bool {
+	switch p {
+	case "", PriorityCritical, PriorityInteractive, PriorityBatch:
+		return true
+	}
+	return false
+}
+
+// RetainCommand reports whether a command should be published as the
+// retained message on the agent's topic, i.e. delivered when an offline robot
+// reconnects. Only batch work is; a stale stop or test drive replayed hours
+// later is useless or unsafe, and must not displace pending maintenance.
+func RetainCommand(cmd Command) bool {
+	// A retained run_at_boot command would arrive again after the reboot and
+	// be deferred once more; replay covers robots that were offline.
+	return cmd.effectivePriority() == PriorityBatch && !cmd.RunAtBoot
+}
+
+func (cmd Command) effectivePriority() string {
+	if cmd.Priority != "" {
+		return cmd.Priority
+	}
+	return DefaultPriority(cmd.Type)
+}
+
+func priorityRank(p string) int {
+	switch p {
+	case PriorityCritical:
+		return 0
+	case PriorityInteractive:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// commandQueueSize bounds queued commands; when full the newest lowest
+// priority command is dropped.
+const commandQueueSize = 32
+
+// seenCommandsSize is how many recent command IDs are remembered to drop
+// duplicates.
+const seenCommandsSize = 256
+
+// commandQueue orders incoming commands by priority, then arrival.
+type commandQueue struct {
+	mu    sync.Mutex
+	items commandHeap
+	seq   uint64
+	// seen holds the IDs of the last seenCommandsSize commands. The same job
+	// can arrive twice, e.g. as the retained message and again when the
+	// controller replays queued jobs after the robot comes back online.
+	seen  map[string]bool
+	order []string
+}
+
+// duplicate reports whether a command with this ID was already received,
+// and remembers it if not. Commands without an ID are never duplicates.
+func (q *commandQueue) duplicate(id string) bool {
+	if id == "" {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.seen[id] {
+		return true
+	}
+	if q.seen == nil {
+		q.seen = make(map[string]bool)
+	}
+	q.seen[id] = true
+	q.order = append(q.order, id)
+	if len(q.order) > seenCommandsSize {
+		delete(q.seen, q.order[0])
+		q.order = q.order[1:]
+	}
+	return false
+}
+
+type queuedCommand struct {
+	cmd  Command
+	rank int
+	seq  uint64
+}
+
+// push adds cmd and reports false if it was dropped because the queue is full
+// of equal or higher priority work.
+func (q *commandQueue) push(cmd Command) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	item := queuedCommand{cmd: cmd, rank: priorityRank(cmd.effectivePriority()), seq: q.seq}
+	q.seq++
+	if len(q.items) >= commandQueueSize {
+		worst := 0
+		for i := range q.items {
+			if q.items.Less(worst, i) {
+				worst = i
+			}
+		}
+		if item.rank >= q.items[worst].rank {
+			return false
+		}
+		heap.Remove(&q.items, worst)
+	}
+	heap.Push(&q.items, item)
+	return true
+}
+
+// pop returns the most urgent command. When busy only critical commands are
+// returned; the rest stay queued until the running job finishes.
+func (q *commandQueue) pop(busy bool) (Command, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return Command{}, false
+	}
+	if busy && q.items[0].rank != 0 {
+		return Command{}, false
+	}
+	return heap.Pop(&q.items).(queuedCommand).cmd, true
+}
+
+type commandHeap []queuedCommand
+
+func (h commandHeap) Len() int { return len(h) }
+func (h commandHeap) Less(i, j int) bool {
+	if h[i].rank != h[j].rank {
+		return h[i].rank < h[j].rank
+	}
+	return h[i].seq < h[j].seq
+}
+func (h commandHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *commandHeap) Push(x interface{}) { *h = append(*h, x.(queuedCommand)) }
+func (h *commandHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
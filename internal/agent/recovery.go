@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	mqttc "example.com/openrobot-fleet/internal/mqtt"
+	mqttlib "github.com/eclipse/paho.mqtt.golang"
+	"gopkg.in/yaml.v3"
+)
+
+// RecoveryTopicPrefix is where agents without a usable config announce
+// themselves. The controller replies on <prefix><hostname>/config.
+const RecoveryTopicPrefix = "lab/recovery/"
+
+const recoveryAnnounceInterval = 30 * time.Second
+
+// RecoveryAnnouncement is published by an agent in "needs configuration" mode.
+type RecoveryAnnouncement struct {
+	Hostname   string `json:"hostname"`
+	IP         string `json:"ip"`
+	Status     string `json:"status"`
+	Error      string `json:"error"`
+	ConfigPath string `json:"config_path"`
+	Timestamp  string `json:"timestamp"`
+}
+
+// RunRecoveryMode is entered when neither the config nor its last-good copy
+// can be loaded. Instead of exiting, the agent connects to whatever broker it
+// can salvage from the damaged file (or MQTT_BROKER), announces itself on the
+// recovery topic and waits for a config to be pushed. It returns the new config once it has
+// been validated and saved.
+func RunRecoveryMode(ctx context.Context, path string, loadErr error) (Config, error) {
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "unknown"
+	}
+	topic := RecoveryTopicPrefix + hostname
+	slog.Warn("entering recovery mode", "err", loadErr, "topic", topic)
+
+	received := make(chan Config, 1)
+	handler := func(_ mqttlib.Client, msg mqttlib.Message) {
+		var cfg Config
+		if err := yaml.Unmarshal(msg.Payload(), &cfg); err != nil {
+			slog.Warn("recovery: invalid config", "err", err)
+			return
+		}
+		if err := cfg.Validate(); err != nil {
+			slog.Warn("recovery: rejected config", "err", err)
+			return
+		}
+		if err := SaveConfig(path, cfg); err != nil {
+			slog.Error("recovery: save config failed", "err", err)
+			return
+		}
+		select {
+		case received <- cfg:
+		default:
+		}
+	}
+	onConnect := func(c mqttlib.Client) {
+		if token := c.Subscribe(topic+"/config", 1, handler); token.Wait() && token.Error() != nil {
+			slog.Error("recovery: subscribe failed", "err", token.Error())
+		}
+	}
+	client := mqttc.NewClientWithHandler("agent-recovery-"+hostname, salvageBroker(path), onConnect)
+	defer client.Disconnect(250 * time.Millisecond)
+
+	announce := func() {
+		payload, _ := json.Marshal(RecoveryAnnouncement{
+			Hostname:   hostname,
+			IP:         DetectIPv4(),
+			Status:     "needs_configuration",
+			Error:      loadErr.Error(),
+			ConfigPath: path,
+			Timestamp:  time.Now().UTC().Format(time.RFC3339),
+		})
+		client.Publish(topic, 0, false, payload)
+	}
+
+	ticker := time.NewTicker(recoveryAnnounceInterval)
+	defer ticker.Stop()
+	announce()
+	for {
+		select {
+		case <-ctx.Done():
+			return Config{}, ctx.Err()
+		case cfg := <-received:
+			slog.Info("recovery: received config", "agent_id", cfg.AgentID)
+			// Clear the retained config so a later corruption does not replay it
+			client.Publish(topic+"/config", 1, true, nil)
+			return cfg, nil
+		case <-ticker.C:
+			announce()
+		}
+	}
+}
+
+// salvageBroker pulls the mqtt_broker line out of a config that no longer
+// parses as a whole. It returns "" if nothing usable is found.
+func salvageBroker(path string) string {
+	for _, p := range []string{path, LastGoodPath(path)} {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			key, value, ok := strings.Cut(line, ":")
+			if !ok || strings.TrimSpace(key) != "mqtt_broker" {
+				continue
+			}
+			value = strings.Trim(strings.TrimSpace(value), `"'`)
+			if strings.HasPrefix(value, "tcp://") || strings.HasPrefix(value, "ssl://") {
+				return value
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// defaultTokenUser is sent with a token that has no username; GitHub and
+// GitLab only check the token.
+const defaultTokenUser = "x-access-token"
+
+// credentialHelper answers git's requests for a password from the
+// environment, so the token is never on a command line or in .git/config.
+const credentialHelper = `!f() { test "$1" = get || exit 0; echo "username=$ORF_GIT_USERNAME"; echo "password=$ORF_GIT_TOKEN"; }; f`
+
+// gitAuth prepares git to clone with auth. The returned env vars are added to
+// git's environment; cleanup removes the deploy key, written to a temporary
+// file on the host or in the ROS container, once git is done with it.
+func gitAuth(ctx context.Context, cfg Config, auth *RepoAuth) (env []string, cleanup func(), err error) {
+	cleanup = func() {}
+	if auth == nil || (auth.Token == "" && auth.SSHKey == "") {
+		return nil, cleanup, nil
+	}
+	// Fail rather than hang waiting for a password nobody will type.
+	env = []string{"GIT_TERMINAL_PROMPT=0"}
+	if auth.Token != "" {
+		user := auth.Username
+		if user == "" {
+			user = defaultTokenUser
+		}
+		// The empty helper drops any configured on the machine.
+		env = append(env,
+			"GIT_CONFIG_COUNT=2",
+			"GIT_CONFIG_KEY_0=credential.helper", "GIT_CONFIG_VALUE_0=",
+			"GIT_CONFIG_KEY_1=credential.helper", "GIT_CONFIG_VALUE_1="+credentialHelper,
+			"ORF_GIT_USERNAME="+user, "ORF_GIT_TOKEN="+auth.Token)
+	}
+	if auth.SSHKey != "" {
+		key := strings.TrimSpace(auth.SSHKey) + "\n"
+		var path string
+		if cfg.ROSContainer == "" {
+			f, err := os.CreateTemp("", "openrobotfleet-deploy-key-*")
+			if err != nil {
+				return nil, cleanup, fmt.Errorf("write deploy key: %w", err)
+			}
+			path = f.Name()
+			cleanup = func() { os.Remove(path) }
+			_, err = f.WriteString(key)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				cleanup()
+				return nil, func() {}, fmt.Errorf("write deploy key: %w", err)
+			}
+		} else {
+			suffix := make([]byte, 8)
+			if _, err := rand.Read(suffix); err != nil {
+				return nil, cleanup, err
+			}
+			path = "/tmp/openrobotfleet-deploy-key-" + hex.EncodeToString(suffix)
+			write := cfg.commandEnv(ctx, []string{"ORF_GIT_SSH_KEY=" + key}, "sh", "-c", `umask 077 && printf '%s' "$ORF_GIT_SSH_KEY" > "$1"`, "sh", path)
+			if output, err := write.CombinedOutput(); err != nil {
+				return nil, cleanup, fmt.Errorf("write deploy key in %s: %w: %s", cfg.ROSContainer, err, strings.TrimSpace(string(output)))
+			}
+			cleanup = func() { cfg.command(context.Background(), "rm", "-f", path).Run() }
+		}
+		// Robots have never seen the git host before; pin it on first use.
+		env = append(env, "GIT_SSH_COMMAND=ssh -i "+path+" -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new")
+	}
+	return env, cleanup, nil
+}
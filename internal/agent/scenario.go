@@ -0,0 +1,251 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// scenarioEnvPath holds the scenario's env vars as shell exports. It is
+	// in profile.d so students' login shells on the host see them too.
+	scenarioEnvPath = "/etc/profile.d/openrobotfleet-scenario.sh"
+	// launchScriptPath is what the launch unit runs.
+	launchScriptPath = "/etc/openrobotfleet-agent/launch.sh"
+	launchUnitName   = "openrobotfleet-launch"
+	launchUnitPath   = "/etc/systemd/system/" + launchUnitName + ".service"
+)
+
+var (
+	envVarName    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	packageName   = regexp.MustCompile(`^[a-z0-9][a-z0-9+._-]+$`)
+	launchArgName = envVarName
+	// launchTarget keeps the package and file safe to name in the unit's
+	// ExecStop.
+	launchTarget = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_./-]*$`)
+)
+
+// HandleInstallPackages installs apt packages, and ROS packages for the
+// installed distro, in the ROS container when there is one.
+func HandleInstallPackages(cfg Config, data InstallPackagesData) error {
+	ctx := context.Background()
+	pkgs := append([]string{}, data.Apt...)
+	if len(data.ROS) > 0 {
+		distro, err := rosDistro(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		for _, p := range data.ROS {
+			pkgs = append(pkgs, "ros-"+distro+"-"+strings.ReplaceAll(p, "_", "-"))
+		}
+	}
+	for _, p := range pkgs {
+		if !packageName.MatchString(p) {
+			return fmt.Errorf("invalid package name %q", p)
+		}
+	}
+	if len(pkgs) == 0 {
+		return nil
+	}
+	steps := [][]string{
+		{"apt-get", "update"},
+		append([]string{"env", "DEBIAN_FRONTEND=noninteractive", "apt-get", "install", "-y", "--no-install-recommends"}, pkgs...),
+	}
+	for _, args := range steps {
+		if output, err := cfg.command(ctx, args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("%s failed: %w: %s", strings.Join(args, " "), err, tail(output))
+		}
+	}
+	slog.Info("installed packages", "packages", pkgs, "container", cfg.ROSContainer)
+	return nil
+}
+
+// rosDistro returns the ROS distro installed under /opt/ros.
+func rosDistro(ctx context.Context, cfg Config) (string, error) {
+	out, err := cfg.command(ctx, "ls", "/opt/ros").Output()
+	if err != nil {
+		return "", fmt.Errorf("find ROS distro: %w", err)
+	}
+	distros := strings.Fields(string(out))
+	if len(distros) == 0 {
+		return "", errors.New("no ROS distro installed under /opt/ros")
+	}
+	if len(distros) > 1 {
+		slog.Warn("several ROS distros installed, using the first", "distros", distros)
+	}
+	return distros[0], nil
+}
+
+// HandleSetEnv writes the scenario's env vars, replacing the previous set.
+// The build and launch pick them up the next time they run.
+func HandleSetEnv(data SetEnvData) error {
+	if len(data.Vars) == 0 {
+		if err := os.Remove(scenarioEnvPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	names := make([]string, 0, len(data.Vars))
+	for k := range data.Vars {
+		if !envVarName.MatchString(k) {
+			return fmt.Errorf("invalid env var name %q", k)
+		}
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString("# Written by openrobotfleet-agent for the applied scenario.\n")
+	for _, k := range names {
+		fmt.Fprintf(&b, "export %s=%s\n", k, shellQuote(data.Vars[k]))
+	}
+	if err := os.WriteFile(scenarioEnvPath, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", scenarioEnvPath, err)
+	}
+	slog.Info("set scenario env", "vars", names)
+	return nil
+}
+
+// HandleBuildWorkspace runs the build steps in the ROS workspace with ROS and
+// the scenario's env vars loaded.
+func HandleBuildWorkspace(cfg Config, data BuildWorkspaceData) error {
+	ctx := context.Background()
+	root := workspaceRoot(cfg)
+	if root == "" {
+		return errors.New("workspace_path is not configured")
+	}
+	for i, step := range data.Steps {
+		slog.Info("build: running step", "step", i+1, "total", len(data.Steps), "cmd", step)
+		script := scenarioScript(root, step)
+		if output, err := cfg.command(ctx, "bash", "-c", script).CombinedOutput(); err != nil {
+			return fmt.Errorf("build step %q failed: %w: %s", step, err, tail(output))
+		}
+	}
+	return ownWorkspace(ctx, cfg, root)
+}
+
+// HandleROSLaunch (re)starts the scenario's ros2 launch as a systemd unit,
+// so it survives reboots and is restarted if it crashes.
+func HandleROSLaunch(cfg Config, data ROSLaunchData) error {
+	root := workspaceRoot(cfg)
+	if root == "" {
+		return errors.New("workspace_path is not configured")
+	}
+	launch, err := launchCommand(data)
+	if err != nil {
+		return err
+	}
+	inner := scenarioScript(root, "exec "+launch)
+
+	script := "#!/bin/bash\n" + inner + "\n"
+	unit := launchUnit
+	if cfg.ROSContainer != "" {
+		// docker exec doesn't pass signals on, so stopping the unit has to
+		// kill the launch inside the container itself.
+		script = "#!/bin/bash\nexec docker exec " + shellQuote(cfg.ROSContainer) + " bash -c " + shellQuote(inner) + "\n"
+		unit = strings.Replace(unit, "[Service]\n", "[Service]\nExecStop=/usr/bin/docker exec "+cfg.ROSContainer+" pkill -INT -f \"ros2 launch "+data.Package+" "+data.File+"\"\n", 1)
+		unit = strings.Replace(unit, "After=network-online.target", "After=network-online.target docker.service", 1)
+	}
+	if err := os.MkdirAll(filepath.Dir(launchScriptPath), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(launchScriptPath, []byte(script), 0o700); err != nil {
+		return fmt.Errorf("write %s: %w", launchScriptPath, err)
+	}
+	if err := os.WriteFile(launchUnitPath, []byte(unit), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", launchUnitPath, err)
+	}
+	for _, args := range [][]string{
+		{"systemctl", "daemon-reload"},
+		{"systemctl", "enable", launchUnitName},
+		{"systemctl", "restart", launchUnitName},
+	} {
+		if output, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+			return fmt.Errorf("%s failed: %w: %s", strings.Join(args, " "), err, tail(output))
+		}
+	}
+	slog.Info("started scenario launch", "package", data.Package, "file", data.File, "container", cfg.ROSContainer)
+	return nil
+}
+
+// launchCommand is the shell command running data's ros2 launch.
+func launchCommand(data ROSLaunchData) (string, error) {
+	if !launchTarget.MatchString(data.Package) || !launchTarget.MatchString(data.File) {
+		return "", fmt.Errorf("invalid launch package %q or file %q", data.Package, data.File)
+	}
+	launch := []string{"ros2", "launch", shellQuote(data.Package), shellQuote(data.File)}
+	keys := make([]string, 0, len(data.Args))
+	for k := range data.Args {
+		if !launchArgName.MatchString(k) {
+			return "", fmt.Errorf("invalid launch argument %q", k)
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		launch = append(launch, shellQuote(k+":="+data.Args[k]))
+	}
+	return strings.Join(launch, " "), nil
+}
+
+const launchUnit = `[Unit]
+Description=OpenRobot scenario launch
+After=network-online.target
+
+[Service]
+ExecStart=` + launchScriptPath + `
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// workspaceRoot is the colcon workspace: the parent of workspace_path when
+// that is its src directory.
+func workspaceRoot(cfg Config) string {
+	ws := strings.TrimSpace(cfg.WorkspacePath)
+	if ws == "" {
+		return ""
+	}
+	ws = filepath.Clean(ws)
+	if filepath.Base(ws) == "src" {
+		return filepath.Dir(ws)
+	}
+	return ws
+}
+
+// scenarioScript wraps body so it runs in root with ROS, the workspace
+// overlay (once built) and the scenario's env vars loaded. The env file is
+// read on the host and inlined, so it also reaches a ROS container.
+func scenarioScript(root, body string) string {
+	var b strings.Builder
+	b.WriteString(rosSetup + "\n")
+	if env, err := os.ReadFile(scenarioEnvPath); err == nil {
+		b.Write(env)
+	}
+	fmt.Fprintf(&b, "cd %s || exit 1\n", shellQuote(root))
+	b.WriteString("[ -f install/setup.bash ] && . install/setup.bash\n")
+	b.WriteString(body)
+	return b.String()
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// tail keeps the end of a command's output, where the error usually is.
+func tail(output []byte) string {
+	const limit = 2000
+	s := strings.TrimSpace(string(output))
+	if len(s) > limit {
+		s = "..." + s[len(s)-limit:]
+	}
+	return s
+}
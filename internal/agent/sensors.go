@@ -0,0 +1,205 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultScanPoints = 360
+	sensorReadTimeout = 10 * time.Second
+)
+
+// HandleSensorSnapshot reads the lidar, camera and odometry once each, in
+// parallel, and posts the combined result to the controller. Individual
+// sensor failures are reported in the snapshot rather than failing the job.
+func HandleSensorSnapshot(cfg Config, data SensorSnapshotData) error {
+	if data.ResultURL == "" {
+		return errors.New("sensor snapshot result url required")
+	}
+	scanTopic, odomTopic := data.ScanTopic, data.OdomTopic
+	if scanTopic == "" {
+		scanTopic = "/scan"
+	}
+	if odomTopic == "" {
+		odomTopic = "/odom"
+	}
+	points := data.ScanPoints
+	if points <= 0 {
+		points = defaultScanPoints
+	}
+
+	slog.Info("taking sensor snapshot", "scan_topic", scanTopic, "odom_topic", odomTopic)
+	ctx, cancel := context.WithTimeout(context.Background(), sensorReadTimeout)
+	defer cancel()
+
+	snap := SensorSnapshot{CapturedAt: time.Now().UTC()}
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		scan, err := readLidarScan(ctx, cfg, scanTopic, points)
+		if err != nil {
+			snap.ScanError = err.Error()
+			return
+		}
+		snap.Scan = scan
+	}()
+	go func() {
+		defer wg.Done()
+		jpeg, err := captureJPEG(ctx)
+		if err != nil {
+			snap.CameraError = err.Error()
+			return
+		}
+		snap.Camera = &CameraFrame{JPEG: jpeg}
+	}()
+	go func() {
+		defer wg.Done()
+		odom, err := readOdom(ctx, cfg, odomTopic)
+		if err != nil {
+			snap.OdomError = err.Error()
+			return
+		}
+		snap.Odom = odom
+	}()
+	wg.Wait()
+
+	body, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(data.ResultURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("report snapshot failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("report snapshot returned status: %s", resp.Status)
+	}
+	slog.Info("sensor snapshot sent", "scan_error", snap.ScanError, "camera_error", snap.CameraError, "odom_error", snap.OdomError)
+	return nil
+}
+
+// echoOnce returns the first message published on topic as YAML.
+func echoOnce(ctx context.Context, cfg Config, topic string) ([]byte, error) {
+	out, err := cfg.rosCommand(ctx, "ros2", "topic", "echo", "--once", "--full-length", topic).Output()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("no message on %s within %s", topic, sensorReadTimeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ros2 topic echo %s: %v", topic, err)
+	}
+	return out, nil
+}
+
+func readLidarScan(ctx context.Context, cfg Config, topic string, maxPoints int) (*LidarScan, error) {
+	out, err := echoOnce(ctx, cfg, topic)
+	if err != nil {
+		return nil, err
+	}
+	var msg struct {
+		AngleMin       float64   `yaml:"angle_min"`
+		AngleIncrement float64   `yaml:"angle_increment"`
+		RangeMin       float64   `yaml:"range_min"`
+		RangeMax       float64   `yaml:"range_max"`
+		Ranges         []float64 `yaml:"ranges"`
+	}
+	if err := yaml.NewDecoder(bytes.NewReader(out)).Decode(&msg); err != nil {
+		return nil, fmt.Errorf("parse scan: %v", err)
+	}
+	if len(msg.Ranges) == 0 {
+		return nil, fmt.Errorf("scan on %s has no ranges", topic)
+	}
+	return downsampleScan(msg.AngleMin, msg.AngleIncrement, msg.RangeMin, msg.RangeMax, msg.Ranges, maxPoints), nil
+}
+
+// downsampleScan keeps the nearest valid return in each sector so obstacles
+// are not averaged away.
+func downsampleScan(angleMin, inc, rangeMin, rangeMax float64, ranges []float64, maxPoints int) *LidarScan {
+	step := (len(ranges) + maxPoints - 1) / maxPoints
+	if step < 1 {
+		step = 1
+	}
+	scan := &LidarScan{
+		AngleMin:       angleMin,
+		AngleIncrement: inc * float64(step),
+		RangeMin:       rangeMin,
+		RangeMax:       rangeMax,
+		Points:         len(ranges),
+	}
+	for i := 0; i < len(ranges); i += step {
+		var nearest *float64
+		for _, r := range ranges[i:min(i+step, len(ranges))] {
+			if math.IsNaN(r) || math.IsInf(r, 0) || r < rangeMin || (rangeMax > 0 && r > rangeMax) {
+				continue
+			}
+			if nearest == nil || r < *nearest {
+				v := r
+				nearest = &v
+			}
+		}
+		scan.Ranges = append(scan.Ranges, nearest)
+	}
+	return scan
+}
+
+func readOdom(ctx context.Context, cfg Config, topic string) (*OdomReading, error) {
+	out, err := echoOnce(ctx, cfg, topic)
+	if err != nil {
+		return nil, err
+	}
+	type vec struct{ X, Y, Z, W float64 }
+	var msg struct {
+		Pose struct {
+			Pose struct {
+				Position    vec `yaml:"position"`
+				Orientation vec `yaml:"orientation"`
+			} `yaml:"pose"`
+		} `yaml:"pose"`
+		Twist struct {
+			Twist struct {
+				Linear  vec `yaml:"linear"`
+				Angular vec `yaml:"angular"`
+			} `yaml:"twist"`
+		} `yaml:"twist"`
+	}
+	if err := yaml.NewDecoder(bytes.NewReader(out)).Decode(&msg); err != nil {
+		return nil, fmt.Errorf("parse odom: %v", err)
+	}
+	q := msg.Pose.Pose.Orientation
+	return &OdomReading{
+		X:        msg.Pose.Pose.Position.X,
+		Y:        msg.Pose.Pose.Position.Y,
+		Yaw:      math.Atan2(2*(q.W*q.Z+q.X*q.Y), 1-2*(q.Y*q.Y+q.Z*q.Z)),
+		LinearX:  msg.Twist.Twist.Linear.X,
+		AngularZ: msg.Twist.Twist.Angular.Z,
+	}, nil
+}
+
+// captureJPEG grabs one frame from the default camera.
+func captureJPEG(ctx context.Context) ([]byte, error) {
+	f, err := os.CreateTemp("", "sensor-*.jpg")
+	if err != nil {
+		return nil, err
+	}
+	path := f.Name()
+	f.Close()
+	defer os.Remove(path)
+	if err := captureFrame(ctx, path); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"example.com/openrobot-fleet/internal/agent/behavior"
+)
+
+// minSuspend is the smallest gap between the wall clock and the monotonic
+// clock taken for a suspend. Shorter steps are NTP corrections.
+const minSuspend = 15 * time.Second
+
+// maxSuspendEvents caps the events kept while the broker is unreachable.
+const maxSuspendEvents = 20
+
+// SuspendEvent is one sleep of the host, reported in the next heartbeat so
+// the controller can tell a laptop that was asleep from one that was down.
+type SuspendEvent struct {
+	SuspendedAt time.Time `json:"suspended_at"`
+	ResumedAt   time.Time `json:"resumed_at"`
+}
+
+// suspendWatch detects resume from suspend. The monotonic clock stops while
+// the host sleeps but the wall clock does not, so after a resume the wall
+// clock has jumped ahead of it by the time spent asleep.
+type suspendWatch struct {
+	last    time.Time
+	pending []SuspendEvent
+}
+
+// check records a suspend if one happened since the previous call and
+// reports whether it did.
+func (w *suspendWatch) check(now time.Time) bool {
+	last := w.last
+	w.last = now
+	if last.IsZero() {
+		return false
+	}
+	asleep := now.Round(0).Sub(last.Round(0)) - now.Sub(last)
+	if asleep < minSuspend {
+		return false
+	}
+	resumed := now.Round(0).UTC()
+	w.pending = append(w.pending, SuspendEvent{SuspendedAt: resumed.Add(-asleep), ResumedAt: resumed})
+	if len(w.pending) > maxSuspendEvents {
+		w.pending = w.pending[len(w.pending)-maxSuspendEvents:]
+	}
+	return true
+}
+
+// watchSuspend handles a resume on laptops: the broker connection is
+// usually dead by then but paho only notices after its keepalive times out,
+// so it is dropped and re-established right away, followed by a heartbeat.
+func (e *AgentEngine) watchSuspend(ctx context.Context, bb *behavior.Blackboard) behavior.Status {
+	if e.Config.Type != "laptop" || !e.suspend.check(time.Now()) {
+		return behavior.StatusSuccess
+	}
+	ev := e.suspend.pending[len(e.suspend.pending)-1]
+	slog.Info("resumed from suspend", "suspended_at", ev.SuspendedAt, "asleep", ev.ResumedAt.Sub(ev.SuspendedAt).Round(time.Second))
+	if e.MQTTClient != nil && e.MQTTClient.Client != nil {
+		e.MQTTClient.Client.Disconnect(0)
+	}
+	e.lastConnectAttempt = time.Time{}
+	e.lastHeartbeat = time.Time{}
+	return behavior.StatusSuccess
+}
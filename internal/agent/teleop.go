@@ -0,0 +1,401 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Teleoperation runs a WebRTC peer next to the agent: a small Python
+// program around GStreamer's webrtcbin that answers the operator's offer,
+// sends the camera as VP8 and publishes the velocities arriving on the data
+// channel to /cmd_vel. It needs python3-gi, the GStreamer "bad" plugins with
+// libnice, and rclpy on the host; the golden image installs them.
+
+const (
+	// teleopAnswerWait bounds how long the peer may take to answer,
+	// including gathering its ICE candidates.
+	teleopAnswerWait = 20 * time.Second
+	// teleopMaxDuration is the longest session unless the command asks for
+	// less.
+	teleopMaxDuration = 30 * time.Minute
+	// teleopVideoDevice is the camera sent to the operator.
+	teleopVideoDevice = "/dev/video0"
+)
+
+// teleopSession is the one teleoperation session a robot has open. Starting
+// another one, e.g. when the operator reloads the page, replaces it.
+type teleopSession struct {
+	mu     sync.Mutex
+	id     string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// start answers data's offer and keeps the peer running in the background
+// until the session ends or ctx, the e-stop's motion context, is cancelled.
+func (t *teleopSession) start(ctx context.Context, cfg Config, data TeleopStartData) error {
+	switch {
+	case data.Session == "":
+		return errors.New("session is required")
+	case data.Offer == "":
+		return errors.New("offer is required")
+	case data.AnswerURL == "":
+		return errors.New("answer_url is required")
+	}
+	t.stop("")
+
+	answer, err := t.run(ctx, cfg, data)
+	if err != nil {
+		postTeleopAnswer(data.AnswerURL, TeleopAnswer{Error: err.Error()})
+		return err
+	}
+	if err := postTeleopAnswer(data.AnswerURL, answer); err != nil {
+		t.stop(data.Session)
+		return fmt.Errorf("send answer: %w", err)
+	}
+	return nil
+}
+
+func (t *teleopSession) run(ctx context.Context, cfg Config, data TeleopStartData) (TeleopAnswer, error) {
+	script := filepath.Join(os.TempDir(), "openrobotfleet-teleop.py")
+	if err := os.WriteFile(script, []byte(teleopPeerScript), 0o600); err != nil {
+		return TeleopAnswer{}, err
+	}
+	maxDuration := teleopMaxDuration
+	if d := time.Duration(data.MaxDurationSec) * time.Second; d > 0 && d < maxDuration {
+		maxDuration = d
+	}
+	limits := cfg.Drive.withDefaults()
+
+	sctx, cancel := context.WithCancel(ctx)
+	cmd := exec.CommandContext(sctx, "python3", script)
+	cmd.Env = append(os.Environ(),
+		"TELEOP_MAX_LINEAR="+strconv.FormatFloat(limits.MaxLinear, 'g', -1, 64),
+		"TELEOP_MAX_ANGULAR="+strconv.FormatFloat(limits.MaxAngular, 'g', -1, 64),
+		"TELEOP_MAX_SEC="+strconv.Itoa(int(maxDuration.Seconds())),
+		"TELEOP_VIDEO_DEVICE="+teleopVideoDevice,
+	)
+	// SIGTERM lets the peer publish a last zero velocity before it exits.
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = 5 * time.Second
+	offer, _ := json.Marshal(map[string]string{"sdp": data.Offer})
+	cmd.Stdin = bytes.NewReader(append(offer, '\n'))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return TeleopAnswer{}, err
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return TeleopAnswer{}, fmt.Errorf("start teleop peer: %w", err)
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64<<10), 1<<20)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	fail := func(err error) (TeleopAnswer, error) {
+		cancel()
+		go func() {
+			for range lines {
+			}
+		}()
+		cmd.Wait()
+		if out := tail(stderr.Bytes()); out != "" {
+			err = fmt.Errorf("%w: %s", err, out)
+		}
+		return TeleopAnswer{}, err
+	}
+
+	var answer TeleopAnswer
+	timer := time.NewTimer(teleopAnswerWait)
+	defer timer.Stop()
+	select {
+	case line, ok := <-lines:
+		if !ok {
+			return fail(errors.New("teleop peer exited without answering"))
+		}
+		if err := json.Unmarshal([]byte(line), &answer); err != nil {
+			return fail(fmt.Errorf("invalid answer from teleop peer: %w", err))
+		}
+		if answer.Error != "" {
+			return fail(errors.New(answer.Error))
+		}
+		if answer.SDP == "" {
+			return fail(errors.New("teleop peer sent an empty answer"))
+		}
+	case <-timer.C:
+		return fail(errors.New("teleop peer did not answer in time"))
+	case <-ctx.Done():
+		return fail(errEStopped)
+	}
+
+	done := make(chan struct{})
+	t.mu.Lock()
+	t.id, t.cancel, t.done = data.Session, cancel, done
+	t.mu.Unlock()
+	slog.Info("teleop session started", "session", data.Session, "max_duration", maxDuration)
+
+	go func() {
+		defer close(done)
+		for line := range lines {
+			var event struct {
+				Event  string `json:"event"`
+				Reason string `json:"reason"`
+				Error  string `json:"error"`
+			}
+			if json.Unmarshal([]byte(line), &event) == nil {
+				slog.Info("teleop", "session", data.Session, "event", event.Event, "reason", event.Reason, "err", event.Error)
+			}
+		}
+		err := cmd.Wait()
+		cancel()
+		t.mu.Lock()
+		if t.id == data.Session {
+			t.id, t.cancel, t.done = "", nil, nil
+		}
+		t.mu.Unlock()
+		if err != nil && sctx.Err() == nil {
+			slog.Warn("teleop peer failed", "session", data.Session, "err", err, "output", tail(stderr.Bytes()))
+			return
+		}
+		slog.Info("teleop session ended", "session", data.Session)
+	}()
+	return answer, nil
+}
+
+// stop ends session, or the open session if session is empty, and waits
+// for the peer to exit.
+func (t *teleopSession) stop(session string) {
+	t.mu.Lock()
+	if t.cancel == nil || (session != "" && session != t.id) {
+		t.mu.Unlock()
+		return
+	}
+	cancel, done := t.cancel, t.done
+	t.mu.Unlock()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		slog.Warn("teleop peer did not exit in time", "session", session)
+	}
+}
+
+func postTeleopAnswer(url string, answer TeleopAnswer) error {
+	body, err := json.Marshal(answer)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 500))
+		return fmt.Errorf("controller returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// teleopPeerScript reads the offer as a JSON line on stdin and writes the
+// answer, then events, as JSON lines on stdout. Velocities on the data
+// channel are JSON {"linear": m/s, "angular": rad/s}, clamped to the
+// robot's drive limits; if none arrives for half a second the robot stops.
+const teleopPeerScript = `import json
+import os
+import signal
+import sys
+import threading
+import time
+
+import gi
+
+gi.require_version("Gst", "1.0")
+gi.require_version("GstSdp", "1.0")
+gi.require_version("GstWebRTC", "1.0")
+from gi.repository import GLib, Gst, GstSdp, GstWebRTC
+
+import rclpy
+from geometry_msgs.msg import Twist
+
+MAX_LINEAR = float(os.environ["TELEOP_MAX_LINEAR"])
+MAX_ANGULAR = float(os.environ["TELEOP_MAX_ANGULAR"])
+MAX_SEC = int(os.environ["TELEOP_MAX_SEC"])
+DEVICE = os.environ.get("TELEOP_VIDEO_DEVICE", "/dev/video0")
+DEADMAN = 0.5
+
+
+def emit(**msg):
+    sys.stdout.write(json.dumps(msg) + "\n")
+    sys.stdout.flush()
+
+
+def clamp(value, limit):
+    try:
+        value = float(value)
+    except (TypeError, ValueError):
+        return 0.0
+    if value != value:
+        return 0.0
+    return max(-limit, min(limit, value))
+
+
+class Peer:
+    def __init__(self, offer):
+        rclpy.init()
+        self.node = rclpy.create_node("openrobotfleet_teleop")
+        self.pub = self.node.create_publisher(Twist, "/cmd_vel", 10)
+        self.lock = threading.Lock()
+        self.velocity = (0.0, 0.0)
+        self.received = 0.0
+        self.answered = False
+        self.channel = None
+        self.loop = GLib.MainLoop()
+
+        desc = "webrtcbin name=webrtc bundle-policy=max-bundle"
+        if os.path.exists(DEVICE):
+            desc += (
+                " v4l2src device=" + DEVICE + " ! videoconvert ! videoscale ! video/x-raw,width=640,height=480"
+                " ! videorate ! video/x-raw,framerate=15/1 ! queue max-size-buffers=1 leaky=downstream"
+                " ! vp8enc deadline=1 cpu-used=8 target-bitrate=800000 keyframe-max-dist=30"
+                " ! rtpvp8pay ! application/x-rtp,media=video,encoding-name=VP8,payload=96 ! webrtc."
+            )
+        self.pipe = Gst.parse_launch(desc)
+        self.webrtc = self.pipe.get_by_name("webrtc")
+        self.webrtc.connect("on-data-channel", self.on_data_channel)
+        self.webrtc.connect("notify::ice-gathering-state", self.on_gathering)
+        self.webrtc.connect("notify::connection-state", self.on_connection)
+        bus = self.pipe.get_bus()
+        bus.add_signal_watch()
+        bus.connect("message::error", self.on_error)
+        self.pipe.set_state(Gst.State.PLAYING)
+
+        _, sdp = GstSdp.SDPMessage.new_from_text(offer)
+        remote = GstWebRTC.WebRTCSessionDescription.new(GstWebRTC.WebRTCSDPType.OFFER, sdp)
+        self.webrtc.emit("set-remote-description", remote, Gst.Promise.new_with_change_func(self.on_remote_set, None, None))
+
+        GLib.timeout_add(100, self.publish)
+        GLib.timeout_add_seconds(MAX_SEC, self.quit, "time limit reached")
+        # Send whatever candidates were gathered if gathering drags on.
+        GLib.timeout_add_seconds(5, self.send_answer)
+        GLib.unix_signal_add(GLib.PRIORITY_DEFAULT, signal.SIGTERM, self.quit, "stopped")
+
+    def on_remote_set(self, promise, _, __):
+        self.webrtc.emit("create-answer", None, Gst.Promise.new_with_change_func(self.on_answer_created, None, None))
+
+    def on_answer_created(self, promise, _, __):
+        answer = promise.get_reply().get_value("answer")
+        self.webrtc.emit("set-local-description", answer, Gst.Promise.new())
+
+    def on_gathering(self, webrtc, _):
+        if webrtc.get_property("ice-gathering-state") == GstWebRTC.WebRTCICEGatheringState.COMPLETE:
+            GLib.idle_add(self.send_answer)
+
+    def send_answer(self):
+        if self.answered:
+            return False
+        local = self.webrtc.get_property("local-description")
+        if local is None:
+            return True
+        self.answered = True
+        emit(sdp=local.sdp.as_text())
+        return False
+
+    def on_connection(self, webrtc, _):
+        state = webrtc.get_property("connection-state")
+        if state == GstWebRTC.WebRTCPeerConnectionState.CONNECTED:
+            emit(event="connected")
+        elif state in (GstWebRTC.WebRTCPeerConnectionState.FAILED, GstWebRTC.WebRTCPeerConnectionState.CLOSED):
+            GLib.idle_add(self.quit, "connection " + state.value_nick)
+
+    def on_data_channel(self, webrtc, channel):
+        self.channel = channel
+        channel.connect("on-message-string", self.on_message)
+        channel.connect("on-close", lambda *_: GLib.idle_add(self.quit, "operator left"))
+
+    def on_message(self, channel, text):
+        try:
+            msg = json.loads(text)
+        except ValueError:
+            return
+        with self.lock:
+            self.velocity = (clamp(msg.get("linear"), MAX_LINEAR), clamp(msg.get("angular"), MAX_ANGULAR))
+            self.received = time.monotonic()
+
+    def on_error(self, bus, message):
+        err, _ = message.parse_error()
+        if not self.answered:
+            self.answered = True
+            emit(error=err.message)
+        GLib.idle_add(self.quit, err.message)
+
+    def publish(self):
+        with self.lock:
+            linear, angular = self.velocity
+            if time.monotonic() - self.received > DEADMAN:
+                linear, angular = 0.0, 0.0
+        self.send(linear, angular)
+        return True
+
+    def send(self, linear, angular):
+        twist = Twist()
+        twist.linear.x = linear
+        twist.angular.z = angular
+        self.pub.publish(twist)
+
+    def quit(self, reason):
+        emit(event="closed", reason=reason)
+        self.loop.quit()
+        return False
+
+    def close(self):
+        for _ in range(3):
+            self.send(0.0, 0.0)
+            time.sleep(0.05)
+        self.pipe.set_state(Gst.State.NULL)
+        self.node.destroy_node()
+        rclpy.shutdown()
+
+
+def main():
+    Gst.init(None)
+    try:
+        offer = json.loads(sys.stdin.readline())["sdp"]
+    except (ValueError, KeyError, TypeError) as e:
+        emit(error="invalid offer: %s" % e)
+        return 1
+    peer = Peer(offer)
+    try:
+        peer.loop.run()
+    finally:
+        peer.close()
+    return 0
+
+
+if __name__ == "__main__":
+    sys.exit(main())
+`
@@ -1,14 +1,19 @@
 package agent
 
 import (
-	"log"
+	"bufio"
+	"log/slog"
 	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func DetectIPv4() string {
 	ifaces, err := net.Interfaces()
 	if err != nil {
-		log.Printf("ip detect: %v", err)
+		slog.Warn("ip detect failed", "err", err)
 		return ""
 	}
 	for _, iface := range ifaces {
@@ -39,3 +44,24 @@ func DetectIPv4() string {
 	}
 	return ""
 }
+
+// DetectBootTime reads the kernel boot time from /proc/stat.
+func DetectBootTime() time.Time {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return time.Time{}
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "btime" {
+			secs, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return time.Time{}
+			}
+			return time.Unix(secs, 0)
+		}
+	}
+	return time.Time{}
+}
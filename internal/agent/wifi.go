@@ -0,0 +1,400 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	nmConnectionsDir = "/etc/NetworkManager/system-connections"
+	// nmConnectionPrefix marks the profiles wifi_profile owns, so a push
+	// removes the ones it no longer lists and leaves the rest alone.
+	nmConnectionPrefix = "openrobot-wifi-"
+	netplanWifiPath    = "/etc/netplan/60-openrobot-wifi.yaml"
+	// wifiRollbackAfter is how long a netplan change gets to bring the
+	// broker back before the previous file is restored.
+	wifiRollbackAfter = 60 * time.Second
+	maxWifiNetworks   = 16
+	maxWifiPriority   = 999
+	maxEAPField       = 128
+)
+
+var (
+	wifiInterface = regexp.MustCompile(`^[a-z][a-z0-9]{0,14}$`)
+	wifiPSKHex    = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+)
+
+// WifiNetwork is one network a robot may join. When several are in range
+// the one with the highest Priority is preferred.
+type WifiNetwork struct {
+	SSID string `json:"ssid"`
+	// Password is the WPA passphrase, or the 64 hex digit key; empty for an
+	// open network.
+	Password string `json:"password,omitempty"`
+	Priority int    `json:"priority,omitempty"`
+	// Hidden networks don't broadcast their SSID, so they are probed for.
+	Hidden bool `json:"hidden,omitempty"`
+	// Band limits the network to "2.4GHz" or "5GHz"; empty allows both.
+	Band string `json:"band,omitempty"`
+	// EAP is "peap" or "ttls" for a WPA2-Enterprise network, which is
+	// joined as Identity with Password (MSCHAPv2 inside the tunnel).
+	EAP      string `json:"eap,omitempty"`
+	Identity string `json:"identity,omitempty"`
+	// AnonymousIdentity is the outer identity sent before the tunnel is up,
+	// such as anonymous@example.edu; empty sends Identity.
+	AnonymousIdentity string `json:"anonymous_identity,omitempty"`
+}
+
+// networks lists the networks to configure: Networks, or the single SSID of
+// older requests. Highest priority comes first.
+func (d WifiProfileData) networks() []WifiNetwork {
+	nets := append([]WifiNetwork(nil), d.Networks...)
+	if len(nets) == 0 && d.SSID != "" {
+		nets = []WifiNetwork{{SSID: d.SSID, Password: d.Password}}
+	}
+	sort.SliceStable(nets, func(i, j int) bool { return nets[i].Priority > nets[j].Priority })
+	return nets
+}
+
+// ValidateWifiNetworks checks networks before they are rendered into a
+// robot's network configuration.
+func ValidateWifiNetworks(nets []WifiNetwork) error {
+	if len(nets) == 0 {
+		return errors.New("at least one network is required")
+	}
+	if len(nets) > maxWifiNetworks {
+		return fmt.Errorf("at most %d networks", maxWifiNetworks)
+	}
+	seen := make(map[string]bool, len(nets))
+	for _, n := range nets {
+		if n.SSID == "" || len(n.SSID) > 32 {
+			return fmt.Errorf("SSID %q must be 1 to 32 bytes", n.SSID)
+		}
+		if strings.IndexFunc(n.SSID, unicode.IsControl) >= 0 {
+			return fmt.Errorf("SSID %q has control characters", n.SSID)
+		}
+		if seen[n.SSID] {
+			return fmt.Errorf("SSID %q is listed twice", n.SSID)
+		}
+		seen[n.SSID] = true
+		if n.EAP != "" {
+			if err := validateEAP(n); err != nil {
+				return err
+			}
+		} else if n.Identity != "" || n.AnonymousIdentity != "" {
+			return fmt.Errorf("identity for %q needs an EAP method", n.SSID)
+		} else if n.Password != "" && !wifiPSKHex.MatchString(n.Password) {
+			if len(n.Password) < 8 || len(n.Password) > 63 {
+				return fmt.Errorf("password for %q must be 8 to 63 characters", n.SSID)
+			}
+			for _, r := range n.Password {
+				if r < 0x20 || r > 0x7e {
+					return fmt.Errorf("password for %q must be printable ASCII", n.SSID)
+				}
+			}
+		}
+		if n.Priority < 0 || n.Priority > maxWifiPriority {
+			return fmt.Errorf("priority for %q must be 0 to %d", n.SSID, maxWifiPriority)
+		}
+		switch n.Band {
+		case "", "2.4GHz", "5GHz":
+		default:
+			return fmt.Errorf("band for %q must be 2.4GHz or 5GHz", n.SSID)
+		}
+	}
+	return nil
+}
+
+// validateEAP checks the sign-in of a WPA2-Enterprise network.
+func validateEAP(n WifiNetwork) error {
+	switch n.EAP {
+	case "peap", "ttls":
+	default:
+		return fmt.Errorf("EAP method for %q must be peap or ttls", n.SSID)
+	}
+	if n.Identity == "" {
+		return fmt.Errorf("identity for %q is required", n.SSID)
+	}
+	if n.Password == "" {
+		return fmt.Errorf("password for %q is required", n.SSID)
+	}
+	for _, f := range []struct{ name, v string }{
+		{"identity", n.Identity},
+		{"anonymous identity", n.AnonymousIdentity},
+		{"password", n.Password},
+	} {
+		if len(f.v) > maxEAPField {
+			return fmt.Errorf("%s for %q must be at most %d bytes", f.name, n.SSID, maxEAPField)
+		}
+		if strings.IndexFunc(f.v, unicode.IsControl) >= 0 {
+			return fmt.Errorf("%s for %q has control characters", f.name, n.SSID)
+		}
+	}
+	return nil
+}
+
+// HandleWifiProfile configures the networks the robot roams between. With
+// NetworkManager each gets a profile with its priority; otherwise they are
+// written to a netplan file, which is rolled back if the robot then can't
+// reach the broker.
+func HandleWifiProfile(cfg Config, data WifiProfileData) error {
+	nets := data.networks()
+	if err := ValidateWifiNetworks(nets); err != nil {
+		return err
+	}
+	iface := data.Interface
+	if iface == "" {
+		iface = "wlan0"
+	}
+	if !wifiInterface.MatchString(iface) {
+		return fmt.Errorf("invalid interface %q", iface)
+	}
+	if networkManagerActive() {
+		return applyNMWifi(nets)
+	}
+	return applyNetplanWifi(cfg, iface, nets)
+}
+
+func networkManagerActive() bool {
+	if _, err := exec.LookPath("nmcli"); err != nil {
+		return false
+	}
+	return exec.Command("systemctl", "is-active", "--quiet", "NetworkManager").Run() == nil
+}
+
+// applyNMWifi writes a NetworkManager profile per network, replacing those
+// an earlier push wrote. Connections that are up stay up; the new settings
+// apply the next time NetworkManager picks a network.
+func applyNMWifi(nets []WifiNetwork) error {
+	keep := make(map[string]bool, len(nets))
+	for _, n := range nets {
+		name := nmConnectionFile(n.SSID)
+		keep[name] = true
+		path := filepath.Join(nmConnectionsDir, name)
+		if err := os.WriteFile(path, nmKeyfile(n), 0o600); err != nil {
+			return fmt.Errorf("write %s: %w", path, err)
+		}
+	}
+	old, _ := filepath.Glob(filepath.Join(nmConnectionsDir, nmConnectionPrefix+"*.nmconnection"))
+	for _, path := range old {
+		if !keep[filepath.Base(path)] {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+	if output, err := exec.Command("nmcli", "connection", "reload").CombinedOutput(); err != nil {
+		return fmt.Errorf("nmcli connection reload failed: %w: %s", err, tail(output))
+	}
+	slog.Info("wifi networks configured", "networks", len(nets), "backend", "NetworkManager")
+	return nil
+}
+
+// NMConnection returns the file name and NetworkManager keyfile the agent
+// writes for n, for installers that set networks up ahead of it.
+func NMConnection(n WifiNetwork) (string, []byte) {
+	return nmConnectionFile(n.SSID), nmKeyfile(n)
+}
+
+// nmConnectionFile names a network's profile after a hash of its SSID,
+// which may hold characters unfit for a file name.
+func nmConnectionFile(ssid string) string {
+	sum := sha1.Sum([]byte(ssid))
+	return nmConnectionPrefix + hex.EncodeToString(sum[:4]) + ".nmconnection"
+}
+
+// nmKeyfile renders n as a NetworkManager keyfile. A WPA passphrase is
+// stored as the derived key.
+func nmKeyfile(n WifiNetwork) []byte {
+	sum := sha1.Sum([]byte("openrobot-wifi:" + n.SSID))
+	uuid := hex.EncodeToString(sum[:16])
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "[connection]\nid=%s\nuuid=%s-%s-%s-%s-%s\ntype=wifi\nautoconnect-priority=%d\n\n",
+		keyfileEscape("openrobot "+n.SSID), uuid[:8], uuid[8:12], uuid[12:16], uuid[16:20], uuid[20:], n.Priority)
+	fmt.Fprintf(&b, "[wifi]\nmode=infrastructure\nssid=%s\n", keyfileEscape(n.SSID))
+	if n.Hidden {
+		b.WriteString("hidden=true\n")
+	}
+	switch n.Band {
+	case "2.4GHz":
+		b.WriteString("band=bg\n")
+	case "5GHz":
+		b.WriteString("band=a\n")
+	}
+	switch {
+	case n.EAP != "":
+		fmt.Fprintf(&b, "\n[wifi-security]\nkey-mgmt=wpa-eap\n\n[802-1x]\neap=%s;\nidentity=%s\n", n.EAP, keyfileEscape(n.Identity))
+		if n.AnonymousIdentity != "" {
+			fmt.Fprintf(&b, "anonymous-identity=%s\n", keyfileEscape(n.AnonymousIdentity))
+		}
+		fmt.Fprintf(&b, "password=%s\nphase2-auth=mschapv2\n", keyfileEscape(n.Password))
+	case n.Password != "":
+		fmt.Fprintf(&b, "\n[wifi-security]\nkey-mgmt=wpa-psk\npsk=%s\n", wpaPSK(n.SSID, n.Password))
+	}
+	b.WriteString("\n[ipv4]\nmethod=auto\n\n[ipv6]\nmethod=auto\n")
+	return b.Bytes()
+}
+
+// keyfileEscape escapes s as a keyfile value, which would otherwise lose
+// leading spaces and read backslashes as escapes.
+func keyfileEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	if strings.HasPrefix(s, " ") {
+		s = `\s` + s[1:]
+	}
+	return s
+}
+
+// wpaPSK is the 256-bit WPA key for a passphrase, or the key itself when
+// given in hex.
+func wpaPSK(ssid, password string) string {
+	if wifiPSKHex.MatchString(password) {
+		return strings.ToLower(password)
+	}
+	key, _ := pbkdf2.Key(sha1.New, password, []byte(ssid), 4096, 32)
+	return hex.EncodeToString(key)
+}
+
+type netplanAccessPoint struct {
+	Password string       `yaml:"password,omitempty"`
+	Auth     *netplanAuth `yaml:"auth,omitempty"`
+	Hidden   bool         `yaml:"hidden,omitempty"`
+	Band     string       `yaml:"band,omitempty"`
+}
+
+// netplanAuth is the WPA2-Enterprise sign-in of an access point.
+type netplanAuth struct {
+	KeyManagement     string `yaml:"key-management"`
+	Method            string `yaml:"method"`
+	Identity          string `yaml:"identity"`
+	AnonymousIdentity string `yaml:"anonymous-identity,omitempty"`
+	Password          string `yaml:"password"`
+	Phase2Auth        string `yaml:"phase2-auth"`
+}
+
+// NetplanAccessPoints renders nets as the access-points of a netplan wifi
+// device. netplan's networkd backend has no notion of priority, so there the
+// strongest network in range is joined.
+func NetplanAccessPoints(nets []WifiNetwork) ([]byte, error) {
+	return yaml.Marshal(netplanAccessPoints(nets))
+}
+
+func netplanAccessPoints(nets []WifiNetwork) map[string]netplanAccessPoint {
+	aps := make(map[string]netplanAccessPoint, len(nets))
+	for _, n := range nets {
+		ap := netplanAccessPoint{Hidden: n.Hidden, Band: n.Band}
+		if n.EAP != "" {
+			ap.Auth = &netplanAuth{
+				KeyManagement:     "eap",
+				Method:            n.EAP,
+				Identity:          n.Identity,
+				AnonymousIdentity: n.AnonymousIdentity,
+				Password:          n.Password,
+				Phase2Auth:        "MSCHAPV2",
+			}
+		} else {
+			ap.Password = n.Password
+		}
+		aps[n.SSID] = ap
+	}
+	return aps
+}
+
+// applyNetplanWifi writes nets to their own netplan file, which netplan
+// merges with the image's, and applies it.
+func applyNetplanWifi(cfg Config, iface string, nets []WifiNetwork) error {
+	doc := map[string]any{
+		"network": map[string]any{
+			"version": 2,
+			"wifis": map[string]any{
+				iface: map[string]any{
+					"dhcp4":         true,
+					"optional":      true,
+					"access-points": netplanAccessPoints(nets),
+				},
+			},
+		},
+	}
+	raw, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	previous, err := os.ReadFile(netplanWifiPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	restore := func() {
+		if previous == nil {
+			os.Remove(netplanWifiPath)
+		} else {
+			os.WriteFile(netplanWifiPath, previous, 0o600)
+		}
+		if output, err := exec.Command("netplan", "apply").CombinedOutput(); err != nil {
+			slog.Error("cannot restore wifi configuration", "err", err, "output", tail(output))
+		}
+	}
+	if err := os.WriteFile(netplanWifiPath, raw, 0o600); err != nil {
+		return fmt.Errorf("write %s: %w", netplanWifiPath, err)
+	}
+	if output, err := exec.Command("netplan", "generate").CombinedOutput(); err != nil {
+		restore()
+		return fmt.Errorf("netplan generate failed: %w: %s", err, tail(output))
+	}
+	if output, err := exec.Command("netplan", "apply").CombinedOutput(); err != nil {
+		restore()
+		return fmt.Errorf("netplan apply failed: %w: %s", err, tail(output))
+	}
+	if !waitForBroker(cfg.MQTTBroker, wifiRollbackAfter) {
+		restore()
+		return fmt.Errorf("broker unreachable %s after applying the networks; restored the previous configuration", wifiRollbackAfter)
+	}
+	slog.Info("wifi networks configured", "networks", len(nets), "backend", "netplan", "interface", iface)
+	return nil
+}
+
+// waitForBroker reports whether the MQTT broker accepts a connection within
+// timeout.
+func waitForBroker(broker string, timeout time.Duration) bool {
+	addr := broker
+	if u, err := url.Parse(broker); err == nil && u.Host != "" {
+		addr = u.Host
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "1883")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for {
+		var d net.Dialer
+		dctx, dcancel := context.WithTimeout(ctx, 5*time.Second)
+		conn, err := d.DialContext(dctx, "tcp", addr)
+		dcancel()
+		if err == nil {
+			conn.Close()
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// workspaceStatePath remembers where the last update_repo cloned to, so the
+// checkout can be inspected later without the controller naming it again.
+const workspaceStatePath = "/var/lib/openrobotfleet-agent/workspace.json"
+
+// workspaceCheckInterval is how often the checkout is re-read for the
+// heartbeat. A new update_repo is picked up straight away.
+const workspaceCheckInterval = 5 * time.Minute
+
+// Workspace is the state of the checkout the last update_repo made, reported
+// in heartbeats so the controller can spot robots that drifted from their
+// scenario. Path is empty when update_repo has never run.
+type Workspace struct {
+	Path   string `json:"path"`
+	Repo   string `json:"repo,omitempty"`
+	Branch string `json:"branch,omitempty"`
+	Commit string `json:"commit,omitempty"`
+	// Tag is the tag update_repo pinned the checkout to, while HEAD is
+	// still there.
+	Tag string `json:"tag,omitempty"`
+	// Dirty is set when tracked files have uncommitted changes.
+	Dirty bool `json:"dirty,omitempty"`
+	// Missing is set when the checkout is gone or no longer a git repo.
+	Missing bool `json:"missing,omitempty"`
+}
+
+// savedWorkspace is what recordWorkspace stores.
+type savedWorkspace struct {
+	Path string `json:"path"`
+	Tag  string `json:"tag,omitempty"`
+}
+
+// recordWorkspace saves target, and the tag it was pinned to, as the
+// checkout to report.
+func recordWorkspace(target, tag string) {
+	raw, _ := json.Marshal(savedWorkspace{Path: target, Tag: tag})
+	err := os.MkdirAll(filepath.Dir(workspaceStatePath), 0o700)
+	if err == nil {
+		err = os.WriteFile(workspaceStatePath, raw, configFileMode)
+	}
+	if err != nil {
+		slog.Warn("cannot record workspace", "path", target, "err", err)
+	}
+}
+
+// workspaceWatch caches the inspected checkout between heartbeats.
+type workspaceWatch struct {
+	state     Workspace
+	checkedAt time.Time
+	// recorded is the modification time of the state file when last read.
+	recorded time.Time
+}
+
+// current returns the checkout's state, re-reading it when it is stale or a
+// new update_repo has recorded a checkout.
+func (w *workspaceWatch) current(cfg Config) Workspace {
+	info, err := os.Stat(workspaceStatePath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("cannot read workspace state", "err", err)
+		}
+		return Workspace{}
+	}
+	if info.ModTime().Equal(w.recorded) && time.Since(w.checkedAt) < workspaceCheckInterval {
+		return w.state
+	}
+	raw, err := os.ReadFile(workspaceStatePath)
+	var saved savedWorkspace
+	if err == nil {
+		err = json.Unmarshal(raw, &saved)
+	}
+	if err != nil {
+		slog.Warn("cannot read workspace state", "err", err)
+		return Workspace{}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	w.state = inspectWorkspace(ctx, cfg, saved.Path, saved.Tag)
+	w.checkedAt = time.Now()
+	w.recorded = info.ModTime()
+	return w.state
+}
+
+// inspectWorkspace reads the origin URL, branch, HEAD commit, whether HEAD is
+// still at tag and whether tracked files changed, in the ROS container when
+// there is one.
+func inspectWorkspace(ctx context.Context, cfg Config, path, tag string) Workspace {
+	ws := Workspace{Path: path}
+	git := func(args ...string) (string, error) {
+		// The checkout belongs to the workspace owner, not root, which git
+		// otherwise refuses to read.
+		full := append([]string{"git", "-c", "safe.directory=*", "-C", path}, args...)
+		out, err := cfg.command(ctx, full...).Output()
+		if err != nil {
+			return "", fmt.Errorf("git %s: %w", args[0], err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	var err error
+	if ws.Commit, err = git("rev-parse", "HEAD"); err != nil {
+		ws.Missing = true
+		return ws
+	}
+	ws.Branch, _ = git("rev-parse", "--abbrev-ref", "HEAD")
+	ws.Repo, _ = git("remote", "get-url", "origin")
+	if tag != "" {
+		if tagged, err := git("rev-parse", "refs/tags/"+tag+"^{commit}"); err == nil && tagged == ws.Commit {
+			ws.Tag = tag
+		}
+	}
+	if status, err := git("status", "--porcelain", "--untracked-files=no"); err == nil {
+		ws.Dirty = status != ""
+	}
+	return ws
+}
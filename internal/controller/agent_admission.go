@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// Any MQTT client can publish a heartbeat, and a heartbeat from an agent the
+// controller doesn't know creates a robot. With AGENT_ENROLLMENT=verified,
+// only an agent holding an enrollment token the controller signed gets one;
+// any other is held in a pending list until an operator approves it. With
+// AGENT_ENROLLMENT=approval every new agent is. Golden images and laptop
+// autoinstall files carry a token, and one can be issued for installing an
+// agent by hand.
+
+const enrollmentKeySetting = "enrollment_signing_key"
+
+// maxEnrollmentTokenTTL caps how long an issued token may be good for.
+const maxEnrollmentTokenTTL = 365 * 24 * time.Hour
+
+// imageEnrollmentTTL is how long the token baked into a golden image or
+// laptop autoinstall file lets new agents in: IMAGE_ENROLLMENT_TTL_DAYS, 14
+// by default. Images are downloaded without login, so anyone who fetches one
+// holds its token; once it expires, robots flashed from the image wait for
+// approval until the image is refreshed or rebuilt.
+func imageEnrollmentTTL() time.Duration {
+	days := 14
+	if v, err := strconv.Atoi(os.Getenv("IMAGE_ENROLLMENT_TTL_DAYS")); err == nil && v > 0 {
+		days = v
+	}
+	return min(time.Duration(days)*24*time.Hour, maxEnrollmentTokenTTL)
+}
+
+// agentEnrollment is how new agents are let in: "open" on their first
+// heartbeat, "verified" with an enrollment token, or "approval" only once
+// an operator approves them.
+func agentEnrollment() string {
+	switch mode := os.Getenv("AGENT_ENROLLMENT"); mode {
+	case "verified", "approval":
+		return mode
+	}
+	return "open"
+}
+
+// enrollmentKey returns the key enrollment tokens are signed with, creating
+// it the first time it is needed.
+func (c *Controller) enrollmentKey(ctx context.Context) ([]byte, error) {
+	key, err := c.DB.GetSecretSetting(ctx, enrollmentKeySetting)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		if key, err = c.rotateEnrollmentKey(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return hex.DecodeString(key)
+}
+
+func (c *Controller) rotateEnrollmentKey(ctx context.Context) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	key := hex.EncodeToString(buf)
+	return key, c.DB.SaveSecretSetting(ctx, enrollmentKeySetting, key)
+}
+
+// issueEnrollmentToken signs a token labelled label, good for ttl or, if it
+// is 0, until the key is rotated.
+func (c *Controller) issueEnrollmentToken(ctx context.Context, label string, ttl time.Duration) (string, agent.EnrollmentClaims, error) {
+	claims := agent.EnrollmentClaims{Label: label, IssuedAt: time.Now().Unix()}
+	if ttl > 0 {
+		claims.ExpiresAt = time.Now().Add(ttl).Unix()
+	}
+	key, err := c.enrollmentKey(ctx)
+	if err != nil {
+		return "", claims, err
+	}
+	token, err := agent.SignEnrollmentToken(key, claims)
+	return token, claims, err
+}
+
+// AdmitAgent decides whether the heartbeat of an agent that has no robot
+// yet creates one. In verified mode an agent without a valid enrollment
+// token, and in approval mode any agent, is put on the pending list
+// instead; either way the robot limit applies.
+func (c *Controller) AdmitAgent(ctx context.Context, agentID, name, ip, rType string, proof *agent.EnrollmentProof) bool {
+	if reason := c.enrollmentRefusal(ctx, agentID, proof); reason != "" {
+		c.holdAgent(ctx, db.PendingAgent{AgentID: agentID, Name: name, IP: ip, Type: rType, Reason: reason})
+		return false
+	}
+	if !c.AllowEnrollment(ctx, agentID) {
+		return false
+	}
+	if agentEnrollment() != "open" {
+		if err := c.DB.DeletePendingAgent(ctx, agentID); err != nil {
+			slog.Error("admit agent: clear pending", "agent_id", agentID, "err", err)
+		}
+	}
+	return true
+}
+
+// EnrollmentVerified reports whether an agent may take over a robot added
+// by hand: in verified mode only with a valid enrollment token, and in
+// approval mode not without approval, since the IP it is matched by is
+// whatever the agent reports.
+func (c *Controller) EnrollmentVerified(ctx context.Context, agentID string, proof *agent.EnrollmentProof) bool {
+	return c.enrollmentRefusal(ctx, agentID, proof) == ""
+}
+
+// enrollmentRefusal returns why agentID isn't let in, or "" if it is.
+func (c *Controller) enrollmentRefusal(ctx context.Context, agentID string, proof *agent.EnrollmentProof) string {
+	switch agentEnrollment() {
+	case "open":
+		return ""
+	case "approval":
+		return "new agents need approval"
+	}
+	if proof == nil {
+		return "no enrollment token"
+	}
+	key, err := c.enrollmentKey(ctx)
+	if err != nil {
+		slog.Error("admit agent: load enrollment key", "err", err)
+		return "enrollment key unavailable"
+	}
+	if _, err := agent.VerifyEnrollmentProof(key, *proof, agentID, time.Now()); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+type enrollmentTokenRequest struct {
+	Label string `json:"label"`
+	// TTLHours is how long the token lets agents in; 0 for until the key
+	// is rotated.
+	TTLHours int `json:"ttl_hours,omitempty"`
+}
+
+type enrollmentTokenResponse struct {
+	Token     string     `json:"token"`
+	Label     string     `json:"label,omitempty"`
+	IssuedAt  time.Time  `json:"issued_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreateEnrollmentToken issues a token to put in an agent's config as
+// enrollment_token, e.g. when installing one by hand.
+func (c *Controller) CreateEnrollmentToken(w http.ResponseWriter, r *http.Request) {
+	var req enrollmentTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	ttl := time.Duration(req.TTLHours) * time.Hour
+	if req.TTLHours < 0 || ttl > maxEnrollmentTokenTTL {
+		respondError(w, http.StatusBadRequest, "ttl_hours must be between 0 and 8760")
+		return
+	}
+	req.Label = strings.TrimSpace(req.Label)
+	token, claims, err := c.issueEnrollmentToken(r.Context(), req.Label, ttl)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("issue enrollment token", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to issue enrollment token")
+		return
+	}
+	resp := enrollmentTokenResponse{Token: token, Label: claims.Label, IssuedAt: time.Unix(claims.IssuedAt, 0).UTC()}
+	if claims.ExpiresAt != 0 {
+		exp := time.Unix(claims.ExpiresAt, 0).UTC()
+		resp.ExpiresAt = &exp
+	}
+	c.audit(r.Context(), "enrollment.issue_token", req.Label, fmt.Sprintf("ttl %dh", req.TTLHours))
+	respondJSON(w, http.StatusCreated, resp)
+}
+
+// RotateEnrollmentKey replaces the key tokens are signed with, so that no
+// token issued so far lets an agent in. Robots already in the fleet stay.
+func (c *Controller) RotateEnrollmentKey(w http.ResponseWriter, r *http.Request) {
+	if _, err := c.rotateEnrollmentKey(r.Context()); err != nil {
+		logging.FromContext(r.Context()).Error("rotate enrollment key", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to rotate enrollment key")
+		return
+	}
+	c.audit(r.Context(), "enrollment.rotate_key", "", "")
+	respondJSON(w, http.StatusOK, map[string]string{"status": "rotated"})
+}
@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"debug/buildinfo"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AgentBinary describes one cross-compiled agent build available for
+// download or install.
+type AgentBinary struct {
+	Arch      string    `json:"arch"`
+	Filename  string    `json:"filename"`
+	Version   string    `json:"version"`
+	BuildDate time.Time `json:"build_date"`
+	GoVersion string    `json:"go_version,omitempty"`
+	SHA256    string    `json:"sha256"`
+	Size      int64     `json:"size"`
+}
+
+// cachedAgentBinary avoids re-hashing binaries on every request; entries are
+// invalidated when the file's size or mtime changes.
+type cachedAgentBinary struct {
+	modTime time.Time
+	size    int64
+	binary  AgentBinary
+}
+
+var (
+	agentBinaryCacheMu sync.Mutex
+	agentBinaryCache   = map[string]cachedAgentBinary{}
+)
+
+// agentBinaryDir is the binary registry: agent-<arch> files built by the
+// controller image.
+func agentBinaryDir() string {
+	if v := os.Getenv("AGENT_BINARY_DIR"); v != "" {
+		return v
+	}
+	return "/app"
+}
+
+// normalizeArch maps uname -m style names onto GOARCH names.
+func normalizeArch(arch string) string {
+	switch strings.ToLower(strings.TrimSpace(arch)) {
+	case "aarch64", "arm64":
+		return "arm64"
+	case "x86_64", "amd64":
+		return "amd64"
+	case "armv7l", "armv6l", "arm":
+		return "arm"
+	}
+	return strings.ToLower(strings.TrimSpace(arch))
+}
+
+func agentBinaryPath(arch string) string {
+	return filepath.Join(agentBinaryDir(), "agent-"+normalizeArch(arch))
+}
+
+// readAgentBinary loads the agent build for arch from the registry.
+func readAgentBinary(arch string) ([]byte, error) {
+	return os.ReadFile(agentBinaryPath(arch))
+}
+
+// listAgentBinaries returns metadata for every agent-<arch> in the registry.
+func listAgentBinaries() ([]AgentBinary, error) {
+	matches, err := filepath.Glob(filepath.Join(agentBinaryDir(), "agent-*"))
+	if err != nil {
+		return nil, err
+	}
+	binaries := []AgentBinary{}
+	for _, path := range matches {
+		if filepath.Ext(path) != "" {
+			continue
+		}
+		b, err := describeAgentBinary(path)
+		if err != nil {
+			continue
+		}
+		binaries = append(binaries, b)
+	}
+	sort.Slice(binaries, func(i, j int) bool { return binaries[i].Arch < binaries[j].Arch })
+	return binaries, nil
+}
+
+func describeAgentBinary(path string) (AgentBinary, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return AgentBinary{}, err
+	}
+	if info.IsDir() {
+		return AgentBinary{}, fmt.Errorf("%s is a directory", path)
+	}
+
+	agentBinaryCacheMu.Lock()
+	cached, ok := agentBinaryCache[path]
+	agentBinaryCacheMu.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.binary, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return AgentBinary{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return AgentBinary{}, err
+	}
+
+	b := AgentBinary{
+		Arch:      strings.TrimPrefix(filepath.Base(path), "agent-"),
+		Filename:  filepath.Base(path),
+		Version:   "unknown",
+		BuildDate: info.ModTime().UTC(),
+		SHA256:    hex.EncodeToString(h.Sum(nil)),
+		Size:      info.Size(),
+	}
+	if bi, err := buildinfo.ReadFile(path); err == nil {
+		b.GoVersion = bi.GoVersion
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "GOARCH":
+				b.Arch = s.Value
+			case "-ldflags":
+				// Release builds stamp -X main.version=... -X main.buildDate=...
+				if v := ldflagValue(s.Value, "main.version"); v != "" {
+					b.Version = v
+				}
+				if v := ldflagValue(s.Value, "main.buildDate"); v != "" {
+					if t, err := time.Parse(time.RFC3339, v); err == nil {
+						b.BuildDate = t.UTC()
+					}
+				}
+			case "vcs.revision":
+				if b.Version == "unknown" && len(s.Value) >= 12 {
+					b.Version = s.Value[:12]
+				}
+			}
+		}
+		if v := bi.Main.Version; v != "" && v != "(devel)" && b.Version == "unknown" {
+			b.Version = v
+		}
+	}
+
+	agentBinaryCacheMu.Lock()
+	agentBinaryCache[path] = cachedAgentBinary{modTime: info.ModTime(), size: info.Size(), binary: b}
+	agentBinaryCacheMu.Unlock()
+	return b, nil
+}
+
+// ldflagValue extracts the value of -X name=value from an ldflags string.
+func ldflagValue(ldflags, name string) string {
+	fields := strings.Fields(ldflags)
+	for i, f := range fields {
+		f = strings.Trim(f, `"'`)
+		if f == "-X" && i+1 < len(fields) {
+			f = strings.Trim(fields[i+1], `"'`)
+		} else {
+			f = strings.TrimPrefix(f, "-X=")
+		}
+		if v, ok := strings.CutPrefix(f, name+"="); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+func (c *Controller) AgentInfo(w http.ResponseWriter, r *http.Request) {
+	binaries, err := listAgentBinaries()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to read agent binaries")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"binaries": binaries})
+}
+
+func (c *Controller) DownloadAgentBinary(w http.ResponseWriter, r *http.Request) {
+	arch := r.URL.Query().Get("arch")
+	if arch == "" {
+		// Older clients don't send an arch; robots are Raspberry Pis
+		arch = "arm64"
+	}
+	if strings.ContainsAny(arch, `/\.`) {
+		respondError(w, http.StatusBadRequest, "invalid arch")
+		return
+	}
+	path := agentBinaryPath(arch)
+	b, err := describeAgentBinary(path)
+	if err != nil {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("no agent binary for arch %q", arch))
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", b.Filename))
+	w.Header().Set("X-Agent-Version", b.Version)
+	w.Header().Set("X-Checksum-SHA256", b.SHA256)
+	http.ServeFile(w, r, path)
+}
@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/scenario"
+)
+
+// APIModels exposes the request and response bodies the handlers decode and
+// encode so the HTTP layer can describe them in the OpenAPI document without
+// exporting the types themselves. Only the dynamic types of the values matter.
+var APIModels = struct {
+	CommandRequest          interface{}
+	SelectorCommandRequest  interface{}
+	SelectorCommandResponse interface{}
+	TagsRequest             interface{}
+	NameRequest             interface{}
+	RobotPatchRequest       interface{}
+	CreateRobotRequest      interface{}
+	RepoAuthRequest         interface{}
+	InstallConfigRequest    interface{}
+	InstallAgentRequest     interface{}
+	InstallDefaultsRequest  interface{}
+	InstallDefaults         interface{}
+	OnboardingDefaults      interface{}
+	BatteryPolicy           interface{}
+	InstallConfigEnvelope   interface{}
+	ScenarioRequest         interface{}
+	ApplyScenarioRequest    interface{}
+	ApplyScenarioResponse   interface{}
+	ScenarioBundle          interface{}
+	ScenarioImportRequest   interface{}
+	ScenarioImportResponse  interface{}
+	GitHookResponse         interface{}
+	FleetApplyRequest       interface{}
+	FleetApplyResponse      interface{}
+	FleetEStopRequest       interface{}
+	FleetEStop              interface{}
+	HelpTopics              interface{}
+	HelpTopic               interface{}
+	HelpTopicRequest        interface{}
+	SnapshotScheduleRequest interface{}
+	SnapshotRun             interface{}
+	RobotSnapshots          interface{}
+	RobotSnapshot           interface{}
+	BagStartRequest         interface{}
+	BagStartResponse        interface{}
+	SemesterRequest         interface{}
+	SemesterStatus          interface{}
+	SemesterPreflight       interface{}
+	SemesterTemplate        interface{}
+	SemesterTemplates       interface{}
+	SemesterTemplateRequest interface{}
+	SemesterBatches         interface{}
+	SemesterBatch           interface{}
+	SpeedTestRequest        interface{}
+	SpeedTestResult         interface{}
+	SensorSnapshotRequest   interface{}
+	SensorSnapshot          interface{}
+	TeleopRequest           interface{}
+	TeleopResponse          interface{}
+	HostKey                 interface{}
+	SSHKeygenRequest        interface{}
+	SSHKeygenResponse       interface{}
+	FormationTestRequest    interface{}
+	NavGoalRequest          interface{}
+	MissionRequest          interface{}
+	MissionRunRequest       interface{}
+	FormationTest           interface{}
+	WeeklyReport            interface{}
+	UsageReport             interface{}
+	TelemetrySeries         interface{}
+	FleetSummary            interface{}
+	FleetPositions          interface{}
+	SendReportRequest       interface{}
+	SendReportResponse      interface{}
+	RecoveryAgents          interface{}
+	RecoveryConfigRequest   interface{}
+	EnrollRequest           interface{}
+	EnrollResponse          interface{}
+	EnrollmentSlotRequest   interface{}
+	EnrollmentTokenRequest  interface{}
+	EnrollmentToken         interface{}
+	ApproveAgentRequest     interface{}
+	ProvisioningToken       interface{}
+	BuildStatus             interface{}
+	ImageProfile            interface{}
+	ImageProfiles           interface{}
+	ImageProfileRequest     interface{}
+	FlashDeviceRequest      interface{}
+	FlashDeviceResponse     interface{}
+	BuildQueued             interface{}
+	ImageBuild              interface{}
+	ImageBuilds             interface{}
+	ImagerOSList            interface{}
+	ImageStorage            interface{}
+	PruneImagesResponse     interface{}
+	AgentBinaries           interface{}
+	StatusMessage           interface{}
+	IdentifyAssignments     interface{}
+}{
+	CommandRequest:          commandRequest{},
+	SelectorCommandRequest:  selectorCommandRequest{},
+	SelectorCommandResponse: selectorCommandResponse{},
+	TagsRequest:             tagsRequest{},
+	NameRequest:             nameRequest{},
+	RobotPatchRequest:       robotPatchRequest{},
+	CreateRobotRequest:      createRobotRequest{},
+	RepoAuthRequest:         repoAuthRequest{},
+	InstallConfigRequest:    installConfigRequest{},
+	InstallAgentRequest:     installAgentRequest{},
+	InstallDefaultsRequest:  installDefaultsRequest{},
+	InstallDefaults:         installDefaultsResponse{},
+	OnboardingDefaults:      onboardingDefaultsRequest{},
+	BatteryPolicy:           batteryPolicy{},
+	InstallConfigEnvelope:   map[string]*db.InstallConfig{},
+	ScenarioRequest:         scenarioRequest{},
+	ApplyScenarioRequest:    applyScenarioRequest{},
+	ApplyScenarioResponse:   applyScenarioResponse{},
+	ScenarioBundle:          scenario.Bundle{},
+	ScenarioImportRequest:   scenarioImportRequest{},
+	ScenarioImportResponse:  scenarioImportResponse{},
+	GitHookResponse:         gitHookResponse{},
+	FleetApplyRequest:       fleetApplyRequest{},
+	FleetApplyResponse:      fleetApplyResponse{},
+	FleetEStopRequest:       fleetEStopRequest{},
+	FleetEStop:              fleetEStopResponse{},
+	HelpTopics:              []helpTopic{},
+	HelpTopic:               helpTopic{},
+	HelpTopicRequest:        helpTopicRequest{},
+	SnapshotScheduleRequest: snapshotScheduleRequest{},
+	SnapshotRun:             snapshotRunResponse{},
+	RobotSnapshots:          []robotSnapshot{},
+	RobotSnapshot:           robotSnapshot{},
+	BagStartRequest:         bagStartRequest{},
+	BagStartResponse:        bagStartResponse{},
+	SemesterRequest:         semesterRequest{},
+	SemesterStatus:          semesterStatusResponse{},
+	SemesterPreflight:       semesterPreflight{},
+	SemesterTemplate:        semesterTemplate{},
+	SemesterTemplates:       []semesterTemplate{},
+	SemesterTemplateRequest: semesterTemplateRequest{},
+	SemesterBatches:         []semesterBatchSummary{},
+	SemesterBatch:           semesterBatchDetail{},
+	SpeedTestRequest:        speedTestRequest{},
+	SensorSnapshotRequest:   sensorSnapshotRequest{},
+	SensorSnapshot:          sensorSnapshotResponse{},
+	TeleopRequest:           teleopRequest{},
+	TeleopResponse:          teleopResponse{},
+	HostKey:                 hostKeyResponse{},
+	SSHKeygenRequest:        sshKeygenRequest{},
+	SSHKeygenResponse:       sshKeygenResponse{},
+	NavGoalRequest:          navGoalRequest{},
+	MissionRequest:          missionRequest{},
+	MissionRunRequest:       missionRunRequest{},
+	FormationTestRequest:    formationTestRequest{},
+	FormationTest:           formationTest{},
+	WeeklyReport:            WeeklyReport{},
+	UsageReport:             UsageReport{},
+	TelemetrySeries:         TelemetrySeries{},
+	FleetSummary:            FleetSummary{},
+	FleetPositions:          fleetPositions{},
+	SendReportRequest:       sendReportRequest{},
+	SendReportResponse:      sendReportResponse{},
+	SpeedTestResult:         agent.SpeedTestResult{},
+	RecoveryAgents:          []recoveryAgent{},
+	RecoveryConfigRequest:   recoveryConfigRequest{},
+	EnrollRequest:           agent.EnrollRequest{},
+	EnrollResponse:          agent.EnrollResponse{},
+	EnrollmentSlotRequest:   enrollmentSlotRequest{},
+	EnrollmentTokenRequest:  enrollmentTokenRequest{},
+	EnrollmentToken:         enrollmentTokenResponse{},
+	ApproveAgentRequest:     approveAgentRequest{},
+	ProvisioningToken:       provisioningTokenResponse{},
+	BuildStatus:             buildStatusResponse{},
+	ImageProfile:            imageProfile{},
+	ImageProfiles:           []imageProfile{},
+	ImageProfileRequest:     imageProfileRequest{},
+	FlashDeviceRequest:      flashDeviceRequest{},
+	FlashDeviceResponse:     flashDeviceResponse{},
+	BuildQueued:             buildQueuedResponse{},
+	ImageBuild:              imageBuild{},
+	ImageBuilds:             []imageBuild{},
+	ImagerOSList:            imagerOSList{},
+	ImageStorage:            imageStorage{},
+	PruneImagesResponse:     pruneImagesResponse{},
+	AgentBinaries:           map[string][]AgentBinary{},
+	StatusMessage:           map[string]string{},
+	IdentifyAssignments:     map[int64]identifyAssignment{},
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// There is a single admin credential today, so every authenticated session
+// acts as this user. Once per-user accounts exist the actor comes from the
+// session instead.
+const adminActor = "admin"
+
+// OnBehalfOfHeader lets an admin issue commands for a student (demos, help
+// sessions) without sharing the admin login. Both identities are kept on the
+// job and in the audit log.
+const OnBehalfOfHeader = "X-On-Behalf-Of"
+
+var onBehalfOfPattern = regexp.MustCompile(`^[A-Za-z0-9._@-]{1,64}$`)
+
+type attribution struct {
+	actor      string
+	onBehalfOf string
+}
+
+type attributionKey struct{}
+
+// WithAttribution records the acting identity on the request context. It
+// returns false if the on-behalf-of header is malformed.
+func WithAttribution(r *http.Request) (*http.Request, bool) {
+	a := attribution{actor: adminActor}
+	if v := strings.TrimSpace(r.Header.Get(OnBehalfOfHeader)); v != "" {
+		if !onBehalfOfPattern.MatchString(v) {
+			return r, false
+		}
+		a.onBehalfOf = v
+	}
+	return r.WithContext(context.WithValue(r.Context(), attributionKey{}, a)), true
+}
+
+func attributionFrom(ctx context.Context) attribution {
+	if a, ok := ctx.Value(attributionKey{}).(attribution); ok {
+		return a
+	}
+	return attribution{}
+}
+
+// Actor returns the identities WithAttribution stored on ctx, or empty strings
+// for unauthenticated requests.
+func Actor(ctx context.Context) (actor, onBehalfOf string) {
+	a := attributionFrom(ctx)
+	return a.actor, a.onBehalfOf
+}
+
+// isAdmin reports whether the request acts as the admin itself rather than
+// on behalf of a student.
+func isAdmin(ctx context.Context) bool {
+	a := attributionFrom(ctx)
+	return a.actor == adminActor && a.onBehalfOf == ""
+}
+
+// attributeJob stamps the identities from ctx onto a job before it is stored.
+func attributeJob(ctx context.Context, job *db.Job) {
+	a := attributionFrom(ctx)
+	job.IssuedBy = a.actor
+	job.OnBehalfOf = a.onBehalfOf
+}
+
+// audit writes an audit event for the identities on ctx. Failures are logged
+// rather than failing the action that was already performed.
+func (c *Controller) audit(ctx context.Context, action, target, detail string) {
+	a := attributionFrom(ctx)
+	if a.actor == "" {
+		return
+	}
+	if a.onBehalfOf != "" {
+		logging.FromContext(ctx).Info("acting on behalf of user", "action", action, "target", target, "actor", a.actor, "on_behalf_of", a.onBehalfOf)
+	}
+	if err := c.DB.RecordAudit(ctx, db.AuditEvent{
+		Actor:      a.actor,
+		OnBehalfOf: a.onBehalfOf,
+		Action:     action,
+		Target:     target,
+		Detail:     detail,
+	}); err != nil {
+		logging.FromContext(ctx).Error("record audit event", "err", err)
+	}
+}
+
+func (c *Controller) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	events, err := c.DB.ListAuditEvents(r.Context(), 200)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list audit events", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to list audit events")
+		return
+	}
+	respondJSON(w, http.StatusOK, events)
+}
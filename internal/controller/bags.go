@@ -0,0 +1,470 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// ROS bags are recorded on the robots by bag_start and uploaded by the agent
+// when the recording ends, as a gzipped tar of the bag directory. They are
+// kept per robot under BAG_DIR, tagged with an experiment name so a class's
+// recordings can be pulled together for analysis.
+
+const (
+	defaultBagDurationSec = 60
+	defaultBagMaxMB       = 4096
+	maxExperimentLen      = 64
+	bagCheckInterval      = time.Minute
+	// bagUploadGrace is how long after its duration a bag may take to
+	// arrive before it counts as failed; the agent gives up uploading after
+	// as long.
+	bagUploadGrace = 30 * time.Minute
+)
+
+var rosTopic = regexp.MustCompile(`^/[A-Za-z_][A-Za-z0-9_/]*$`)
+
+type bagStartRequest struct {
+	RobotIDs   []int64 `json:"robot_ids"`
+	Selector   string  `json:"selector,omitempty"`
+	Experiment string  `json:"experiment,omitempty"`
+	// Topics to record; empty records every topic.
+	Topics []string `json:"topics,omitempty"`
+	// DurationSec stops the recording after this long (default 60, at most
+	// an hour). bag_stop can end it sooner.
+	DurationSec int `json:"duration_sec,omitempty"`
+}
+
+type bagStartResponse struct {
+	Bags []db.Bag `json:"bags"`
+	// Skipped names matched robots that have no agent to record on.
+	Skipped []string `json:"skipped"`
+}
+
+// bagDir is where uploaded bags are kept: BAG_DIR, or bags/ next to the
+// SQLite database.
+func (c *Controller) bagDir() string {
+	if dir := os.Getenv("BAG_DIR"); dir != "" {
+		return dir
+	}
+	if c.DB.Path != "" {
+		return filepath.Join(filepath.Dir(c.DB.Path), "bags")
+	}
+	return "bags"
+}
+
+func (c *Controller) bagFile(b db.Bag) string {
+	return filepath.Join(c.bagDir(), strconv.FormatInt(b.RobotID, 10), fmt.Sprintf("%d.tar.gz", b.ID))
+}
+
+func bagMaxBytes() int64 {
+	if v, err := strconv.Atoi(os.Getenv("BAG_MAX_MB")); err == nil && v > 0 {
+		return int64(v) << 20
+	}
+	return defaultBagMaxMB << 20
+}
+
+// StartBags starts recording a bag on each selected robot.
+func (c *Controller) StartBags(w http.ResponseWriter, r *http.Request) {
+	var req bagStartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid bag payload")
+		return
+	}
+	req.Experiment = strings.TrimSpace(req.Experiment)
+	if len(req.Experiment) > maxExperimentLen {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("experiment must be at most %d characters", maxExperimentLen))
+		return
+	}
+	for _, topic := range req.Topics {
+		if !rosTopic.MatchString(topic) {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid topic %q", topic))
+			return
+		}
+	}
+	if req.DurationSec == 0 {
+		req.DurationSec = defaultBagDurationSec
+	}
+	if maxSec := int(agent.MaxBagDuration.Seconds()); req.DurationSec < 0 || req.DurationSec > maxSec {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("duration_sec must be between 1 and %d", maxSec))
+		return
+	}
+	if msg := c.usageLimitReached(r.Context(), "storage"); msg != "" {
+		respondError(w, http.StatusForbidden, msg)
+		return
+	}
+	sel, err := parseSelector(req.Selector)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid selector: "+err.Error())
+		return
+	}
+	ids, err := c.mergeSelected(r.Context(), req.RobotIDs, sel)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("bag select robots", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to list robots")
+		return
+	}
+	if len(ids) == 0 {
+		respondError(w, http.StatusBadRequest, "robot_ids or a matching selector required")
+		return
+	}
+
+	// Every robot is looked up first, so a bad ID records nothing.
+	robots := make([]db.Robot, 0, len(ids))
+	for _, id := range ids {
+		robot, err := c.DB.GetRobotByID(r.Context(), id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				respondError(w, http.StatusNotFound, fmt.Sprintf("robot %d not found", id))
+				return
+			}
+			logging.FromContext(r.Context()).Error("bag fetch robot", "err", err)
+			respondError(w, http.StatusInternalServerError, "failed to fetch robot")
+			return
+		}
+		robots = append(robots, robot)
+	}
+
+	createdBy, _ := Actor(r.Context())
+	resp := bagStartResponse{Bags: []db.Bag{}, Skipped: []string{}}
+	for _, robot := range robots {
+		if robot.AgentID == "" || robot.Type == "laptop" || robot.ArchivedAt != nil {
+			resp.Skipped = append(resp.Skipped, robot.Name)
+			continue
+		}
+		bag, err := c.startBag(r.Context(), robot, req, createdBy, requestBaseURL(r))
+		if err != nil {
+			logging.FromContext(r.Context()).Error("start bag", "robot", robot.Name, "err", err)
+			respondError(w, http.StatusInternalServerError, "failed to start bag")
+			return
+		}
+		resp.Bags = append(resp.Bags, bag)
+	}
+	detail := fmt.Sprintf("%d robots, %ds", len(resp.Bags), req.DurationSec)
+	if req.Experiment != "" {
+		detail = req.Experiment + ": " + detail
+	}
+	c.audit(r.Context(), "bag.start", strings.Join(req.Topics, ","), detail)
+	respondJSON(w, http.StatusCreated, resp)
+}
+
+// startBag records a bag and queues bag_start for it. A robot the command
+// can't be queued for gets a failed bag; only database errors are returned.
+func (c *Controller) startBag(ctx context.Context, robot db.Robot, req bagStartRequest, createdBy, baseURL string) (db.Bag, error) {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	bag := db.Bag{
+		RobotID:     robot.ID,
+		Experiment:  req.Experiment,
+		Topics:      req.Topics,
+		DurationSec: req.DurationSec,
+		Token:       hex.EncodeToString(buf),
+		CreatedBy:   createdBy,
+	}
+	id, err := c.DB.CreateBag(ctx, bag)
+	if err != nil {
+		return bag, err
+	}
+	bag.ID = id
+
+	data, _ := json.Marshal(agent.BagStartData{
+		Name:        bagName(id),
+		Topics:      req.Topics,
+		DurationSec: req.DurationSec,
+		UploadURL:   fmt.Sprintf("%s/api/robots/%d/bags/%d?token=%s", strings.TrimSuffix(baseURL, "/"), robot.ID, id, bag.Token),
+	})
+	job, err := c.queueRobotCommand(ctx, robot, agent.Command{Type: "bag_start", Data: data})
+	if err != nil {
+		c.failBag(ctx, bag, robot.Name, "could not queue bag_start: "+err.Error())
+		return c.DB.GetBag(ctx, id)
+	}
+	if err := c.DB.SetBagJob(ctx, id, job.ID); err != nil {
+		return bag, err
+	}
+	return c.DB.GetBag(ctx, id)
+}
+
+// bagName is the recording's name on the robot, for bag_stop.
+func bagName(id int64) string {
+	return fmt.Sprintf("bag-%d", id)
+}
+
+// failBag marks a recording bag failed and raises a "bag" alert.
+func (c *Controller) failBag(ctx context.Context, bag db.Bag, robotName, reason string) {
+	ok, err := c.DB.FinishBag(ctx, bag.ID, db.BagFailed, 0, reason)
+	if err != nil {
+		slog.Error("bag: record failure", "bag", bag.ID, "err", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	slog.Warn("bag failed", "robot", robotName, "bag", bag.ID, "reason", reason)
+	c.raiseAlert("bag", bag.RobotID, fmt.Sprintf("Bag %d on %s failed: %s", bag.ID, robotName, reason))
+}
+
+// ListBags returns bags, newest first, optionally only one experiment's or
+// one robot's.
+func (c *Controller) ListBags(w http.ResponseWriter, r *http.Request) {
+	f := db.BagFilter{Experiment: r.URL.Query().Get("experiment")}
+	if v := r.URL.Query().Get("robot_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid robot_id")
+			return
+		}
+		f.RobotID = id
+	}
+	c.respondBags(w, r, f)
+}
+
+// ListRobotBags returns one robot's bags, newest first.
+func (c *Controller) ListRobotBags(w http.ResponseWriter, r *http.Request) {
+	id, err := parseRobotID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid robot id")
+		return
+	}
+	c.respondBags(w, r, db.BagFilter{RobotID: id, Experiment: r.URL.Query().Get("experiment")})
+}
+
+func (c *Controller) respondBags(w http.ResponseWriter, r *http.Request, f db.BagFilter) {
+	bags, err := c.DB.ListBags(r.Context(), f)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list bags", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load bags")
+		return
+	}
+	respondJSON(w, http.StatusOK, bags)
+}
+
+// bagFromPath loads the bag named by /api/bags/{id}[/...].
+func (c *Controller) bagFromPath(w http.ResponseWriter, r *http.Request) (db.Bag, bool) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/bags/")
+	id, err := strconv.ParseInt(strings.SplitN(rest, "/", 2)[0], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid bag id")
+		return db.Bag{}, false
+	}
+	bag, err := c.DB.GetBag(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(w, http.StatusNotFound, "bag not found")
+			return db.Bag{}, false
+		}
+		logging.FromContext(r.Context()).Error("get bag", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load bag")
+		return db.Bag{}, false
+	}
+	return bag, true
+}
+
+// GetBag returns one bag.
+func (c *Controller) GetBag(w http.ResponseWriter, r *http.Request) {
+	if bag, ok := c.bagFromPath(w, r); ok {
+		respondJSON(w, http.StatusOK, bag)
+	}
+}
+
+// DownloadBag sends a stored bag as a gzipped tar of its bag directory.
+func (c *Controller) DownloadBag(w http.ResponseWriter, r *http.Request) {
+	bag, ok := c.bagFromPath(w, r)
+	if !ok {
+		return
+	}
+	if bag.Status != db.BagStored {
+		respondError(w, http.StatusConflict, "bag is "+bag.Status)
+		return
+	}
+	name := fmt.Sprintf("bag-%d.tar.gz", bag.ID)
+	if bag.Experiment != "" {
+		name = fmt.Sprintf("%s-%d-%d.tar.gz", strings.ReplaceAll(bag.Experiment, " ", "_"), bag.RobotID, bag.ID)
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeFile(w, r, c.bagFile(bag))
+}
+
+// StopBag ends a recording before its duration is up. The robot uploads
+// what it recorded so far.
+func (c *Controller) StopBag(w http.ResponseWriter, r *http.Request) {
+	bag, ok := c.bagFromPath(w, r)
+	if !ok {
+		return
+	}
+	if bag.Status != db.BagRecording {
+		respondError(w, http.StatusConflict, "bag is "+bag.Status)
+		return
+	}
+	robot, err := c.DB.GetRobotByID(r.Context(), bag.RobotID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("bag stop fetch robot", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to fetch robot")
+		return
+	}
+	data, _ := json.Marshal(agent.BagStopData{Name: bagName(bag.ID)})
+	job, err := c.queueRobotCommand(r.Context(), robot, agent.Command{Type: "bag_stop", Data: data})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("queue bag stop", "robot", robot.Name, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to queue bag_stop")
+		return
+	}
+	c.audit(r.Context(), "bag.stop", robot.Name, bagName(bag.ID))
+	respondJSON(w, http.StatusAccepted, job)
+}
+
+// DeleteBag removes a bag that is no longer recording, and its file.
+func (c *Controller) DeleteBag(w http.ResponseWriter, r *http.Request) {
+	bag, ok := c.bagFromPath(w, r)
+	if !ok {
+		return
+	}
+	if bag.Status == db.BagRecording {
+		respondError(w, http.StatusConflict, "bag is still recording; stop it first")
+		return
+	}
+	if err := c.DB.DeleteBag(r.Context(), bag.ID); err != nil {
+		logging.FromContext(r.Context()).Error("delete bag", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to delete bag")
+		return
+	}
+	if err := os.Remove(c.bagFile(bag)); err != nil && !os.IsNotExist(err) {
+		logging.FromContext(r.Context()).Warn("remove bag file", "bag", bag.ID, "err", err)
+	}
+	c.audit(r.Context(), "bag.delete", strconv.FormatInt(bag.RobotID, 10), bagName(bag.ID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UploadRobotBag receives a finished bag from the agent, authenticated by
+// the bag's token, as a gzipped tar streamed in the request body.
+func (c *Controller) UploadRobotBag(w http.ResponseWriter, r *http.Request) {
+	robotID, err := parseRobotID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid robot id")
+		return
+	}
+	bagID, err := strconv.ParseInt(filepath.Base(strings.TrimSuffix(r.URL.Path, "/")), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid bag id")
+		return
+	}
+	bag, err := c.DB.GetBag(r.Context(), bagID)
+	if err != nil || bag.RobotID != robotID || subtle.ConstantTimeCompare([]byte(bag.Token), []byte(r.URL.Query().Get("token"))) != 1 {
+		respondError(w, http.StatusNotFound, "unknown bag")
+		return
+	}
+	if bag.Status != db.BagRecording {
+		respondError(w, http.StatusConflict, "bag is "+bag.Status)
+		return
+	}
+	if msg := c.usageLimitReached(r.Context(), "storage"); msg != "" {
+		c.failBag(r.Context(), bag, strconv.FormatInt(robotID, 10), msg)
+		respondError(w, http.StatusForbidden, msg)
+		return
+	}
+
+	dst := c.bagFile(bag)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		logging.FromContext(r.Context()).Error("failed to create bag dir", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to save")
+		return
+	}
+	f, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to create bag file", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to save")
+		return
+	}
+	defer os.Remove(f.Name())
+	size, err := io.Copy(f, http.MaxBytesReader(w, r.Body, bagMaxBytes()))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			c.failBag(r.Context(), bag, strconv.FormatInt(robotID, 10), fmt.Sprintf("bag is larger than %d MB", tooBig.Limit>>20))
+			respondError(w, http.StatusRequestEntityTooLarge, "bag too large")
+			return
+		}
+		respondError(w, http.StatusBadRequest, "failed to read bag")
+		return
+	}
+	if err := os.Rename(f.Name(), dst); err != nil {
+		logging.FromContext(r.Context()).Error("failed to store bag", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to save")
+		return
+	}
+	ok, err := c.DB.FinishBag(r.Context(), bagID, db.BagStored, size, "")
+	if err != nil || !ok {
+		_ = os.Remove(dst)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("finish bag", "err", err)
+			respondError(w, http.StatusInternalServerError, "failed to save")
+			return
+		}
+		respondError(w, http.StatusConflict, "bag is no longer recording")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "uploaded"})
+}
+
+// RunBagWatch fails bags whose bag_start job failed or that never arrived,
+// until ctx is done.
+func (c *Controller) RunBagWatch(ctx context.Context) {
+	ticker := time.NewTicker(bagCheckInterval)
+	defer ticker.Stop()
+	for {
+		c.checkRecordingBags(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Controller) checkRecordingBags(ctx context.Context, now time.Time) {
+	recording, err := c.DB.ListRecordingBags(ctx)
+	if err != nil {
+		slog.Error("bags: list recording", "err", err)
+		return
+	}
+	for _, bag := range recording {
+		var reason string
+		switch {
+		case bag.JobStatus == "failed":
+			reason = "bag_start failed"
+		case now.Sub(bag.CreatedAt) > time.Duration(bag.DurationSec)*time.Second+bagUploadGrace:
+			reason = "no bag arrived after the recording ended"
+		default:
+			continue
+		}
+		name := fmt.Sprintf("robot %d", bag.RobotID)
+		if robot, err := c.DB.GetRobotByID(ctx, bag.RobotID); err == nil {
+			name = robot.Name
+			if state := c.GetRobotJobStatus(robot.AgentID); bag.JobID != nil && state.JobID == strconv.FormatInt(*bag.JobID, 10) && state.JobError != "" {
+				reason += ": " + state.JobError
+			}
+		}
+		c.failBag(ctx, bag, name, reason)
+	}
+}
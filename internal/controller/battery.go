@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+const (
+	// batteryPolicyKey is the settings key holding the battery policy as
+	// JSON.
+	batteryPolicyKey = "battery_policy"
+	// batteryRearm is how far above the threshold a robot must charge before
+	// the policy will send it to its dock again.
+	batteryRearm = 5
+)
+
+// batteryPolicy sends robots with a dock back to it when their battery
+// drops below LowPct.
+type batteryPolicy struct {
+	Enabled bool    `json:"enabled"`
+	LowPct  float64 `json:"low_pct"`
+}
+
+var defaultBatteryPolicy = batteryPolicy{LowPct: 20}
+
+// batteryWatch holds the battery policy in memory, since it is checked on
+// every heartbeat, and the robots it has sent to their dock.
+type batteryWatch struct {
+	mu     sync.Mutex
+	loaded bool
+	policy batteryPolicy
+	// sent holds robots sent to their dock this discharge.
+	sent map[int64]bool
+}
+
+func (c *Controller) loadBatteryPolicy(ctx context.Context) (batteryPolicy, error) {
+	c.battery.mu.Lock()
+	defer c.battery.mu.Unlock()
+	if c.battery.loaded {
+		return c.battery.policy, nil
+	}
+	raw, err := c.DB.GetSetting(ctx, batteryPolicyKey)
+	if err != nil {
+		return batteryPolicy{}, err
+	}
+	policy := defaultBatteryPolicy
+	if raw != "" {
+		if err := json.Unmarshal([]byte(raw), &policy); err != nil {
+			return batteryPolicy{}, fmt.Errorf("invalid battery policy: %w", err)
+		}
+	}
+	c.battery.policy, c.battery.loaded = policy, true
+	return policy, nil
+}
+
+// GetBatteryPolicy returns the low-battery docking policy.
+func (c *Controller) GetBatteryPolicy(w http.ResponseWriter, r *http.Request) {
+	policy, err := c.loadBatteryPolicy(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("load battery policy", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load battery policy")
+		return
+	}
+	respondJSON(w, http.StatusOK, policy)
+}
+
+// UpdateBatteryPolicy replaces the low-battery docking policy.
+func (c *Controller) UpdateBatteryPolicy(w http.ResponseWriter, r *http.Request) {
+	var policy batteryPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid battery policy")
+		return
+	}
+	if policy.LowPct < 5 || policy.LowPct > 90 {
+		respondError(w, http.StatusBadRequest, "low_pct must be between 5 and 90")
+		return
+	}
+	raw, _ := json.Marshal(policy)
+	if err := c.DB.SaveSetting(r.Context(), batteryPolicyKey, string(raw)); err != nil {
+		logging.FromContext(r.Context()).Error("save battery policy", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to save battery policy")
+		return
+	}
+	c.battery.mu.Lock()
+	c.battery.policy, c.battery.loaded = policy, true
+	c.battery.mu.Unlock()
+	state := "off"
+	if policy.Enabled {
+		state = fmt.Sprintf("below %g%%", policy.LowPct)
+	}
+	c.audit(r.Context(), "battery_policy.update", "", state)
+	respondJSON(w, http.StatusOK, policy)
+}
+
+// CheckBattery applies the battery policy to a robot's latest heartbeat:
+// one that can dock itself and is low is sent to its dock once, with an
+// alert. It is sent again only after it has docked or charged back above
+// the threshold.
+func (c *Controller) CheckBattery(ctx context.Context, robot db.Robot) {
+	if robot.ID == 0 || robot.Battery == nil || robot.Dock == nil {
+		return
+	}
+	policy, err := c.loadBatteryPolicy(ctx)
+	if err != nil {
+		slog.Error("battery policy: load", "err", err)
+		return
+	}
+	battery := *robot.Battery
+
+	c.battery.mu.Lock()
+	if c.battery.sent == nil {
+		c.battery.sent = make(map[int64]bool)
+	}
+	if robot.Dock.Docked || battery >= policy.LowPct+batteryRearm {
+		delete(c.battery.sent, robot.ID)
+	}
+	send := policy.Enabled && !robot.Dock.Docked && battery < policy.LowPct && !c.battery.sent[robot.ID]
+	if send {
+		c.battery.sent[robot.ID] = true
+	}
+	c.battery.mu.Unlock()
+	if !send {
+		return
+	}
+
+	// The dock waits for the robot's current job, such as a mission, to
+	// finish.
+	job, err := c.queueRobotCommand(ctx, robot, agent.Command{Type: "dock"})
+	if err != nil {
+		slog.Error("battery policy: queue dock", "robot", robot.Name, "err", err)
+		c.battery.mu.Lock()
+		delete(c.battery.sent, robot.ID)
+		c.battery.mu.Unlock()
+		return
+	}
+	slog.Info("battery policy: sending robot to dock", "robot", robot.Name, "battery", battery, "job_id", job.ID)
+	c.raiseAlert("battery", robot.ID, fmt.Sprintf("%s is at %g%% battery and was sent to its dock", robot.Name, battery))
+}
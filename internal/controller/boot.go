@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/events"
+)
+
+const defaultSlowBootThreshold = 3 * time.Minute
+
+// slowBootThreshold is how long a robot may take from power-on to agent
+// connect before we alert. Override with SLOW_BOOT_THRESHOLD_SEC.
+func slowBootThreshold() time.Duration {
+	if v := os.Getenv("SLOW_BOOT_THRESHOLD_SEC"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+			return time.Duration(secs) * time.Second
+		}
+	}
+	return defaultSlowBootThreshold
+}
+
+// RecordBoot stores a boot report from a robot's heartbeat. Reports repeat on
+// every heartbeat, so only a changed boot time is treated as a new boot; a
+// new boot that took longer than the threshold raises a slow_boot alert.
+func (c *Controller) RecordBoot(ctx context.Context, robot db.Robot, bootTime time.Time, connectSec int) {
+	if bootTime.IsZero() {
+		return
+	}
+	if robot.BootTime != nil && absDuration(robot.BootTime.Sub(bootTime)) < 2*time.Second {
+		return
+	}
+	if err := c.DB.UpdateRobotBoot(ctx, robot.ID, bootTime, connectSec); err != nil {
+		slog.Error("boot: failed to record boot", "robot", robot.Name, "err", err)
+		return
+	}
+	took := time.Duration(connectSec) * time.Second
+	if took <= slowBootThreshold() {
+		return
+	}
+	msg := fmt.Sprintf("%s took %s from power-on to agent connect (threshold %s); check the SD card or look for an fsck loop", robot.Name, took, slowBootThreshold())
+	slog.Warn("boot: slow boot", "robot", robot.Name, "msg", msg)
+	c.raiseAlert("slow_boot", robot.ID, msg)
+}
+
+// RecordSuspends stores the sleeps a laptop reported after resuming, so the
+// time it spent offline asleep is not mistaken for an outage.
+func (c *Controller) RecordSuspends(ctx context.Context, robot db.Robot, suspends []db.RobotSuspend) {
+	for _, s := range suspends {
+		if s.SuspendedAt.IsZero() || !s.ResumedAt.After(s.SuspendedAt) {
+			continue
+		}
+		s.RobotID = robot.ID
+		if err := c.DB.RecordRobotSuspend(ctx, s); err != nil {
+			slog.Error("suspend: failed to record suspend", "robot", robot.Name, "err", err)
+			return
+		}
+		slog.Info("suspend: robot resumed", "robot", robot.Name, "asleep", s.ResumedAt.Sub(s.SuspendedAt).Round(time.Second))
+	}
+}
+
+func (c *Controller) raiseAlert(kind string, robotID int64, message string) {
+	c.Events.Publish(events.Alert{Kind: kind, RobotID: robotID, Message: message})
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
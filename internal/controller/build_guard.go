@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// The work image is grown by this much before the chroot install.
+	imageExpandBytes = 8 << 30
+	// xz compresses the Ubuntu Pi images roughly 4:1; used when xz can't
+	// report the uncompressed size.
+	xzRatioEstimate   = 4
+	diskCheckInterval = 10 * time.Second
+)
+
+var (
+	errLowDisk        = errors.New("free disk space dropped below the safety threshold")
+	errBuildCancelled = errors.New("build cancelled")
+)
+
+// buildLimits are the resource guardrails for golden image builds.
+type buildLimits struct {
+	// Abort when free space on the images or cache volume falls below this.
+	safetyBytes uint64
+	// Refuse to start without this much available memory.
+	minMemoryBytes uint64
+	nice           int    // 0 disables
+	ioniceClass    string // "", "idle", "best-effort"
+}
+
+func buildLimitsFromEnv() buildLimits {
+	l := buildLimits{
+		safetyBytes:    2 << 30,
+		minMemoryBytes: 1 << 30,
+		nice:           10,
+		ioniceClass:    "idle",
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("BUILD_DISK_SAFETY_GB"), 64); err == nil && v >= 0 {
+		l.safetyBytes = uint64(v * (1 << 30))
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("BUILD_MIN_MEMORY_GB"), 64); err == nil && v >= 0 {
+		l.minMemoryBytes = uint64(v * (1 << 30))
+	}
+	if v, err := strconv.Atoi(os.Getenv("BUILD_NICE")); err == nil && v >= 0 && v <= 19 {
+		l.nice = v
+	}
+	if v, ok := os.LookupEnv("BUILD_IONICE_CLASS"); ok {
+		switch v = strings.ToLower(strings.TrimSpace(v)); v {
+		case "", "none":
+			l.ioniceClass = ""
+		case "idle", "best-effort":
+			l.ioniceClass = v
+		}
+	}
+	return l
+}
+
+// command builds an exec.Cmd for a heavy build step, wrapped in nice and
+// ionice when they are configured and installed. The command is killed when
+// ctx is cancelled.
+func (l buildLimits) command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	argv := append([]string{name}, args...)
+	if l.ioniceClass != "" {
+		if path, err := exec.LookPath("ionice"); err == nil {
+			class := []string{"-c", "3"}
+			if l.ioniceClass == "best-effort" {
+				class = []string{"-c", "2", "-n", "7"}
+			}
+			argv = append(append([]string{path}, class...), argv...)
+		}
+	}
+	if l.nice > 0 {
+		if path, err := exec.LookPath("nice"); err == nil {
+			argv = append([]string{path, "-n", strconv.Itoa(l.nice)}, argv...)
+		}
+	}
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	// Kill the whole process group so apt/dpkg children in the chroot die too
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	return cmd
+}
+
+// abortReason prefers the reason a build was cancelled (e.g. low disk) over
+// the error of the command that was killed because of it.
+func abortReason(ctx context.Context, msg string) string {
+	if cause := context.Cause(ctx); cause != nil {
+		return cause.Error()
+	}
+	return msg
+}
+
+// diskFree returns the bytes available to unprivileged users on the
+// filesystem holding path.
+func diskFree(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
+
+// memAvailable reads MemAvailable from /proc/meminfo.
+func memAvailable() (uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return kb << 10, nil
+		}
+	}
+	return 0, errors.New("MemAvailable not found in /proc/meminfo")
+}
+
+// xzUncompressedSize asks xz for the uncompressed size of file, falling back
+// to an estimate from the compressed size.
+func xzUncompressedSize(file string) (uint64, error) {
+	out, err := exec.Command("xz", "--robot", "--list", file).Output()
+	if err == nil {
+		for _, line := range strings.Split(string(out), "\n") {
+			fields := strings.Fields(line)
+			// totals <streams> <blocks> <compressed> <uncompressed> ...
+			if len(fields) >= 5 && fields[0] == "totals" {
+				if n, err := strconv.ParseUint(fields[4], 10, 64); err == nil {
+					return n, nil
+				}
+			}
+		}
+	}
+	info, statErr := os.Stat(file)
+	if statErr != nil {
+		return 0, statErr
+	}
+	return uint64(info.Size()) * xzRatioEstimate, nil
+}
+
+// preflight checks there is room to decompress and expand baseImageXZ into
+// imagesDir, keeping the safety margin, and enough memory for the chroot.
+func (l buildLimits) preflight(baseImageXZ, imagesDir string) error {
+	if l.minMemoryBytes > 0 {
+		if avail, err := memAvailable(); err == nil && avail < l.minMemoryBytes {
+			return fmt.Errorf("only %s of memory available, need %s (BUILD_MIN_MEMORY_GB)", formatBytes(avail), formatBytes(l.minMemoryBytes))
+		}
+	}
+	size, err := xzUncompressedSize(baseImageXZ)
+	if err != nil {
+		return fmt.Errorf("size base image: %w", err)
+	}
+	need := size + imageExpandBytes + l.safetyBytes
+	free, err := diskFree(imagesDir)
+	if err != nil {
+		return fmt.Errorf("check free disk: %w", err)
+	}
+	if free < need {
+		return fmt.Errorf("only %s free in %s, need %s (image %s + %s expansion + %s safety margin)",
+			formatBytes(free), imagesDir, formatBytes(need), formatBytes(size), formatBytes(imageExpandBytes), formatBytes(l.safetyBytes))
+	}
+	return nil
+}
+
+// watchDisk cancels the build with errLowDisk if any of dirs drops below the
+// safety margin. It returns when ctx is done.
+func (l buildLimits) watchDisk(ctx context.Context, cancel context.CancelCauseFunc, dirs ...string) {
+	if l.safetyBytes == 0 {
+		return
+	}
+	ticker := time.NewTicker(diskCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, dir := range dirs {
+			free, err := diskFree(dir)
+			if err != nil || free >= l.safetyBytes {
+				continue
+			}
+			cancel(fmt.Errorf("%w: %s free in %s", errLowDisk, formatBytes(free), dir))
+			return
+		}
+	}
+}
+
+func formatBytes(n uint64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The install script is most of a build, so it reports how far it has got.
+// It prints checkpoints, "::install <from> <to> <what>", giving the share
+// of the script (0-100) the next part takes, and may print "::total <n>"
+// for a part that does n things. Within a part, apt's "Setting up" lines,
+// out of the count in its summary, and colcon's finished packages move the
+// progress along.
+
+const (
+	// installFrom and installTo are the build's progress before and after
+	// the install script.
+	installFrom = 60
+	installTo   = 90
+	// etaMinFraction is how much of the script must be done before its
+	// pace is trusted for an ETA.
+	etaMinFraction = 0.05
+)
+
+// aptSummary is the line apt prints before installing, e.g. "12 upgraded,
+// 240 newly installed, 0 to remove and 3 not upgraded."
+var aptSummary = regexp.MustCompile(`^(\d+) upgraded, (\d+) newly installed`)
+
+// installProgress follows the install script's output of one build.
+type installProgress struct {
+	run     *buildRun
+	started time.Time
+	// from and to are the current part's share of the script, what it is
+	// doing, and how many of its total things are done.
+	from, to    int
+	what        string
+	total, done int
+	// fraction is the share of the script done; it never goes back.
+	fraction float64
+}
+
+func newInstallProgress(run *buildRun) *installProgress {
+	return &installProgress{run: run, started: time.Now(), to: 100}
+}
+
+// line takes a line of the script's output. It reports whether the line
+// was a checkpoint, which needn't be logged.
+func (p *installProgress) line(s string) bool {
+	s = strings.TrimSpace(s)
+	if rest, ok := strings.CutPrefix(s, "::install "); ok {
+		fields := strings.SplitN(rest, " ", 3)
+		if len(fields) < 2 {
+			return false
+		}
+		from, err1 := strconv.Atoi(fields[0])
+		to, err2 := strconv.Atoi(fields[1])
+		if err1 != nil || err2 != nil || from < 0 || to > 100 || from > to {
+			return false
+		}
+		p.from, p.to, p.total, p.done = from, to, 0, 0
+		if len(fields) == 3 {
+			p.what = fields[2]
+			p.run.logf(">>> %s", p.what)
+		}
+		p.advance(0, true)
+		return true
+	}
+	if rest, ok := strings.CutPrefix(s, "::total "); ok {
+		if n, err := strconv.Atoi(rest); err == nil && n > 0 {
+			p.total, p.done = n, 0
+		}
+		return true
+	}
+	switch {
+	case strings.HasPrefix(s, "Setting up "), strings.HasPrefix(s, "Finished <<< "):
+		p.done++
+	default:
+		if m := aptSummary.FindStringSubmatch(s); m != nil {
+			upgraded, _ := strconv.Atoi(m[1])
+			installed, _ := strconv.Atoi(m[2])
+			p.total, p.done = upgraded+installed, 0
+		}
+		return false
+	}
+	if p.total > 0 {
+		p.advance(min(float64(p.done)/float64(p.total), 1), false)
+	}
+	return false
+}
+
+// advance moves the progress to part of the way through the current part.
+// A new part is shown even if the progress stays where it was.
+func (p *installProgress) advance(part float64, newPart bool) {
+	f := max((float64(p.from)+float64(p.to-p.from)*part)/100, p.fraction)
+	if f == p.fraction && !newPart {
+		return
+	}
+	p.fraction = f
+	var eta time.Duration
+	if f >= etaMinFraction {
+		elapsed := time.Since(p.started)
+		eta = time.Duration(float64(elapsed) * (1 - f) / f).Round(time.Minute)
+	}
+	step := "Installing ROS 2 and Agent"
+	if p.what != "" {
+		step += ": " + p.what
+	}
+	if eta > 0 {
+		step += fmt.Sprintf(" (about %d min left)", int(eta.Minutes()))
+	}
+	p.run.progressWithin(step, installFrom+int(f*float64(installTo-installFrom)), eta)
+}
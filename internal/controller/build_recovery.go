@@ -0,0 +1,234 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// A golden image build mounts the image in its own directory under
+// buildMountDir through a loop device. If the controller dies mid-build those are never cleaned up, the
+// partial image is left in the images directory and the build's record says
+// building forever. RecoverInterruptedBuild puts that right on startup.
+
+// buildMountDir holds the directory each build mounts its image at.
+const buildMountDir = "/mnt/turtlebot-build"
+
+var sha256Hex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// buildImagesDir is where built images are written and served from.
+func buildImagesDir() string {
+	webRoot := os.Getenv("WEB_ROOT")
+	if webRoot == "" {
+		webRoot = "./web/dist"
+	}
+	return filepath.Join(webRoot, "images")
+}
+
+// buildCacheDir keeps downloaded base images between builds: on the
+// persistent /data volume if there is one, else in /tmp.
+func buildCacheDir() string {
+	if _, err := os.Stat("/data"); err == nil {
+		return "/data/image-cache"
+	}
+	return "/tmp/image-cache"
+}
+
+// cachedHash returns the SHA-256 recorded for a cached base image once it
+// was verified, or "" if there is none.
+func cachedHash(baseImage string) string {
+	if _, err := os.Stat(baseImage); err != nil {
+		return ""
+	}
+	b, err := os.ReadFile(baseImage + ".sha256")
+	if err != nil {
+		return ""
+	}
+	if h := strings.TrimSpace(string(b)); sha256Hex.MatchString(h) {
+		return h
+	}
+	return ""
+}
+
+func recordCachedHash(baseImage, hash string) {
+	if err := os.WriteFile(baseImage+".sha256", []byte(hash+"\n"), 0644); err != nil {
+		slog.Warn("record base image hash", "image", baseImage, "err", err)
+	}
+}
+
+// hasCachedBaseImage reports whether a build can be retried without
+// reaching the upstream mirror. The cache of a remote builder can't be seen
+// from here, so a retry is always offered with one; it fails straight away
+// if there is nothing cached.
+func hasCachedBaseImage() bool {
+	if os.Getenv("BUILD_SSH_HOST") != "" {
+		return true
+	}
+	matches, _ := filepath.Glob(filepath.Join(buildCacheDir(), "*.img.xz.sha256"))
+	for _, m := range matches {
+		if cachedHash(strings.TrimSuffix(m, ".sha256")) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// RecoverInterruptedBuild cleans up after a build the controller didn't
+// live to finish: it unmounts the image, detaches its loop devices, removes
+// the partial image and marks the build interrupted, so the builder offers
+// to retry it from the cached base image. It must run before any build can
+// start.
+func (c *Controller) RecoverInterruptedBuild(ctx context.Context) {
+	const reason = "the controller restarted during the build"
+	n, partial, err := c.DB.InterruptImageBuilds(ctx, reason)
+	if err != nil {
+		slog.Error("build recovery: mark interrupted builds", "err", err)
+	}
+
+	var notes []string
+	note := func(format string, v ...interface{}) {
+		msg := fmt.Sprintf(format, v...)
+		slog.Info(msg, "source", "image_build")
+		notes = append(notes, fmt.Sprintf("[%s] %s", time.Now().Format("15:04:05"), msg))
+	}
+
+	if mounts := staleBuildMounts(); len(mounts) > 0 {
+		for _, dir := range buildMountRoots(mounts) {
+			if err := unmountBuild(dir); err != nil {
+				note("could not unmount %s: %v", dir, err)
+			} else {
+				note("unmounted stale build mounts under %s", dir)
+				os.Remove(dir)
+			}
+		}
+		os.Remove(buildMountDir)
+	}
+
+	if n > 0 {
+		if builder, err := c.remoteBuilder(ctx); err != nil {
+			note("could not clean up the remote builder: %v", err)
+		} else if builder != nil {
+			if err := builder.recoverBuilds(); err != nil {
+				note("could not clean up on builder %s: %v", builder.host.Addr, err)
+			} else {
+				note("cleaned up interrupted builds on builder %s", builder.host.Addr)
+			}
+		}
+	}
+
+	imagesDir := buildImagesDir()
+	for _, dev := range staleLoopDevices(imagesDir) {
+		if out, err := exec.Command("losetup", "-d", dev).CombinedOutput(); err != nil {
+			note("could not detach loop device %s: %v: %s", dev, err, strings.TrimSpace(string(out)))
+		} else {
+			note("detached stale loop device %s", dev)
+		}
+	}
+
+	for _, name := range partial {
+		// The build may have been compressing the image.
+		for _, name := range []string{name, name + ".xz"} {
+			path := filepath.Join(imagesDir, filepath.Base(name))
+			if err := removeImage(name); err == nil {
+				note("removed partial image %s", path)
+			} else if !os.IsNotExist(err) {
+				note("could not remove partial image %s: %v", path, err)
+			}
+		}
+	}
+
+	if n == 0 && len(notes) == 0 {
+		return
+	}
+	slog.Warn("golden image build was interrupted by a restart", "builds", n)
+	c.builds.mu.Lock()
+	c.builds.last = &buildRun{events: c.Events, status: "interrupted", err: reason, step: "Build interrupted", logs: notes}
+	c.builds.mu.Unlock()
+	c.raiseAlert("build", 0, "Golden image build was interrupted: "+reason)
+}
+
+// unmountBuild unmounts the image mounted at dir and everything under it.
+// Processes still running in the chroot would keep the mounts busy, so they
+// are killed first; if the mounts stay busy they are detached lazily and go
+// once freed.
+func unmountBuild(dir string) error {
+	killChrootProcesses(dir)
+	out, err := exec.Command("umount", "-R", dir).CombinedOutput()
+	if err != nil {
+		out, err = exec.Command("umount", "-R", "-l", dir).CombinedOutput()
+	}
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// killChrootProcesses kills every process whose root is dir or below it,
+// e.g. a daemon apt started in the chroot that outlived the install
+// script's process group.
+func killChrootProcesses(dir string) {
+	procs, _ := filepath.Glob("/proc/[0-9]*")
+	for _, p := range procs {
+		root, err := os.Readlink(filepath.Join(p, "root"))
+		if err != nil || (root != dir && !strings.HasPrefix(root, dir+"/")) {
+			continue
+		}
+		if pid, err := strconv.Atoi(filepath.Base(p)); err == nil {
+			syscall.Kill(pid, syscall.SIGKILL)
+		}
+	}
+}
+
+// staleBuildMounts lists what is mounted at or under buildMountDir.
+func staleBuildMounts() []string {
+	f, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var mounts []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		if fields[1] == buildMountDir || strings.HasPrefix(fields[1], buildMountDir+"/") {
+			mounts = append(mounts, fields[1])
+		}
+	}
+	return mounts
+}
+
+// staleLoopDevices lists the loop devices backed by an image in imagesDir.
+// Only builds attach those, and none is running yet.
+func staleLoopDevices(imagesDir string) []string {
+	abs, err := filepath.Abs(imagesDir)
+	if err != nil {
+		return nil
+	}
+	out, err := exec.Command("losetup", "--list", "--noheadings", "--output", "NAME,BACK-FILE").Output()
+	if err != nil {
+		return nil
+	}
+	var devs []string
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if strings.HasPrefix(fields[1], abs+"/") {
+			devs = append(devs, fields[0])
+		}
+	}
+	return devs
+}
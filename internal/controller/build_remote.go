@@ -0,0 +1,534 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"example.com/openrobot-fleet/internal/db"
+	sshc "example.com/openrobot-fleet/internal/ssh"
+)
+
+// A controller that can't use loop devices, mounts or chroot, e.g. one in an
+// unprivileged container, can have images built on another host over SSH
+// instead: BUILD_SSH_HOST. The builder needs losetup, parted, resize2fs, xz,
+// wget and, unless it is arm64 itself, qemu-aarch64-static with binfmt
+// support. Each build runs remoteBuildScript in its own directory under
+// BUILD_SSH_WORK_DIR, which is this controller's alone, and the compressed
+// image is copied back to be checksummed, signed and served as usual.
+
+const defaultBuilderWorkDir = "/var/tmp/openrobot-build"
+
+// remoteBuilder is the host golden images are built on.
+type remoteBuilder struct {
+	host    sshc.HostSpec
+	workDir string
+}
+
+// remoteBuilderFromEnv returns the builder BUILD_SSH_HOST names, or nil if
+// images are built here.
+func remoteBuilderFromEnv() (*remoteBuilder, error) {
+	addr := os.Getenv("BUILD_SSH_HOST")
+	if addr == "" {
+		return nil, nil
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	b := &remoteBuilder{
+		host: sshc.HostSpec{
+			Addr:     addr,
+			User:     os.Getenv("BUILD_SSH_USER"),
+			Password: os.Getenv("BUILD_SSH_PASSWORD"),
+			HostKey:  []byte(os.Getenv("BUILD_SSH_HOST_KEY")),
+		},
+		workDir: os.Getenv("BUILD_SSH_WORK_DIR"),
+	}
+	if b.host.User == "" {
+		b.host.User = "root"
+	}
+	if b.workDir == "" {
+		b.workDir = defaultBuilderWorkDir
+	}
+	if keyFile := os.Getenv("BUILD_SSH_KEY_FILE"); keyFile != "" {
+		key, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read builder SSH key: %v", err)
+		}
+		b.host.PrivateKey = key
+		b.host.KeyPassphrase = os.Getenv("BUILD_SSH_KEY_PASSPHRASE")
+	}
+	return b, nil
+}
+
+// remoteBuilder returns the builder BUILD_SSH_HOST names, or nil if images
+// are built here. Unless BUILD_SSH_HOST_KEY pins it, the host key the builder
+// presents the first time is recorded and required afterwards, as robots'
+// are, so that something else answering at its address doesn't get the
+// builder's credentials.
+func (c *Controller) remoteBuilder(ctx context.Context) (*remoteBuilder, error) {
+	b, err := remoteBuilderFromEnv()
+	if err != nil || b == nil {
+		return b, err
+	}
+	if len(b.host.HostKey) > 0 {
+		return b, nil
+	}
+	setting := "builder_host_key:" + b.host.Addr
+	key, err := c.DB.GetSetting(ctx, setting)
+	if err != nil {
+		return nil, fmt.Errorf("load builder host key: %w", err)
+	}
+	if key != "" {
+		b.host.HostKey = []byte(key)
+		return b, nil
+	}
+	addr := b.host.Addr
+	b.host.OnHostKey = func(key []byte) error {
+		if err := c.DB.SaveSetting(context.Background(), setting, strings.TrimSpace(string(key))); err != nil {
+			return fmt.Errorf("record builder host key: %w", err)
+		}
+		slog.Info("recorded builder ssh host key", "addr", addr, "fingerprint", sshc.HostKeyFingerprint(key))
+		return nil
+	}
+	return b, nil
+}
+
+// dial logs in to the builder.
+func (b *remoteBuilder) dial() (*ssh.Client, error) {
+	client, err := sshc.Dial(b.host)
+	if errors.Is(err, sshc.ErrHostKeyMismatch) {
+		return nil, fmt.Errorf("%w; if the builder was reinstalled, set BUILD_SSH_HOST_KEY to its new key", err)
+	}
+	return client, err
+}
+
+// command is cmd as run on the builder: as root, through passwordless sudo
+// unless the builder user is root.
+func (b *remoteBuilder) command(cmd string) string {
+	if b.host.User == "root" {
+		return cmd
+	}
+	return "sudo -n " + cmd
+}
+
+// run runs cmd on the builder.
+func (b *remoteBuilder) run(client *ssh.Client, cmd string) error {
+	sess, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("new session: %w", err)
+	}
+	defer sess.Close()
+	if out, err := sess.CombinedOutput(b.command(cmd)); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// buildRemotely builds profile's image on the builder and copies it, xz
+// compressed, to the images directory as workImage.xz. It reports false if
+// the build failed or was cancelled, having ended run.
+func (c *Controller) buildRemotely(ctx context.Context, run *buildRun, b *remoteBuilder, profile db.ImageProfile, fromCache bool) (workImage string, ok bool) {
+	cfg := &profile.Config
+	limits := buildLimitsFromEnv()
+
+	// 3. Download Base Image, on the builder
+	run.progressTo("Downloading base image (this may take a while)...", 15)
+	baseImageURL, baseImageName := baseImage(cfg)
+	// An empty hash has the builder use the one it recorded when it cached
+	// the base image.
+	var expectedSHA256 string
+	if fromCache {
+		run.logf("retrying from the builder's cached base image")
+	} else {
+		run.logf("fetching upstream hash for verification...")
+		hash, err := fetchRemoteHash(baseImageURL)
+		if err != nil {
+			run.abort(ctx, fmt.Sprintf("failed to fetch upstream hash: %v", err))
+			return "", false
+		}
+		expectedSHA256 = hash
+		run.logf("upstream hash: %s", expectedSHA256)
+	}
+	userData, err := c.renderUserData(context.Background(), cfg)
+	if err != nil {
+		run.fail(err.Error())
+		return "", false
+	}
+
+	run.logf("connecting to builder %s...", b.host.Addr)
+	client, err := b.dial()
+	if err != nil {
+		run.fail(fmt.Sprintf("connect to builder: %v", err))
+		return "", false
+	}
+	defer client.Close()
+	sc, err := sftp.NewClient(client)
+	if err != nil {
+		run.fail(fmt.Sprintf("sftp to builder: %v", err))
+		return "", false
+	}
+	defer sc.Close()
+
+	dir := path.Join(b.workDir, strconv.FormatInt(run.id, 10))
+	if err := sc.MkdirAll(dir); err != nil {
+		run.fail(fmt.Sprintf("mkdir %s on builder: %v", dir, err))
+		return "", false
+	}
+	defer func() {
+		// Not into the image, should it still be mounted.
+		if err := b.run(client, "rm -rf --one-file-system "+shellQuote(dir)); err != nil {
+			run.logf("warning: could not remove %s on builder: %v", dir, err)
+		}
+	}()
+	files := map[string][]byte{
+		"build.sh":   []byte(remoteBuildScript),
+		"install.sh": []byte(installScript(cfg)),
+		"user-data":  userData,
+	}
+	if agent, err := os.ReadFile(goldenAgentBinary()); err == nil {
+		files["agent"] = agent
+	} else {
+		run.logf("warning: could not copy agent binary: %v", err)
+	}
+	for name, data := range files {
+		if err := writeRemoteFile(sc, path.Join(dir, name), data); err != nil {
+			run.fail(fmt.Sprintf("upload %s to builder: %v", name, err))
+			return "", false
+		}
+	}
+
+	imageName := profileImageName(profile.Name, run.id)
+	workImage = filepath.Join(buildImagesDir(), imageName)
+	// Recorded so that a restart mid-build knows which image is partial.
+	if err := c.DB.SetImageBuildImage(context.Background(), run.id, imageName); err != nil {
+		run.logf("warning: record image build: %v", err)
+	}
+
+	env := []string{
+		"BUILD_DIR=" + dir,
+		"CACHE_DIR=" + path.Join(b.workDir, "cache"),
+		"BASE_URL=" + baseImageURL,
+		"BASE_NAME=" + baseImageName,
+		"BASE_SHA256=" + expectedSHA256,
+		"IMAGE=" + imageName,
+		"EXPAND_BYTES=" + strconv.FormatInt(imageExpandBytes, 10),
+		"SAFETY_BYTES=" + strconv.FormatUint(limits.safetyBytes, 10),
+		"NICE=" + strconv.Itoa(limits.nice),
+		"IONICE_CLASS=" + limits.ioniceClass,
+	}
+	for i, kv := range env {
+		env[i] = shellQuote(kv)
+	}
+	if !b.runScript(ctx, run, client, dir, "env "+strings.Join(env, " ")+" setsid -w bash "+shellQuote(path.Join(dir, "build.sh"))) {
+		return workImage, false
+	}
+
+	run.progressTo("Copying image from builder...", 95)
+	if err := copyRemoteFile(ctx, sc, path.Join(dir, imageName+".xz"), workImage+".xz"); err != nil {
+		run.abort(ctx, fmt.Sprintf("copy image from builder: %v", err))
+		return workImage, false
+	}
+	return workImage, true
+}
+
+// runScript runs the build script on the builder, turning its output into
+// run's log and progress. Cancelling ctx stops it; the script cleans up after
+// itself. It reports false if the script failed, having ended run.
+func (b *remoteBuilder) runScript(ctx context.Context, run *buildRun, client *ssh.Client, dir, cmd string) bool {
+	sess, err := client.NewSession()
+	if err != nil {
+		run.fail(fmt.Sprintf("new session on builder: %v", err))
+		return false
+	}
+	defer sess.Close()
+	output, err := sess.StdoutPipe()
+	if err != nil {
+		run.fail(fmt.Sprintf("builder output: %v", err))
+		return false
+	}
+	// The script sends its errors to stdout too, in order.
+	if err := sess.Start(b.command(cmd) + " 2>&1"); err != nil {
+		run.fail(fmt.Sprintf("start build on builder: %v", err))
+		return false
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			run.logf("stopping build on builder...")
+			// The script writes its process group to pid.
+			kill := "kill -s TERM -- -$(cat " + shellQuote(path.Join(dir, "pid")) + ")"
+			if err := b.run(client, "sh -c "+shellQuote(kill)); err != nil {
+				run.logf("warning: could not stop build on builder: %v", err)
+			}
+		case <-done:
+		}
+	}()
+
+	var last string
+	// progress follows the install script while it runs.
+	var progress *installProgress
+	scanner := bufio.NewScanner(output)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if rest, found := strings.CutPrefix(line, "::step "); found {
+			pct, step, _ := strings.Cut(rest, " ")
+			if n, err := strconv.Atoi(pct); err == nil {
+				run.progressTo(step, n)
+				progress = nil
+				if n == installFrom {
+					progress = newInstallProgress(run)
+				}
+				continue
+			}
+		}
+		if rest, found := strings.CutPrefix(line, "[install] "); found && progress != nil && progress.line(rest) {
+			continue
+		}
+		if line != "" {
+			last = line
+		}
+		run.logf("[builder] %s", line)
+	}
+	if err := sess.Wait(); err != nil {
+		run.abort(ctx, fmt.Sprintf("build on builder failed: %v: %s", err, last))
+		return false
+	}
+	return true
+}
+
+func writeRemoteFile(sc *sftp.Client, name string, data []byte) error {
+	f, err := sc.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// copyRemoteFile copies the builder's file src to dst here, stopping if ctx
+// is cancelled.
+func copyRemoteFile(ctx context.Context, sc *sftp.Client, src, dst string) error {
+	in, err := sc.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, ctxReader{ctx, in}); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// ctxReader stops reading once ctx is cancelled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// recoverBuilds cleans up after builds the controller didn't live to
+// finish on the builder: it stops their scripts, unmounts their images,
+// detaches their loop devices and removes their directories. The cached base
+// images are kept.
+func (b *remoteBuilder) recoverBuilds() error {
+	client, err := b.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return b.run(client, "sh -c "+shellQuote(fmt.Sprintf(remoteRecoverScript, shellQuote(b.workDir))))
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+const remoteRecoverScript = `WORK_DIR=%s
+cd "$WORK_DIR" 2>/dev/null || exit 0
+for pid in [0-9]*/pid; do
+	[ -f "$pid" ] && kill -s TERM -- "-$(cat "$pid")" 2>/dev/null
+done
+sleep 2
+grep -o " $WORK_DIR/[0-9]*/mnt[^ ]*" /proc/self/mounts | sort -r | while read -r m; do umount -l "$m"; done
+losetup --list --noheadings --output NAME,BACK-FILE | awk -v d="$WORK_DIR/" 'index($2, d) == 1 { print $1 }' | xargs -r -n1 losetup -d
+rm -rf --one-file-system "$WORK_DIR"/[0-9]*
+`
+
+// remoteBuildScript builds a golden image on the builder, in BUILD_DIR where
+// the controller has put install.sh, user-data and the agent. It does what
+// runBuild does here, from the base image download to compressing the image
+// into BUILD_DIR/IMAGE.xz, and reports each step as "::step <percent>
+// <description>". Whether it fails or is stopped with SIGTERM it unmounts
+// the image, detaches the loop device and removes the partial image.
+const remoteBuildScript = `#!/bin/bash
+set -euo pipefail
+step() { echo "::step $1 $2"; }
+
+MNT="$BUILD_DIR/mnt"
+WORK="$BUILD_DIR/$IMAGE"
+LOOP=""
+echo $$ > "$BUILD_DIR/pid"
+
+heavy() {
+	local cmd=("$@")
+	case "$IONICE_CLASS" in
+	idle) command -v ionice >/dev/null && cmd=(ionice -c 3 "${cmd[@]}") ;;
+	best-effort) command -v ionice >/dev/null && cmd=(ionice -c 2 -n 7 "${cmd[@]}") ;;
+	esac
+	if [ "$NICE" -gt 0 ] && command -v nice >/dev/null; then
+		cmd=(nice -n "$NICE" "${cmd[@]}")
+	fi
+	"${cmd[@]}"
+}
+
+cleanup() {
+	status=$?
+	# Kill anything the install left running in the chroot.
+	for p in /proc/[0-9]*; do
+		root=$(readlink "$p/root" 2>/dev/null) || continue
+		case "$root" in "$MNT" | "$MNT"/*) kill -9 "${p#/proc/}" 2>/dev/null || true ;; esac
+	done
+	if mountpoint -q "$MNT"; then
+		umount -R "$MNT" 2>/dev/null || umount -R -l "$MNT" || true
+	fi
+	if [ -n "$LOOP" ]; then
+		losetup -d "$LOOP" || true
+	fi
+	rmdir "$MNT" 2>/dev/null || true
+	if [ "$status" -ne 0 ]; then
+		rm -f "$WORK" "$WORK.xz"
+	fi
+	rm -f "$BUILD_DIR/pid"
+}
+trap cleanup EXIT
+trap 'exit 143' TERM HUP INT PIPE
+
+for tool in wget sha256sum xz truncate losetup parted partprobe resize2fs mount mountpoint chroot flock; do
+	command -v "$tool" >/dev/null || { echo "builder is missing $tool"; exit 1; }
+done
+if [ "$(uname -m)" != aarch64 ] && [ ! -x /usr/bin/qemu-aarch64-static ]; then
+	echo "builder is missing /usr/bin/qemu-aarch64-static"
+	exit 1
+fi
+
+mkdir -p "$CACHE_DIR"
+BASE="$CACHE_DIR/$BASE_NAME"
+(
+	# One build at a time checks, fills or reads the cache.
+	flock 9
+	if [ -z "$BASE_SHA256" ]; then
+		BASE_SHA256=$(cat "$BASE.sha256" 2>/dev/null || true)
+		if [ -z "$BASE_SHA256" ] || [ ! -f "$BASE" ]; then
+			echo "no cached base image on the builder"
+			exit 1
+		fi
+		echo "recorded hash: $BASE_SHA256"
+	fi
+	if [ -f "$BASE" ] && echo "$BASE_SHA256  $BASE" | sha256sum -c --status; then
+		echo "hash verified, skipping download"
+	else
+		echo "downloading base image from $BASE_URL..."
+		rm -f "$BASE"
+		wget -q -O "$BASE" "$BASE_URL"
+		if ! echo "$BASE_SHA256  $BASE" | sha256sum -c --status; then
+			rm -f "$BASE"
+			echo "downloaded file hash mismatch"
+			exit 1
+		fi
+	fi
+	echo "$BASE_SHA256" > "$BASE.sha256"
+
+	step 22 "Checking disk space..."
+	size=$(xz --robot --list "$BASE" | awk '$1 == "totals" { print $5 }')
+	need=$((size + EXPAND_BYTES + SAFETY_BYTES))
+	free=$(df -B1 --output=avail "$BUILD_DIR" | tail -n 1)
+	if [ "$free" -lt "$need" ]; then
+		echo "not enough disk space on the builder: need $need bytes, have $free"
+		exit 1
+	fi
+
+	step 25 "Decompressing image..."
+	heavy xz -d -k -c "$BASE" > "$WORK"
+) 9> "$CACHE_DIR/lock"
+
+step 35 "Expanding image..."
+truncate -s "+$EXPAND_BYTES" "$WORK"
+
+step 40 "Setting up loop device..."
+LOOP=$(losetup -fP --show "$WORK")
+
+step 45 "Resizing partitions..."
+parted -s "$LOOP" resizepart 2 100%
+partprobe "$LOOP" || true
+sleep 2
+resize2fs "${LOOP}p2"
+
+step 50 "Mounting image..."
+mkdir -p "$MNT"
+mount "${LOOP}p2" "$MNT"
+mkdir -p "$MNT/boot/firmware"
+mount "${LOOP}p1" "$MNT/boot/firmware"
+
+step 55 "Preparing chroot environment..."
+if [ -x /usr/bin/qemu-aarch64-static ]; then
+	cp /usr/bin/qemu-aarch64-static "$MNT/usr/bin/"
+fi
+for d in proc sys dev; do
+	mount --bind "/$d" "$MNT/$d"
+done
+mount --bind /dev/pts "$MNT/dev/pts" || true
+rm -f "$MNT/etc/resolv.conf"
+cp -L /etc/resolv.conf "$MNT/etc/resolv.conf"
+
+step 60 "Installing ROS 2 and Agent (this takes 20-30 mins)..."
+install -m 0755 "$BUILD_DIR/install.sh" "$MNT/tmp/install.sh"
+if [ -f "$BUILD_DIR/agent" ]; then
+	install -m 0755 "$BUILD_DIR/agent" "$MNT/usr/local/bin/openrobotfleet-agent"
+fi
+heavy chroot "$MNT" /bin/bash /tmp/install.sh 2>&1 | sed -u 's/^/[install] /'
+rm -f "$MNT/usr/bin/qemu-aarch64-static" "$MNT/tmp/install.sh"
+rm -f "$MNT/etc/resolv.conf"
+ln -s /run/systemd/resolve/stub-resolv.conf "$MNT/etc/resolv.conf"
+
+step 90 "Injecting configuration..."
+install -m 0644 "$BUILD_DIR/user-data" "$MNT/boot/firmware/user-data"
+
+step 92 "Unmounting image..."
+umount -R "$MNT"
+losetup -d "$LOOP"
+LOOP=""
+
+step 94 "Compressing image..."
+heavy xz -T0 -f "$WORK"
+`
@@ -0,0 +1,318 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/openrobot-fleet/internal/events"
+)
+
+// defaultMaxBuilds is how many golden image builds run at once unless
+// BUILD_MAX_CONCURRENT says otherwise. Builds of the same profile always
+// run one after another.
+const defaultMaxBuilds = 2
+
+func maxConcurrentBuilds() int {
+	if v, err := strconv.Atoi(os.Getenv("BUILD_MAX_CONCURRENT")); err == nil && v >= 1 {
+		return v
+	}
+	return defaultMaxBuilds
+}
+
+// buildRun is the live state of one golden image build: its progress and
+// log, sent to clients as build_update events while it runs.
+type buildRun struct {
+	events *events.Bus
+
+	id          int64
+	profileID   int64
+	profileName string
+	// mountDir is where this build mounts its image, so that builds
+	// running side by side don't meet.
+	mountDir string
+
+	mu          sync.Mutex
+	status      string // building, success, error, interrupted, cancelled
+	err         string
+	progress    int    // 0-100
+	step        string // Current step description
+	eta         time.Duration
+	logs        []string
+	imageName   string
+	smoke       string // passed or failed, once the smoke test has run
+	smokeErr    string
+	lastPublish time.Time
+	// cancel stops the build; CancelBuild calls it with errBuildCancelled.
+	cancel context.CancelCauseFunc
+}
+
+// update returns the run's state as a build_update event.
+func (b *buildRun) update() events.BuildUpdate {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.updateLocked()
+}
+
+func (b *buildRun) updateLocked() events.BuildUpdate {
+	logs := make([]string, len(b.logs))
+	copy(logs, b.logs)
+	return events.BuildUpdate{
+		BuildID:     b.id,
+		Status:      b.status,
+		Progress:    b.progress,
+		Step:        b.step,
+		ETASec:      int(b.eta.Seconds()),
+		Logs:        logs,
+		Error:       b.err,
+		ImageName:   b.imageName,
+		ProfileID:   b.profileID,
+		ProfileName: b.profileName,
+	}
+}
+
+func (b *buildRun) publish(u events.BuildUpdate) {
+	if b.events != nil {
+		b.events.Publish(u)
+	}
+}
+
+// logf adds a line to the build's log.
+func (b *buildRun) logf(format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	slog.Info(msg, "source", "image_build", "build_id", b.id)
+	b.mu.Lock()
+	b.logs = append(b.logs, fmt.Sprintf("[%s] %s", time.Now().Format("15:04:05"), msg))
+	// Limit log size
+	if len(b.logs) > 2000 {
+		b.logs = b.logs[len(b.logs)-2000:]
+	}
+	// Throttle updates to frontend to avoid flooding
+	shouldUpdate := time.Since(b.lastPublish) > 200*time.Millisecond
+	if shouldUpdate {
+		b.lastPublish = time.Now()
+	}
+	u := b.updateLocked()
+	b.mu.Unlock()
+
+	if shouldUpdate {
+		b.publish(u)
+	}
+}
+
+// progressTo starts the next step of the build.
+func (b *buildRun) progressTo(step string, progress int) {
+	b.mu.Lock()
+	b.step = step
+	b.progress = progress
+	b.eta = 0
+	b.logs = append(b.logs, fmt.Sprintf("[%s] >>> %s", time.Now().Format("15:04:05"), step))
+	u := b.updateLocked()
+	b.mu.Unlock()
+
+	b.publish(u)
+}
+
+// progressWithin moves the build along within a step, e.g. as the install
+// script gets through its packages, with how long the step has left if
+// that is known. Like logf, it publishes at most every 200ms.
+func (b *buildRun) progressWithin(step string, progress int, eta time.Duration) {
+	b.mu.Lock()
+	b.step = step
+	b.progress = progress
+	b.eta = eta
+	shouldUpdate := time.Since(b.lastPublish) > 200*time.Millisecond
+	if shouldUpdate {
+		b.lastPublish = time.Now()
+	}
+	u := b.updateLocked()
+	b.mu.Unlock()
+
+	if shouldUpdate {
+		b.publish(u)
+	}
+}
+
+// fail ends the build as failed.
+func (b *buildRun) fail(msg string) {
+	b.logf("build failed: %s", msg)
+	b.mu.Lock()
+	b.status = "error"
+	b.err = msg
+	u := b.updateLocked()
+	b.mu.Unlock()
+
+	b.publish(u)
+}
+
+// abort ends a build whose step failed or was killed: as cancelled if
+// CancelBuild stopped it, else as failed with the reason it was stopped
+// (e.g. low disk) or msg.
+func (b *buildRun) abort(ctx context.Context, msg string) {
+	if !errors.Is(context.Cause(ctx), errBuildCancelled) {
+		b.fail(abortReason(ctx, msg))
+		return
+	}
+	b.logf("build cancelled; cleaning up")
+	b.mu.Lock()
+	b.status = "cancelled"
+	b.err = errBuildCancelled.Error()
+	b.step = "Build cancelled"
+	u := b.updateLocked()
+	b.mu.Unlock()
+
+	b.publish(u)
+}
+
+// succeed ends the build as having written imageName.
+func (b *buildRun) succeed(imageName string) {
+	b.mu.Lock()
+	b.status = "success"
+	b.progress = 100
+	b.step = fmt.Sprintf("Build complete! Image: %s", imageName)
+	b.imageName = imageName
+	u := b.updateLocked()
+	b.mu.Unlock()
+
+	b.publish(u)
+}
+
+// interrupt marks a build cut short by the controller shutting down, unless
+// it has already ended.
+func (b *buildRun) interrupt() {
+	b.mu.Lock()
+	building := b.status == "building"
+	b.mu.Unlock()
+	if !building {
+		return
+	}
+	b.logf("controller shutting down; build interrupted")
+	b.mu.Lock()
+	b.status = "interrupted"
+	b.err = "interrupted by controller shutdown"
+	u := b.updateLocked()
+	b.mu.Unlock()
+
+	b.publish(u)
+}
+
+// buildRegistry holds the golden image builds running now, and the last one
+// started so the status endpoint has something to show once it is done.
+type buildRegistry struct {
+	// startMu makes starting builds one caller at a time, so two can't
+	// take the same queued build or go over the limit.
+	startMu sync.Mutex
+
+	mu      sync.Mutex
+	running map[int64]*buildRun
+	last    *buildRun
+	// stopped stops queued builds starting while the controller shuts
+	// down.
+	stopped bool
+	wg      sync.WaitGroup
+
+	// cacheMu keeps builds from downloading or verifying the cached base
+	// images at the same time.
+	cacheMu sync.Mutex
+}
+
+// add registers a build that is about to run.
+func (r *buildRegistry) add(b *buildRun) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running == nil {
+		r.running = make(map[int64]*buildRun)
+	}
+	r.running[b.id] = b
+	r.last = b
+	r.wg.Add(1)
+}
+
+// done unregisters a build that has finished.
+func (r *buildRegistry) done(b *buildRun) {
+	r.mu.Lock()
+	delete(r.running, b.id)
+	r.mu.Unlock()
+	r.wg.Done()
+}
+
+// get returns the running build with id, or nil.
+func (r *buildRegistry) get(id int64) *buildRun {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.running[id]
+}
+
+// latest returns the build with id if it is running, else the last build
+// started; nil if there has been none.
+func (r *buildRegistry) latest(id int64) *buildRun {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if b := r.running[id]; b != nil {
+		return b
+	}
+	return r.last
+}
+
+// active returns the running builds, oldest first.
+func (r *buildRegistry) active() []*buildRun {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	runs := make([]*buildRun, 0, len(r.running))
+	for _, b := range r.running {
+		runs = append(runs, b)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].id < runs[j].id })
+	return runs
+}
+
+// building reports whether a build of the profile is running.
+func (r *buildRegistry) building(profileID int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, b := range r.running {
+		if b.profileID == profileID {
+			return true
+		}
+	}
+	return false
+}
+
+// buildMountPath is where build id mounts its image.
+func buildMountPath(id int64) string {
+	return filepath.Join(buildMountDir, strconv.FormatInt(id, 10))
+}
+
+// buildMountRoots returns the directories builds mounted images at among
+// mounts: buildMountDir itself, for builds from before they each had their
+// own, or a directory under it.
+func buildMountRoots(mounts []string) []string {
+	for _, m := range mounts {
+		if m == buildMountDir {
+			// Everything under it is that build's chroot.
+			return []string{buildMountDir}
+		}
+	}
+	seen := map[string]bool{}
+	var roots []string
+	for _, m := range mounts {
+		root := buildMountDir
+		if rest := strings.TrimPrefix(m, buildMountDir+"/"); rest != m {
+			first, _, _ := strings.Cut(rest, "/")
+			root = filepath.Join(buildMountDir, first)
+		}
+		if !seen[root] {
+			seen[root] = true
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
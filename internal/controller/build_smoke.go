@@ -0,0 +1,392 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/openrobot-fleet/internal/db"
+)
+
+// With BUILD_SMOKE_TEST=true every image is booted headless in QEMU once it
+// is built. The image boots with a copy of its user-data that points the
+// agent at a throwaway broker on the controller; the test passes when the
+// agent publishes its status there. The result goes into the build history,
+// and a failure raises a build alert, but the image is kept either way.
+
+const (
+	defaultSmokeTimeout = 20 * time.Minute
+	// smokeHost is the controller as QEMU's user network shows it to the
+	// guest.
+	smokeHost = "10.0.2.2"
+	// smokeConsoleLines is how much of the serial console a failed test
+	// adds to the build log.
+	smokeConsoleLines = 40
+)
+
+func smokeTestEnabled() bool {
+	return os.Getenv("BUILD_SMOKE_TEST") == "true"
+}
+
+// smokeTimeout is how long the agent gets to report, BUILD_SMOKE_TIMEOUT.
+// Emulating an arm64 guest on an x86 controller takes several minutes.
+func smokeTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("BUILD_SMOKE_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return defaultSmokeTimeout
+}
+
+// smokeTest boots the raw image and records on run whether its agent came
+// up. It returns early, leaving the result unset, if ctx is cancelled.
+func (c *Controller) smokeTest(ctx context.Context, run *buildRun, image string, cfg *db.GoldenImageConfig) {
+	run.progressTo("Booting image in QEMU...", 93)
+	err := c.bootImage(ctx, run, image, cfg)
+	if ctx.Err() != nil {
+		return
+	}
+	run.mu.Lock()
+	if err == nil {
+		run.smoke, run.smokeErr = db.ImageSmokePassed, ""
+	} else {
+		run.smoke, run.smokeErr = db.ImageSmokeFailed, err.Error()
+	}
+	run.mu.Unlock()
+	if err != nil {
+		run.logf("smoke test failed: %v", err)
+		c.raiseAlert("build", 0, fmt.Sprintf("image %s of %s failed its QEMU smoke test: %v", filepath.Base(image), run.profileName, err))
+		return
+	}
+	run.logf("smoke test passed")
+}
+
+func (c *Controller) bootImage(ctx context.Context, run *buildRun, image string, cfg *db.GoldenImageConfig) error {
+	if _, err := exec.LookPath("qemu-system-aarch64"); err != nil {
+		return errors.New("qemu-system-aarch64 is not installed")
+	}
+	dir, err := os.MkdirTemp("", "openrobot-smoke-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	kernel, initrd, err := smokeKernel(image, dir)
+	if err != nil {
+		return err
+	}
+
+	broker, err := newSmokeBroker()
+	if err != nil {
+		return err
+	}
+	defer broker.Close()
+	// The image's own user-data, but without enrolling and with the
+	// throwaway broker.
+	smokeCfg := *cfg
+	smokeCfg.ControllerURL = ""
+	smokeCfg.MQTTBroker = fmt.Sprintf("tcp://%s:%d", smokeHost, broker.port())
+	userData, err := c.renderUserData(ctx, &smokeCfg)
+	if err != nil {
+		return err
+	}
+	seed, err := serveSmokeSeed(userData, run.id)
+	if err != nil {
+		return err
+	}
+	defer seed.Close()
+	seedPort := seed.Addr().(*net.TCPAddr).Port
+
+	ctx, cancel := context.WithTimeout(ctx, smokeTimeout())
+	defer cancel()
+	args := []string{
+		"-M", "virt", "-m", "2048", "-smp", "2", "-nographic",
+		"-kernel", kernel, "-initrd", initrd,
+		"-append", fmt.Sprintf("root=LABEL=writable rootwait console=ttyAMA0 net.ifnames=0 ds=nocloud-net;s=http://%s:%d/", smokeHost, seedPort),
+		// snapshot=on leaves the image as it was built.
+		"-drive", "file=" + image + ",format=raw,if=virtio,snapshot=on",
+		"-netdev", "user,id=net0", "-device", "virtio-net-pci,netdev=net0",
+	}
+	if _, err := os.Stat("/dev/kvm"); err == nil && runtime.GOARCH == "arm64" {
+		args = append(args, "-enable-kvm", "-cpu", "host")
+	} else {
+		args = append(args, "-cpu", "cortex-a72")
+	}
+	cmd := exec.CommandContext(ctx, "qemu-system-aarch64", args...)
+	console, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = cmd.Stdout
+	run.logf("booting %s (up to %s)...", filepath.Base(image), smokeTimeout())
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start qemu: %v", err)
+	}
+	tail := make([]string, 0, smokeConsoleLines)
+	var tailMu sync.Mutex
+	exited := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(console)
+		for scanner.Scan() {
+			tailMu.Lock()
+			if len(tail) == smokeConsoleLines {
+				tail = tail[1:]
+			}
+			tail = append(tail, scanner.Text())
+			tailMu.Unlock()
+		}
+		exited <- cmd.Wait()
+	}()
+	stop := func() {
+		cmd.Process.Kill()
+		<-exited
+	}
+
+	var result error
+	select {
+	case agentID := <-broker.connected:
+		run.logf("agent %s connected to the test broker", agentID)
+		select {
+		case topic := <-broker.status:
+			run.logf("agent published %s", topic)
+			stop()
+			return nil
+		case err := <-exited:
+			result = fmt.Errorf("qemu exited before the agent published its status: %v", err)
+		case <-ctx.Done():
+			result = fmt.Errorf("agent connected but published no status within %s", smokeTimeout())
+			stop()
+		}
+	case err := <-exited:
+		result = fmt.Errorf("qemu exited before the agent connected: %v", err)
+	case <-ctx.Done():
+		result = fmt.Errorf("agent didn't connect within %s", smokeTimeout())
+		stop()
+	}
+	tailMu.Lock()
+	for _, line := range tail {
+		run.logf("[console] %s", line)
+	}
+	tailMu.Unlock()
+	return result
+}
+
+// smokeKernel copies the kernel and initrd to boot with out of the image's
+// boot partition, unless BUILD_SMOKE_KERNEL and BUILD_SMOKE_INITRD name
+// others, e.g. a generic arm64 kernel where the image's doesn't suit QEMU's
+// virt machine.
+func smokeKernel(image, dir string) (string, string, error) {
+	if k, i := os.Getenv("BUILD_SMOKE_KERNEL"), os.Getenv("BUILD_SMOKE_INITRD"); k != "" && i != "" {
+		return k, i, nil
+	}
+	if _, err := exec.LookPath("mcopy"); err != nil {
+		return "", "", errors.New("mcopy (mtools) is needed to read the kernel from the image, or set BUILD_SMOKE_KERNEL and BUILD_SMOKE_INITRD")
+	}
+	offset, err := bootPartitionOffset(image)
+	if err != nil {
+		return "", "", err
+	}
+	kernel, initrd := filepath.Join(dir, "vmlinuz"), filepath.Join(dir, "initrd.img")
+	for _, f := range []string{kernel, initrd} {
+		src := fmt.Sprintf("%s@@%d", image, offset)
+		if out, err := exec.Command("mcopy", "-n", "-i", src, "::"+filepath.Base(f), f).CombinedOutput(); err != nil {
+			return "", "", fmt.Errorf("copy %s from the boot partition: %v: %s", filepath.Base(f), err, strings.TrimSpace(string(out)))
+		}
+	}
+	return kernel, initrd, nil
+}
+
+// bootPartitionOffset returns where the image's first partition starts,
+// from its MBR.
+func bootPartitionOffset(image string) (int64, error) {
+	f, err := os.Open(image)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	mbr := make([]byte, 512)
+	if _, err := io.ReadFull(f, mbr); err != nil {
+		return 0, fmt.Errorf("read partition table: %v", err)
+	}
+	if mbr[510] != 0x55 || mbr[511] != 0xaa {
+		return 0, errors.New("image has no MBR partition table")
+	}
+	lba := binary.LittleEndian.Uint32(mbr[446+8:])
+	if lba == 0 {
+		return 0, errors.New("image has no first partition")
+	}
+	return int64(lba) * 512, nil
+}
+
+// serveSmokeSeed serves user-data to the booting image as a NoCloud seed.
+func serveSmokeSeed(userData []byte, buildID int64) (net.Listener, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user-data", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(userData)
+	})
+	mux.HandleFunc("/meta-data", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "instance-id: openrobot-smoke-%d\n", buildID)
+	})
+	mux.HandleFunc("/vendor-data", func(w http.ResponseWriter, r *http.Request) {})
+	go http.Serve(ln, mux)
+	return ln, nil
+}
+
+// smokeBroker is just enough of an MQTT 3.1.1 broker for an agent to
+// connect, subscribe and publish to. It delivers nothing; it reports the
+// client ID of each agent that connects and the topic of each status it
+// publishes.
+type smokeBroker struct {
+	ln        net.Listener
+	connected chan string
+	status    chan string
+}
+
+func newSmokeBroker() (*smokeBroker, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	b := &smokeBroker{ln: ln, connected: make(chan string, 8), status: make(chan string, 8)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b, nil
+}
+
+func (b *smokeBroker) port() int { return b.ln.Addr().(*net.TCPAddr).Port }
+
+func (b *smokeBroker) Close() error { return b.ln.Close() }
+
+func (b *smokeBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		conn.SetDeadline(time.Now().Add(5 * time.Minute))
+		header, body, err := readMQTTPacket(r)
+		if err != nil {
+			return
+		}
+		var reply []byte
+		switch header >> 4 {
+		case 1: // CONNECT
+			reply = []byte{0x20, 2, 0, 0}
+			notify(b.connected, mqttConnectClientID(body))
+		case 3: // PUBLISH
+			if len(body) < 2 {
+				return
+			}
+			n := int(binary.BigEndian.Uint16(body))
+			if len(body) < 2+n {
+				return
+			}
+			topic := string(body[2 : 2+n])
+			if strings.HasPrefix(topic, "lab/status/") {
+				notify(b.status, topic)
+			}
+			switch qos := header >> 1 & 3; {
+			case qos == 1 && len(body) >= 4+n:
+				reply = []byte{0x40, 2, body[2+n], body[3+n]}
+			case qos == 2 && len(body) >= 4+n:
+				reply = []byte{0x50, 2, body[2+n], body[3+n]}
+			}
+		case 6: // PUBREL
+			if len(body) >= 2 {
+				reply = []byte{0x70, 2, body[0], body[1]}
+			}
+		case 8: // SUBSCRIBE: grant QoS 0 to each topic filter
+			if len(body) < 2 {
+				return
+			}
+			granted := 0
+			for p := 2; p+2 <= len(body); {
+				p += 2 + int(binary.BigEndian.Uint16(body[p:])) + 1
+				granted++
+			}
+			reply = append([]byte{0x90, byte(2 + granted), body[0], body[1]}, make([]byte, granted)...)
+		case 10: // UNSUBSCRIBE
+			if len(body) >= 2 {
+				reply = []byte{0xb0, 2, body[0], body[1]}
+			}
+		case 12: // PINGREQ
+			reply = []byte{0xd0, 0}
+		case 14: // DISCONNECT
+			return
+		}
+		if reply != nil {
+			if _, err := conn.Write(reply); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readMQTTPacket reads one control packet's first byte and the rest of it.
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var length, shift int
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(c&0x7f) << shift
+		if c&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	return header, body, err
+}
+
+// mqttConnectClientID picks the client ID out of a CONNECT packet's body.
+func mqttConnectClientID(body []byte) string {
+	if len(body) < 2 {
+		return ""
+	}
+	// Protocol name, then level, flags and keep-alive.
+	p := 2 + int(binary.BigEndian.Uint16(body)) + 4
+	if len(body) < p+2 {
+		return ""
+	}
+	n := int(binary.BigEndian.Uint16(body[p:]))
+	if len(body) < p+2+n {
+		return ""
+	}
+	return string(body[p+2 : p+2+n])
+}
+
+// notify sends v on ch unless nobody is reading it.
+func notify(ch chan string, v string) {
+	select {
+	case ch <- v:
+	default:
+	}
+}
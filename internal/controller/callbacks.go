@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AgentCallback reports whether r is an agent callback carrying a valid token
+// for its route. Agents post speed test transfers, sensor and camera
+// snapshots, formation reports, teleop answers and ROS bags to
+// /api/robots/{id}/... with a per-request token instead of the admin cookie,
+// so only these exact routes are let through without it, and only while the
+// token is live for that robot.
+func (c *Controller) AgentCallback(r *http.Request) bool {
+	token := r.URL.Query().Get("token")
+	rest, ok := strings.CutPrefix(r.URL.Path, "/api/robots/")
+	if token == "" || !ok {
+		return false
+	}
+	parts := strings.Split(rest, "/")
+	robotID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return false
+	}
+	switch strings.Join(parts[1:], "/") {
+	case "speedtest/payload", "speedtest/upload", "speedtest/result":
+		_, ok := c.speedTests.get(token, robotID)
+		return ok
+	case "sensors/result":
+		return c.sensors.expects(token, robotID)
+	case "formation/result":
+		return c.formations.expects(token, robotID)
+	case "teleop/answer":
+		return c.teleop.expects(token, robotID)
+	}
+	if len(parts) != 3 {
+		return false
+	}
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return false
+	}
+	switch parts[1] {
+	case "snapshots":
+		snap, err := c.DB.GetSnapshot(r.Context(), id)
+		return err == nil && snap.RobotID == robotID && subtle.ConstantTimeCompare([]byte(snap.Token), []byte(token)) == 1
+	case "bags":
+		bag, err := c.DB.GetBag(r.Context(), id)
+		return err == nil && bag.RobotID == robotID && subtle.ConstantTimeCompare([]byte(bag.Token), []byte(token)) == 1
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+const (
+	defaultCameraPort = 8090
+	// cameraConnectWait is how long the robot has to open its camera after
+	// camera_stream is queued.
+	cameraConnectWait = 15 * time.Second
+	cameraRetry       = 500 * time.Millisecond
+)
+
+// cameraPort is where agents serve the live view, ROBOT_CAMERA_PORT or 8090.
+func cameraPort() int {
+	if v, err := strconv.Atoi(os.Getenv("ROBOT_CAMERA_PORT")); err == nil && v > 0 && v <= 65535 {
+		return v
+	}
+	return defaultCameraPort
+}
+
+// cameraClient has no timeout: a live view lasts until the viewer leaves or
+// the agent ends it.
+var cameraClient = &http.Client{}
+
+// GetRobotCamera proxies a live MJPEG view of the robot's camera. It asks
+// the agent to open the stream with camera_stream, then connects to it with
+// the one-time token it sent.
+func (c *Controller) GetRobotCamera(w http.ResponseWriter, r *http.Request) {
+	id, err := parseRobotID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid robot id")
+		return
+	}
+	robot, err := c.DB.GetRobotByID(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(w, http.StatusNotFound, "robot not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("camera fetch robot", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to fetch robot")
+		return
+	}
+	if robot.AgentID == "" || robot.IP == "" {
+		respondError(w, http.StatusBadRequest, "robot has no agent attached")
+		return
+	}
+	if robot.Status == "offline" {
+		respondError(w, http.StatusConflict, "robot is offline")
+		return
+	}
+
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	token := hex.EncodeToString(buf)
+	port := cameraPort()
+	data, _ := json.Marshal(agent.CameraStreamData{Token: token, Port: port})
+	if _, err := c.queueRobotCommand(r.Context(), robot, agent.Command{Type: "camera_stream", Data: data}); err != nil {
+		logging.FromContext(r.Context()).Error("queue camera stream", "robot", robot.Name, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to queue camera_stream")
+		return
+	}
+
+	// The agent only knows the token once the command reaches it, so keep
+	// trying until it accepts it.
+	url := fmt.Sprintf("http://%s/camera?token=%s", net.JoinHostPort(robot.IP, strconv.Itoa(port)), token)
+	deadline := time.Now().Add(cameraConnectWait)
+	var resp *http.Response
+	for {
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, url, nil)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to reach robot")
+			return
+		}
+		resp, err = cameraClient.Do(req)
+		if err == nil {
+			if resp.StatusCode == http.StatusOK {
+				break
+			}
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 500))
+			resp.Body.Close()
+			switch resp.StatusCode {
+			case http.StatusConflict:
+				respondError(w, http.StatusConflict, "camera is already streaming to another viewer")
+				return
+			case http.StatusServiceUnavailable:
+				respondError(w, http.StatusBadGateway, string(msg))
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			respondError(w, http.StatusGatewayTimeout, "robot did not open its camera")
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(cameraRetry):
+		}
+	}
+	defer resp.Body.Close()
+
+	c.audit(r.Context(), "camera.view", robot.Name, "")
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	chunk := make([]byte, 32<<10)
+	for {
+		n, err := resp.Body.Read(chunk)
+		if n > 0 {
+			if _, werr := w.Write(chunk[:n]); werr != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -14,6 +13,8 @@ import (
 	"time"
 
 	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/events"
+	"example.com/openrobot-fleet/internal/logging"
 	mqttc "example.com/openrobot-fleet/internal/mqtt"
 )
 
@@ -21,35 +22,64 @@ type RobotJobState struct {
 	JobID     string
 	JobStatus string
 	JobError  string
-	UpdatedAt time.Time
+	JobSteps  []db.JobStep
+	// JobProgress is the last progress line the agent reported.
+	JobProgress string
+	UpdatedAt   time.Time
 }
 
 // Controller holds shared dependencies for HTTP handlers.
 type Controller struct {
-	DB            *db.DB
-	MQTT          *mqttc.Client
-	OnBuildUpdate func(status string, progress int, step string, logs []string, errorMsg string, imageName string)
+	DB   *db.DB
+	MQTT *mqttc.Client
+	// Events carries build progress, alerts and semester progress to
+	// whoever subscribed, such as the websocket hub.
+	Events *events.Bus
 
 	jobStates   map[string]RobotJobState
 	jobStatesMu sync.RWMutex
+
+	speedTests speedTestRegistry
+	sensors    sensorRegistry
+	recovery   recoveryRegistry
+	telemetry  telemetryThrottle
+	heartbeats heartbeatTracker
+	formations formationRegistry
+	teleop     teleopRegistry
+	semester   semesterRun
+	builds     buildRegistry
+	battery    batteryWatch
+	// onboarded holds the robots OnboardRobot has already looked at since
+	// the controller started, so heartbeats don't hit the database.
+	onboarded sync.Map
+	// refusedAgents holds new agents turned away by the robot limit, so
+	// each is alerted on once.
+	refusedAgents sync.Map
+	// unknownEnrollments holds robots that asked to enroll without a slot
+	// in the enrollment pool, so each is alerted on once.
+	unknownEnrollments sync.Map
+	rejected           rejectedAgents
 }
 
 func New(dbConn *db.DB, mqttClient *mqttc.Client) *Controller {
 	return &Controller{
 		DB:        dbConn,
 		MQTT:      mqttClient,
+		Events:    events.New(),
 		jobStates: make(map[string]RobotJobState),
 	}
 }
 
-func (c *Controller) UpdateRobotJobStatus(agentID, jobID, status, errStr string) {
+func (c *Controller) UpdateRobotJobStatus(agentID, jobID, status, errStr string, steps []db.JobStep, progress string) {
 	c.jobStatesMu.Lock()
 	defer c.jobStatesMu.Unlock()
 	c.jobStates[agentID] = RobotJobState{
-		JobID:     jobID,
-		JobStatus: status,
-		JobError:  errStr,
-		UpdatedAt: time.Now(),
+		JobID:       jobID,
+		JobStatus:   status,
+		JobError:    errStr,
+		JobSteps:    steps,
+		JobProgress: progress,
+		UpdatedAt:   time.Now(),
 	}
 }
 
@@ -136,40 +166,63 @@ func (c *Controller) HandleRobotUpload(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "invalid robot id")
 		return
 	}
+	if msg := c.usageLimitReached(r.Context(), "storage"); msg != "" {
+		respondError(w, http.StatusForbidden, msg)
+		return
+	}
 
+	r.Body = http.MaxBytesReader(w, r.Body, maxSnapshotBytes)
 	file, _, err := r.FormFile("image")
 	if err != nil {
 		respondError(w, http.StatusBadRequest, "failed to get image")
 		return
 	}
 	defer file.Close()
-
-	// Save to web/dist/snapshots/<id>.jpg
-	webRoot := os.Getenv("WEB_ROOT")
-	if webRoot == "" {
-		webRoot = "./web/dist"
-	}
-	snapDir := filepath.Join(webRoot, "snapshots")
-	if err := os.MkdirAll(snapDir, 0755); err != nil {
-		log.Printf("failed to create snapshot dir: %v", err)
-		respondError(w, http.StatusInternalServerError, "failed to save")
+	image, err := io.ReadAll(file)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "failed to read image")
 		return
 	}
 
-	dstPath := filepath.Join(snapDir, fmt.Sprintf("%d.jpg", id))
-	out, err := os.Create(dstPath)
+	// The upload is kept in the robot's snapshot history, with the job that
+	// took it if the uploader says which, and becomes its latest snapshot.
+	snap := db.Snapshot{RobotID: id, Status: db.SnapshotStored}
+	if v := r.FormValue("job_id"); v != "" {
+		jobID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid job_id")
+			return
+		}
+		snap.JobID = &jobID
+	}
+	now := time.Now().UTC()
+	snap.CreatedAt, snap.CompletedAt = now, &now
+	snapID, err := c.DB.CreateSnapshot(r.Context(), snap)
 	if err != nil {
-		log.Printf("failed to create snapshot file: %v", err)
+		logging.FromContext(r.Context()).Error("record snapshot", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to save")
 		return
 	}
-	defer out.Close()
-
-	if _, err := io.Copy(out, file); err != nil {
-		log.Printf("failed to write snapshot file: %v", err)
+	if err := saveSnapshotImage(id, snapID, image); err != nil {
+		logging.FromContext(r.Context()).Error("failed to write snapshot file", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to save")
 		return
 	}
+	if err := os.WriteFile(snapshotPath(id), image, 0644); err != nil {
+		logging.FromContext(r.Context()).Error("failed to write snapshot file", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to save")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"status": "uploaded", "url": fmt.Sprintf("/snapshots/%d/%d.jpg", id, snapID)})
+}
 
-	respondJSON(w, http.StatusOK, map[string]string{"status": "uploaded", "url": fmt.Sprintf("/snapshots/%d.jpg", id)})
+// snapshotPath is where the latest camera snapshot of a robot is stored:
+// web/dist/snapshots/<id>.jpg, served alongside the dashboard.
+func snapshotPath(robotID int64) string {
+	webRoot := os.Getenv("WEB_ROOT")
+	if webRoot == "" {
+		webRoot = "./web/dist"
+	}
+	return filepath.Join(webRoot, "snapshots", fmt.Sprintf("%d.jpg", robotID))
 }
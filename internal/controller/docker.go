@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// RollbackDocker queues a docker_rollback, which redeploys the image or
+// compose project the robot ran before its current docker scenario.
+func (c *Controller) RollbackDocker(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDFromPath(strings.TrimSuffix(r.URL.Path, "/docker/rollback"), "/api/robots/")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid robot id")
+		return
+	}
+	robot, err := c.DB.GetRobotByID(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(w, http.StatusNotFound, "robot not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("fetch robot for docker rollback", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to fetch robot")
+		return
+	}
+	if robot.Docker == nil || !robot.Docker.CanRollback {
+		respondError(w, http.StatusConflict, "robot has no previous docker deployment to roll back to")
+		return
+	}
+	job, err := c.queueRobotCommand(r.Context(), robot, agent.Command{Type: "docker_rollback"})
+	if errors.Is(err, errPayloadKeyMissing) || errors.Is(err, db.ErrRobotArchived) {
+		respondError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("queue docker rollback", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to queue rollback")
+		return
+	}
+	respondJSON(w, http.StatusCreated, job)
+}
@@ -0,0 +1,225 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/scenario"
+)
+
+const (
+	defaultDriftCheckInterval = 5 * time.Minute
+	// remediateBackoff is how long a robot that is still drifting after
+	// update_repo was queued waits before it is queued again.
+	remediateBackoff = time.Hour
+	// driftActor issues and audits the update_repo jobs of auto-remediation.
+	driftActor = "drift-watch"
+)
+
+// driftCheckInterval is how often robots are compared with their scenarios.
+// Override with DRIFT_CHECK_INTERVAL_SEC.
+func driftCheckInterval() time.Duration {
+	if v := os.Getenv("DRIFT_CHECK_INTERVAL_SEC"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+			return time.Duration(secs) * time.Second
+		}
+	}
+	return defaultDriftCheckInterval
+}
+
+// RunDriftWatch compares the workspace each agent reports with the repo its
+// last applied scenario clones, records the differences on the robot (shown
+// as drift in /api/robots) and raises a "drift" alert when a robot starts to
+// drift. With DRIFT_AUTO_REMEDIATE=true it also queues update_repo for online
+// robots that drift, which discards any local changes in the checkout.
+func (c *Controller) RunDriftWatch(ctx context.Context) {
+	remediate := os.Getenv("DRIFT_AUTO_REMEDIATE") == "true"
+	ticker := time.NewTicker(driftCheckInterval())
+	defer ticker.Stop()
+	remediated := map[int64]time.Time{}
+	for {
+		if err := c.checkDrift(ctx, remediate, remediated); err != nil {
+			slog.Error("drift watch", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkDrift runs one round of RunDriftWatch. remediated holds when
+// update_repo was last queued for each drifting robot.
+func (c *Controller) checkDrift(ctx context.Context, remediate bool, remediated map[int64]time.Time) error {
+	robots, err := c.DB.ListRobots(ctx)
+	if err != nil {
+		return fmt.Errorf("list robots: %w", err)
+	}
+	specs := map[int64]*scenario.Spec{}
+	reasons := make(map[int64][]string, len(robots))
+	for _, r := range robots {
+		if r.LastScenario == nil {
+			continue
+		}
+		spec, ok := specs[r.LastScenario.ID]
+		if !ok {
+			spec = c.driftSpec(ctx, r.LastScenario.ID)
+			specs[r.LastScenario.ID] = spec
+		}
+		if spec == nil {
+			continue
+		}
+		rs, err := spec.Drift(r)
+		if err != nil {
+			slog.Warn("drift watch: render scenario", "robot", r.Name, "scenario", r.LastScenario.Name, "err", err)
+			continue
+		}
+		reasons[r.ID] = rs
+	}
+	for id, rs := range commitOutliers(robots, reasons) {
+		reasons[id] = append(reasons[id], rs)
+	}
+
+	now := time.Now().UTC()
+	for _, r := range robots {
+		rs := reasons[r.ID]
+		if len(rs) == 0 {
+			delete(remediated, r.ID)
+			if r.Drift != nil {
+				if err := c.DB.UpdateRobotDrift(ctx, r.ID, nil); err != nil {
+					slog.Error("drift watch: clear drift", "robot", r.Name, "err", err)
+				}
+				slog.Info("robot back in sync with its scenario", "robot", r.Name)
+			}
+			continue
+		}
+		// A scenario being applied changes the checkout soon; judge it once
+		// the robot's jobs have run.
+		if c.hasPendingJobs(ctx, r.AgentID) {
+			continue
+		}
+		if r.Drift == nil || !slices.Equal(r.Drift.Reasons, rs) {
+			drift := &db.RobotDrift{Reasons: rs, Since: now}
+			if r.Drift != nil {
+				drift.Since = r.Drift.Since
+			}
+			if err := c.DB.UpdateRobotDrift(ctx, r.ID, drift); err != nil {
+				slog.Error("drift watch: record drift", "robot", r.Name, "err", err)
+			}
+		}
+		if r.Drift == nil {
+			msg := fmt.Sprintf("%s drifted from scenario %s: %s", r.Name, r.LastScenario.Name, strings.Join(rs, "; "))
+			slog.Warn("robot drifted", "robot", r.Name, "scenario", r.LastScenario.Name, "reasons", rs)
+			c.raiseAlert("drift", r.ID, msg)
+		}
+		if remediate && r.Status != "offline" && now.Sub(remediated[r.ID]) >= remediateBackoff {
+			if err := c.remediateDrift(ctx, r, specs[r.LastScenario.ID]); err != nil {
+				slog.Error("drift watch: remediate", "robot", r.Name, "err", err)
+				continue
+			}
+			remediated[r.ID] = now
+		}
+	}
+	return nil
+}
+
+// driftSpec loads a scenario for the drift check, or nil if it can't be
+// used; the error is logged rather than failing the round.
+func (c *Controller) driftSpec(ctx context.Context, id int64) *scenario.Spec {
+	s, err := c.DB.GetScenarioByID(ctx, id)
+	if err != nil {
+		slog.Warn("drift watch: load scenario", "scenario_id", id, "err", err)
+		return nil
+	}
+	spec, err := c.loadScenarioSpec(ctx, s)
+	if err != nil {
+		slog.Warn("drift watch: parse scenario", "scenario", s.Name, "err", err)
+		return nil
+	}
+	return &spec
+}
+
+// commitOutliers flags robots whose checkout is otherwise in sync but at a
+// different commit than most robots on the same scenario, e.g. one that
+// missed the last deploy. Scenarios without a clear majority are left alone.
+func commitOutliers(robots []db.Robot, reasons map[int64][]string) map[int64]string {
+	byScenario := map[int64][]db.Robot{}
+	for _, r := range robots {
+		if rs, checked := reasons[r.ID]; !checked || len(rs) > 0 || r.Workspace == nil || r.Workspace.Commit == "" {
+			continue
+		}
+		byScenario[r.LastScenario.ID] = append(byScenario[r.LastScenario.ID], r)
+	}
+	out := map[int64]string{}
+	for _, group := range byScenario {
+		counts := map[string]int{}
+		for _, r := range group {
+			counts[r.Workspace.Commit]++
+		}
+		if len(counts) < 2 {
+			continue
+		}
+		var majority string
+		for commit, n := range counts {
+			if 2*n > len(group) {
+				majority = commit
+			}
+		}
+		if majority == "" {
+			continue
+		}
+		for _, r := range group {
+			if r.Workspace.Commit != majority {
+				out[r.ID] = fmt.Sprintf("at commit %s, %d of %d robots on this scenario are at %s",
+					scenario.ShortCommit(r.Workspace.Commit), counts[majority], len(group), scenario.ShortCommit(majority))
+			}
+		}
+	}
+	return out
+}
+
+// hasPendingJobs reports whether the robot has jobs from the last hour that
+// haven't finished. Older ones are taken to be lost.
+func (c *Controller) hasPendingJobs(ctx context.Context, agentID string) bool {
+	since := time.Now().Add(-time.Hour)
+	for _, status := range []string{"queued", "running", "deferred"} {
+		jobs, err := c.DB.ListJobs(ctx, db.JobFilter{Target: agentID, Status: status, Since: since, Limit: 1})
+		if err != nil {
+			slog.Warn("drift watch: list jobs", "agent_id", agentID, "err", err)
+			return true
+		}
+		if len(jobs) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// remediateDrift re-queues the scenario's update_repo for robot.
+func (c *Controller) remediateDrift(ctx context.Context, robot db.Robot, spec *scenario.Spec) error {
+	cmds, err := spec.Commands(robot)
+	if err != nil {
+		return err
+	}
+	for _, cmd := range cmds {
+		if cmd.Type != "update_repo" {
+			continue
+		}
+		ctx = context.WithValue(ctx, attributionKey{}, attribution{actor: driftActor})
+		job, err := c.queueRobotCommand(ctx, robot, cmd)
+		if err != nil {
+			return err
+		}
+		slog.Info("queued update_repo to fix drift", "robot", robot.Name, "job_id", job.ID)
+		return nil
+	}
+	return nil
+}
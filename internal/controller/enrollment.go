@@ -0,0 +1,489 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// Zero-touch provisioning: the golden image carries a provisioning token and
+// the controller's URL. A freshly flashed robot posts the token with its MAC
+// addresses and serial number to /api/enroll, and is enrolled under the name
+// its slot in the enrollment pool gives it.
+
+const provisioningTokenKey = "provisioning_token"
+
+// provisioningTokens is what provisioningTokenKey holds, sealed. Images are
+// downloaded without login, so a token is only good for two image TTLs. It
+// is replaced once less than one TTL is left, and the one it replaces stays
+// good until it expires, so every image gets at least a TTL to enroll in.
+type provisioningTokens struct {
+	Current  provisioningTokenEntry  `json:"current"`
+	Previous *provisioningTokenEntry `json:"previous,omitempty"`
+}
+
+type provisioningTokenEntry struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (e *provisioningTokenEntry) valid(now time.Time) bool {
+	return e != nil && e.Token != "" && now.Before(e.ExpiresAt)
+}
+
+func (c *Controller) loadProvisioningTokens(ctx context.Context) (provisioningTokens, error) {
+	var tokens provisioningTokens
+	raw, err := c.DB.GetSecretSetting(ctx, provisioningTokenKey)
+	if err != nil || raw == "" {
+		return tokens, err
+	}
+	if json.Unmarshal([]byte(raw), &tokens) != nil {
+		// A token saved before tokens expired: give images built with it
+		// one TTL from now.
+		tokens = provisioningTokens{Current: provisioningTokenEntry{Token: raw, ExpiresAt: time.Now().Add(imageEnrollmentTTL())}}
+	}
+	return tokens, nil
+}
+
+// provisioningToken returns the token to bake into golden images, creating
+// or replacing it when it has less than one image TTL left.
+func (c *Controller) provisioningToken(ctx context.Context) (provisioningTokenEntry, error) {
+	tokens, err := c.loadProvisioningTokens(ctx)
+	if err != nil {
+		return provisioningTokenEntry{}, err
+	}
+	if tokens.Current.valid(time.Now().Add(imageEnrollmentTTL())) {
+		return tokens.Current, nil
+	}
+	var previous *provisioningTokenEntry
+	if tokens.Current.valid(time.Now()) {
+		previous = &tokens.Current
+	}
+	return c.saveProvisioningToken(ctx, previous)
+}
+
+// rotateProvisioningToken replaces the token at once; images built with the
+// old one can no longer enroll.
+func (c *Controller) rotateProvisioningToken(ctx context.Context) (provisioningTokenEntry, error) {
+	return c.saveProvisioningToken(ctx, nil)
+}
+
+func (c *Controller) saveProvisioningToken(ctx context.Context, previous *provisioningTokenEntry) (provisioningTokenEntry, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return provisioningTokenEntry{}, err
+	}
+	tokens := provisioningTokens{
+		Current:  provisioningTokenEntry{Token: hex.EncodeToString(buf), ExpiresAt: time.Now().Add(2 * imageEnrollmentTTL()).UTC()},
+		Previous: previous,
+	}
+	raw, err := json.Marshal(tokens)
+	if err != nil {
+		return provisioningTokenEntry{}, err
+	}
+	if err := c.DB.SaveSecretSetting(ctx, provisioningTokenKey, string(raw)); err != nil {
+		return provisioningTokenEntry{}, err
+	}
+	return tokens.Current, nil
+}
+
+type provisioningTokenResponse struct {
+	Token string `json:"token"`
+	// ExpiresAt is when images built with the token stop enrolling.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// GetProvisioningToken shows the token images are built with.
+func (c *Controller) GetProvisioningToken(w http.ResponseWriter, r *http.Request) {
+	token, err := c.provisioningToken(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("get provisioning token", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load provisioning token")
+		return
+	}
+	respondJSON(w, http.StatusOK, provisioningTokenResponse{Token: token.Token, ExpiresAt: token.ExpiresAt})
+}
+
+// RotateProvisioningToken replaces the token. Images built with the old one
+// can no longer enroll and have to be rebuilt.
+func (c *Controller) RotateProvisioningToken(w http.ResponseWriter, r *http.Request) {
+	token, err := c.rotateProvisioningToken(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("rotate provisioning token", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to rotate provisioning token")
+		return
+	}
+	c.audit(r.Context(), "enrollment.rotate_token", "", "")
+	respondJSON(w, http.StatusOK, provisioningTokenResponse{Token: token.Token, ExpiresAt: token.ExpiresAt})
+}
+
+// enrollmentSlotRequest pre-registers a robot in the enrollment pool. At
+// least one of MAC and Serial is required.
+type enrollmentSlotRequest struct {
+	Name   string `json:"name"`
+	MAC    string `json:"mac,omitempty"`
+	Serial string `json:"serial,omitempty"`
+	// Type is robot (default) or laptop.
+	Type  string   `json:"type,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+	Notes string   `json:"notes,omitempty"`
+}
+
+func (c *Controller) ListEnrollmentPool(w http.ResponseWriter, r *http.Request) {
+	slots, err := c.DB.ListEnrollmentSlots(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list enrollment pool", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to list enrollment pool")
+		return
+	}
+	respondJSON(w, http.StatusOK, slots)
+}
+
+// CreateEnrollmentSlot adds a robot to the enrollment pool.
+func (c *Controller) CreateEnrollmentSlot(w http.ResponseWriter, r *http.Request) {
+	var req enrollmentSlotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	slot := db.EnrollmentSlot{
+		Name:   strings.TrimSpace(req.Name),
+		Serial: normalizeSerial(req.Serial),
+		Type:   req.Type,
+		Notes:  req.Notes,
+	}
+	switch {
+	case slot.Name == "":
+		respondError(w, http.StatusBadRequest, "name is required")
+		return
+	case strings.ContainsAny(slot.Name, " \t\n/+#"):
+		// The name becomes the agent ID, which is part of MQTT topics.
+		respondError(w, http.StatusBadRequest, "name must not contain spaces, /, + or #")
+		return
+	case slot.Type != "" && slot.Type != "robot" && slot.Type != "laptop":
+		respondError(w, http.StatusBadRequest, "type must be robot or laptop")
+		return
+	case strings.TrimSpace(req.MAC) == "" && slot.Serial == "":
+		respondError(w, http.StatusBadRequest, "mac or serial is required")
+		return
+	}
+	if mac := strings.TrimSpace(req.MAC); mac != "" {
+		hw, err := net.ParseMAC(mac)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "mac is not a valid MAC address")
+			return
+		}
+		slot.MAC = hw.String()
+	}
+	for _, tag := range req.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || strings.Contains(tag, ",") {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid tag %q", tag))
+			return
+		}
+		if !slices.Contains(slot.Tags, tag) {
+			slot.Tags = append(slot.Tags, tag)
+		}
+	}
+
+	slots, err := c.DB.ListEnrollmentSlots(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list enrollment pool", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to check enrollment pool")
+		return
+	}
+	for _, s := range slots {
+		switch {
+		case s.Name == slot.Name:
+			respondError(w, http.StatusConflict, fmt.Sprintf("%s is already in the enrollment pool", slot.Name))
+			return
+		case slot.MAC != "" && s.MAC == slot.MAC:
+			respondError(w, http.StatusConflict, fmt.Sprintf("MAC %s is already registered for %s", slot.MAC, s.Name))
+			return
+		case slot.Serial != "" && s.Serial == slot.Serial:
+			respondError(w, http.StatusConflict, fmt.Sprintf("serial %s is already registered for %s", slot.Serial, s.Name))
+			return
+		}
+	}
+
+	id, err := c.DB.CreateEnrollmentSlot(r.Context(), slot)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("create enrollment slot", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to add to enrollment pool")
+		return
+	}
+	c.audit(r.Context(), "enrollment.add", slot.Name, strings.TrimSpace(slot.MAC+" "+slot.Serial))
+	created, err := c.DB.GetEnrollmentSlot(r.Context(), id)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("get enrollment slot", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to fetch enrollment slot")
+		return
+	}
+	respondJSON(w, http.StatusCreated, created)
+}
+
+// DeleteEnrollmentSlot removes a robot from the pool. A robot that already
+// enrolled stays in the fleet.
+// Path: /api/enrollment/pool/{id}
+func (c *Controller) DeleteEnrollmentSlot(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(filepath.Base(strings.TrimSuffix(r.URL.Path, "/")), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid slot id")
+		return
+	}
+	slot, err := c.DB.GetEnrollmentSlot(r.Context(), id)
+	if err == nil {
+		err = c.DB.DeleteEnrollmentSlot(r.Context(), id)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "enrollment slot not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("delete enrollment slot", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to delete enrollment slot")
+		return
+	}
+	c.audit(r.Context(), "enrollment.remove", slot.Name, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResetEnrollmentSlot lets a robot enroll through the slot again, after it
+// was re-flashed. The robot's payload key is dropped with it, since the
+// agent that held it is gone; the robot enrolls as the same robot and gets a
+// new one.
+// Path: /api/enrollment/pool/{id}/reset
+func (c *Controller) ResetEnrollmentSlot(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(filepath.Base(strings.TrimSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/reset")), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid slot id")
+		return
+	}
+	ctx := r.Context()
+	slot, err := c.DB.GetEnrollmentSlot(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, http.StatusNotFound, "enrollment slot not found")
+		return
+	}
+	if err == nil {
+		if robot, rerr := c.slotRobot(ctx, slot); rerr == nil {
+			err = c.DB.SetRobotPayloadKey(ctx, robot.ID, "")
+		} else if !errors.Is(rerr, sql.ErrNoRows) {
+			err = rerr
+		}
+	}
+	if err == nil {
+		err = c.DB.ResetEnrollmentSlot(ctx, id)
+	}
+	if err == nil {
+		slot, err = c.DB.GetEnrollmentSlot(ctx, id)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("reset enrollment slot", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to reset enrollment slot")
+		return
+	}
+	c.audit(ctx, "enrollment.reset", slot.Name, "")
+	respondJSON(w, http.StatusOK, slot)
+}
+
+// Enroll is called by a freshly flashed agent, authenticated by the
+// provisioning token baked into its image. It looks the robot up in the
+// enrollment pool by MAC address or serial number, enrolls it under the
+// slot's name and returns the identity the agent should adopt. A robot that
+// isn't in the pool yet gets 404, and an alert, and keeps asking. While the
+// pool is empty the answer is 204 and the robot starts under its own name.
+func (c *Controller) Enroll(w http.ResponseWriter, r *http.Request) {
+	var req agent.EnrollRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	ctx := r.Context()
+	ok, err := c.checkProvisionToken(ctx, req.Token)
+	if err != nil {
+		logging.FromContext(ctx).Error("enroll: load provisioning token", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to check provisioning token")
+		return
+	}
+	if !ok {
+		respondError(w, http.StatusUnauthorized, "invalid provisioning token")
+		return
+	}
+
+	macs := make([]string, 0, len(req.MACs))
+	for _, mac := range req.MACs {
+		if hw, err := net.ParseMAC(strings.TrimSpace(mac)); err == nil {
+			macs = append(macs, hw.String())
+		}
+	}
+	serial := normalizeSerial(req.Serial)
+	identity := strings.Join(append(slices.Clone(macs), serial), " ")
+
+	slot, err := c.DB.FindEnrollmentSlot(ctx, macs, serial)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Without a pool robots keep the random name the image gives them
+		// and are adopted as before.
+		if slots, lerr := c.DB.ListEnrollmentSlots(ctx); lerr == nil && len(slots) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if _, seen := c.unknownEnrollments.LoadOrStore(identity, true); !seen {
+			slog.Warn("enroll: robot not in enrollment pool", "hostname", req.Hostname, "ip", req.IP, "macs", macs, "serial", serial)
+			c.raiseAlert("enrollment", 0, fmt.Sprintf("%s (%s) asked to enroll but is not in the enrollment pool; add MAC %s or serial %s to enroll it",
+				req.Hostname, req.IP, strings.Join(macs, ", "), serial))
+		}
+		respondError(w, http.StatusNotFound, "robot is not in the enrollment pool")
+		return
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("enroll: find slot", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to look up enrollment pool")
+		return
+	}
+	c.unknownEnrollments.Delete(identity)
+	if slot.Type == "" && req.Type == "laptop" {
+		// An installed laptop says so; a slot's own type still wins.
+		slot.Type = req.Type
+	}
+
+	// Knowing a slot's MAC or serial must not be enough to take over the
+	// robot that enrolled through it, so a slot enrolls once until an
+	// operator resets it.
+	claimed, err := c.DB.ClaimEnrollmentSlot(ctx, slot.ID)
+	if err != nil {
+		logging.FromContext(ctx).Error("enroll: claim slot", "slot", slot.Name, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to enroll robot")
+		return
+	}
+	if !claimed {
+		c.refuseReenrollment(w, slot, req, identity)
+		return
+	}
+	enrolled := false
+	defer func() {
+		if !enrolled {
+			if err := c.DB.ResetEnrollmentSlot(context.Background(), slot.ID); err != nil {
+				slog.Error("enroll: release slot", "slot", slot.Name, "err", err)
+			}
+		}
+	}()
+
+	robot, err := c.enrollmentRobot(ctx, slot, req.IP)
+	if err != nil {
+		if errors.Is(err, errRobotLimit) {
+			respondError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		logging.FromContext(ctx).Error("enroll: create robot", "slot", slot.Name, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to enroll robot")
+		return
+	}
+	// A robot whose agent holds a payload key keeps it; handing out a new
+	// one would lock that agent out.
+	if key, err := c.DB.RobotPayloadKey(ctx, robot.ID); err != nil {
+		logging.FromContext(ctx).Error("enroll: load payload key", "robot", robot.Name, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to enroll robot")
+		return
+	} else if key != "" {
+		c.refuseReenrollment(w, slot, req, identity)
+		return
+	}
+	agentID := robot.AgentID
+	if agentID == "" {
+		agentID = robot.Name
+	}
+	if err := c.DB.UpsertRobotWithType(ctx, agentID, robot.Name, req.IP, "enrolled", slot.Type); err != nil {
+		logging.FromContext(ctx).Error("enroll: link agent", "robot", robot.Name, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to enroll robot")
+		return
+	}
+	payloadKey, err := agent.NewPayloadKey()
+	if err == nil {
+		err = c.DB.SetRobotPayloadKey(ctx, robot.ID, payloadKey)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("enroll: payload key", "robot", robot.Name, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to issue payload key")
+		return
+	}
+	if err := c.DB.MarkEnrollmentSlotEnrolled(ctx, slot.ID, robot.ID); err != nil {
+		logging.FromContext(ctx).Error("enroll: mark slot", "slot", slot.Name, "err", err)
+	}
+	enrolled = true
+	c.unknownEnrollments.Delete("enrolled " + identity)
+	slog.Info("enroll: robot enrolled", "robot", robot.Name, "agent_id", agentID, "ip", req.IP, "hostname", req.Hostname)
+	respondJSON(w, http.StatusOK, agent.EnrollResponse{AgentID: agentID, Type: slot.Type, PayloadKey: payloadKey})
+}
+
+// refuseReenrollment answers a robot asking to enroll through a slot whose
+// robot has already enrolled. It may be that robot re-flashed, or another
+// device that knows the slot's MAC or serial, so it keeps asking until an
+// operator resets the slot.
+func (c *Controller) refuseReenrollment(w http.ResponseWriter, slot db.EnrollmentSlot, req agent.EnrollRequest, identity string) {
+	if _, seen := c.unknownEnrollments.LoadOrStore("enrolled "+identity, true); !seen {
+		slog.Warn("enroll: slot already enrolled", "slot", slot.Name, "hostname", req.Hostname, "ip", req.IP)
+		var robotID int64
+		if slot.RobotID != nil {
+			robotID = *slot.RobotID
+		}
+		c.raiseAlert("enrollment", robotID, fmt.Sprintf("%s (%s) asked to enroll as %s, which has already enrolled; if the robot was re-flashed, reset its enrollment slot",
+			req.Hostname, req.IP, slot.Name))
+	}
+	respondError(w, http.StatusConflict, fmt.Sprintf("%s has already enrolled; reset its enrollment slot to enroll it again", slot.Name))
+}
+
+var errRobotLimit = errors.New("robot limit reached")
+
+// slotRobot returns the robot in the fleet a slot enrolls: the one that
+// enrolled through it before, or one added by hand under the slot's name.
+// It returns sql.ErrNoRows if there is none yet.
+func (c *Controller) slotRobot(ctx context.Context, slot db.EnrollmentSlot) (db.Robot, error) {
+	if slot.RobotID != nil {
+		if robot, err := c.DB.GetRobotByID(ctx, *slot.RobotID); err == nil {
+			return robot, nil
+		}
+	}
+	return c.DB.GetRobotByName(ctx, slot.Name)
+}
+
+// enrollmentRobot returns the robot a slot enrolls: the one that enrolled
+// through it before (the robot was re-flashed), one added by hand under the
+// slot's name, or a new one with the slot's tags and notes.
+func (c *Controller) enrollmentRobot(ctx context.Context, slot db.EnrollmentSlot, ip string) (db.Robot, error) {
+	if robot, err := c.slotRobot(ctx, slot); err == nil {
+		return robot, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return db.Robot{}, err
+	}
+	if !c.AllowEnrollment(ctx, slot.Name) {
+		return db.Robot{}, errRobotLimit
+	}
+	id, err := c.DB.CreateUnmanagedRobot(ctx, db.NewRobot{Name: slot.Name, Type: slot.Type, IP: ip, Tags: slot.Tags, Notes: slot.Notes})
+	if err != nil {
+		return db.Robot{}, err
+	}
+	return c.DB.GetRobotByID(ctx, id)
+}
+
+// normalizeSerial lower-cases a serial number and drops the NULs and
+// whitespace device trees pad it with.
+func normalizeSerial(s string) string {
+	return strings.ToLower(strings.Trim(s, "\x00 \t\r\n"))
+}
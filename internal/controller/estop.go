@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// fleetEStopKey stores the fleet e-stop while it is engaged, so the page
+// shows it after a reload and after a controller restart.
+const fleetEStopKey = "fleet_estop"
+
+type fleetEStopRequest struct {
+	Reason string `json:"reason"`
+}
+
+// stoppedRobot is a robot reporting a latched e-stop.
+type stoppedRobot struct {
+	ID     int64     `json:"id"`
+	Name   string    `json:"name"`
+	Since  time.Time `json:"since"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+type fleetEStopResponse struct {
+	Engaged bool       `json:"engaged"`
+	Since   *time.Time `json:"since,omitempty"`
+	Reason  string     `json:"reason,omitempty"`
+	// Robots have an e-stop latched, from the fleet one or their own. A robot
+	// that hasn't acknowledged the fleet e-stop yet isn't listed.
+	Robots []stoppedRobot `json:"robots"`
+}
+
+// GetFleetEStop reports the fleet e-stop and the robots that are stopped.
+func (c *Controller) GetFleetEStop(w http.ResponseWriter, r *http.Request) {
+	resp := fleetEStopResponse{Robots: []stoppedRobot{}}
+	raw, err := c.DB.GetSetting(r.Context(), fleetEStopKey)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("load fleet e-stop", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load e-stop")
+		return
+	}
+	if raw != "" {
+		var st db.RobotEStop
+		if err := json.Unmarshal([]byte(raw), &st); err == nil {
+			resp.Engaged = true
+			resp.Since = &st.Since
+			resp.Reason = st.Reason
+		}
+	}
+	robots, err := c.DB.ListRobots(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list robots", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to list robots")
+		return
+	}
+	for _, robot := range robots {
+		if robot.EStop != nil {
+			resp.Robots = append(resp.Robots, stoppedRobot{ID: robot.ID, Name: robot.Name, Since: robot.EStop.Since, Reason: robot.EStop.Reason})
+		}
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// EngageFleetEStop stops every robot. The estop is retained on its own
+// topic, which agents handle outside the job queue, so robots that are
+// offline stop as soon as they reconnect. It has no job: each robot reports
+// the stop in its heartbeat instead.
+func (c *Controller) EngageFleetEStop(w http.ResponseWriter, r *http.Request) {
+	var req fleetEStopRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid e-stop payload")
+			return
+		}
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	data, _ := json.Marshal(agent.EStopData{Reason: req.Reason})
+	cmd := agent.Command{Type: "estop", Data: data, CorrelationID: correlationID(r.Context()), Priority: agent.PriorityCritical}
+	payload, err := json.Marshal(cmd)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to encode e-stop")
+		return
+	}
+	if err := c.MQTT.Publish(agent.EStopTopic, 1, true, payload); err != nil {
+		logging.FromContext(r.Context()).Error("publish fleet e-stop", "err", err)
+		respondError(w, http.StatusServiceUnavailable, "failed to publish e-stop: "+err.Error())
+		return
+	}
+	st := db.RobotEStop{Since: time.Now().UTC(), Reason: req.Reason}
+	if raw, err := c.DB.GetSetting(r.Context(), fleetEStopKey); err == nil && raw != "" {
+		// Engaging it again keeps the original time, as the robots do.
+		var prev db.RobotEStop
+		if json.Unmarshal([]byte(raw), &prev) == nil {
+			st = prev
+		}
+	}
+	raw, _ := json.Marshal(st)
+	if err := c.DB.SaveSetting(r.Context(), fleetEStopKey, string(raw)); err != nil {
+		logging.FromContext(r.Context()).Error("save fleet e-stop", "err", err)
+	}
+	logging.FromContext(r.Context()).Warn("fleet e-stop engaged", "reason", req.Reason)
+	c.audit(r.Context(), "fleet.estop", "all", req.Reason)
+	c.GetFleetEStop(w, r)
+}
+
+// ClearFleetEStop releases the e-stop on every robot, including any that
+// were stopped on their own.
+func (c *Controller) ClearFleetEStop(w http.ResponseWriter, r *http.Request) {
+	// An empty retained message removes the estop, so robots connecting
+	// later aren't stopped again.
+	if err := c.MQTT.Publish(agent.EStopTopic, 1, true, nil); err != nil {
+		logging.FromContext(r.Context()).Error("clear retained fleet e-stop", "err", err)
+		respondError(w, http.StatusServiceUnavailable, "failed to clear e-stop: "+err.Error())
+		return
+	}
+	payload, _ := json.Marshal(agent.Command{Type: "estop_clear", CorrelationID: correlationID(r.Context()), Priority: agent.PriorityCritical})
+	if err := c.MQTT.Publish(agent.EStopTopic, 1, false, payload); err != nil {
+		logging.FromContext(r.Context()).Error("publish fleet e-stop clear", "err", err)
+		respondError(w, http.StatusServiceUnavailable, "failed to clear e-stop: "+err.Error())
+		return
+	}
+	if err := c.DB.SaveSetting(r.Context(), fleetEStopKey, ""); err != nil {
+		logging.FromContext(r.Context()).Error("save fleet e-stop", "err", err)
+	}
+	logging.FromContext(r.Context()).Info("fleet e-stop cleared")
+	c.audit(r.Context(), "fleet.estop_clear", "all", "")
+	c.GetFleetEStop(w, r)
+}
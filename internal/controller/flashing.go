@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// A card can be flashed for one particular robot: flash the profile's image
+// as usual, then replace user-data on its boot partition with the one
+// FlashDevice returns. The robot boots under the name on its label, and the
+// controller already has it, so it is linked as soon as its agent reports in.
+
+// deviceName is what a pre-registered robot may be called; it becomes its
+// hostname as well as its agent ID.
+var deviceName = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+type flashDeviceRequest struct {
+	Name string `json:"name"`
+	// Tags and Notes are only given to a robot the request creates.
+	Tags  []string `json:"tags,omitempty"`
+	Notes string   `json:"notes,omitempty"`
+}
+
+type flashDeviceResponse struct {
+	Robot db.Robot `json:"robot"`
+	// Created is false when a robot by that name was already registered,
+	// e.g. it is being re-flashed.
+	Created bool `json:"created"`
+	// UserData replaces user-data on the flashed card's boot partition.
+	UserData string `json:"user_data"`
+}
+
+// FlashDevice pre-registers a robot and returns user-data for a card
+// flashed with the profile's image that boots as that robot.
+func (c *Controller) FlashDevice(w http.ResponseWriter, r *http.Request) {
+	p, ok := c.imageProfileFromPath(w, r)
+	if !ok {
+		return
+	}
+	if p.Config.RobotModel == laptopModel {
+		respondError(w, http.StatusBadRequest, "laptop profiles aren't flashed; install Ubuntu with the profile's autoinstall file")
+		return
+	}
+	var req flashDeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if !deviceName.MatchString(req.Name) {
+		respondError(w, http.StatusBadRequest, "name must be a hostname: lowercase letters, digits and hyphens, at most 63 characters")
+		return
+	}
+	tags := make([]string, 0, len(req.Tags))
+	for _, tag := range req.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || strings.Contains(tag, ",") {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid tag %q", tag))
+			return
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	ctx := r.Context()
+	robot, err := c.DB.GetRobotByName(ctx, req.Name)
+	created := false
+	switch {
+	case err == nil:
+		if robot.AgentID != "" && robot.AgentID != req.Name {
+			respondError(w, http.StatusConflict, fmt.Sprintf("robot %q runs agent %q; rename it or pick another name", req.Name, robot.AgentID))
+			return
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		if msg, err := c.renameConflict(ctx, 0, req.Name); err != nil {
+			logging.FromContext(ctx).Error("flash device: check robot name", "err", err)
+			respondError(w, http.StatusInternalServerError, "failed to check robot name")
+			return
+		} else if msg != "" {
+			respondError(w, http.StatusConflict, msg)
+			return
+		}
+		if msg := c.usageLimitReached(ctx, "robots"); msg != "" {
+			respondError(w, http.StatusForbidden, msg)
+			return
+		}
+		id, err := c.DB.CreateUnmanagedRobot(ctx, db.NewRobot{Name: req.Name, Tags: tags, Notes: req.Notes})
+		if err != nil {
+			logging.FromContext(ctx).Error("flash device: create robot", "err", err)
+			respondError(w, http.StatusInternalServerError, "failed to create robot")
+			return
+		}
+		if robot, err = c.DB.GetRobotByID(ctx, id); err != nil {
+			logging.FromContext(ctx).Error("flash device: get robot", "err", err)
+			respondError(w, http.StatusInternalServerError, "failed to fetch robot")
+			return
+		}
+		created = true
+	default:
+		logging.FromContext(ctx).Error("flash device: get robot", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load robot")
+		return
+	}
+
+	userData, err := c.renderDeviceUserData(ctx, &p.Config, req.Name)
+	if err != nil {
+		logging.FromContext(ctx).Error("flash device: render user-data", "profile", p.Name, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to render user-data")
+		return
+	}
+	detail := "profile " + p.Name
+	if created {
+		detail += ", registered"
+	}
+	c.audit(ctx, "image.flash", req.Name, detail)
+	redactInstallConfig(&robot)
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	respondJSON(w, status, flashDeviceResponse{Robot: robot, Created: created, UserData: string(userData)})
+}
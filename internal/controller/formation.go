@@ -0,0 +1,398 @@
+package controller
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// A formation test has the selected robots drive forward together at a start
+// time the controller picks a few seconds ahead. Each agent reports when the
+// command arrived and when it moved, which shows whether commands reach the
+// whole fleet in time and the robots are ready to move, before a lab that
+// needs several of them at once.
+const (
+	defaultFormationDelay    = 5 * time.Second
+	minFormationDelay        = 2 * time.Second
+	maxFormationDelay        = time.Minute
+	defaultFormationDistance = 0.5
+	maxFormationDistance     = 2.0
+	defaultFormationSpeed    = 0.1
+	maxFormationSpeed        = 0.3
+	// formationReportGrace is how long after a robot should have finished
+	// its drive it may still report, before it is marked no_report.
+	formationReportGrace = 30 * time.Second
+	// formationSyncTolerance is how far apart the robots may start moving
+	// for the test to pass.
+	formationSyncTolerance = 500 * time.Millisecond
+	formationTTL           = 30 * time.Minute
+)
+
+type formationTestRequest struct {
+	RobotIDs []int64 `json:"robot_ids"`
+	// Selector adds every robot it matches, e.g. tag=classA.
+	Selector string `json:"selector,omitempty"`
+	// DelaySec is how far ahead the start time is (default 5).
+	DelaySec  float64 `json:"delay_sec,omitempty"`
+	DistanceM float64 `json:"distance_m,omitempty"`
+	SpeedMPS  float64 `json:"speed_mps,omitempty"`
+}
+
+// formationTest is one run and what the robots reported. Latencies and
+// offsets are corrected for each robot's clock offset, estimated from when
+// its report was sent and received, so they are only as exact as that one
+// HTTP round trip.
+type formationTest struct {
+	ID        string    `json:"id"`
+	IssuedAt  time.Time `json:"issued_at"`
+	StartAt   time.Time `json:"start_at"`
+	DistanceM float64   `json:"distance_m"`
+	SpeedMPS  float64   `json:"speed_mps"`
+	// Done is set once every robot has reported or run out of time.
+	Done bool `json:"done"`
+	// Ready is set when every robot got the command in time, drove, and
+	// started within formationSyncTolerance of the others.
+	Ready         bool             `json:"ready"`
+	MaxLatencyMs  int64            `json:"max_latency_ms"`
+	StartSpreadMs int64            `json:"start_spread_ms"`
+	Robots        []formationRobot `json:"robots"`
+}
+
+// formationRobot is one robot's part. Status is queued, done, late (the
+// command arrived after the start time), failed, skipped (not sent, e.g.
+// offline) or no_report. The times are set once the robot has reported.
+type formationRobot struct {
+	RobotID int64  `json:"robot_id"`
+	Name    string `json:"name"`
+	JobID   int64  `json:"job_id,omitempty"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	// LatencyMs is from the controller issuing the command to the robot
+	// receiving it.
+	LatencyMs int64 `json:"latency_ms"`
+	// StartOffsetMs is how long after the start time the robot moved.
+	StartOffsetMs int64 `json:"start_offset_ms"`
+	// ClockOffsetMs is how far the robot's clock is ahead of the
+	// controller's.
+	ClockOffsetMs int64 `json:"clock_offset_ms"`
+}
+
+// formationRegistry keeps recent formation tests and routes the agents'
+// reports, which carry a per-robot token instead of the admin cookie.
+type formationRegistry struct {
+	mu     sync.Mutex
+	tests  map[string]*formationTest
+	tokens map[string]formationToken
+}
+
+type formationToken struct {
+	testID  string
+	robotID int64
+	expires time.Time
+}
+
+func newFormationID() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func (r *formationRegistry) add(t *formationTest) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tests == nil {
+		r.tests = make(map[string]*formationTest)
+		r.tokens = make(map[string]formationToken)
+	}
+	now := time.Now()
+	for id, old := range r.tests {
+		if now.Sub(old.IssuedAt) > formationTTL {
+			delete(r.tests, id)
+		}
+	}
+	for tok, ref := range r.tokens {
+		if now.After(ref.expires) {
+			delete(r.tokens, tok)
+		}
+	}
+	r.tests[t.ID] = t
+}
+
+func (r *formationRegistry) token(testID string, robotID int64) string {
+	tok := newFormationID()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens[tok] = formationToken{testID: testID, robotID: robotID, expires: time.Now().Add(formationTTL)}
+	return tok
+}
+
+// get returns a copy of the test, brought up to date.
+func (r *formationRegistry) get(id string) (formationTest, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.tests[id]
+	if !ok {
+		return formationTest{}, false
+	}
+	t.summarize(time.Now())
+	out := *t
+	out.Robots = append([]formationRobot(nil), t.Robots...)
+	return out, true
+}
+
+// expects reports whether token is live for a report from the robot.
+func (r *formationRegistry) expects(token string, robotID int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ref, ok := r.tokens[token]
+	return ok && ref.robotID == robotID && time.Now().Before(ref.expires)
+}
+
+// deliver records a robot's report, received at now, and reports whether the
+// token was valid for it.
+func (r *formationRegistry) deliver(token string, robotID int64, res agent.FormationResult, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ref, ok := r.tokens[token]
+	if !ok || ref.robotID != robotID {
+		return false
+	}
+	delete(r.tokens, token)
+	t := r.tests[ref.testID]
+	if t == nil {
+		return false
+	}
+	for i := range t.Robots {
+		fr := &t.Robots[i]
+		if fr.RobotID != robotID || fr.Status != "queued" {
+			continue
+		}
+		fr.ClockOffsetMs = res.SentAt - now.UnixMilli()
+		fr.LatencyMs = res.ReceivedAt - fr.ClockOffsetMs - t.IssuedAt.UnixMilli()
+		fr.Error = res.Error
+		switch {
+		case res.MovingAt != 0:
+			fr.StartOffsetMs = res.MovingAt - fr.ClockOffsetMs - t.StartAt.UnixMilli()
+			fr.Status = "done"
+			if res.Error != "" {
+				fr.Status = "failed"
+			}
+		case res.ReceivedAt-fr.ClockOffsetMs > t.StartAt.UnixMilli():
+			fr.Status = "late"
+		default:
+			fr.Status = "failed"
+		}
+	}
+	t.summarize(now)
+	return true
+}
+
+// summarize marks robots that should have reported by now and works out the
+// totals.
+func (t *formationTest) summarize(now time.Time) {
+	drive := time.Duration(t.DistanceM / t.SpeedMPS * float64(time.Second))
+	overdue := now.After(t.StartAt.Add(drive + formationReportGrace))
+	t.Done, t.Ready = true, true
+	t.MaxLatencyMs, t.StartSpreadMs = 0, 0
+	var first, last int64
+	moved := 0
+	for i := range t.Robots {
+		fr := &t.Robots[i]
+		if fr.Status == "queued" && overdue {
+			fr.Status = "no_report"
+		}
+		switch fr.Status {
+		case "queued":
+			t.Done = false
+		case "done":
+			if fr.LatencyMs > t.MaxLatencyMs {
+				t.MaxLatencyMs = fr.LatencyMs
+			}
+			if moved == 0 || fr.StartOffsetMs < first {
+				first = fr.StartOffsetMs
+			}
+			if moved == 0 || fr.StartOffsetMs > last {
+				last = fr.StartOffsetMs
+			}
+			moved++
+			continue
+		case "late", "failed":
+			if fr.LatencyMs > t.MaxLatencyMs {
+				t.MaxLatencyMs = fr.LatencyMs
+			}
+		}
+		t.Ready = false
+	}
+	t.StartSpreadMs = last - first
+	if !t.Done || moved == 0 || time.Duration(t.StartSpreadMs)*time.Millisecond > formationSyncTolerance {
+		t.Ready = false
+	}
+}
+
+// StartFormationTest sends a formation_drive to each selected robot with a
+// shared start time and returns the test, whose progress GetFormationTest
+// reports.
+func (c *Controller) StartFormationTest(w http.ResponseWriter, r *http.Request) {
+	var req formationTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid formation test payload")
+		return
+	}
+	delay := defaultFormationDelay
+	if req.DelaySec != 0 {
+		delay = time.Duration(req.DelaySec * float64(time.Second))
+	}
+	if delay < minFormationDelay || delay > maxFormationDelay {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("delay_sec must be between %v and %v", minFormationDelay.Seconds(), maxFormationDelay.Seconds()))
+		return
+	}
+	if req.DistanceM == 0 {
+		req.DistanceM = defaultFormationDistance
+	}
+	if req.SpeedMPS == 0 {
+		req.SpeedMPS = defaultFormationSpeed
+	}
+	if req.DistanceM < 0 || req.DistanceM > maxFormationDistance {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("distance_m must be at most %v", maxFormationDistance))
+		return
+	}
+	if req.SpeedMPS < 0 || req.SpeedMPS > maxFormationSpeed {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("speed_mps must be at most %v", maxFormationSpeed))
+		return
+	}
+	sel, err := parseSelector(req.Selector)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid selector: "+err.Error())
+		return
+	}
+	if req.RobotIDs, err = c.mergeSelected(r.Context(), req.RobotIDs, sel); err != nil {
+		logging.FromContext(r.Context()).Error("formation test select robots", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to list robots")
+		return
+	}
+	if len(req.RobotIDs) == 0 {
+		respondError(w, http.StatusBadRequest, "robot_ids or a matching selector required")
+		return
+	}
+	robots := make([]db.Robot, 0, len(req.RobotIDs))
+	for _, id := range req.RobotIDs {
+		robot, err := c.DB.GetRobotByID(r.Context(), id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				respondError(w, http.StatusNotFound, fmt.Sprintf("robot %d not found", id))
+				return
+			}
+			logging.FromContext(r.Context()).Error("formation test fetch robot", "err", err)
+			respondError(w, http.StatusInternalServerError, "failed to fetch robot")
+			return
+		}
+		robots = append(robots, robot)
+	}
+
+	now := time.Now()
+	test := &formationTest{
+		ID:        newFormationID(),
+		IssuedAt:  now,
+		StartAt:   now.Add(delay).Truncate(time.Millisecond),
+		DistanceM: req.DistanceM,
+		SpeedMPS:  req.SpeedMPS,
+	}
+	c.formations.add(test)
+	// Robots are filled in here, before anyone can look the test up by its
+	// ID, but tokens are live from the start, so reports go through deliver.
+	c.formations.mu.Lock()
+	for _, robot := range robots {
+		fr := formationRobot{RobotID: robot.ID, Name: robot.Name, Status: "queued"}
+		switch {
+		case robot.AgentID == "":
+			fr.Status, fr.Error = "skipped", "no agent attached"
+		case robot.ArchivedAt != nil:
+			fr.Status, fr.Error = "skipped", "archived"
+		case robot.Status == "offline":
+			fr.Status, fr.Error = "skipped", "offline"
+		case robot.Status == "unknown":
+			fr.Status, fr.Error = "skipped", "no heartbeat yet"
+		}
+		test.Robots = append(test.Robots, fr)
+	}
+	c.formations.mu.Unlock()
+
+	for i, robot := range robots {
+		c.formations.mu.Lock()
+		queued := test.Robots[i].Status == "queued"
+		c.formations.mu.Unlock()
+		if !queued {
+			continue
+		}
+		token := c.formations.token(test.ID, robot.ID)
+		data, _ := json.Marshal(agent.FormationDriveData{
+			IssuedAt:  test.IssuedAt.UnixMilli(),
+			StartAt:   test.StartAt.UnixMilli(),
+			DistanceM: test.DistanceM,
+			SpeedMPS:  test.SpeedMPS,
+			ResultURL: robotCallbackBase(r, robot.ID) + "/formation/result?token=" + token,
+		})
+		job, err := c.queueRobotCommand(r.Context(), robot, agent.Command{Type: "formation_drive", Data: data})
+		c.formations.mu.Lock()
+		if err != nil {
+			test.Robots[i].Status = "skipped"
+			test.Robots[i].Error = "failed to queue command"
+			if errors.Is(err, errPayloadKeyMissing) {
+				test.Robots[i].Error = err.Error()
+			}
+			logging.FromContext(r.Context()).Error("formation test queue", "robot", robot.Name, "err", err)
+		} else {
+			test.Robots[i].JobID = job.ID
+		}
+		c.formations.mu.Unlock()
+	}
+	names := make([]string, 0, len(robots))
+	for _, robot := range robots {
+		names = append(names, robot.Name)
+	}
+	c.audit(r.Context(), "formation.start", strings.Join(names, ","), fmt.Sprintf("%.2fm at %.2fm/s in %s", test.DistanceM, test.SpeedMPS, delay))
+	out, _ := c.formations.get(test.ID)
+	respondJSON(w, http.StatusCreated, out)
+}
+
+// GetFormationTest returns a formation test's progress and result.
+func (c *Controller) GetFormationTest(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/robots/formation-test/"), "/")
+	test, ok := c.formations.get(id)
+	if !ok {
+		respondError(w, http.StatusNotFound, "formation test not found")
+		return
+	}
+	respondJSON(w, http.StatusOK, test)
+}
+
+// FormationResult receives a robot's report on its formation drive.
+func (c *Controller) FormationResult(w http.ResponseWriter, r *http.Request) {
+	received := time.Now()
+	id, err := parseRobotID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid robot id")
+		return
+	}
+	var res agent.FormationResult
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&res); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid formation result")
+		return
+	}
+	if !c.formations.deliver(r.URL.Query().Get("token"), id, res, received) {
+		respondError(w, http.StatusForbidden, "invalid or expired formation token")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "received"})
+}
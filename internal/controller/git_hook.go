@@ -0,0 +1,373 @@
+package controller
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+	"example.com/openrobot-fleet/internal/scenario"
+	"example.com/openrobot-fleet/internal/selector"
+)
+
+const (
+	// gitHookActor issues and audits the jobs of deploys that need no
+	// approval, on behalf of whoever pushed.
+	gitHookActor = "git-hook"
+	// maxGitHookBody is generous: a push of many commits lists them all.
+	maxGitHookBody = 10 << 20
+)
+
+// gitPush is the part of a GitHub or GitLab push event the hook reads. GitHub
+// describes the repo under repository, GitLab under project.
+type gitPush struct {
+	Ref     string `json:"ref"`
+	After   string `json:"after"`
+	Deleted bool   `json:"deleted"`
+	// GitHub
+	Repository struct {
+		CloneURL   string `json:"clone_url"`
+		SSHURL     string `json:"ssh_url"`
+		HTMLURL    string `json:"html_url"`
+		GitHTTPURL string `json:"git_http_url"`
+		GitSSHURL  string `json:"git_ssh_url"`
+	} `json:"repository"`
+	Pusher struct {
+		Name string `json:"name"`
+	} `json:"pusher"`
+	// GitLab
+	Project struct {
+		GitHTTPURL string `json:"git_http_url"`
+		GitSSHURL  string `json:"git_ssh_url"`
+		WebURL     string `json:"web_url"`
+	} `json:"project"`
+	UserUsername string `json:"user_username"`
+}
+
+func (p gitPush) urls() []string {
+	var urls []string
+	for _, u := range []string{p.Repository.CloneURL, p.Repository.SSHURL, p.Repository.HTMLURL, p.Repository.GitHTTPURL, p.Repository.GitSSHURL, p.Project.GitHTTPURL, p.Project.GitSSHURL, p.Project.WebURL} {
+		if u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+func (p gitPush) pusher() string {
+	if p.Pusher.Name != "" {
+		return p.Pusher.Name
+	}
+	return p.UserUsername
+}
+
+type gitHookResponse struct {
+	// Status is deployed when the push matched a scenario, otherwise why it
+	// was ignored.
+	Status  string         `json:"status"`
+	Deploys []db.GitDeploy `json:"deploys"`
+}
+
+// verifyGitHook checks a GitHub signature (X-Hub-Signature-256, an HMAC of
+// the body) or a GitLab token (X-Gitlab-Token) against secret.
+func verifyGitHook(r *http.Request, body []byte, secret string) bool {
+	if sig := r.Header.Get("X-Hub-Signature-256"); sig != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		return hmac.Equal([]byte(sig), []byte("sha256="+hex.EncodeToString(mac.Sum(nil))))
+	}
+	if tok := r.Header.Get("X-Gitlab-Token"); tok != "" {
+		return subtle.ConstantTimeCompare([]byte(tok), []byte(secret)) == 1
+	}
+	return false
+}
+
+// GitHook receives push events from GitHub or GitLab and redeploys every
+// scenario with auto_deploy whose repo was pushed to, on the robots that
+// check out the pushed branch. It authenticates with GIT_WEBHOOK_SECRET
+// rather than the admin cookie and is disabled without it.
+func (c *Controller) GitHook(w http.ResponseWriter, r *http.Request) {
+	secret := os.Getenv("GIT_WEBHOOK_SECRET")
+	if secret == "" {
+		respondError(w, http.StatusServiceUnavailable, "git webhook is disabled; set GIT_WEBHOOK_SECRET")
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxGitHookBody))
+	if err != nil {
+		respondError(w, http.StatusRequestEntityTooLarge, "webhook payload too large")
+		return
+	}
+	if !verifyGitHook(r, body, secret) {
+		respondError(w, http.StatusUnauthorized, "invalid webhook signature")
+		return
+	}
+	switch event := r.Header.Get("X-GitHub-Event") + r.Header.Get("X-Gitlab-Event"); event {
+	case "push", "Push Hook":
+	case "ping":
+		respondJSON(w, http.StatusOK, gitHookResponse{Status: "pong", Deploys: []db.GitDeploy{}})
+		return
+	default:
+		respondJSON(w, http.StatusAccepted, gitHookResponse{Status: fmt.Sprintf("ignored %q event", event), Deploys: []db.GitDeploy{}})
+		return
+	}
+	var push gitPush
+	if err := json.Unmarshal(body, &push); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid push payload")
+		return
+	}
+	branch, ok := strings.CutPrefix(push.Ref, "refs/heads/")
+	switch {
+	case !ok:
+		respondJSON(w, http.StatusAccepted, gitHookResponse{Status: "ignored: not a branch", Deploys: []db.GitDeploy{}})
+		return
+	case push.Deleted || strings.Trim(push.After, "0") == "":
+		respondJSON(w, http.StatusAccepted, gitHookResponse{Status: "ignored: branch deleted", Deploys: []db.GitDeploy{}})
+		return
+	}
+
+	ctx := r.Context()
+	a := attribution{actor: gitHookActor}
+	if onBehalfOfPattern.MatchString(push.pusher()) {
+		a.onBehalfOf = push.pusher()
+	}
+	ctx = context.WithValue(ctx, attributionKey{}, a)
+	deploys, err := c.deployPush(ctx, push, branch)
+	if err != nil {
+		logging.FromContext(ctx).Error("git hook deploy", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to deploy push")
+		return
+	}
+	resp := gitHookResponse{Status: "deployed", Deploys: deploys}
+	if len(deploys) == 0 {
+		resp.Status = "ignored: no scenario deploys this repo and branch"
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// deployPush creates a deploy for each scenario the push redeploys, and
+// applies those that need no approval.
+func (c *Controller) deployPush(ctx context.Context, push gitPush, branch string) ([]db.GitDeploy, error) {
+	scenarios, err := c.DB.ListScenarios(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list scenarios: %w", err)
+	}
+	robots, err := c.DB.ListRobots(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list robots: %w", err)
+	}
+	urls := push.urls()
+	deploys := []db.GitDeploy{}
+	for _, s := range scenarios {
+		spec, err := c.resolveScenarioSpec(ctx, s.Name, s.ConfigYAML)
+		if err != nil || spec.AutoDeploy == nil || !spec.AutoDeploy.MatchBranch(branch) {
+			continue
+		}
+		ids := gitDeployTargets(s, spec, robots, urls, branch)
+		if len(ids) == 0 {
+			continue
+		}
+		if err := c.DB.SupersedeGitDeploys(ctx, s.ID, branch); err != nil {
+			return nil, err
+		}
+		dep := db.GitDeploy{
+			ScenarioID:   s.ID,
+			ScenarioName: s.Name,
+			Repo:         urls[0],
+			Branch:       branch,
+			Commit:       push.After,
+			Pusher:       push.pusher(),
+			RobotIDs:     ids,
+			Status:       db.GitDeployPending,
+		}
+		if dep.ID, err = c.DB.CreateGitDeploy(ctx, dep); err != nil {
+			return nil, err
+		}
+		c.audit(ctx, "git_deploy.push", s.Name, fmt.Sprintf("%s@%s to %d robot(s)", branch, scenario.ShortCommit(push.After), len(ids)))
+		if !spec.AutoDeploy.Approval {
+			if _, err := c.DB.DecideGitDeploy(ctx, dep.ID, db.GitDeployApplied, gitHookActor); err != nil {
+				return nil, err
+			}
+			c.applyGitDeploy(ctx, dep.ID)
+		}
+		if dep, err = c.DB.GetGitDeploy(ctx, dep.ID); err != nil {
+			return nil, err
+		}
+		deploys = append(deploys, dep)
+	}
+	return deploys, nil
+}
+
+// gitDeployTargets picks the robots a push to branch of a repo at urls
+// redeploys s on: those auto_deploy selects that clone that repo and branch.
+func gitDeployTargets(s db.Scenario, spec scenario.Spec, robots []db.Robot, urls []string, branch string) []int64 {
+	var candidates []db.Robot
+	if expr := strings.TrimSpace(spec.AutoDeploy.Robots); expr != "" {
+		sel, err := selector.Parse(expr)
+		if err != nil {
+			return nil
+		}
+		candidates = sel.Filter(robots)
+	} else {
+		for _, r := range robots {
+			if r.LastScenario != nil && r.LastScenario.ID == s.ID {
+				candidates = append(candidates, r)
+			}
+		}
+	}
+	ids := []int64{}
+	for _, r := range candidates {
+		if r.AgentID == "" {
+			continue
+		}
+		repo, err := spec.RepoFor(r)
+		if err != nil || repo.Branch != branch {
+			continue
+		}
+		for _, u := range urls {
+			if scenario.SameRepo(repo.Repo, u) {
+				ids = append(ids, r.ID)
+				break
+			}
+		}
+	}
+	return ids
+}
+
+// applyGitDeploy applies the scenario, as it is now, to the deploy's robots
+// and records the jobs. Robots that are gone or don't meet the scenario's
+// requirements are skipped and named in the deploy's error; it only fails
+// if none are left.
+func (c *Controller) applyGitDeploy(ctx context.Context, id int64) {
+	dep, err := c.DB.GetGitDeploy(ctx, id)
+	if err != nil {
+		logging.FromContext(ctx).Error("load git deploy", "id", id, "err", err)
+		return
+	}
+	fail := func(msg string) {
+		if err := c.DB.FinishGitDeploy(ctx, id, db.GitDeployFailed, nil, msg); err != nil {
+			logging.FromContext(ctx).Error("record git deploy", "id", id, "err", err)
+		}
+	}
+	s, err := c.DB.GetScenarioByID(ctx, dep.ScenarioID)
+	if err != nil {
+		fail("scenario not found")
+		return
+	}
+	spec, err := c.loadScenarioSpec(ctx, s)
+	if err != nil {
+		fail(fmt.Sprintf("invalid scenario config: %v", err))
+		return
+	}
+	jobIDs := []int64{}
+	var skipped []string
+	for _, robotID := range dep.RobotIDs {
+		robot, err := c.DB.GetRobotByID(ctx, robotID)
+		if err != nil || robot.ArchivedAt != nil || robot.AgentID == "" {
+			skipped = append(skipped, fmt.Sprintf("robot %d: no longer in the fleet", robotID))
+			continue
+		}
+		if reasons := spec.Requires.Unmet(robot); len(reasons) > 0 {
+			skipped = append(skipped, fmt.Sprintf("%s: %s", robot.Name, strings.Join(reasons, ", ")))
+			continue
+		}
+		cmd, err := spec.BatchCommand(robot)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", robot.Name, err))
+			continue
+		}
+		job, err := c.queueRobotCommand(ctx, robot, cmd)
+		if errors.Is(err, errPayloadKeyMissing) {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", robot.Name, err))
+			continue
+		}
+		if err != nil {
+			logging.FromContext(ctx).Error("git deploy queue", "robot", robot.Name, "err", err)
+			skipped = append(skipped, fmt.Sprintf("%s: failed to queue command", robot.Name))
+			continue
+		}
+		if err := c.DB.UpdateRobotScenario(ctx, robot.ID, s.ID); err != nil {
+			logging.FromContext(ctx).Error("git deploy update robot", "robot", robot.Name, "err", err)
+		}
+		c.recordScenarioApply(ctx, s.ID, robot, job)
+		jobIDs = append(jobIDs, job.ID)
+	}
+	status := db.GitDeployApplied
+	if len(jobIDs) == 0 {
+		status = db.GitDeployFailed
+	}
+	if err := c.DB.FinishGitDeploy(ctx, id, status, jobIDs, strings.Join(skipped, "; ")); err != nil {
+		logging.FromContext(ctx).Error("record git deploy", "id", id, "err", err)
+	}
+}
+
+// ListGitDeploys returns recent deploys from the git webhook, newest first.
+// ?status=pending lists those waiting for approval.
+func (c *Controller) ListGitDeploys(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= 500 {
+		limit = v
+	}
+	deploys, err := c.DB.ListGitDeploys(r.Context(), r.URL.Query().Get("status"), limit)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list git deploys", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to list deploys")
+		return
+	}
+	respondJSON(w, http.StatusOK, deploys)
+}
+
+// DecideGitDeploy approves (applies) or rejects a pending deploy:
+// POST /api/hooks/git/deploys/{id}/approve or .../reject.
+func (c *Controller) DecideGitDeploy(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	base, action := path[:strings.LastIndex(path, "/")], path[strings.LastIndex(path, "/")+1:]
+	status := map[string]string{"approve": db.GitDeployApplied, "reject": db.GitDeployRejected}[action]
+	id, err := parseIDFromPath(base, "/api/hooks/git/deploys/")
+	if err != nil || status == "" {
+		respondError(w, http.StatusBadRequest, "invalid deploy path")
+		return
+	}
+	dep, err := c.DB.GetGitDeploy(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(w, http.StatusNotFound, "deploy not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("get git deploy", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load deploy")
+		return
+	}
+	actor, _ := Actor(r.Context())
+	ok, err := c.DB.DecideGitDeploy(r.Context(), id, status, actor)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("decide git deploy", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to update deploy")
+		return
+	}
+	if !ok {
+		respondError(w, http.StatusConflict, fmt.Sprintf("deploy is %s, not pending", dep.Status))
+		return
+	}
+	c.audit(r.Context(), "git_deploy."+action, dep.ScenarioName, fmt.Sprintf("%s@%s", dep.Branch, scenario.ShortCommit(dep.Commit)))
+	if status == db.GitDeployApplied {
+		c.applyGitDeploy(r.Context(), id)
+	}
+	if dep, err = c.DB.GetGitDeploy(r.Context(), id); err != nil {
+		logging.FromContext(r.Context()).Error("get git deploy", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load deploy")
+		return
+	}
+	respondJSON(w, http.StatusOK, dep)
+}
@@ -2,97 +2,161 @@ package controller
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"crypto/sha256"
+	"database/sql"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"text/template"
 	"time"
 
-	"golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
 
+	"example.com/openrobot-fleet/internal/agent"
 	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+	"example.com/openrobot-fleet/internal/metrics"
+	sshc "example.com/openrobot-fleet/internal/ssh"
 )
 
-func (c *Controller) GetGoldenImageConfig(w http.ResponseWriter, r *http.Request) {
-	cfg, err := c.DB.GetGoldenImageConfig(r.Context())
-	if err != nil {
-		log.Printf("get golden image config: %v", err)
-		respondError(w, http.StatusInternalServerError, "failed to load config")
-		return
-	}
-	respondJSON(w, http.StatusOK, map[string]*db.GoldenImageConfig{"config": cfg})
+// userData is what userDataTemplate renders.
+type userData struct {
+	*db.GoldenImageConfig
+	SSHPublicKey string
+	// WifiAccessPoints is the netplan access-points, indented to fit.
+	WifiAccessPoints string
+	// ProvisionToken lets the robot enroll itself on first boot. It is only
+	// baked in when the config has a controller URL to enroll with.
+	ProvisionToken string
+	// AgentID, if set, is the robot's agent ID and hostname, for a card
+	// flashed for one robot. Such a robot doesn't enroll.
+	AgentID string
+	// EnrollmentToken lets the robot's agent in when the controller runs
+	// with AGENT_ENROLLMENT=verified.
+	EnrollmentToken string
+	// ExtraWriteFiles and ExtraRunCmd are the config's write_files and
+	// runcmd, indented to fit.
+	ExtraWriteFiles string
+	ExtraRunCmd     string
 }
 
-func (c *Controller) SaveGoldenImageConfig(w http.ResponseWriter, r *http.Request) {
-	var req db.GoldenImageConfig
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "invalid config")
-		return
+func newUserData(cfg *db.GoldenImageConfig, pubKey string) (userData, error) {
+	data := userData{GoldenImageConfig: cfg, SSHPublicKey: pubKey}
+	if nets := goldenWifiNetworks(cfg); len(nets) > 0 {
+		aps, err := agent.NetplanAccessPoints(nets)
+		if err != nil {
+			return data, err
+		}
+		data.WifiAccessPoints = indent(string(aps), "              ")
 	}
-	if err := c.DB.SaveGoldenImageConfig(r.Context(), req); err != nil {
-		log.Printf("save golden image config: %v", err)
-		respondError(w, http.StatusInternalServerError, "failed to save config")
-		return
+	var err error
+	if data.ExtraWriteFiles, err = cloudInitWriteFiles(cfg.WriteFiles); err != nil {
+		return data, err
 	}
-	respondJSON(w, http.StatusOK, map[string]*db.GoldenImageConfig{"config": &req})
+	if data.ExtraRunCmd, err = cloudInitRunCmd(cfg.RunCmd); err != nil {
+		return data, err
+	}
+	return data, nil
 }
 
-func (c *Controller) DownloadGoldenImage(w http.ResponseWriter, r *http.Request) {
-	cfg, err := c.DB.GetGoldenImageConfig(r.Context())
-	if err != nil {
-		log.Printf("get golden image config: %v", err)
-		respondError(w, http.StatusInternalServerError, "failed to load config")
-		return
+// cloudInitWriteFiles checks raw is a YAML list of write_files entries, each
+// with a path, and returns it indented to fit under write_files.
+func cloudInitWriteFiles(raw string) (string, error) {
+	var files []map[string]interface{}
+	if err := yaml.Unmarshal([]byte(raw), &files); err != nil {
+		return "", fmt.Errorf("write_files must be a YAML list of files: %v", err)
 	}
-	if cfg == nil {
-		respondError(w, http.StatusBadRequest, "golden image config not set")
-		return
+	for i, f := range files {
+		if p, _ := f["path"].(string); p == "" {
+			return "", fmt.Errorf("write_files entry %d has no path", i+1)
+		}
 	}
+	return cloudInitList(files)
+}
 
-	// Fetch default install config for SSH key
-	installCfg, err := c.DB.GetDefaultInstallConfig(r.Context())
-	sshKey := ""
-	if err == nil && installCfg != nil {
-		sshKey = installCfg.SSHKey
+// cloudInitRunCmd checks raw is a YAML list of runcmd commands, each a shell
+// string or an argv list, and returns it indented to fit under runcmd.
+func cloudInitRunCmd(raw string) (string, error) {
+	var cmds []interface{}
+	if err := yaml.Unmarshal([]byte(raw), &cmds); err != nil {
+		return "", fmt.Errorf("runcmd must be a YAML list of commands: %v", err)
+	}
+	for i, cmd := range cmds {
+		switch cmd := cmd.(type) {
+		case string:
+		case []interface{}:
+			for _, arg := range cmd {
+				if _, ok := arg.(string); !ok {
+					return "", fmt.Errorf("runcmd entry %d: arguments must be strings", i+1)
+				}
+			}
+		default:
+			return "", fmt.Errorf("runcmd entry %d must be a string or a list of strings", i+1)
+		}
 	}
+	return cloudInitList(cmds)
+}
 
-	pubKey, _ := prepareSSHKeys(sshKey)
-
-	tmplData := struct {
-		*db.GoldenImageConfig
-		SSHPublicKey string
-	}{
-		GoldenImageConfig: cfg,
-		SSHPublicKey:      pubKey,
+func cloudInitList[T any](list []T) (string, error) {
+	if len(list) == 0 {
+		return "", nil
+	}
+	out, err := yaml.Marshal(list)
+	if err != nil {
+		return "", err
 	}
+	return indent(string(out), "  "), nil
+}
 
-	w.Header().Set("Content-Type", "text/yaml")
-	w.Header().Set("Content-Disposition", "attachment; filename=user-data")
+// imageProvisionToken is the provisioning token to bake into an image, or ""
+// when the config has no controller URL for the robot to enroll with.
+func (c *Controller) imageProvisionToken(ctx context.Context, cfg *db.GoldenImageConfig) (string, error) {
+	if strings.TrimSpace(cfg.ControllerURL) == "" {
+		return "", nil
+	}
+	token, err := c.provisioningToken(ctx)
+	return token.Token, err
+}
 
-	tmpl, err := template.New("user-data").Parse(userDataTemplate)
-	if err != nil {
-		log.Printf("parse template: %v", err)
-		respondError(w, http.StatusInternalServerError, "template error")
-		return
+// goldenWifiNetworks lists the networks an image joins: wifi_ssid, preferred
+// over the rest, then wifi_networks.
+func goldenWifiNetworks(cfg *db.GoldenImageConfig) []agent.WifiNetwork {
+	var nets []agent.WifiNetwork
+	if cfg.WifiSSID != "" {
+		top := 0
+		for _, n := range cfg.WifiNetworks {
+			top = max(top, n.Priority+1)
+		}
+		nets = append(nets, agent.WifiNetwork{SSID: cfg.WifiSSID, Password: cfg.WifiPassword, Priority: top})
 	}
+	for _, n := range cfg.WifiNetworks {
+		nets = append(nets, agent.WifiNetwork(n))
+	}
+	return nets
+}
 
-	if err := tmpl.Execute(w, tmplData); err != nil {
-		log.Printf("execute template: %v", err)
+// indent prefixes every line of s.
+func indent(s, prefix string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = prefix + line
 	}
+	return strings.Join(lines, "\n")
 }
 
 const userDataTemplate = `#cloud-config
-hostname: openrobot
+hostname: {{if .AgentID}}{{.AgentID}}{{else}}openrobot{{end}}
 manage_etc_hosts: true
 users:
   - name: ubuntu
@@ -122,6 +186,7 @@ write_files:
       exec /usr/local/bin/openrobotfleet-agent
 
   - path: /etc/netplan/50-cloud-init.yaml
+    permissions: '0600'
     content: |
       network:
         version: 2
@@ -129,13 +194,14 @@ write_files:
           eth0:
             dhcp4: true
             optional: true
+{{- if .WifiAccessPoints}}
         wifis:
           wlan0:
             dhcp4: true
             optional: true
             access-points:
-              "{{.WifiSSID}}":
-                password: "{{.WifiPassword}}"
+{{.WifiAccessPoints}}
+{{- end}}
 
   - path: /etc/apt/apt.conf.d/20auto-upgrades
     content: |
@@ -144,17 +210,31 @@ write_files:
 
   - path: /etc/openrobotfleet-agent/config.yaml
     content: |
-      agent_id: "ROBOT-UNINITIALIZED"
+      agent_id: "{{if .AgentID}}{{.AgentID}}{{else}}ROBOT-UNINITIALIZED{{end}}"
       mqtt_broker: "{{.MQTTBroker}}"
       workspace_path: "/home/ubuntu/ros_ws/src"
+{{- if .ProvisionToken}}
+      controller_url: "{{.ControllerURL}}"
+      provision_token: "{{.ProvisionToken}}"
+{{- end}}
+{{- if .EnrollmentToken}}
+      enrollment_token: "{{.EnrollmentToken}}"
+{{- end}}
+{{- if .ExtraWriteFiles}}
+
+  # Lab files
+{{.ExtraWriteFiles}}
+{{- end}}
 
 runcmd:
+{{- if not .AgentID}}
   # Generate unique Agent ID and Hostname
   - |
     SUFFIX=$(head /dev/urandom | tr -dc a-z0-9 | head -c 6)
     sed -i "s/ROBOT-UNINITIALIZED/robot-$SUFFIX/" /etc/openrobotfleet-agent/config.yaml
     hostnamectl set-hostname robot-$SUFFIX
     sed -i "s/openrobot/robot-$SUFFIX/g" /etc/hosts
+{{- end}}
 
   # Fix DNS (Docker/Systemd conflict)
   - rm -f /etc/resolv.conf
@@ -200,267 +280,549 @@ runcmd:
     EOF
   - systemctl enable openrobotfleet-agent
   - systemctl start openrobotfleet-agent
+{{- if .ExtraRunCmd}}
+
+  # Lab commands
+{{.ExtraRunCmd}}
+{{- end}}
 
 final_message: "OpenRobot setup complete. Ready to roll!"
 `
 
-var (
-	buildLock      sync.Mutex
-	buildStatus    = "idle" // idle, building, success, error
-	buildError     string
-	buildProgress  int    // 0-100
-	buildStep      string // Current step description
-	buildLogs      []string
-	buildImageName string
-	lastLogUpdate  time.Time
-)
-
-func (c *Controller) logBuild(format string, v ...interface{}) {
-	msg := fmt.Sprintf(format, v...)
-	log.Print(msg)
-	buildLock.Lock()
-	// Prepend timestamp
-	ts := time.Now().Format("15:04:05")
-	buildLogs = append(buildLogs, fmt.Sprintf("[%s] %s", ts, msg))
-	// Limit log size
-	if len(buildLogs) > 2000 {
-		buildLogs = buildLogs[len(buildLogs)-2000:]
-	}
-
-	// Throttle updates to frontend to avoid flooding
-	shouldUpdate := time.Since(lastLogUpdate) > 200*time.Millisecond
-	if shouldUpdate {
-		lastLogUpdate = time.Now()
-	}
-
-	// Capture state for callback
-	status := buildStatus
-	logs := make([]string, len(buildLogs))
-	copy(logs, buildLogs)
-	progress := buildProgress
-	step := buildStep
-	err := buildError
-	imageName := buildImageName
-	buildLock.Unlock()
-
-	if shouldUpdate && c.OnBuildUpdate != nil {
-		c.OnBuildUpdate(status, progress, step, logs, err, imageName)
-	}
-}
+var buildDuration = metrics.NewHistogramVec("openrobot_image_build_duration_seconds",
+	"Golden image build wall time by result.",
+	[]float64{60, 300, 600, 900, 1200, 1800, 2700, 3600, 5400, 7200}, "result")
 
 func (c *Controller) BuildGoldenImage(w http.ResponseWriter, r *http.Request) {
 	if os.Getenv("DEMO_MODE") == "true" {
 		respondError(w, http.StatusForbidden, "Build feature is disabled in demo mode")
 		return
 	}
-	buildLock.Lock()
-	if buildStatus == "building" {
-		buildLock.Unlock()
-		respondError(w, http.StatusConflict, "build already in progress")
+	for _, kind := range []string{"builds", "storage"} {
+		if msg := c.usageLimitReached(r.Context(), kind); msg != "" {
+			respondError(w, http.StatusForbidden, msg)
+			return
+		}
+	}
+	profile, ok := c.buildProfile(w, r)
+	if !ok {
 		return
 	}
-	buildStatus = "building"
-	buildError = ""
-	buildProgress = 0
-	buildStep = "Starting build..."
-	buildLogs = []string{}
-	buildImageName = ""
-	buildLock.Unlock()
+	if profile.Config.RobotModel == laptopModel {
+		respondError(w, http.StatusBadRequest, "laptop profiles aren't built; install Ubuntu with the profile's autoinstall file from /api/image-profiles/"+strconv.FormatInt(profile.ID, 10)+"/user-data")
+		return
+	}
+	actor, _ := Actor(r.Context())
+	buildID, err := c.DB.QueueImageBuild(r.Context(), db.ImageBuild{
+		ProfileID:   profile.ID,
+		ProfileName: profile.Name,
+		FromCache:   r.URL.Query().Get("from_cache") == "true",
+		RequestedBy: actor,
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("queue image build", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to queue build")
+		return
+	}
+	c.audit(r.Context(), "image.build", profile.Name, fmt.Sprintf("build %d", buildID))
+	c.startNextBuild()
+
+	resp := buildQueuedResponse{Status: "started", BuildID: buildID}
+	if c.builds.get(buildID) == nil {
+		resp.Status = "queued"
+		if n, err := c.DB.QueuedImageBuilds(r.Context()); err == nil {
+			resp.Position = n
+		}
+	}
+	respondJSON(w, http.StatusAccepted, resp)
+}
 
-	go c.runBuild()
+// buildQueuedResponse says whether a requested build started straight away
+// or is waiting behind others; Position counts the builds queued, this one
+// included.
+type buildQueuedResponse struct {
+	Status   string `json:"status"`
+	BuildID  int64  `json:"build_id"`
+	Position int    `json:"position,omitempty"`
+}
 
-	respondJSON(w, http.StatusAccepted, map[string]string{"status": "started"})
+// StartQueuedBuilds starts the builds left queued when the controller last
+// stopped. It must run after RecoverInterruptedBuild.
+func (c *Controller) StartQueuedBuilds() {
+	c.startNextBuild()
 }
 
+// startNextBuild starts queued builds, longest queued first, until
+// BUILD_MAX_CONCURRENT are running, unless the controller is shutting down.
+// A build waits while another of the same profile runs. Each build starts
+// the next when it ends.
+func (c *Controller) startNextBuild() {
+	c.builds.startMu.Lock()
+	defer c.builds.startMu.Unlock()
+	ctx := context.Background()
+	for {
+		c.builds.mu.Lock()
+		stopped := c.builds.stopped
+		c.builds.mu.Unlock()
+		running := c.builds.active()
+		if stopped || len(running) >= maxConcurrentBuilds() {
+			return
+		}
+		busy := make([]int64, 0, len(running))
+		for _, b := range running {
+			busy = append(busy, b.profileID)
+		}
+		next, err := c.DB.NextQueuedImageBuild(ctx, busy)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				slog.Error("next queued image build", "err", err)
+			}
+			return
+		}
+		if err := c.DB.StartQueuedImageBuild(ctx, next.ID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			slog.Error("start queued image build", "id", next.ID, "err", err)
+			return
+		}
+		profile, err := c.DB.GetImageProfile(ctx, next.ProfileID)
+		if err != nil {
+			next.Status, next.Error = db.ImageBuildError, "image profile was deleted"
+			if !errors.Is(err, sql.ErrNoRows) {
+				next.Error = fmt.Sprintf("load image profile: %v", err)
+			}
+			if err := c.DB.FinishImageBuild(ctx, next); err != nil {
+				slog.Error("record image build", "err", err)
+			}
+			continue
+		}
+
+		buildCtx, cancel := context.WithCancelCause(context.Background())
+		run := &buildRun{
+			events:      c.Events,
+			id:          next.ID,
+			profileID:   profile.ID,
+			profileName: profile.Name,
+			mountDir:    buildMountPath(next.ID),
+			status:      "building",
+			step:        "Starting build...",
+			logs:        []string{},
+			cancel:      cancel,
+		}
+		c.builds.add(run)
+		if next.RefreshOf != 0 {
+			run.step = "Starting refresh..."
+			go c.runRefresh(buildCtx, run, profile, next.RefreshOf)
+			continue
+		}
+		go c.runBuild(buildCtx, run, profile, next.FromCache)
+	}
+}
+
+// buildProfile loads the profile named by ?profile_id=. It may be left out
+// when there is only one profile.
+func (c *Controller) buildProfile(w http.ResponseWriter, r *http.Request) (db.ImageProfile, bool) {
+	if v := r.URL.Query().Get("profile_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid profile_id")
+			return db.ImageProfile{}, false
+		}
+		p, err := c.DB.GetImageProfile(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				respondError(w, http.StatusNotFound, "image profile not found")
+				return db.ImageProfile{}, false
+			}
+			logging.FromContext(r.Context()).Error("get image profile", "err", err)
+			respondError(w, http.StatusInternalServerError, "failed to load image profile")
+			return db.ImageProfile{}, false
+		}
+		return p, true
+	}
+	profiles, err := c.DB.ListImageProfiles(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list image profiles", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load image profiles")
+		return db.ImageProfile{}, false
+	}
+	switch len(profiles) {
+	case 0:
+		respondError(w, http.StatusBadRequest, "no image profile to build; create one first")
+		return db.ImageProfile{}, false
+	case 1:
+		return profiles[0], true
+	}
+	respondError(w, http.StatusBadRequest, "profile_id required")
+	return db.ImageProfile{}, false
+}
+
+type buildStatusResponse struct {
+	Status   string `json:"status"`
+	Error    string `json:"error"`
+	Progress int    `json:"progress"`
+	Step     string `json:"step"`
+	// ETASec is about how many seconds the current step has left, when
+	// that is known.
+	ETASec    int      `json:"eta_sec,omitempty"`
+	Logs      []string `json:"logs"`
+	ImageName string   `json:"image_name"`
+	// BuildID, ProfileID and ProfileName are the build, and its image
+	// profile, running or last run.
+	BuildID     int64  `json:"build_id,omitempty"`
+	ProfileID   int64  `json:"profile_id,omitempty"`
+	ProfileName string `json:"profile_name,omitempty"`
+	// Queued is how many builds are waiting to run.
+	Queued int `json:"queued,omitempty"`
+	// Active lists every build running, when there is more than one.
+	Active []activeBuild `json:"active,omitempty"`
+	// RetryFromCache is set when a failed or interrupted build can be
+	// retried with the base image already cached.
+	RetryFromCache bool `json:"retry_from_cache,omitempty"`
+}
+
+// activeBuild is one of the builds running.
+type activeBuild struct {
+	BuildID     int64  `json:"build_id"`
+	ProfileID   int64  `json:"profile_id"`
+	ProfileName string `json:"profile_name"`
+	Progress    int    `json:"progress"`
+	Step        string `json:"step"`
+	ETASec      int    `json:"eta_sec,omitempty"`
+}
+
+// GetBuildStatus returns the progress of the build ?build_id= names, if it
+// is running, else of the last build started.
 func (c *Controller) GetBuildStatus(w http.ResponseWriter, r *http.Request) {
-	buildLock.Lock()
-	defer buildLock.Unlock()
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"status":     buildStatus,
-		"error":      buildError,
-		"progress":   buildProgress,
-		"step":       buildStep,
-		"logs":       buildLogs,
-		"image_name": buildImageName,
-	})
+	var id int64
+	if v := r.URL.Query().Get("build_id"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid build_id")
+			return
+		}
+		id = n
+	}
+	queued, err := c.DB.QueuedImageBuilds(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("count queued image builds", "err", err)
+	}
+	resp := buildStatusResponse{Status: "idle", Logs: []string{}, Queued: queued}
+	if run := c.builds.latest(id); run != nil {
+		u := run.update()
+		resp.BuildID = u.BuildID
+		resp.Status = u.Status
+		resp.Error = u.Error
+		resp.Progress = u.Progress
+		resp.Step = u.Step
+		resp.ETASec = u.ETASec
+		resp.Logs = u.Logs
+		resp.ImageName = u.ImageName
+		resp.ProfileID = u.ProfileID
+		resp.ProfileName = u.ProfileName
+	}
+	resp.RetryFromCache = (resp.Status == "error" || resp.Status == "interrupted" || resp.Status == "cancelled") && hasCachedBaseImage()
+	if active := c.builds.active(); len(active) > 1 {
+		for _, run := range active {
+			u := run.update()
+			resp.Active = append(resp.Active, activeBuild{BuildID: u.BuildID, ProfileID: u.ProfileID, ProfileName: u.ProfileName, Progress: u.Progress, Step: u.Step, ETASec: u.ETASec})
+		}
+	}
+	respondJSON(w, http.StatusOK, resp)
 }
 
-func (c *Controller) updateBuildProgress(step string, progress int) {
-	buildLock.Lock()
-	buildStep = step
-	buildProgress = progress
-	// Also log the step
-	ts := time.Now().Format("15:04:05")
-	buildLogs = append(buildLogs, fmt.Sprintf("[%s] >>> %s", ts, step))
-
-	// Capture state for callback
-	status := buildStatus
-	logs := make([]string, len(buildLogs))
-	copy(logs, buildLogs)
-	err := buildError
-	imageName := buildImageName
-	buildLock.Unlock()
-
-	if c.OnBuildUpdate != nil {
-		c.OnBuildUpdate(status, progress, step, logs, err, imageName)
+// CancelBuild stops a running golden image build: the one ?build_id=
+// names, which may be left out while only one is running. The step it is
+// on is killed along with anything it started in the chroot, the image is
+// unmounted and its loop device detached, and the partial image removed;
+// the build then ends as cancelled.
+func (c *Controller) CancelBuild(w http.ResponseWriter, r *http.Request) {
+	var run *buildRun
+	if v := r.URL.Query().Get("build_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid build_id")
+			return
+		}
+		run = c.builds.get(id)
+	} else if active := c.builds.active(); len(active) == 1 {
+		run = active[0]
+	} else if len(active) > 1 {
+		respondError(w, http.StatusConflict, "several builds are running; build_id required")
+		return
+	}
+	if run == nil {
+		respondError(w, http.StatusConflict, "no build in progress")
+		return
+	}
+
+	actor, _ := Actor(r.Context())
+	if actor == "" {
+		actor = "unknown user"
 	}
+	run.logf("cancel requested by %s", actor)
+	run.cancel(errBuildCancelled)
+	c.audit(r.Context(), "image.build_cancel", run.profileName, fmt.Sprintf("build %d", run.id))
+	respondJSON(w, http.StatusAccepted, map[string]string{"status": "cancelling"})
 }
 
-func (c *Controller) runBuild() {
+// runBuild builds profile's golden image. fromCache retries with the base
+// image already cached, e.g. after a build was interrupted. Cancelling
+// parent stops the build.
+func (c *Controller) runBuild(parent context.Context, run *buildRun, profile db.ImageProfile, fromCache bool) {
+	defer func() {
+		c.builds.done(run)
+		go c.startNextBuild()
+	}()
+	started := time.Now()
 	var workImage string
+	// Set by the last step, once the image is compressed.
+	var imageSize int64
+	var checksum string
+	defer func() { c.recordBuild(run, profile, started, imageSize, checksum) }()
 	buildSucceeded := false
 	defer func() {
 		if r := recover(); r != nil {
-			c.failBuild(fmt.Sprintf("panic: %v", r))
+			run.fail(fmt.Sprintf("panic: %v", r))
 		}
 		if !buildSucceeded && workImage != "" {
-			c.logBuild("cleaning up failed work image: %s", workImage)
+			run.logf("cleaning up failed work image: %s", workImage)
 			os.Remove(workImage)
+			removeImage(filepath.Base(workImage) + ".xz")
 		}
 	}()
 
 	// 1. Load Config
-	c.updateBuildProgress("Loading configuration...", 5)
+	run.progressTo("Loading configuration...", 5)
 	ctx := context.Background()
-	cfg, err := c.DB.GetGoldenImageConfig(ctx)
-	if err != nil || cfg == nil {
-		c.failBuild("failed to load config")
-		return
+	cfg := &profile.Config
+	var err error
+	run.logf("Config loaded: Profile=%s, RobotModel=%s, ROSVersion=%s", profile.Name, cfg.RobotModel, cfg.ROSVersion)
+
+	limits := buildLimitsFromEnv()
+	buildCtx, cancelBuild := context.WithCancelCause(parent)
+	defer cancelBuild(nil)
+	// stopped ends the build if it was cancelled, or aborted for low disk,
+	// between steps that don't watch buildCtx themselves.
+	stopped := func() bool {
+		if buildCtx.Err() == nil {
+			return false
+		}
+		run.abort(buildCtx, "build aborted")
+		return true
 	}
-	c.logBuild("Config loaded: RobotModel=%s, ROSVersion=%s", cfg.RobotModel, cfg.ROSVersion)
 
 	// 2. Prepare directories
-	c.updateBuildProgress("Preparing directories...", 10)
-	webRoot := os.Getenv("WEB_ROOT")
-	if webRoot == "" {
-		webRoot = "./web/dist"
-	}
-	imagesDir := filepath.Join(webRoot, "images")
+	run.progressTo("Preparing directories...", 10)
+	imagesDir := buildImagesDir()
 	if err := os.MkdirAll(imagesDir, 0755); err != nil {
-		c.failBuild(fmt.Sprintf("mkdir failed: %v", err))
+		run.fail(fmt.Sprintf("mkdir failed: %v", err))
 		return
 	}
 
-	// 3. Download Base Image
-	c.updateBuildProgress("Downloading base image (this may take a while)...", 15)
+	// seal ends the build once the compressed image is in the images
+	// directory.
+	seal := func(imageName string) {
+		run.progressTo("Computing checksum...", 97)
+		if imageSize, checksum, err = c.sealImage(run, imageName); err != nil {
+			run.fail(err.Error())
+			return
+		}
+		run.logf("image %s: %d bytes, sha256 %s", imageName, imageSize, checksum)
 
-	// Determine Image URL based on ROS Version
-	baseImageURL := "https://cdimage.ubuntu.com/releases/22.04/release/ubuntu-22.04.5-preinstalled-server-arm64+raspi.img.xz"
-	baseImageName := "ubuntu-22.04-server-arm64.img.xz"
+		buildSucceeded = true
+		run.succeed(imageName)
 
-	if cfg.ROSVersion == "Jazzy" {
-		baseImageURL = "https://cdimage.ubuntu.com/releases/24.04/release/ubuntu-24.04.3-preinstalled-server-arm64+raspi.img.xz"
-		baseImageName = "ubuntu-24.04-server-arm64.img.xz"
+		run.logf("golden image build complete: %s", filepath.Join(imagesDir, imageName))
 	}
 
-	// Fetch hash dynamically
-	c.logBuild("fetching upstream hash for verification...")
-	expectedSHA256, err := fetchRemoteHash(baseImageURL)
+	builder, err := c.remoteBuilder(buildCtx)
 	if err != nil {
-		c.failBuild(fmt.Sprintf("failed to fetch upstream hash: %v", err))
+		run.fail(err.Error())
+		return
+	}
+	if builder != nil {
+		// The builder host does the rest and sends back the compressed image.
+		var ok bool
+		if workImage, ok = c.buildRemotely(buildCtx, run, builder, profile, fromCache); !ok {
+			return
+		}
+		if smokeTestEnabled() {
+			// QEMU boots the raw image, so unpack a copy next to the
+			// compressed one.
+			out, err := exec.CommandContext(buildCtx, "xz", "-dkf", workImage+".xz").CombinedOutput()
+			if err != nil {
+				run.abort(buildCtx, fmt.Sprintf("decompress for smoke test failed: %v: %s", err, string(out)))
+				return
+			}
+			c.smokeTest(buildCtx, run, workImage, cfg)
+			os.Remove(workImage)
+			if stopped() {
+				return
+			}
+		}
+		seal(filepath.Base(workImage) + ".xz")
 		return
 	}
-	c.logBuild("upstream hash: %s", expectedSHA256)
 
-	// Cache it in /data/image-cache (persistent volume) if available, else /tmp
-	cacheDir := "/tmp/image-cache"
-	if _, err := os.Stat("/data"); err == nil {
-		cacheDir = "/data/image-cache"
+	// 3. Download Base Image
+	if stopped() {
+		return
 	}
+	run.progressTo("Downloading base image (this may take a while)...", 15)
 
+	baseImageURL, baseImageName := baseImage(cfg)
+
+	cacheDir := buildCacheDir()
+	// Builds share the base image cache; one at a time checks, fills or
+	// reads it.
+	c.builds.cacheMu.Lock()
+	cacheLocked := true
+	defer func() {
+		if cacheLocked {
+			c.builds.cacheMu.Unlock()
+		}
+	}()
 	if err := os.MkdirAll(cacheDir, 0755); err != nil {
-		c.failBuild(fmt.Sprintf("cache dir failed: %v", err))
+		run.fail(fmt.Sprintf("cache dir failed: %v", err))
 		return
 	}
 	baseImageXZ := filepath.Join(cacheDir, baseImageName)
 
+	// A retry from cache checks the cached base image against the hash
+	// recorded when it was cached, so it doesn't need the upstream mirror.
+	var expectedSHA256 string
+	if fromCache {
+		if expectedSHA256 = cachedHash(baseImageXZ); expectedSHA256 != "" {
+			run.logf("retrying from cache, recorded hash: %s", expectedSHA256)
+		} else {
+			run.logf("no cached base image recorded, checking upstream")
+		}
+	}
+	if expectedSHA256 == "" {
+		// Fetch hash dynamically
+		run.logf("fetching upstream hash for verification...")
+		expectedSHA256, err = fetchRemoteHash(baseImageURL)
+		if err != nil {
+			run.abort(buildCtx, fmt.Sprintf("failed to fetch upstream hash: %v", err))
+			return
+		}
+		run.logf("upstream hash: %s", expectedSHA256)
+	}
+
+	// Abort (killing the running step) if either volume fills up mid-build
+	go limits.watchDisk(buildCtx, cancelBuild, imagesDir, cacheDir)
+
 	// Check if file exists and verify hash
 	downloadNeeded := true
 	if _, err := os.Stat(baseImageXZ); err == nil {
-		c.logBuild("verifying existing image hash...")
+		run.logf("verifying existing image hash...")
 		if verifyHash(baseImageXZ, expectedSHA256) {
-			c.logBuild("hash verified, skipping download")
+			run.logf("hash verified, skipping download")
 			downloadNeeded = false
 		} else {
-			c.logBuild("hash mismatch, re-downloading...")
+			run.logf("hash mismatch, re-downloading...")
 			os.Remove(baseImageXZ)
 		}
 	}
 
 	if downloadNeeded {
-		c.logBuild("downloading base image from %s...", baseImageURL)
-		cmd := exec.Command("wget", "-O", baseImageXZ, baseImageURL)
+		run.logf("downloading base image from %s...", baseImageURL)
+		cmd := exec.CommandContext(buildCtx, "wget", "-O", baseImageXZ, baseImageURL)
 		if out, err := cmd.CombinedOutput(); err != nil {
-			c.failBuild(fmt.Sprintf("download failed: %v: %s", err, string(out)))
+			os.Remove(baseImageXZ)
+			run.abort(buildCtx, fmt.Sprintf("download failed: %v: %s", err, string(out)))
 			return
 		}
 		// Verify after download
 		if !verifyHash(baseImageXZ, expectedSHA256) {
-			c.failBuild("downloaded file hash mismatch")
+			run.fail("downloaded file hash mismatch")
 			os.Remove(baseImageXZ)
 			return
 		}
 	}
+	recordCachedHash(baseImageXZ, expectedSHA256)
 
 	// 4. Decompress to working copy
-	c.updateBuildProgress("Decompressing image...", 25)
-
-	// Construct image name
-	robotModel := cfg.RobotModel
-	if robotModel == "" {
-		robotModel = "TB3"
+	if stopped() {
+		return
 	}
-	rosVersion := cfg.ROSVersion
-	if rosVersion == "" {
-		rosVersion = "Humble"
+	run.progressTo("Checking disk space and memory...", 22)
+	if err := limits.preflight(baseImageXZ, imagesDir); err != nil {
+		run.fail(fmt.Sprintf("preflight failed: %v", err))
+		return
 	}
-	imageName := fmt.Sprintf("turtlebot-%s-%s-golden.img", strings.ToLower(robotModel), strings.ToLower(rosVersion))
+	run.progressTo("Decompressing image...", 25)
+
+	imageName := profileImageName(profile.Name, run.id)
 	workImage = filepath.Join(imagesDir, imageName)
+	// Recorded so that a restart mid-build knows which image is partial.
+	if err := c.DB.SetImageBuildImage(ctx, run.id, imageName); err != nil {
+		slog.Error("record image build", "err", err)
+	}
 
-	c.logBuild("decompressing to %s...", workImage)
-	cmd := exec.Command("xz", "-d", "-k", "-c", baseImageXZ)
+	run.logf("decompressing to %s...", workImage)
+	cmd := limits.command(buildCtx, "xz", "-d", "-k", "-c", baseImageXZ)
 	outFile, err := os.Create(workImage)
 	if err != nil {
-		c.failBuild(fmt.Sprintf("create work image failed: %v", err))
+		run.fail(fmt.Sprintf("create work image failed: %v", err))
 		return
 	}
 	cmd.Stdout = outFile
 	if err := cmd.Run(); err != nil {
 		outFile.Close()
-		c.failBuild(fmt.Sprintf("decompress failed: %v", err))
+		run.abort(buildCtx, fmt.Sprintf("decompress failed: %v", err))
 		return
 	}
 	outFile.Close()
+	// Done with the base image; another build may replace it now.
+	c.builds.cacheMu.Unlock()
+	cacheLocked = false
 
-	// 5. Expand Image (+4GB)
-	c.updateBuildProgress("Expanding image...", 35)
-	c.logBuild("expanding image by 4GB...")
-	if err := exec.Command("truncate", "-s", "+8G", workImage).Run(); err != nil {
-		c.failBuild(fmt.Sprintf("truncate failed: %v", err))
+	// 5. Expand Image (+8GB)
+	if stopped() {
+		return
+	}
+	run.progressTo("Expanding image...", 35)
+	run.logf("expanding image by 8GB...")
+	if err := exec.Command("truncate", "-s", fmt.Sprintf("+%d", imageExpandBytes), workImage).Run(); err != nil {
+		run.fail(fmt.Sprintf("truncate failed: %v", err))
 		return
 	}
 
 	// 6. Setup Loop Device
-	c.updateBuildProgress("Setting up loop device...", 40)
-	c.logBuild("setting up loop device...")
+	if stopped() {
+		return
+	}
+	run.progressTo("Setting up loop device...", 40)
+	run.logf("setting up loop device...")
 
 	if err := ensureLoopDevices(); err != nil {
-		c.logBuild("warning: failed to ensure loop devices: %v", err)
+		run.logf("warning: failed to ensure loop devices: %v", err)
 	}
 
 	out, err := exec.Command("losetup", "-fP", "--show", workImage).CombinedOutput()
 	if err != nil {
-		c.failBuild(fmt.Sprintf("losetup failed: %v: %s", err, string(out)))
+		run.fail(fmt.Sprintf("losetup failed: %v: %s", err, string(out)))
 		return
 	}
 	loopDev := strings.TrimSpace(string(out))
-	defer exec.Command("losetup", "-d", loopDev).Run()
+	detached := false
+	defer func() {
+		if !detached {
+			exec.Command("losetup", "-d", loopDev).Run()
+		}
+	}()
 
 	// 7. Resize Partition and Filesystem
-	c.updateBuildProgress("Resizing partitions...", 45)
-	c.logBuild("resizing partition 2 on %s...", loopDev)
+	if stopped() {
+		return
+	}
+	run.progressTo("Resizing partitions...", 45)
+	run.logf("resizing partition 2 on %s...", loopDev)
 	if out, err := exec.Command("parted", "-s", loopDev, "resizepart", "2", "100%").CombinedOutput(); err != nil {
-		c.failBuild(fmt.Sprintf("parted failed: %v: %s", err, string(out)))
+		run.fail(fmt.Sprintf("parted failed: %v: %s", err, string(out)))
 		return
 	}
 
@@ -470,44 +832,57 @@ func (c *Controller) runBuild() {
 
 	// Ensure device nodes exist (Docker container might not have udev)
 	if err := ensureDeviceNode(loopDev + "p1"); err != nil {
-		c.logBuild("warning: ensureDeviceNode p1: %v", err)
+		run.logf("warning: ensureDeviceNode p1: %v", err)
 	}
 	if err := ensureDeviceNode(loopDev + "p2"); err != nil {
-		c.logBuild("warning: ensureDeviceNode p2: %v", err)
+		run.logf("warning: ensureDeviceNode p2: %v", err)
 	}
 
-	c.logBuild("resizing filesystem on %sp2...", loopDev)
+	run.logf("resizing filesystem on %sp2...", loopDev)
 	if out, err := exec.Command("resize2fs", loopDev+"p2").CombinedOutput(); err != nil {
-		c.failBuild(fmt.Sprintf("resize2fs failed: %v: %s", err, string(out)))
+		run.fail(fmt.Sprintf("resize2fs failed: %v: %s", err, string(out)))
 		return
 	}
 
 	// 8. Mount
-	c.updateBuildProgress("Mounting image...", 50)
-	mntDir := "/mnt/turtlebot-build"
+	if stopped() {
+		return
+	}
+	run.progressTo("Mounting image...", 50)
+	mntDir := run.mountDir
 	os.MkdirAll(mntDir, 0755)
-	defer os.RemoveAll(mntDir)
+	// Remove, not RemoveAll: if the image couldn't be unmounted, the
+	// directory still reaches into it and the host's /dev.
+	defer os.Remove(mntDir)
 
 	// Mount root
 	if out, err := exec.Command("mount", loopDev+"p2", mntDir).CombinedOutput(); err != nil {
-		c.failBuild(fmt.Sprintf("mount root failed: %v: %s", err, string(out)))
+		run.fail(fmt.Sprintf("mount root failed: %v: %s", err, string(out)))
 		return
 	}
-	defer exec.Command("umount", "-R", mntDir).Run()
+	mounted := true
+	defer func() {
+		if mounted {
+			unmountBuild(mntDir)
+		}
+	}()
 
 	// Mount boot (firmware)
 	os.MkdirAll(filepath.Join(mntDir, "boot/firmware"), 0755)
 	if out, err := exec.Command("mount", loopDev+"p1", filepath.Join(mntDir, "boot/firmware")).CombinedOutput(); err != nil {
-		c.failBuild(fmt.Sprintf("mount boot failed: %v: %s", err, string(out)))
+		run.fail(fmt.Sprintf("mount boot failed: %v: %s", err, string(out)))
 		return
 	}
 
 	// 9. Prepare Chroot
-	c.updateBuildProgress("Preparing chroot environment...", 55)
-	c.logBuild("preparing chroot...")
+	if stopped() {
+		return
+	}
+	run.progressTo("Preparing chroot environment...", 55)
+	run.logf("preparing chroot...")
 	// Copy qemu-aarch64-static
 	if out, err := exec.Command("cp", "/usr/bin/qemu-aarch64-static", filepath.Join(mntDir, "usr/bin/")).CombinedOutput(); err != nil {
-		c.failBuild(fmt.Sprintf("cp qemu failed: %v: %s", err, string(out)))
+		run.fail(fmt.Sprintf("cp qemu failed: %v: %s", err, string(out)))
 		return
 	}
 	// Bind mounts
@@ -515,7 +890,7 @@ func (c *Controller) runBuild() {
 		if err := exec.Command("mount", "--bind", "/"+d, filepath.Join(mntDir, d)).Run(); err != nil {
 			// dev/pts might fail if not present, ignore
 			if d != "dev/pts" {
-				c.failBuild(fmt.Sprintf("mount bind %s failed: %v", d, err))
+				run.fail(fmt.Sprintf("mount bind %s failed: %v", d, err))
 				return
 			}
 		}
@@ -524,162 +899,36 @@ func (c *Controller) runBuild() {
 	destResolv := filepath.Join(mntDir, "etc/resolv.conf")
 	os.Remove(destResolv) // Remove existing file/symlink to avoid issues
 	if err := exec.Command("cp", "/etc/resolv.conf", destResolv).Run(); err != nil {
-		c.failBuild(fmt.Sprintf("cp resolv.conf failed: %v", err))
+		run.fail(fmt.Sprintf("cp resolv.conf failed: %v", err))
 		return
 	}
 
 	// 10. Install ROS 2 & Agent
-	c.updateBuildProgress("Installing ROS 2 and Agent (this takes 20-30 mins)...", 60)
-	c.logBuild("installing ROS 2 and Agent (this may take a while)...")
-
-	var installScript string
-	if cfg.RobotModel == "TB4" {
-		// TB4 Logic
-		branch := "humble"
-		if cfg.ROSVersion == "Jazzy" {
-			branch = "jazzy"
-		}
-		installScript = fmt.Sprintf(`#!/bin/bash
-set -e
-export DEBIAN_FRONTEND=noninteractive
-
-# Define sudo as a no-op since we are root
-function sudo() { "$@"; }
-export -f sudo
-
-# Install prerequisites
-apt-get update
-apt-get install -y wget curl git
-
-# Download and run official setup script
-wget -qO /tmp/turtlebot4_setup.sh https://raw.githubusercontent.com/turtlebot/turtlebot4_setup/%s/scripts/turtlebot4_setup.sh
-bash /tmp/turtlebot4_setup.sh
-
-# Install Docker
-curl -fsSL https://download.docker.com/linux/ubuntu/gpg | gpg --dearmor -o /usr/share/keyrings/docker-archive-keyring.gpg
-echo "deb [arch=$(dpkg --print-architecture) signed-by=/usr/share/keyrings/docker-archive-keyring.gpg] https://download.docker.com/linux/ubuntu $(. /etc/os-release && echo $UBUNTU_CODENAME) stable" | tee /etc/apt/sources.list.d/docker.list > /dev/null
-apt-get update
-apt-get install -y docker-ce docker-ce-cli containerd.io docker-buildx-plugin docker-compose-plugin
-usermod -aG docker ubuntu
-systemctl enable docker
-
-# Cleanup
-rm -f /tmp/turtlebot4_setup.sh /tmp/install.sh
-apt-get clean
-rm -rf /var/lib/apt/lists/*
-`, branch)
-	} else {
-		// TB3 Logic
-		rosDistro := "humble"
-		if cfg.ROSVersion == "Jazzy" {
-			rosDistro = "jazzy"
-		}
-		includeExtras := "true"
-		if cfg.IncludeExtras != nil && !*cfg.IncludeExtras {
-			includeExtras = "false"
-		}
-		installScript = fmt.Sprintf(`#!/bin/bash
-set -e
-export DEBIAN_FRONTEND=noninteractive
-
-# Set locale (required by ROS 2 install docs)
-apt-get update
-apt-get install -y locales
-locale-gen en_US en_US.UTF-8
-update-locale LC_ALL=en_US.UTF-8 LANG=en_US.UTF-8
-export LANG=en_US.UTF-8
-
-# The preinstalled Pi image may only list 'noble' in its apt Suites, missing
-# noble-updates and noble-backports. Per the ROS 2 Jazzy install docs, missing
-# these suites causes dependency conflicts. Add them before doing anything else.
-if [ -f /etc/apt/sources.list.d/ubuntu.sources ]; then
-    if ! grep -q "noble-updates" /etc/apt/sources.list.d/ubuntu.sources; then
-        sed -i 's/^Suites: noble$/Suites: noble noble-updates noble-backports/' /etc/apt/sources.list.d/ubuntu.sources
-    fi
-fi
-
-# Full-upgrade (not just upgrade) so held-back packages with new deps are also updated.
-apt-get clean
-apt-get update
-apt-get full-upgrade -y
-
-# Enable Universe repo
-apt-get install -y software-properties-common curl
-add-apt-repository universe -y
-
-# Add ROS 2 repo via the official ros2-apt-source package (per ROS 2 Jazzy install docs)
-ROS_APT_SOURCE_VERSION=$(curl -s https://api.github.com/repos/ros-infrastructure/ros-apt-source/releases/latest | grep -F "tag_name" | awk -F'"' '{print $4}')
-curl -L -o /tmp/ros2-apt-source.deb "https://github.com/ros-infrastructure/ros-apt-source/releases/download/${ROS_APT_SOURCE_VERSION}/ros2-apt-source_${ROS_APT_SOURCE_VERSION}.$(. /etc/os-release && echo ${UBUNTU_CODENAME:-${VERSION_CODENAME}})_all.deb"
-dpkg -i /tmp/ros2-apt-source.deb
-apt-get update
-
-apt-get install -y ros-%s-ros-base ros-%s-turtlebot3-msgs ros-%s-dynamixel-sdk ros-%s-xacro ros-%s-hls-lfcd-lds-driver ros-%s-robot-state-publisher ros-%s-joint-state-publisher ros-%s-tf2-tools ros-%s-laser-geometry ros-%s-diagnostic-updater libudev-dev build-essential git python3-colcon-common-extensions
-
-if [ "%s" = "true" ]; then
-    apt-get install -y ros-%s-slam-toolbox ros-%s-navigation2 ros-%s-nav2-bringup ros-%s-cartographer-ros ros-%s-teleop-twist-keyboard ros-%s-teleop-twist-joy ros-%s-joy
-fi
-
-# Setup Workspace
-if ! id -u ubuntu >/dev/null 2>&1; then
-    useradd --create-home --shell /bin/bash --groups sudo ubuntu
-fi
-mkdir -p /home/ubuntu/ros_ws/src
-cd /home/ubuntu/ros_ws/src
-git clone -b %s https://github.com/ROBOTIS-GIT/turtlebot3.git
-git clone -b %s https://github.com/ROBOTIS-GIT/ld08_driver.git
-cd /home/ubuntu/ros_ws
-source /opt/ros/%s/setup.bash
-colcon build --symlink-install --parallel-workers 1
-chown -R ubuntu:ubuntu /home/ubuntu/ros_ws
-chown ubuntu:ubuntu /home/ubuntu
-mkdir -p /home/ubuntu/.ros
-chown -R ubuntu:ubuntu /home/ubuntu/.ros
-
-# Udev Rules
-cp /home/ubuntu/ros_ws/src/turtlebot3/turtlebot3_bringup/script/99-turtlebot3-cdc.rules /etc/udev/rules.d/
-
-# Install Docker
-curl -fsSL https://download.docker.com/linux/ubuntu/gpg | gpg --dearmor -o /usr/share/keyrings/docker-archive-keyring.gpg
-echo "deb [arch=$(dpkg --print-architecture) signed-by=/usr/share/keyrings/docker-archive-keyring.gpg] https://download.docker.com/linux/ubuntu $(. /etc/os-release && echo $UBUNTU_CODENAME) stable" | tee /etc/apt/sources.list.d/docker.list > /dev/null
-apt-get update
-apt-get install -y docker-ce docker-ce-cli containerd.io docker-buildx-plugin docker-compose-plugin
-usermod -aG docker ubuntu
-systemctl enable docker
+	run.progressTo("Installing ROS 2 and Agent (this takes 20-30 mins)...", installFrom)
+	run.logf("installing ROS 2 and Agent (this may take a while)...")
 
-# Cleanup
-rm -f /tmp/install.sh
-apt-get clean
-rm -rf /var/lib/apt/lists/*
-`, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, includeExtras, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro)
-	}
-	if err := os.WriteFile(filepath.Join(mntDir, "tmp/install.sh"), []byte(installScript), 0755); err != nil {
-		c.failBuild(fmt.Sprintf("write install script failed: %v", err))
+	if err := os.WriteFile(filepath.Join(mntDir, "tmp/install.sh"), []byte(installScript(cfg)), 0755); err != nil {
+		run.fail(fmt.Sprintf("write install script failed: %v", err))
 		return
 	}
 
-	// Copy Agent Binary (assuming it's in current dir or path)
-	// We are running in /app, agent binary is ./agent (from Dockerfile)
-	// Golden images are always ARM64 (Raspberry Pi)
-	binaryName := "agent-arm64"
-	binaryPath := filepath.Join("/app", binaryName)
-	if _, err := os.Stat(binaryPath); os.IsNotExist(err) {
-		// Fallback to local dir if running locally
-		binaryPath = "./" + binaryName
-	}
-
-	if out, err := exec.Command("cp", binaryPath, filepath.Join(mntDir, "usr/local/bin/openrobotfleet-agent")).CombinedOutput(); err != nil {
-		c.logBuild("warning: could not copy agent binary: %v %s", err, string(out))
+	// Copy Agent Binary from the registry
+	if out, err := exec.Command("cp", goldenAgentBinary(), filepath.Join(mntDir, "usr/local/bin/openrobotfleet-agent")).CombinedOutput(); err != nil {
+		run.logf("warning: could not copy agent binary: %v %s", err, string(out))
 	}
 	exec.Command("chmod", "+x", filepath.Join(mntDir, "usr/local/bin/openrobotfleet-agent")).Run()
 
 	// Run Script in Chroot
-	cmd = exec.Command("chroot", mntDir, "/bin/bash", "/tmp/install.sh")
+	if stopped() {
+		return
+	}
+	cmd = limits.command(buildCtx, "chroot", mntDir, "/bin/bash", "/tmp/install.sh")
 
 	stdout, _ := cmd.StdoutPipe()
 	stderr, _ := cmd.StderrPipe()
 
 	if err := cmd.Start(); err != nil {
-		c.failBuild(fmt.Sprintf("install script start failed: %v", err))
+		run.fail(fmt.Sprintf("install script start failed: %v", err))
 		return
 	}
 
@@ -689,9 +938,12 @@ rm -rf /var/lib/apt/lists/*
 
 	go func() {
 		defer wg.Done()
+		progress := newInstallProgress(run)
 		scanner := bufio.NewScanner(stdout)
 		for scanner.Scan() {
-			c.logBuild("[install] %s", scanner.Text())
+			if !progress.line(scanner.Text()) {
+				run.logf("[install] %s", scanner.Text())
+			}
 		}
 	}()
 
@@ -699,14 +951,14 @@ rm -rf /var/lib/apt/lists/*
 		defer wg.Done()
 		scanner := bufio.NewScanner(stderr)
 		for scanner.Scan() {
-			c.logBuild("[install/err] %s", scanner.Text())
+			run.logf("[install/err] %s", scanner.Text())
 		}
 	}()
 
 	wg.Wait()
 
 	if err := cmd.Wait(); err != nil {
-		c.failBuild(fmt.Sprintf("install script failed: %v", err))
+		run.abort(buildCtx, fmt.Sprintf("install script failed: %v", err))
 		return
 	}
 
@@ -719,81 +971,104 @@ rm -rf /var/lib/apt/lists/*
 	os.Symlink("/run/systemd/resolve/stub-resolv.conf", filepath.Join(mntDir, "etc/resolv.conf"))
 
 	// 11. Write User Data (Cloud Init)
-	c.updateBuildProgress("Injecting configuration...", 90)
-	c.logBuild("writing user-data...")
+	if stopped() {
+		return
+	}
+	run.progressTo("Injecting configuration...", installTo)
+	run.logf("writing user-data...")
 	userDataPath := filepath.Join(mntDir, "boot/firmware/user-data") // Ubuntu 22.04 Pi
 
-	// Fetch default install config for SSH key
-	installCfg, err := c.DB.GetDefaultInstallConfig(ctx)
-	sshKey := ""
-	if err == nil && installCfg != nil {
-		sshKey = installCfg.SSHKey
+	userData, err := c.renderUserData(ctx, cfg)
+	if err != nil {
+		run.fail(err.Error())
+		return
 	}
-
-	pubKey, _ := prepareSSHKeys(sshKey)
-
-	tmplData := struct {
-		*db.GoldenImageConfig
-		SSHPublicKey string
-	}{
-		GoldenImageConfig: cfg,
-		SSHPublicKey:      pubKey,
+	if err := os.WriteFile(userDataPath, userData, 0644); err != nil {
+		run.fail(fmt.Sprintf("create user-data failed: %v", err))
+		return
 	}
 
-	tmpl, err := template.New("user-data").Parse(userDataTemplate)
-	if err != nil {
-		c.failBuild(fmt.Sprintf("template parse failed: %v", err))
+	// 12. Unmount, so what is compressed is what gets flashed
+	if stopped() {
 		return
 	}
-	f, err := os.Create(userDataPath)
-	if err != nil {
-		c.failBuild(fmt.Sprintf("create user-data failed: %v", err))
+	run.progressTo("Unmounting image...", 92)
+	if err := unmountBuild(mntDir); err != nil {
+		run.fail(fmt.Sprintf("unmount failed: %v", err))
 		return
 	}
-	if err := tmpl.Execute(f, tmplData); err != nil {
-		f.Close()
-		c.failBuild(fmt.Sprintf("template execute failed: %v", err))
+	mounted = false
+	if out, err := exec.Command("losetup", "-d", loopDev).CombinedOutput(); err != nil {
+		run.fail(fmt.Sprintf("detach loop device failed: %v: %s", err, string(out)))
 		return
 	}
-	f.Close()
-
-	buildSucceeded = true
-
-	// Success
-	buildLock.Lock()
-	buildStatus = "success"
-	buildProgress = 100
-	buildStep = fmt.Sprintf("Build complete! Image: %s", imageName)
-	buildImageName = imageName
-
-	// Capture state
-	logs := make([]string, len(buildLogs))
-	copy(logs, buildLogs)
-	buildLock.Unlock()
-
-	if c.OnBuildUpdate != nil {
-		c.OnBuildUpdate("success", 100, fmt.Sprintf("Build complete! Image: %s", imageName), logs, "", imageName)
+	detached = true
+	if smokeTestEnabled() {
+		c.smokeTest(buildCtx, run, workImage, cfg)
 	}
 
-	c.logBuild("golden image build complete: %s", workImage)
+	// 13. Compress, checksum and sign
+	if stopped() {
+		return
+	}
+	run.progressTo("Compressing image...", 94)
+	run.logf("compressing %s...", workImage)
+	// xz replaces the image with image.xz once it is done.
+	if out, err := limits.command(buildCtx, "xz", "-T0", "-f", workImage).CombinedOutput(); err != nil {
+		run.abort(buildCtx, fmt.Sprintf("compress failed: %v: %s", err, string(out)))
+		return
+	}
+	seal(imageName + ".xz")
 }
 
-func (c *Controller) failBuild(msg string) {
-	c.logBuild("build failed: %s", msg)
-	buildLock.Lock()
-	buildStatus = "error"
-	buildError = msg
+// recordBuild records how a build that started at started ended in the
+// history, and applies the profile's retention once it has written an
+// image of imageSize bytes with checksum.
+func (c *Controller) recordBuild(run *buildRun, profile db.ImageProfile, started time.Time, imageSize int64, checksum string) {
+	run.mu.Lock()
+	b := db.ImageBuild{ID: run.id, Status: run.status, ImageName: run.imageName, Error: run.err, Log: strings.Join(run.logs, "\n"), SmokeTest: run.smoke, SmokeError: run.smokeErr}
+	run.mu.Unlock()
+	buildDuration.Observe(time.Since(started).Seconds(), b.Status)
+	if b.Status == "success" {
+		b.ImageSize, b.Checksum = imageSize, checksum
+	}
+	if err := c.DB.FinishImageBuild(context.Background(), b); err != nil {
+		slog.Error("record image build", "err", err)
+	}
+	if b.Status == "success" {
+		removed, _, err := c.pruneProfileImages(context.Background(), profile)
+		if err != nil {
+			slog.Error("list profile images", "profile_id", profile.ID, "err", err)
+		}
+		for _, image := range removed {
+			run.logf("removed old image %s", image)
+		}
+	}
+}
 
-	// Capture state
-	progress := buildProgress
-	step := buildStep
-	logs := make([]string, len(buildLogs))
-	copy(logs, buildLogs)
-	imageName := buildImageName
-	buildLock.Unlock()
+// WaitForBuild blocks until in-flight golden image builds finish. If ctx
+// expires first they are marked interrupted so clients are not left
+// watching builds that died with the process.
+func (c *Controller) WaitForBuild(ctx context.Context) {
+	// Queued builds stay queued and start when the controller next runs.
+	c.builds.startMu.Lock()
+	c.builds.mu.Lock()
+	c.builds.stopped = true
+	c.builds.mu.Unlock()
+	c.builds.startMu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		c.builds.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
 
-	if c.OnBuildUpdate != nil {
-		c.OnBuildUpdate("error", progress, step, logs, msg, imageName)
+	for _, run := range c.builds.active() {
+		run.interrupt()
 	}
 }
 
@@ -828,11 +1103,12 @@ func prepareSSHKeys(rawKey string) (pubKey string, privKeyIndented string) {
 		return "", ""
 	}
 
-	// Try to parse as private key
-	signer, err := ssh.ParsePrivateKey([]byte(rawKey))
+	// Try to parse as private key. An OpenSSH key protected by a passphrase
+	// still has its public key in the clear.
+	pub, err := sshc.PublicKey([]byte(rawKey), "")
 	if err == nil {
 		// It is a valid private key
-		pubKey = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+		pubKey = pub
 		// We don't need the private key for the robot anymore
 		privKeyIndented = ""
 	} else {
@@ -841,7 +1117,7 @@ func prepareSSHKeys(rawKey string) (pubKey string, privKeyIndented string) {
 		if strings.Contains(rawKey, "PRIVATE KEY") || strings.Contains(rawKey, "\n") {
 			// It's multiline or looks like a private key, but we couldn't parse it.
 			// Do NOT use it as a public key, it will break cloud-init.
-			log.Printf("Warning: Failed to parse SSH key and it looks like a private key. Skipping.")
+			slog.Warn("failed to parse SSH key that looks like a private key; skipping")
 			return "", ""
 		}
 
@@ -913,3 +1189,242 @@ func fetchRemoteHash(imageURL string) (string, error) {
 	}
 	return "", fmt.Errorf("hash not found in SHA256SUMS")
 }
+
+// baseImage returns the Ubuntu Pi image cfg's ROS version runs on and the
+// name it is cached under.
+func baseImage(cfg *db.GoldenImageConfig) (url, name string) {
+	if cfg.ROSVersion == "Jazzy" {
+		return "https://cdimage.ubuntu.com/releases/24.04/release/ubuntu-24.04.3-preinstalled-server-arm64+raspi.img.xz", "ubuntu-24.04-server-arm64.img.xz"
+	}
+	return "https://cdimage.ubuntu.com/releases/22.04/release/ubuntu-22.04.5-preinstalled-server-arm64+raspi.img.xz", "ubuntu-22.04-server-arm64.img.xz"
+}
+
+// installScript is the script run in the image's chroot to install ROS 2,
+// the robot's drivers and Docker.
+func installScript(cfg *db.GoldenImageConfig) string {
+	if cfg.RobotModel == "TB4" {
+		// TB4 Logic
+		branch := "humble"
+		if cfg.ROSVersion == "Jazzy" {
+			branch = "jazzy"
+		}
+		return fmt.Sprintf(`#!/bin/bash
+set -e
+export DEBIAN_FRONTEND=noninteractive
+
+# Define sudo as a no-op since we are root
+function sudo() { "$@"; }
+export -f sudo
+
+# Install prerequisites
+echo "::install 0 5 Installing prerequisites"
+apt-get update
+apt-get install -y wget curl git
+
+# Download and run official setup script
+echo "::install 5 75 Running the TurtleBot 4 setup script"
+wget -qO /tmp/turtlebot4_setup.sh https://raw.githubusercontent.com/turtlebot/turtlebot4_setup/%s/scripts/turtlebot4_setup.sh
+bash /tmp/turtlebot4_setup.sh
+# GStreamer WebRTC for teleoperation from the dashboard
+echo "::install 75 80 Installing GStreamer"
+apt-get install -y python3-gi gir1.2-gst-plugins-bad-1.0 gstreamer1.0-plugins-good gstreamer1.0-plugins-bad gstreamer1.0-nice
+
+# Install Docker
+echo "::install 80 95 Installing Docker"
+curl -fsSL https://download.docker.com/linux/ubuntu/gpg | gpg --dearmor -o /usr/share/keyrings/docker-archive-keyring.gpg
+echo "deb [arch=$(dpkg --print-architecture) signed-by=/usr/share/keyrings/docker-archive-keyring.gpg] https://download.docker.com/linux/ubuntu $(. /etc/os-release && echo $UBUNTU_CODENAME) stable" | tee /etc/apt/sources.list.d/docker.list > /dev/null
+apt-get update
+apt-get install -y docker-ce docker-ce-cli containerd.io docker-buildx-plugin docker-compose-plugin
+usermod -aG docker ubuntu
+systemctl enable docker
+echo "::install 95 100 Installing lab packages and cleaning up"
+%s
+# Cleanup
+rm -f /tmp/turtlebot4_setup.sh /tmp/install.sh
+apt-get clean
+rm -rf /var/lib/apt/lists/*
+`, branch, labPackages(cfg))
+	} else {
+		// TB3 Logic
+		rosDistro := "humble"
+		if cfg.ROSVersion == "Jazzy" {
+			rosDistro = "jazzy"
+		}
+		includeExtras := "true"
+		if cfg.IncludeExtras != nil && !*cfg.IncludeExtras {
+			includeExtras = "false"
+		}
+		return fmt.Sprintf(`#!/bin/bash
+set -e
+export DEBIAN_FRONTEND=noninteractive
+
+# Set locale (required by ROS 2 install docs)
+echo "::install 0 5 Setting the locale"
+apt-get update
+apt-get install -y locales
+locale-gen en_US en_US.UTF-8
+update-locale LC_ALL=en_US.UTF-8 LANG=en_US.UTF-8
+export LANG=en_US.UTF-8
+
+# The preinstalled Pi image may only list 'noble' in its apt Suites, missing
+# noble-updates and noble-backports. Per the ROS 2 Jazzy install docs, missing
+# these suites causes dependency conflicts. Add them before doing anything else.
+if [ -f /etc/apt/sources.list.d/ubuntu.sources ]; then
+    if ! grep -q "noble-updates" /etc/apt/sources.list.d/ubuntu.sources; then
+        sed -i 's/^Suites: noble$/Suites: noble noble-updates noble-backports/' /etc/apt/sources.list.d/ubuntu.sources
+    fi
+fi
+
+# Full-upgrade (not just upgrade) so held-back packages with new deps are also updated.
+echo "::install 5 30 Upgrading the base system"
+apt-get clean
+apt-get update
+apt-get full-upgrade -y
+
+# Enable Universe repo
+echo "::install 30 35 Adding the ROS 2 repository"
+apt-get install -y software-properties-common curl
+add-apt-repository universe -y
+
+# Add ROS 2 repo via the official ros2-apt-source package (per ROS 2 Jazzy install docs)
+ROS_APT_SOURCE_VERSION=$(curl -s https://api.github.com/repos/ros-infrastructure/ros-apt-source/releases/latest | grep -F "tag_name" | awk -F'"' '{print $4}')
+curl -L -o /tmp/ros2-apt-source.deb "https://github.com/ros-infrastructure/ros-apt-source/releases/download/${ROS_APT_SOURCE_VERSION}/ros2-apt-source_${ROS_APT_SOURCE_VERSION}.$(. /etc/os-release && echo ${UBUNTU_CODENAME:-${VERSION_CODENAME}})_all.deb"
+dpkg -i /tmp/ros2-apt-source.deb
+apt-get update
+
+echo "::install 35 60 Installing ROS 2"
+apt-get install -y ros-%s-ros-base ros-%s-turtlebot3-msgs ros-%s-dynamixel-sdk ros-%s-xacro ros-%s-hls-lfcd-lds-driver ros-%s-robot-state-publisher ros-%s-joint-state-publisher ros-%s-tf2-tools ros-%s-laser-geometry ros-%s-diagnostic-updater libudev-dev build-essential git python3-colcon-common-extensions
+
+if [ "%s" = "true" ]; then
+    echo "::install 60 72 Installing navigation and SLAM"
+    apt-get install -y ros-%s-slam-toolbox ros-%s-navigation2 ros-%s-nav2-bringup ros-%s-cartographer-ros ros-%s-teleop-twist-keyboard ros-%s-teleop-twist-joy ros-%s-joy
+fi
+
+# Setup Workspace
+echo "::install 72 85 Building the TurtleBot 3 workspace"
+if ! id -u ubuntu >/dev/null 2>&1; then
+    useradd --create-home --shell /bin/bash --groups sudo ubuntu
+fi
+mkdir -p /home/ubuntu/ros_ws/src
+cd /home/ubuntu/ros_ws/src
+git clone -b %s https://github.com/ROBOTIS-GIT/turtlebot3.git
+git clone -b %s https://github.com/ROBOTIS-GIT/ld08_driver.git
+cd /home/ubuntu/ros_ws
+source /opt/ros/%s/setup.bash
+echo "::total $(colcon list --names-only | wc -l)"
+colcon build --symlink-install --parallel-workers 1
+chown -R ubuntu:ubuntu /home/ubuntu/ros_ws
+chown ubuntu:ubuntu /home/ubuntu
+mkdir -p /home/ubuntu/.ros
+chown -R ubuntu:ubuntu /home/ubuntu/.ros
+
+# Udev Rules
+cp /home/ubuntu/ros_ws/src/turtlebot3/turtlebot3_bringup/script/99-turtlebot3-cdc.rules /etc/udev/rules.d/
+# GStreamer WebRTC for teleoperation from the dashboard
+echo "::install 85 88 Installing GStreamer"
+apt-get install -y python3-gi gir1.2-gst-plugins-bad-1.0 gstreamer1.0-plugins-good gstreamer1.0-plugins-bad gstreamer1.0-nice
+
+# Install Docker
+echo "::install 88 96 Installing Docker"
+curl -fsSL https://download.docker.com/linux/ubuntu/gpg | gpg --dearmor -o /usr/share/keyrings/docker-archive-keyring.gpg
+echo "deb [arch=$(dpkg --print-architecture) signed-by=/usr/share/keyrings/docker-archive-keyring.gpg] https://download.docker.com/linux/ubuntu $(. /etc/os-release && echo $UBUNTU_CODENAME) stable" | tee /etc/apt/sources.list.d/docker.list > /dev/null
+apt-get update
+apt-get install -y docker-ce docker-ce-cli containerd.io docker-buildx-plugin docker-compose-plugin
+usermod -aG docker ubuntu
+systemctl enable docker
+echo "::install 96 100 Installing lab packages and cleaning up"
+%s
+# Cleanup
+rm -f /tmp/install.sh
+apt-get clean
+rm -rf /var/lib/apt/lists/*
+`, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, includeExtras, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, rosDistro, labPackages(cfg))
+	}
+}
+
+// labPackages is the part of the install script that installs the config's
+// own apt and pip packages.
+func labPackages(cfg *db.GoldenImageConfig) string {
+	var b strings.Builder
+	if len(cfg.AptPackages) > 0 || len(cfg.PipPackages) > 0 {
+		b.WriteString("\n# Lab packages\n")
+	}
+	if len(cfg.AptPackages) > 0 {
+		b.WriteString("apt-get update\napt-get install -y")
+		for _, pkg := range cfg.AptPackages {
+			b.WriteString(" " + shellQuote(pkg))
+		}
+		b.WriteString("\n")
+	}
+	if len(cfg.PipPackages) > 0 {
+		// Ubuntu 24.04's pip refuses to install system-wide without
+		// --break-system-packages, which 22.04's doesn't know.
+		b.WriteString("apt-get install -y python3-pip\n")
+		b.WriteString("PIP_FLAGS=\"\"\n")
+		b.WriteString("if pip3 install --help | grep -q break-system-packages; then PIP_FLAGS=--break-system-packages; fi\n")
+		b.WriteString("pip3 install $PIP_FLAGS")
+		for _, pkg := range cfg.PipPackages {
+			b.WriteString(" " + shellQuote(pkg))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// goldenAgentBinary is the agent baked into images, from the registry.
+// Golden images are always ARM64 (Raspberry Pi).
+func goldenAgentBinary() string {
+	binaryPath := agentBinaryPath("arm64")
+	if _, err := os.Stat(binaryPath); os.IsNotExist(err) {
+		// Fallback to local dir if running locally
+		binaryPath = "./agent-arm64"
+	}
+	return binaryPath
+}
+
+// renderUserData renders the cloud-init user-data written to the image's
+// boot partition.
+func (c *Controller) renderUserData(ctx context.Context, cfg *db.GoldenImageConfig) ([]byte, error) {
+	return c.renderDeviceUserData(ctx, cfg, "")
+}
+
+// renderDeviceUserData renders user-data for one robot when agentID is set:
+// it boots as agentID instead of a random robot-xxxxxx, and doesn't enroll.
+func (c *Controller) renderDeviceUserData(ctx context.Context, cfg *db.GoldenImageConfig, agentID string) ([]byte, error) {
+	// Fetch default install config for SSH key
+	installCfg, err := c.DB.GetDefaultInstallConfig(ctx)
+	sshKey := ""
+	if err == nil && installCfg != nil {
+		sshKey = installCfg.SSHKey
+	}
+
+	pubKey, _ := prepareSSHKeys(sshKey)
+
+	tmplData, err := newUserData(cfg, pubKey)
+	if err != nil {
+		return nil, fmt.Errorf("render wifi networks failed: %v", err)
+	}
+	tmplData.AgentID = agentID
+	if agentID == "" {
+		if tmplData.ProvisionToken, err = c.imageProvisionToken(ctx, cfg); err != nil {
+			return nil, fmt.Errorf("load provisioning token failed: %v", err)
+		}
+	}
+	label := "golden image"
+	if agentID != "" {
+		label = agentID
+	}
+	if tmplData.EnrollmentToken, _, err = c.issueEnrollmentToken(ctx, label, imageEnrollmentTTL()); err != nil {
+		return nil, fmt.Errorf("issue enrollment token failed: %v", err)
+	}
+
+	tmpl, err := template.New("user-data").Parse(userDataTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("template parse failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, tmplData); err != nil {
+		return nil, fmt.Errorf("template execute failed: %v", err)
+	}
+	return buf.Bytes(), nil
+}
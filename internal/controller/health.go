@@ -0,0 +1,293 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+const (
+	// agentHeartbeatInterval matches the agent's heartbeat period.
+	agentHeartbeatInterval = 10 * time.Second
+	heartbeatWindow        = 10 * time.Minute
+	healthJobWindow        = 72 * time.Hour
+	healthTelemetryMaxAge  = 10 * time.Minute
+
+	healthyScore    = 80
+	degradedScore   = 50
+	offlineMaxScore = 40
+)
+
+// Health score weights; they add up to 100.
+const (
+	weightHeartbeat = 40
+	weightJobs      = 25
+	weightDisk      = 10
+	weightTemp      = 10
+	weightVersion   = 15
+)
+
+// heartbeatTracker remembers when heartbeats arrived over the last window so
+// a robot that drops every other one shows up before it goes offline.
+type heartbeatTracker struct {
+	mu    sync.Mutex
+	seen  map[int64][]time.Time
+	first map[int64]time.Time
+}
+
+func (t *heartbeatTracker) record(robotID int64, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.seen == nil {
+		t.seen = make(map[int64][]time.Time)
+		t.first = make(map[int64]time.Time)
+	}
+	if _, ok := t.first[robotID]; !ok {
+		t.first[robotID] = now
+	}
+	beats := append(t.seen[robotID], now)
+	cutoff := now.Add(-heartbeatWindow)
+	for len(beats) > 0 && beats[0].Before(cutoff) {
+		beats = beats[1:]
+	}
+	t.seen[robotID] = beats
+}
+
+func (t *heartbeatTracker) forget(robotID int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.seen, robotID)
+	delete(t.first, robotID)
+}
+
+// regularity is the fraction of expected heartbeats received in the window,
+// or 1 when the controller hasn't been listening long enough to tell.
+func (t *heartbeatTracker) regularity(robotID int64, now time.Time) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	first, ok := t.first[robotID]
+	if !ok {
+		return 1
+	}
+	span := min(now.Sub(first), heartbeatWindow)
+	if span < time.Minute {
+		return 1
+	}
+	cutoff := now.Add(-heartbeatWindow)
+	n := 0
+	for _, b := range t.seen[robotID] {
+		if !b.Before(cutoff) {
+			n++
+		}
+	}
+	// The first beat opens the span rather than filling an interval.
+	expected := float64(span/agentHeartbeatInterval) + 1
+	return math.Min(1, float64(n)/expected)
+}
+
+// RecordHeartbeat notes a status message from a known robot.
+func (c *Controller) RecordHeartbeat(robotID int64, now time.Time) {
+	if robotID != 0 {
+		c.heartbeats.record(robotID, now)
+	}
+}
+
+// RobotHealth scores one robot from 0 to 100 and explains what cost points.
+type RobotHealth struct {
+	ID     int64    `json:"id"`
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Status string   `json:"status"`
+	Score  int      `json:"score"`
+	Grade  string   `json:"grade"` // healthy, degraded or unhealthy
+	Issues []string `json:"issues"`
+}
+
+// FleetCounts breaks one device type down by connectivity and health grade.
+type FleetCounts struct {
+	Total     int `json:"total"`
+	Online    int `json:"online"`
+	Offline   int `json:"offline"`
+	Unknown   int `json:"unknown"`
+	Healthy   int `json:"healthy"`
+	Degraded  int `json:"degraded"`
+	Unhealthy int `json:"unhealthy"`
+}
+
+// FleetSummary is the landing page view of the fleet.
+type FleetSummary struct {
+	GeneratedAt  time.Time   `json:"generated_at"`
+	Robots       FleetCounts `json:"robots"`
+	Laptops      FleetCounts `json:"laptops"`
+	AverageScore int         `json:"average_score"`
+	// FailedJobs counts failed jobs over the same window the scores use.
+	FailedJobs     int `json:"failed_jobs"`
+	JobWindowHours int `json:"job_window_hours"`
+	// AgentVersions are the builds the controller currently serves; robots
+	// running anything else are flagged as outdated.
+	AgentVersions []string `json:"agent_versions"`
+	// Health lists every device, worst score first.
+	Health []RobotHealth `json:"health"`
+}
+
+// healthInputs is everything scoring needs beyond the robot row.
+type healthInputs struct {
+	now      time.Time
+	jobs     map[string]db.JobFailureCount
+	disk     map[int64]float64
+	temp     map[int64]float64
+	versions map[string]bool
+}
+
+// BuildFleetSummary scores every robot and aggregates the counts.
+func (c *Controller) BuildFleetSummary(ctx context.Context, now time.Time) (FleetSummary, error) {
+	sum := FleetSummary{GeneratedAt: now.UTC(), JobWindowHours: int(healthJobWindow.Hours()), AgentVersions: []string{}, Health: []RobotHealth{}}
+	robots, err := c.DB.ListRobots(ctx)
+	if err != nil {
+		return sum, fmt.Errorf("list robots: %w", err)
+	}
+	in := healthInputs{now: now, versions: map[string]bool{}}
+	if in.jobs, err = c.DB.JobCountsByRobot(ctx, now.Add(-healthJobWindow), now); err != nil {
+		return sum, fmt.Errorf("count jobs: %w", err)
+	}
+	if in.disk, err = c.DB.LatestTelemetry(ctx, agent.MetricDisk, now.Add(-healthTelemetryMaxAge)); err != nil {
+		return sum, fmt.Errorf("disk telemetry: %w", err)
+	}
+	if in.temp, err = c.DB.LatestTelemetry(ctx, agent.MetricCPUTemp, now.Add(-healthTelemetryMaxAge)); err != nil {
+		return sum, fmt.Errorf("temperature telemetry: %w", err)
+	}
+	// No binaries (e.g. a dev controller) means freshness can't be judged.
+	if binaries, err := listAgentBinaries(); err == nil {
+		for _, b := range binaries {
+			if b.Version != "unknown" && !in.versions[b.Version] {
+				in.versions[b.Version] = true
+				sum.AgentVersions = append(sum.AgentVersions, b.Version)
+			}
+		}
+	}
+	sort.Strings(sum.AgentVersions)
+	for _, j := range in.jobs {
+		sum.FailedJobs += j.Failed
+	}
+
+	total := 0
+	for _, r := range robots {
+		h := c.robotHealth(r, in)
+		sum.Health = append(sum.Health, h)
+		total += h.Score
+		counts := &sum.Robots
+		if r.Type == "laptop" {
+			counts = &sum.Laptops
+		}
+		counts.Total++
+		switch r.Status {
+		case "offline":
+			counts.Offline++
+		case "unknown":
+			counts.Unknown++
+		default:
+			counts.Online++
+		}
+		switch h.Grade {
+		case "healthy":
+			counts.Healthy++
+		case "degraded":
+			counts.Degraded++
+		default:
+			counts.Unhealthy++
+		}
+	}
+	if len(robots) > 0 {
+		sum.AverageScore = int(math.Round(float64(total) / float64(len(robots))))
+	}
+	sort.SliceStable(sum.Health, func(i, j int) bool {
+		if sum.Health[i].Score != sum.Health[j].Score {
+			return sum.Health[i].Score < sum.Health[j].Score
+		}
+		return sum.Health[i].Name < sum.Health[j].Name
+	})
+	return sum, nil
+}
+
+// robotHealth deducts points for each problem. Missing data (no jobs, no
+// telemetry, unknown version) costs nothing; only evidence of trouble does.
+func (c *Controller) robotHealth(r db.Robot, in healthInputs) RobotHealth {
+	h := RobotHealth{ID: r.ID, Name: r.Name, Type: r.Type, Status: r.Status, Issues: []string{}}
+	score := 100.0
+
+	switch r.Status {
+	case "offline":
+		score -= weightHeartbeat
+		h.Issues = append(h.Issues, fmt.Sprintf("offline since %s", r.LastSeen.Local().Format("Jan 2 15:04")))
+	case "unknown":
+		score -= weightHeartbeat
+		h.Issues = append(h.Issues, "never connected")
+	default:
+		if reg := c.heartbeats.regularity(r.ID, in.now); reg < 0.9 {
+			score -= weightHeartbeat * (1 - reg)
+			h.Issues = append(h.Issues, fmt.Sprintf("missed %.0f%% of heartbeats", 100*(1-reg)))
+		}
+	}
+
+	if j, ok := in.jobs[r.AgentID]; ok && j.Failed > 0 && j.Total > 0 {
+		score -= weightJobs * float64(j.Failed) / float64(j.Total)
+		h.Issues = append(h.Issues, fmt.Sprintf("%d of %d jobs failed", j.Failed, j.Total))
+	}
+
+	if disk, ok := in.disk[r.ID]; ok {
+		if penalty := ramp(disk, 80, 95); penalty > 0 {
+			score -= weightDisk * penalty
+			h.Issues = append(h.Issues, fmt.Sprintf("disk %.0f%% full", disk))
+		}
+	}
+	if temp, ok := in.temp[r.ID]; ok {
+		if penalty := ramp(temp, 70, 85); penalty > 0 {
+			score -= weightTemp * penalty
+			h.Issues = append(h.Issues, fmt.Sprintf("CPU at %.0f°C", temp))
+		}
+	}
+
+	if len(in.versions) > 0 && r.AgentVersion != "" && !in.versions[r.AgentVersion] {
+		score -= weightVersion
+		h.Issues = append(h.Issues, fmt.Sprintf("agent %s is outdated", r.AgentVersion))
+	}
+
+	// Whatever else is true, a robot that isn't reporting isn't healthy.
+	if r.Status == "offline" || r.Status == "unknown" {
+		score = math.Min(score, offlineMaxScore)
+	}
+	h.Score = int(math.Round(math.Max(0, score)))
+	switch {
+	case h.Score >= healthyScore:
+		h.Grade = "healthy"
+	case h.Score >= degradedScore:
+		h.Grade = "degraded"
+	default:
+		h.Grade = "unhealthy"
+	}
+	return h
+}
+
+// ramp is 0 at or below lo, 1 at or above hi and linear in between.
+func ramp(v, lo, hi float64) float64 {
+	return math.Max(0, math.Min(1, (v-lo)/(hi-lo)))
+}
+
+// FleetSummary handles GET /api/fleet/summary.
+func (c *Controller) FleetSummary(w http.ResponseWriter, r *http.Request) {
+	sum, err := c.BuildFleetSummary(r.Context(), time.Now())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("fleet summary", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to build fleet summary")
+		return
+	}
+	respondJSON(w, http.StatusOK, sum)
+}
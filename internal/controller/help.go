@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// maxHelpBody keeps a help topic to a page or two of markdown.
+const maxHelpBody = 64 << 10
+
+// helpTopic is the guidance shown on a feature's page. Customized is set
+// when an admin replaced the built-in text for their lab.
+type helpTopic struct {
+	Key        string     `json:"key"`
+	Title      string     `json:"title"`
+	Body       string     `json:"body"`
+	Customized bool       `json:"customized"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+	UpdatedBy  string     `json:"updated_by,omitempty"`
+}
+
+type helpTopicRequest struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// builtinHelp is the text each feature starts with. Only these keys can be
+// customized, since each is shown on a page of the dashboard.
+var builtinHelp = []helpTopic{
+	{
+		Key:   "golden-image",
+		Title: "Building a golden image",
+		Body: `Every robot flashed with the golden image comes up with the agent installed and connected, so there is no per-robot install step.
+
+1. Pick the **image profile** for the kind of robot, e.g. TB3-Humble, or create one. Fill in the **WiFi** network the robots join and the **MQTT broker** address they can reach the controller on.
+2. Add **backup networks** if robots move between buildings. The main network is always preferred.
+3. Click **Build** to produce the image. A build started while another runs is queued behind it, and past builds and their images are listed under **Build History**. Or click **Download user-data** for just the ` + "`user-data`" + ` cloud-init file.
+4. Flash the image onto each robot's SD card and power it on.
+
+Robots appear on the **Robots** page once they connect. If one doesn't, check that it can reach the broker from its network.`,
+	},
+	{
+		Key:   "enrollment",
+		Title: "Enrolling robots and laptops",
+		Body: `Robots flashed with the golden image enroll themselves. Add their MAC addresses or serial numbers to the **Enrollment Pool** on the Golden Image page beforehand and they come up under the names you give them. For laptops, and robots installed by hand, the controller installs the agent over SSH.
+
+1. Use **Scan Network** to find hosts on the subnets in ` + "`SCAN_SUBNETS`" + `, or enter the address yourself.
+2. Give the SSH user and a key or password. Enable sudo if the account needs a password for it.
+3. Pick the robot's name, then **Install**.
+
+The agent connects to the MQTT broker and the device appears in the dashboard. Hosts without network access can be provisioned over USB or by running the install command by hand.`,
+	},
+	{
+		Key:   "scenarios",
+		Title: "Deploying code with scenarios",
+		Body: `A scenario is a YAML file declaring the git repo each robot should have, and optionally how to build and launch it.
+
+` + "```yaml" + `
+repo:
+  url: https://github.com/your-org/your-repo.git
+  branch: main
+` + "```" + `
+
+**Apply** a scenario to robots to clone or update the repo on them. Add repo credentials to a scenario for private repos. They are stored encrypted and only sent to the robots it is applied to.`,
+	},
+}
+
+func findBuiltinHelp(key string) (helpTopic, bool) {
+	for _, t := range builtinHelp {
+		if t.Key == key {
+			return t, true
+		}
+	}
+	return helpTopic{}, false
+}
+
+// withCustom returns t with an admin's version in place of the built-in text.
+func (t helpTopic) withCustom(custom *db.HelpTopic) helpTopic {
+	if custom == nil {
+		return t
+	}
+	t.Title = custom.Title
+	t.Body = custom.Body
+	t.Customized = true
+	updated := custom.UpdatedAt
+	t.UpdatedAt = &updated
+	t.UpdatedBy = custom.UpdatedBy
+	return t
+}
+
+// ListHelpTopics returns every feature's help, customized or built in.
+func (c *Controller) ListHelpTopics(w http.ResponseWriter, r *http.Request) {
+	custom, err := c.DB.ListHelpTopics(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list help topics", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load help")
+		return
+	}
+	byKey := make(map[string]*db.HelpTopic, len(custom))
+	for i := range custom {
+		byKey[custom[i].Key] = &custom[i]
+	}
+	topics := make([]helpTopic, 0, len(builtinHelp))
+	for _, t := range builtinHelp {
+		topics = append(topics, t.withCustom(byKey[t.Key]))
+	}
+	respondJSON(w, http.StatusOK, topics)
+}
+
+// GetHelpTopic returns the help for one feature.
+func (c *Controller) GetHelpTopic(w http.ResponseWriter, r *http.Request) {
+	t, ok := helpTopicFromPath(w, r)
+	if !ok {
+		return
+	}
+	custom, err := c.DB.GetHelpTopic(r.Context(), t.Key)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("get help topic", "key", t.Key, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load help")
+		return
+	}
+	respondJSON(w, http.StatusOK, t.withCustom(custom))
+}
+
+// UpdateHelpTopic replaces a feature's help with the lab's own. An empty
+// title keeps the built-in one.
+func (c *Controller) UpdateHelpTopic(w http.ResponseWriter, r *http.Request) {
+	t, ok := helpTopicFromPath(w, r)
+	if !ok {
+		return
+	}
+	var req helpTopicRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxHelpBody+4096)).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid help payload")
+		return
+	}
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" {
+		req.Title = t.Title
+	}
+	if strings.TrimSpace(req.Body) == "" {
+		respondError(w, http.StatusBadRequest, "body is required; delete the topic to restore the built-in help")
+		return
+	}
+	if len(req.Body) > maxHelpBody {
+		respondError(w, http.StatusBadRequest, "body is too long")
+		return
+	}
+	actor, _ := Actor(r.Context())
+	custom := db.HelpTopic{Key: t.Key, Title: req.Title, Body: req.Body, UpdatedAt: time.Now().UTC(), UpdatedBy: actor}
+	if err := c.DB.SaveHelpTopic(r.Context(), custom); err != nil {
+		logging.FromContext(r.Context()).Error("save help topic", "key", t.Key, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to save help")
+		return
+	}
+	c.audit(r.Context(), "help.update", t.Key, "")
+	respondJSON(w, http.StatusOK, t.withCustom(&custom))
+}
+
+// ResetHelpTopic restores a feature's built-in help.
+func (c *Controller) ResetHelpTopic(w http.ResponseWriter, r *http.Request) {
+	t, ok := helpTopicFromPath(w, r)
+	if !ok {
+		return
+	}
+	if err := c.DB.DeleteHelpTopic(r.Context(), t.Key); err != nil {
+		logging.FromContext(r.Context()).Error("delete help topic", "key", t.Key, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to reset help")
+		return
+	}
+	c.audit(r.Context(), "help.reset", t.Key, "")
+	respondJSON(w, http.StatusOK, t)
+}
+
+func helpTopicFromPath(w http.ResponseWriter, r *http.Request) (helpTopic, bool) {
+	key := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/help/"), "/")
+	t, ok := findBuiltinHelp(key)
+	if !ok {
+		respondError(w, http.StatusNotFound, "unknown help topic")
+	}
+	return t, ok
+}
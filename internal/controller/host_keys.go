@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"example.com/openrobot-fleet/internal/logging"
+	sshc "example.com/openrobot-fleet/internal/ssh"
+)
+
+// The controller logs in to robots over SSH to install the agent, probe
+// robots that went offline and open terminals. The key a robot presents the
+// first time is recorded, and later logins require it, so that something
+// else answering at a robot's address doesn't get its credentials. A
+// reflashed robot has a new key; resetting the recorded one lets the next
+// login record that.
+
+type hostKeyResponse struct {
+	RobotID     int64     `json:"robot_id"`
+	Key         string    `json:"key"`
+	Fingerprint string    `json:"fingerprint"`
+	FirstSeen   time.Time `json:"first_seen"`
+}
+
+// pinRobotHostKey has logins with h require the host key recorded for the
+// robot, or record the key it presents if there is none yet.
+func (c *Controller) pinRobotHostKey(ctx context.Context, robotID int64, h *sshc.HostSpec) {
+	k, err := c.DB.GetRobotHostKey(ctx, robotID)
+	switch {
+	case err == nil:
+		h.HostKey = []byte(k.Key)
+	case errors.Is(err, sql.ErrNoRows):
+		h.OnHostKey = func(key []byte) error {
+			return c.recordHostKey(context.Background(), robotID, key)
+		}
+	default:
+		h.OnHostKey = func([]byte) error {
+			return fmt.Errorf("load host key: %w", err)
+		}
+	}
+}
+
+// recordHostKey records key for the robot unless another login recorded
+// one first, in which case key must match it.
+func (c *Controller) recordHostKey(ctx context.Context, robotID int64, key []byte) error {
+	presented := strings.TrimSpace(string(key))
+	stored, err := c.DB.RecordRobotHostKey(ctx, robotID, presented)
+	if err != nil {
+		return fmt.Errorf("record host key: %w", err)
+	}
+	if stored.Key != presented {
+		return fmt.Errorf("%w: presented %s, recorded %s", sshc.ErrHostKeyMismatch, sshc.HostKeyFingerprint(key), sshc.HostKeyFingerprint([]byte(stored.Key)))
+	}
+	slog.Info("recorded ssh host key", "robot_id", robotID, "fingerprint", sshc.HostKeyFingerprint(key))
+	return nil
+}
+
+// hostKeyChangedMessage explains a login refused for a changed host key.
+func hostKeyChangedMessage(err error) string {
+	return fmt.Sprintf("%v; if the robot was reflashed, reset its host key and try again", err)
+}
+
+// GetRobotHostKey returns the SSH host key recorded for robot {id}.
+func (c *Controller) GetRobotHostKey(w http.ResponseWriter, r *http.Request) {
+	id, err := parseRobotID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid robot id")
+		return
+	}
+	k, err := c.DB.GetRobotHostKey(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "no host key recorded; the next SSH login records one")
+			return
+		}
+		logging.FromContext(r.Context()).Error("get host key", "robot_id", id, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load host key")
+		return
+	}
+	respondJSON(w, http.StatusOK, hostKeyResponse{
+		RobotID:     k.RobotID,
+		Key:         k.Key,
+		Fingerprint: sshc.HostKeyFingerprint([]byte(k.Key)),
+		FirstSeen:   k.FirstSeen,
+	})
+}
+
+// ResetRobotHostKey forgets the host key recorded for robot {id}, e.g.
+// after it was reflashed. The next SSH login records the key it presents.
+func (c *Controller) ResetRobotHostKey(w http.ResponseWriter, r *http.Request) {
+	id, err := parseRobotID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid robot id")
+		return
+	}
+	robot, err := c.DB.GetRobotByID(r.Context(), id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "robot not found")
+		return
+	}
+	k, _ := c.DB.GetRobotHostKey(r.Context(), id)
+	found, err := c.DB.DeleteRobotHostKey(r.Context(), id)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("reset host key", "robot_id", id, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to reset host key")
+		return
+	}
+	if !found {
+		respondError(w, http.StatusNotFound, "no host key recorded")
+		return
+	}
+	c.audit(r.Context(), "robot.host_key_reset", robot.Name, sshc.HostKeyFingerprint([]byte(k.Key)))
+	w.WriteHeader(http.StatusNoContent)
+}
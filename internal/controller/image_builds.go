@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+const (
+	defaultImageBuildLimit = 20
+	maxImageBuildLimit     = 200
+	// defaultKeepImages is how many images per profile pruneProfileImages
+	// keeps unless BUILD_KEEP_IMAGES or the profile says otherwise.
+	defaultKeepImages = 3
+	maxKeepImages     = 100
+)
+
+// imageBuild is a build in the history. DownloadURL, and ChecksumURL and
+// SignatureURL if the image has them, are set while the image it wrote is
+// still on disk.
+type imageBuild struct {
+	db.ImageBuild
+	// DurationSec is from start to finish, or so far for a running build.
+	DurationSec  int    `json:"duration_sec"`
+	DownloadURL  string `json:"download_url,omitempty"`
+	ChecksumURL  string `json:"checksum_url,omitempty"`
+	SignatureURL string `json:"signature_url,omitempty"`
+}
+
+func toImageBuild(b db.ImageBuild) imageBuild {
+	out := imageBuild{ImageBuild: b}
+	if b.StartedAt != nil {
+		end := time.Now()
+		if b.FinishedAt != nil {
+			end = *b.FinishedAt
+		}
+		out.DurationSec = int(end.Sub(*b.StartedAt).Seconds())
+	}
+	if b.Status == db.ImageBuildSuccess && b.ImageName != "" {
+		if _, err := os.Stat(filepath.Join(buildImagesDir(), filepath.Base(b.ImageName))); err == nil {
+			out.DownloadURL = fmt.Sprintf("/api/golden-image/builds/%d/artifact", b.ID)
+			if hasSidecar(b.ImageName, checksumSuffix) {
+				out.ChecksumURL = out.DownloadURL + "/checksum"
+			}
+			if hasSidecar(b.ImageName, signatureSuffix) {
+				out.SignatureURL = out.DownloadURL + "/signature"
+			}
+		}
+	}
+	return out
+}
+
+// ListImageBuilds returns recent golden image builds, newest first, queued
+// ones included. ?profile_id= limits them to one profile and ?limit= caps
+// how many (default 20).
+func (c *Controller) ListImageBuilds(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var profileID int64
+	if v := q.Get("profile_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid profile_id")
+			return
+		}
+		profileID = id
+	}
+	limit := defaultImageBuildLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxImageBuildLimit {
+			respondError(w, http.StatusBadRequest, "limit must be between 1 and 200")
+			return
+		}
+		limit = n
+	}
+	builds, err := c.DB.ListImageBuilds(r.Context(), profileID, limit)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list image builds", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load image builds")
+		return
+	}
+	out := make([]imageBuild, 0, len(builds))
+	for _, b := range builds {
+		out = append(out, toImageBuild(b))
+	}
+	respondJSON(w, http.StatusOK, out)
+}
+
+// GetImageBuild returns one build with its log; a running build's log is
+// the one so far.
+func (c *Controller) GetImageBuild(w http.ResponseWriter, r *http.Request) {
+	b, ok := c.imageBuildFromPath(w, r)
+	if !ok {
+		return
+	}
+	if run := c.builds.get(b.ID); run != nil {
+		run.mu.Lock()
+		b.Log = strings.Join(run.logs, "\n")
+		run.mu.Unlock()
+	}
+	respondJSON(w, http.StatusOK, toImageBuild(b))
+}
+
+// DownloadImageBuildArtifact returns the image a successful build wrote,
+// unless it has since been pruned. .../artifact/checksum and
+// .../artifact/signature return its checksum and signature files instead.
+func (c *Controller) DownloadImageBuildArtifact(w http.ResponseWriter, r *http.Request) {
+	b, ok := c.imageBuildFromPath(w, r)
+	if !ok {
+		return
+	}
+	path := filepath.Join(buildImagesDir(), filepath.Base(b.ImageName))
+	if _, err := os.Stat(path); b.Status != db.ImageBuildSuccess || b.ImageName == "" || err != nil {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("build %d has no image to download", b.ID))
+		return
+	}
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/checksum"):
+		serveImageSidecar(w, r, b.ImageName, checksumSuffix)
+	case strings.HasSuffix(r.URL.Path, "/signature"):
+		serveImageSidecar(w, r, b.ImageName, signatureSuffix)
+	default:
+		serveImage(w, r, b.ImageName)
+	}
+}
+
+// CancelImageBuild takes a queued build off the queue, or stops a running
+// one as CancelBuild does.
+func (c *Controller) CancelImageBuild(w http.ResponseWriter, r *http.Request) {
+	b, ok := c.imageBuildFromPath(w, r)
+	if !ok {
+		return
+	}
+	if b.Status == db.ImageBuildQueued {
+		if err := c.DB.CancelQueuedImageBuild(r.Context(), b.ID); err == nil {
+			c.audit(r.Context(), "image.build_cancel", b.ProfileName, fmt.Sprintf("build %d (queued)", b.ID))
+			respondJSON(w, http.StatusOK, map[string]string{"status": db.ImageBuildCancelled})
+			return
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			logging.FromContext(r.Context()).Error("cancel queued image build", "err", err)
+			respondError(w, http.StatusInternalServerError, "failed to cancel build")
+			return
+		}
+		// It started in the meantime.
+	}
+	if c.builds.get(b.ID) == nil {
+		respondError(w, http.StatusConflict, fmt.Sprintf("build %d is not queued or running", b.ID))
+		return
+	}
+	q := r.URL.Query()
+	q.Set("build_id", strconv.FormatInt(b.ID, 10))
+	r.URL.RawQuery = q.Encode()
+	c.CancelBuild(w, r)
+}
+
+// imageBuildFromPath loads the build named by
+// /api/golden-image/builds/{id}[/...].
+func (c *Controller) imageBuildFromPath(w http.ResponseWriter, r *http.Request) (db.ImageBuild, bool) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/golden-image/builds/"), "/")
+	idStr, _, _ := strings.Cut(rest, "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid build id")
+		return db.ImageBuild{}, false
+	}
+	b, err := c.DB.GetImageBuild(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "image build not found")
+			return db.ImageBuild{}, false
+		}
+		logging.FromContext(r.Context()).Error("get image build", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load image build")
+		return db.ImageBuild{}, false
+	}
+	return b, true
+}
+
+// keepImages is how many images profile keeps: its own keep_images, else
+// BUILD_KEEP_IMAGES, else 3.
+func keepImages(profile db.ImageProfile) int {
+	if profile.Config.KeepImages > 0 {
+		return profile.Config.KeepImages
+	}
+	if v, err := strconv.Atoi(os.Getenv("BUILD_KEEP_IMAGES")); err == nil && v >= 1 {
+		return v
+	}
+	return defaultKeepImages
+}
+
+// pruneProfileImages deletes all but the newest keepImages images built from
+// a profile and returns those it deleted with how many bytes they held.
+// Their builds stay in the history.
+func (c *Controller) pruneProfileImages(ctx context.Context, profile db.ImageProfile) ([]string, int64, error) {
+	images, err := c.DB.ProfileArtifacts(ctx, profile.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+	keep := keepImages(profile)
+	if len(images) <= keep {
+		return nil, 0, nil
+	}
+	var removed []string
+	var freed int64
+	for _, image := range images[keep:] {
+		info, statErr := os.Stat(filepath.Join(buildImagesDir(), filepath.Base(image)))
+		if err := removeImage(image); err == nil {
+			removed = append(removed, image)
+			if statErr == nil {
+				freed += info.Size()
+			}
+		} else if !os.IsNotExist(err) {
+			slog.Warn("remove old golden image", "image", image, "err", err)
+		}
+	}
+	return removed, freed, nil
+}
+
+// fileChecksum returns the size and SHA-256 of the file at path.
+func fileChecksum(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
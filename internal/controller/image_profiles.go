@@ -0,0 +1,356 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// imageProfile is a named golden image configuration, e.g. TB3-Humble,
+// TB4-Jazzy or a lab's laptops. Each is built and downloaded on its own.
+type imageProfile struct {
+	ID          int64                `json:"id"`
+	Name        string               `json:"name"`
+	Description string               `json:"description,omitempty"`
+	Config      db.GoldenImageConfig `json:"config"`
+	// ImageName is the image the profile's last successful build wrote, if
+	// it is still there to download.
+	ImageName string     `json:"image_name,omitempty"`
+	ImageSize int64      `json:"image_size,omitempty"`
+	BuiltAt   *time.Time `json:"built_at,omitempty"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+type imageProfileRequest struct {
+	Name        string               `json:"name"`
+	Description string               `json:"description,omitempty"`
+	Config      db.GoldenImageConfig `json:"config"`
+}
+
+// applyTo validates req and copies it into p.
+func (req imageProfileRequest) applyTo(p *db.ImageProfile) error {
+	p.Name = strings.TrimSpace(req.Name)
+	p.Description = strings.TrimSpace(req.Description)
+	p.Config = req.Config
+	if p.Name == "" {
+		return errors.New("profile name required")
+	}
+	if profileSlug(p.Name) == "" {
+		return errors.New("profile name must contain a letter or digit")
+	}
+	switch p.Config.RobotModel {
+	case "", "TB3", "TB4":
+	case laptopModel:
+		if strings.TrimSpace(p.Config.ControllerURL) == "" {
+			return errors.New("laptop profiles need a controller URL to download the agent from")
+		}
+	default:
+		return fmt.Errorf("unknown robot model %q", p.Config.RobotModel)
+	}
+	switch p.Config.ROSVersion {
+	case "", "Humble", "Jazzy":
+	default:
+		return fmt.Errorf("unknown ROS version %q", p.Config.ROSVersion)
+	}
+	if nets := goldenWifiNetworks(&p.Config); len(nets) > 0 {
+		if err := agent.ValidateWifiNetworks(nets); err != nil {
+			return err
+		}
+	}
+	for _, pkg := range p.Config.AptPackages {
+		if !aptPackage.MatchString(pkg) {
+			return fmt.Errorf("invalid apt package %q", pkg)
+		}
+	}
+	for _, pkg := range p.Config.PipPackages {
+		if !pipPackage.MatchString(pkg) {
+			return fmt.Errorf("invalid pip package %q", pkg)
+		}
+	}
+	if _, err := cloudInitWriteFiles(p.Config.WriteFiles); err != nil {
+		return err
+	}
+	if _, err := cloudInitRunCmd(p.Config.RunCmd); err != nil {
+		return err
+	}
+	if p.Config.KeepImages < 0 || p.Config.KeepImages > maxKeepImages {
+		return fmt.Errorf("keep_images must be between 1 and %d, or 0 for the default", maxKeepImages)
+	}
+	return nil
+}
+
+var (
+	// aptPackage is a package name, optionally pinned: ros-humble-foo=1.2-1.
+	aptPackage = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]*(=[A-Za-z0-9.+:~-]+)?$`)
+	// pipPackage is a requirement without URLs or options, e.g.
+	// pyserial, numpy==1.26.4 or opencv-python>=4.8.
+	pipPackage = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*(\[[A-Za-z0-9._,-]+\])?((==|!=|<=|>=|~=|<|>)[A-Za-z0-9.*+!_-]+)?$`)
+)
+
+// profileImageName is the file a build of a profile writes, e.g.
+// tb3-humble-golden-12.img for build 12 of TB3-Humble.
+func profileImageName(name string, buildID int64) string {
+	return fmt.Sprintf("%s-golden-%d.img", profileSlug(name), buildID)
+}
+
+// profileSlug lowercases name and joins its runs of letters and digits with
+// dashes.
+func profileSlug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+func (c *Controller) toImageProfile(r *http.Request, p db.ImageProfile) imageProfile {
+	out := imageProfile{
+		ID:          p.ID,
+		Name:        p.Name,
+		Description: p.Description,
+		Config:      p.Config,
+		CreatedBy:   p.CreatedBy,
+		CreatedAt:   p.CreatedAt,
+		UpdatedAt:   p.UpdatedAt,
+	}
+	image, builtAt, err := c.DB.LastProfileImage(r.Context(), p.ID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			logging.FromContext(r.Context()).Error("last profile image", "profile", p.Name, "err", err)
+		}
+		return out
+	}
+	if fi, err := os.Stat(filepath.Join(buildImagesDir(), filepath.Base(image))); err == nil {
+		out.ImageName = image
+		out.ImageSize = fi.Size()
+		out.BuiltAt = &builtAt
+	}
+	return out
+}
+
+// ListImageProfiles returns every image profile with its latest image.
+func (c *Controller) ListImageProfiles(w http.ResponseWriter, r *http.Request) {
+	profiles, err := c.DB.ListImageProfiles(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list image profiles", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load image profiles")
+		return
+	}
+	out := make([]imageProfile, 0, len(profiles))
+	for _, p := range profiles {
+		out = append(out, c.toImageProfile(r, p))
+	}
+	respondJSON(w, http.StatusOK, out)
+}
+
+// CreateImageProfile saves a new profile.
+func (c *Controller) CreateImageProfile(w http.ResponseWriter, r *http.Request) {
+	var req imageProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid image profile payload")
+		return
+	}
+	var p db.ImageProfile
+	if err := req.applyTo(&p); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !c.imageProfileNameFree(w, r, p) {
+		return
+	}
+	p.CreatedBy, _ = Actor(r.Context())
+	id, err := c.DB.CreateImageProfile(r.Context(), p)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("create image profile", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to save image profile")
+		return
+	}
+	c.audit(r.Context(), "image_profile.create", p.Name, "")
+	c.respondImageProfile(w, r, id, http.StatusCreated)
+}
+
+// GetImageProfile returns one profile.
+func (c *Controller) GetImageProfile(w http.ResponseWriter, r *http.Request) {
+	p, ok := c.imageProfileFromPath(w, r)
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, c.toImageProfile(r, p))
+}
+
+// UpdateImageProfile replaces a profile's settings. Images already built
+// from it keep the settings they were built with until it is rebuilt.
+func (c *Controller) UpdateImageProfile(w http.ResponseWriter, r *http.Request) {
+	p, ok := c.imageProfileFromPath(w, r)
+	if !ok {
+		return
+	}
+	var req imageProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid image profile payload")
+		return
+	}
+	if err := req.applyTo(&p); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !c.imageProfileNameFree(w, r, p) {
+		return
+	}
+	if err := c.DB.UpdateImageProfile(r.Context(), p); err != nil {
+		logging.FromContext(r.Context()).Error("update image profile", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to save image profile")
+		return
+	}
+	c.audit(r.Context(), "image_profile.update", p.Name, "")
+	c.respondImageProfile(w, r, p.ID, http.StatusOK)
+}
+
+// DeleteImageProfile removes a profile and the images built from it. A
+// profile can't be deleted while it is being built; its queued builds fail
+// when their turn comes.
+func (c *Controller) DeleteImageProfile(w http.ResponseWriter, r *http.Request) {
+	p, ok := c.imageProfileFromPath(w, r)
+	if !ok {
+		return
+	}
+	if c.builds.building(p.ID) {
+		respondError(w, http.StatusConflict, "profile is being built")
+		return
+	}
+	images, err := c.DB.ProfileArtifacts(r.Context(), p.ID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list profile images", "err", err)
+	}
+	if err := c.DB.DeleteImageProfile(r.Context(), p.ID); err != nil {
+		logging.FromContext(r.Context()).Error("delete image profile", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to delete image profile")
+		return
+	}
+	for _, image := range images {
+		removeImage(image)
+	}
+	c.audit(r.Context(), "image_profile.delete", p.Name, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DownloadProfileUserData returns the cloud-init user-data a profile's image
+// is built with, for flashing a stock image by hand. For a laptop profile it
+// is the autoinstall file to install Ubuntu with.
+func (c *Controller) DownloadProfileUserData(w http.ResponseWriter, r *http.Request) {
+	p, ok := c.imageProfileFromPath(w, r)
+	if !ok {
+		return
+	}
+	render := c.renderUserData
+	if p.Config.RobotModel == laptopModel {
+		render = c.renderAutoinstall
+	}
+	data, err := render(r.Context(), &p.Config)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("render user-data", "profile", p.Name, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to render user-data")
+		return
+	}
+	w.Header().Set("Content-Type", "text/yaml")
+	w.Header().Set("Content-Disposition", "attachment; filename=user-data")
+	w.Write(data)
+}
+
+// DownloadProfileImage returns the image the profile's last successful
+// build wrote.
+func (c *Controller) DownloadProfileImage(w http.ResponseWriter, r *http.Request) {
+	p, ok := c.imageProfileFromPath(w, r)
+	if !ok {
+		return
+	}
+	image, _, err := c.DB.LastProfileImage(r.Context(), p.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		logging.FromContext(r.Context()).Error("last profile image", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load image")
+		return
+	}
+	path := filepath.Join(buildImagesDir(), filepath.Base(image))
+	if _, statErr := os.Stat(path); err != nil || statErr != nil {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("profile %q has not been built", p.Name))
+		return
+	}
+	serveImage(w, r, image)
+}
+
+func (c *Controller) respondImageProfile(w http.ResponseWriter, r *http.Request, id int64, status int) {
+	p, err := c.DB.GetImageProfile(r.Context(), id)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("get image profile", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load image profile")
+		return
+	}
+	respondJSON(w, status, c.toImageProfile(r, p))
+}
+
+// imageProfileNameFree responds 409 if another profile already has p's
+// name.
+func (c *Controller) imageProfileNameFree(w http.ResponseWriter, r *http.Request, p db.ImageProfile) bool {
+	profiles, err := c.DB.ListImageProfiles(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list image profiles", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load image profiles")
+		return false
+	}
+	for _, other := range profiles {
+		if other.ID == p.ID {
+			continue
+		}
+		if other.Name == p.Name {
+			respondError(w, http.StatusConflict, fmt.Sprintf("profile %q already exists", p.Name))
+			return false
+		}
+	}
+	return true
+}
+
+// imageProfileFromPath loads the profile named by
+// /api/image-profiles/{id}[/...].
+func (c *Controller) imageProfileFromPath(w http.ResponseWriter, r *http.Request) (db.ImageProfile, bool) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/image-profiles/"), "/")
+	idStr, _, _ := strings.Cut(rest, "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid profile id")
+		return db.ImageProfile{}, false
+	}
+	p, err := c.DB.GetImageProfile(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "image profile not found")
+			return db.ImageProfile{}, false
+		}
+		logging.FromContext(r.Context()).Error("get image profile", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load image profile")
+		return db.ImageProfile{}, false
+	}
+	return p, true
+}
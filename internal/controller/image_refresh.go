@@ -0,0 +1,258 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// Shipping an agent fix shouldn't take a full build. A refresh starts from
+// the image an earlier build of the profile wrote and only replaces the
+// agent binary and user-data in it, so it takes minutes rather than the
+// half hour the ROS install does. It is queued, numbered, logged and kept
+// like any other build, and its image replaces the one it started from as
+// the profile's newest.
+
+// RefreshImageBuild queues a refresh of the image build {id} wrote with the
+// current agent binary and the profile's current user-data.
+func (c *Controller) RefreshImageBuild(w http.ResponseWriter, r *http.Request) {
+	if os.Getenv("DEMO_MODE") == "true" {
+		respondError(w, http.StatusForbidden, "Build feature is disabled in demo mode")
+		return
+	}
+	b, ok := c.imageBuildFromPath(w, r)
+	if !ok {
+		return
+	}
+	if b.Status != db.ImageBuildSuccess || b.ImageName == "" {
+		respondError(w, http.StatusConflict, fmt.Sprintf("build %d didn't write an image to refresh", b.ID))
+		return
+	}
+	if _, err := os.Stat(filepath.Join(buildImagesDir(), filepath.Base(b.ImageName))); err != nil {
+		respondError(w, http.StatusConflict, fmt.Sprintf("image of build %d was deleted; run a full build", b.ID))
+		return
+	}
+	if os.Getenv("BUILD_SSH_HOST") != "" {
+		respondError(w, http.StatusConflict, "refreshes mount the image on the controller, which BUILD_SSH_HOST says it can't; run a full build")
+		return
+	}
+	profile, err := c.DB.GetImageProfile(r.Context(), b.ProfileID)
+	if err != nil {
+		respondError(w, http.StatusConflict, fmt.Sprintf("profile of build %d was deleted", b.ID))
+		return
+	}
+	if msg := c.usageLimitReached(r.Context(), "builds"); msg != "" {
+		respondError(w, http.StatusForbidden, msg)
+		return
+	}
+	actor, _ := Actor(r.Context())
+	buildID, err := c.DB.QueueImageBuild(r.Context(), db.ImageBuild{
+		ProfileID:   profile.ID,
+		ProfileName: profile.Name,
+		RefreshOf:   b.ID,
+		RequestedBy: actor,
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("queue image refresh", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to queue refresh")
+		return
+	}
+	c.audit(r.Context(), "image.refresh", profile.Name, fmt.Sprintf("build %d from build %d", buildID, b.ID))
+	c.startNextBuild()
+
+	resp := buildQueuedResponse{Status: "started", BuildID: buildID}
+	if c.builds.get(buildID) == nil {
+		resp.Status = "queued"
+		if n, err := c.DB.QueuedImageBuilds(r.Context()); err == nil {
+			resp.Position = n
+		}
+	}
+	respondJSON(w, http.StatusAccepted, resp)
+}
+
+// runRefresh writes profile's image anew from the one build sourceID wrote,
+// with the current agent binary and user-data. Cancelling parent stops it.
+func (c *Controller) runRefresh(parent context.Context, run *buildRun, profile db.ImageProfile, sourceID int64) {
+	defer func() {
+		c.builds.done(run)
+		go c.startNextBuild()
+	}()
+	started := time.Now()
+	var workImage string
+	var imageSize int64
+	var checksum string
+	defer func() { c.recordBuild(run, profile, started, imageSize, checksum) }()
+	refreshed := false
+	defer func() {
+		if r := recover(); r != nil {
+			run.fail(fmt.Sprintf("panic: %v", r))
+		}
+		if !refreshed && workImage != "" {
+			run.logf("cleaning up failed work image: %s", workImage)
+			os.Remove(workImage)
+			removeImage(filepath.Base(workImage) + ".xz")
+		}
+	}()
+
+	ctx := context.Background()
+	cfg := &profile.Config
+	limits := buildLimitsFromEnv()
+	buildCtx, cancelBuild := context.WithCancelCause(parent)
+	defer cancelBuild(nil)
+	stopped := func() bool {
+		if buildCtx.Err() == nil {
+			return false
+		}
+		run.abort(buildCtx, "refresh aborted")
+		return true
+	}
+
+	run.progressTo("Loading source image...", 5)
+	source, err := c.DB.GetImageBuild(ctx, sourceID)
+	if err != nil {
+		run.fail(fmt.Sprintf("load build %d: %v", sourceID, err))
+		return
+	}
+	imagesDir := buildImagesDir()
+	sourceXZ := filepath.Join(imagesDir, filepath.Base(source.ImageName))
+	if _, err := os.Stat(sourceXZ); err != nil {
+		run.fail(fmt.Sprintf("image of build %d is gone: %v", sourceID, err))
+		return
+	}
+	run.logf("refreshing %s (build %d) for profile %s", filepath.Base(sourceXZ), sourceID, profile.Name)
+	go limits.watchDisk(buildCtx, cancelBuild, imagesDir)
+
+	run.progressTo("Checking disk space and memory...", 10)
+	if err := limits.preflight(sourceXZ, imagesDir); err != nil {
+		run.fail(fmt.Sprintf("preflight failed: %v", err))
+		return
+	}
+
+	run.progressTo("Decompressing image...", 15)
+	imageName := profileImageName(profile.Name, run.id)
+	workImage = filepath.Join(imagesDir, imageName)
+	if err := c.DB.SetImageBuildImage(ctx, run.id, imageName); err != nil {
+		slog.Error("record image build", "err", err)
+	}
+	out, err := os.Create(workImage)
+	if err != nil {
+		run.fail(fmt.Sprintf("create work image failed: %v", err))
+		return
+	}
+	cmd := limits.command(buildCtx, "xz", "-d", "-c", sourceXZ)
+	cmd.Stdout = out
+	if err := cmd.Run(); err != nil {
+		out.Close()
+		run.abort(buildCtx, fmt.Sprintf("decompress failed: %v", err))
+		return
+	}
+	out.Close()
+
+	if stopped() {
+		return
+	}
+	run.progressTo("Mounting image...", 40)
+	if err := ensureLoopDevices(); err != nil {
+		run.logf("warning: failed to ensure loop devices: %v", err)
+	}
+	dev, err := exec.Command("losetup", "-fP", "--show", workImage).CombinedOutput()
+	if err != nil {
+		run.fail(fmt.Sprintf("losetup failed: %v: %s", err, string(dev)))
+		return
+	}
+	loopDev := strings.TrimSpace(string(dev))
+	detached := false
+	defer func() {
+		if !detached {
+			exec.Command("losetup", "-d", loopDev).Run()
+		}
+	}()
+	for _, p := range []string{"p1", "p2"} {
+		if err := ensureDeviceNode(loopDev + p); err != nil {
+			run.logf("warning: ensureDeviceNode %s: %v", p, err)
+		}
+	}
+	mntDir := run.mountDir
+	os.MkdirAll(mntDir, 0755)
+	defer os.Remove(mntDir)
+	if out, err := exec.Command("mount", loopDev+"p2", mntDir).CombinedOutput(); err != nil {
+		run.fail(fmt.Sprintf("mount root failed: %v: %s", err, string(out)))
+		return
+	}
+	mounted := true
+	defer func() {
+		if mounted {
+			unmountBuild(mntDir)
+		}
+	}()
+	if out, err := exec.Command("mount", loopDev+"p1", filepath.Join(mntDir, "boot/firmware")).CombinedOutput(); err != nil {
+		run.fail(fmt.Sprintf("mount boot failed: %v: %s", err, string(out)))
+		return
+	}
+
+	if stopped() {
+		return
+	}
+	run.progressTo("Replacing agent binary...", 55)
+	agentPath := filepath.Join(mntDir, "usr/local/bin/openrobotfleet-agent")
+	if out, err := exec.Command("cp", goldenAgentBinary(), agentPath).CombinedOutput(); err != nil {
+		run.fail(fmt.Sprintf("copy agent binary failed: %v: %s", err, string(out)))
+		return
+	}
+	if err := os.Chmod(agentPath, 0755); err != nil {
+		run.fail(fmt.Sprintf("chmod agent binary failed: %v", err))
+		return
+	}
+
+	run.progressTo("Injecting configuration...", 65)
+	userData, err := c.renderUserData(ctx, cfg)
+	if err != nil {
+		run.fail(err.Error())
+		return
+	}
+	if err := os.WriteFile(filepath.Join(mntDir, "boot/firmware/user-data"), userData, 0644); err != nil {
+		run.fail(fmt.Sprintf("create user-data failed: %v", err))
+		return
+	}
+
+	run.progressTo("Unmounting image...", 70)
+	if err := unmountBuild(mntDir); err != nil {
+		run.fail(fmt.Sprintf("unmount failed: %v", err))
+		return
+	}
+	mounted = false
+	if out, err := exec.Command("losetup", "-d", loopDev).CombinedOutput(); err != nil {
+		run.fail(fmt.Sprintf("detach loop device failed: %v: %s", err, string(out)))
+		return
+	}
+	detached = true
+	if smokeTestEnabled() {
+		c.smokeTest(buildCtx, run, workImage, cfg)
+	}
+
+	if stopped() {
+		return
+	}
+	run.progressTo("Compressing image...", 94)
+	if out, err := limits.command(buildCtx, "xz", "-T0", "-f", workImage).CombinedOutput(); err != nil {
+		run.abort(buildCtx, fmt.Sprintf("compress failed: %v: %s", err, string(out)))
+		return
+	}
+	run.progressTo("Computing checksum...", 97)
+	if imageSize, checksum, err = c.sealImage(run, imageName+".xz"); err != nil {
+		run.fail(err.Error())
+		return
+	}
+	run.logf("image %s: %d bytes, sha256 %s", imageName+".xz", imageSize, checksum)
+	refreshed = true
+	run.succeed(imageName + ".xz")
+}
@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// A built image is served with two files next to it: image.sha256, a line
+// sha256sum -c understands, and, when IMAGE_SIGNING_KEY_FILE is set,
+// image.sha256.sig, the raw Ed25519 signature of that line. Anyone with the
+// public key from GET /api/golden-image/signing-key can check it with
+//
+//	openssl pkeyutl -verify -pubin -inkey signing.pub -rawin \
+//	    -in image.sha256 -sigfile image.sha256.sig
+const (
+	checksumSuffix  = ".sha256"
+	signatureSuffix = ".sha256.sig"
+)
+
+// imageSigningKey loads the Ed25519 key in IMAGE_SIGNING_KEY_FILE, a PKCS #8
+// PEM file such as openssl genpkey -algorithm ed25519 writes. It returns nil
+// if none is configured.
+func imageSigningKey() (ed25519.PrivateKey, error) {
+	path := os.Getenv("IMAGE_SIGNING_KEY_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read image signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("image signing key %s is not PEM", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse image signing key: %w", err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("image signing key %s is not an Ed25519 key", path)
+	}
+	return priv, nil
+}
+
+// sealImage checksums the image called name in the images directory and
+// writes its .sha256 file, and its signature if there is a signing key. It
+// returns the image's size and SHA-256.
+func (c *Controller) sealImage(run *buildRun, name string) (int64, string, error) {
+	path := filepath.Join(buildImagesDir(), name)
+	size, sum, err := fileChecksum(path)
+	if err != nil {
+		return 0, "", fmt.Errorf("checksum failed: %v", err)
+	}
+	line := []byte(fmt.Sprintf("%s  %s\n", sum, name))
+	if err := os.WriteFile(path+checksumSuffix, line, 0644); err != nil {
+		return 0, "", fmt.Errorf("write checksum failed: %v", err)
+	}
+	key, err := imageSigningKey()
+	if err != nil {
+		return 0, "", err
+	}
+	if key == nil {
+		return size, sum, nil
+	}
+	if err := os.WriteFile(path+signatureSuffix, ed25519.Sign(key, line), 0644); err != nil {
+		return 0, "", fmt.Errorf("write signature failed: %v", err)
+	}
+	run.logf("signed %s", name+checksumSuffix)
+	return size, sum, nil
+}
+
+// removeImage deletes a built image along with its checksum and signature.
+func removeImage(name string) error {
+	path := filepath.Join(buildImagesDir(), filepath.Base(name))
+	os.Remove(path + checksumSuffix)
+	os.Remove(path + signatureSuffix)
+	return os.Remove(path)
+}
+
+// serveImage sends a built image, with its checksum and signature, if it
+// has them, in the X-Checksum-Sha256 and X-Signature-Ed25519 (base64)
+// headers.
+func serveImage(w http.ResponseWriter, r *http.Request, name string) {
+	path := filepath.Join(buildImagesDir(), filepath.Base(name))
+	if line, err := os.ReadFile(path + checksumSuffix); err == nil {
+		if sum, _, ok := strings.Cut(string(line), " "); ok {
+			w.Header().Set("X-Checksum-Sha256", sum)
+		}
+	}
+	if sig, err := os.ReadFile(path + signatureSuffix); err == nil {
+		w.Header().Set("X-Signature-Ed25519", base64.StdEncoding.EncodeToString(sig))
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(name)))
+	http.ServeFile(w, r, path)
+}
+
+// serveImageSidecar sends an image's .sha256 or .sha256.sig file.
+func serveImageSidecar(w http.ResponseWriter, r *http.Request, name, suffix string) {
+	path := filepath.Join(buildImagesDir(), filepath.Base(name)) + suffix
+	if _, err := os.Stat(path); err != nil {
+		what := "checksum"
+		if suffix == signatureSuffix {
+			what = "signature"
+		}
+		respondError(w, http.StatusNotFound, fmt.Sprintf("image %s has no %s", filepath.Base(name), what))
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(path)))
+	if suffix == checksumSuffix {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	http.ServeFile(w, r, path)
+}
+
+// GetImageSigningKey returns the public half of the image signing key as a
+// PEM file, for checking image signatures.
+func (c *Controller) GetImageSigningKey(w http.ResponseWriter, r *http.Request) {
+	key, err := imageSigningKey()
+	if err != nil {
+		logging.FromContext(r.Context()).Error("image signing key", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load image signing key")
+		return
+	}
+	if key == nil {
+		respondError(w, http.StatusNotFound, "images are not signed; set IMAGE_SIGNING_KEY_FILE")
+		return
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("marshal image signing key", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load image signing key")
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Header().Set("Content-Disposition", `attachment; filename="image-signing.pub"`)
+	pem.Encode(w, &pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+// hasSidecar reports whether the image called name has its .sha256 or
+// .sha256.sig file.
+func hasSidecar(name, suffix string) bool {
+	_, err := os.Stat(filepath.Join(buildImagesDir(), filepath.Base(name)) + suffix)
+	return err == nil
+}
@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// imageStorage is the disk used by golden images, the base image cache and
+// camera snapshots, with the images broken down by profile.
+type imageStorage struct {
+	Areas    []StorageUsage   `json:"areas"`
+	Profiles []profileStorage `json:"profiles"`
+	// Untracked are files in the images directory no build in the history
+	// wrote, e.g. images from before there was a history. Prune leaves them.
+	Untracked []string `json:"untracked"`
+}
+
+type profileStorage struct {
+	ProfileID   int64  `json:"profile_id"`
+	ProfileName string `json:"profile_name"`
+	KeepImages  int    `json:"keep_images"`
+	Images      int    `json:"images"`
+	Bytes       int64  `json:"bytes"`
+}
+
+type pruneImagesResponse struct {
+	Removed    []string `json:"removed"`
+	FreedBytes int64    `json:"freed_bytes"`
+}
+
+// GetImageStorage reports how much disk images, the base image cache and
+// snapshots take, and how many images each profile keeps.
+func (c *Controller) GetImageStorage(w http.ResponseWriter, r *http.Request) {
+	profiles, err := c.DB.ListImageProfiles(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("image storage: list profiles", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load image profiles")
+		return
+	}
+	out := imageStorage{Areas: []StorageUsage{}, Profiles: []profileStorage{}, Untracked: []string{}}
+	for _, u := range []StorageUsage{
+		{Label: "golden images", Path: buildImagesDir()},
+		{Label: "base image cache", Path: buildCacheDir()},
+		{Label: "snapshots", Path: filepath.Dir(snapshotPath(0))},
+	} {
+		u.ContentBytes = dirBytes(u.Path)
+		fillDiskUsage(&u)
+		out.Areas = append(out.Areas, u)
+	}
+
+	artifacts, err := c.DB.ImageArtifacts(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("image storage: list images", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load images")
+		return
+	}
+	tracked := make(map[string]bool, len(artifacts))
+	for _, image := range artifacts {
+		tracked[filepath.Base(image)] = true
+	}
+	for _, p := range profiles {
+		images, err := c.DB.ProfileArtifacts(r.Context(), p.ID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("image storage: list profile images", "profile", p.Name, "err", err)
+			respondError(w, http.StatusInternalServerError, "failed to load images")
+			return
+		}
+		ps := profileStorage{ProfileID: p.ID, ProfileName: p.Name, KeepImages: keepImages(p)}
+		for _, image := range images {
+			if info, err := os.Stat(filepath.Join(buildImagesDir(), filepath.Base(image))); err == nil {
+				ps.Images++
+				ps.Bytes += info.Size()
+			}
+		}
+		out.Profiles = append(out.Profiles, ps)
+	}
+	entries, _ := os.ReadDir(buildImagesDir())
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() || strings.HasSuffix(name, checksumSuffix) || strings.HasSuffix(name, signatureSuffix) {
+			continue
+		}
+		if !tracked[name] {
+			out.Untracked = append(out.Untracked, name)
+		}
+	}
+	respondJSON(w, http.StatusOK, out)
+}
+
+// PruneImages applies each profile's retention now, as a build of it would.
+func (c *Controller) PruneImages(w http.ResponseWriter, r *http.Request) {
+	profiles, err := c.DB.ListImageProfiles(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("prune images: list profiles", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load image profiles")
+		return
+	}
+	out := pruneImagesResponse{Removed: []string{}}
+	for _, p := range profiles {
+		removed, freed, err := c.pruneProfileImages(r.Context(), p)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("prune images", "profile", p.Name, "err", err)
+			respondError(w, http.StatusInternalServerError, "failed to prune images")
+			return
+		}
+		out.Removed = append(out.Removed, removed...)
+		out.FreedBytes += freed
+	}
+	c.audit(r.Context(), "image.prune", "", fmt.Sprintf("%d images, %d bytes", len(out.Removed), out.FreedBytes))
+	respondJSON(w, http.StatusOK, out)
+}
+
+// DeleteImageBuildArtifact deletes the image a build wrote, with its
+// checksum and signature. The build stays in the history.
+func (c *Controller) DeleteImageBuildArtifact(w http.ResponseWriter, r *http.Request) {
+	b, ok := c.imageBuildFromPath(w, r)
+	if !ok {
+		return
+	}
+	if b.ImageName == "" {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("build %d has no image", b.ID))
+		return
+	}
+	if err := removeImage(b.ImageName); err != nil {
+		if os.IsNotExist(err) {
+			respondError(w, http.StatusNotFound, fmt.Sprintf("image of build %d was already deleted", b.ID))
+			return
+		}
+		logging.FromContext(r.Context()).Error("delete image", "image", b.ImageName, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to delete image")
+		return
+	}
+	c.audit(r.Context(), "image.delete", b.ProfileName, fmt.Sprintf("build %d: %s", b.ID, b.ImageName))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ClearImageCache deletes the downloaded base images. The next build
+// downloads its base image again. A remote builder's cache is its own.
+func (c *Controller) ClearImageCache(w http.ResponseWriter, r *http.Request) {
+	if len(c.builds.active()) > 0 {
+		respondError(w, http.StatusConflict, "a build is running; clear the cache once it finishes")
+		return
+	}
+	dir := buildCacheDir()
+	freed := dirBytes(dir)
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		logging.FromContext(r.Context()).Error("clear image cache", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to read image cache")
+		return
+	}
+	out := pruneImagesResponse{Removed: []string{}, FreedBytes: int64(freed)}
+	for _, e := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			logging.FromContext(r.Context()).Error("clear image cache", "file", e.Name(), "err", err)
+			respondError(w, http.StatusInternalServerError, "failed to clear image cache")
+			return
+		}
+		out.Removed = append(out.Removed, e.Name())
+	}
+	c.audit(r.Context(), "image.cache_clear", "", fmt.Sprintf("%d bytes", freed))
+	respondJSON(w, http.StatusOK, out)
+}
+
+// dirBytes adds up the sizes of the files under dir.
+func dirBytes(dir string) uint64 {
+	var total uint64
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += uint64(info.Size())
+			}
+		}
+		return nil
+	})
+	return total
+}
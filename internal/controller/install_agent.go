@@ -4,27 +4,27 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
-	"log"
 	"net"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"example.com/openrobot-fleet/internal/agent"
 	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
 	sshc "example.com/openrobot-fleet/internal/ssh"
 )
 
 type installAgentRequest struct {
-	Name     string `json:"name"`
-	Type     string `json:"type"`
-	Address  string `json:"address"`
-	User     string `json:"user"`
-	SSHKey   string `json:"ssh_key"`
-	Password string `json:"password"`
-	Sudo     bool   `json:"sudo"`
-	SudoPwd  string `json:"sudo_password"`
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	Address       string `json:"address"`
+	User          string `json:"user"`
+	SSHKey        string `json:"ssh_key"`
+	KeyPassphrase string `json:"key_passphrase"`
+	Password      string `json:"password"`
+	Sudo          bool   `json:"sudo"`
+	SudoPwd       string `json:"sudo_password"`
 }
 
 func (c *Controller) InstallAgent(w http.ResponseWriter, r *http.Request) {
@@ -37,10 +37,16 @@ func (c *Controller) InstallAgent(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "name, address, and user required")
 		return
 	}
-	if req.SSHKey == "" && req.Password == "" {
+	if req.SSHKey == "" && req.Password == "" && sshc.AgentSocket() == "" {
 		respondError(w, http.StatusBadRequest, "ssh_key or password required")
 		return
 	}
+	if req.SSHKey != "" {
+		if _, err := sshc.ParsePrivateKey([]byte(req.SSHKey), req.KeyPassphrase); errors.Is(err, sshc.ErrPassphraseRequired) || errors.Is(err, sshc.ErrWrongPassphrase) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
 	rType := req.Type
 	if rType == "" {
 		rType = "robot"
@@ -67,49 +73,72 @@ func (c *Controller) InstallAgent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	host := sshc.HostSpec{
-		Addr:         addr,
-		User:         req.User,
-		PrivateKey:   []byte(req.SSHKey),
-		Password:     req.Password,
-		UseSudo:      useSudo,
-		SudoPassword: sudoPwd,
+		Addr:          addr,
+		User:          req.User,
+		PrivateKey:    []byte(req.SSHKey),
+		KeyPassphrase: req.KeyPassphrase,
+		Password:      req.Password,
+		UseSudo:       useSudo,
+		SudoPassword:  sudoPwd,
+	}
+	// A robot installed before must still present its recorded host key. A
+	// new one has the key it presents recorded once it exists.
+	var presentedKey []byte
+	if existing, err := c.DB.GetRobotByName(r.Context(), req.Name); err == nil {
+		c.pinRobotHostKey(r.Context(), existing.ID, &host)
+	} else {
+		host.OnHostKey = func(key []byte) error {
+			presentedKey = key
+			return nil
+		}
 	}
 
 	arch, err := sshc.DetectArch(host)
 	if err != nil {
-		log.Printf("install agent: detect arch: %v", err)
+		logging.FromContext(r.Context()).Error("install agent: detect arch", "err", err)
+		if errors.Is(err, sshc.ErrHostKeyMismatch) {
+			respondError(w, http.StatusConflict, hostKeyChangedMessage(err))
+			return
+		}
 		respondError(w, http.StatusInternalServerError, "failed to detect architecture: "+err.Error())
 		return
 	}
 
-	binaryDir := os.Getenv("AGENT_BINARY_DIR")
-	if binaryDir == "" {
-		binaryDir = "/app"
+	if presentedKey != nil {
+		host.HostKey = presentedKey
 	}
 
-	binaryName := "agent-amd64"
-	if arch == "arm64" {
-		binaryName = "agent-arm64"
-	}
-
-	binaryPath := filepath.Join(binaryDir, binaryName)
-	binary, err := os.ReadFile(binaryPath)
+	binary, err := readAgentBinary(arch)
 	if err != nil {
-		log.Printf("install agent: read binary: %v", err)
+		logging.FromContext(r.Context()).Error("install agent: read binary", "err", err)
 		respondError(w, http.StatusInternalServerError, "agent binary unavailable")
 		return
 	}
 
+	payloadKey, err := agent.NewPayloadKey()
+	if err != nil {
+		logging.FromContext(r.Context()).Error("install agent: payload key", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to generate payload key")
+		return
+	}
+	enrollmentToken, _, err := c.issueEnrollmentToken(r.Context(), req.Name, 0)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("install agent: enrollment token", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to issue enrollment token")
+		return
+	}
 	broker := agentBrokerURL()
 	cfg := agent.Config{
-		AgentID:        req.Name,
-		MQTTBroker:     broker,
-		WorkspacePath:  workspace,
-		WorkspaceOwner: determineWorkspaceOwner(req),
+		AgentID:         req.Name,
+		MQTTBroker:      broker,
+		WorkspacePath:   workspace,
+		WorkspaceOwner:  determineWorkspaceOwner(req),
+		PayloadKey:      payloadKey,
+		EnrollmentToken: enrollmentToken,
 	}
 
 	if err := sshc.InstallAgent(host, cfg, binary); err != nil {
-		log.Printf("install agent: ssh failure: %v", err)
+		logging.FromContext(r.Context()).Error("install agent: ssh failure", "err", err)
 		msg := "failed to install agent"
 		if strings.Contains(err.Error(), "connection refused") || strings.Contains(err.Error(), "no route to host") || strings.Contains(err.Error(), "i/o timeout") {
 			msg = "Connection failed. Please check the connection or restart the robot."
@@ -118,8 +147,8 @@ func (c *Controller) InstallAgent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	robotIP := req.Address
-	if err := c.DB.UpdateRobotInstallConfigByName(r.Context(), req.Name, db.InstallConfig{Address: req.Address, User: req.User, SSHKey: req.SSHKey}); err != nil {
-		log.Printf("install agent: save install config: %v", err)
+	if err := c.DB.UpdateRobotInstallConfigByName(r.Context(), req.Name, db.InstallConfig{Address: req.Address, User: req.User, SSHKey: req.SSHKey, KeyPassphrase: req.KeyPassphrase}); err != nil {
+		logging.FromContext(r.Context()).Error("install agent: save install config", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to save robot install config")
 		return
 	}
@@ -127,64 +156,39 @@ func (c *Controller) InstallAgent(w http.ResponseWriter, r *http.Request) {
 		robotIP = hostIP
 	}
 	if err := c.DB.UpsertRobotWithType(r.Context(), cfg.AgentID, req.Name, robotIP, "installed", rType); err != nil {
-		log.Printf("install agent: upsert robot: %v", err)
+		logging.FromContext(r.Context()).Error("install agent: upsert robot", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to update robot")
 		return
 	}
 	if err := c.DB.UpdateRobotInstallConfigByName(r.Context(), req.Name, db.InstallConfig{
-		Address: req.Address,
-		User:    req.User,
-		SSHKey:  req.SSHKey,
+		Address:       req.Address,
+		User:          req.User,
+		SSHKey:        req.SSHKey,
+		KeyPassphrase: req.KeyPassphrase,
 	}); err != nil {
-		log.Printf("install agent: persist install config: %v", err)
+		logging.FromContext(r.Context()).Error("install agent: persist install config", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to save install settings")
 		return
 	}
 	robot, err := c.DB.GetRobotByName(r.Context(), req.Name)
 	if err != nil {
 		if !errors.Is(err, sql.ErrNoRows) {
-			log.Printf("install agent: fetch robot: %v", err)
+			logging.FromContext(r.Context()).Error("install agent: fetch robot", "err", err)
 		}
 		respondError(w, http.StatusInternalServerError, "failed to fetch robot")
 		return
 	}
-	respondJSON(w, http.StatusCreated, robot)
-}
-
-func (c *Controller) DownloadAgentBinary(w http.ResponseWriter, r *http.Request) {
-	basePath := os.Getenv("AGENT_BINARY_PATH")
-	if basePath == "" {
-		basePath = "/app/agent"
-	}
-
-	// Check for arch param
-	arch := r.URL.Query().Get("arch")
-	if arch != "" {
-		// Try to find architecture specific binary
-		// e.g. /app/agent-arm64
-		archPath := basePath + "-" + arch
-		if _, err := os.Stat(archPath); err == nil {
-			http.ServeFile(w, r, archPath)
-			return
-		}
-		// Also try mapping common names
-		if arch == "aarch64" {
-			archPath = basePath + "-arm64"
-			if _, err := os.Stat(archPath); err == nil {
-				http.ServeFile(w, r, archPath)
-				return
-			}
-		}
-		if arch == "x86_64" {
-			archPath = basePath + "-amd64"
-			if _, err := os.Stat(archPath); err == nil {
-				http.ServeFile(w, r, archPath)
-				return
-			}
+	if presentedKey != nil {
+		if err := c.recordHostKey(r.Context(), robot.ID, presentedKey); err != nil {
+			logging.FromContext(r.Context()).Warn("install agent: record host key", "err", err)
 		}
 	}
-
-	http.ServeFile(w, r, basePath)
+	if err := c.DB.SetRobotPayloadKey(r.Context(), robot.ID, payloadKey); err != nil {
+		logging.FromContext(r.Context()).Error("install agent: save payload key", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to save payload key")
+		return
+	}
+	respondJSON(w, http.StatusCreated, robot)
 }
 
 func agentBrokerURL() string {
@@ -1,17 +1,55 @@
 package controller
 
 import (
-	"log"
 	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// Job history is returned a page at a time: jobListDefaultLimit when no limit
+// is given, never more than jobListMaxLimit.
+const (
+	jobListDefaultLimit = 500
+	jobListMaxLimit     = 5000
 )
 
+// ListJobs returns jobs newest first. When the page is full, the X-Next-Until
+// header holds the until value that fetches the next one.
 func (c *Controller) ListJobs(w http.ResponseWriter, r *http.Request) {
-	target := r.URL.Query().Get("robot")
-	jobs, err := c.DB.ListJobs(r.Context(), target)
+	q := r.URL.Query()
+	f := db.JobFilter{Target: q.Get("robot"), Status: q.Get("status"), Limit: jobListDefaultLimit}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, p.name+" must be an RFC 3339 time")
+				return
+			}
+			*p.dst = t
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		f.Limit = min(n, jobListMaxLimit)
+	}
+	jobs, err := c.DB.ListJobs(r.Context(), f)
 	if err != nil {
-		log.Printf("list jobs: %v", err)
+		logging.FromContext(r.Context()).Error("list jobs", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to list jobs")
 		return
 	}
+	if len(jobs) == f.Limit {
+		w.Header().Set("X-Next-Until", jobs[len(jobs)-1].CreatedAt.UTC().Format(time.RFC3339Nano))
+	}
 	respondJSON(w, http.StatusOK, jobs)
 }
@@ -0,0 +1,271 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// laptopModel is the robot model of profiles for the lab's amd64 laptops.
+// They aren't built into an image: the profile's user-data is an Ubuntu
+// autoinstall file, which installs ROS desktop and the agent while Ubuntu
+// is installed from a stock ISO.
+const laptopModel = "laptop"
+
+// provisionTokenHeader carries the provisioning token when an installing
+// laptop downloads the agent.
+const provisionTokenHeader = "X-Provision-Token"
+
+// laptopUbuntu is the Ubuntu release each ROS version installs on.
+var laptopUbuntu = map[string]string{"Humble": "jammy", "Jazzy": "noble"}
+
+// renderAutoinstall renders the autoinstall file for a laptop profile. The
+// robot-side settings (LDS model, extras) don't apply.
+func (c *Controller) renderAutoinstall(ctx context.Context, cfg *db.GoldenImageConfig) ([]byte, error) {
+	if strings.TrimSpace(cfg.ControllerURL) == "" {
+		return nil, fmt.Errorf("laptop profiles need a controller URL")
+	}
+	token, err := c.imageProvisionToken(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("load provisioning token failed: %v", err)
+	}
+	enrollmentToken, _, err := c.issueEnrollmentToken(ctx, "laptop autoinstall", imageEnrollmentTTL())
+	if err != nil {
+		return nil, fmt.Errorf("issue enrollment token failed: %v", err)
+	}
+	script, err := laptopInstallScript(cfg, token, enrollmentToken)
+	if err != nil {
+		return nil, err
+	}
+
+	installCfg, err := c.DB.GetDefaultInstallConfig(ctx)
+	sshKey := ""
+	if err == nil && installCfg != nil {
+		sshKey = installCfg.SSHKey
+	}
+	pubKey, _ := prepareSSHKeys(sshKey)
+
+	user := map[string]interface{}{
+		"name":        "ubuntu",
+		"groups":      []string{"sudo", "dialout", "video", "plugdev"},
+		"shell":       "/bin/bash",
+		"sudo":        []string{"ALL=(ALL) NOPASSWD:ALL"},
+		"lock_passwd": cfg.UbuntuPassword == "",
+	}
+	if pubKey != "" {
+		user["ssh_authorized_keys"] = []string{pubKey}
+	}
+	userData := map[string]interface{}{
+		"preserve_hostname": true,
+		"users":             []interface{}{user},
+	}
+	if cfg.UbuntuPassword != "" {
+		userData["chpasswd"] = map[string]interface{}{
+			"expire": false,
+			"list":   []string{"ubuntu:" + cfg.UbuntuPassword},
+		}
+	}
+	// The networks are set up as NetworkManager profiles under the names
+	// the agent's wifi_profile uses, so a later push replaces them.
+	var files []interface{}
+	for _, n := range goldenWifiNetworks(cfg) {
+		name, keyfile := agent.NMConnection(n)
+		files = append(files, map[string]interface{}{
+			"path":        filepath.Join("/etc/NetworkManager/system-connections", name),
+			"permissions": "0600",
+			"content":     string(keyfile),
+		})
+	}
+	if _, err := cloudInitWriteFiles(cfg.WriteFiles); err != nil {
+		return nil, err
+	}
+	var extraFiles []interface{}
+	yaml.Unmarshal([]byte(cfg.WriteFiles), &extraFiles)
+	if files = append(files, extraFiles...); len(files) > 0 {
+		userData["write_files"] = files
+	}
+	if _, err := cloudInitRunCmd(cfg.RunCmd); err != nil {
+		return nil, err
+	}
+	var runCmd []interface{}
+	yaml.Unmarshal([]byte(cfg.RunCmd), &runCmd)
+	if len(runCmd) > 0 {
+		userData["runcmd"] = runCmd
+	}
+
+	doc := map[string]interface{}{
+		"autoinstall": map[string]interface{}{
+			"version":  1,
+			"locale":   "en_US.UTF-8",
+			"keyboard": map[string]string{"layout": "us"},
+			"storage":  map[string]interface{}{"layout": map[string]string{"name": "lvm"}},
+			"ssh": map[string]interface{}{
+				"install-server": true,
+				"allow-pw":       cfg.UbuntuPassword != "",
+			},
+			"late-commands": []string{
+				"echo " + base64.StdEncoding.EncodeToString([]byte(script)) + " | base64 -d > /target/root/openrobot-install.sh",
+				"curtin in-target --target=/target -- bash /root/openrobot-install.sh",
+				"rm -f /target/root/openrobot-install.sh",
+			},
+			"user-data": userData,
+		},
+	}
+	var buf bytes.Buffer
+	buf.WriteString("#cloud-config\n")
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// laptopInstallScript installs ROS desktop, the profile's lab packages and
+// the agent in the freshly installed system. The agent is downloaded from
+// the controller with the provisioning token and enrolls on first boot;
+// enrollmentToken lets it in if the controller requires one.
+func laptopInstallScript(cfg *db.GoldenImageConfig, token, enrollmentToken string) (string, error) {
+	rosVersion := cfg.ROSVersion
+	if rosVersion == "" {
+		rosVersion = "Humble"
+	}
+	codename, ok := laptopUbuntu[rosVersion]
+	if !ok {
+		return "", fmt.Errorf("unknown ROS version %q", cfg.ROSVersion)
+	}
+	agentCfg, err := yaml.Marshal(agent.Config{
+		AgentID:         "LAPTOP-UNINITIALIZED",
+		Type:            "laptop",
+		MQTTBroker:      cfg.MQTTBroker,
+		WorkspacePath:   "/home/ubuntu/ros_ws/src",
+		WorkspaceOwner:  "ubuntu",
+		ControllerURL:   cfg.ControllerURL,
+		ProvisionToken:  token,
+		EnrollmentToken: enrollmentToken,
+	})
+	if err != nil {
+		return "", err
+	}
+	agentURL := strings.TrimRight(cfg.ControllerURL, "/") + "/api/enroll/agent?arch=amd64"
+	return fmt.Sprintf(laptopScript,
+		rosVersion, codename, strings.ToLower(rosVersion), cfg.ROSDomainID,
+		labPackages(cfg),
+		shellQuote(provisionTokenHeader+": "+token), shellQuote(agentURL),
+		agentCfg), nil
+}
+
+const laptopScript = `#!/bin/bash
+set -euo pipefail
+export DEBIAN_FRONTEND=noninteractive
+
+CODENAME=$(. /etc/os-release && echo "$VERSION_CODENAME")
+if [ "$CODENAME" != "%[2]s" ]; then
+  echo "ROS %[1]s needs Ubuntu %[2]s, but this is $CODENAME" >&2
+  exit 1
+fi
+
+# ROS desktop
+apt-get update
+apt-get install -y curl git gnupg software-properties-common
+add-apt-repository -y universe
+curl -fsSL https://raw.githubusercontent.com/ros/rosdistro/master/ros.key -o /usr/share/keyrings/ros-archive-keyring.gpg
+echo "deb [arch=amd64 signed-by=/usr/share/keyrings/ros-archive-keyring.gpg] http://packages.ros.org/ros2/ubuntu $CODENAME main" > /etc/apt/sources.list.d/ros2.list
+apt-get update
+# The server ISO installs no desktop; the desktop ISO already has one.
+dpkg -s ubuntu-desktop-minimal >/dev/null 2>&1 || apt-get install -y ubuntu-desktop-minimal
+apt-get install -y ros-%[3]s-desktop python3-colcon-common-extensions python3-rosdep
+[ -f /etc/ros/rosdep/sources.list.d/20-default.list ] || rosdep init
+cat >> /etc/bash.bashrc <<'EOF'
+source /opt/ros/%[3]s/setup.bash
+export ROS_DOMAIN_ID=%[4]d
+EOF
+%[5]s
+# OpenRobot agent
+curl -fsSL -H %[6]s %[7]s -o /usr/local/bin/openrobotfleet-agent
+chmod 0755 /usr/local/bin/openrobotfleet-agent
+cat > /usr/local/bin/openrobotfleet-agent-start <<'EOF'
+#!/bin/bash
+for setup in /opt/ros/*/setup.bash; do
+  [ -f "$setup" ] && source "$setup" && break
+done
+exec /usr/local/bin/openrobotfleet-agent
+EOF
+chmod 0755 /usr/local/bin/openrobotfleet-agent-start
+mkdir -p /etc/openrobotfleet-agent
+cat > /etc/openrobotfleet-agent/config.yaml <<'EOF'
+%[8]sEOF
+chmod 0600 /etc/openrobotfleet-agent/config.yaml
+cat > /etc/systemd/system/openrobotfleet-agent.service <<'EOF'
+[Unit]
+Description=OpenRobot Agent
+After=network-online.target
+
+[Service]
+ExecStart=/usr/local/bin/openrobotfleet-agent-start
+Restart=always
+User=root
+Environment=AGENT_CONFIG_PATH=/etc/openrobotfleet-agent/config.yaml
+
+[Install]
+WantedBy=multi-user.target
+EOF
+systemctl enable openrobotfleet-agent
+
+# Until it enrolls under its pool name, the laptop is laptop-<random>.
+SUFFIX=$(od -An -N3 -tx1 /dev/urandom | tr -d ' \n')
+sed -i "s/LAPTOP-UNINITIALIZED/laptop-$SUFFIX/" /etc/openrobotfleet-agent/config.yaml
+echo "laptop-$SUFFIX" > /etc/hostname
+echo "127.0.1.1 laptop-$SUFFIX" >> /etc/hosts
+`
+
+// DownloadEnrollAgent returns the amd64 (or ?arch=) agent to a laptop being
+// installed from an autoinstall file. It is authenticated by the
+// provisioning token in the X-Provision-Token header, like /api/enroll.
+func (c *Controller) DownloadEnrollAgent(w http.ResponseWriter, r *http.Request) {
+	ok, err := c.checkProvisionToken(r.Context(), r.Header.Get(provisionTokenHeader))
+	if err != nil {
+		logging.FromContext(r.Context()).Error("enroll agent: load provisioning token", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to check provisioning token")
+		return
+	}
+	if !ok {
+		respondError(w, http.StatusUnauthorized, "invalid provisioning token")
+		return
+	}
+	if r.URL.Query().Get("arch") == "" {
+		q := r.URL.Query()
+		q.Set("arch", "amd64")
+		r.URL.RawQuery = q.Encode()
+	}
+	c.DownloadAgentBinary(w, r)
+}
+
+// checkProvisionToken reports whether token is an unexpired provisioning
+// token.
+func (c *Controller) checkProvisionToken(ctx context.Context, token string) (bool, error) {
+	tokens, err := c.loadProvisioningTokens(ctx)
+	if err != nil {
+		return false, err
+	}
+	ok := false
+	now := time.Now()
+	for _, e := range []*provisioningTokenEntry{&tokens.Current, tokens.Previous} {
+		if e.valid(now) && subtle.ConstantTimeCompare([]byte(e.Token), []byte(token)) == 1 {
+			ok = true
+		}
+	}
+	return ok, nil
+}
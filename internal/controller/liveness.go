@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"example.com/openrobot-fleet/internal/db"
+	sshc "example.com/openrobot-fleet/internal/ssh"
+)
+
+const offlineCheckInterval = 30 * time.Second
+
+// RunOfflineWatch raises an "offline" alert when a robot stops heartbeating.
+// With OFFLINE_SSH_PROBE=true robots that have SSH credentials (their own
+// install config or the default one) are probed first and the diagnosis, e.g.
+// "host up, agent crashed" or "host unreachable", is added to the alert.
+func (c *Controller) RunOfflineWatch(ctx context.Context) {
+	probe := os.Getenv("OFFLINE_SSH_PROBE") == "true"
+	ticker := time.NewTicker(offlineCheckInterval)
+	defer ticker.Stop()
+	// Robots already offline when the controller starts are not news.
+	var offline map[int64]bool
+	for {
+		robots, err := c.DB.ListRobots(ctx)
+		if err != nil {
+			slog.Error("offline watch: list robots", "err", err)
+		} else {
+			now := make(map[int64]bool)
+			for _, r := range robots {
+				if r.Status != "offline" {
+					continue
+				}
+				now[r.ID] = true
+				if offline != nil && !offline[r.ID] {
+					go c.alertOffline(ctx, r, probe)
+				}
+			}
+			offline = now
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Controller) alertOffline(ctx context.Context, robot db.Robot, probe bool) {
+	msg := fmt.Sprintf("%s went offline (last heartbeat %s)", robot.Name, robot.LastSeen.Local().Format("15:04:05"))
+	if probe {
+		if diagnosis := c.probeOffline(ctx, robot); diagnosis != "" {
+			msg += ": " + diagnosis
+		}
+	}
+	slog.Warn("robot offline", "robot", robot.Name, "msg", msg)
+	c.raiseAlert("offline", robot.ID, msg)
+}
+
+// probeOffline returns the SSH diagnosis for robot, or "" when it has no
+// usable credentials.
+func (c *Controller) probeOffline(ctx context.Context, robot db.Robot) string {
+	host, ok := c.probeHost(ctx, robot)
+	if !ok {
+		return ""
+	}
+	res, err := sshc.Probe(host)
+	if err != nil {
+		slog.Warn("offline watch: probe failed", "robot", robot.Name, "err", err)
+		return ""
+	}
+	return res.Diagnosis()
+}
+
+// probeHost fills the robot's install config from the default one, the same
+// way agent installs do, and prefers the last reported IP as the address. The
+// robot's recorded host key is required.
+func (c *Controller) probeHost(ctx context.Context, robot db.Robot) (sshc.HostSpec, bool) {
+	var cfg db.InstallConfig
+	if robot.InstallConfig != nil {
+		cfg = *robot.InstallConfig
+	}
+	if cfg.User == "" || (cfg.SSHKey == "" && cfg.Password == "") {
+		def, err := c.DB.GetDefaultInstallConfig(ctx)
+		if err != nil {
+			slog.Warn("offline watch: default install config", "err", err)
+		}
+		if def != nil {
+			if cfg.User == "" {
+				cfg.User = def.User
+			}
+			if cfg.SSHKey == "" && cfg.Password == "" {
+				cfg.SSHKey, cfg.Password, cfg.KeyPassphrase = def.SSHKey, def.Password, def.KeyPassphrase
+			}
+		}
+	}
+	addr := cfg.Address
+	if robot.IP != "" {
+		addr = robot.IP
+	}
+	if addr == "" || cfg.User == "" || (cfg.SSHKey == "" && cfg.Password == "" && sshc.AgentSocket() == "") {
+		return sshc.HostSpec{}, false
+	}
+	if !strings.Contains(addr, ":") {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	host := sshc.HostSpec{
+		Addr:          addr,
+		User:          cfg.User,
+		PrivateKey:    []byte(cfg.SSHKey),
+		KeyPassphrase: cfg.KeyPassphrase,
+		Password:      cfg.Password,
+	}
+	c.pinRobotHostKey(ctx, robot.ID, &host)
+	return host, true
+}
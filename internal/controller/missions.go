@@ -0,0 +1,351 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+const (
+	maxMissionWaypoints = 100
+	maxMissionLoops     = 20
+	// maxMissionWaitSec matches the agent's cap on a wait command.
+	maxMissionWaitSec = 600
+)
+
+// rosFrame is what a frame name may contain, with or without the leading
+// slash.
+var rosFrame = regexp.MustCompile(`^/?[A-Za-z_][A-Za-z0-9_/]*$`)
+
+type missionRequest struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description,omitempty"`
+	Frame       string        `json:"frame,omitempty"`
+	Waypoints   []db.Waypoint `json:"waypoints"`
+}
+
+// missionRunRequest sends a mission to every robot in robot_ids or matching
+// selector.
+type missionRunRequest struct {
+	RobotIDs []int64 `json:"robot_ids,omitempty"`
+	Selector string  `json:"selector,omitempty"`
+	// Loops drives the route this many times (default 1), e.g. for a patrol.
+	Loops int `json:"loops,omitempty"`
+	// Action is the NavigateToPose action server, /navigate_to_pose by
+	// default.
+	Action string `json:"action,omitempty"`
+	// TimeoutSec is how long each waypoint may take (default 300).
+	TimeoutSec int `json:"timeout_sec,omitempty"`
+}
+
+// applyTo validates req and copies it into m.
+func (req missionRequest) applyTo(m *db.Mission) error {
+	m.Name = strings.TrimSpace(req.Name)
+	m.Description = strings.TrimSpace(req.Description)
+	m.Frame = strings.TrimSpace(req.Frame)
+	if m.Name == "" {
+		return errors.New("mission name required")
+	}
+	if m.Frame != "" && !rosFrame.MatchString(m.Frame) {
+		return fmt.Errorf("invalid frame %q", m.Frame)
+	}
+	if len(req.Waypoints) == 0 || len(req.Waypoints) > maxMissionWaypoints {
+		return fmt.Errorf("a mission needs between 1 and %d waypoints", maxMissionWaypoints)
+	}
+	for i := range req.Waypoints {
+		wp := &req.Waypoints[i]
+		wp.Name = strings.TrimSpace(wp.Name)
+		for _, v := range []float64{wp.X, wp.Y, wp.Yaw} {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return fmt.Errorf("waypoint %d: x, y and yaw must be finite numbers", i+1)
+			}
+		}
+		switch wp.Action {
+		case "", db.WaypointSnapshot:
+			if wp.WaitSec != 0 {
+				return fmt.Errorf("waypoint %d: wait_sec needs the wait action", i+1)
+			}
+		case db.WaypointWait:
+			if wp.WaitSec < 1 || wp.WaitSec > maxMissionWaitSec {
+				return fmt.Errorf("waypoint %d: wait_sec must be between 1 and %d", i+1, maxMissionWaitSec)
+			}
+		default:
+			return fmt.Errorf("waypoint %d: unknown action %q; use wait or snapshot", i+1, wp.Action)
+		}
+	}
+	m.Waypoints = req.Waypoints
+	return nil
+}
+
+// ListMissions returns every mission.
+func (c *Controller) ListMissions(w http.ResponseWriter, r *http.Request) {
+	missions, err := c.DB.ListMissions(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list missions", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load missions")
+		return
+	}
+	respondJSON(w, http.StatusOK, missions)
+}
+
+// CreateMission saves a new mission.
+func (c *Controller) CreateMission(w http.ResponseWriter, r *http.Request) {
+	var req missionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid mission payload")
+		return
+	}
+	var m db.Mission
+	if err := req.applyTo(&m); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !c.missionNameFree(w, r, m) {
+		return
+	}
+	m.CreatedBy, _ = Actor(r.Context())
+	id, err := c.DB.CreateMission(r.Context(), m)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("create mission", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to save mission")
+		return
+	}
+	c.audit(r.Context(), "mission.create", m.Name, fmt.Sprintf("%d waypoints", len(m.Waypoints)))
+	c.respondMission(w, r, id, http.StatusCreated)
+}
+
+// GetMission returns one mission.
+func (c *Controller) GetMission(w http.ResponseWriter, r *http.Request) {
+	m, ok := c.missionFromPath(w, r)
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, m)
+}
+
+// UpdateMission replaces a mission's route. Robots already on it carry on
+// with the old one.
+func (c *Controller) UpdateMission(w http.ResponseWriter, r *http.Request) {
+	m, ok := c.missionFromPath(w, r)
+	if !ok {
+		return
+	}
+	var req missionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid mission payload")
+		return
+	}
+	if err := req.applyTo(&m); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !c.missionNameFree(w, r, m) {
+		return
+	}
+	if err := c.DB.UpdateMission(r.Context(), m); err != nil {
+		logging.FromContext(r.Context()).Error("update mission", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to save mission")
+		return
+	}
+	c.audit(r.Context(), "mission.update", m.Name, fmt.Sprintf("%d waypoints", len(m.Waypoints)))
+	c.respondMission(w, r, m.ID, http.StatusOK)
+}
+
+// DeleteMission removes a mission; robots already on it carry on.
+func (c *Controller) DeleteMission(w http.ResponseWriter, r *http.Request) {
+	m, ok := c.missionFromPath(w, r)
+	if !ok {
+		return
+	}
+	if err := c.DB.DeleteMission(r.Context(), m.ID); err != nil {
+		logging.FromContext(r.Context()).Error("delete mission", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to delete mission")
+		return
+	}
+	c.audit(r.Context(), "mission.delete", m.Name, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RunMission sends a mission to each robot as a batch: a nav_goal for every
+// waypoint, followed by its action. The job's steps show which waypoints
+// were reached and its progress the distance left to the current one. A
+// waypoint that can't be reached ends the mission; a failed snapshot
+// doesn't.
+func (c *Controller) RunMission(w http.ResponseWriter, r *http.Request) {
+	m, ok := c.missionFromPath(w, r)
+	if !ok {
+		return
+	}
+	var req missionRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid mission run payload")
+		return
+	}
+	if req.Loops == 0 {
+		req.Loops = 1
+	}
+	if req.Loops < 1 || req.Loops > maxMissionLoops {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("loops must be between 1 and %d", maxMissionLoops))
+		return
+	}
+	if req.TimeoutSec < 0 || req.TimeoutSec > maxNavTimeoutSec {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("timeout_sec must be between 0 and %d", maxNavTimeoutSec))
+		return
+	}
+	sel, err := parseSelector(req.Selector)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid selector: "+err.Error())
+		return
+	}
+	ids, err := c.mergeSelected(r.Context(), req.RobotIDs, sel)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("mission select robots", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to list robots")
+		return
+	}
+	if len(ids) == 0 {
+		respondError(w, http.StatusBadRequest, "robot_ids or a matching selector required")
+		return
+	}
+
+	robots := make([]db.Robot, 0, len(ids))
+	for _, id := range ids {
+		robot, err := c.DB.GetRobotByID(r.Context(), id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				respondError(w, http.StatusNotFound, fmt.Sprintf("robot %d not found", id))
+				return
+			}
+			logging.FromContext(r.Context()).Error("mission fetch robot", "err", err)
+			respondError(w, http.StatusInternalServerError, "failed to fetch robot")
+			return
+		}
+		robots = append(robots, robot)
+	}
+
+	baseURL := strings.TrimSuffix(requestBaseURL(r), "/")
+	resp := selectorCommandResponse{Jobs: []db.Job{}, Skipped: []string{}}
+	for _, robot := range robots {
+		if robot.AgentID == "" || robot.Type == "laptop" {
+			resp.Skipped = append(resp.Skipped, robot.Name)
+			continue
+		}
+		batch := missionBatch(m, req, fmt.Sprintf("%s/api/robots/%d/upload", baseURL, robot.ID))
+		data, _ := json.Marshal(batch)
+		// Interactive, so a robot offline for more than a few minutes doesn't
+		// start the route when it reconnects.
+		cmd := agent.Command{Type: "batch", Data: data, Priority: agent.PriorityInteractive}
+		job, err := c.queueRobotCommand(r.Context(), robot, cmd)
+		if errors.Is(err, db.ErrRobotArchived) {
+			resp.Skipped = append(resp.Skipped, robot.Name)
+			continue
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("queue mission", "robot", robot.Name, "err", err)
+			respondError(w, http.StatusInternalServerError, "failed to queue mission")
+			return
+		}
+		resp.Jobs = append(resp.Jobs, job)
+	}
+	c.audit(r.Context(), "mission.run", m.Name, fmt.Sprintf("%d robots, %d loops", len(resp.Jobs), req.Loops))
+	respondJSON(w, http.StatusCreated, resp)
+}
+
+// missionBatch is the batch that drives m: a nav_goal step per waypoint, and
+// a wait or capture_image step after those with an action, once per loop.
+// Snapshots are uploaded to uploadURL as the robot's latest image.
+func missionBatch(m db.Mission, req missionRunRequest, uploadURL string) agent.BatchData {
+	var batch agent.BatchData
+	add := func(name, cmdType string, data any, step agent.BatchStep) {
+		raw, _ := json.Marshal(data)
+		step.Name = name
+		batch.Commands = append(batch.Commands, agent.Command{Type: cmdType, Data: raw})
+		batch.Steps = append(batch.Steps, step)
+	}
+	for loop := 1; loop <= req.Loops; loop++ {
+		for i, wp := range m.Waypoints {
+			name := wp.Name
+			if name == "" {
+				name = fmt.Sprintf("waypoint %d", i+1)
+			}
+			if req.Loops > 1 {
+				name = fmt.Sprintf("loop %d: %s", loop, name)
+			}
+			add(name, "nav_goal", agent.NavGoalData{
+				X:          wp.X,
+				Y:          wp.Y,
+				Yaw:        wp.Yaw,
+				Frame:      m.Frame,
+				Action:     strings.TrimSpace(req.Action),
+				TimeoutSec: req.TimeoutSec,
+			}, agent.BatchStep{})
+			switch wp.Action {
+			case db.WaypointWait:
+				add(name+": wait", "wait", agent.WaitData{Seconds: wp.WaitSec}, agent.BatchStep{})
+			case db.WaypointSnapshot:
+				add(name+": snapshot", "capture_image", agent.CaptureImageData{UploadURL: uploadURL}, agent.BatchStep{ContinueOnError: true})
+			}
+		}
+	}
+	return batch
+}
+
+func (c *Controller) respondMission(w http.ResponseWriter, r *http.Request, id int64, status int) {
+	m, err := c.DB.GetMission(r.Context(), id)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("get mission", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load mission")
+		return
+	}
+	respondJSON(w, status, m)
+}
+
+// missionNameFree responds 409 if another mission already has m's name.
+func (c *Controller) missionNameFree(w http.ResponseWriter, r *http.Request, m db.Mission) bool {
+	other, err := c.DB.GetMissionByName(r.Context(), m.Name)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return true
+	case err != nil:
+		logging.FromContext(r.Context()).Error("get mission by name", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load missions")
+		return false
+	case other.ID != m.ID:
+		respondError(w, http.StatusConflict, fmt.Sprintf("mission %q already exists", m.Name))
+		return false
+	}
+	return true
+}
+
+// missionFromPath loads the mission named by /api/missions/{id}, with or
+// without a trailing action.
+func (c *Controller) missionFromPath(w http.ResponseWriter, r *http.Request) (db.Mission, bool) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/missions/"), "/")
+	idStr, _, _ := strings.Cut(rest, "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid mission id")
+		return db.Mission{}, false
+	}
+	m, err := c.DB.GetMission(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "mission not found")
+			return db.Mission{}, false
+		}
+		logging.FromContext(r.Context()).Error("get mission", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load mission")
+		return db.Mission{}, false
+	}
+	return m, true
+}
@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// maxNavTimeoutSec matches the agent's own cap on how long a goal may run.
+const maxNavTimeoutSec = 1800
+
+// navPose is where Nav2 should take a robot: x and y in meters and yaw in
+// radians, in frame (map by default).
+type navPose struct {
+	X     float64 `json:"x"`
+	Y     float64 `json:"y"`
+	Yaw   float64 `json:"yaw"`
+	Frame string  `json:"frame,omitempty"`
+}
+
+// robotNavGoal is a goal for one robot.
+type robotNavGoal struct {
+	RobotID int64 `json:"robot_id"`
+	navPose
+}
+
+// navGoalRequest sends Nav2 goals: the shared pose to every robot in
+// robot_ids or matching selector, and each of goals to its own robot.
+type navGoalRequest struct {
+	RobotIDs []int64 `json:"robot_ids,omitempty"`
+	Selector string  `json:"selector,omitempty"`
+	navPose
+	Goals []robotNavGoal `json:"goals,omitempty"`
+	// Action is the NavigateToPose action server, /navigate_to_pose by
+	// default.
+	Action string `json:"action,omitempty"`
+	// TimeoutSec cancels a goal not reached by then (default 300).
+	TimeoutSec int `json:"timeout_sec,omitempty"`
+}
+
+// NavGoals queues a nav_goal command for each robot. Each job reports the
+// distance remaining as its progress and fails if the goal is aborted,
+// rejected or times out.
+func (c *Controller) NavGoals(w http.ResponseWriter, r *http.Request) {
+	var req navGoalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid nav goal payload")
+		return
+	}
+	if req.TimeoutSec < 0 || req.TimeoutSec > maxNavTimeoutSec {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("timeout_sec must be between 0 and %d", maxNavTimeoutSec))
+		return
+	}
+	sel, err := parseSelector(req.Selector)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid selector: "+err.Error())
+		return
+	}
+	ids, err := c.mergeSelected(r.Context(), req.RobotIDs, sel)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("nav goal select robots", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to list robots")
+		return
+	}
+
+	// A robot given its own goal doesn't also get the shared one.
+	goals := make([]robotNavGoal, 0, len(ids)+len(req.Goals))
+	own := make(map[int64]bool, len(req.Goals))
+	for _, g := range req.Goals {
+		if own[g.RobotID] {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("robot %d has more than one goal", g.RobotID))
+			return
+		}
+		own[g.RobotID] = true
+		goals = append(goals, g)
+	}
+	for _, id := range ids {
+		if !own[id] {
+			goals = append(goals, robotNavGoal{RobotID: id, navPose: req.navPose})
+		}
+	}
+	if len(goals) == 0 {
+		respondError(w, http.StatusBadRequest, "robot_ids, a matching selector or goals required")
+		return
+	}
+
+	// Every robot is looked up first, so a bad ID queues nothing.
+	robots := make([]db.Robot, 0, len(goals))
+	for _, g := range goals {
+		robot, err := c.DB.GetRobotByID(r.Context(), g.RobotID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				respondError(w, http.StatusNotFound, fmt.Sprintf("robot %d not found", g.RobotID))
+				return
+			}
+			logging.FromContext(r.Context()).Error("nav goal fetch robot", "err", err)
+			respondError(w, http.StatusInternalServerError, "failed to fetch robot")
+			return
+		}
+		robots = append(robots, robot)
+	}
+
+	resp := selectorCommandResponse{Jobs: []db.Job{}, Skipped: []string{}}
+	for i, g := range goals {
+		robot := robots[i]
+		if robot.AgentID == "" || robot.Type == "laptop" {
+			resp.Skipped = append(resp.Skipped, robot.Name)
+			continue
+		}
+		data, _ := json.Marshal(agent.NavGoalData{
+			X:          g.X,
+			Y:          g.Y,
+			Yaw:        g.Yaw,
+			Frame:      strings.TrimSpace(g.Frame),
+			Action:     strings.TrimSpace(req.Action),
+			TimeoutSec: req.TimeoutSec,
+		})
+		job, err := c.queueRobotCommand(r.Context(), robot, agent.Command{Type: "nav_goal", Data: data})
+		if errors.Is(err, db.ErrRobotArchived) {
+			resp.Skipped = append(resp.Skipped, robot.Name)
+			continue
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("queue nav goal", "robot", robot.Name, "err", err)
+			respondError(w, http.StatusInternalServerError, "failed to queue nav goal")
+			return
+		}
+		resp.Jobs = append(resp.Jobs, job)
+	}
+	respondJSON(w, http.StatusCreated, resp)
+}
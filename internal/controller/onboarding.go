@@ -0,0 +1,225 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// onboardingDefaultsKey is the settings key holding the per-type onboarding
+// defaults as JSON.
+const onboardingDefaultsKey = "onboarding_defaults"
+
+// onboardingDefault is what a robot of one type gets when it first joins the
+// fleet. Type matches the platform the agent detects (turtlebot4,
+// turtlebot3) or, failing that, the robot's type (robot, laptop).
+type onboardingDefault struct {
+	Type string `json:"type"`
+	// Scenario is applied by name unless the robot already has one.
+	Scenario string   `json:"scenario,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+type onboardingDefaultsRequest struct {
+	Defaults []onboardingDefault `json:"defaults"`
+}
+
+func (c *Controller) loadOnboardingDefaults(ctx context.Context) ([]onboardingDefault, error) {
+	raw, err := c.DB.GetSetting(ctx, onboardingDefaultsKey)
+	if err != nil || raw == "" {
+		return []onboardingDefault{}, err
+	}
+	var defaults []onboardingDefault
+	if err := json.Unmarshal([]byte(raw), &defaults); err != nil {
+		return nil, fmt.Errorf("invalid onboarding defaults: %w", err)
+	}
+	return defaults, nil
+}
+
+// GetOnboardingDefaults lists the per-type onboarding defaults.
+func (c *Controller) GetOnboardingDefaults(w http.ResponseWriter, r *http.Request) {
+	defaults, err := c.loadOnboardingDefaults(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("load onboarding defaults", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load onboarding defaults")
+		return
+	}
+	respondJSON(w, http.StatusOK, onboardingDefaultsRequest{Defaults: defaults})
+}
+
+// UpdateOnboardingDefaults replaces the per-type onboarding defaults.
+func (c *Controller) UpdateOnboardingDefaults(w http.ResponseWriter, r *http.Request) {
+	var req onboardingDefaultsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid onboarding defaults")
+		return
+	}
+	seen := make(map[string]bool, len(req.Defaults))
+	for i := range req.Defaults {
+		d := &req.Defaults[i]
+		d.Type = strings.ToLower(strings.TrimSpace(d.Type))
+		d.Scenario = strings.TrimSpace(d.Scenario)
+		if d.Type == "" {
+			respondError(w, http.StatusBadRequest, "type required")
+			return
+		}
+		if seen[d.Type] {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("type %q is listed twice", d.Type))
+			return
+		}
+		seen[d.Type] = true
+		tags := make([]string, 0, len(d.Tags))
+		for _, tag := range d.Tags {
+			tag = strings.TrimSpace(tag)
+			if tag == "" || strings.Contains(tag, ",") {
+				respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid tag %q", tag))
+				return
+			}
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		d.Tags = tags
+		if d.Scenario == "" {
+			continue
+		}
+		if _, err := c.DB.GetScenarioByName(r.Context(), d.Scenario); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				respondError(w, http.StatusBadRequest, fmt.Sprintf("scenario %q not found", d.Scenario))
+				return
+			}
+			logging.FromContext(r.Context()).Error("onboarding defaults fetch scenario", "err", err)
+			respondError(w, http.StatusInternalServerError, "failed to load scenario")
+			return
+		}
+	}
+	if req.Defaults == nil {
+		req.Defaults = []onboardingDefault{}
+	}
+	raw, _ := json.Marshal(req.Defaults)
+	if err := c.DB.SaveSetting(r.Context(), onboardingDefaultsKey, string(raw)); err != nil {
+		logging.FromContext(r.Context()).Error("save onboarding defaults", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to save onboarding defaults")
+		return
+	}
+	c.audit(r.Context(), "onboarding.update", "", fmt.Sprintf("%d types", len(req.Defaults)))
+	respondJSON(w, http.StatusOK, req)
+}
+
+// onboardingFor returns the default for robot: one for its platform if there
+// is one, else one for its type.
+func onboardingFor(defaults []onboardingDefault, robot db.Robot) (onboardingDefault, bool) {
+	if robot.Facts != nil && robot.Facts.Platform != "" {
+		for _, d := range defaults {
+			if d.Type == robot.Facts.Platform {
+				return d, true
+			}
+		}
+	}
+	for _, d := range defaults {
+		if d.Type == robot.Type {
+			return d, true
+		}
+	}
+	return onboardingDefault{}, false
+}
+
+// OnboardRobot applies the onboarding defaults to a robot the first time its
+// agent reports in, whether it was enrolled through install-agent, added by
+// hand or registered itself. It is called on every heartbeat; the work runs
+// in the background, once per robot.
+func (c *Controller) OnboardRobot(ctx context.Context, robotID int64) {
+	if robotID == 0 {
+		return
+	}
+	if _, done := c.onboarded.LoadOrStore(robotID, true); done {
+		return
+	}
+	go c.onboard(ctx, robotID)
+}
+
+func (c *Controller) onboard(ctx context.Context, robotID int64) {
+	claimed, err := c.DB.ClaimRobotOnboarding(ctx, robotID)
+	if err != nil {
+		slog.Error("onboarding: failed to mark robot", "robot_id", robotID, "err", err)
+		c.onboarded.Delete(robotID)
+		return
+	}
+	if !claimed {
+		return
+	}
+	robot, err := c.DB.GetRobotByID(ctx, robotID)
+	if err != nil {
+		slog.Error("onboarding: failed to fetch robot", "robot_id", robotID, "err", err)
+		return
+	}
+	defaults, err := c.loadOnboardingDefaults(ctx)
+	if err != nil {
+		slog.Error("onboarding: failed to load defaults", "err", err)
+		return
+	}
+	d, ok := onboardingFor(defaults, robot)
+	if !ok {
+		return
+	}
+	slog.Info("onboarding: applying defaults", "robot", robot.Name, "type", d.Type, "scenario", d.Scenario, "tags", d.Tags)
+
+	if len(d.Tags) > 0 {
+		tags := append([]string(nil), robot.Tags...)
+		for _, tag := range d.Tags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		if err := c.DB.UpdateRobotTags(ctx, robot.ID, tags); err != nil {
+			slog.Error("onboarding: failed to tag robot", "robot", robot.Name, "err", err)
+		}
+		robot.Tags = tags
+	}
+	if d.Scenario == "" || robot.LastScenario != nil {
+		return
+	}
+	if err := c.applyOnboardingScenario(ctx, robot, d.Scenario); err != nil {
+		slog.Warn("onboarding: scenario not applied", "robot", robot.Name, "scenario", d.Scenario, "err", err)
+		c.raiseAlert("onboarding", robot.ID, fmt.Sprintf("%s joined the fleet but its default scenario %s was not applied: %v", robot.Name, d.Scenario, err))
+	}
+}
+
+func (c *Controller) applyOnboardingScenario(ctx context.Context, robot db.Robot, name string) error {
+	s, err := c.DB.GetScenarioByName(ctx, name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("scenario not found")
+		}
+		return err
+	}
+	spec, err := c.loadScenarioSpec(ctx, s)
+	if err != nil {
+		return fmt.Errorf("invalid scenario config: %w", err)
+	}
+	if reasons := spec.Requires.Unmet(robot); len(reasons) > 0 {
+		return errors.New(strings.Join(reasons, ", "))
+	}
+	cmd, err := spec.BatchCommand(robot)
+	if err != nil {
+		return err
+	}
+	job, err := c.queueRobotCommand(ctx, robot, cmd)
+	if err != nil {
+		return err
+	}
+	if err := c.DB.UpdateRobotScenario(ctx, robot.ID, s.ID); err != nil {
+		slog.Error("onboarding: failed to record scenario", "robot", robot.Name, "err", err)
+	}
+	c.recordScenarioApply(ctx, s.ID, robot, job)
+	return nil
+}
@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// errPayloadKeyMissing is returned when a sensitive command can't be sealed
+// for its robot and PAYLOAD_ENCRYPTION=required forbids sending it in the
+// clear.
+var errPayloadKeyMissing = errors.New("robot has no payload key; reinstall its agent to enable encrypted commands")
+
+// payloadEncryptionRequired reports whether sensitive commands must be
+// encrypted. By default robots installed before payload keys existed still
+// receive them in the clear, with a warning; repo credentials are the
+// exception (see sealSensitive).
+func payloadEncryptionRequired() bool {
+	return os.Getenv("PAYLOAD_ENCRYPTION") == "required"
+}
+
+// sealSensitive encrypts cmd with the robot's payload key if it carries
+// secrets, before the job (and its payload) is stored or published.
+func (c *Controller) sealSensitive(ctx context.Context, robot db.Robot, cmd *agent.Command) error {
+	if !agent.SensitiveCommand(*cmd) {
+		return nil
+	}
+	key, err := c.DB.RobotPayloadKey(ctx, robot.ID)
+	if err != nil {
+		return fmt.Errorf("payload key: %w", err)
+	}
+	if key == "" {
+		// A repo token or deploy key reaches beyond the lab, so it is never
+		// sent, or stored in the job, in the clear.
+		if payloadEncryptionRequired() || agent.HasRepoAuth(*cmd) {
+			return errPayloadKeyMissing
+		}
+		logging.FromContext(ctx).Warn("sending sensitive command unencrypted", "type", cmd.Type, "robot", robot.Name)
+		return nil
+	}
+	return agent.SealCommand(cmd, key, robot.AgentID)
+}
@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// A new agent that AGENT_ENROLLMENT doesn't let in on its own waits in
+// /api/robots/pending for an operator. Approving it creates its robot;
+// rejecting it has the status subscriber drop its heartbeats before they
+// touch anything.
+
+// rejectedAgents is the set of rejected agent IDs, kept in memory because
+// it is checked on every heartbeat. It is loaded on first use.
+type rejectedAgents struct {
+	once sync.Once
+	ids  sync.Map
+}
+
+func (r *rejectedAgents) load(ctx context.Context, d *db.DB) {
+	r.once.Do(func() {
+		agents, err := d.ListPendingAgents(ctx)
+		if err != nil {
+			slog.Error("load rejected agents", "err", err)
+			return
+		}
+		for _, a := range agents {
+			if a.Rejected {
+				r.ids.Store(a.AgentID, true)
+			}
+		}
+	})
+}
+
+func (r *rejectedAgents) add(agentID string)    { r.ids.Store(agentID, true) }
+func (r *rejectedAgents) remove(agentID string) { r.ids.Delete(agentID) }
+
+// AgentRejected reports whether an operator rejected agentID, so that its
+// heartbeats are ignored.
+func (c *Controller) AgentRejected(ctx context.Context, agentID string) bool {
+	c.rejected.load(ctx, c.DB)
+	_, ok := c.rejected.ids.Load(agentID)
+	return ok
+}
+
+// holdAgent records an agent that wasn't let in, raising an alert the first
+// time it is seen.
+func (c *Controller) holdAgent(ctx context.Context, p db.PendingAgent) {
+	stored, created, err := c.DB.RecordPendingAgent(ctx, p)
+	if err != nil {
+		slog.Error("admit agent: record pending", "agent_id", p.AgentID, "err", err)
+		return
+	}
+	if created && !stored.Rejected {
+		slog.Warn("agent waiting for approval", "agent_id", p.AgentID, "ip", p.IP, "reason", p.Reason)
+		c.raiseAlert("enrollment", 0, fmt.Sprintf("Agent %s (%s) is waiting for approval: %s", p.AgentID, p.IP, p.Reason))
+	}
+}
+
+// ListPendingAgents returns the agents waiting for approval, and those
+// rejected.
+func (c *Controller) ListPendingAgents(w http.ResponseWriter, r *http.Request) {
+	agents, err := c.DB.ListPendingAgents(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list pending agents", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to list pending agents")
+		return
+	}
+	respondJSON(w, http.StatusOK, agents)
+}
+
+type approveAgentRequest struct {
+	// Name is the robot's name; the agent is renamed to it. It defaults to
+	// the name the agent reported.
+	Name string `json:"name,omitempty"`
+}
+
+// ApprovePendingAgent creates the robot for a pending agent; its next
+// heartbeat is handled like any other robot's.
+// Path: /api/robots/pending/{agent}/approve
+func (c *Controller) ApprovePendingAgent(w http.ResponseWriter, r *http.Request) {
+	p, ok := c.pendingAgentFromPath(w, r)
+	if !ok {
+		return
+	}
+	var req approveAgentRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+	ctx := r.Context()
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = p.Name
+	}
+	if name == "" || strings.ContainsAny(name, " \t\n/+#") {
+		respondError(w, http.StatusBadRequest, "name must not be empty or contain spaces, /, + or #")
+		return
+	}
+	// A robot added by hand under the name is linked to the agent; one
+	// another agent runs is not taken over.
+	if other, err := c.DB.GetRobotByName(ctx, name); err == nil && other.AgentID != "" && other.AgentID != p.AgentID {
+		respondError(w, http.StatusConflict, fmt.Sprintf("name %q is already used by robot %d", name, other.ID))
+		return
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		logging.FromContext(ctx).Error("approve agent: check name", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to check robot name")
+		return
+	}
+	if other, err := c.DB.GetRobotByAgentID(ctx, p.AgentID); err == nil {
+		respondError(w, http.StatusConflict, fmt.Sprintf("agent %q already runs robot %q", p.AgentID, other.Name))
+		return
+	}
+	if msg := c.usageLimitReached(ctx, "robots"); msg != "" {
+		respondError(w, http.StatusForbidden, msg)
+		return
+	}
+	if err := c.DB.UpsertRobotWithType(ctx, p.AgentID, name, p.IP, "approved", p.Type); err != nil {
+		logging.FromContext(ctx).Error("approve agent: create robot", "agent_id", p.AgentID, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to create robot")
+		return
+	}
+	if err := c.DB.DeletePendingAgent(ctx, p.AgentID); err != nil {
+		logging.FromContext(ctx).Error("approve agent: clear pending", "agent_id", p.AgentID, "err", err)
+	}
+	c.rejected.remove(p.AgentID)
+	robot, err := c.DB.GetRobotByAgentID(ctx, p.AgentID)
+	if err != nil {
+		logging.FromContext(ctx).Error("approve agent: get robot", "agent_id", p.AgentID, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to fetch robot")
+		return
+	}
+	c.audit(ctx, "enrollment.approve", name, "agent "+p.AgentID)
+	redactInstallConfig(&robot)
+	respondJSON(w, http.StatusOK, robot)
+}
+
+// RejectPendingAgent keeps a pending agent out; its heartbeats are dropped
+// as they arrive until it is approved after all.
+// Path: /api/robots/pending/{agent}/reject
+func (c *Controller) RejectPendingAgent(w http.ResponseWriter, r *http.Request) {
+	p, ok := c.pendingAgentFromPath(w, r)
+	if !ok {
+		return
+	}
+	if err := c.DB.RejectPendingAgent(r.Context(), p.AgentID); err != nil {
+		logging.FromContext(r.Context()).Error("reject agent", "agent_id", p.AgentID, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to reject agent")
+		return
+	}
+	c.rejected.add(p.AgentID)
+	c.audit(r.Context(), "enrollment.reject", p.AgentID, p.IP)
+	respondJSON(w, http.StatusOK, map[string]string{"status": "rejected"})
+}
+
+// pendingAgentFromPath loads the agent named by
+// /api/robots/pending/{agent}/....
+func (c *Controller) pendingAgentFromPath(w http.ResponseWriter, r *http.Request) (db.PendingAgent, bool) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/robots/pending/"), "/")
+	agentID, _, _ := strings.Cut(rest, "/")
+	p, err := c.DB.GetPendingAgent(r.Context(), agentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "pending agent not found")
+			return db.PendingAgent{}, false
+		}
+		logging.FromContext(r.Context()).Error("get pending agent", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load pending agent")
+		return db.PendingAgent{}, false
+	}
+	return p, true
+}
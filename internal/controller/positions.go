@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// positionStaleAfter is how old a reported pose may be before the map shows
+// it as last known rather than current. Agents report every 30 seconds.
+const positionStaleAfter = 2 * time.Minute
+
+// fleetRobotPosition is one robot on the fleet map.
+type fleetRobotPosition struct {
+	RobotID int64  `json:"robot_id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	db.RobotPosition
+	// Stale is set when the robot is offline or hasn't reported a pose
+	// lately; the position is where it was last seen.
+	Stale bool `json:"stale"`
+}
+
+type fleetPositions struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	// Frames are the frames the positions are in, e.g. map for robots
+	// localizing with AMCL and odom for the rest, which only share a
+	// coordinate system by accident.
+	Frames []string             `json:"frames"`
+	Robots []fleetRobotPosition `json:"robots"`
+}
+
+// FleetPositions returns where every robot last reported being, for drawing
+// the fleet on the lab map. ?frame= keeps only positions in that frame.
+func (c *Controller) FleetPositions(w http.ResponseWriter, r *http.Request) {
+	robots, err := c.DB.ListRobots(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("fleet positions: list robots", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load robots")
+		return
+	}
+	frame := r.URL.Query().Get("frame")
+	now := time.Now().UTC()
+	out := fleetPositions{GeneratedAt: now, Frames: []string{}, Robots: []fleetRobotPosition{}}
+	frames := map[string]bool{}
+	for _, robot := range robots {
+		if robot.Position == nil {
+			continue
+		}
+		if !frames[robot.Position.Frame] {
+			frames[robot.Position.Frame] = true
+			out.Frames = append(out.Frames, robot.Position.Frame)
+		}
+		if frame != "" && robot.Position.Frame != frame {
+			continue
+		}
+		out.Robots = append(out.Robots, fleetRobotPosition{
+			RobotID:       robot.ID,
+			Name:          robot.Name,
+			Type:          robot.Type,
+			Status:        robot.Status,
+			RobotPosition: *robot.Position,
+			Stale:         robot.Status == "offline" || now.Sub(robot.Position.At) > positionStaleAfter,
+		})
+	}
+	sort.Strings(out.Frames)
+	respondJSON(w, http.StatusOK, out)
+}
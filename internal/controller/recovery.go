@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"gopkg.in/yaml.v3"
+)
+
+// Agents announce every 30s while in recovery mode; alert once per window.
+const recoveryAlertInterval = 10 * time.Minute
+
+type recoveryAgent struct {
+	agent.RecoveryAnnouncement
+	LastSeen time.Time `json:"last_seen"`
+
+	lastAlert time.Time
+}
+
+type recoveryConfigRequest struct {
+	AgentID        string `json:"agent_id"`
+	Type           string `json:"type"`
+	MQTTBroker     string `json:"mqtt_broker"`
+	WorkspacePath  string `json:"workspace_path"`
+	WorkspaceOwner string `json:"workspace_owner"`
+}
+
+type recoveryRegistry struct {
+	mu     sync.Mutex
+	agents map[string]*recoveryAgent
+}
+
+// RecordRecoveryAnnouncement handles a message from an agent that could not
+// load its config and is waiting in "needs configuration" mode.
+func (c *Controller) RecordRecoveryAnnouncement(payload []byte) {
+	var a agent.RecoveryAnnouncement
+	if err := json.Unmarshal(payload, &a); err != nil || a.Hostname == "" {
+		slog.Warn("recovery: invalid announcement", "err", err)
+		return
+	}
+	c.recovery.mu.Lock()
+	if c.recovery.agents == nil {
+		c.recovery.agents = make(map[string]*recoveryAgent)
+	}
+	entry, ok := c.recovery.agents[a.Hostname]
+	if !ok {
+		entry = &recoveryAgent{}
+		c.recovery.agents[a.Hostname] = entry
+	}
+	entry.RecoveryAnnouncement = a
+	entry.LastSeen = time.Now()
+	shouldAlert := time.Since(entry.lastAlert) > recoveryAlertInterval
+	if shouldAlert {
+		entry.lastAlert = entry.LastSeen
+	}
+	c.recovery.mu.Unlock()
+
+	if shouldAlert {
+		var robotID int64
+		if robot, err := c.DB.GetRobotByAgentID(context.Background(), a.Hostname); err == nil {
+			robotID = robot.ID
+		}
+		c.raiseAlert("needs_configuration", robotID, fmt.Sprintf("agent on %s (%s) needs configuration: %s", a.Hostname, a.IP, a.Error))
+	}
+}
+
+func (c *Controller) ListRecoveryAgents(w http.ResponseWriter, r *http.Request) {
+	c.recovery.mu.Lock()
+	list := make([]recoveryAgent, 0, len(c.recovery.agents))
+	for _, a := range c.recovery.agents {
+		list = append(list, *a)
+	}
+	c.recovery.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Hostname < list[j].Hostname })
+	respondJSON(w, http.StatusOK, list)
+}
+
+// PushRecoveryConfig sends a fresh config to an agent in recovery mode.
+// Path: /api/recovery/{hostname}
+func (c *Controller) PushRecoveryConfig(w http.ResponseWriter, r *http.Request) {
+	hostname := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/recovery/"), "/")
+	if hostname == "" || strings.ContainsAny(hostname, "/#+") {
+		respondError(w, http.StatusBadRequest, "invalid hostname")
+		return
+	}
+	var req recoveryConfigRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	cfg := agent.Config{
+		AgentID:        req.AgentID,
+		Type:           req.Type,
+		MQTTBroker:     req.MQTTBroker,
+		WorkspacePath:  req.WorkspacePath,
+		WorkspaceOwner: req.WorkspaceOwner,
+	}
+	if cfg.AgentID == "" {
+		cfg.AgentID = hostname
+	}
+	if cfg.Type == "" {
+		cfg.Type = "robot"
+	}
+	if cfg.MQTTBroker == "" {
+		cfg.MQTTBroker = agentBrokerURL()
+	}
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to encode config")
+		return
+	}
+	// Retained so an agent that reconnects between announcements still gets it
+	c.MQTT.Publish(agent.RecoveryTopicPrefix+hostname+"/config", 1, true, data)
+
+	c.recovery.mu.Lock()
+	delete(c.recovery.agents, hostname)
+	c.recovery.mu.Unlock()
+
+	c.audit(r.Context(), "recovery.push_config", hostname, "agent_id "+cfg.AgentID)
+	respondJSON(w, http.StatusAccepted, map[string]string{"status": "sent", "agent_id": cfg.AgentID})
+}
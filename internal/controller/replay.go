@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
+)
+
+// replayInteractiveWindow is how old an interactive command (identify, test
+// drive, ...) may be and still be replayed; after that the person who sent
+// it has moved on. Critical commands are never replayed, for the reason
+// agent.RetainCommand gives.
+const replayInteractiveWindow = 5 * time.Minute
+
+// ReplayQueuedJobs re-publishes, oldest first, the jobs still queued for a
+// robot that has come back online. Only jobs created since its last
+// heartbeat are replayed: earlier ones were sent while it was connected. The
+// agent drops any it already received (e.g. as the retained message). Stale
+// commands are marked expired instead.
+func (c *Controller) ReplayQueuedJobs(ctx context.Context, robot db.Robot, since time.Time) {
+	if robot.AgentID == "" || robot.ArchivedAt != nil {
+		return
+	}
+	jobs, err := c.DB.ListQueuedJobs(ctx, robot.AgentID, since)
+	if err != nil {
+		slog.Error("replay: list queued jobs", "robot", robot.Name, "err", err)
+		return
+	}
+	topic := fmt.Sprintf("lab/commands/%s", robot.AgentID)
+	var replayed, expired int
+	for _, job := range jobs {
+		var cmd agent.Command
+		if err := json.Unmarshal([]byte(job.PayloadJSON), &cmd); err != nil {
+			slog.Warn("replay: invalid job payload", "job_id", job.ID, "err", err)
+			continue
+		}
+		if replayExpired(cmd, job.CreatedAt) {
+			if err := c.DB.UpdateJobStatus(ctx, job.ID, "expired"); err != nil {
+				slog.Error("replay: expire job", "job_id", job.ID, "err", err)
+			}
+			expired++
+			continue
+		}
+		// The stored payload predates the job ID.
+		cmd.ID = fmt.Sprintf("%d", job.ID)
+		payload, _ := json.Marshal(cmd)
+		c.MQTT.Publish(topic, 1, false, payload)
+		replayed++
+	}
+	if replayed+expired > 0 {
+		slog.Info("replayed queued jobs", "robot", robot.Name, "agent_id", robot.AgentID, "replayed", replayed, "expired", expired)
+	}
+}
+
+func replayExpired(cmd agent.Command, created time.Time) bool {
+	priority := cmd.Priority
+	if priority == "" {
+		priority = agent.DefaultPriority(cmd.Type)
+	}
+	switch priority {
+	case agent.PriorityCritical:
+		return true
+	case agent.PriorityInteractive:
+		return time.Since(created) > replayInteractiveWindow
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+	"example.com/openrobot-fleet/internal/scenario"
+	"golang.org/x/crypto/ssh"
+)
+
+// repoAuthRequest sets a scenario's repo credentials: a token (with an
+// optional username) for an HTTPS repo, or a deploy key for an SSH one.
+type repoAuthRequest struct {
+	Username string `json:"username,omitempty"`
+	Token    string `json:"token,omitempty"`
+	SSHKey   string `json:"ssh_key,omitempty"`
+}
+
+// SetScenarioRepoAuth stores (PUT) or removes (DELETE) the credentials the
+// agents use to clone the scenario's private repo. They are never returned.
+func (c *Controller) SetScenarioRepoAuth(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDFromPath(strings.TrimSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/repo-auth"), "/api/scenarios/")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid scenario id")
+		return
+	}
+	s, err := c.DB.GetScenarioByID(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(w, http.StatusNotFound, "scenario not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("repo auth fetch scenario", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load scenario")
+		return
+	}
+
+	var stored, detail string
+	if r.Method == http.MethodDelete {
+		detail = "removed"
+	} else {
+		var req repoAuthRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid repo auth payload")
+			return
+		}
+		auth := agent.RepoAuth{Username: strings.TrimSpace(req.Username), Token: strings.TrimSpace(req.Token), SSHKey: strings.TrimSpace(req.SSHKey)}
+		var repoURL string
+		if spec, err := c.resolveScenarioSpec(r.Context(), s.Name, s.ConfigYAML); err == nil {
+			repoURL = spec.Repo.URL
+		}
+		if msg := validateRepoAuth(auth, repoURL); msg != "" {
+			respondError(w, http.StatusBadRequest, msg)
+			return
+		}
+		raw, _ := json.Marshal(auth)
+		stored = string(raw)
+		detail = "token"
+		if auth.SSHKey != "" {
+			detail = "ssh key"
+		}
+	}
+	if err := c.DB.SetScenarioRepoAuth(r.Context(), id, stored); err != nil {
+		logging.FromContext(r.Context()).Error("store repo auth", "scenario", s.Name, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to store repo credentials")
+		return
+	}
+	c.audit(r.Context(), "scenario.repo_auth", s.Name, detail)
+	s.HasRepoAuth = stored != ""
+	respondJSON(w, http.StatusOK, s)
+}
+
+// validateRepoAuth returns why auth can't be used to clone repoURL, or "".
+func validateRepoAuth(auth agent.RepoAuth, repoURL string) string {
+	switch {
+	case auth.Token == "" && auth.SSHKey == "":
+		return "token or ssh_key required"
+	case auth.Token != "" && auth.SSHKey != "":
+		return "set either a token or an ssh_key, not both"
+	case strings.ContainsAny(auth.Username+auth.Token, "\n\x00"):
+		return "username and token must be a single line"
+	}
+	if auth.SSHKey != "" {
+		if _, err := ssh.ParseRawPrivateKey([]byte(auth.SSHKey)); err != nil {
+			if _, ok := err.(*ssh.PassphraseMissingError); ok {
+				return "ssh_key must not have a passphrase"
+			}
+			return "ssh_key is not a valid private key"
+		}
+	}
+	// A token only works over HTTPS and a key only over SSH. Templated URLs
+	// are checked too, as long as the scheme isn't templated.
+	url := strings.TrimSpace(repoURL)
+	https := strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "http://")
+	sshURL := strings.HasPrefix(url, "ssh://") || (!strings.Contains(url, "://") && strings.Contains(url, "@") && strings.Contains(url, ":"))
+	if auth.Token != "" && sshURL {
+		return "a token needs an https repo URL; use an ssh_key for " + url
+	}
+	if auth.SSHKey != "" && https {
+		return "an ssh_key needs an ssh repo URL (git@host:org/repo); use a token for " + url
+	}
+	return ""
+}
+
+// loadScenarioSpec resolves s and attaches its repo credentials, for building
+// the commands sent to robots.
+func (c *Controller) loadScenarioSpec(ctx context.Context, s db.Scenario) (scenario.Spec, error) {
+	spec, err := c.resolveScenarioSpec(ctx, s.Name, s.ConfigYAML)
+	if err != nil {
+		return spec, err
+	}
+	if !s.HasRepoAuth {
+		return spec, nil
+	}
+	raw, err := c.DB.ScenarioRepoAuth(ctx, s.ID)
+	if err != nil {
+		return spec, fmt.Errorf("repo credentials: %w", err)
+	}
+	var auth agent.RepoAuth
+	if err := json.Unmarshal([]byte(raw), &auth); err != nil {
+		return spec, fmt.Errorf("repo credentials: %w", err)
+	}
+	spec.RepoAuth = &auth
+	return spec, nil
+}
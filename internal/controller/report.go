@@ -0,0 +1,381 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"example.com/openrobot-fleet/internal/logging"
+	"example.com/openrobot-fleet/internal/mail"
+)
+
+const (
+	reportCheckInterval = 5 * time.Minute
+	reportTopFailing    = 5
+	// reportLastSentKey stores the date of the last weekly report so a
+	// restart (or a second controller) doesn't send it twice.
+	reportLastSentKey = "weekly_report_last_sent"
+)
+
+// reportConfig is read from REPORT_RECIPIENTS, REPORT_WEEKDAY and REPORT_HOUR.
+type reportConfig struct {
+	recipients []string
+	weekday    time.Weekday
+	hour       int
+}
+
+func reportConfigFromEnv() reportConfig {
+	cfg := reportConfig{weekday: time.Monday, hour: 8}
+	for _, addr := range strings.Split(os.Getenv("REPORT_RECIPIENTS"), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			cfg.recipients = append(cfg.recipients, addr)
+		}
+	}
+	if v := strings.ToLower(strings.TrimSpace(os.Getenv("REPORT_WEEKDAY"))); v != "" {
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if name := strings.ToLower(d.String()); v == name || v == name[:3] {
+				cfg.weekday = d
+			}
+		}
+	}
+	if v, err := strconv.Atoi(os.Getenv("REPORT_HOUR")); err == nil && v >= 0 && v <= 23 {
+		cfg.hour = v
+	}
+	return cfg
+}
+
+// WeeklyReport summarises the last seven days for course coordinators.
+type WeeklyReport struct {
+	GeneratedAt  time.Time         `json:"generated_at"`
+	Since        time.Time         `json:"since"`
+	Availability FleetAvailability `json:"availability"`
+	TopFailing   []FailingRobot    `json:"top_failing"`
+	Storage      []StorageUsage    `json:"storage"`
+	JobsByStatus map[string]int    `json:"jobs_by_status"`
+	// Logins counts dashboard logins in the report window.
+	Logins int `json:"logins"`
+}
+
+type FleetAvailability struct {
+	Total   int `json:"total"`
+	Online  int `json:"online"`
+	Offline int `json:"offline"`
+	Unknown int `json:"unknown"`
+	// SeenThisWeek counts robots that sent a heartbeat in the report window.
+	SeenThisWeek int      `json:"seen_this_week"`
+	NotSeen      []string `json:"not_seen"`
+	// Archived robots are not in the counts above, but their jobs still
+	// show up under their names.
+	Archived int `json:"archived"`
+	// Suspends and SuspendedHours count laptops going to sleep in the
+	// report window; a sleeping laptop is offline but not down.
+	Suspends       int     `json:"suspends"`
+	SuspendedHours float64 `json:"suspended_hours"`
+}
+
+type FailingRobot struct {
+	Name   string `json:"name"`
+	Failed int    `json:"failed"`
+	Total  int    `json:"total"`
+}
+
+type StorageUsage struct {
+	Label      string `json:"label"`
+	Path       string `json:"path"`
+	UsedBytes  uint64 `json:"used_bytes"`
+	TotalBytes uint64 `json:"total_bytes"`
+	// ContentBytes is the size of the files this controller keeps there,
+	// e.g. the database or the golden images.
+	ContentBytes uint64 `json:"content_bytes"`
+}
+
+type sendReportRequest struct {
+	To []string `json:"to"`
+}
+
+type sendReportResponse struct {
+	SentTo []string `json:"sent_to"`
+}
+
+// BuildWeeklyReport collects the report for the week ending at now.
+func (c *Controller) BuildWeeklyReport(ctx context.Context, now time.Time) (WeeklyReport, error) {
+	rep := WeeklyReport{GeneratedAt: now.UTC(), Since: now.Add(-7 * 24 * time.Hour).UTC()}
+
+	robots, err := c.DB.ListAllRobots(ctx)
+	if err != nil {
+		return rep, fmt.Errorf("list robots: %w", err)
+	}
+	names := make(map[string]string, len(robots))
+	rep.Availability.NotSeen = []string{}
+	for _, r := range robots {
+		names[r.AgentID] = r.Name
+		if r.ArchivedAt != nil {
+			rep.Availability.Archived++
+			continue
+		}
+		rep.Availability.Total++
+		switch r.Status {
+		case "offline":
+			rep.Availability.Offline++
+		case "unknown":
+			rep.Availability.Unknown++
+		default:
+			rep.Availability.Online++
+		}
+		if r.LastSeen.After(rep.Since) {
+			rep.Availability.SeenThisWeek++
+		} else {
+			rep.Availability.NotSeen = append(rep.Availability.NotSeen, r.Name)
+		}
+	}
+
+	suspends, err := c.DB.ListRobotSuspends(ctx, rep.Since)
+	if err != nil {
+		return rep, fmt.Errorf("list suspends: %w", err)
+	}
+	var asleep time.Duration
+	for _, s := range suspends {
+		from := s.SuspendedAt
+		if from.Before(rep.Since) {
+			from = rep.Since
+		}
+		if s.ResumedAt.After(from) {
+			asleep += s.ResumedAt.Sub(from)
+		}
+	}
+	rep.Availability.Suspends = len(suspends)
+	rep.Availability.SuspendedHours = math.Round(asleep.Hours()*10) / 10
+
+	failing, err := c.DB.TopFailingRobots(ctx, rep.Since, rep.GeneratedAt, reportTopFailing)
+	if err != nil {
+		return rep, fmt.Errorf("count failed jobs: %w", err)
+	}
+	rep.TopFailing = []FailingRobot{}
+	for _, f := range failing {
+		name := names[f.TargetRobot]
+		if name == "" {
+			name = f.TargetRobot
+		}
+		rep.TopFailing = append(rep.TopFailing, FailingRobot{Name: name, Failed: f.Failed, Total: f.Total})
+	}
+
+	if rep.JobsByStatus, err = c.DB.CountJobsByStatus(ctx); err != nil {
+		return rep, fmt.Errorf("count jobs: %w", err)
+	}
+	if rep.Logins, err = c.DB.CountLogins(ctx, rep.Since); err != nil {
+		return rep, fmt.Errorf("count logins: %w", err)
+	}
+	rep.Storage = c.storageUsage()
+	return rep, nil
+}
+
+// storageUsage reports the database and golden image volumes.
+func (c *Controller) storageUsage() []StorageUsage {
+	var out []StorageUsage
+	if c.DB.Path != "" {
+		u := StorageUsage{Label: "database", Path: filepath.Dir(c.DB.Path)}
+		if info, err := os.Stat(c.DB.Path); err == nil {
+			u.ContentBytes = uint64(info.Size())
+		}
+		if fillDiskUsage(&u) {
+			out = append(out, u)
+		}
+	}
+	webRoot := os.Getenv("WEB_ROOT")
+	if webRoot == "" {
+		webRoot = "./web/dist"
+	}
+	u := StorageUsage{Label: "golden images", Path: filepath.Join(webRoot, "images")}
+	if entries, err := os.ReadDir(u.Path); err == nil {
+		for _, e := range entries {
+			if info, err := e.Info(); err == nil && info.Mode().IsRegular() {
+				u.ContentBytes += uint64(info.Size())
+			}
+		}
+	}
+	if fillDiskUsage(&u) {
+		out = append(out, u)
+	}
+	u = StorageUsage{Label: "ROS bags", Path: c.bagDir()}
+	u.ContentBytes = dirBytes(u.Path)
+	if fillDiskUsage(&u) {
+		out = append(out, u)
+	}
+	if out == nil {
+		out = []StorageUsage{}
+	}
+	return out
+}
+
+func fillDiskUsage(u *StorageUsage) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(u.Path, &st); err != nil {
+		return false
+	}
+	u.TotalBytes = st.Blocks * uint64(st.Bsize)
+	u.UsedBytes = u.TotalBytes - st.Bfree*uint64(st.Bsize)
+	return true
+}
+
+// Text renders the report as the plain-text email body.
+func (r WeeklyReport) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Fleet report for %s to %s\n\n", r.Since.Format("Mon 2 Jan"), r.GeneratedAt.Format("Mon 2 Jan 2006"))
+
+	a := r.Availability
+	b.WriteString("AVAILABILITY\n")
+	fmt.Fprintf(&b, "  %d robots: %d online, %d offline, %d never connected\n", a.Total, a.Online, a.Offline, a.Unknown)
+	if a.Total > 0 {
+		fmt.Fprintf(&b, "  %d of %d (%.0f%%) checked in during the week\n", a.SeenThisWeek, a.Total, 100*float64(a.SeenThisWeek)/float64(a.Total))
+	}
+	if len(a.NotSeen) > 0 {
+		fmt.Fprintf(&b, "  Not seen this week: %s\n", strings.Join(a.NotSeen, ", "))
+	}
+	if a.Archived > 0 {
+		fmt.Fprintf(&b, "  %d archived robots not counted\n", a.Archived)
+	}
+	if a.Suspends > 0 {
+		fmt.Fprintf(&b, "  Laptops slept %d times, %.1f hours in all\n", a.Suspends, a.SuspendedHours)
+	}
+	fmt.Fprintf(&b, "  %d dashboard logins\n", r.Logins)
+
+	b.WriteString("\nTOP FAILING ROBOTS\n")
+	if len(r.TopFailing) == 0 {
+		b.WriteString("  No failed jobs this week.\n")
+	}
+	for _, f := range r.TopFailing {
+		fmt.Fprintf(&b, "  %-20s %d of %d jobs failed\n", f.Name, f.Failed, f.Total)
+	}
+
+	b.WriteString("\nJOBS (ALL TIME)\n")
+	statuses := make([]string, 0, len(r.JobsByStatus))
+	for s := range r.JobsByStatus {
+		statuses = append(statuses, s)
+	}
+	sort.Strings(statuses)
+	if len(statuses) == 0 {
+		b.WriteString("  No jobs yet.\n")
+	}
+	for _, s := range statuses {
+		fmt.Fprintf(&b, "  %-10s %d\n", s, r.JobsByStatus[s])
+	}
+
+	b.WriteString("\nSTORAGE\n")
+	for _, s := range r.Storage {
+		pct := 0.0
+		if s.TotalBytes > 0 {
+			pct = 100 * float64(s.UsedBytes) / float64(s.TotalBytes)
+		}
+		fmt.Fprintf(&b, "  %-14s %s used of %s (%.0f%%), %s in %s\n", s.Label, formatBytes(s.UsedBytes), formatBytes(s.TotalBytes), pct, formatBytes(s.ContentBytes), s.Path)
+	}
+	return b.String()
+}
+
+func (c *Controller) sendWeeklyReport(ctx context.Context, to []string) error {
+	rep, err := c.BuildWeeklyReport(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	subject := "OpenRobotFleet weekly report - " + rep.GeneratedAt.Format("2 Jan 2006")
+	return mail.ConfigFromEnv().Send(to, subject, rep.Text())
+}
+
+// RunWeeklyReports emails the weekly report to REPORT_RECIPIENTS on the
+// configured weekday and hour (controller local time) until ctx is done.
+func (c *Controller) RunWeeklyReports(ctx context.Context) {
+	cfg := reportConfigFromEnv()
+	if len(cfg.recipients) == 0 || !mail.ConfigFromEnv().Enabled() {
+		return
+	}
+	slog.Info("weekly reports enabled", "weekday", cfg.weekday.String(), "hour", cfg.hour, "recipients", len(cfg.recipients))
+	ticker := time.NewTicker(reportCheckInterval)
+	defer ticker.Stop()
+	for {
+		c.maybeSendWeeklyReport(ctx, cfg, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Controller) maybeSendWeeklyReport(ctx context.Context, cfg reportConfig, now time.Time) {
+	if now.Weekday() != cfg.weekday || now.Hour() < cfg.hour {
+		return
+	}
+	today := now.Format("2006-01-02")
+	last, err := c.DB.GetSetting(ctx, reportLastSentKey)
+	if err != nil {
+		slog.Error("weekly report: read last sent", "err", err)
+		return
+	}
+	if last == today {
+		return
+	}
+	if err := c.sendWeeklyReport(ctx, cfg.recipients); err != nil {
+		slog.Error("weekly report: send failed", "err", err)
+		return
+	}
+	if err := c.DB.SaveSetting(ctx, reportLastSentKey, today); err != nil {
+		slog.Error("weekly report: save last sent", "err", err)
+	}
+	slog.Info("weekly report sent", "recipients", len(cfg.recipients))
+}
+
+// GetWeeklyReport returns the report as it would be emailed now.
+func (c *Controller) GetWeeklyReport(w http.ResponseWriter, r *http.Request) {
+	rep, err := c.BuildWeeklyReport(r.Context(), time.Now())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("build weekly report", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to build report")
+		return
+	}
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(rep.Text()))
+		return
+	}
+	respondJSON(w, http.StatusOK, rep)
+}
+
+// SendWeeklyReport emails the report immediately, to the addresses in the
+// request or to REPORT_RECIPIENTS.
+func (c *Controller) SendWeeklyReport(w http.ResponseWriter, r *http.Request) {
+	var req sendReportRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid payload")
+			return
+		}
+	}
+	to := req.To
+	if len(to) == 0 {
+		to = reportConfigFromEnv().recipients
+	}
+	if len(to) == 0 {
+		respondError(w, http.StatusBadRequest, "no recipients; set REPORT_RECIPIENTS or pass \"to\"")
+		return
+	}
+	if !mail.ConfigFromEnv().Enabled() {
+		respondError(w, http.StatusServiceUnavailable, "SMTP is not configured")
+		return
+	}
+	if err := c.sendWeeklyReport(r.Context(), to); err != nil {
+		logging.FromContext(r.Context()).Error("send weekly report", "err", err)
+		respondError(w, http.StatusBadGateway, "failed to send report: "+err.Error())
+		return
+	}
+	c.audit(r.Context(), "report.send", "weekly", strings.Join(to, ", "))
+	respondJSON(w, http.StatusOK, sendReportResponse{SentTo: to})
+}
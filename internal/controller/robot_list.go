@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"example.com/openrobot-fleet/internal/db"
+)
+
+// robotListQuery holds the filters and paging of GET /api/robots. Status,
+// type and tag take comma-separated values and match any of them; q is a
+// case-insensitive substring of the name, agent ID or notes. Archived robots
+// are left out unless archived is "include" or "only".
+type robotListQuery struct {
+	statuses []string
+	types    []string
+	tags     []string
+	search   string
+	archived string
+	limit    int
+	offset   int
+	// fields lists the JSON fields to return, or nil for all of them.
+	fields []string
+}
+
+// robotFields are the JSON names of db.Robot, which ?fields= chooses from.
+var robotFields = func() []string {
+	var names []string
+	t := reflect.TypeOf(db.Robot{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		names = append(names, name)
+	}
+	return names
+}()
+
+func parseRobotListQuery(q url.Values) (robotListQuery, error) {
+	lq := robotListQuery{
+		statuses: splitList(q.Get("status")),
+		types:    splitList(q.Get("type")),
+		tags:     splitList(q.Get("tag")),
+		search:   strings.ToLower(strings.TrimSpace(q.Get("q"))),
+		archived: q.Get("archived"),
+		fields:   splitList(q.Get("fields")),
+	}
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"limit", &lq.limit}, {"offset", &lq.offset}} {
+		if v := q.Get(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return lq, fmt.Errorf("%s must be a non-negative integer", p.name)
+			}
+			*p.dst = n
+		}
+	}
+	switch lq.archived {
+	case "", "include", "only":
+	default:
+		return lq, fmt.Errorf("archived must be include or only")
+	}
+	for _, f := range lq.fields {
+		if !slices.Contains(robotFields, f) {
+			return lq, fmt.Errorf("unknown field %q (fields: %s)", f, strings.Join(robotFields, ", "))
+		}
+	}
+	return lq, nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func (q robotListQuery) match(r db.Robot) bool {
+	if len(q.statuses) > 0 {
+		online := r.Status != "offline" && r.Status != "unknown"
+		if !slices.Contains(q.statuses, r.Status) && !(online && slices.Contains(q.statuses, "online")) {
+			return false
+		}
+	}
+	if len(q.types) > 0 && !slices.Contains(q.types, r.Type) {
+		return false
+	}
+	if len(q.tags) > 0 && !slices.ContainsFunc(r.Tags, func(t string) bool { return slices.Contains(q.tags, t) }) {
+		return false
+	}
+	if q.search != "" {
+		hay := strings.ToLower(r.Name + "\n" + r.AgentID + "\n" + r.Notes)
+		if !strings.Contains(hay, q.search) {
+			return false
+		}
+	}
+	return true
+}
+
+// list loads the robots the archived option asks for, through the robot list
+// cache.
+func (q robotListQuery) list(ctx context.Context, d *db.DB) ([]db.Robot, error) {
+	return d.CachedRobotList(ctx, q.archived)
+}
+
+// page applies offset and limit (0 means no limit).
+func (q robotListQuery) page(robots []db.Robot) []db.Robot {
+	if q.offset >= len(robots) {
+		return []db.Robot{}
+	}
+	robots = robots[q.offset:]
+	if q.limit > 0 && q.limit < len(robots) {
+		robots = robots[:q.limit]
+	}
+	return robots
+}
+
+// wantsSecrets reports whether install_config was asked for by name, the only
+// way the list returns SSH keys and passwords.
+func (q robotListQuery) wantsSecrets() bool {
+	return slices.Contains(q.fields, "install_config")
+}
+
+// redactInstallConfig blanks the SSH key, its passphrase and the password but
+// keeps the address and user, which the dashboard shows.
+func redactInstallConfig(r *db.Robot) {
+	if r.InstallConfig == nil {
+		return
+	}
+	cfg := *r.InstallConfig
+	cfg.SSHKey, cfg.Password, cfg.KeyPassphrase = "", "", ""
+	r.InstallConfig = &cfg
+}
+
+// project keeps only the requested fields of each robot.
+func (q robotListQuery) project(robots []db.Robot) ([]map[string]json.RawMessage, error) {
+	out := make([]map[string]json.RawMessage, 0, len(robots))
+	for _, r := range robots {
+		raw, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &all); err != nil {
+			return nil, err
+		}
+		m := make(map[string]json.RawMessage, len(q.fields))
+		for _, f := range q.fields {
+			if v, ok := all[f]; ok {
+				m[f] = v
+			}
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
@@ -4,31 +4,224 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"maps"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"example.com/openrobot-fleet/internal/agent"
 	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+	"example.com/openrobot-fleet/internal/selector"
 )
 
 type commandRequest struct {
 	Type string          `json:"type"`
 	Data json.RawMessage `json:"data"`
+	// Priority overrides the default for the command type: critical,
+	// interactive or batch.
+	Priority string `json:"priority,omitempty"`
+	// RunAtBoot has the agent keep the command and run it after the robot
+	// next reboots.
+	RunAtBoot bool `json:"run_at_boot,omitempty"`
 }
 
+// selectorCommandRequest sends one command to every robot a selector matches.
+type selectorCommandRequest struct {
+	commandRequest
+	Selector string `json:"selector"`
+}
+
+type selectorCommandResponse struct {
+	Jobs []db.Job `json:"jobs"`
+	// Skipped names matched robots that have no agent to send to.
+	Skipped []string `json:"skipped"`
+}
+
+type tagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+type nameRequest struct {
+	Name string `json:"name"`
+}
+
+// robotPatchRequest edits a robot in place. Omitted fields are unchanged.
+type robotPatchRequest struct {
+	Name  *string `json:"name,omitempty"`
+	Notes *string `json:"notes,omitempty"`
+	Type  *string `json:"type,omitempty"`
+	// ROSContainer names the Docker container to run ROS commands in; an
+	// empty string runs them on the host.
+	ROSContainer *string `json:"ros_container,omitempty"`
+}
+
+// createRobotRequest adds a robot by hand, without installing an agent.
+type createRobotRequest struct {
+	Name string `json:"name"`
+	// Type is robot (default) or laptop.
+	Type  string   `json:"type,omitempty"`
+	IP    string   `json:"ip,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+	Notes string   `json:"notes,omitempty"`
+}
+
+// containerName matches Docker container names.
+var containerName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
 func (c *Controller) ListRobots(w http.ResponseWriter, r *http.Request) {
-	robots, err := c.DB.ListRobots(r.Context())
+	sel, err := parseSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid selector: "+err.Error())
+		return
+	}
+	q, err := parseRobotListQuery(r.URL.Query())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if q.wantsSecrets() && !isAdmin(r.Context()) {
+		respondError(w, http.StatusForbidden, "install_config is only returned to the admin")
+		return
+	}
+	robots, err := q.list(r.Context(), c.DB)
 	if err != nil {
-		log.Printf("list robots: %v", err)
+		logging.FromContext(r.Context()).Error("list robots", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to list robots")
 		return
 	}
-	respondJSON(w, http.StatusOK, robots)
+	if sel != nil {
+		robots = sel.Filter(robots)
+	}
+	matched := []db.Robot{}
+	for _, robot := range robots {
+		if q.match(robot) {
+			if !q.wantsSecrets() {
+				redactInstallConfig(&robot)
+			}
+			matched = append(matched, robot)
+		}
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(matched)))
+	matched = q.page(matched)
+	if q.fields == nil {
+		respondJSON(w, http.StatusOK, matched)
+		return
+	}
+	projected, err := q.project(matched)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("project robots", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to list robots")
+		return
+	}
+	respondJSON(w, http.StatusOK, projected)
+}
+
+// CreateRobot records a robot that was provisioned by hand. It is unmanaged,
+// and can't take commands, until an agent heartbeats under its name or from
+// its IP and is linked to it.
+func (c *Controller) CreateRobot(w http.ResponseWriter, r *http.Request) {
+	var req createRobotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.IP = strings.TrimSpace(req.IP)
+	switch {
+	case req.Name == "":
+		respondError(w, http.StatusBadRequest, "name is required")
+		return
+	case strings.ContainsAny(req.Name, " \t\n/+#"):
+		// The name becomes the agent ID, which is part of MQTT topics.
+		respondError(w, http.StatusBadRequest, "name must not contain spaces, /, + or #")
+		return
+	case req.Type != "" && req.Type != "robot" && req.Type != "laptop":
+		respondError(w, http.StatusBadRequest, "type must be robot or laptop")
+		return
+	case req.IP != "" && net.ParseIP(req.IP) == nil:
+		respondError(w, http.StatusBadRequest, "ip is not a valid IP address")
+		return
+	}
+	tags := make([]string, 0, len(req.Tags))
+	for _, tag := range req.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || strings.Contains(tag, ",") {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid tag %q", tag))
+			return
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	if msg, err := c.renameConflict(r.Context(), 0, req.Name); err != nil {
+		logging.FromContext(r.Context()).Error("check robot name", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to check robot name")
+		return
+	} else if msg != "" {
+		respondError(w, http.StatusConflict, msg)
+		return
+	}
+	if msg := c.usageLimitReached(r.Context(), "robots"); msg != "" {
+		respondError(w, http.StatusForbidden, msg)
+		return
+	}
+	id, err := c.DB.CreateUnmanagedRobot(r.Context(), db.NewRobot{Name: req.Name, Type: req.Type, IP: req.IP, Tags: tags, Notes: req.Notes})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("create robot", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to create robot")
+		return
+	}
+	c.audit(r.Context(), "robot.create", req.Name, "unmanaged")
+	robot, err := c.DB.GetRobotByID(r.Context(), id)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("get robot", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to fetch robot")
+		return
+	}
+	redactInstallConfig(&robot)
+	respondJSON(w, http.StatusCreated, robot)
+}
+
+// parseSelector parses an optional selector; it returns nil when expr is
+// blank.
+func parseSelector(expr string) (*selector.Selector, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	return selector.Parse(expr)
+}
+
+// mergeSelected appends the IDs of robots matching sel to ids, skipping any
+// already listed, so requests can name robots both ways.
+func (c *Controller) mergeSelected(ctx context.Context, ids []int64, sel *selector.Selector) ([]int64, error) {
+	if sel == nil {
+		return ids, nil
+	}
+	robots, err := c.DB.ListRobots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+	for _, r := range sel.Filter(robots) {
+		if !seen[r.ID] {
+			seen[r.ID] = true
+			ids = append(ids, r.ID)
+		}
+	}
+	return ids, nil
 }
 
 func (c *Controller) GetRobot(w http.ResponseWriter, r *http.Request) {
@@ -43,7 +236,7 @@ func (c *Controller) GetRobot(w http.ResponseWriter, r *http.Request) {
 			respondError(w, http.StatusNotFound, "robot not found")
 			return
 		}
-		log.Printf("get robot: %v", err)
+		logging.FromContext(r.Context()).Error("get robot", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to fetch robot")
 		return
 	}
@@ -62,7 +255,7 @@ func (c *Controller) RobotCommand(w http.ResponseWriter, r *http.Request) {
 			respondError(w, http.StatusNotFound, "robot not found")
 			return
 		}
-		log.Printf("fetch robot for command: %v", err)
+		logging.FromContext(r.Context()).Error("fetch robot for command", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to fetch robot")
 		return
 	}
@@ -81,33 +274,108 @@ func (c *Controller) RobotCommand(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if req.Type == "identify" {
-		var data map[string]interface{}
-		if len(req.Data) > 0 {
-			if err := json.Unmarshal(req.Data, &data); err != nil {
-				data = make(map[string]interface{})
-			}
-		} else {
-			data = make(map[string]interface{})
-		}
-		data["id"] = fmt.Sprintf("%d", robot.ID)
-		data["name"] = robot.Name
-		data["ip"] = robot.IP
-		data["url"] = fmt.Sprintf("http://%s/identify?id=%d&name=%s&ip=%s", r.Host, robot.ID, url.QueryEscape(robot.Name), url.QueryEscape(robot.IP))
-
-		newData, _ := json.Marshal(data)
-		req.Data = newData
+		req.Data = identifyData(r.Host, robot, req.Data)
 	}
 
-	cmd := agent.Command{Type: req.Type, Data: req.Data}
+	if !agent.ValidPriority(req.Priority) {
+		respondError(w, http.StatusBadRequest, "priority must be critical, interactive or batch")
+		return
+	}
+	cmd := agent.Command{Type: req.Type, Data: req.Data, Priority: req.Priority, RunAtBoot: req.RunAtBoot}
 	job, err := c.queueRobotCommand(r.Context(), robot, cmd)
+	if errors.Is(err, errPayloadKeyMissing) || errors.Is(err, db.ErrRobotArchived) {
+		respondError(w, http.StatusConflict, err.Error())
+		return
+	}
 	if err != nil {
-		log.Printf("queue command: %v", err)
+		logging.FromContext(r.Context()).Error("queue command", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to queue command")
 		return
 	}
 	respondJSON(w, http.StatusCreated, job)
 }
 
+// identifyData adds the robot's details and identify page URL to an identify
+// command.
+func identifyData(host string, robot db.Robot, raw json.RawMessage) json.RawMessage {
+	var data map[string]interface{}
+	if len(raw) > 0 {
+		_ = json.Unmarshal(raw, &data)
+	}
+	// Missing, null or non-object data all start from an empty object.
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	data["id"] = fmt.Sprintf("%d", robot.ID)
+	data["name"] = robot.Name
+	data["ip"] = robot.IP
+	data["url"] = fmt.Sprintf("http://%s/identify?id=%d&name=%s&ip=%s", host, robot.ID, url.QueryEscape(robot.Name), url.QueryEscape(robot.IP))
+
+	newData, _ := json.Marshal(data)
+	return newData
+}
+
+// SelectorCommand queues a command for each robot matching a selector, e.g.
+// {"selector": "tag in (classA, classB)", "type": "restart_ros"}.
+func (c *Controller) SelectorCommand(w http.ResponseWriter, r *http.Request) {
+	var req selectorCommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid command payload")
+		return
+	}
+	if req.Type == "" {
+		respondError(w, http.StatusBadRequest, "command type required")
+		return
+	}
+	if !agent.ValidPriority(req.Priority) {
+		respondError(w, http.StatusBadRequest, "priority must be critical, interactive or batch")
+		return
+	}
+	sel, err := parseSelector(req.Selector)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid selector: "+err.Error())
+		return
+	}
+	if sel == nil {
+		respondError(w, http.StatusBadRequest, "selector required")
+		return
+	}
+	robots, err := c.DB.ListRobots(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list robots for command", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to list robots")
+		return
+	}
+	matched := sel.Filter(robots)
+	if len(matched) == 0 {
+		respondError(w, http.StatusBadRequest, "selector matched no robots")
+		return
+	}
+	resp := selectorCommandResponse{Jobs: []db.Job{}, Skipped: []string{}}
+	for _, robot := range matched {
+		if robot.AgentID == "" {
+			resp.Skipped = append(resp.Skipped, robot.Name)
+			continue
+		}
+		cmd := agent.Command{Type: req.Type, Data: req.Data, Priority: req.Priority, RunAtBoot: req.RunAtBoot}
+		if req.Type == "identify" {
+			cmd.Data = identifyData(r.Host, robot, req.Data)
+		}
+		job, err := c.queueRobotCommand(r.Context(), robot, cmd)
+		if errors.Is(err, errPayloadKeyMissing) {
+			respondError(w, http.StatusConflict, robot.Name+": "+err.Error())
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("queue command", "robot", robot.Name, "err", err)
+			respondError(w, http.StatusInternalServerError, "failed to queue command")
+			return
+		}
+		resp.Jobs = append(resp.Jobs, job)
+	}
+	respondJSON(w, http.StatusCreated, resp)
+}
+
 func (c *Controller) BroadcastCommand(w http.ResponseWriter, r *http.Request) {
 	var req commandRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -118,10 +386,27 @@ func (c *Controller) BroadcastCommand(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "command type required")
 		return
 	}
-	cmd := agent.Command{Type: req.Type, Data: req.Data}
+	if !agent.ValidPriority(req.Priority) {
+		respondError(w, http.StatusBadRequest, "priority must be critical, interactive or batch")
+		return
+	}
+	priority := req.Priority
+	if priority == "" {
+		priority = agent.DefaultPriority(req.Type)
+	}
+	cmd := agent.Command{Type: req.Type, Data: req.Data, CorrelationID: correlationID(r.Context()), Priority: priority, RunAtBoot: req.RunAtBoot}
+	// A broadcast goes to every robot on one topic, so it can't be sealed
+	// with per-robot keys.
+	if agent.SensitiveCommand(cmd) {
+		if payloadEncryptionRequired() {
+			respondError(w, http.StatusBadRequest, req.Type+" carries secrets and can't be broadcast encrypted; send it with a selector instead")
+			return
+		}
+		logging.FromContext(r.Context()).Warn("broadcasting sensitive command unencrypted", "type", req.Type)
+	}
 	payload, err := json.Marshal(cmd)
 	if err != nil {
-		log.Printf("marshal broadcast: %v", err)
+		logging.FromContext(r.Context()).Error("marshal broadcast", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to encode command")
 		return
 	}
@@ -131,12 +416,14 @@ func (c *Controller) BroadcastCommand(w http.ResponseWriter, r *http.Request) {
 		TargetRobot: "all",
 		PayloadJSON: string(payload),
 		Status:      "queued",
+		Priority:    priority,
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
+	attributeJob(r.Context(), &job)
 	jobID, err := c.DB.CreateJob(r.Context(), job)
 	if err != nil {
-		log.Printf("create broadcast job: %v", err)
+		logging.FromContext(r.Context()).Error("create broadcast job", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to create job")
 		return
 	}
@@ -146,8 +433,9 @@ func (c *Controller) BroadcastCommand(w http.ResponseWriter, r *http.Request) {
 	cmd.ID = fmt.Sprintf("%d", jobID)
 	payload, _ = json.Marshal(cmd)
 
-	log.Printf("broadcast command %s queued to lab/commands/all", req.Type)
-	c.MQTT.Publish("lab/commands/all", 1, true, payload)
+	logging.FromContext(r.Context()).Info("broadcast command queued", "type", req.Type, "job_id", jobID, "correlation_id", cmd.CorrelationID)
+	c.MQTT.Publish("lab/commands/all", 1, agent.RetainCommand(cmd), payload)
+	c.audit(r.Context(), "command."+req.Type, "all", fmt.Sprintf("job %d", jobID))
 	respondJSON(w, http.StatusCreated, job)
 }
 
@@ -168,7 +456,7 @@ func (c *Controller) UpdateInstallConfig(w http.ResponseWriter, r *http.Request)
 	}
 	cfg := req.toInstallConfig()
 	if err := c.DB.UpdateRobotInstallConfigByID(r.Context(), robotID, cfg); err != nil {
-		log.Printf("update install config: %v", err)
+		logging.FromContext(r.Context()).Error("update install config", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to save install config")
 		return
 	}
@@ -178,7 +466,7 @@ func (c *Controller) UpdateInstallConfig(w http.ResponseWriter, r *http.Request)
 			respondError(w, http.StatusNotFound, "robot not found")
 			return
 		}
-		log.Printf("fetch robot after install config update: %v", err)
+		logging.FromContext(r.Context()).Error("fetch robot after install config update", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to fetch robot")
 		return
 	}
@@ -206,16 +494,14 @@ func (c *Controller) UpdateRobotTags(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	var req struct {
-		Tags []string `json:"tags"`
-	}
+	var req tagsRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "invalid payload")
 		return
 	}
 
 	if err := c.DB.UpdateRobotTags(r.Context(), id, req.Tags); err != nil {
-		log.Printf("update tags: %v", err)
+		logging.FromContext(r.Context()).Error("update tags", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to update tags")
 		return
 	}
@@ -229,21 +515,138 @@ func (c *Controller) UpdateRobotTags(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, robot)
 }
 
+// DeleteRobot archives a robot, or with ?purge=true deletes it and its
+// history for good.
 func (c *Controller) DeleteRobot(w http.ResponseWriter, r *http.Request) {
 	id, err := parseIDFromPath(r.URL.Path, "/api/robots/")
 	if err != nil {
 		respondError(w, http.StatusBadRequest, "invalid robot id")
 		return
 	}
-	if err := c.DB.DeleteRobot(r.Context(), id); err != nil {
-		log.Printf("delete robot: %v", err)
+	purge, _ := strconv.ParseBool(r.URL.Query().Get("purge"))
+	rep, err := c.deleteRobot(r.Context(), id, purge)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(w, http.StatusNotFound, "robot not found")
+			return
+		}
+		if errors.Is(err, db.ErrRobotArchived) {
+			respondError(w, http.StatusConflict, "robot is already archived; delete with purge=true to remove it for good")
+			return
+		}
+		logging.FromContext(r.Context()).Error("delete robot", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to delete robot")
 		return
 	}
-	w.WriteHeader(http.StatusNoContent)
+	respondJSON(w, http.StatusOK, rep)
+}
+
+// deleteRobot archives robot id (see db.ArchiveRobot) or, with purge, deletes
+// it with everything that refers to it (db.DeleteRobotCascade). Either way it
+// stops tracking the robot's heartbeats and clears the retained command on
+// its MQTT topic; a purge also removes its camera snapshots.
+func (c *Controller) deleteRobot(ctx context.Context, id int64, purge bool) (db.RobotDeletion, error) {
+	var rep db.RobotDeletion
+	var err error
+	if purge {
+		rep, err = c.DB.DeleteRobotCascade(ctx, id)
+	} else {
+		rep, err = c.DB.ArchiveRobot(ctx, id)
+	}
+	if err != nil {
+		return rep, err
+	}
+	c.heartbeats.forget(id)
+	if rep.AgentID != "" {
+		// An empty retained message clears the broker's copy, so a
+		// re-enrolled agent with the same ID doesn't replay it.
+		c.MQTT.Publish(fmt.Sprintf("lab/commands/%s", rep.AgentID), 1, true, []byte{})
+	}
+	if _, err := os.Stat(snapshotPath(id)); err == nil {
+		if !purge {
+			rep.Retained["snapshot"] = 1
+		} else if err := os.Remove(snapshotPath(id)); err != nil {
+			logging.FromContext(ctx).Warn("remove robot snapshot", "robot", rep.Name, "err", err)
+		} else {
+			rep.Removed["snapshot"] = 1
+		}
+	}
+	if purge {
+		if err := os.RemoveAll(filepath.Dir(snapshotFile(id, 0))); err != nil {
+			logging.FromContext(ctx).Warn("remove robot snapshot history", "robot", rep.Name, "err", err)
+		}
+	}
+	logging.FromContext(ctx).Info("robot deleted", "robot", rep.Name, "archived", rep.Archived, "removed", rep.Removed, "retained", rep.Retained)
+	action := "robot.delete"
+	if rep.Archived {
+		action = "robot.archive"
+	}
+	c.audit(ctx, action, rep.Name, deletionSummary(rep))
+	return rep, nil
+}
+
+func deletionSummary(rep db.RobotDeletion) string {
+	summary := "deleted"
+	if rep.Archived {
+		summary = "archived"
+	}
+	for _, table := range slices.Sorted(maps.Keys(rep.Removed)) {
+		if table != "robots" && rep.Removed[table] > 0 {
+			summary += fmt.Sprintf(", %d %s removed", rep.Removed[table], table)
+		}
+	}
+	return summary
+}
+
+// RestoreRobot brings an archived robot back into the fleet.
+func (c *Controller) RestoreRobot(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDFromPath(strings.TrimSuffix(r.URL.Path, "/restore"), "/api/robots/")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid robot id")
+		return
+	}
+	robot, err := c.DB.RestoreRobot(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(w, http.StatusNotFound, "robot not found")
+			return
+		}
+		if errors.Is(err, db.ErrRobotNotArchived) {
+			respondError(w, http.StatusConflict, err.Error())
+			return
+		}
+		logging.FromContext(r.Context()).Error("restore robot", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to restore robot")
+		return
+	}
+	c.audit(r.Context(), "robot.restore", robot.Name, "")
+	respondJSON(w, http.StatusOK, robot)
+}
+
+// ListArchivedRobots returns archived robots, most recently archived first.
+func (c *Controller) ListArchivedRobots(w http.ResponseWriter, r *http.Request) {
+	robots, err := c.DB.ListArchivedRobots(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list archived robots", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to list archived robots")
+		return
+	}
+	respondJSON(w, http.StatusOK, robots)
 }
 
 func (c *Controller) queueRobotCommand(ctx context.Context, robot db.Robot, cmd agent.Command) (db.Job, error) {
+	if cmd.CorrelationID == "" {
+		cmd.CorrelationID = correlationID(ctx)
+	}
+	if cmd.Priority == "" {
+		cmd.Priority = agent.DefaultPriority(cmd.Type)
+	}
+	if robot.ArchivedAt != nil {
+		return db.Job{}, db.ErrRobotArchived
+	}
+	if err := c.sealSensitive(ctx, robot, &cmd); err != nil {
+		return db.Job{}, err
+	}
 	payload, err := json.Marshal(cmd)
 	if err != nil {
 		return db.Job{}, fmt.Errorf("marshal command: %w", err)
@@ -254,9 +657,12 @@ func (c *Controller) queueRobotCommand(ctx context.Context, robot db.Robot, cmd
 		TargetRobot: robot.AgentID,
 		PayloadJSON: string(payload),
 		Status:      "queued",
+		Priority:    cmd.Priority,
 		CreatedAt:   now,
 		UpdatedAt:   now,
+		Steps:       pendingSteps(cmd),
 	}
+	attributeJob(ctx, &job)
 	jobID, err := c.DB.CreateJob(ctx, job)
 	if err != nil {
 		return db.Job{}, fmt.Errorf("create job: %w", err)
@@ -268,26 +674,48 @@ func (c *Controller) queueRobotCommand(ctx context.Context, robot db.Robot, cmd
 	payload, _ = json.Marshal(cmd)
 
 	topic := fmt.Sprintf("lab/commands/%s", robot.AgentID)
-	log.Printf("command %s queued for robot %s (agent %s) topic %s", cmd.Type, robot.Name, robot.AgentID, topic)
-	c.MQTT.Publish(topic, 1, true, payload)
+	logging.FromContext(ctx).Info("command queued", "type", cmd.Type, "priority", cmd.Priority, "robot", robot.Name, "agent_id", robot.AgentID, "topic", topic, "job_id", jobID, "correlation_id", cmd.CorrelationID)
+	c.MQTT.Publish(topic, 1, agent.RetainCommand(cmd), payload)
+	c.audit(ctx, "command."+cmd.Type, robot.AgentID, fmt.Sprintf("job %d", jobID))
 	return job, nil
 }
 
+// pendingSteps lists the steps of a batch command, none of them run yet, so
+// the job shows its pipeline before the agent reports progress.
+func pendingSteps(cmd agent.Command) []db.JobStep {
+	if cmd.Type != "batch" {
+		return nil
+	}
+	var batch agent.BatchData
+	if err := json.Unmarshal(cmd.Data, &batch); err != nil {
+		return nil
+	}
+	steps := make([]db.JobStep, len(batch.Commands))
+	for i, sub := range batch.Commands {
+		steps[i] = db.JobStep{Name: sub.Type, Type: sub.Type, Status: "pending"}
+		if i < len(batch.Steps) && batch.Steps[i].Name != "" {
+			steps[i].Name = batch.Steps[i].Name
+		}
+	}
+	return steps
+}
+
 func (c *Controller) IdentifyAll(w http.ResponseWriter, r *http.Request) {
 	robots, err := c.DB.ListRobots(r.Context())
 	if err != nil {
-		log.Printf("list robots: %v", err)
+		logging.FromContext(r.Context()).Error("list robots", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to list robots")
 		return
 	}
 
-	assignments := make(map[int64]string)
-	for i, robot := range robots {
+	assignments := make(map[int64]identifyAssignment)
+	for _, robot := range robots {
 		if robot.AgentID == "" {
 			continue
 		}
-		pattern := generatePattern(i)
-		assignments[robot.ID] = pattern
+		assignment := identifyPattern(len(assignments))
+		assignments[robot.ID] = assignment
+		pattern := assignment.Pattern
 
 		// Send command directly via MQTT (ephemeral, no DB job needed)
 		cmd := agent.Command{
@@ -310,38 +738,50 @@ func (c *Controller) IdentifyAll(w http.ResponseWriter, r *http.Request) {
 
 		payload, _ := json.Marshal(cmd)
 		topic := fmt.Sprintf("lab/commands/%s", robot.AgentID)
-		c.MQTT.Publish(topic, 1, true, payload)
+		c.MQTT.Publish(topic, 1, agent.RetainCommand(cmd), payload)
 	}
 	respondJSON(w, http.StatusOK, assignments)
 }
 
-func generatePattern(index int) string {
-	// Generate a 10-step pattern (2 seconds)
-	// 0=off, g=green, r=red, b=both
-	// We want distinct patterns.
-	// Strategy: Use binary representation of index?
-	// Or just a set of presets.
-
-	presets := []string{
-		"g0g0g0g0g0", // 0: Fast Green
-		"r0r0r0r0r0", // 1: Fast Red
-		"gggg000000", // 2: Slow Green
-		"rrrr000000", // 3: Slow Red
-		"grgrgrgrgr", // 4: Alternating
-		"gg00rr00gg", // 5: Mixed
-		"b0b0b0b0b0", // 6: Fast Both
-		"bbbb000000", // 7: Slow Both
-		"g000g000g0", // 8: Heartbeat Green
-		"r000r000r0", // 9: Heartbeat Red
-	}
-
-	if index < len(presets) {
-		return presets[index]
-	}
+// identifyAssignment is the LED pattern a robot flashes for identify-all.
+type identifyAssignment struct {
+	Pattern     string `json:"pattern"`
+	Description string `json:"description"`
+}
 
-	// Fallback for >10 robots: generate based on index
-	// e.g. just random or simple
-	return "b0b0b0b0b0"
+var flashColors = []struct {
+	step byte
+	name string
+}{{'g', "green"}, {'r', "red"}, {'b', "green+red"}}
+
+// identifyPattern returns the index'th identify pattern and a description of
+// it. A pattern is a run of flashes, one 200 ms step each with a step off
+// between them, then a longer pause that marks where it starts again. Each
+// flash is green, red or both at once, so there are 3 one-flash patterns, 9
+// two-flash patterns and so on; the simplest go first, and no two indexes
+// share a pattern however large the fleet.
+func identifyPattern(index int) identifyAssignment {
+	flashes, count := 1, len(flashColors)
+	for index >= count {
+		index -= count
+		flashes++
+		count *= len(flashColors)
+	}
+	steps := make([]byte, 2*flashes+2)
+	names := make([]string, flashes)
+	for i := flashes - 1; i >= 0; i-- {
+		color := flashColors[index%len(flashColors)]
+		index /= len(flashColors)
+		steps[2*i], steps[2*i+1] = color.step, '0'
+		names[i] = color.name
+	}
+	steps[2*flashes], steps[2*flashes+1] = '0', '0'
+
+	desc := "1 flash: " + names[0]
+	if flashes > 1 {
+		desc = fmt.Sprintf("%d flashes: %s", flashes, strings.Join(names, ", "))
+	}
+	return identifyAssignment{Pattern: string(steps), Description: desc}
 }
 
 func (c *Controller) UpdateRobotName(w http.ResponseWriter, r *http.Request) {
@@ -357,9 +797,7 @@ func (c *Controller) UpdateRobotName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req struct {
-		Name string `json:"name"`
-	}
+	var req nameRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "invalid request body")
 		return
@@ -376,8 +814,19 @@ func (c *Controller) UpdateRobotName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if oldRobot.Name != req.Name {
+		if msg, err := c.renameConflict(r.Context(), id, req.Name); err != nil {
+			logging.FromContext(r.Context()).Error("check robot name", "err", err)
+			respondError(w, http.StatusInternalServerError, "failed to check robot name")
+			return
+		} else if msg != "" {
+			respondError(w, http.StatusConflict, msg)
+			return
+		}
+	}
+
 	if err := c.DB.UpdateRobotName(r.Context(), id, req.Name); err != nil {
-		log.Printf("update robot name: %v", err)
+		logging.FromContext(r.Context()).Error("update robot name", "err", err)
 		if strings.Contains(err.Error(), "UNIQUE constraint failed") || strings.Contains(err.Error(), "constraint failed") {
 			respondError(w, http.StatusConflict, "name already taken")
 			return
@@ -409,3 +858,143 @@ func (c *Controller) UpdateRobotName(w http.ResponseWriter, r *http.Request) {
 	}
 	respondJSON(w, http.StatusOK, robot)
 }
+
+// PatchRobot edits a robot's name, notes and type. A new name becomes the
+// agent's ID once it restarts, so it must not collide with another robot's
+// name or agent ID. Name and type changes are pushed to the agent with a
+// configure_agent command, since its heartbeat would otherwise revert them.
+func (c *Controller) PatchRobot(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDFromPath(r.URL.Path, "/api/robots/")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid robot id")
+		return
+	}
+	var req robotPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	robot, err := c.DB.GetRobotByID(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(w, http.StatusNotFound, "robot not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("get robot", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to fetch robot")
+		return
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			respondError(w, http.StatusBadRequest, "name cannot be empty")
+			return
+		}
+		if name == robot.Name {
+			req.Name = nil
+		} else {
+			if msg, err := c.renameConflict(r.Context(), id, name); err != nil {
+				logging.FromContext(r.Context()).Error("check robot name", "err", err)
+				respondError(w, http.StatusInternalServerError, "failed to check robot name")
+				return
+			} else if msg != "" {
+				respondError(w, http.StatusConflict, msg)
+				return
+			}
+			req.Name = &name
+		}
+	}
+	if req.Type != nil {
+		if *req.Type != "robot" && *req.Type != "laptop" {
+			respondError(w, http.StatusBadRequest, "type must be robot or laptop")
+			return
+		}
+		if *req.Type == robot.Type {
+			req.Type = nil
+		}
+	}
+	if req.ROSContainer != nil {
+		name := strings.TrimSpace(*req.ROSContainer)
+		if name != "" && !containerName.MatchString(name) {
+			respondError(w, http.StatusBadRequest, "ros_container is not a valid container name")
+			return
+		}
+		if name == robot.ROSContainer {
+			req.ROSContainer = nil
+		} else {
+			req.ROSContainer = &name
+		}
+	}
+
+	update := db.RobotUpdate{Name: req.Name, Notes: req.Notes, Type: req.Type, ROSContainer: req.ROSContainer}
+	if err := c.DB.UpdateRobot(r.Context(), id, update); err != nil {
+		logging.FromContext(r.Context()).Error("update robot", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to update robot")
+		return
+	}
+
+	if robot.AgentID != "" && (req.Name != nil || req.Type != nil || req.ROSContainer != nil) {
+		data := agent.ConfigureAgentData{AgentID: robot.AgentID, ROSContainer: req.ROSContainer}
+		if req.Name != nil {
+			data.AgentID = *req.Name
+		}
+		if req.Type != nil {
+			data.Type = *req.Type
+		}
+		raw, _ := json.Marshal(data)
+		if _, err := c.queueRobotCommand(r.Context(), robot, agent.Command{Type: "configure_agent", Data: raw}); err != nil {
+			logging.FromContext(r.Context()).Error("queue configure_agent", "robot", robot.Name, "err", err)
+		}
+	}
+	c.audit(r.Context(), "robot.update", robot.Name, patchSummary(req))
+
+	updated, err := c.DB.GetRobotByID(r.Context(), id)
+	if err != nil {
+		respondJSON(w, http.StatusOK, map[string]string{"status": "updated"})
+		return
+	}
+	respondJSON(w, http.StatusOK, updated)
+}
+
+// renameConflict explains why robot id cannot be called name, or returns ""
+// when the name is free.
+func (c *Controller) renameConflict(ctx context.Context, id int64, name string) (string, error) {
+	if other, err := c.DB.GetRobotByName(ctx, name); err == nil && other.ID != id {
+		return fmt.Sprintf("name %q is already used by robot %d", name, other.ID), nil
+	} else if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if other, err := c.DB.GetRobotByAgentID(ctx, name); err == nil && other.ID != id {
+		return fmt.Sprintf("agent_id %q is already used by robot %q", name, other.Name), nil
+	} else if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	return "", nil
+}
+
+func patchSummary(req robotPatchRequest) string {
+	var parts []string
+	if req.Name != nil {
+		parts = append(parts, "name="+*req.Name)
+	}
+	if req.Type != nil {
+		parts = append(parts, "type="+*req.Type)
+	}
+	if req.ROSContainer != nil {
+		parts = append(parts, "ros_container="+*req.ROSContainer)
+	}
+	if req.Notes != nil {
+		parts = append(parts, "notes")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// correlationID returns the request ID on ctx so agent logs can be tied back
+// to the API call, or a fresh ID for commands issued from background work.
+func correlationID(ctx context.Context) string {
+	if id := logging.RequestID(ctx); id != "" {
+		return id
+	}
+	return logging.NewID()
+}
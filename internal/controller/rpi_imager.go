@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// Raspberry Pi Imager takes a custom repository URL (Options, or
+// rpi-imager --repo URL) pointing at an os_list.json. The controller serves
+// one listing the built images still kept, one submenu per profile, newest
+// first. The images themselves are downloaded from /images/, which, like the
+// list, needs no login.
+
+// imagerOSList is rpi-imager's repository format.
+type imagerOSList struct {
+	OSList []imagerOS `json:"os_list"`
+}
+
+// imagerOS is an image, or a submenu of them when it has SubItems.
+type imagerOS struct {
+	Name                string     `json:"name"`
+	Description         string     `json:"description"`
+	URL                 string     `json:"url,omitempty"`
+	ReleaseDate         string     `json:"release_date,omitempty"`
+	ImageDownloadSize   int64      `json:"image_download_size,omitempty"`
+	ImageDownloadSHA256 string     `json:"image_download_sha256,omitempty"`
+	SubItems            []imagerOS `json:"subitems,omitempty"`
+}
+
+// ImagerOSList returns the built images as a Raspberry Pi Imager
+// repository.
+func (c *Controller) ImagerOSList(w http.ResponseWriter, r *http.Request) {
+	builds, err := c.DB.ListImageBuilds(r.Context(), 0, maxImageBuildLimit)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("imager os list: list image builds", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load image builds")
+		return
+	}
+	profiles, err := c.DB.ListImageProfiles(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("imager os list: list image profiles", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load image profiles")
+		return
+	}
+	byID := make(map[int64]db.ImageProfile, len(profiles))
+	for _, p := range profiles {
+		byID[p.ID] = p
+	}
+
+	base := requestBaseURL(r)
+	list := imagerOSList{OSList: []imagerOS{}}
+	menus := map[string]int{}
+	for _, b := range builds {
+		if b.Status != db.ImageBuildSuccess || b.ImageName == "" || b.Checksum == "" {
+			continue
+		}
+		name := filepath.Base(b.ImageName)
+		if _, err := os.Stat(filepath.Join(buildImagesDir(), name)); err != nil {
+			continue
+		}
+		profile, ok := byID[b.ProfileID]
+		if !ok {
+			profile = db.ImageProfile{Name: b.ProfileName}
+		}
+		i, ok := menus[profile.Name]
+		if !ok {
+			i = len(list.OSList)
+			menus[profile.Name] = i
+			list.OSList = append(list.OSList, imagerOS{Name: profile.Name, Description: imagerDescription(profile)})
+		}
+		item := imagerOS{
+			Name:                fmt.Sprintf("%s (build %d)", profile.Name, b.ID),
+			Description:         name,
+			URL:                 base + "/images/" + name,
+			ImageDownloadSize:   b.ImageSize,
+			ImageDownloadSHA256: b.Checksum,
+		}
+		if b.FinishedAt != nil {
+			item.ReleaseDate = b.FinishedAt.Format("2006-01-02")
+		}
+		if b.SmokeTest == db.ImageSmokeFailed {
+			item.Description += " - failed its QEMU smoke test"
+		}
+		list.OSList[i].SubItems = append(list.OSList[i].SubItems, item)
+	}
+	respondJSON(w, http.StatusOK, list)
+}
+
+// imagerDescription is the profile's description, or else sums up what its
+// images are for.
+func imagerDescription(p db.ImageProfile) string {
+	if p.ID == 0 {
+		return "OpenRobot golden image (profile deleted)"
+	}
+	if p.Description != "" {
+		return p.Description
+	}
+	parts := []string{"OpenRobot golden image"}
+	if p.Config.ROSVersion != "" {
+		parts = append(parts, "ROS 2 "+p.Config.ROSVersion)
+	}
+	if p.Config.RobotModel != "" {
+		parts = append(parts, p.Config.RobotModel)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+	"example.com/openrobot-fleet/internal/scenario"
+	"gopkg.in/yaml.v3"
+)
+
+// ScenarioHistory returns the robots a scenario was applied to, newest first.
+func (c *Controller) ScenarioHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDFromPath(strings.TrimSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/history"), "/api/scenarios/")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid scenario id")
+		return
+	}
+	if _, err := c.DB.GetScenarioByID(r.Context(), id); err != nil {
+		if err == sql.ErrNoRows {
+			respondError(w, http.StatusNotFound, "scenario not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("scenario history fetch", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load scenario")
+		return
+	}
+	applies, err := c.DB.ListScenarioApplies(r.Context(), id)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list scenario applies", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load scenario history")
+		return
+	}
+	respondJSON(w, http.StatusOK, applies)
+}
+
+// ExportScenarios writes a bundle of the scenarios in ?ids= (all of them if
+// empty) and the scenarios they extend. ?history=true adds each one's apply
+// history and ?format=yaml writes YAML instead of JSON.
+func (c *Controller) ExportScenarios(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format != "" && format != "json" && format != "yaml" {
+		respondError(w, http.StatusBadRequest, "format must be json or yaml")
+		return
+	}
+	ids := map[int64]bool{}
+	for _, v := range splitList(q.Get("ids")) {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid scenario id %q", v))
+			return
+		}
+		ids[id] = true
+	}
+	all, err := c.DB.ListScenarios(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("export scenarios", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to list scenarios")
+		return
+	}
+	selected := all
+	if len(ids) > 0 {
+		selected = nil
+		for _, s := range all {
+			if ids[s.ID] {
+				selected = append(selected, s)
+				delete(ids, s.ID)
+			}
+		}
+		for id := range ids {
+			respondError(w, http.StatusNotFound, fmt.Sprintf("scenario %d not found", id))
+			return
+		}
+	}
+
+	bundle := scenario.Bundle{Version: scenario.BundleVersion, ExportedAt: time.Now().UTC(), Scenarios: []scenario.BundleScenario{}}
+	for _, s := range scenario.WithParents(selected, all) {
+		bs := scenario.BundleScenario{Name: s.Name, Description: s.Description, ConfigYAML: s.ConfigYAML}
+		if q.Get("history") == "true" {
+			applies, err := c.DB.ListScenarioApplies(r.Context(), s.ID)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("export scenario history", "scenario", s.Name, "err", err)
+				respondError(w, http.StatusInternalServerError, "failed to load scenario history")
+				return
+			}
+			for _, a := range applies {
+				bs.History = append(bs.History, scenario.BundleApply{Robot: a.RobotName, Status: a.Status, AppliedBy: a.AppliedBy, AppliedAt: a.AppliedAt})
+			}
+		}
+		bundle.Scenarios = append(bundle.Scenarios, bs)
+	}
+
+	c.audit(r.Context(), "scenario.export", "", fmt.Sprintf("%d scenarios", len(bundle.Scenarios)))
+	filename := "scenarios-" + bundle.ExportedAt.Format("20060102")
+	if format == "yaml" {
+		out, err := yaml.Marshal(bundle)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to encode bundle")
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.yaml"`)
+		w.Write(out)
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+	respondJSON(w, http.StatusOK, bundle)
+}
+
+type scenarioImportRequest struct {
+	// Bundle is an exported bundle, as YAML or JSON text.
+	Bundle string `json:"bundle"`
+	// OnConflict decides what happens to a scenario whose name exists with a
+	// different config: skip (the default) keeps the existing one, replace
+	// overwrites it.
+	OnConflict string `json:"on_conflict,omitempty"`
+	// DryRun reports what would change without changing it.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+type scenarioImportResponse struct {
+	Created  []string `json:"created"`
+	Replaced []string `json:"replaced"`
+	// Skipped exist here with a different config and were kept.
+	Skipped   []string `json:"skipped"`
+	Unchanged []string `json:"unchanged"`
+	Applied   bool     `json:"applied"`
+}
+
+// ImportScenarios creates the scenarios of a bundle. Every scenario that
+// would be written is validated first, against the scenarios it extends as
+// they will be after the import, and nothing is written if one fails.
+func (c *Controller) ImportScenarios(w http.ResponseWriter, r *http.Request) {
+	var req scenarioImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid import payload")
+		return
+	}
+	switch req.OnConflict {
+	case "":
+		req.OnConflict = "skip"
+	case "skip", "replace":
+	default:
+		respondError(w, http.StatusBadRequest, "on_conflict must be skip or replace")
+		return
+	}
+	bundle, err := scenario.ParseBundle(req.Bundle)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	existing, err := c.DB.ListScenarios(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("import scenarios", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to list scenarios")
+		return
+	}
+	byName := make(map[string]db.Scenario, len(existing))
+	for _, s := range existing {
+		byName[s.Name] = s
+	}
+
+	resp := scenarioImportResponse{Created: []string{}, Replaced: []string{}, Skipped: []string{}, Unchanged: []string{}}
+	var writes []db.Scenario
+	for _, bs := range bundle.Scenarios {
+		s := db.Scenario{Name: bs.Name, Description: bs.Description, ConfigYAML: bs.ConfigYAML}
+		old, exists := byName[bs.Name]
+		switch {
+		case !exists:
+			resp.Created = append(resp.Created, s.Name)
+		case old.ConfigYAML == s.ConfigYAML && old.Description == s.Description:
+			resp.Unchanged = append(resp.Unchanged, s.Name)
+			continue
+		case req.OnConflict == "skip":
+			resp.Skipped = append(resp.Skipped, s.Name)
+			continue
+		default:
+			s.ID = old.ID
+			resp.Replaced = append(resp.Replaced, s.Name)
+		}
+		writes = append(writes, s)
+		byName[s.Name] = s
+	}
+	lookup := func(name string) (string, error) {
+		if s, ok := byName[name]; ok {
+			return s.ConfigYAML, nil
+		}
+		return "", fmt.Errorf("scenario %q not found", name)
+	}
+	for _, s := range writes {
+		if _, err := scenario.Resolve(s.Name, s.ConfigYAML, lookup); err != nil {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("scenario %q: invalid config: %v", s.Name, err))
+			return
+		}
+	}
+	if req.DryRun {
+		respondJSON(w, http.StatusOK, resp)
+		return
+	}
+	for _, s := range writes {
+		if err := c.writeImportedScenario(r.Context(), s); err != nil {
+			logging.FromContext(r.Context()).Error("import scenario", "scenario", s.Name, "err", err)
+			respondError(w, http.StatusInternalServerError, fmt.Sprintf("failed to save scenario %q", s.Name))
+			return
+		}
+	}
+	resp.Applied = true
+	c.audit(r.Context(), "scenario.import", "", fmt.Sprintf("created %d, replaced %d, skipped %d", len(resp.Created), len(resp.Replaced), len(resp.Skipped)))
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func (c *Controller) writeImportedScenario(ctx context.Context, s db.Scenario) error {
+	if s.ID != 0 {
+		return c.DB.UpdateScenario(ctx, s)
+	}
+	_, err := c.DB.CreateScenario(ctx, s)
+	return err
+}
@@ -1,15 +1,16 @@
 package controller
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 
-	"example.com/openrobot-fleet/internal/agent"
 	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
 	"example.com/openrobot-fleet/internal/scenario"
 )
 
@@ -22,7 +23,7 @@ type scenarioRequest struct {
 func (c *Controller) ListScenarios(w http.ResponseWriter, r *http.Request) {
 	scenarios, err := c.DB.ListScenarios(r.Context())
 	if err != nil {
-		log.Printf("list scenarios: %v", err)
+		logging.FromContext(r.Context()).Error("list scenarios", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to list scenarios")
 		return
 	}
@@ -41,7 +42,7 @@ func (c *Controller) GetScenario(w http.ResponseWriter, r *http.Request) {
 			respondError(w, http.StatusNotFound, "scenario not found")
 			return
 		}
-		log.Printf("get scenario: %v", err)
+		logging.FromContext(r.Context()).Error("get scenario", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to fetch scenario")
 		return
 	}
@@ -58,14 +59,14 @@ func (c *Controller) CreateScenario(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "scenario name required")
 		return
 	}
-	if _, err := scenario.Parse(req.ConfigYAML); err != nil {
+	if _, err := c.resolveScenarioSpec(r.Context(), req.Name, req.ConfigYAML); err != nil {
 		respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid scenario config: %v", err))
 		return
 	}
 	s := db.Scenario{Name: req.Name, Description: req.Description, ConfigYAML: req.ConfigYAML}
 	id, err := c.DB.CreateScenario(r.Context(), s)
 	if err != nil {
-		log.Printf("create scenario: %v", err)
+		logging.FromContext(r.Context()).Error("create scenario", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to create scenario")
 		return
 	}
@@ -89,12 +90,12 @@ func (c *Controller) UpdateScenario(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "scenario name required")
 		return
 	}
-	if _, err := scenario.Parse(req.ConfigYAML); err != nil {
+	if _, err := c.resolveScenarioSpec(r.Context(), s.Name, req.ConfigYAML); err != nil {
 		respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid scenario config: %v", err))
 		return
 	}
 	if err := c.DB.UpdateScenario(r.Context(), s); err != nil {
-		log.Printf("update scenario: %v", err)
+		logging.FromContext(r.Context()).Error("update scenario", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to update scenario")
 		return
 	}
@@ -108,7 +109,7 @@ func (c *Controller) DeleteScenario(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err := c.DB.DeleteScenario(r.Context(), id); err != nil {
-		log.Printf("delete scenario: %v", err)
+		logging.FromContext(r.Context()).Error("delete scenario", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to delete scenario")
 		return
 	}
@@ -117,10 +118,26 @@ func (c *Controller) DeleteScenario(w http.ResponseWriter, r *http.Request) {
 
 type applyScenarioRequest struct {
 	RobotIDs []int64 `json:"robot_ids"`
+	// Selector adds every robot it matches, e.g. tag=classA.
+	Selector string `json:"selector,omitempty"`
+	// Force applies the scenario to robots that don't meet its
+	// requirements too, reporting them as warnings instead of skipping them.
+	Force bool `json:"force,omitempty"`
 }
 
 type applyScenarioResponse struct {
 	Jobs []db.Job `json:"jobs"`
+	// Skipped are robots left out because they don't meet the scenario's
+	// requirements; Warnings are those it was forced onto.
+	Skipped  []scenarioMismatch `json:"skipped,omitempty"`
+	Warnings []scenarioMismatch `json:"warnings,omitempty"`
+}
+
+// scenarioMismatch says why a robot doesn't meet a scenario's requirements.
+type scenarioMismatch struct {
+	RobotID int64    `json:"robot_id"`
+	Name    string   `json:"name"`
+	Reasons []string `json:"reasons"`
 }
 
 func (c *Controller) ApplyScenario(w http.ResponseWriter, r *http.Request) {
@@ -134,8 +151,18 @@ func (c *Controller) ApplyScenario(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "invalid apply payload")
 		return
 	}
+	sel, err := parseSelector(req.Selector)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid selector: "+err.Error())
+		return
+	}
+	if req.RobotIDs, err = c.mergeSelected(r.Context(), req.RobotIDs, sel); err != nil {
+		logging.FromContext(r.Context()).Error("apply scenario select robots", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to list robots")
+		return
+	}
 	if len(req.RobotIDs) == 0 {
-		respondError(w, http.StatusBadRequest, "robot_ids required")
+		respondError(w, http.StatusBadRequest, "robot_ids or a matching selector required")
 		return
 	}
 	s, err := c.DB.GetScenarioByID(r.Context(), scenarioID)
@@ -144,23 +171,16 @@ func (c *Controller) ApplyScenario(w http.ResponseWriter, r *http.Request) {
 			respondError(w, http.StatusNotFound, "scenario not found")
 			return
 		}
-		log.Printf("apply scenario fetch: %v", err)
+		logging.FromContext(r.Context()).Error("apply scenario fetch", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to load scenario")
 		return
 	}
-	spec, err := scenario.Parse(s.ConfigYAML)
+	spec, err := c.loadScenarioSpec(r.Context(), s)
 	if err != nil {
 		respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid scenario config: %v", err))
 		return
 	}
-	repoPayload := spec.Repo.ToUpdateRepo()
-	data, err := json.Marshal(repoPayload)
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to encode scenario command")
-		return
-	}
-	cmd := agent.Command{Type: "update_repo", Data: data}
-	var jobs []db.Job
+	var resp applyScenarioResponse
 	for _, robotID := range req.RobotIDs {
 		robot, err := c.DB.GetRobotByID(r.Context(), robotID)
 		if err != nil {
@@ -168,7 +188,7 @@ func (c *Controller) ApplyScenario(w http.ResponseWriter, r *http.Request) {
 				respondError(w, http.StatusNotFound, fmt.Sprintf("robot %d not found", robotID))
 				return
 			}
-			log.Printf("apply scenario robot fetch: %v", err)
+			logging.FromContext(r.Context()).Error("apply scenario robot fetch", "err", err)
 			respondError(w, http.StatusInternalServerError, "failed to fetch robot")
 			return
 		}
@@ -176,20 +196,68 @@ func (c *Controller) ApplyScenario(w http.ResponseWriter, r *http.Request) {
 			respondError(w, http.StatusBadRequest, fmt.Sprintf("robot %s has no agent", robot.Name))
 			return
 		}
+		if reasons := spec.Requires.Unmet(robot); len(reasons) > 0 {
+			m := scenarioMismatch{RobotID: robot.ID, Name: robot.Name, Reasons: reasons}
+			if !req.Force {
+				resp.Skipped = append(resp.Skipped, m)
+				continue
+			}
+			resp.Warnings = append(resp.Warnings, m)
+		}
+		cmd, err := spec.BatchCommand(robot)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid scenario config for robot %s: %v", robot.Name, err))
+			return
+		}
 		job, err := c.queueRobotCommand(r.Context(), robot, cmd)
+		if errors.Is(err, errPayloadKeyMissing) {
+			respondError(w, http.StatusConflict, fmt.Sprintf("robot %s: %v", robot.Name, err))
+			return
+		}
 		if err != nil {
-			log.Printf("apply scenario queue: %v", err)
+			logging.FromContext(r.Context()).Error("apply scenario queue", "err", err)
 			respondError(w, http.StatusInternalServerError, "failed to queue command")
 			return
 		}
 		if err := c.DB.UpdateRobotScenario(r.Context(), robotID, scenarioID); err != nil {
-			log.Printf("apply scenario update robot: %v", err)
+			logging.FromContext(r.Context()).Error("apply scenario update robot", "err", err)
 			respondError(w, http.StatusInternalServerError, "failed to tag robot scenario")
 			return
 		}
-		jobs = append(jobs, job)
+		c.recordScenarioApply(r.Context(), scenarioID, robot, job)
+		resp.Jobs = append(resp.Jobs, job)
+	}
+	if len(resp.Jobs) == 0 {
+		first := resp.Skipped[0]
+		respondError(w, http.StatusConflict, fmt.Sprintf("no selected robot meets the scenario's requirements (%s: %s)", first.Name, strings.Join(first.Reasons, ", ")))
+		return
+	}
+	respondJSON(w, http.StatusCreated, resp)
+}
+
+// recordScenarioApply adds job to the scenario's apply history. A failure is
+// logged; the job is already queued.
+func (c *Controller) recordScenarioApply(ctx context.Context, scenarioID int64, robot db.Robot, job db.Job) {
+	a := db.ScenarioApply{RobotID: robot.ID, RobotName: robot.Name, JobID: job.ID, AppliedBy: job.IssuedBy, AppliedAt: job.CreatedAt}
+	if err := c.DB.RecordScenarioApply(ctx, scenarioID, a); err != nil {
+		logging.FromContext(ctx).Error("record scenario apply", "scenario_id", scenarioID, "robot", robot.Name, "err", err)
+	}
+}
+
+// resolveScenarioSpec parses a scenario config and merges in any scenarios it
+// extends, looking parents up by name.
+func (c *Controller) resolveScenarioSpec(ctx context.Context, name, raw string) (scenario.Spec, error) {
+	lookup := func(parent string) (string, error) {
+		s, err := c.DB.GetScenarioByName(ctx, parent)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return "", fmt.Errorf("scenario %q not found", parent)
+			}
+			return "", err
+		}
+		return s.ConfigYAML, nil
 	}
-	respondJSON(w, http.StatusCreated, applyScenarioResponse{Jobs: jobs})
+	return scenario.Resolve(name, raw, lookup)
 }
 
 func parseScenarioApplyID(path string) (int64, error) {
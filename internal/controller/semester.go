@@ -2,25 +2,47 @@ package controller
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
-	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"example.com/openrobot-fleet/internal/agent"
 	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/events"
+	"example.com/openrobot-fleet/internal/logging"
 	"example.com/openrobot-fleet/internal/scenario"
 	sshc "example.com/openrobot-fleet/internal/ssh"
 )
 
+// Each step of a semester batch waits this long for the robot to report
+// its job finished, including time spent behind commands already queued.
+const (
+	semesterResetLogsTimeout  = 2 * time.Minute
+	semesterUpdateRepoTimeout = 10 * time.Minute
+	semesterScenariosTimeout  = 30 * time.Minute
+	semesterSelfTestTimeout   = 3 * time.Minute
+	semesterCommandTimeout    = 10 * time.Minute
+	semesterJobPollInterval   = 2 * time.Second
+)
+
 type semesterRequest struct {
-	RobotIDs       []int64              `json:"robot_ids"`
+	RobotIDs []int64 `json:"robot_ids"`
+	Selector string  `json:"selector,omitempty"`
+	// Steps are run on each robot in order. Without them the batch runs the
+	// steps saved in TemplateID, or else those turned on by the flags below,
+	// in their fixed order.
+	Steps          []semesterStep       `json:"steps,omitempty"`
+	TemplateID     int64                `json:"template_id,omitempty"`
 	Reinstall      bool                 `json:"reinstall"`
 	ResetLogs      bool                 `json:"reset_logs"`
 	UpdateRepo     bool                 `json:"update_repo"`
@@ -28,408 +50,934 @@ type semesterRequest struct {
 	RepoConfig     agent.UpdateRepoData `json:"repo_config"`
 	ApplyScenarios bool                 `json:"apply_scenarios"`
 	ScenarioIDs    []int64              `json:"scenario_ids"`
+}
+
+// Semester step types. A command step sends any agent command.
+const (
+	semesterReinstall      = "reinstall"
+	semesterResetLogs      = "reset_logs"
+	semesterUpdateRepo     = "update_repo"
+	semesterApplyScenarios = "apply_scenarios"
+	semesterSelfTest       = "self_test"
+	semesterCustomCommand  = "command"
+)
+
+// semesterStep is one step of a semester batch.
+type semesterStep struct {
+	Type string `json:"type"`
+	// Name labels the step in the batch progress; it defaults to one
+	// derived from the type.
+	Name        string                `json:"name,omitempty"`
+	RepoConfig  *agent.UpdateRepoData `json:"repo_config,omitempty"`
+	ScenarioIDs []int64               `json:"scenario_ids,omitempty"`
+	// Command and Data are the agent command a command step sends.
+	Command string          `json:"command,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	// TimeoutSec overrides how long the step waits for the robot.
+	TimeoutSec int `json:"timeout_sec,omitempty"`
+
+	scenarios []semesterScenario
+}
+
+// label is the robot state shown while the step runs.
+func (s semesterStep) label() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	switch s.Type {
+	case semesterReinstall:
+		return "installing_agent"
+	case semesterResetLogs:
+		return "resetting_logs"
+	case semesterUpdateRepo:
+		return "updating_repo"
+	case semesterApplyScenarios:
+		return "applying_scenarios"
+	case semesterSelfTest:
+		return "running_self_test"
+	}
+	return "running_" + s.Command
+}
 
-	// Internal
-	ScenarioConfigs []agent.UpdateRepoData `json:"-"`
+func (s semesterStep) timeout() time.Duration {
+	if s.TimeoutSec > 0 {
+		return time.Duration(s.TimeoutSec) * time.Second
+	}
+	switch s.Type {
+	case semesterResetLogs:
+		return semesterResetLogsTimeout
+	case semesterUpdateRepo:
+		return semesterUpdateRepoTimeout
+	case semesterApplyScenarios:
+		return semesterScenariosTimeout
+	case semesterSelfTest:
+		return semesterSelfTestTimeout
+	}
+	return semesterCommandTimeout
 }
 
-type SemesterBatchStatus struct {
-	sync.RWMutex
+// validate checks a step's type and the fields it needs.
+func (s semesterStep) validate() error {
+	if s.TimeoutSec < 0 {
+		return errors.New("timeout_sec must not be negative")
+	}
+	switch s.Type {
+	case semesterReinstall, semesterResetLogs, semesterSelfTest:
+	case semesterUpdateRepo:
+		if s.RepoConfig == nil || s.RepoConfig.Repo == "" {
+			return errors.New("update_repo step requires repo_config.repo")
+		}
+	case semesterApplyScenarios:
+		if len(s.ScenarioIDs) == 0 {
+			return errors.New("apply_scenarios step requires scenario_ids")
+		}
+	case semesterCustomCommand:
+		if s.Command == "" {
+			return errors.New("command step requires command")
+		}
+		if len(s.Data) > 0 && !json.Valid(s.Data) {
+			return errors.New("command step data must be JSON")
+		}
+	case "":
+		return errors.New("step type required")
+	default:
+		return fmt.Errorf("unknown step type %q", s.Type)
+	}
+	return nil
+}
+
+// validateSemesterSteps checks a list of steps, naming the one at fault.
+func validateSemesterSteps(steps []semesterStep) error {
+	if len(steps) == 0 {
+		return errors.New("at least one step required")
+	}
+	for i, step := range steps {
+		if err := step.validate(); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// semesterScenario is a resolved scenario, rendered for each robot when it
+// is queued.
+type semesterScenario struct {
+	ID   int64
+	Name string
+	Spec scenario.Spec
+}
+
+// semesterRun is the latest semester batch. It is saved to the database on
+// every change, so a batch paused or cut short by a restart can be resumed.
+type semesterRun struct {
+	mu    sync.Mutex
+	batch db.SemesterBatch
+	// active is set while robots are being processed; a paused batch stays
+	// active until each robot has finished the step it was on.
+	active bool
+	cancel context.CancelFunc
+}
+
+// semesterStatusResponse is the latest batch, returned by the status
+// endpoint.
+type semesterStatusResponse struct {
+	ID        int64            `json:"id,omitempty"`
 	Active    bool             `json:"active"`
+	State     string           `json:"state,omitempty"`
 	Total     int              `json:"total"`
 	Completed int              `json:"completed"`
 	Robots    map[int64]string `json:"robots"`
 	Errors    map[int64]string `json:"errors"`
+	CreatedBy string           `json:"created_by,omitempty"`
 }
 
-var batchStatus = &SemesterBatchStatus{
-	Robots: make(map[int64]string),
-	Errors: make(map[int64]string),
+// Robot states that end a robot's part of the batch; the rest are run again
+// when the batch is resumed.
+func semesterRobotFinished(state string) bool {
+	return state == "success" || state == "error" || state == "cancelled"
 }
 
 func (c *Controller) GetSemesterStatus(w http.ResponseWriter, r *http.Request) {
-	batchStatus.RLock()
-	defer batchStatus.RUnlock()
-	// Create a copy to avoid race conditions during JSON marshaling if we passed the struct directly with the mutex
-	status := struct {
-		Active    bool             `json:"active"`
-		Total     int              `json:"total"`
-		Completed int              `json:"completed"`
-		Robots    map[int64]string `json:"robots"`
-		Errors    map[int64]string `json:"errors"`
-	}{
-		Active:    batchStatus.Active,
-		Total:     batchStatus.Total,
-		Completed: batchStatus.Completed,
-		Robots:    make(map[int64]string),
-		Errors:    make(map[int64]string),
+	c.semester.mu.Lock()
+	defer c.semester.mu.Unlock()
+	respondJSON(w, http.StatusOK, c.semester.snapshot())
+}
+
+// snapshot copies the status, so it can be marshaled without the lock. The
+// caller holds the lock.
+func (s *semesterRun) snapshot() semesterStatusResponse {
+	b := s.batch
+	status := semesterStatusResponse{
+		ID:        b.ID,
+		Active:    s.active,
+		State:     b.State,
+		Total:     b.Total,
+		Completed: b.Completed,
+		Robots:    make(map[int64]string, len(b.Robots)),
+		Errors:    make(map[int64]string, len(b.Errors)),
+		CreatedBy: b.CreatedBy,
 	}
-	for k, v := range batchStatus.Robots {
+	for k, v := range b.Robots {
 		status.Robots[k] = v
 	}
-	for k, v := range batchStatus.Errors {
+	for k, v := range b.Errors {
 		status.Errors[k] = v
 	}
-	respondJSON(w, http.StatusOK, status)
+	return status
+}
+
+// updateSemester changes the batch with fn, saves it and publishes the
+// result.
+func (c *Controller) updateSemester(fn func(s *semesterRun)) {
+	c.semester.mu.Lock()
+	fn(&c.semester)
+	status := c.semester.snapshot()
+	if c.semester.batch.ID != 0 {
+		if err := c.DB.UpdateSemesterBatch(context.Background(), c.semester.batch); err != nil {
+			slog.Error("semester: failed to save batch", "batch", c.semester.batch.ID, "err", err)
+		}
+	}
+	c.semester.mu.Unlock()
+	c.Events.Publish(events.SemesterProgress(status))
+}
+
+// semesterStep records the step robot id has moved on to.
+func (c *Controller) semesterStep(id int64, step string) {
+	c.updateSemester(func(s *semesterRun) {
+		if !semesterRobotFinished(s.batch.Robots[id]) {
+			s.batch.Robots[id] = step
+		}
+	})
+}
+
+// semesterFail ends robot id's part of the batch with msg.
+func (c *Controller) semesterFail(id int64, msg string) {
+	c.updateSemester(func(s *semesterRun) {
+		if semesterRobotFinished(s.batch.Robots[id]) {
+			return
+		}
+		s.batch.Errors[id] = msg
+		s.batch.Robots[id] = "error"
+		s.batch.Completed++
+	})
+}
+
+// semesterStepDone reports whether robot id finished step before the batch
+// was paused.
+func (c *Controller) semesterStepDone(id int64, step string) bool {
+	c.semester.mu.Lock()
+	defer c.semester.mu.Unlock()
+	return slices.Contains(c.semester.batch.Done[id], step)
+}
+
+// semesterFinishStep records that robot id finished step.
+func (c *Controller) semesterFinishStep(id int64, step string) {
+	c.updateSemester(func(s *semesterRun) { s.batch.Done[id] = append(s.batch.Done[id], step) })
+}
+
+// semesterHalted reports whether robot id should stop before its next step:
+// the batch was cancelled, or paused, in which case the robot is left to be
+// picked up again on resume.
+func (c *Controller) semesterHalted(id int64) bool {
+	c.semester.mu.Lock()
+	state := c.semester.batch.State
+	c.semester.mu.Unlock()
+	switch state {
+	case db.SemesterCancelled:
+		return true
+	case db.SemesterPaused:
+		c.semesterStep(id, "paused")
+		return true
+	}
+	return false
 }
 
 func (c *Controller) HandleSemesterStart(w http.ResponseWriter, r *http.Request) {
-	var req semesterRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "invalid payload")
+	req, ok := c.decodeSemesterRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := c.resolveSemesterSteps(r.Context(), &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	raw, _ := json.Marshal(req)
+	createdBy, _ := Actor(r.Context())
+	batch := db.SemesterBatch{
+		State:     db.SemesterRunning,
+		Request:   string(raw),
+		BaseURL:   requestBaseURL(r),
+		Total:     len(req.RobotIDs),
+		Robots:    make(map[int64]string),
+		Errors:    make(map[int64]string),
+		Done:      make(map[int64][]string),
+		CreatedBy: createdBy,
+	}
+	for _, id := range req.RobotIDs {
+		batch.Robots[id] = "pending"
+	}
+
+	c.semester.mu.Lock()
+	if c.semester.active {
+		c.semester.mu.Unlock()
+		respondError(w, http.StatusConflict, "batch already in progress")
+		return
+	}
+	if c.semester.batch.State == db.SemesterPaused {
+		c.semester.mu.Unlock()
+		respondError(w, http.StatusConflict, "a paused batch exists; resume or cancel it first")
+		return
+	}
+	id, err := c.DB.CreateSemesterBatch(r.Context(), batch)
+	if err != nil {
+		c.semester.mu.Unlock()
+		logging.FromContext(r.Context()).Error("semester: save batch", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to save batch")
 		return
 	}
+	batch.ID = id
+	c.semester.batch = batch
+	ctx := c.runSemesterLocked(context.WithoutCancel(r.Context()))
+	status := c.semester.snapshot()
+	c.semester.mu.Unlock()
+	c.Events.Publish(events.SemesterProgress(status))
+
+	// Keep the caller's attribution but not the request's lifetime
+	go c.processSemesterBatch(ctx, req, batch.BaseURL)
 
-	if req.ApplyScenarios {
-		for _, sid := range req.ScenarioIDs {
-			s, err := c.DB.GetScenarioByID(r.Context(), sid)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "accepted"})
+}
+
+// resolveSemesterSteps settles the steps req runs, from its template or
+// flags if it has none, and loads the scenarios they apply.
+func (c *Controller) resolveSemesterSteps(ctx context.Context, req *semesterRequest) error {
+	switch {
+	case len(req.Steps) > 0:
+	case req.TemplateID != 0:
+		t, err := c.DB.GetSemesterTemplate(ctx, req.TemplateID)
+		if err != nil {
+			return fmt.Errorf("invalid template id: %d", req.TemplateID)
+		}
+		if err := json.Unmarshal([]byte(t.Steps), &req.Steps); err != nil {
+			return fmt.Errorf("template %s is unreadable: %v", t.Name, err)
+		}
+	default:
+		req.Steps = req.flagSteps()
+	}
+	if err := validateSemesterSteps(req.Steps); err != nil {
+		return err
+	}
+	for i := range req.Steps {
+		step := &req.Steps[i]
+		step.scenarios = nil
+		if step.Type != semesterApplyScenarios {
+			continue
+		}
+		for _, sid := range step.ScenarioIDs {
+			s, err := c.DB.GetScenarioByID(ctx, sid)
 			if err != nil {
-				respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid scenario id: %d", sid))
-				return
+				return fmt.Errorf("invalid scenario id: %d", sid)
 			}
-			spec, err := scenario.Parse(s.ConfigYAML)
+			spec, err := c.loadScenarioSpec(ctx, s)
 			if err != nil {
-				respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid scenario config for %s: %v", s.Name, err))
-				return
+				return fmt.Errorf("invalid scenario config for %s: %v", s.Name, err)
 			}
-			req.ScenarioConfigs = append(req.ScenarioConfigs, spec.Repo.ToUpdateRepo())
+			step.scenarios = append(step.scenarios, semesterScenario{ID: s.ID, Name: s.Name, Spec: spec})
 		}
 	}
+	return nil
+}
 
-	batchStatus.Lock()
-	if batchStatus.Active {
-		batchStatus.Unlock()
-		respondError(w, http.StatusConflict, "batch already in progress")
+// flagSteps are the steps turned on by req's flags, in the order the
+// wizard has always run them.
+func (req semesterRequest) flagSteps() []semesterStep {
+	var steps []semesterStep
+	if req.Reinstall {
+		steps = append(steps, semesterStep{Type: semesterReinstall})
+	}
+	if req.ResetLogs {
+		steps = append(steps, semesterStep{Type: semesterResetLogs})
+	}
+	if req.UpdateRepo {
+		repo := req.RepoConfig
+		steps = append(steps, semesterStep{Type: semesterUpdateRepo, RepoConfig: &repo})
+	}
+	if req.ApplyScenarios && len(req.ScenarioIDs) > 0 {
+		steps = append(steps, semesterStep{Type: semesterApplyScenarios, ScenarioIDs: req.ScenarioIDs})
+	}
+	if req.RunSelfTest {
+		steps = append(steps, semesterStep{Type: semesterSelfTest})
+	}
+	return steps
+}
+
+// runSemesterLocked marks the batch as being processed and returns the
+// context cancelling it stops. The caller holds the lock.
+func (c *Controller) runSemesterLocked(parent context.Context) context.Context {
+	ctx, cancel := context.WithCancel(parent)
+	c.semester.active = true
+	c.semester.cancel = cancel
+	return ctx
+}
+
+// PauseSemester stops the running batch once each robot has finished the
+// step it is on. The robots left are picked up again by ResumeSemester.
+func (c *Controller) PauseSemester(w http.ResponseWriter, r *http.Request) {
+	c.semester.mu.Lock()
+	if c.semester.batch.State != db.SemesterRunning {
+		c.semester.mu.Unlock()
+		respondError(w, http.StatusConflict, "no batch is running")
+		return
+	}
+	c.semester.mu.Unlock()
+	var status semesterStatusResponse
+	c.updateSemester(func(s *semesterRun) {
+		s.batch.State = db.SemesterPaused
+		status = s.snapshot()
+	})
+	c.audit(r.Context(), "semester.pause", fmt.Sprintf("batch %d", status.ID), "")
+	respondJSON(w, http.StatusOK, status)
+}
+
+// ResumeSemester runs a paused batch again for the robots that hadn't
+// finished, skipping the steps each already completed.
+func (c *Controller) ResumeSemester(w http.ResponseWriter, r *http.Request) {
+	c.semester.mu.Lock()
+	if c.semester.active {
+		c.semester.mu.Unlock()
+		respondError(w, http.StatusConflict, "the batch is still pausing; wait for its robots to finish their current step")
+		return
+	}
+	if c.semester.batch.State != db.SemesterPaused {
+		c.semester.mu.Unlock()
+		respondError(w, http.StatusConflict, "no batch is paused")
+		return
+	}
+	batch := c.semester.batch
+	c.semester.mu.Unlock()
+
+	var req semesterRequest
+	if err := json.Unmarshal([]byte(batch.Request), &req); err != nil {
+		logging.FromContext(r.Context()).Error("semester: invalid saved request", "batch", batch.ID, "err", err)
+		respondError(w, http.StatusInternalServerError, "saved batch request is unreadable")
+		return
+	}
+	// Scenarios are loaded again, since they may have been fixed while the
+	// batch was paused.
+	if err := c.resolveSemesterSteps(r.Context(), &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	batchStatus.Active = true
-	batchStatus.Total = len(req.RobotIDs)
-	batchStatus.Completed = 0
-	batchStatus.Robots = make(map[int64]string)
-	batchStatus.Errors = make(map[int64]string)
+	var remaining []int64
 	for _, id := range req.RobotIDs {
-		batchStatus.Robots[id] = "pending"
+		if !semesterRobotFinished(batch.Robots[id]) {
+			remaining = append(remaining, id)
+		}
 	}
-	batchStatus.Unlock()
+	req.RobotIDs = remaining
 
-	scheme := "http"
-	if r.TLS != nil {
-		scheme = "https"
+	c.semester.mu.Lock()
+	if c.semester.active || c.semester.batch.State != db.SemesterPaused {
+		c.semester.mu.Unlock()
+		respondError(w, http.StatusConflict, "the batch changed; try again")
+		return
 	}
-	baseURL := fmt.Sprintf("%s://%s", scheme, r.Host)
+	ctx := c.runSemesterLocked(context.WithoutCancel(r.Context()))
+	c.semester.mu.Unlock()
+	var status semesterStatusResponse
+	c.updateSemester(func(s *semesterRun) {
+		s.batch.State = db.SemesterRunning
+		for _, id := range remaining {
+			s.batch.Robots[id] = "pending"
+		}
+		status = s.snapshot()
+	})
+	c.audit(r.Context(), "semester.resume", fmt.Sprintf("batch %d", status.ID), fmt.Sprintf("%d robots left", len(remaining)))
 
-	go c.processSemesterBatch(req, baseURL)
+	go c.processSemesterBatch(ctx, req, batch.BaseURL)
+	respondJSON(w, http.StatusOK, status)
+}
 
-	w.WriteHeader(http.StatusAccepted)
-	json.NewEncoder(w).Encode(map[string]string{"status": "accepted"})
+// CancelSemester ends a running or paused batch. Robots that hadn't
+// finished are marked cancelled; commands already sent to them still run.
+func (c *Controller) CancelSemester(w http.ResponseWriter, r *http.Request) {
+	c.semester.mu.Lock()
+	if state := c.semester.batch.State; state != db.SemesterRunning && state != db.SemesterPaused {
+		c.semester.mu.Unlock()
+		respondError(w, http.StatusConflict, "no batch is running or paused")
+		return
+	}
+	c.semester.mu.Unlock()
+	var status semesterStatusResponse
+	c.updateSemester(func(s *semesterRun) {
+		s.batch.State = db.SemesterCancelled
+		now := time.Now().UTC()
+		s.batch.FinishedAt = &now
+		for id, state := range s.batch.Robots {
+			if !semesterRobotFinished(state) {
+				s.batch.Robots[id] = "cancelled"
+			}
+		}
+		if s.cancel != nil {
+			s.cancel()
+		}
+		status = s.snapshot()
+	})
+	c.audit(r.Context(), "semester.cancel", fmt.Sprintf("batch %d", status.ID), "")
+	respondJSON(w, http.StatusOK, status)
 }
 
-func (c *Controller) processSemesterBatch(req semesterRequest, baseURL string) {
+// RecoverSemesterBatch loads the latest batch at startup. One that was
+// running when the controller stopped is paused, so it can be resumed.
+func (c *Controller) RecoverSemesterBatch(ctx context.Context) {
+	batch, err := c.DB.LatestSemesterBatch(ctx)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error("semester: load latest batch", "err", err)
+		}
+		return
+	}
+	c.semester.mu.Lock()
+	defer c.semester.mu.Unlock()
+	c.semester.batch = batch
+	if batch.State != db.SemesterRunning {
+		return
+	}
+	c.semester.batch.State = db.SemesterPaused
+	for id, state := range batch.Robots {
+		if !semesterRobotFinished(state) {
+			c.semester.batch.Robots[id] = "paused"
+		}
+	}
+	if err := c.DB.UpdateSemesterBatch(ctx, c.semester.batch); err != nil {
+		slog.Error("semester: pause interrupted batch", "batch", batch.ID, "err", err)
+		return
+	}
+	slog.Warn("semester batch was interrupted by a restart and is paused", "batch", batch.ID, "completed", batch.Completed, "total", batch.Total)
+}
+
+func (c *Controller) processSemesterBatch(ctx context.Context, req semesterRequest, baseURL string) {
 	defer func() {
-		batchStatus.Lock()
-		batchStatus.Active = false
-		batchStatus.Unlock()
+		c.updateSemester(func(s *semesterRun) {
+			s.active = false
+			s.cancel = nil
+			if s.batch.State == db.SemesterRunning {
+				s.batch.State = db.SemesterCompleted
+				now := time.Now().UTC()
+				s.batch.FinishedAt = &now
+			}
+		})
 	}()
 
-	ctx := context.Background()
-	log.Printf("starting semester batch for %d robots", len(req.RobotIDs))
-
-	workspace := os.Getenv("AGENT_WORKSPACE_PATH")
-	if workspace == "" {
-		workspace = "/home/ubuntu/ros_ws/src/course"
-	}
-	broker := agentBrokerURL()
+	logger := logging.FromContext(ctx)
+	logger.Info("starting semester batch", "robots", len(req.RobotIDs), "steps", len(req.Steps))
 
 	var wg sync.WaitGroup
 	for _, id := range req.RobotIDs {
 		wg.Add(1)
 		go func(id int64) {
 			defer wg.Done()
-
-			batchStatus.Lock()
-			batchStatus.Robots[id] = "processing"
-			batchStatus.Unlock()
+			if c.semesterHalted(id) {
+				return
+			}
+			c.semesterStep(id, "processing")
 
 			robot, err := c.DB.GetRobotByID(ctx, id)
 			if err != nil {
-				log.Printf("semester: failed to get robot %d: %v", id, err)
-				batchStatus.Lock()
-				batchStatus.Errors[id] = "robot not found"
-				batchStatus.Robots[id] = "error"
-				batchStatus.Completed++
-				batchStatus.Unlock()
+				logger.Error("semester: failed to get robot", "robot_id", id, "err", err)
+				c.semesterFail(id, "robot not found")
 				return
 			}
 
-			if req.Reinstall {
-				if robot.InstallConfig == nil || robot.InstallConfig.Address == "" {
-					// Try to use default install config if robot-specific one is missing
-					defaultCfg, err := c.DB.GetDefaultInstallConfig(ctx)
-					if err == nil && defaultCfg != nil {
-						if robot.InstallConfig == nil {
-							robot.InstallConfig = &db.InstallConfig{}
-						}
-						if robot.InstallConfig.User == "" {
-							robot.InstallConfig.User = defaultCfg.User
-						}
-						if robot.InstallConfig.SSHKey == "" {
-							robot.InstallConfig.SSHKey = defaultCfg.SSHKey
-						}
-					}
-					// If address is still missing, try to use the robot's IP
-					if (robot.InstallConfig == nil || robot.InstallConfig.Address == "") && robot.IP != "" {
-						if robot.InstallConfig == nil {
-							robot.InstallConfig = &db.InstallConfig{}
-						}
-						robot.InstallConfig.Address = robot.IP
-					}
+			for i, step := range req.Steps {
+				key := fmt.Sprintf("%d:%s", i, step.Type)
+				if c.semesterStepDone(id, key) {
+					continue
+				}
+				if c.semesterHalted(id) {
+					return
+				}
+				record := c.startSemesterStepRecord(ctx, robot, i, step)
+				ok := c.runSemesterStep(ctx, robot, id, step, i < len(req.Steps)-1, baseURL)
+				c.finishSemesterStepRecord(ctx, id, record, ok)
+				if !ok {
+					return
 				}
+				c.semesterFinishStep(id, key)
+			}
 
-				if robot.InstallConfig == nil || robot.InstallConfig.Address == "" || robot.InstallConfig.User == "" || robot.InstallConfig.SSHKey == "" {
-					// If we are in demo mode, we can fake success for reinstall
-					if os.Getenv("DEMO_MODE") == "true" {
-						log.Printf("semester: demo mode, skipping reinstall for %s", robot.Name)
-						// Fall through to other steps
-					} else {
-						log.Printf("semester: robot %d missing install config (addr=%v, user=%v, key_len=%d)", id,
-							robot.InstallConfig != nil && robot.InstallConfig.Address != "",
-							robot.InstallConfig != nil && robot.InstallConfig.User != "",
-							func() int {
-								if robot.InstallConfig != nil {
-									return len(robot.InstallConfig.SSHKey)
-								}
-								return 0
-							}())
-						batchStatus.Lock()
-						batchStatus.Errors[id] = "missing install config"
-						batchStatus.Robots[id] = "error"
-						batchStatus.Completed++
-						batchStatus.Unlock()
-						return
-					}
-				} else {
-					log.Printf("semester: reinstalling agent on %s", robot.Name)
-					batchStatus.Lock()
-					batchStatus.Robots[id] = "installing_agent"
-					batchStatus.Unlock()
-
-					addr := robot.InstallConfig.Address
-					if robot.IP != "" {
-						addr = robot.IP
-					}
-					if !strings.Contains(addr, ":") {
-						addr = net.JoinHostPort(addr, "22")
-					}
+			c.updateSemester(func(s *semesterRun) {
+				if !semesterRobotFinished(s.batch.Robots[id]) {
+					s.batch.Robots[id] = "success"
+					s.batch.Completed++
+				}
+			})
+		}(id)
+	}
+	wg.Wait()
+	logger.Info("semester batch complete")
+}
 
-					// Default sudo logic from install_agent.go
-					useSudo := strings.ToLower(robot.InstallConfig.User) != "root"
-					sudoPwd := os.Getenv("AGENT_SUDO_PASSWORD")
-					if useSudo && sudoPwd == "" {
-						sudoPwd = "ubuntu"
-					}
+// startSemesterStepRecord saves that robot has started step i, returning
+// the record's id, or 0 if it couldn't be saved. The batch carries on
+// either way.
+func (c *Controller) startSemesterStepRecord(ctx context.Context, robot db.Robot, i int, step semesterStep) int64 {
+	c.semester.mu.Lock()
+	batchID := c.semester.batch.ID
+	c.semester.mu.Unlock()
+	id, err := c.DB.StartSemesterStep(context.WithoutCancel(ctx), db.SemesterStepRun{
+		BatchID:   batchID,
+		RobotID:   robot.ID,
+		RobotName: robot.Name,
+		Index:     i,
+		Type:      step.Type,
+		Label:     step.label(),
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("semester: failed to record step", "robot", robot.Name, "step", step.label(), "err", err)
+		return 0
+	}
+	return id
+}
 
-					cfg := agent.Config{
-						AgentID:        robot.Name, // Use name as AgentID for consistency
-						MQTTBroker:     broker,
-						WorkspacePath:  workspace,
-						WorkspaceOwner: determineWorkspaceOwner(installAgentRequest{User: robot.InstallConfig.User}),
-					}
+// finishSemesterStepRecord saves how the step in record ended for robot id.
+func (c *Controller) finishSemesterStepRecord(ctx context.Context, id, record int64, ok bool) {
+	if record == 0 {
+		return
+	}
+	status, msg := db.SemesterStepSucceeded, ""
+	if !ok {
+		c.semester.mu.Lock()
+		status = db.SemesterStepFailed
+		if c.semester.batch.Robots[id] == "cancelled" {
+			status = db.SemesterStepCancelled
+		}
+		msg = c.semester.batch.Errors[id]
+		c.semester.mu.Unlock()
+	}
+	if err := c.DB.FinishSemesterStep(context.WithoutCancel(ctx), record, status, msg); err != nil {
+		logging.FromContext(ctx).Error("semester: failed to record step result", "record", record, "err", err)
+	}
+}
 
-					host := sshc.HostSpec{
-						Addr:         addr,
-						User:         robot.InstallConfig.User,
-						PrivateKey:   []byte(robot.InstallConfig.SSHKey),
-						UseSudo:      useSudo,
-						SudoPassword: sudoPwd,
-					}
+// runSemesterStep runs one step on robot and waits for it to finish. It
+// reports whether the robot may go on; a failed step has already failed
+// the robot. more is set when other steps follow.
+func (c *Controller) runSemesterStep(ctx context.Context, robot db.Robot, id int64, step semesterStep, more bool, baseURL string) bool {
+	timeout := step.timeout()
+	switch step.Type {
+	case semesterReinstall:
+		return c.semesterReinstall(ctx, robot, id, step, more)
+	case semesterResetLogs:
+		return c.semesterCommand(ctx, robot, id, step, agent.Command{Type: "reset_logs", Data: []byte("{}")}, timeout)
+	case semesterUpdateRepo:
+		data, _ := json.Marshal(step.RepoConfig)
+		return c.semesterCommand(ctx, robot, id, step, agent.Command{Type: "update_repo", Data: data}, timeout)
+	case semesterApplyScenarios:
+		return c.semesterScenarios(ctx, robot, id, step, timeout)
+	case semesterSelfTest:
+		return c.semesterSelfTest(ctx, robot, id, step, timeout, baseURL)
+	case semesterCustomCommand:
+		data := step.Data
+		if len(data) == 0 {
+			data = []byte("{}")
+		}
+		return c.semesterCommand(ctx, robot, id, step, agent.Command{Type: step.Command, Data: data}, timeout)
+	}
+	c.semesterFail(id, "unknown step "+step.Type)
+	return false
+}
 
-					arch, err := sshc.DetectArch(host)
-					if err != nil {
-						log.Printf("semester: failed to detect arch for %s: %v", robot.Name, err)
-						batchStatus.Lock()
-						batchStatus.Errors[id] = "failed to detect arch: " + err.Error()
-						batchStatus.Robots[id] = "error"
-						batchStatus.Completed++
-						batchStatus.Unlock()
-						return
-					}
+// semesterCommand sends cmd for step and waits for it.
+func (c *Controller) semesterCommand(ctx context.Context, robot db.Robot, id int64, step semesterStep, cmd agent.Command, timeout time.Duration) bool {
+	logger := logging.FromContext(ctx)
+	logger.Info("semester: running step", "robot", robot.Name, "step", step.label(), "command", cmd.Type)
+	c.semesterStep(id, step.label())
+	job, err := c.queueRobotCommand(ctx, robot, cmd)
+	if err != nil {
+		logger.Error("semester: failed to queue command", "robot", robot.Name, "command", cmd.Type, "err", err)
+		c.semesterFail(id, "failed to queue "+cmd.Type)
+		return false
+	}
+	if msg := c.waitForJob(ctx, robot, job, cmd.Type, timeout); msg != "" {
+		logger.Warn("semester: step did not succeed", "robot", robot.Name, "command", cmd.Type, "reason", msg)
+		c.semesterFail(id, msg)
+		return false
+	}
+	return true
+}
 
-					binaryDir := os.Getenv("AGENT_BINARY_DIR")
-					if binaryDir == "" {
-						binaryDir = "/app"
-					}
-					binaryName := "agent-amd64"
-					if arch == "arm64" {
-						binaryName = "agent-arm64"
-					}
-					binaryPath := filepath.Join(binaryDir, binaryName)
-					binary, err := os.ReadFile(binaryPath)
-					if err != nil {
-						log.Printf("semester: failed to read agent binary: %v", err)
-						batchStatus.Lock()
-						batchStatus.Errors[id] = "agent binary unavailable"
-						batchStatus.Robots[id] = "error"
-						batchStatus.Completed++
-						batchStatus.Unlock()
-						return
-					}
+// semesterReinstall installs the agent again over SSH and, if more steps
+// follow, waits for it to reconnect.
+func (c *Controller) semesterReinstall(ctx context.Context, robot db.Robot, id int64, step semesterStep, waitReconnect bool) bool {
+	logger := logging.FromContext(ctx)
+	workspace := os.Getenv("AGENT_WORKSPACE_PATH")
+	if workspace == "" {
+		workspace = "/home/ubuntu/ros_ws/src/course"
+	}
+	broker := agentBrokerURL()
 
-					installStart := time.Now()
-					if err := sshc.InstallAgent(host, cfg, binary); err != nil {
-						log.Printf("semester: failed to install agent on %s: %v", robot.Name, err)
-						batchStatus.Lock()
-						msg := fmt.Sprintf("install failed: %v", err)
-						if strings.Contains(err.Error(), "connection refused") || strings.Contains(err.Error(), "no route to host") || strings.Contains(err.Error(), "i/o timeout") {
-							msg = "Connection failed. Check connection or restart robot."
-						}
-						batchStatus.Errors[id] = msg
-						batchStatus.Robots[id] = "error"
-						batchStatus.Completed++
-						batchStatus.Unlock()
-						return
-					}
+	if robot.InstallConfig == nil || robot.InstallConfig.Address == "" {
+		// Try to use default install config if robot-specific one is missing
+		defaultCfg, err := c.DB.GetDefaultInstallConfig(ctx)
+		if err == nil && defaultCfg != nil {
+			if robot.InstallConfig == nil {
+				robot.InstallConfig = &db.InstallConfig{}
+			}
+			if robot.InstallConfig.User == "" {
+				robot.InstallConfig.User = defaultCfg.User
+			}
+			if robot.InstallConfig.SSHKey == "" {
+				robot.InstallConfig.SSHKey = defaultCfg.SSHKey
+				robot.InstallConfig.KeyPassphrase = defaultCfg.KeyPassphrase
+			}
+		}
+		// If address is still missing, try to use the robot's IP
+		if (robot.InstallConfig == nil || robot.InstallConfig.Address == "") && robot.IP != "" {
+			if robot.InstallConfig == nil {
+				robot.InstallConfig = &db.InstallConfig{}
+			}
+			robot.InstallConfig.Address = robot.IP
+		}
+	}
 
-					// Wait for reconnect
-					if req.ResetLogs || req.UpdateRepo || req.ApplyScenarios {
-						log.Printf("semester: waiting for %s to reconnect...", robot.Name)
-						batchStatus.Lock()
-						batchStatus.Robots[id] = "waiting_for_connection"
-						batchStatus.Unlock()
-
-						connected := false
-						for i := 0; i < 60; i++ {
-							time.Sleep(1 * time.Second)
-							updated, err := c.DB.GetRobotByID(ctx, id)
-							if err == nil && updated.LastSeen.After(installStart) {
-								connected = true
-								break
-							}
-						}
-						if !connected {
-							log.Printf("semester: timeout waiting for %s to reconnect", robot.Name)
-							batchStatus.Lock()
-							batchStatus.Errors[id] = "reconnect timeout"
-							batchStatus.Robots[id] = "error"
-							batchStatus.Completed++
-							batchStatus.Unlock()
-							return
-						}
+	if robot.InstallConfig == nil || robot.InstallConfig.Address == "" || robot.InstallConfig.User == "" || (robot.InstallConfig.SSHKey == "" && sshc.AgentSocket() == "") {
+		// If we are in demo mode, we can fake success for reinstall
+		if os.Getenv("DEMO_MODE") == "true" {
+			logger.Info("semester: demo mode, skipping reinstall", "robot", robot.Name)
+			// Fall through to other steps
+		} else {
+			logger.Warn("semester: robot missing install config", "robot_id", id,
+				"has_address", robot.InstallConfig != nil && robot.InstallConfig.Address != "",
+				"has_user", robot.InstallConfig != nil && robot.InstallConfig.User != "",
+				"key_len", func() int {
+					if robot.InstallConfig != nil {
+						return len(robot.InstallConfig.SSHKey)
 					}
-				}
-			}
+					return 0
+				}())
+			c.semesterFail(id, "missing install config")
+			return false
+		}
+	} else {
+		logger.Info("semester: reinstalling agent", "robot", robot.Name)
+		c.semesterStep(id, step.label())
 
-			if req.ResetLogs {
-				log.Printf("semester: resetting logs for %s", robot.Name)
-				batchStatus.Lock()
-				batchStatus.Robots[id] = "resetting_logs"
-				batchStatus.Unlock()
-
-				cmd := agent.Command{Type: "reset_logs", Data: []byte("{}")}
-				if _, err := c.queueRobotCommand(ctx, robot, cmd); err != nil {
-					log.Printf("semester: failed to queue reset_logs for %s: %v", robot.Name, err)
-					batchStatus.Lock()
-					batchStatus.Errors[id] = "failed to queue reset_logs"
-					batchStatus.Robots[id] = "error"
-					batchStatus.Completed++
-					batchStatus.Unlock()
-					return
-				}
+		addr := robot.InstallConfig.Address
+		if robot.IP != "" {
+			addr = robot.IP
+		}
+		if !strings.Contains(addr, ":") {
+			addr = net.JoinHostPort(addr, "22")
+		}
+
+		// Default sudo logic from install_agent.go
+		useSudo := strings.ToLower(robot.InstallConfig.User) != "root"
+		sudoPwd := os.Getenv("AGENT_SUDO_PASSWORD")
+		if useSudo && sudoPwd == "" {
+			sudoPwd = "ubuntu"
+		}
+
+		cfg := agent.Config{
+			AgentID:        robot.Name, // Use name as AgentID for consistency
+			MQTTBroker:     broker,
+			WorkspacePath:  workspace,
+			WorkspaceOwner: determineWorkspaceOwner(installAgentRequest{User: robot.InstallConfig.User}),
+		}
+
+		host := sshc.HostSpec{
+			Addr:          addr,
+			User:          robot.InstallConfig.User,
+			PrivateKey:    []byte(robot.InstallConfig.SSHKey),
+			KeyPassphrase: robot.InstallConfig.KeyPassphrase,
+			UseSudo:       useSudo,
+			SudoPassword:  sudoPwd,
+		}
+		c.pinRobotHostKey(ctx, robot.ID, &host)
+
+		arch, err := sshc.DetectArch(host)
+		if err != nil {
+			logger.Error("semester: failed to detect arch", "robot", robot.Name, "err", err)
+			c.semesterFail(id, "failed to detect arch: "+err.Error())
+			return false
+		}
+
+		binary, err := readAgentBinary(arch)
+		if err != nil {
+			logger.Error("semester: failed to read agent binary", "err", err)
+			c.semesterFail(id, "agent binary unavailable")
+			return false
+		}
+
+		installStart := time.Now()
+		if err := sshc.InstallAgent(host, cfg, binary); err != nil {
+			logger.Error("semester: failed to install agent", "robot", robot.Name, "err", err)
+			msg := fmt.Sprintf("install failed: %v", err)
+			if strings.Contains(err.Error(), "connection refused") || strings.Contains(err.Error(), "no route to host") || strings.Contains(err.Error(), "i/o timeout") {
+				msg = "Connection failed. Check connection or restart robot."
 			}
+			c.semesterFail(id, msg)
+			return false
+		}
 
-			if req.UpdateRepo {
-				log.Printf("semester: updating repo for %s", robot.Name)
-				batchStatus.Lock()
-				batchStatus.Robots[id] = "updating_repo"
-				batchStatus.Unlock()
-
-				data, _ := json.Marshal(req.RepoConfig)
-				cmd := agent.Command{Type: "update_repo", Data: data}
-				if _, err := c.queueRobotCommand(ctx, robot, cmd); err != nil {
-					log.Printf("semester: failed to queue update_repo for %s: %v", robot.Name, err)
-					batchStatus.Lock()
-					batchStatus.Errors[id] = "failed to queue update_repo"
-					batchStatus.Robots[id] = "error"
-					batchStatus.Completed++
-					batchStatus.Unlock()
-					return
+		// Wait for reconnect
+		if waitReconnect {
+			logger.Info("semester: waiting for robot to reconnect", "robot", robot.Name)
+			c.semesterStep(id, "waiting_for_connection")
+
+			connected := false
+			for i := 0; i < 60; i++ {
+				time.Sleep(1 * time.Second)
+				updated, err := c.DB.GetRobotByID(ctx, id)
+				if err == nil && updated.LastSeen.After(installStart) {
+					connected = true
+					break
 				}
 			}
+			if !connected {
+				logger.Warn("semester: timeout waiting for robot to reconnect", "robot", robot.Name)
+				c.semesterFail(id, "reconnect timeout")
+				return false
+			}
+		}
+	}
+	return true
+}
 
-			if req.ApplyScenarios {
-				log.Printf("semester: applying scenarios for %s", robot.Name)
-				batchStatus.Lock()
-				batchStatus.Robots[id] = "applying_scenarios"
-				batchStatus.Unlock()
+// semesterScenarios applies the step's scenarios as one batch command.
+func (c *Controller) semesterScenarios(ctx context.Context, robot db.Robot, id int64, step semesterStep, timeout time.Duration) bool {
+	logger := logging.FromContext(ctx)
+	logger.Info("semester: applying scenarios", "robot", robot.Name)
+	c.semesterStep(id, step.label())
+
+	// Scenarios the robot doesn't meet the requirements of are
+	// left out and noted; the rest still run.
+	var commands []agent.Command
+	var steps []agent.BatchStep
+	var skipped []string
+	var applied []int64
+	for _, sc := range step.scenarios {
+		if reasons := sc.Spec.Requires.Unmet(robot); len(reasons) > 0 {
+			skipped = append(skipped, fmt.Sprintf("skipped %s: %s", sc.Name, strings.Join(reasons, ", ")))
+			continue
+		}
+		cmds, opts, err := sc.Spec.Pipeline(robot)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("skipped %s: %v", sc.Name, err))
+			continue
+		}
+		// Keep each scenario's step options lined up with its
+		// commands; scenarios without steps get the defaults.
+		if opts == nil {
+			opts = make([]agent.BatchStep, len(cmds))
+		}
+		commands = append(commands, cmds...)
+		steps = append(steps, opts...)
+		applied = append(applied, sc.ID)
+	}
+	if len(skipped) > 0 {
+		logger.Warn("semester: robot doesn't meet scenario requirements", "robot", robot.Name, "skipped", skipped)
+		c.updateSemester(func(s *semesterRun) { s.batch.Errors[id] = strings.Join(skipped, "; ") })
+	}
 
-				var commands []agent.Command
-				for _, config := range req.ScenarioConfigs {
-					data, _ := json.Marshal(config)
-					commands = append(commands, agent.Command{Type: "update_repo", Data: data})
-				}
+	if len(commands) > 0 {
+		batchData := agent.BatchData{Commands: commands, Steps: steps}
+		batchPayload, _ := json.Marshal(batchData)
+		cmd := agent.Command{Type: "batch", Data: batchPayload}
 
-				batchData := agent.BatchData{Commands: commands}
-				batchPayload, _ := json.Marshal(batchData)
-				cmd := agent.Command{Type: "batch", Data: batchPayload}
-
-				if _, err := c.queueRobotCommand(ctx, robot, cmd); err != nil {
-					log.Printf("semester: failed to queue batch scenarios for %s: %v", robot.Name, err)
-					batchStatus.Lock()
-					batchStatus.Errors[id] = "failed to queue batch scenarios"
-					batchStatus.Robots[id] = "error"
-					batchStatus.Completed++
-					batchStatus.Unlock()
-					return
-				}
+		job, err := c.queueRobotCommand(ctx, robot, cmd)
+		if err != nil {
+			logger.Error("semester: failed to queue batch scenarios", "robot", robot.Name, "err", err)
+			c.semesterFail(id, "failed to queue batch scenarios")
+			return false
+		}
 
-				// Update DB to reflect the last scenario applied
-				if len(req.ScenarioIDs) > 0 {
-					lastID := req.ScenarioIDs[len(req.ScenarioIDs)-1]
-					if err := c.DB.UpdateRobotScenario(ctx, id, lastID); err != nil {
-						log.Printf("semester: failed to update robot scenario for %s: %v", robot.Name, err)
-					}
-				}
-			}
+		// Update DB to reflect the last scenario applied
+		if err := c.DB.UpdateRobotScenario(ctx, id, applied[len(applied)-1]); err != nil {
+			logger.Error("semester: failed to update robot scenario", "robot", robot.Name, "err", err)
+		}
+		for _, sid := range applied {
+			c.recordScenarioApply(ctx, sid, robot, job)
+		}
+		if msg := c.waitForJob(ctx, robot, job, "scenarios", timeout); msg != "" {
+			logger.Warn("semester: scenarios did not succeed", "robot", robot.Name, "reason", msg)
+			c.semesterFail(id, msg)
+			return false
+		}
+	}
+	return true
+}
 
-			if req.RunSelfTest {
-				log.Printf("semester: running self test for %s", robot.Name)
-				batchStatus.Lock()
-				batchStatus.Robots[id] = "running_self_test"
-				batchStatus.Unlock()
-
-				// Test Drive
-				driveData, _ := json.Marshal(agent.TestDriveData{DurationSec: 2})
-				cmdDrive := agent.Command{Type: "test_drive", Data: driveData}
-				if _, err := c.queueRobotCommand(ctx, robot, cmdDrive); err != nil {
-					log.Printf("semester: failed to queue test_drive for %s: %v", robot.Name, err)
-					batchStatus.Lock()
-					batchStatus.Errors[id] = "failed to queue test_drive"
-					batchStatus.Robots[id] = "error"
-					batchStatus.Completed++
-					batchStatus.Unlock()
-					return
-				}
+// semesterSelfTest drives the robot briefly and takes a snapshot.
+func (c *Controller) semesterSelfTest(ctx context.Context, robot db.Robot, id int64, step semesterStep, timeout time.Duration, baseURL string) bool {
+	logger := logging.FromContext(ctx)
+	logger.Info("semester: running self test", "robot", robot.Name)
+	c.semesterStep(id, step.label())
+
+	// Test Drive
+	driveData, _ := json.Marshal(agent.TestDriveData{DurationSec: 2})
+	cmdDrive := agent.Command{Type: "test_drive", Data: driveData}
+	job, err := c.queueRobotCommand(ctx, robot, cmdDrive)
+	if err != nil {
+		logger.Error("semester: failed to queue test_drive", "robot", robot.Name, "err", err)
+		c.semesterFail(id, "failed to queue test_drive")
+		return false
+	}
+	if msg := c.waitForJob(ctx, robot, job, "test_drive", timeout); msg != "" {
+		logger.Warn("semester: test_drive did not succeed", "robot", robot.Name, "reason", msg)
+		c.semesterFail(id, msg)
+		return false
+	}
 
-				// Capture Image
-				uploadURL := fmt.Sprintf("%s/api/robots/%d/upload", baseURL, id)
-				captureData, _ := json.Marshal(agent.CaptureImageData{UploadURL: uploadURL})
-				cmdCapture := agent.Command{Type: "capture_image", Data: captureData}
-				if _, err := c.queueRobotCommand(ctx, robot, cmdCapture); err != nil {
-					log.Printf("semester: failed to queue capture_image for %s: %v", robot.Name, err)
-					batchStatus.Lock()
-					batchStatus.Errors[id] = "failed to queue capture_image"
-					batchStatus.Robots[id] = "error"
-					batchStatus.Completed++
-					batchStatus.Unlock()
-					return
-				}
-			}
+	// Capture Image, kept in the robot's snapshot history
+	snap, err := c.takeSnapshot(ctx, robot, nil, baseURL)
+	if err != nil {
+		logger.Error("semester: failed to request snapshot", "robot", robot.Name, "err", err)
+		c.semesterFail(id, "failed to queue capture_image")
+		return false
+	}
+	if snap.Status == db.SnapshotFailed || snap.JobID == nil {
+		c.semesterFail(id, "capture_image failed: "+snap.Error)
+		return false
+	}
+	if msg := c.waitForJob(ctx, robot, db.Job{ID: *snap.JobID}, "capture_image", timeout); msg != "" {
+		logger.Warn("semester: capture_image did not succeed", "robot", robot.Name, "reason", msg)
+		c.semesterFail(id, msg)
+		return false
+	}
+	return true
+}
 
-			batchStatus.Lock()
-			batchStatus.Robots[id] = "success"
-			batchStatus.Completed++
-			batchStatus.Unlock()
-		}(id)
+// waitForJob waits until the robot reports job finished and returns why the
+// step failed, or "" if it succeeded.
+func (c *Controller) waitForJob(ctx context.Context, robot db.Robot, job db.Job, step string, timeout time.Duration) string {
+	deadline := time.Now().Add(timeout)
+	for {
+		current, err := c.DB.GetJob(ctx, job.ID)
+		if err != nil {
+			logging.FromContext(ctx).Error("semester: failed to load job", "job_id", job.ID, "err", err)
+		}
+		switch current.Status {
+		case "success":
+			return ""
+		case "failed":
+			msg := step + " failed"
+			if state := c.GetRobotJobStatus(robot.AgentID); state.JobID == strconv.FormatInt(job.ID, 10) && state.JobError != "" {
+				msg += ": " + state.JobError
+			}
+			return msg
+		case "expired":
+			return step + " expired before the robot ran it"
+		}
+		if time.Now().After(deadline) {
+			return fmt.Sprintf("%s did not finish within %s", step, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return step + " cancelled"
+		case <-time.After(semesterJobPollInterval):
+		}
 	}
-	wg.Wait()
-	log.Printf("semester batch complete")
 }
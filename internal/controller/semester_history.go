@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+const (
+	defaultSemesterHistoryLimit = 20
+	maxSemesterHistoryLimit     = 200
+)
+
+// semesterBatchSummary is a past or current batch in the history list.
+type semesterBatchSummary struct {
+	ID        int64  `json:"id"`
+	State     string `json:"state"`
+	Total     int    `json:"total"`
+	Completed int    `json:"completed"`
+	Failed    int    `json:"failed"`
+	// Steps are the labels of the steps the batch ran, in order.
+	Steps      []string   `json:"steps"`
+	TemplateID int64      `json:"template_id,omitempty"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// DurationSec is from start to finish, or so far for a batch that
+	// hasn't finished.
+	DurationSec int `json:"duration_sec"`
+}
+
+// semesterStepStats sums up how one step of a batch went across robots.
+type semesterStepStats struct {
+	Index          int     `json:"index"`
+	Type           string  `json:"type"`
+	Label          string  `json:"label"`
+	Succeeded      int     `json:"succeeded"`
+	Failed         int     `json:"failed"`
+	AvgDurationSec float64 `json:"avg_duration_sec"`
+	MaxDurationSec float64 `json:"max_duration_sec"`
+}
+
+// semesterBatchRobot is how far one robot got in a batch.
+type semesterBatchRobot struct {
+	RobotID int64                `json:"robot_id"`
+	Name    string               `json:"name"`
+	State   string               `json:"state"`
+	Error   string               `json:"error,omitempty"`
+	Steps   []db.SemesterStepRun `json:"steps"`
+}
+
+type semesterBatchDetail struct {
+	semesterBatchSummary
+	Request   semesterRequest      `json:"request"`
+	StepStats []semesterStepStats  `json:"step_stats"`
+	Robots    []semesterBatchRobot `json:"robots"`
+}
+
+// ListSemesterBatches returns recent semester batches, newest first.
+// ?limit= caps how many (default 20).
+func (c *Controller) ListSemesterBatches(w http.ResponseWriter, r *http.Request) {
+	limit := defaultSemesterHistoryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSemesterHistoryLimit {
+			respondError(w, http.StatusBadRequest, "limit must be between 1 and 200")
+			return
+		}
+		limit = n
+	}
+	batches, err := c.DB.ListSemesterBatches(r.Context(), limit)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list semester batches", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load semester batches")
+		return
+	}
+	out := make([]semesterBatchSummary, 0, len(batches))
+	for _, b := range batches {
+		out = append(out, summarizeSemesterBatch(b, savedSemesterRequest(b)))
+	}
+	respondJSON(w, http.StatusOK, out)
+}
+
+// GetSemesterBatch returns one batch with the request it was started with,
+// each robot's steps and how long each step took.
+func (c *Controller) GetSemesterBatch(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/semester/batches/"), "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid batch id")
+		return
+	}
+	b, err := c.DB.GetSemesterBatch(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "semester batch not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("get semester batch", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load semester batch")
+		return
+	}
+	steps, err := c.DB.ListSemesterSteps(r.Context(), id)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list semester steps", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load semester batch")
+		return
+	}
+	req := savedSemesterRequest(b)
+	detail := semesterBatchDetail{
+		semesterBatchSummary: summarizeSemesterBatch(b, req),
+		Request:              req,
+		StepStats:            make([]semesterStepStats, len(req.Steps)),
+		Robots:               []semesterBatchRobot{},
+	}
+	for i, step := range req.Steps {
+		detail.StepStats[i] = semesterStepStats{Index: i, Type: step.Type, Label: step.label()}
+	}
+	byRobot := map[int64]*semesterBatchRobot{}
+	for _, robotID := range req.RobotIDs {
+		detail.Robots = append(detail.Robots, semesterBatchRobot{RobotID: robotID, State: b.Robots[robotID], Error: b.Errors[robotID], Steps: []db.SemesterStepRun{}})
+	}
+	for i := range detail.Robots {
+		byRobot[detail.Robots[i].RobotID] = &detail.Robots[i]
+	}
+	for _, s := range steps {
+		rb := byRobot[s.RobotID]
+		if rb == nil {
+			continue
+		}
+		rb.Name = s.RobotName
+		rb.Steps = append(rb.Steps, s)
+		if s.Index < 0 || s.Index >= len(detail.StepStats) || s.FinishedAt == nil {
+			continue
+		}
+		st := &detail.StepStats[s.Index]
+		switch s.Status {
+		case db.SemesterStepSucceeded:
+			st.Succeeded++
+			sec := s.FinishedAt.Sub(s.StartedAt).Seconds()
+			st.AvgDurationSec += sec
+			st.MaxDurationSec = max(st.MaxDurationSec, sec)
+		case db.SemesterStepFailed:
+			st.Failed++
+		}
+	}
+	for i := range detail.StepStats {
+		if st := &detail.StepStats[i]; st.Succeeded > 0 {
+			st.AvgDurationSec /= float64(st.Succeeded)
+		}
+	}
+	for i := range detail.Robots {
+		if rb := &detail.Robots[i]; rb.Name == "" {
+			if robot, err := c.DB.GetRobotByID(r.Context(), rb.RobotID); err == nil {
+				rb.Name = robot.Name
+			}
+		}
+	}
+	respondJSON(w, http.StatusOK, detail)
+}
+
+// savedSemesterRequest reads the request a batch was started with. Batches
+// saved before steps were recorded derive them from the flags.
+func savedSemesterRequest(b db.SemesterBatch) semesterRequest {
+	var req semesterRequest
+	json.Unmarshal([]byte(b.Request), &req)
+	if len(req.Steps) == 0 {
+		req.Steps = req.flagSteps()
+	}
+	return req
+}
+
+func summarizeSemesterBatch(b db.SemesterBatch, req semesterRequest) semesterBatchSummary {
+	sum := semesterBatchSummary{
+		ID:         b.ID,
+		State:      b.State,
+		Total:      b.Total,
+		Completed:  b.Completed,
+		Failed:     len(b.Errors),
+		Steps:      make([]string, len(req.Steps)),
+		TemplateID: req.TemplateID,
+		CreatedBy:  b.CreatedBy,
+		CreatedAt:  b.CreatedAt,
+		FinishedAt: b.FinishedAt,
+	}
+	for i, step := range req.Steps {
+		sum.Steps[i] = step.label()
+	}
+	end := time.Now()
+	switch {
+	case b.FinishedAt != nil:
+		end = *b.FinishedAt
+	case b.State != db.SemesterRunning:
+		// Paused, or finished before finish times were kept.
+		end = b.UpdatedAt
+	}
+	sum.DurationSec = int(end.Sub(b.CreatedAt).Seconds())
+	return sum
+}
@@ -0,0 +1,263 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+	sshc "example.com/openrobot-fleet/internal/ssh"
+)
+
+const (
+	// defaultPreflightMinDiskGB is the free disk space a robot needs to
+	// pass pre-flight when updating its repo or applying scenarios.
+	defaultPreflightMinDiskGB = 2
+	// preflightParallel bounds how many robots are checked at once; each
+	// check may wait on an SSH login.
+	preflightParallel    = 16
+	preflightDialTimeout = 5 * time.Second
+)
+
+// Pre-flight check outcomes. A robot is ready when none of its checks
+// failed; warnings are shown but don't hold the batch up.
+const (
+	preflightOK   = "ok"
+	preflightWarn = "warn"
+	preflightFail = "fail"
+)
+
+// preflightMinDiskGB reads PREFLIGHT_MIN_DISK_GB.
+func preflightMinDiskGB() int {
+	if v, err := strconv.Atoi(os.Getenv("PREFLIGHT_MIN_DISK_GB")); err == nil && v >= 0 {
+		return v
+	}
+	return defaultPreflightMinDiskGB
+}
+
+type preflightCheck struct {
+	// Name is heartbeat, reachable, ssh, install_config, disk or estop.
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type robotPreflight struct {
+	RobotID int64            `json:"robot_id"`
+	Name    string           `json:"name"`
+	Ready   bool             `json:"ready"`
+	Checks  []preflightCheck `json:"checks"`
+}
+
+type semesterPreflight struct {
+	// Ready is set when every robot is ready.
+	Ready  bool             `json:"ready"`
+	Robots []robotPreflight `json:"robots"`
+}
+
+// PreflightSemester checks each robot a semester batch would run on, without
+// starting it: that its agent is heartbeating, the host answers on SSH, its
+// install config works if the agent is to be reinstalled, and it has the
+// disk space for new code.
+func (c *Controller) PreflightSemester(w http.ResponseWriter, r *http.Request) {
+	req, ok := c.decodeSemesterRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := c.resolveSemesterSteps(r.Context(), &req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	needs := semesterNeedsOf(req.Steps)
+	report := semesterPreflight{Ready: true, Robots: make([]robotPreflight, len(req.RobotIDs))}
+	sem := make(chan struct{}, preflightParallel)
+	var wg sync.WaitGroup
+	for i, id := range req.RobotIDs {
+		wg.Add(1)
+		go func(i int, id int64) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			report.Robots[i] = c.preflightRobot(r.Context(), id, needs)
+		}(i, id)
+	}
+	wg.Wait()
+	for _, rp := range report.Robots {
+		report.Ready = report.Ready && rp.Ready
+	}
+	respondJSON(w, http.StatusOK, report)
+}
+
+// decodeSemesterRequest reads a batch request and resolves its selector into
+// robot IDs, answering the request itself when that fails.
+func (c *Controller) decodeSemesterRequest(w http.ResponseWriter, r *http.Request) (semesterRequest, bool) {
+	var req semesterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return req, false
+	}
+	sel, err := parseSelector(req.Selector)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid selector: "+err.Error())
+		return req, false
+	}
+	if req.RobotIDs, err = c.mergeSelected(r.Context(), req.RobotIDs, sel); err != nil {
+		logging.FromContext(r.Context()).Error("semester select robots", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to list robots")
+		return req, false
+	}
+	if len(req.RobotIDs) == 0 {
+		respondError(w, http.StatusBadRequest, "robot_ids or a matching selector required")
+		return req, false
+	}
+	return req, true
+}
+
+// semesterNeeds is what a batch's steps ask of each robot.
+type semesterNeeds struct {
+	Reinstall bool
+	// Agent is set when a step talks to the agent rather than over SSH.
+	Agent bool
+	Disk  bool
+	Drive bool
+}
+
+func semesterNeedsOf(steps []semesterStep) semesterNeeds {
+	var n semesterNeeds
+	for _, step := range steps {
+		switch step.Type {
+		case semesterReinstall:
+			n.Reinstall = true
+			continue
+		case semesterUpdateRepo, semesterApplyScenarios:
+			n.Disk = true
+		case semesterSelfTest:
+			n.Drive = true
+		}
+		n.Agent = true
+	}
+	return n
+}
+
+func (c *Controller) preflightRobot(ctx context.Context, id int64, needs semesterNeeds) robotPreflight {
+	rp := robotPreflight{RobotID: id, Name: fmt.Sprintf("robot %d", id), Ready: true}
+	check := func(name, status, detail string) {
+		rp.Checks = append(rp.Checks, preflightCheck{Name: name, Status: status, Detail: detail})
+		if status == preflightFail {
+			rp.Ready = false
+		}
+	}
+	robot, err := c.DB.GetRobotByID(ctx, id)
+	if err != nil {
+		check("robot", preflightFail, "robot not found")
+		return rp
+	}
+	rp.Name = robot.Name
+
+	// The agent itself, over MQTT. A reinstall can bring back one that is
+	// down, so that only warns.
+	switch {
+	case robot.AgentID == "" && !needs.Reinstall:
+		check("heartbeat", preflightFail, "no agent attached")
+	case robot.Status == "offline" || robot.AgentID == "":
+		status := preflightFail
+		if needs.Reinstall || !needs.Agent {
+			status = preflightWarn
+		}
+		detail := "agent never connected"
+		if !robot.LastSeen.IsZero() {
+			detail = "agent offline, last heartbeat " + robot.LastSeen.UTC().Format(time.RFC3339)
+		}
+		check("heartbeat", status, detail)
+	default:
+		check("heartbeat", preflightOK, fmt.Sprintf("last heartbeat %s ago", time.Since(robot.LastSeen).Round(time.Second)))
+	}
+
+	// The host, over SSH. Logging in is only needed to reinstall.
+	host, hasCreds := c.probeHost(ctx, robot)
+	if needs.Reinstall {
+		switch {
+		case !hasCreds || (len(host.PrivateKey) == 0 && sshc.AgentSocket() == ""):
+			status := preflightFail
+			if os.Getenv("DEMO_MODE") == "true" {
+				status = preflightWarn
+			}
+			check("install_config", status, "needs an address or IP, a user and an SSH key (or SSH_AGENT_SOCKET), on the robot or as the default")
+		default:
+			check("install_config", preflightOK, host.User+"@"+host.Addr)
+		}
+	}
+	switch {
+	case hasCreds:
+		res, err := sshc.Probe(host)
+		switch {
+		case err != nil:
+			check("ssh", sshStatus(needs), err.Error())
+		case !res.Reachable:
+			check("reachable", unreachableStatus(robot, needs), "no answer on "+host.Addr)
+		case res.HostKeyMismatch:
+			check("reachable", preflightOK, host.Addr)
+			check("ssh", sshStatus(needs), "host key changed; reset it if the robot was reflashed")
+		case res.LoginError != "":
+			check("reachable", preflightOK, host.Addr)
+			check("ssh", sshStatus(needs), "login failed: "+res.LoginError)
+		default:
+			check("reachable", preflightOK, host.Addr)
+			check("ssh", preflightOK, "agent "+res.AgentStatus)
+		}
+	case robot.IP != "":
+		addr := net.JoinHostPort(robot.IP, "22")
+		if conn, err := net.DialTimeout("tcp", addr, preflightDialTimeout); err != nil {
+			check("reachable", unreachableStatus(robot, needs), "no answer on "+addr)
+		} else {
+			conn.Close()
+			check("reachable", preflightOK, addr)
+		}
+	default:
+		check("reachable", preflightWarn, "no IP address known")
+	}
+
+	// New code needs room.
+	if needs.Disk {
+		minGB := preflightMinDiskGB()
+		switch {
+		case robot.Facts == nil:
+			check("disk", preflightWarn, "free disk space not reported yet")
+		case robot.Facts.DiskFreeGB < minGB:
+			check("disk", preflightFail, fmt.Sprintf("%d GB free, needs %d GB", robot.Facts.DiskFreeGB, minGB))
+		default:
+			check("disk", preflightOK, fmt.Sprintf("%d GB free", robot.Facts.DiskFreeGB))
+		}
+	}
+
+	// The self test drives the robot.
+	if needs.Drive && robot.EStop != nil {
+		check("estop", preflightFail, "emergency stop latched")
+	}
+	return rp
+}
+
+// sshStatus is how much an SSH login failure matters: only a reinstall
+// needs one.
+func sshStatus(needs semesterNeeds) string {
+	if needs.Reinstall {
+		return preflightFail
+	}
+	return preflightWarn
+}
+
+// unreachableStatus is how much an unreachable host matters: a robot whose
+// agent is heartbeating may just block SSH.
+func unreachableStatus(robot db.Robot, needs semesterNeeds) string {
+	if needs.Reinstall || robot.Status == "offline" {
+		return preflightFail
+	}
+	return preflightWarn
+}
@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// semesterTemplate is a saved list of semester batch steps, e.g. a
+// department's end-of-term routine, started with template_id.
+type semesterTemplate struct {
+	ID          int64          `json:"id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Steps       []semesterStep `json:"steps"`
+	CreatedBy   string         `json:"created_by,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+type semesterTemplateRequest struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Steps       []semesterStep `json:"steps"`
+}
+
+// applyTo validates req and copies it into t.
+func (req semesterTemplateRequest) applyTo(t *db.SemesterTemplate) error {
+	t.Name = strings.TrimSpace(req.Name)
+	t.Description = strings.TrimSpace(req.Description)
+	if t.Name == "" {
+		return errors.New("template name required")
+	}
+	if err := validateSemesterSteps(req.Steps); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(req.Steps)
+	if err != nil {
+		return err
+	}
+	t.Steps = string(raw)
+	return nil
+}
+
+func toSemesterTemplate(t db.SemesterTemplate) semesterTemplate {
+	out := semesterTemplate{
+		ID:          t.ID,
+		Name:        t.Name,
+		Description: t.Description,
+		Steps:       []semesterStep{},
+		CreatedBy:   t.CreatedBy,
+		CreatedAt:   t.CreatedAt,
+		UpdatedAt:   t.UpdatedAt,
+	}
+	// Steps were checked when saved.
+	json.Unmarshal([]byte(t.Steps), &out.Steps)
+	return out
+}
+
+// ListSemesterTemplates returns every saved semester template.
+func (c *Controller) ListSemesterTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := c.DB.ListSemesterTemplates(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list semester templates", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load templates")
+		return
+	}
+	out := make([]semesterTemplate, 0, len(templates))
+	for _, t := range templates {
+		out = append(out, toSemesterTemplate(t))
+	}
+	respondJSON(w, http.StatusOK, out)
+}
+
+// CreateSemesterTemplate saves a new template.
+func (c *Controller) CreateSemesterTemplate(w http.ResponseWriter, r *http.Request) {
+	var req semesterTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid template payload")
+		return
+	}
+	var t db.SemesterTemplate
+	if err := req.applyTo(&t); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !c.semesterTemplateNameFree(w, r, t) {
+		return
+	}
+	t.CreatedBy, _ = Actor(r.Context())
+	id, err := c.DB.CreateSemesterTemplate(r.Context(), t)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("create semester template", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to save template")
+		return
+	}
+	c.audit(r.Context(), "semester_template.create", t.Name, fmt.Sprintf("%d steps", len(req.Steps)))
+	c.respondSemesterTemplate(w, r, id, http.StatusCreated)
+}
+
+// GetSemesterTemplate returns one template.
+func (c *Controller) GetSemesterTemplate(w http.ResponseWriter, r *http.Request) {
+	t, ok := c.semesterTemplateFromPath(w, r)
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, toSemesterTemplate(t))
+}
+
+// UpdateSemesterTemplate replaces a template's steps. Batches already
+// started from it keep the steps they started with.
+func (c *Controller) UpdateSemesterTemplate(w http.ResponseWriter, r *http.Request) {
+	t, ok := c.semesterTemplateFromPath(w, r)
+	if !ok {
+		return
+	}
+	var req semesterTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid template payload")
+		return
+	}
+	if err := req.applyTo(&t); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !c.semesterTemplateNameFree(w, r, t) {
+		return
+	}
+	if err := c.DB.UpdateSemesterTemplate(r.Context(), t); err != nil {
+		logging.FromContext(r.Context()).Error("update semester template", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to save template")
+		return
+	}
+	c.audit(r.Context(), "semester_template.update", t.Name, fmt.Sprintf("%d steps", len(req.Steps)))
+	c.respondSemesterTemplate(w, r, t.ID, http.StatusOK)
+}
+
+// DeleteSemesterTemplate removes a template.
+func (c *Controller) DeleteSemesterTemplate(w http.ResponseWriter, r *http.Request) {
+	t, ok := c.semesterTemplateFromPath(w, r)
+	if !ok {
+		return
+	}
+	if err := c.DB.DeleteSemesterTemplate(r.Context(), t.ID); err != nil {
+		logging.FromContext(r.Context()).Error("delete semester template", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to delete template")
+		return
+	}
+	c.audit(r.Context(), "semester_template.delete", t.Name, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Controller) respondSemesterTemplate(w http.ResponseWriter, r *http.Request, id int64, status int) {
+	t, err := c.DB.GetSemesterTemplate(r.Context(), id)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("get semester template", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load template")
+		return
+	}
+	respondJSON(w, status, toSemesterTemplate(t))
+}
+
+// semesterTemplateNameFree responds 409 if another template already has t's
+// name.
+func (c *Controller) semesterTemplateNameFree(w http.ResponseWriter, r *http.Request, t db.SemesterTemplate) bool {
+	other, err := c.DB.GetSemesterTemplateByName(r.Context(), t.Name)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return true
+	case err != nil:
+		logging.FromContext(r.Context()).Error("get semester template by name", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load templates")
+		return false
+	case other.ID != t.ID:
+		respondError(w, http.StatusConflict, fmt.Sprintf("template %q already exists", t.Name))
+		return false
+	}
+	return true
+}
+
+// semesterTemplateFromPath loads the template named by
+// /api/semester/templates/{id}.
+func (c *Controller) semesterTemplateFromPath(w http.ResponseWriter, r *http.Request) (db.SemesterTemplate, bool) {
+	idStr := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/semester/templates/"), "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid template id")
+		return db.SemesterTemplate{}, false
+	}
+	t, err := c.DB.GetSemesterTemplate(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, http.StatusNotFound, "template not found")
+			return db.SemesterTemplate{}, false
+		}
+		logging.FromContext(r.Context()).Error("get semester template", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load template")
+		return db.SemesterTemplate{}, false
+	}
+	return t, true
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// sensorSnapshotWait bounds how long a snapshot request blocks. The agent
+// gives each sensor 10s, so this leaves room for a command already running.
+const sensorSnapshotWait = 30 * time.Second
+
+// sensorRegistry hands snapshots posted by agents to the request waiting for
+// them.
+type sensorRegistry struct {
+	mu      sync.Mutex
+	pending map[string]pendingSensorSnapshot
+}
+
+type pendingSensorSnapshot struct {
+	RobotID int64
+	Result  chan agent.SensorSnapshot
+}
+
+func (r *sensorRegistry) add(robotID int64) (string, chan agent.SensorSnapshot) {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	token := hex.EncodeToString(buf)
+	ch := make(chan agent.SensorSnapshot, 1)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending == nil {
+		r.pending = make(map[string]pendingSensorSnapshot)
+	}
+	r.pending[token] = pendingSensorSnapshot{RobotID: robotID, Result: ch}
+	return token, ch
+}
+
+// deliver passes snap to the waiting request and reports whether there was one.
+func (r *sensorRegistry) deliver(token string, robotID int64, snap agent.SensorSnapshot) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.pending[token]
+	if !ok || p.RobotID != robotID {
+		return false
+	}
+	delete(r.pending, token)
+	p.Result <- snap
+	return true
+}
+
+// expects reports whether a snapshot from the robot is awaited under token.
+func (r *sensorRegistry) expects(token string, robotID int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.pending[token]
+	return ok && p.RobotID == robotID
+}
+
+func (r *sensorRegistry) cancel(token string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pending, token)
+}
+
+type sensorSnapshotRequest struct {
+	ScanTopic  string `json:"scan_topic"`
+	OdomTopic  string `json:"odom_topic"`
+	ScanPoints int    `json:"scan_points"`
+}
+
+type sensorSnapshotResponse struct {
+	Job db.Job `json:"job"`
+	agent.SensorSnapshot
+}
+
+// SensorSnapshot asks the robot for one lidar scan, camera frame and odometry
+// reading and waits for the agent to send them back, so all sensors can be
+// checked with a single request.
+func (c *Controller) SensorSnapshot(w http.ResponseWriter, r *http.Request) {
+	id, err := parseRobotID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid robot id")
+		return
+	}
+	var req sensorSnapshotRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid payload")
+			return
+		}
+	}
+	robot, err := c.DB.GetRobotByID(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(w, http.StatusNotFound, "robot not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("sensor snapshot fetch robot", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to fetch robot")
+		return
+	}
+	if robot.AgentID == "" {
+		respondError(w, http.StatusBadRequest, "robot has no agent attached")
+		return
+	}
+	if robot.Status == "offline" {
+		respondError(w, http.StatusConflict, "robot is offline")
+		return
+	}
+
+	token, result := c.sensors.add(id)
+	defer c.sensors.cancel(token)
+	data, _ := json.Marshal(agent.SensorSnapshotData{
+		ResultURL:  robotCallbackBase(r, id) + "/sensors/result?token=" + token,
+		ScanTopic:  req.ScanTopic,
+		OdomTopic:  req.OdomTopic,
+		ScanPoints: req.ScanPoints,
+	})
+	job, err := c.queueRobotCommand(r.Context(), robot, agent.Command{Type: "sensor_snapshot", Data: data})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("queue sensor snapshot", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to queue command")
+		return
+	}
+
+	timer := time.NewTimer(sensorSnapshotWait)
+	defer timer.Stop()
+	select {
+	case snap := <-result:
+		respondJSON(w, http.StatusOK, sensorSnapshotResponse{Job: job, SensorSnapshot: snap})
+	case <-timer.C:
+		respondError(w, http.StatusGatewayTimeout, "robot did not report sensors in time")
+	case <-r.Context().Done():
+	}
+}
+
+// SensorSnapshotResult receives the snapshot from the agent.
+func (c *Controller) SensorSnapshotResult(w http.ResponseWriter, r *http.Request) {
+	id, err := parseRobotID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid robot id")
+		return
+	}
+	var snap agent.SensorSnapshot
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<20)).Decode(&snap); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid snapshot")
+		return
+	}
+	if !c.sensors.deliver(r.URL.Query().Get("token"), id, snap) {
+		respondError(w, http.StatusForbidden, "invalid or expired snapshot token")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "received"})
+}
@@ -1,18 +1,40 @@
 package controller
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/json"
-	"log"
+	"encoding/pem"
+	"errors"
+	"io"
 	"net/http"
 	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
 
 	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+	sshc "example.com/openrobot-fleet/internal/ssh"
 )
 
+type installDefaultsView struct {
+	*db.InstallConfig
+	SSHPublicKey string `json:"ssh_public_key"`
+	// SSHAgentKeys are the public keys of the SSH_AGENT_SOCKET agent, which
+	// robots need in their authorized_keys as well.
+	SSHAgentKeys []string `json:"ssh_agent_keys,omitempty"`
+}
+
+type installDefaultsResponse struct {
+	InstallConfig *installDefaultsView `json:"install_config"`
+	DemoMode      bool                 `json:"demo_mode"`
+}
+
 func (c *Controller) GetInstallDefaults(w http.ResponseWriter, r *http.Request) {
 	cfg, err := c.DB.GetDefaultInstallConfig(r.Context())
 	if err != nil {
-		log.Printf("get install defaults: %v", err)
+		logging.FromContext(r.Context()).Error("get install defaults", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to load defaults")
 		return
 	}
@@ -23,19 +45,18 @@ func (c *Controller) GetInstallDefaults(w http.ResponseWriter, r *http.Request)
 		pubKey, _ = prepareSSHKeys(cfg.SSHKey)
 	}
 
-	type response struct {
-		*db.InstallConfig
-		SSHPublicKey string `json:"ssh_public_key"`
-	}
-
-	resp := &response{
-		InstallConfig: cfg,
-		SSHPublicKey:  pubKey,
+	agentKeys, err := sshc.AgentKeys()
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("get install defaults: ssh agent keys", "err", err)
 	}
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"install_config": resp,
-		"demo_mode":      os.Getenv("DEMO_MODE") == "true",
+	respondJSON(w, http.StatusOK, installDefaultsResponse{
+		InstallConfig: &installDefaultsView{
+			InstallConfig: cfg,
+			SSHPublicKey:  pubKey,
+			SSHAgentKeys:  agentKeys,
+		},
+		DemoMode: os.Getenv("DEMO_MODE") == "true",
 	})
 }
 
@@ -51,9 +72,84 @@ func (c *Controller) UpdateInstallDefaults(w http.ResponseWriter, r *http.Reques
 	}
 	cfg := req.toInstallConfig()
 	if err := c.DB.SaveDefaultInstallConfig(r.Context(), cfg); err != nil {
-		log.Printf("update install defaults: %v", err)
+		logging.FromContext(r.Context()).Error("update install defaults", "err", err)
 		respondError(w, http.StatusInternalServerError, "failed to save defaults")
 		return
 	}
 	respondJSON(w, http.StatusOK, map[string]*db.InstallConfig{"install_config": &cfg})
 }
+
+type sshKeygenRequest struct {
+	// Replace must be set to overwrite an existing default key. Robots that
+	// only trust the old key can't be logged in to with the new one.
+	Replace bool `json:"replace"`
+}
+
+type sshKeygenResponse struct {
+	SSHPublicKey string `json:"ssh_public_key"`
+	Fingerprint  string `json:"fingerprint"`
+	// Encrypted is false when no SECRETS_KEY is configured and the private
+	// key was stored in plaintext.
+	Encrypted bool `json:"encrypted"`
+}
+
+// GenerateSSHKey generates an ed25519 keypair on the controller and makes
+// its private key the default install key, so nobody has to paste one. The
+// private key never leaves the controller; the response has the public key
+// to bake into images or add to authorized_keys.
+func (c *Controller) GenerateSSHKey(w http.ResponseWriter, r *http.Request) {
+	var req sshKeygenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	cfg, err := c.DB.GetDefaultInstallConfig(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("ssh keygen: load install defaults", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load defaults")
+		return
+	}
+	if cfg == nil {
+		cfg = &db.InstallConfig{}
+	}
+	if cfg.SSHKey != "" && !req.Replace {
+		respondError(w, http.StatusConflict, "a default SSH key is already set; pass replace to overwrite it (robots that only trust the old key will refuse the new one)")
+		return
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("ssh keygen: generate", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to generate key")
+		return
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "openrobot-fleet")
+	if err != nil {
+		logging.FromContext(r.Context()).Error("ssh keygen: marshal", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to generate key")
+		return
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("ssh keygen: public key", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to generate key")
+		return
+	}
+
+	cfg.SSHKey = string(pem.EncodeToMemory(block))
+	if err := c.DB.SaveDefaultInstallConfig(r.Context(), *cfg); err != nil {
+		logging.FromContext(r.Context()).Error("ssh keygen: save install defaults", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to save defaults")
+		return
+	}
+	resp := sshKeygenResponse{
+		SSHPublicKey: strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub))),
+		Fingerprint:  ssh.FingerprintSHA256(sshPub),
+		Encrypted:    c.DB.SecretsEncrypted(),
+	}
+	if !resp.Encrypted {
+		logging.FromContext(r.Context()).Warn("ssh keygen: no SECRETS_KEY configured, default key stored in plaintext")
+	}
+	c.audit(r.Context(), "settings.ssh_keygen", "install_defaults", resp.Fingerprint)
+	respondJSON(w, http.StatusCreated, resp)
+}
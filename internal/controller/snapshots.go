@@ -0,0 +1,699 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+	"example.com/openrobot-fleet/internal/selector"
+)
+
+const (
+	snapshotCheckInterval = time.Minute
+	// snapshotCatchUp is how late a schedule may still run, e.g. after the
+	// controller restarted. Later than that it waits for its next day.
+	snapshotCatchUp = time.Hour
+	// snapshotUploadWait is how long a robot has to upload a snapshot before
+	// it counts as failed.
+	snapshotUploadWait = 15 * time.Minute
+	maxSnapshotBytes   = 20 << 20
+	snapshotListLimit  = 50
+	maxSnapshotList    = 500
+	// snapshotThumbWidth is the width of the thumbnails shown in galleries.
+	snapshotThumbWidth = 240
+
+	defaultSnapshotRetention      = 30 * 24 * time.Hour
+	defaultSnapshotRetentionCount = 500
+)
+
+type snapshotScheduleRequest struct {
+	Name   string   `json:"name"`
+	Robots string   `json:"robots"`
+	At     string   `json:"at"`
+	Days   []string `json:"days"`
+	// Enabled defaults to true.
+	Enabled *bool `json:"enabled"`
+}
+
+// robotSnapshot is a snapshot with where to fetch its image and thumbnail,
+// once stored.
+type robotSnapshot struct {
+	db.Snapshot
+	URL          string `json:"url,omitempty"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+type snapshotRunResponse struct {
+	Snapshots []robotSnapshot `json:"snapshots"`
+}
+
+func snapshotRetention() time.Duration {
+	if v, err := strconv.Atoi(os.Getenv("SNAPSHOT_RETENTION_DAYS")); err == nil && v > 0 {
+		return time.Duration(v) * 24 * time.Hour
+	}
+	return defaultSnapshotRetention
+}
+
+// snapshotRetentionCount is how many snapshots each robot keeps,
+// SNAPSHOT_RETENTION_COUNT or 500.
+func snapshotRetentionCount() int {
+	if v, err := strconv.Atoi(os.Getenv("SNAPSHOT_RETENTION_COUNT")); err == nil && v > 0 {
+		return v
+	}
+	return defaultSnapshotRetentionCount
+}
+
+// snapshotFile is where a stored snapshot's image is kept:
+// web/dist/snapshots/<robot id>/<snapshot id>.jpg, next to the robot's
+// latest snapshot.
+func snapshotFile(robotID, snapshotID int64) string {
+	return filepath.Join(filepath.Dir(snapshotPath(robotID)), strconv.FormatInt(robotID, 10), fmt.Sprintf("%d.jpg", snapshotID))
+}
+
+// snapshotThumbFile is the thumbnail kept next to a snapshot's image.
+func snapshotThumbFile(robotID, snapshotID int64) string {
+	return strings.TrimSuffix(snapshotFile(robotID, snapshotID), ".jpg") + ".thumb.jpg"
+}
+
+func withSnapshotURL(s db.Snapshot) robotSnapshot {
+	rs := robotSnapshot{Snapshot: s}
+	if s.Status == db.SnapshotStored {
+		rs.URL = fmt.Sprintf("/snapshots/%d/%d.jpg", s.RobotID, s.ID)
+		rs.ThumbnailURL = fmt.Sprintf("/snapshots/%d/%d.thumb.jpg", s.RobotID, s.ID)
+	}
+	return rs
+}
+
+// saveSnapshotImage writes a stored snapshot's image and its thumbnail. An
+// image that can't be decoded is kept without a thumbnail.
+func saveSnapshotImage(robotID, snapshotID int64, image []byte) error {
+	dst := snapshotFile(robotID, snapshotID)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(dst, image, 0644); err != nil {
+		return err
+	}
+	if err := writeThumbnail(snapshotThumbFile(robotID, snapshotID), bytes.NewReader(image)); err != nil {
+		slog.Warn("snapshot thumbnail", "robot", robotID, "snapshot", snapshotID, "err", err)
+	}
+	return nil
+}
+
+// removeSnapshotImage deletes a snapshot's image and thumbnail.
+func removeSnapshotImage(robotID, snapshotID int64) {
+	for _, p := range []string{snapshotFile(robotID, snapshotID), snapshotThumbFile(robotID, snapshotID)} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			slog.Warn("snapshots: remove image", "snapshot", snapshotID, "err", err)
+		}
+	}
+}
+
+// ensureThumbnail makes the thumbnail of a snapshot stored before
+// thumbnails were kept.
+func ensureThumbnail(s db.Snapshot) {
+	thumb := snapshotThumbFile(s.RobotID, s.ID)
+	if _, err := os.Stat(thumb); !os.IsNotExist(err) {
+		return
+	}
+	f, err := os.Open(snapshotFile(s.RobotID, s.ID))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if err := writeThumbnail(thumb, f); err != nil {
+		slog.Warn("snapshot thumbnail", "robot", s.RobotID, "snapshot", s.ID, "err", err)
+	}
+}
+
+// writeThumbnail scales the JPEG in r down to snapshotThumbWidth, averaging
+// the pixels each thumbnail pixel covers, and writes it to path.
+func writeThumbnail(path string, r io.Reader) error {
+	src, err := jpeg.Decode(r)
+	if err != nil {
+		return err
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return errors.New("empty image")
+	}
+	tw := min(snapshotThumbWidth, w)
+	th := max(1, h*tw/w)
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+max((x+1)*w/tw, x*w/tw+1)
+			var r, g, bl, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, _ := src.At(sx, sy).RGBA()
+					r, g, bl, n = r+cr, g+cg, bl+cb, n+1
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(bl / n >> 8), A: 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 75}); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// ListSnapshotSchedules returns every snapshot schedule.
+func (c *Controller) ListSnapshotSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules, err := c.DB.ListSnapshotSchedules(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list snapshot schedules", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load schedules")
+		return
+	}
+	respondJSON(w, http.StatusOK, schedules)
+}
+
+// CreateSnapshotSchedule adds a schedule. Robots upload to the address the
+// request was made to, so create it from a URL the robots can reach.
+func (c *Controller) CreateSnapshotSchedule(w http.ResponseWriter, r *http.Request) {
+	var req snapshotScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid schedule payload")
+		return
+	}
+	s := db.SnapshotSchedule{Enabled: true, BaseURL: requestBaseURL(r)}
+	if err := req.applyTo(&s); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.CreatedBy, _ = Actor(r.Context())
+	id, err := c.DB.CreateSnapshotSchedule(r.Context(), s)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("create snapshot schedule", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to save schedule")
+		return
+	}
+	c.audit(r.Context(), "snapshot_schedule.create", s.Name, fmt.Sprintf("%s at %s", s.Robots, s.At))
+	c.respondSnapshotSchedule(w, r, id, http.StatusCreated)
+}
+
+// UpdateSnapshotSchedule replaces a schedule's settings.
+func (c *Controller) UpdateSnapshotSchedule(w http.ResponseWriter, r *http.Request) {
+	s, ok := c.snapshotScheduleFromPath(w, r)
+	if !ok {
+		return
+	}
+	var req snapshotScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid schedule payload")
+		return
+	}
+	if err := req.applyTo(&s); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.BaseURL = requestBaseURL(r)
+	if err := c.DB.UpdateSnapshotSchedule(r.Context(), s); err != nil {
+		logging.FromContext(r.Context()).Error("update snapshot schedule", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to save schedule")
+		return
+	}
+	c.audit(r.Context(), "snapshot_schedule.update", s.Name, fmt.Sprintf("%s at %s", s.Robots, s.At))
+	c.respondSnapshotSchedule(w, r, s.ID, http.StatusOK)
+}
+
+// DeleteSnapshotSchedule removes a schedule; the snapshots it took stay.
+func (c *Controller) DeleteSnapshotSchedule(w http.ResponseWriter, r *http.Request) {
+	s, ok := c.snapshotScheduleFromPath(w, r)
+	if !ok {
+		return
+	}
+	if err := c.DB.DeleteSnapshotSchedule(r.Context(), s.ID); err != nil {
+		logging.FromContext(r.Context()).Error("delete snapshot schedule", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to delete schedule")
+		return
+	}
+	c.audit(r.Context(), "snapshot_schedule.delete", s.Name, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RunSnapshotSchedule takes the schedule's snapshots now, without waiting
+// for its time.
+func (c *Controller) RunSnapshotSchedule(w http.ResponseWriter, r *http.Request) {
+	s, ok := c.snapshotScheduleFromPath(w, r)
+	if !ok {
+		return
+	}
+	snaps, err := c.runSnapshotSchedule(r.Context(), s)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("run snapshot schedule", "schedule", s.Name, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to run schedule")
+		return
+	}
+	c.audit(r.Context(), "snapshot_schedule.run", s.Name, fmt.Sprintf("%d robots", len(snaps)))
+	respondJSON(w, http.StatusAccepted, snapshotRunResponse{Snapshots: snaps})
+}
+
+// GetSnapshotSchedule returns one schedule.
+func (c *Controller) GetSnapshotSchedule(w http.ResponseWriter, r *http.Request) {
+	s, ok := c.snapshotScheduleFromPath(w, r)
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, s)
+}
+
+func (c *Controller) respondSnapshotSchedule(w http.ResponseWriter, r *http.Request, id int64, status int) {
+	s, err := c.DB.GetSnapshotSchedule(r.Context(), id)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("get snapshot schedule", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load schedule")
+		return
+	}
+	respondJSON(w, status, s)
+}
+
+// snapshotScheduleFromPath loads the schedule named by
+// /api/snapshot-schedules/{id}, with or without a trailing action.
+func (c *Controller) snapshotScheduleFromPath(w http.ResponseWriter, r *http.Request) (db.SnapshotSchedule, bool) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/snapshot-schedules/"), "/")
+	idStr, _, _ := strings.Cut(rest, "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid schedule id")
+		return db.SnapshotSchedule{}, false
+	}
+	s, err := c.DB.GetSnapshotSchedule(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(w, http.StatusNotFound, "schedule not found")
+			return s, false
+		}
+		logging.FromContext(r.Context()).Error("get snapshot schedule", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load schedule")
+		return s, false
+	}
+	return s, true
+}
+
+// applyTo validates req and copies it onto s.
+func (req snapshotScheduleRequest) applyTo(s *db.SnapshotSchedule) error {
+	s.Name = strings.TrimSpace(req.Name)
+	if s.Name == "" {
+		return errors.New("name is required")
+	}
+	s.Robots = strings.TrimSpace(req.Robots)
+	if s.Robots == "" {
+		return errors.New("robots is required, e.g. tag=classA or all")
+	}
+	if _, err := selector.Parse(s.Robots); err != nil {
+		return fmt.Errorf("invalid robots selector: %v", err)
+	}
+	at, err := time.Parse("15:04", strings.TrimSpace(req.At))
+	if err != nil {
+		return errors.New("at must be a time of day like 07:30")
+	}
+	s.At = at.Format("15:04")
+	s.Days = []string{}
+	for _, d := range req.Days {
+		day, ok := parseWeekday(d)
+		if !ok {
+			return fmt.Errorf("unknown day %q", d)
+		}
+		s.Days = append(s.Days, dayName(day))
+	}
+	if req.Enabled != nil {
+		s.Enabled = *req.Enabled
+	}
+	return nil
+}
+
+// parseWeekday accepts a weekday's name or its first three letters.
+func parseWeekday(v string) (time.Weekday, bool) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if name := strings.ToLower(d.String()); v == name || v == name[:3] {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// dayName is how schedules store a weekday, e.g. "mon".
+func dayName(d time.Weekday) string {
+	return strings.ToLower(d.String())[:3]
+}
+
+// requestBaseURL is the controller's address as the request reached it.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, r.Host)
+}
+
+// RunSnapshotSchedules takes each schedule's snapshots when it comes due,
+// fails snapshots that never arrived and prunes old ones, until ctx is done.
+func (c *Controller) RunSnapshotSchedules(ctx context.Context) {
+	ticker := time.NewTicker(snapshotCheckInterval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		c.runDueSnapshotSchedules(ctx, now)
+		c.checkPendingSnapshots(ctx, now)
+		c.pruneSnapshots(ctx, now)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Controller) runDueSnapshotSchedules(ctx context.Context, now time.Time) {
+	schedules, err := c.DB.ListSnapshotSchedules(ctx)
+	if err != nil {
+		slog.Error("snapshot schedules: list", "err", err)
+		return
+	}
+	for _, s := range schedules {
+		if !snapshotScheduleDue(s, now) {
+			continue
+		}
+		snaps, err := c.runSnapshotSchedule(ctx, s)
+		if err != nil {
+			slog.Error("snapshot schedule failed", "schedule", s.Name, "err", err)
+			continue
+		}
+		slog.Info("snapshot schedule ran", "schedule", s.Name, "robots", len(snaps))
+	}
+}
+
+// snapshotScheduleDue reports whether s should run at now: it is enabled,
+// today is one of its days, its time passed less than snapshotCatchUp ago
+// and it hasn't run since.
+func snapshotScheduleDue(s db.SnapshotSchedule, now time.Time) bool {
+	if !s.Enabled {
+		return false
+	}
+	at, err := time.Parse("15:04", s.At)
+	if err != nil {
+		return false
+	}
+	slot := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+	if now.Before(slot) || now.Sub(slot) > snapshotCatchUp {
+		return false
+	}
+	if s.LastRunAt != nil && !s.LastRunAt.Before(slot) {
+		return false
+	}
+	if len(s.Days) == 0 {
+		return true
+	}
+	today := dayName(now.Weekday())
+	for _, d := range s.Days {
+		if d == today {
+			return true
+		}
+	}
+	return false
+}
+
+// runSnapshotSchedule asks every robot s selects for a snapshot and records
+// the run.
+func (c *Controller) runSnapshotSchedule(ctx context.Context, s db.SnapshotSchedule) ([]robotSnapshot, error) {
+	sel, err := selector.Parse(s.Robots)
+	if err != nil {
+		return nil, err
+	}
+	robots, err := c.DB.ListRobots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.DB.MarkSnapshotScheduleRun(ctx, s.ID, time.Now()); err != nil {
+		return nil, err
+	}
+	snaps := []robotSnapshot{}
+	for _, robot := range sel.Filter(robots) {
+		if robot.AgentID == "" {
+			continue
+		}
+		snap, err := c.takeSnapshot(ctx, robot, &s.ID, s.BaseURL)
+		if err != nil {
+			return snaps, err
+		}
+		snaps = append(snaps, withSnapshotURL(snap))
+	}
+	return snaps, nil
+}
+
+// TakeRobotSnapshot asks one robot for a snapshot kept in its history.
+func (c *Controller) TakeRobotSnapshot(w http.ResponseWriter, r *http.Request) {
+	id, err := parseRobotID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid robot id")
+		return
+	}
+	robot, err := c.DB.GetRobotByID(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(w, http.StatusNotFound, "robot not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("snapshot fetch robot", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to fetch robot")
+		return
+	}
+	if robot.AgentID == "" {
+		respondError(w, http.StatusBadRequest, "robot has no agent attached")
+		return
+	}
+	snap, err := c.takeSnapshot(r.Context(), robot, nil, requestBaseURL(r))
+	if err != nil {
+		logging.FromContext(r.Context()).Error("take snapshot", "robot", robot.Name, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to request snapshot")
+		return
+	}
+	respondJSON(w, http.StatusAccepted, withSnapshotURL(snap))
+}
+
+// takeSnapshot records a pending snapshot and queues capture_image for it.
+// A robot that is offline or can't be sent the command gets a failed
+// snapshot and an alert; only database errors are returned.
+func (c *Controller) takeSnapshot(ctx context.Context, robot db.Robot, scheduleID *int64, baseURL string) (db.Snapshot, error) {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	snap := db.Snapshot{RobotID: robot.ID, ScheduleID: scheduleID, Token: hex.EncodeToString(buf), Status: db.SnapshotPending}
+	id, err := c.DB.CreateSnapshot(ctx, snap)
+	if err != nil {
+		return snap, err
+	}
+	snap.ID = id
+
+	if robot.Status == "offline" {
+		c.failSnapshot(ctx, snap, robot.Name, "robot is offline")
+		return c.DB.GetSnapshot(ctx, id)
+	}
+	data, _ := json.Marshal(agent.CaptureImageData{
+		UploadURL: fmt.Sprintf("%s/api/robots/%d/snapshots/%d?token=%s", strings.TrimSuffix(baseURL, "/"), robot.ID, id, snap.Token),
+	})
+	job, err := c.queueRobotCommand(ctx, robot, agent.Command{Type: "capture_image", Data: data})
+	if err != nil {
+		c.failSnapshot(ctx, snap, robot.Name, "could not queue capture_image: "+err.Error())
+		return c.DB.GetSnapshot(ctx, id)
+	}
+	if err := c.DB.SetSnapshotJob(ctx, id, job.ID); err != nil {
+		return snap, err
+	}
+	return c.DB.GetSnapshot(ctx, id)
+}
+
+// failSnapshot marks a pending snapshot failed and raises a "snapshot" alert.
+func (c *Controller) failSnapshot(ctx context.Context, snap db.Snapshot, robotName, reason string) {
+	ok, err := c.DB.FinishSnapshot(ctx, snap.ID, db.SnapshotFailed, reason)
+	if err != nil {
+		slog.Error("snapshot: record failure", "snapshot", snap.ID, "err", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	what := "Snapshot"
+	if snap.ScheduleID != nil {
+		what = "Scheduled snapshot"
+	}
+	msg := fmt.Sprintf("%s of %s failed: %s", what, robotName, reason)
+	slog.Warn("snapshot failed", "robot", robotName, "snapshot", snap.ID, "reason", reason)
+	c.raiseAlert("snapshot", snap.RobotID, msg)
+}
+
+// checkPendingSnapshots fails snapshots whose capture_image job failed or
+// that never arrived.
+func (c *Controller) checkPendingSnapshots(ctx context.Context, now time.Time) {
+	pending, err := c.DB.ListPendingSnapshots(ctx)
+	if err != nil {
+		slog.Error("snapshots: list pending", "err", err)
+		return
+	}
+	for _, snap := range pending {
+		var reason string
+		switch {
+		case snap.JobStatus == "failed":
+			reason = "capture_image failed"
+		case now.Sub(snap.CreatedAt) > snapshotUploadWait:
+			reason = fmt.Sprintf("no image arrived within %s", snapshotUploadWait)
+		default:
+			continue
+		}
+		name := fmt.Sprintf("robot %d", snap.RobotID)
+		if robot, err := c.DB.GetRobotByID(ctx, snap.RobotID); err == nil {
+			name = robot.Name
+			if state := c.GetRobotJobStatus(robot.AgentID); snap.JobID != nil && state.JobID == strconv.FormatInt(*snap.JobID, 10) && state.JobError != "" {
+				reason += ": " + state.JobError
+			}
+		}
+		c.failSnapshot(ctx, snap, name, reason)
+	}
+}
+
+// pruneSnapshots deletes snapshots older than the retention period and
+// those past each robot's retention count.
+func (c *Controller) pruneSnapshots(ctx context.Context, now time.Time) {
+	old, err := c.DB.DeleteSnapshotsBefore(ctx, now.Add(-snapshotRetention()))
+	if err != nil {
+		slog.Error("snapshots: prune", "err", err)
+		return
+	}
+	extra, err := c.DB.DeleteSnapshotsBeyond(ctx, snapshotRetentionCount())
+	if err != nil {
+		slog.Error("snapshots: prune", "err", err)
+	}
+	old = append(old, extra...)
+	for _, s := range old {
+		if s.Status == db.SnapshotStored {
+			removeSnapshotImage(s.RobotID, s.ID)
+		}
+	}
+	if len(old) > 0 {
+		slog.Info("pruned old snapshots", "count", len(old))
+	}
+}
+
+// ListRobotSnapshots returns a robot's snapshot history, newest first:
+// ?limit= snapshots (50 by default), older than ?before= if given.
+func (c *Controller) ListRobotSnapshots(w http.ResponseWriter, r *http.Request) {
+	id, err := parseRobotID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid robot id")
+		return
+	}
+	limit := snapshotListLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		limit = min(n, maxSnapshotList)
+	}
+	var before int64
+	if v := r.URL.Query().Get("before"); v != "" {
+		if before, err = strconv.ParseInt(v, 10, 64); err != nil || before <= 0 {
+			respondError(w, http.StatusBadRequest, "invalid before")
+			return
+		}
+	}
+	snaps, err := c.DB.ListSnapshots(r.Context(), id, before, limit)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list snapshots", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load snapshots")
+		return
+	}
+	out := make([]robotSnapshot, 0, len(snaps))
+	for _, s := range snaps {
+		if s.Status == db.SnapshotStored {
+			ensureThumbnail(s)
+		}
+		out = append(out, withSnapshotURL(s))
+	}
+	respondJSON(w, http.StatusOK, out)
+}
+
+// UploadRobotSnapshot receives the image for a pending snapshot from the
+// agent, authenticated by the snapshot's token. It is kept in the robot's
+// history and also becomes the robot's latest snapshot.
+func (c *Controller) UploadRobotSnapshot(w http.ResponseWriter, r *http.Request) {
+	robotID, err := parseRobotID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid robot id")
+		return
+	}
+	snapID, err := strconv.ParseInt(filepath.Base(strings.TrimSuffix(r.URL.Path, "/")), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid snapshot id")
+		return
+	}
+	snap, err := c.DB.GetSnapshot(r.Context(), snapID)
+	if err != nil || snap.RobotID != robotID || subtle.ConstantTimeCompare([]byte(snap.Token), []byte(r.URL.Query().Get("token"))) != 1 {
+		respondError(w, http.StatusNotFound, "unknown snapshot")
+		return
+	}
+	if snap.Status != db.SnapshotPending {
+		respondError(w, http.StatusConflict, "snapshot is "+snap.Status)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSnapshotBytes)
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "failed to get image")
+		return
+	}
+	defer file.Close()
+	image, err := io.ReadAll(file)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "failed to read image")
+		return
+	}
+
+	if err := saveSnapshotImage(robotID, snapID, image); err != nil {
+		logging.FromContext(r.Context()).Error("failed to write snapshot file", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to save")
+		return
+	}
+	ok, err := c.DB.FinishSnapshot(r.Context(), snapID, db.SnapshotStored, "")
+	if err != nil || !ok {
+		removeSnapshotImage(robotID, snapID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("finish snapshot", "err", err)
+			respondError(w, http.StatusInternalServerError, "failed to save")
+			return
+		}
+		respondError(w, http.StatusConflict, "snapshot is no longer pending")
+		return
+	}
+	if err := os.WriteFile(snapshotPath(robotID), image, 0644); err != nil {
+		logging.FromContext(r.Context()).Warn("failed to update latest snapshot", "err", err)
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "uploaded", "url": fmt.Sprintf("/snapshots/%d/%d.jpg", robotID, snapID)})
+}
@@ -0,0 +1,232 @@
+package controller
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+const (
+	defaultSpeedTestBytes = 10 << 20
+	maxSpeedTestBytes     = 200 << 20
+	speedTestTTL          = 10 * time.Minute
+)
+
+// pendingSpeedTest tracks a running speed test so the agent's unauthenticated
+// callbacks can be matched to the robot that was asked to run it.
+type pendingSpeedTest struct {
+	RobotID   int64
+	SizeBytes int64
+	Expires   time.Time
+}
+
+type speedTestRegistry struct {
+	mu    sync.Mutex
+	tests map[string]pendingSpeedTest
+}
+
+func (r *speedTestRegistry) add(test pendingSpeedTest) string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	token := hex.EncodeToString(buf)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tests == nil {
+		r.tests = make(map[string]pendingSpeedTest)
+	}
+	now := time.Now()
+	for k, v := range r.tests {
+		if now.After(v.Expires) {
+			delete(r.tests, k)
+		}
+	}
+	r.tests[token] = test
+	return token
+}
+
+func (r *speedTestRegistry) get(token string, robotID int64) (pendingSpeedTest, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	test, ok := r.tests[token]
+	if !ok || test.RobotID != robotID || time.Now().After(test.Expires) {
+		return pendingSpeedTest{}, false
+	}
+	return test, true
+}
+
+func (r *speedTestRegistry) finish(token string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tests, token)
+}
+
+// robotCallbackBase is the URL an agent uses to reach this robot's API, as
+// seen from the request that asked for the callback.
+func robotCallbackBase(r *http.Request, robotID int64) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/api/robots/%d", scheme, r.Host, robotID)
+}
+
+type speedTestRequest struct {
+	SizeMB int `json:"size_mb"`
+}
+
+// StartSpeedTest queues a speed_test command for the robot.
+func (c *Controller) StartSpeedTest(w http.ResponseWriter, r *http.Request) {
+	id, err := parseRobotID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid robot id")
+		return
+	}
+	var req speedTestRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid payload")
+			return
+		}
+	}
+	size := int64(defaultSpeedTestBytes)
+	if req.SizeMB > 0 {
+		size = int64(req.SizeMB) << 20
+	}
+	if size > maxSpeedTestBytes {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("size_mb must be at most %d", maxSpeedTestBytes>>20))
+		return
+	}
+	robot, err := c.DB.GetRobotByID(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(w, http.StatusNotFound, "robot not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("speed test fetch robot", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to fetch robot")
+		return
+	}
+	if robot.AgentID == "" {
+		respondError(w, http.StatusBadRequest, "robot has no agent attached")
+		return
+	}
+
+	token := c.speedTests.add(pendingSpeedTest{RobotID: id, SizeBytes: size, Expires: time.Now().Add(speedTestTTL)})
+	base := robotCallbackBase(r, id) + "/speedtest"
+	data, _ := json.Marshal(agent.SpeedTestData{
+		DownloadURL: base + "/payload?token=" + token,
+		UploadURL:   base + "/upload?token=" + token,
+		ResultURL:   base + "/result?token=" + token,
+		SizeBytes:   size,
+	})
+	job, err := c.queueRobotCommand(r.Context(), robot, agent.Command{Type: "speed_test", Data: data})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("queue speed test", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to queue command")
+		return
+	}
+	respondJSON(w, http.StatusCreated, job)
+}
+
+// ListSpeedTests returns recent speed test results for a robot.
+func (c *Controller) ListSpeedTests(w http.ResponseWriter, r *http.Request) {
+	id, err := parseRobotID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid robot id")
+		return
+	}
+	limit := 20
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		limit = v
+	}
+	tests, err := c.DB.ListSpeedTests(r.Context(), id, limit)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("list speed tests", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to list speed tests")
+		return
+	}
+	respondJSON(w, http.StatusOK, tests)
+}
+
+// SpeedTestPayload streams the download half of the test to the agent.
+func (c *Controller) SpeedTestPayload(w http.ResponseWriter, r *http.Request) {
+	test, ok := c.speedTestFromRequest(r)
+	if !ok {
+		respondError(w, http.StatusForbidden, "invalid speed test token")
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(test.SizeBytes, 10))
+	// Random bytes so no proxy along the way can compress the payload.
+	if _, err := io.CopyN(w, rand.Reader, test.SizeBytes); err != nil {
+		logging.FromContext(r.Context()).Error("speed test payload", "err", err)
+	}
+}
+
+// SpeedTestUpload drains the upload half of the test.
+func (c *Controller) SpeedTestUpload(w http.ResponseWriter, r *http.Request) {
+	test, ok := c.speedTestFromRequest(r)
+	if !ok {
+		respondError(w, http.StatusForbidden, "invalid speed test token")
+		return
+	}
+	n, err := io.Copy(io.Discard, io.LimitReader(r.Body, test.SizeBytes+1))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "upload interrupted")
+		return
+	}
+	if n > test.SizeBytes {
+		respondError(w, http.StatusRequestEntityTooLarge, "upload larger than requested")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]int64{"received": n})
+}
+
+// SpeedTestResult stores the rates measured by the agent.
+func (c *Controller) SpeedTestResult(w http.ResponseWriter, r *http.Request) {
+	test, ok := c.speedTestFromRequest(r)
+	if !ok {
+		respondError(w, http.StatusForbidden, "invalid speed test token")
+		return
+	}
+	var res agent.SpeedTestResult
+	if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid result")
+		return
+	}
+	record := db.SpeedTest{
+		RobotID:      test.RobotID,
+		SizeBytes:    test.SizeBytes,
+		DownloadMbps: res.DownloadMbps,
+		UploadMbps:   res.UploadMbps,
+	}
+	id, err := c.DB.CreateSpeedTest(r.Context(), record)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("save speed test", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to save result")
+		return
+	}
+	record.ID = id
+	c.speedTests.finish(r.URL.Query().Get("token"))
+	logging.FromContext(r.Context()).Info("speed test complete", "robot_id", test.RobotID, "download_mbps", res.DownloadMbps, "upload_mbps", res.UploadMbps)
+	respondJSON(w, http.StatusOK, record)
+}
+
+func (c *Controller) speedTestFromRequest(r *http.Request) (pendingSpeedTest, bool) {
+	id, err := parseRobotID(r.URL.Path)
+	if err != nil {
+		return pendingSpeedTest{}, false
+	}
+	return c.speedTests.get(r.URL.Query().Get("token"), id)
+}
@@ -0,0 +1,241 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+const (
+	telemetryMaintenanceInterval = 10 * time.Minute
+	defaultTelemetryRawRetention = 48 * time.Hour
+	defaultTelemetryRetention    = 90 * 24 * time.Hour
+	defaultTelemetryRange        = 24 * time.Hour
+	maxTelemetryMetrics          = 32
+	maxTelemetryMetricName       = 64
+)
+
+// telemetryRetention reads TELEMETRY_RAW_RETENTION_HOURS (per-minute samples)
+// and TELEMETRY_RETENTION_DAYS (hourly rollups).
+func telemetryRetention() (raw, hourly time.Duration) {
+	raw, hourly = defaultTelemetryRawRetention, defaultTelemetryRetention
+	if v, err := strconv.Atoi(os.Getenv("TELEMETRY_RAW_RETENTION_HOURS")); err == nil && v > 0 {
+		raw = time.Duration(v) * time.Hour
+	}
+	if v, err := strconv.Atoi(os.Getenv("TELEMETRY_RETENTION_DAYS")); err == nil && v > 0 {
+		hourly = time.Duration(v) * 24 * time.Hour
+	}
+	return raw, hourly
+}
+
+// telemetryThrottle keeps heartbeats (every 10s) down to one stored sample
+// per robot per raw resolution.
+type telemetryThrottle struct {
+	mu   sync.Mutex
+	last map[int64]time.Time
+}
+
+func (t *telemetryThrottle) allow(robotID int64, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.last == nil {
+		t.last = make(map[int64]time.Time)
+	}
+	if now.Sub(t.last[robotID]) < db.TelemetryRaw*time.Second {
+		return false
+	}
+	t.last[robotID] = now
+	return true
+}
+
+// RecordTelemetry stores the metrics from a heartbeat. Junk from a
+// misbehaving agent (non-finite values, odd names, too many metrics) is
+// dropped.
+func (c *Controller) RecordTelemetry(ctx context.Context, robotID int64, metrics map[string]float64) {
+	if len(metrics) == 0 || !c.telemetry.allow(robotID, time.Now()) {
+		return
+	}
+	clean := make(map[string]float64, len(metrics))
+	for name, v := range metrics {
+		if len(clean) >= maxTelemetryMetrics {
+			break
+		}
+		if name == "" || len(name) > maxTelemetryMetricName || math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		clean[name] = v
+	}
+	if err := c.DB.RecordTelemetry(ctx, robotID, time.Now(), clean); err != nil {
+		slog.Error("telemetry: failed to record", "robot_id", robotID, "err", err)
+	}
+}
+
+// RunTelemetryMaintenance rolls finished hours of raw samples up into hourly
+// averages and prunes both beyond their retention.
+func (c *Controller) RunTelemetryMaintenance(ctx context.Context) {
+	ticker := time.NewTicker(telemetryMaintenanceInterval)
+	defer ticker.Stop()
+	for {
+		c.maintainTelemetry(ctx, time.Now().UTC())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Controller) maintainTelemetry(ctx context.Context, now time.Time) {
+	rawRetention, retention := telemetryRetention()
+	hour := now.Truncate(time.Hour)
+	from, err := c.DB.LastTelemetryRollup(ctx)
+	if err != nil {
+		slog.Error("telemetry: read last rollup", "err", err)
+		return
+	}
+	if oldest := now.Add(-rawRetention).Truncate(time.Hour); from.Before(oldest) {
+		from = oldest
+	}
+	if from.Before(hour) {
+		if err := c.DB.RollupTelemetry(ctx, from, hour); err != nil {
+			slog.Error("telemetry: rollup", "from", from, "to", hour, "err", err)
+			return
+		}
+	}
+	// Raw samples are only dropped once their hour has been rolled up.
+	rawCutoff := now.Add(-rawRetention)
+	if rawCutoff.After(hour) {
+		rawCutoff = hour
+	}
+	if n, err := c.DB.PruneTelemetry(ctx, db.TelemetryRaw, rawCutoff); err != nil {
+		slog.Error("telemetry: prune raw", "err", err)
+	} else if n > 0 {
+		slog.Debug("telemetry: pruned raw samples", "rows", n)
+	}
+	if _, err := c.DB.PruneTelemetry(ctx, db.TelemetryHourly, now.Add(-retention)); err != nil {
+		slog.Error("telemetry: prune hourly", "err", err)
+	}
+}
+
+// TelemetrySeries is one metric of one robot over a time range.
+type TelemetrySeries struct {
+	RobotID int64  `json:"robot_id"`
+	Metric  string `json:"metric"`
+	Range   string `json:"range"`
+	// ResolutionSec is the spacing of the points: 60 for ranges still
+	// covered by raw samples, 3600 beyond that.
+	ResolutionSec int                 `json:"resolution_sec"`
+	Points        []db.TelemetryPoint `json:"points"`
+}
+
+// GetRobotTelemetry handles GET /api/robots/{id}/telemetry?metric=battery&range=24h.
+func (c *Controller) GetRobotTelemetry(w http.ResponseWriter, r *http.Request) {
+	id, err := parseRobotID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid robot id")
+		return
+	}
+	log := logging.FromContext(r.Context())
+	metric := r.URL.Query().Get("metric")
+	if metric == "" {
+		names, err := c.DB.TelemetryMetrics(r.Context(), id)
+		if err != nil {
+			log.Error("list telemetry metrics", "err", err)
+			respondError(w, http.StatusInternalServerError, "failed to list metrics")
+			return
+		}
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("metric required (recorded: %s)", strings.Join(names, ", ")))
+		return
+	}
+	rangeStr := r.URL.Query().Get("range")
+	span := defaultTelemetryRange
+	if rangeStr != "" {
+		if span, err = parseTelemetryRange(rangeStr); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else {
+		rangeStr = "24h"
+	}
+
+	now := time.Now().UTC()
+	since := now.Add(-span)
+	rawRetention, _ := telemetryRetention()
+	series := TelemetrySeries{RobotID: id, Metric: metric, Range: rangeStr, ResolutionSec: db.TelemetryRaw}
+	if span <= rawRetention {
+		series.Points, err = c.DB.TelemetrySeries(r.Context(), id, metric, db.TelemetryRaw, since)
+	} else {
+		series.ResolutionSec = db.TelemetryHourly
+		series.Points, err = c.hourlySeries(r.Context(), id, metric, since)
+	}
+	if err != nil {
+		log.Error("telemetry series", "robot_id", id, "metric", metric, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to load telemetry")
+		return
+	}
+	respondJSON(w, http.StatusOK, series)
+}
+
+// hourlySeries returns the rolled-up hours since the given time, followed by
+// the hours not rolled up yet (including the current one) averaged from raw
+// samples.
+func (c *Controller) hourlySeries(ctx context.Context, robotID int64, metric string, since time.Time) ([]db.TelemetryPoint, error) {
+	points, err := c.DB.TelemetrySeries(ctx, robotID, metric, db.TelemetryHourly, since.Truncate(time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	tailFrom := since
+	if len(points) > 0 {
+		tailFrom = points[len(points)-1].TS.Add(time.Hour)
+	}
+	raw, err := c.DB.TelemetrySeries(ctx, robotID, metric, db.TelemetryRaw, tailFrom)
+	if err != nil {
+		return nil, err
+	}
+	var sum float64
+	var n int
+	for i, p := range raw {
+		hour := p.TS.UTC().Truncate(time.Hour)
+		if n == 0 {
+			points = append(points, db.TelemetryPoint{TS: hour, Min: p.Value, Max: p.Value})
+		}
+		last := &points[len(points)-1]
+		sum += p.Value
+		n++
+		last.Value = sum / float64(n)
+		last.Min = min(last.Min, p.Value)
+		last.Max = max(last.Max, p.Value)
+		if i+1 < len(raw) && !raw[i+1].TS.UTC().Truncate(time.Hour).Equal(hour) {
+			sum, n = 0, 0
+		}
+	}
+	return points, nil
+}
+
+// parseTelemetryRange accepts Go durations ("90m", "24h") and whole days
+// ("7d").
+func parseTelemetryRange(s string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid range %q (use e.g. 24h or 7d)", s)
+	}
+	return d, nil
+}
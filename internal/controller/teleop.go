@@ -0,0 +1,218 @@
+package controller
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// teleopAnswerWait bounds how long a teleop request waits for the robot's
+// answer. The agent gives its peer 20s, which leaves room for a command
+// already running.
+const teleopAnswerWait = 40 * time.Second
+
+// teleopRegistry hands WebRTC answers posted by agents to the request
+// waiting for them.
+type teleopRegistry struct {
+	mu      sync.Mutex
+	pending map[string]pendingTeleopAnswer
+}
+
+type pendingTeleopAnswer struct {
+	RobotID int64
+	Result  chan agent.TeleopAnswer
+}
+
+func (r *teleopRegistry) add(robotID int64) (string, chan agent.TeleopAnswer) {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	token := hex.EncodeToString(buf)
+	ch := make(chan agent.TeleopAnswer, 1)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending == nil {
+		r.pending = make(map[string]pendingTeleopAnswer)
+	}
+	r.pending[token] = pendingTeleopAnswer{RobotID: robotID, Result: ch}
+	return token, ch
+}
+
+// deliver passes answer to the waiting request and reports whether there was
+// one.
+func (r *teleopRegistry) deliver(token string, robotID int64, answer agent.TeleopAnswer) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.pending[token]
+	if !ok || p.RobotID != robotID {
+		return false
+	}
+	delete(r.pending, token)
+	p.Result <- answer
+	return true
+}
+
+// expects reports whether an answer from the robot is awaited under token.
+func (r *teleopRegistry) expects(token string, robotID int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.pending[token]
+	return ok && p.RobotID == robotID
+}
+
+func (r *teleopRegistry) cancel(token string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pending, token)
+}
+
+type teleopRequest struct {
+	// SDP is the operator's offer with its ICE candidates gathered; there is
+	// no trickle ICE.
+	SDP            string `json:"sdp"`
+	MaxDurationSec int    `json:"max_duration_sec"`
+}
+
+type teleopResponse struct {
+	Session string `json:"session"`
+	SDP     string `json:"sdp"`
+	Job     db.Job `json:"job"`
+}
+
+// StartTeleop relays an operator's WebRTC offer to the robot and returns its
+// answer. The peer on the robot sends its camera and drives from velocities
+// on the data channel the operator opens, until either side hangs up.
+func (c *Controller) StartTeleop(w http.ResponseWriter, r *http.Request) {
+	id, err := parseRobotID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid robot id")
+		return
+	}
+	var req teleopRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	if !strings.HasPrefix(strings.TrimSpace(req.SDP), "v=0") {
+		respondError(w, http.StatusBadRequest, "sdp must be a session description offer")
+		return
+	}
+	if req.MaxDurationSec < 0 {
+		respondError(w, http.StatusBadRequest, "max_duration_sec must not be negative")
+		return
+	}
+	robot, err := c.DB.GetRobotByID(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(w, http.StatusNotFound, "robot not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("teleop fetch robot", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to fetch robot")
+		return
+	}
+	if robot.AgentID == "" {
+		respondError(w, http.StatusBadRequest, "robot has no agent attached")
+		return
+	}
+	if robot.Type == "laptop" {
+		respondError(w, http.StatusBadRequest, "laptops cannot be driven")
+		return
+	}
+	if robot.Status == "offline" {
+		respondError(w, http.StatusConflict, "robot is offline")
+		return
+	}
+
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	session := hex.EncodeToString(buf)
+	token, result := c.teleop.add(id)
+	defer c.teleop.cancel(token)
+	data, _ := json.Marshal(agent.TeleopStartData{
+		Session:        session,
+		Offer:          req.SDP,
+		AnswerURL:      robotCallbackBase(r, id) + "/teleop/answer?token=" + token,
+		MaxDurationSec: req.MaxDurationSec,
+	})
+	job, err := c.queueRobotCommand(r.Context(), robot, agent.Command{Type: "teleop_start", Data: data})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("queue teleop", "robot", robot.Name, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to queue command")
+		return
+	}
+
+	timer := time.NewTimer(teleopAnswerWait)
+	defer timer.Stop()
+	select {
+	case answer := <-result:
+		if answer.Error != "" {
+			respondError(w, http.StatusBadGateway, "robot could not start teleop: "+answer.Error)
+			return
+		}
+		c.audit(r.Context(), "robot.teleop", robot.Name, "session "+session)
+		respondJSON(w, http.StatusOK, teleopResponse{Session: session, SDP: answer.SDP, Job: job})
+	case <-timer.C:
+		respondError(w, http.StatusGatewayTimeout, "robot did not answer in time")
+	case <-r.Context().Done():
+	}
+}
+
+// TeleopAnswer receives the robot's answer from the agent.
+func (c *Controller) TeleopAnswer(w http.ResponseWriter, r *http.Request) {
+	id, err := parseRobotID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid robot id")
+		return
+	}
+	var answer agent.TeleopAnswer
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&answer); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid answer")
+		return
+	}
+	if !c.teleop.deliver(r.URL.Query().Get("token"), id, answer) {
+		respondError(w, http.StatusForbidden, "invalid or expired teleop token")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "received"})
+}
+
+// StopTeleop ends the robot's teleop session, or only ?session= if it is
+// still the open one, and stops the robot.
+func (c *Controller) StopTeleop(w http.ResponseWriter, r *http.Request) {
+	id, err := parseRobotID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid robot id")
+		return
+	}
+	robot, err := c.DB.GetRobotByID(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondError(w, http.StatusNotFound, "robot not found")
+			return
+		}
+		logging.FromContext(r.Context()).Error("teleop stop fetch robot", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to fetch robot")
+		return
+	}
+	if robot.AgentID == "" {
+		respondError(w, http.StatusBadRequest, "robot has no agent attached")
+		return
+	}
+	data, _ := json.Marshal(agent.TeleopStopData{Session: r.URL.Query().Get("session")})
+	job, err := c.queueRobotCommand(r.Context(), robot, agent.Command{Type: "teleop_stop", Data: data})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("queue teleop stop", "robot", robot.Name, "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to queue command")
+		return
+	}
+	respondJSON(w, http.StatusAccepted, job)
+}
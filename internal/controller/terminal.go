@@ -2,18 +2,19 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/gorilla/websocket"
 	"golang.org/x/crypto/ssh"
 
 	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/logging"
+	sshc "example.com/openrobot-fleet/internal/ssh"
 )
 
 var upgrader = websocket.Upgrader{
@@ -59,6 +60,7 @@ func (c *Controller) HandleTerminal(w http.ResponseWriter, r *http.Request) {
 			}
 			if robot.InstallConfig.SSHKey == "" {
 				robot.InstallConfig.SSHKey = defaultCfg.SSHKey
+				robot.InstallConfig.KeyPassphrase = defaultCfg.KeyPassphrase
 			}
 		}
 	}
@@ -69,38 +71,36 @@ func (c *Controller) HandleTerminal(w http.ResponseWriter, r *http.Request) {
 		addr = robot.InstallConfig.Address
 	}
 
-	if addr == "" || robot.InstallConfig.User == "" || robot.InstallConfig.SSHKey == "" {
+	if addr == "" || robot.InstallConfig.User == "" || (robot.InstallConfig.SSHKey == "" && sshc.AgentSocket() == "") {
 		http.Error(w, "robot ssh credentials missing", http.StatusBadRequest)
 		return
 	}
 
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("websocket upgrade: %v", err)
+		logging.FromContext(r.Context()).Error("websocket upgrade", "err", err)
 		return
 	}
 	defer ws.Close()
 
-	signer, err := ssh.ParsePrivateKey([]byte(robot.InstallConfig.SSHKey))
-	if err != nil {
-		ws.WriteMessage(websocket.TextMessage, []byte("error: invalid private key\r\n"))
-		return
-	}
-
-	config := &ssh.ClientConfig{
-		User:            robot.InstallConfig.User,
-		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         10 * time.Second,
-	}
-
 	if !strings.Contains(addr, ":") {
 		addr = addr + ":22"
 	}
 
-	client, err := ssh.Dial("tcp", addr, config)
+	host := sshc.HostSpec{
+		Addr:          addr,
+		User:          robot.InstallConfig.User,
+		PrivateKey:    []byte(robot.InstallConfig.SSHKey),
+		KeyPassphrase: robot.InstallConfig.KeyPassphrase,
+	}
+	c.pinRobotHostKey(r.Context(), robot.ID, &host)
+	client, err := sshc.Dial(host)
 	if err != nil {
-		ws.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("error: ssh dial failed: %v\r\n", err)))
+		msg := fmt.Sprintf("ssh dial failed: %v", err)
+		if errors.Is(err, sshc.ErrHostKeyMismatch) {
+			msg = hostKeyChangedMessage(err)
+		}
+		ws.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("error: %s\r\n", msg)))
 		return
 	}
 	defer client.Close()
@@ -168,6 +168,12 @@ func (c *Controller) HandleTerminal(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
+	// Unblock the read loop when the controller shuts down
+	go func() {
+		<-r.Context().Done()
+		ws.Close()
+	}()
+
 	// Read from websocket and write to stdin
 	for {
 		_, msg, err := ws.ReadMessage()
@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// Usage accounting sizes and bills hosted deployments: how many robots are
+// enrolled, how many agents are active, how many golden images were built
+// and how much disk the controller's data takes. Limits are optional and
+// only reported unless USAGE_ENFORCE is set.
+
+// usageLimits are the configured limits; zero means no limit.
+type usageLimits struct {
+	Robots         int    `json:"robots,omitempty"`
+	BuildsPerMonth int    `json:"builds_per_month,omitempty"`
+	StorageBytes   uint64 `json:"storage_bytes,omitempty"`
+}
+
+func usageLimitsFromEnv() (usageLimits, bool) {
+	var l usageLimits
+	if v, err := strconv.Atoi(os.Getenv("USAGE_LIMIT_ROBOTS")); err == nil && v > 0 {
+		l.Robots = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("USAGE_LIMIT_BUILDS_PER_MONTH")); err == nil && v > 0 {
+		l.BuildsPerMonth = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("USAGE_LIMIT_STORAGE_GB"), 64); err == nil && v > 0 {
+		l.StorageBytes = uint64(v * (1 << 30))
+	}
+	return l, os.Getenv("USAGE_ENFORCE") == "true"
+}
+
+// UsageReport is the deployment's usage this calendar month.
+type UsageReport struct {
+	PeriodStart  time.Time   `json:"period_start"`
+	GeneratedAt  time.Time   `json:"generated_at"`
+	Robots       int         `json:"robots"`
+	ActiveAgents int         `json:"active_agents"`
+	OnlineAgents int         `json:"online_agents"`
+	Builds       int         `json:"builds"`
+	BuildsTotal  int         `json:"builds_total"`
+	StorageBytes uint64      `json:"storage_bytes"`
+	Limits       usageLimits `json:"limits"`
+	Enforced     bool        `json:"enforced"`
+	// Exceeded lists the limits reached: robots, builds or storage.
+	Exceeded []string `json:"exceeded"`
+}
+
+func monthStart(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+}
+
+func (c *Controller) usage(ctx context.Context) (UsageReport, error) {
+	now := time.Now()
+	rep := UsageReport{PeriodStart: monthStart(now), GeneratedAt: now, Exceeded: []string{}}
+	rep.Limits, rep.Enforced = usageLimitsFromEnv()
+	counts, err := c.DB.CountUsage(ctx, rep.PeriodStart)
+	if err != nil {
+		return rep, err
+	}
+	rep.Robots, rep.ActiveAgents, rep.OnlineAgents = counts.Robots, counts.ActiveAgents, counts.OnlineAgents
+	rep.Builds, rep.BuildsTotal = counts.Builds, counts.BuildsTotal
+	rep.StorageBytes = c.storageUsed()
+
+	if rep.Limits.Robots > 0 && rep.Robots >= rep.Limits.Robots {
+		rep.Exceeded = append(rep.Exceeded, "robots")
+	}
+	if rep.Limits.BuildsPerMonth > 0 && rep.Builds >= rep.Limits.BuildsPerMonth {
+		rep.Exceeded = append(rep.Exceeded, "builds")
+	}
+	if rep.Limits.StorageBytes > 0 && rep.StorageBytes >= rep.Limits.StorageBytes {
+		rep.Exceeded = append(rep.Exceeded, "storage")
+	}
+	return rep, nil
+}
+
+// storageUsed adds up the database, golden images, ROS bags and camera
+// snapshots.
+func (c *Controller) storageUsed() uint64 {
+	var total uint64
+	for _, u := range c.storageUsage() {
+		total += u.ContentBytes
+	}
+	return total + dirBytes(filepath.Dir(snapshotPath(0)))
+}
+
+// GetUsage reports the deployment's usage this month against its limits.
+func (c *Controller) GetUsage(w http.ResponseWriter, r *http.Request) {
+	rep, err := c.usage(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("count usage", "err", err)
+		respondError(w, http.StatusInternalServerError, "failed to count usage")
+		return
+	}
+	respondJSON(w, http.StatusOK, rep)
+}
+
+// usageLimitReached returns why adding more of kind (robots, builds or
+// storage) is refused, or "" when it isn't: limits are enforced and the
+// limit is reached.
+func (c *Controller) usageLimitReached(ctx context.Context, kind string) string {
+	if limits, enforced := usageLimitsFromEnv(); !enforced || limits == (usageLimits{}) {
+		return ""
+	}
+	rep, err := c.usage(ctx)
+	if err != nil {
+		// Don't lock users out because usage couldn't be counted.
+		slog.Error("usage: count", "err", err)
+		return ""
+	}
+	for _, e := range rep.Exceeded {
+		if e != kind {
+			continue
+		}
+		switch kind {
+		case "robots":
+			return fmt.Sprintf("robot limit of %d reached", rep.Limits.Robots)
+		case "builds":
+			return fmt.Sprintf("limit of %d golden image builds a month reached", rep.Limits.BuildsPerMonth)
+		case "storage":
+			return fmt.Sprintf("storage limit of %s reached", formatBytes(rep.Limits.StorageBytes))
+		}
+	}
+	return ""
+}
+
+// AllowEnrollment reports whether a new agent may join the fleet. Refused
+// agents are logged and alerted on once each.
+func (c *Controller) AllowEnrollment(ctx context.Context, agentID string) bool {
+	msg := c.usageLimitReached(ctx, "robots")
+	if msg == "" {
+		c.refusedAgents.Delete(agentID)
+		return true
+	}
+	if _, seen := c.refusedAgents.LoadOrStore(agentID, true); !seen {
+		slog.Warn("usage: refusing new agent", "agent_id", agentID, "reason", msg)
+		c.raiseAlert("usage", 0, fmt.Sprintf("Agent %s was not enrolled: %s", agentID, msg))
+	}
+	return false
+}
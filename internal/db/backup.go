@@ -0,0 +1,285 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// An encrypted backup is
+//
+//	"ORFBAK01" | mode (1 byte) | key info length (uint16) | key info | nonce | ciphertext
+//
+// sealed with AES-256-GCM, the header before the nonce being authenticated
+// too. The key info is the scrypt salt for a passphrase, or for the controller
+// key a random file key wrapped with the SECRETS_KEY master key, like the
+// data keys of stored secrets.
+const backupMagic = "ORFBAK01"
+
+const (
+	backupModePassphrase    byte = 1
+	backupModeControllerKey byte = 2
+)
+
+// sqliteMagic starts every SQLite database file.
+const sqliteMagic = "SQLite format 3\x00"
+
+var (
+	// ErrBackupPassphrase is returned by Restore when an encrypted backup
+	// was given no passphrase or the wrong one.
+	ErrBackupPassphrase = errors.New("backup is encrypted; the passphrase is missing or wrong")
+	// ErrInvalidBackup is returned by Restore for files that aren't a
+	// controller database or can't be decrypted.
+	ErrInvalidBackup = errors.New("not a valid controller backup")
+)
+
+// BackupEncryption selects how Backup encrypts the copy. The zero value
+// leaves it in the clear.
+type BackupEncryption struct {
+	Passphrase string
+	// ControllerKey encrypts with the SECRETS_KEY master key instead, so only
+	// a controller with the same key can restore it.
+	ControllerKey bool
+}
+
+// Backup writes a consistent copy of the SQLite database to w, encrypted as
+// enc asks.
+func (d *DB) Backup(ctx context.Context, w io.Writer, enc BackupEncryption) error {
+	if d.Driver != DriverSQLite {
+		return errors.New("backup is only available for SQLite")
+	}
+	if enc.ControllerKey && d.secrets == nil {
+		return errors.New("no SECRETS_KEY or SECRETS_KEY_FILE is configured to encrypt the backup with")
+	}
+	dir, err := os.MkdirTemp(filepath.Dir(d.Path), ".backup-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	snapshot := filepath.Join(dir, "controller.db")
+	// Unlike copying the file, this includes writes still in the WAL.
+	if _, err := d.SQL.ExecContext(ctx, `VACUUM INTO ?`, snapshot); err != nil {
+		return fmt.Errorf("snapshot database: %w", err)
+	}
+	if enc.Passphrase == "" && !enc.ControllerKey {
+		f, err := os.Open(snapshot)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	}
+	plain, err := os.ReadFile(snapshot)
+	if err != nil {
+		return err
+	}
+	sealed, err := d.sealBackup(plain, enc)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(sealed)
+	return err
+}
+
+func (d *DB) sealBackup(plain []byte, enc BackupEncryption) ([]byte, error) {
+	var mode byte
+	var key, keyInfo []byte
+	var err error
+	if enc.ControllerKey {
+		mode, key = backupModeControllerKey, make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if keyInfo, err = gcmSeal(d.secrets.master, key); err != nil {
+			return nil, err
+		}
+	} else {
+		mode, keyInfo = backupModePassphrase, make([]byte, 16)
+		if _, err := rand.Read(keyInfo); err != nil {
+			return nil, err
+		}
+		if key, err = backupKey(enc.Passphrase, keyInfo); err != nil {
+			return nil, err
+		}
+	}
+	header := backupHeader(mode, keyInfo)
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append(header, nonce...)
+	return aead.Seal(out, nonce, plain, header), nil
+}
+
+func backupHeader(mode byte, keyInfo []byte) []byte {
+	h := append([]byte(backupMagic), mode, 0, 0)
+	binary.BigEndian.PutUint16(h[len(backupMagic)+1:], uint16(len(keyInfo)))
+	return append(h, keyInfo...)
+}
+
+func backupKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+}
+
+// IsEncryptedBackup reports whether raw starts like an encrypted backup.
+func IsEncryptedBackup(raw []byte) bool {
+	return bytes.HasPrefix(raw, []byte(backupMagic))
+}
+
+// openBackup decrypts an encrypted backup.
+func (d *DB) openBackup(raw []byte, passphrase string) ([]byte, error) {
+	n := len(backupMagic)
+	if len(raw) < n+3 {
+		return nil, ErrInvalidBackup
+	}
+	mode, keyLen := raw[n], int(binary.BigEndian.Uint16(raw[n+1:]))
+	if len(raw) < n+3+keyLen {
+		return nil, ErrInvalidBackup
+	}
+	header, keyInfo := raw[:n+3+keyLen], raw[n+3:n+3+keyLen]
+	var key []byte
+	var err error
+	switch mode {
+	case backupModePassphrase:
+		if passphrase == "" {
+			return nil, ErrBackupPassphrase
+		}
+		if key, err = backupKey(passphrase, keyInfo); err != nil {
+			return nil, err
+		}
+	case backupModeControllerKey:
+		if d.secrets == nil {
+			return nil, errors.New("backup is encrypted with a controller key, but no SECRETS_KEY or SECRETS_KEY_FILE is configured")
+		}
+		if key, err = gcmOpen(d.secrets.master, keyInfo); err != nil {
+			return nil, errors.New("backup is encrypted with a different controller key")
+		}
+	default:
+		return nil, ErrInvalidBackup
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := openSealedBackup(aead, raw[len(header):], header)
+	if err != nil {
+		if mode == backupModePassphrase {
+			return nil, ErrBackupPassphrase
+		}
+		return nil, ErrInvalidBackup
+	}
+	return plain, nil
+}
+
+func openSealedBackup(aead cipher.AEAD, sealed, header []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrInvalidBackup
+	}
+	n := aead.NonceSize()
+	return aead.Open(nil, sealed[:n], sealed[n:], header)
+}
+
+// Restore replaces the SQLite database with a backup read from r, decrypting
+// it with passphrase or the controller key if it is encrypted. The backup is
+// checked first: it must be an intact controller database whose secrets this
+// controller can read. The live database is untouched if any check fails.
+func (d *DB) Restore(ctx context.Context, r io.Reader, passphrase string) error {
+	if d.Driver != DriverSQLite {
+		return errors.New("restore is only available for SQLite")
+	}
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if IsEncryptedBackup(raw) {
+		if raw, err = d.openBackup(raw, passphrase); err != nil {
+			return err
+		}
+	}
+	if !bytes.HasPrefix(raw, []byte(sqliteMagic)) {
+		return ErrInvalidBackup
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(d.Path), ".restore-*.db")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer func() {
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			os.Remove(tmpPath + suffix)
+		}
+	}()
+	_, err = tmp.Write(raw)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := checkRestoredDB(ctx, tmpPath); err != nil {
+		return err
+	}
+
+	if err := d.SQL.Close(); err != nil {
+		slog.Error("restore: close database", "err", err)
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		os.Remove(d.Path + suffix)
+	}
+	if err := os.Rename(tmpPath, d.Path); err != nil {
+		return fmt.Errorf("replace database: %w", err)
+	}
+	restored, err := Open(DriverSQLite, d.Path)
+	if err != nil {
+		return fmt.Errorf("reopen database: %w", err)
+	}
+	d.SQL = restored.SQL
+	d.robotList.invalidate()
+	return nil
+}
+
+// checkRestoredDB opens the database at path the way the controller would,
+// migrating it and unsealing its secrets, after checking it is one.
+func checkRestoredDB(ctx context.Context, path string) error {
+	c, err := Connect(DriverSQLite, path)
+	if err != nil {
+		return err
+	}
+	var integrity string
+	err = c.SQL.QueryRowContext(ctx, `PRAGMA integrity_check`).Scan(&integrity)
+	if err == nil && integrity != "ok" {
+		err = errors.New(integrity)
+	}
+	var tables int
+	if err == nil {
+		err = c.SQL.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('robots', 'jobs', 'scenarios')`).Scan(&tables)
+	}
+	c.SQL.Close()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	if tables != 3 {
+		return fmt.Errorf("%w: no robots, jobs or scenarios tables", ErrInvalidBackup)
+	}
+	checked, err := Open(DriverSQLite, path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	return checked.SQL.Close()
+}
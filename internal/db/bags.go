@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Bag statuses. A bag is recording from when bag_start is queued until the
+// robot uploads it (stored) or the recording fails.
+const (
+	BagRecording = "recording"
+	BagStored    = "stored"
+	BagFailed    = "failed"
+)
+
+// Bag is one ROS bag recorded on a robot, optionally as part of a named
+// experiment. Topics is empty when every topic was recorded.
+type Bag struct {
+	ID          int64      `json:"id"`
+	RobotID     int64      `json:"robot_id"`
+	Experiment  string     `json:"experiment,omitempty"`
+	Topics      []string   `json:"topics"`
+	DurationSec int        `json:"duration_sec"`
+	JobID       *int64     `json:"job_id,omitempty"`
+	Token       string     `json:"-"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	SizeBytes   int64      `json:"size_bytes,omitempty"`
+	CreatedBy   string     `json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	// JobStatus is the status of the bag_start job, filled in by
+	// ListRecordingBags.
+	JobStatus string `json:"-"`
+}
+
+// BagFilter narrows ListBags. Zero fields don't filter.
+type BagFilter struct {
+	RobotID    int64
+	Experiment string
+	Limit      int
+}
+
+const bagColumns = `b.id, b.robot_id, b.experiment, b.topics, b.duration_sec, b.job_id, b.token, b.status, b.error, b.size_bytes, b.created_by, b.created_at, b.completed_at`
+
+// CreateBag records a bag about to be recorded and returns its id.
+func (d *DB) CreateBag(ctx context.Context, b Bag) (int64, error) {
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = time.Now().UTC()
+	}
+	if b.Status == "" {
+		b.Status = BagRecording
+	}
+	topics, err := json.Marshal(b.Topics)
+	if err != nil {
+		return 0, err
+	}
+	return d.insert(ctx, `INSERT INTO bags (robot_id, experiment, topics, duration_sec, token, status, error, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		b.RobotID, b.Experiment, string(topics), b.DurationSec, b.Token, b.Status, b.Error, b.CreatedBy, b.CreatedAt)
+}
+
+// SetBagJob records the bag_start job queued for a bag.
+func (d *DB) SetBagJob(ctx context.Context, id, jobID int64) error {
+	_, err := d.exec(ctx, `UPDATE bags SET job_id = ? WHERE id = ?`, jobID, id)
+	return err
+}
+
+// GetBag returns one bag, or sql.ErrNoRows.
+func (d *DB) GetBag(ctx context.Context, id int64) (Bag, error) {
+	rows, err := d.query(ctx, `SELECT `+bagColumns+`, '' FROM bags b WHERE b.id = ?`, id)
+	if err != nil {
+		return Bag{}, err
+	}
+	bags, err := scanBags(rows)
+	if err != nil {
+		return Bag{}, err
+	}
+	if len(bags) == 0 {
+		return Bag{}, sql.ErrNoRows
+	}
+	return bags[0], nil
+}
+
+// ListBags returns the bags f matches, newest first.
+func (d *DB) ListBags(ctx context.Context, f BagFilter) ([]Bag, error) {
+	var where []string
+	var args []interface{}
+	if f.RobotID != 0 {
+		where, args = append(where, "b.robot_id = ?"), append(args, f.RobotID)
+	}
+	if f.Experiment != "" {
+		where, args = append(where, "b.experiment = ?"), append(args, f.Experiment)
+	}
+	q := `SELECT ` + bagColumns + `, '' FROM bags b`
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	q += " ORDER BY b.created_at DESC, b.id DESC"
+	if f.Limit > 0 {
+		q += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+	rows, err := d.query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanBags(rows)
+}
+
+// ListRecordingBags returns the bags still waiting for an upload, with the
+// status of their bag_start job.
+func (d *DB) ListRecordingBags(ctx context.Context) ([]Bag, error) {
+	rows, err := d.query(ctx, `SELECT `+bagColumns+`, COALESCE(j.status, '') FROM bags b LEFT JOIN jobs j ON j.id = b.job_id WHERE b.status = ? ORDER BY b.id`, BagRecording)
+	if err != nil {
+		return nil, err
+	}
+	return scanBags(rows)
+}
+
+// FinishBag moves a recording bag to status. It reports false if the bag was
+// no longer recording, so a late upload can't revive a failed bag.
+func (d *DB) FinishBag(ctx context.Context, id int64, status string, size int64, errMsg string) (bool, error) {
+	res, err := d.exec(ctx, `UPDATE bags SET status = ?, size_bytes = ?, error = ?, completed_at = ? WHERE id = ? AND status = ?`,
+		status, size, errMsg, time.Now().UTC(), id, BagRecording)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteBag removes a bag's record.
+func (d *DB) DeleteBag(ctx context.Context, id int64) error {
+	res, err := d.exec(ctx, `DELETE FROM bags WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func scanBags(rows *sql.Rows) ([]Bag, error) {
+	defer rows.Close()
+	bags := []Bag{}
+	for rows.Next() {
+		var b Bag
+		var experiment, topics, errMsg, createdBy sql.NullString
+		var jobID, size sql.NullInt64
+		var completed sql.NullTime
+		if err := rows.Scan(&b.ID, &b.RobotID, &experiment, &topics, &b.DurationSec, &jobID, &b.Token, &b.Status, &errMsg, &size, &createdBy, &b.CreatedAt, &completed, &b.JobStatus); err != nil {
+			return nil, err
+		}
+		b.Experiment = experiment.String
+		b.Topics = []string{}
+		if topics.String != "" {
+			if err := json.Unmarshal([]byte(topics.String), &b.Topics); err != nil {
+				return nil, err
+			}
+		}
+		if jobID.Valid {
+			b.JobID = &jobID.Int64
+		}
+		b.Error = errMsg.String
+		b.SizeBytes = size.Int64
+		b.CreatedBy = createdBy.String
+		if completed.Valid {
+			t := completed.Time
+			b.CompletedAt = &t
+		}
+		bags = append(bags, b)
+	}
+	return bags, rows.Err()
+}
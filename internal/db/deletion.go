@@ -0,0 +1,179 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrRobotArchived is returned for operations that need an active robot.
+	ErrRobotArchived = errors.New("robot is archived")
+	// ErrRobotNotArchived is returned when restoring a robot that is active.
+	ErrRobotNotArchived = errors.New("robot is not archived")
+)
+
+// RobotDeletion reports what archiving or deleting a robot removed and what
+// it left in place, by table (or "snapshot" for the camera image on disk).
+type RobotDeletion struct {
+	RobotID  int64            `json:"robot_id"`
+	Name     string           `json:"name"`
+	AgentID  string           `json:"agent_id"`
+	Archived bool             `json:"archived"`
+	Removed  map[string]int64 `json:"removed"`
+	Retained map[string]int64 `json:"retained"`
+}
+
+// robotTx runs fn for robot id in one transaction, with exec and count
+// helpers bound to it.
+func (d *DB) robotTx(ctx context.Context, id int64, fn func(robot Robot, exec, count func(string, ...interface{}) (int64, error)) error) error {
+	robot, err := d.GetRobotByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	exec := func(query string, args ...interface{}) (int64, error) {
+		res, err := tx.ExecContext(ctx, d.dialect.rebind(query), args...)
+		if err != nil {
+			return 0, err
+		}
+		return res.RowsAffected()
+	}
+	count := func(query string, args ...interface{}) (int64, error) {
+		var n int64
+		err := tx.QueryRowContext(ctx, d.dialect.rebind(query), args...).Scan(&n)
+		return n, err
+	}
+	if err := fn(robot, exec, count); err != nil {
+		return err
+	}
+	err = tx.Commit()
+	d.robotList.invalidate()
+	return err
+}
+
+func newRobotDeletion(robot Robot, archived bool) RobotDeletion {
+	return RobotDeletion{
+		RobotID:  robot.ID,
+		Name:     robot.Name,
+		AgentID:  robot.AgentID,
+		Archived: archived,
+		Removed:  map[string]int64{},
+		Retained: map[string]int64{},
+	}
+}
+
+// ArchiveRobot soft-deletes robot id: it disappears from listings, selectors
+// and the fleet file but keeps its jobs, speed tests, telemetry, snapshots and scenario,
+// so reports still count it and RestoreRobot can bring it back. Queued and
+// running jobs are removed since they can never complete.
+func (d *DB) ArchiveRobot(ctx context.Context, id int64) (RobotDeletion, error) {
+	var rep RobotDeletion
+	err := d.robotTx(ctx, id, func(robot Robot, exec, count func(string, ...interface{}) (int64, error)) error {
+		if robot.ArchivedAt != nil {
+			return ErrRobotArchived
+		}
+		rep = newRobotDeletion(robot, true)
+		// Jobs only know the robot by agent ID; a robot that never connected
+		// has none.
+		if robot.AgentID != "" {
+			n, err := exec(`DELETE FROM jobs WHERE target_robot = ? AND status IN ('queued', 'pending', 'running', 'deferred')`, robot.AgentID)
+			if err != nil {
+				return fmt.Errorf("delete pending jobs: %w", err)
+			}
+			rep.Removed["pending_jobs"] = n
+			if rep.Retained["jobs"], err = count(`SELECT COUNT(*) FROM jobs WHERE target_robot = ?`, robot.AgentID); err != nil {
+				return fmt.Errorf("jobs: %w", err)
+			}
+		}
+		for _, table := range []string{"speed_tests", "telemetry", "scenario_applies", "robot_suspends", "snapshots", "ssh_host_keys"} {
+			n, err := count(`SELECT COUNT(*) FROM `+table+` WHERE robot_id = ?`, id)
+			if err != nil {
+				return fmt.Errorf("%s: %w", table, err)
+			}
+			rep.Retained[table] = n
+		}
+		if err := countAudit(robot, count, &rep); err != nil {
+			return err
+		}
+		_, err := exec(`UPDATE robots SET archived_at = ? WHERE id = ?`, time.Now().UTC(), id)
+		return err
+	})
+	return rep, err
+}
+
+// DeleteRobotCascade permanently deletes robot id, active or archived,
+// together with its jobs, speed tests, telemetry, scenario apply history,
+// suspends, snapshots and SSH host key, in one transaction.
+// Audit events are never deleted.
+func (d *DB) DeleteRobotCascade(ctx context.Context, id int64) (RobotDeletion, error) {
+	var rep RobotDeletion
+	err := d.robotTx(ctx, id, func(robot Robot, exec, count func(string, ...interface{}) (int64, error)) error {
+		rep = newRobotDeletion(robot, false)
+		if robot.AgentID != "" {
+			n, err := exec(`DELETE FROM jobs WHERE target_robot = ? AND status IN ('queued', 'pending', 'running', 'deferred')`, robot.AgentID)
+			if err != nil {
+				return fmt.Errorf("delete pending jobs: %w", err)
+			}
+			rep.Removed["pending_jobs"] = n
+			if rep.Removed["jobs"], err = exec(`DELETE FROM jobs WHERE target_robot = ?`, robot.AgentID); err != nil {
+				return fmt.Errorf("jobs: %w", err)
+			}
+		}
+		for _, table := range []string{"speed_tests", "telemetry", "scenario_applies", "robot_suspends", "snapshots", "ssh_host_keys"} {
+			n, err := exec(`DELETE FROM `+table+` WHERE robot_id = ?`, id)
+			if err != nil {
+				return fmt.Errorf("%s: %w", table, err)
+			}
+			rep.Removed[table] = n
+		}
+		if err := countAudit(robot, count, &rep); err != nil {
+			return err
+		}
+		if _, err := exec(`DELETE FROM robots WHERE id = ?`, id); err != nil {
+			return err
+		}
+		rep.Removed["robots"] = 1
+		return nil
+	})
+	return rep, err
+}
+
+func countAudit(robot Robot, count func(string, ...interface{}) (int64, error), rep *RobotDeletion) error {
+	agentRef := robot.AgentID
+	if agentRef == "" {
+		agentRef = robot.Name
+	}
+	n, err := count(`SELECT COUNT(*) FROM audit_events WHERE target IN (?, ?)`, robot.Name, agentRef)
+	if err != nil {
+		return fmt.Errorf("audit_events: %w", err)
+	}
+	rep.Retained["audit_events"] = n
+	return nil
+}
+
+// RestoreRobot returns an archived robot to the fleet.
+func (d *DB) RestoreRobot(ctx context.Context, id int64) (Robot, error) {
+	robot, err := d.GetRobotByID(ctx, id)
+	if err != nil {
+		return Robot{}, err
+	}
+	if robot.ArchivedAt == nil {
+		return Robot{}, ErrRobotNotArchived
+	}
+	if _, err := d.exec(ctx, `UPDATE robots SET archived_at = NULL WHERE id = ?`, id); err != nil {
+		return Robot{}, err
+	}
+	robot.ArchivedAt = nil
+	return robot, nil
+}
+
+// ListArchivedRobots returns archived robots, most recently archived first.
+func (d *DB) ListArchivedRobots(ctx context.Context) ([]Robot, error) {
+	return d.listRobots(ctx, `WHERE r.archived_at IS NOT NULL ORDER BY r.archived_at DESC`)
+}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Git deploy statuses. A deploy that needs approval starts out pending;
+// superseded means a newer push to the same branch arrived before anyone
+// decided on it.
+const (
+	GitDeployPending    = "pending"
+	GitDeployApplied    = "applied"
+	GitDeployRejected   = "rejected"
+	GitDeploySuperseded = "superseded"
+	GitDeployFailed     = "failed"
+)
+
+// GitDeploy is a push to a scenario's repo that redeploys the scenario.
+// RobotIDs are the robots picked when the push arrived; JobIDs the jobs
+// queued for them once it was applied.
+type GitDeploy struct {
+	ID           int64      `json:"id"`
+	ScenarioID   int64      `json:"scenario_id"`
+	ScenarioName string     `json:"scenario_name"`
+	Repo         string     `json:"repo"`
+	Branch       string     `json:"branch"`
+	Commit       string     `json:"commit,omitempty"`
+	Pusher       string     `json:"pusher,omitempty"`
+	RobotIDs     []int64    `json:"robot_ids"`
+	JobIDs       []int64    `json:"job_ids,omitempty"`
+	Status       string     `json:"status"`
+	Error        string     `json:"error,omitempty"`
+	DecidedBy    string     `json:"decided_by,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DecidedAt    *time.Time `json:"decided_at,omitempty"`
+}
+
+const gitDeployColumns = `id, scenario_id, scenario_name, repo, branch, commit_sha, pusher, robot_ids, job_ids, status, error, decided_by, created_at, decided_at`
+
+// CreateGitDeploy stores a new deploy and returns its id.
+func (d *DB) CreateGitDeploy(ctx context.Context, g GitDeploy) (int64, error) {
+	if g.CreatedAt.IsZero() {
+		g.CreatedAt = time.Now().UTC()
+	}
+	robots, _ := json.Marshal(g.RobotIDs)
+	jobs, _ := json.Marshal(g.JobIDs)
+	return d.insert(ctx, `INSERT INTO git_deploys (scenario_id, scenario_name, repo, branch, commit_sha, pusher, robot_ids, job_ids, status, error, decided_by, created_at, decided_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		g.ScenarioID, g.ScenarioName, g.Repo, g.Branch, g.Commit, g.Pusher, string(robots), string(jobs), g.Status, g.Error, g.DecidedBy, g.CreatedAt, g.DecidedAt)
+}
+
+// GetGitDeploy returns one deploy, or sql.ErrNoRows.
+func (d *DB) GetGitDeploy(ctx context.Context, id int64) (GitDeploy, error) {
+	rows, err := d.query(ctx, `SELECT `+gitDeployColumns+` FROM git_deploys WHERE id = ?`, id)
+	if err != nil {
+		return GitDeploy{}, err
+	}
+	deploys, err := scanGitDeploys(rows)
+	if err != nil {
+		return GitDeploy{}, err
+	}
+	if len(deploys) == 0 {
+		return GitDeploy{}, sql.ErrNoRows
+	}
+	return deploys[0], nil
+}
+
+// ListGitDeploys returns the newest deploys first, only those in status if it
+// is set.
+func (d *DB) ListGitDeploys(ctx context.Context, status string, limit int) ([]GitDeploy, error) {
+	query := `SELECT ` + gitDeployColumns + ` FROM git_deploys`
+	args := []interface{}{}
+	if status != "" {
+		query += ` WHERE status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY created_at DESC, id DESC LIMIT ?`
+	rows, err := d.query(ctx, query, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanGitDeploys(rows)
+}
+
+// DecideGitDeploy moves a pending deploy to status, recording who decided.
+// It reports false if the deploy was no longer pending, so two admins can't
+// both apply it.
+func (d *DB) DecideGitDeploy(ctx context.Context, id int64, status, decidedBy string) (bool, error) {
+	res, err := d.exec(ctx, `UPDATE git_deploys SET status = ?, decided_by = ?, decided_at = ? WHERE id = ? AND status = ?`,
+		status, decidedBy, time.Now().UTC(), id, GitDeployPending)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// FinishGitDeploy records the outcome of applying a deploy.
+func (d *DB) FinishGitDeploy(ctx context.Context, id int64, status string, jobIDs []int64, errMsg string) error {
+	jobs, _ := json.Marshal(jobIDs)
+	_, err := d.exec(ctx, `UPDATE git_deploys SET status = ?, job_ids = ?, error = ? WHERE id = ?`, status, string(jobs), errMsg, id)
+	return err
+}
+
+// SupersedeGitDeploys marks the scenario's deploys still pending for branch
+// as superseded by a newer push.
+func (d *DB) SupersedeGitDeploys(ctx context.Context, scenarioID int64, branch string) error {
+	_, err := d.exec(ctx, `UPDATE git_deploys SET status = ?, decided_at = ? WHERE scenario_id = ? AND branch = ? AND status = ?`,
+		GitDeploySuperseded, time.Now().UTC(), scenarioID, branch, GitDeployPending)
+	return err
+}
+
+func scanGitDeploys(rows *sql.Rows) ([]GitDeploy, error) {
+	defer rows.Close()
+	deploys := []GitDeploy{}
+	for rows.Next() {
+		var g GitDeploy
+		var commit, pusher, robots, jobs, errMsg, decidedBy sql.NullString
+		var decidedAt sql.NullTime
+		if err := rows.Scan(&g.ID, &g.ScenarioID, &g.ScenarioName, &g.Repo, &g.Branch, &commit, &pusher, &robots, &jobs, &g.Status, &errMsg, &decidedBy, &g.CreatedAt, &decidedAt); err != nil {
+			return nil, err
+		}
+		g.Commit = commit.String
+		g.Pusher = pusher.String
+		g.Error = errMsg.String
+		g.DecidedBy = decidedBy.String
+		_ = json.Unmarshal([]byte(robots.String), &g.RobotIDs)
+		_ = json.Unmarshal([]byte(jobs.String), &g.JobIDs)
+		if g.RobotIDs == nil {
+			g.RobotIDs = []int64{}
+		}
+		if decidedAt.Valid {
+			t := decidedAt.Time
+			g.DecidedAt = &t
+		}
+		deploys = append(deploys, g)
+	}
+	return deploys, rows.Err()
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// Supported values for DB_DRIVER.
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// dialect hides the differences between the SQL backends. Queries in this
+// package are written for SQLite (? placeholders, SQLite column types) and
+// passed through the dialect before they reach the driver.
+type dialect interface {
+	// rebind rewrites ? placeholders into the driver's syntax.
+	rebind(query string) string
+	// ddl rewrites a CREATE/ALTER TABLE statement's column types.
+	ddl(stmt string) string
+	// insert runs an INSERT and returns the new row's id.
+	insert(ctx context.Context, db *sql.DB, query string, args ...interface{}) (int64, error)
+}
+
+func dialectFor(driver string) (dialect, error) {
+	switch driver {
+	case "", DriverSQLite:
+		return sqliteDialect{}, nil
+	case DriverPostgres:
+		return postgresDialect{}, nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", driver)
+	}
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) rebind(query string) string { return query }
+
+func (sqliteDialect) ddl(stmt string) string { return stmt }
+
+func (sqliteDialect) insert(ctx context.Context, db *sql.DB, query string, args ...interface{}) (int64, error) {
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+type postgresDialect struct{}
+
+// rebind numbers placeholders $1, $2, ... skipping any ? inside quoted literals.
+func (postgresDialect) rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	inQuote := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inQuote = !inQuote
+		case r == '?' && !inQuote:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+var postgresTypes = strings.NewReplacer(
+	"INTEGER PRIMARY KEY AUTOINCREMENT", "BIGSERIAL PRIMARY KEY",
+	"INTEGER", "BIGINT",
+	"TIMESTAMP", "TIMESTAMPTZ",
+	"REAL", "DOUBLE PRECISION",
+)
+
+func (postgresDialect) ddl(stmt string) string { return postgresTypes.Replace(stmt) }
+
+// insert uses RETURNING since Postgres has no LastInsertId.
+func (p postgresDialect) insert(ctx context.Context, db *sql.DB, query string, args ...interface{}) (int64, error) {
+	var id int64
+	err := db.QueryRowContext(ctx, p.rebind(query)+" RETURNING id", args...).Scan(&id)
+	return id, err
+}
+
+func (d *DB) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	res, err := d.SQL.ExecContext(ctx, d.dialect.rebind(query), args...)
+	d.robotList.wrote(query)
+	return res, err
+}
+
+func (d *DB) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return d.SQL.QueryContext(ctx, d.dialect.rebind(query), args...)
+}
+
+func (d *DB) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return d.SQL.QueryRowContext(ctx, d.dialect.rebind(query), args...)
+}
+
+func (d *DB) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	return d.SQL.PrepareContext(ctx, d.dialect.rebind(query))
+}
+
+func (d *DB) insert(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	id, err := d.dialect.insert(ctx, d.SQL, query, args...)
+	d.robotList.wrote(query)
+	return id, err
+}
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// EnrollmentSlot pre-registers a robot by its MAC address or serial number.
+// When a robot flashed with the golden image phones home with a matching
+// identity it is enrolled under Name, with Type, Tags and Notes, without
+// anyone adopting it by hand.
+type EnrollmentSlot struct {
+	ID     int64    `json:"id"`
+	Name   string   `json:"name"`
+	MAC    string   `json:"mac,omitempty"`
+	Serial string   `json:"serial,omitempty"`
+	Type   string   `json:"type"`
+	Tags   []string `json:"tags"`
+	Notes  string   `json:"notes,omitempty"`
+	// RobotID and EnrolledAt are set once a robot has enrolled through the
+	// slot. A re-flashed robot enrolls through it again as the same robot
+	// once the slot is reset.
+	RobotID    *int64     `json:"robot_id,omitempty"`
+	EnrolledAt *time.Time `json:"enrolled_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+const enrollmentColumns = `id, name, mac, serial, type, tags, notes, robot_id, enrolled_at, created_at`
+
+// CreateEnrollmentSlot adds a slot to the pool and returns its id. MAC and
+// Serial are expected normalized (lower case).
+func (d *DB) CreateEnrollmentSlot(ctx context.Context, s EnrollmentSlot) (int64, error) {
+	if s.Type == "" {
+		s.Type = "robot"
+	}
+	return d.insert(ctx, `INSERT INTO enrollment_pool (name, mac, serial, type, tags, notes, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		s.Name, s.MAC, s.Serial, s.Type, strings.Join(s.Tags, ","), s.Notes, time.Now().UTC())
+}
+
+// GetEnrollmentSlot returns one slot, or sql.ErrNoRows.
+func (d *DB) GetEnrollmentSlot(ctx context.Context, id int64) (EnrollmentSlot, error) {
+	rows, err := d.query(ctx, `SELECT `+enrollmentColumns+` FROM enrollment_pool WHERE id = ?`, id)
+	if err != nil {
+		return EnrollmentSlot{}, err
+	}
+	slots, err := scanEnrollmentSlots(rows)
+	if err != nil {
+		return EnrollmentSlot{}, err
+	}
+	if len(slots) == 0 {
+		return EnrollmentSlot{}, sql.ErrNoRows
+	}
+	return slots[0], nil
+}
+
+// ListEnrollmentSlots returns the pool ordered by name.
+func (d *DB) ListEnrollmentSlots(ctx context.Context) ([]EnrollmentSlot, error) {
+	rows, err := d.query(ctx, `SELECT `+enrollmentColumns+` FROM enrollment_pool ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	return scanEnrollmentSlots(rows)
+}
+
+// FindEnrollmentSlot returns the slot registered for any of macs or for
+// serial, or sql.ErrNoRows. A MAC match wins over a serial match.
+func (d *DB) FindEnrollmentSlot(ctx context.Context, macs []string, serial string) (EnrollmentSlot, error) {
+	for _, mac := range macs {
+		if mac == "" {
+			continue
+		}
+		rows, err := d.query(ctx, `SELECT `+enrollmentColumns+` FROM enrollment_pool WHERE mac = ? ORDER BY id LIMIT 1`, mac)
+		if err != nil {
+			return EnrollmentSlot{}, err
+		}
+		slots, err := scanEnrollmentSlots(rows)
+		if err != nil {
+			return EnrollmentSlot{}, err
+		}
+		if len(slots) > 0 {
+			return slots[0], nil
+		}
+	}
+	if serial != "" {
+		rows, err := d.query(ctx, `SELECT `+enrollmentColumns+` FROM enrollment_pool WHERE serial = ? ORDER BY id LIMIT 1`, serial)
+		if err != nil {
+			return EnrollmentSlot{}, err
+		}
+		slots, err := scanEnrollmentSlots(rows)
+		if err != nil {
+			return EnrollmentSlot{}, err
+		}
+		if len(slots) > 0 {
+			return slots[0], nil
+		}
+	}
+	return EnrollmentSlot{}, sql.ErrNoRows
+}
+
+// ClaimEnrollmentSlot marks a slot enrolled and reports whether it wasn't
+// already, so that of two robots enrolling through one slot only the first
+// gets it.
+func (d *DB) ClaimEnrollmentSlot(ctx context.Context, id int64) (bool, error) {
+	res, err := d.exec(ctx, `UPDATE enrollment_pool SET enrolled_at = ? WHERE id = ? AND enrolled_at IS NULL`, time.Now().UTC(), id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ResetEnrollmentSlot lets a robot enroll through the slot again. The robot
+// that enrolled through it is kept, and enrolls as the same robot.
+func (d *DB) ResetEnrollmentSlot(ctx context.Context, id int64) error {
+	res, err := d.exec(ctx, `UPDATE enrollment_pool SET enrolled_at = NULL WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MarkEnrollmentSlotEnrolled records that robotID enrolled through a slot.
+func (d *DB) MarkEnrollmentSlotEnrolled(ctx context.Context, id, robotID int64) error {
+	_, err := d.exec(ctx, `UPDATE enrollment_pool SET robot_id = ?, enrolled_at = ? WHERE id = ?`, robotID, time.Now().UTC(), id)
+	return err
+}
+
+// DeleteEnrollmentSlot removes a slot from the pool. A robot that already
+// enrolled through it is kept.
+func (d *DB) DeleteEnrollmentSlot(ctx context.Context, id int64) error {
+	res, err := d.exec(ctx, `DELETE FROM enrollment_pool WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func scanEnrollmentSlots(rows *sql.Rows) ([]EnrollmentSlot, error) {
+	defer rows.Close()
+	slots := []EnrollmentSlot{}
+	for rows.Next() {
+		var s EnrollmentSlot
+		var mac, serial, tags, notes sql.NullString
+		var robotID sql.NullInt64
+		var enrolled sql.NullTime
+		if err := rows.Scan(&s.ID, &s.Name, &mac, &serial, &s.Type, &tags, &notes, &robotID, &enrolled, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		s.MAC = mac.String
+		s.Serial = serial.String
+		s.Tags = []string{}
+		if tags.String != "" {
+			s.Tags = strings.Split(tags.String, ",")
+		}
+		s.Notes = notes.String
+		if robotID.Valid {
+			s.RobotID = &robotID.Int64
+		}
+		if enrolled.Valid {
+			t := enrolled.Time
+			s.EnrolledAt = &t
+		}
+		slots = append(slots, s)
+	}
+	return slots, rows.Err()
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// HelpTopic is an admin's version of the guidance shown for a feature,
+// replacing the built-in text.
+type HelpTopic struct {
+	Key       string    `json:"key"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+}
+
+// ListHelpTopics returns the customized topics by key.
+func (d *DB) ListHelpTopics(ctx context.Context) ([]HelpTopic, error) {
+	rows, err := d.query(ctx, `SELECT key, title, body, updated_at, COALESCE(updated_by, '') FROM help_topics ORDER BY key`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	topics := []HelpTopic{}
+	for rows.Next() {
+		var t HelpTopic
+		if err := rows.Scan(&t.Key, &t.Title, &t.Body, &t.UpdatedAt, &t.UpdatedBy); err != nil {
+			return nil, err
+		}
+		topics = append(topics, t)
+	}
+	return topics, rows.Err()
+}
+
+// GetHelpTopic returns the customized topic key, or nil if it has the
+// built-in text.
+func (d *DB) GetHelpTopic(ctx context.Context, key string) (*HelpTopic, error) {
+	var t HelpTopic
+	err := d.queryRow(ctx, `SELECT key, title, body, updated_at, COALESCE(updated_by, '') FROM help_topics WHERE key = ?`, key).
+		Scan(&t.Key, &t.Title, &t.Body, &t.UpdatedAt, &t.UpdatedBy)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// SaveHelpTopic stores t, replacing any earlier version.
+func (d *DB) SaveHelpTopic(ctx context.Context, t HelpTopic) error {
+	_, err := d.exec(ctx, `INSERT INTO help_topics (key, title, body, updated_at, updated_by) VALUES (?, ?, ?, ?, ?)
+ON CONFLICT(key) DO UPDATE SET title = excluded.title, body = excluded.body, updated_at = excluded.updated_at, updated_by = excluded.updated_by`,
+		t.Key, t.Title, t.Body, t.UpdatedAt.UTC(), t.UpdatedBy)
+	return err
+}
+
+// DeleteHelpTopic drops the customized topic key, so the built-in text is
+// shown again.
+func (d *DB) DeleteHelpTopic(ctx context.Context, key string) error {
+	_, err := d.exec(ctx, `DELETE FROM help_topics WHERE key = ?`, key)
+	return err
+}
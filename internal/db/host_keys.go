@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// HostKey is the SSH host key a robot presented the first time the
+// controller logged in to it, in authorized_keys format. Later logins
+// require the same key.
+type HostKey struct {
+	RobotID   int64     `json:"robot_id"`
+	Key       string    `json:"key"`
+	FirstSeen time.Time `json:"first_seen"`
+}
+
+// GetRobotHostKey returns the host key recorded for a robot, or
+// sql.ErrNoRows.
+func (d *DB) GetRobotHostKey(ctx context.Context, robotID int64) (HostKey, error) {
+	k := HostKey{RobotID: robotID}
+	err := d.queryRow(ctx, `SELECT host_key, first_seen FROM ssh_host_keys WHERE robot_id = ?`, robotID).Scan(&k.Key, &k.FirstSeen)
+	return k, err
+}
+
+// RecordRobotHostKey records key as the robot's host key unless one is
+// recorded already, and returns the one that is.
+func (d *DB) RecordRobotHostKey(ctx context.Context, robotID int64, key string) (HostKey, error) {
+	if _, err := d.exec(ctx, `INSERT INTO ssh_host_keys (robot_id, host_key, first_seen) VALUES (?, ?, ?)
+ON CONFLICT(robot_id) DO NOTHING`, robotID, key, time.Now().UTC()); err != nil {
+		return HostKey{}, err
+	}
+	return d.GetRobotHostKey(ctx, robotID)
+}
+
+// DeleteRobotHostKey forgets a robot's host key, e.g. after it was
+// reflashed; the next login records the new one. It reports whether there
+// was one.
+func (d *DB) DeleteRobotHostKey(ctx context.Context, robotID int64) (bool, error) {
+	res, err := d.exec(ctx, `DELETE FROM ssh_host_keys WHERE robot_id = ?`, robotID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
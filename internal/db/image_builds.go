@@ -0,0 +1,241 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Image build statuses. A build is queued until there is room for it to run.
+const (
+	ImageBuildQueued      = "queued"
+	ImageBuildBuilding    = "building"
+	ImageBuildSuccess     = "success"
+	ImageBuildError       = "error"
+	ImageBuildCancelled   = "cancelled"
+	ImageBuildInterrupted = "interrupted"
+)
+
+// Results of booting a built image in QEMU (see BUILD_SMOKE_TEST).
+const (
+	ImageSmokePassed = "passed"
+	ImageSmokeFailed = "failed"
+)
+
+// ImageBuild is one golden image build, queued, running or finished.
+// ProfileName is the profile's name when the build was queued. ImageName is
+// the artifact in the images directory; it may since have been pruned.
+type ImageBuild struct {
+	ID          int64  `json:"id"`
+	ProfileID   int64  `json:"profile_id,omitempty"`
+	ProfileName string `json:"profile_name,omitempty"`
+	Status      string `json:"status"`
+	FromCache   bool   `json:"from_cache,omitempty"`
+	// RefreshOf is the build whose image this one refreshes with the
+	// current agent and user-data instead of building from scratch.
+	RefreshOf   int64      `json:"refresh_of,omitempty"`
+	RequestedBy string     `json:"requested_by,omitempty"`
+	QueuedAt    time.Time  `json:"queued_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	ImageName   string     `json:"image_name,omitempty"`
+	ImageSize   int64      `json:"image_size,omitempty"`
+	Checksum    string     `json:"checksum,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	// SmokeTest is passed or failed once the image was booted in QEMU, and
+	// SmokeError why it failed; empty if it wasn't.
+	SmokeTest  string `json:"smoke_test,omitempty"`
+	SmokeError string `json:"smoke_error,omitempty"`
+	// Log is only loaded by GetImageBuild.
+	Log string `json:"log,omitempty"`
+}
+
+const imageBuildColumns = `id, profile_id, profile_name, status, from_cache, requested_by, queued_at, started_at, finished_at, image_name, image_size, checksum, error, smoke_test, smoke_error, refresh_of`
+
+// QueueImageBuild records a build waiting to run and returns its id.
+func (d *DB) QueueImageBuild(ctx context.Context, b ImageBuild) (int64, error) {
+	now := time.Now().UTC()
+	var refreshOf interface{}
+	if b.RefreshOf != 0 {
+		refreshOf = b.RefreshOf
+	}
+	return d.insert(ctx, `INSERT INTO image_builds (started_at, queued_at, status, profile_id, profile_name, from_cache, requested_by, refresh_of) VALUES (?, ?, 'queued', ?, ?, ?, ?, ?)`,
+		now, now, b.ProfileID, b.ProfileName, boolInt(b.FromCache), b.RequestedBy, refreshOf)
+}
+
+// NextQueuedImageBuild returns the build queued longest, passing over
+// builds of the profiles in busy, or sql.ErrNoRows.
+func (d *DB) NextQueuedImageBuild(ctx context.Context, busy []int64) (ImageBuild, error) {
+	q := `SELECT ` + imageBuildColumns + ` FROM image_builds WHERE status = 'queued'`
+	var args []interface{}
+	if len(busy) > 0 {
+		q += ` AND profile_id NOT IN (?` + strings.Repeat(", ?", len(busy)-1) + `)`
+		for _, id := range busy {
+			args = append(args, id)
+		}
+	}
+	rows, err := d.query(ctx, q+` ORDER BY queued_at, id LIMIT 1`, args...)
+	if err != nil {
+		return ImageBuild{}, err
+	}
+	return firstImageBuild(rows)
+}
+
+// StartQueuedImageBuild marks a queued build as building. It returns
+// sql.ErrNoRows if the build is no longer queued, e.g. it was cancelled.
+func (d *DB) StartQueuedImageBuild(ctx context.Context, id int64) error {
+	res, err := d.exec(ctx, `UPDATE image_builds SET status = 'building', started_at = ? WHERE id = ? AND status = 'queued'`, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CancelQueuedImageBuild takes a build off the queue. It returns
+// sql.ErrNoRows if the build isn't queued.
+func (d *DB) CancelQueuedImageBuild(ctx context.Context, id int64) error {
+	res, err := d.exec(ctx, `UPDATE image_builds SET status = 'cancelled', finished_at = ?, error = 'build cancelled' WHERE id = ? AND status = 'queued'`, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// QueuedImageBuilds returns how many builds are waiting to run.
+func (d *DB) QueuedImageBuilds(ctx context.Context) (int, error) {
+	var n int
+	err := d.queryRow(ctx, `SELECT COUNT(*) FROM image_builds WHERE status = 'queued'`).Scan(&n)
+	return n, err
+}
+
+// ListImageBuilds returns recent builds, newest first, without their logs.
+// profileID, if not 0, limits them to one profile.
+func (d *DB) ListImageBuilds(ctx context.Context, profileID int64, limit int) ([]ImageBuild, error) {
+	q := `SELECT ` + imageBuildColumns + ` FROM image_builds`
+	var args []interface{}
+	if profileID != 0 {
+		q += ` WHERE profile_id = ?`
+		args = append(args, profileID)
+	}
+	q += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+	rows, err := d.query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanImageBuilds(rows)
+}
+
+// GetImageBuild returns one build with its log, or sql.ErrNoRows.
+func (d *DB) GetImageBuild(ctx context.Context, id int64) (ImageBuild, error) {
+	rows, err := d.query(ctx, `SELECT `+imageBuildColumns+` FROM image_builds WHERE id = ?`, id)
+	if err != nil {
+		return ImageBuild{}, err
+	}
+	b, err := firstImageBuild(rows)
+	if err != nil {
+		return b, err
+	}
+	var log sql.NullString
+	if err := d.queryRow(ctx, `SELECT log FROM image_builds WHERE id = ?`, id).Scan(&log); err != nil {
+		return b, err
+	}
+	b.Log = log.String
+	return b, nil
+}
+
+// ProfileArtifacts returns the images a profile's successful builds wrote,
+// newest first.
+func (d *DB) ProfileArtifacts(ctx context.Context, profileID int64) ([]string, error) {
+	rows, err := d.query(ctx, `SELECT image_name FROM image_builds
+WHERE profile_id = ? AND status = 'success' AND image_name IS NOT NULL AND image_name != ''
+ORDER BY id DESC`, profileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var images []string
+	for rows.Next() {
+		var image string
+		if err := rows.Scan(&image); err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
+// ImageArtifacts returns the images every successful build wrote, of any
+// profile, deleted ones included.
+func (d *DB) ImageArtifacts(ctx context.Context) ([]string, error) {
+	rows, err := d.query(ctx, `SELECT image_name FROM image_builds
+WHERE status = 'success' AND image_name IS NOT NULL AND image_name != ''`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var images []string
+	for rows.Next() {
+		var image string
+		if err := rows.Scan(&image); err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
+func firstImageBuild(rows *sql.Rows) (ImageBuild, error) {
+	builds, err := scanImageBuilds(rows)
+	if err != nil {
+		return ImageBuild{}, err
+	}
+	if len(builds) == 0 {
+		return ImageBuild{}, sql.ErrNoRows
+	}
+	return builds[0], nil
+}
+
+func scanImageBuilds(rows *sql.Rows) ([]ImageBuild, error) {
+	defer rows.Close()
+	builds := []ImageBuild{}
+	for rows.Next() {
+		var b ImageBuild
+		var profileID, size, refreshOf sql.NullInt64
+		var profileName, requestedBy, image, checksum, errMsg, smoke, smokeErr sql.NullString
+		var fromCache int
+		var started time.Time
+		var finished sql.NullTime
+		if err := rows.Scan(&b.ID, &profileID, &profileName, &b.Status, &fromCache, &requestedBy, &b.QueuedAt, &started, &finished, &image, &size, &checksum, &errMsg, &smoke, &smokeErr, &refreshOf); err != nil {
+			return nil, err
+		}
+		b.ProfileID = profileID.Int64
+		b.ProfileName = profileName.String
+		b.FromCache = fromCache != 0
+		b.RefreshOf = refreshOf.Int64
+		b.RequestedBy = requestedBy.String
+		// started_at holds the queue time until a build starts, and keeps
+		// it for one cancelled while queued.
+		if b.Status != ImageBuildQueued && !(b.Status == ImageBuildCancelled && started.Equal(b.QueuedAt)) {
+			b.StartedAt = &started
+		}
+		if finished.Valid {
+			b.FinishedAt = &finished.Time
+		}
+		b.ImageName = image.String
+		b.ImageSize = size.Int64
+		b.Checksum = checksum.String
+		b.Error = errMsg.String
+		b.SmokeTest = smoke.String
+		b.SmokeError = smokeErr.String
+		builds = append(builds, b)
+	}
+	return builds, rows.Err()
+}
@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ImageProfile is a named golden image configuration, such as TB3-Humble or
+// a lab's laptops, built and downloaded independently of the others.
+type ImageProfile struct {
+	ID          int64
+	Name        string
+	Description string
+	Config      GoldenImageConfig
+	CreatedBy   string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+const imageProfileColumns = `id, name, description, config, created_by, created_at, updated_at`
+
+// ListImageProfiles returns every profile by name.
+func (d *DB) ListImageProfiles(ctx context.Context) ([]ImageProfile, error) {
+	rows, err := d.query(ctx, `SELECT `+imageProfileColumns+` FROM image_profiles ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	return d.scanImageProfiles(rows)
+}
+
+// GetImageProfile returns one profile, or sql.ErrNoRows.
+func (d *DB) GetImageProfile(ctx context.Context, id int64) (ImageProfile, error) {
+	rows, err := d.query(ctx, `SELECT `+imageProfileColumns+` FROM image_profiles WHERE id = ?`, id)
+	if err != nil {
+		return ImageProfile{}, err
+	}
+	return d.firstImageProfile(rows)
+}
+
+// GetImageProfileByName returns the profile called name, or sql.ErrNoRows.
+func (d *DB) GetImageProfileByName(ctx context.Context, name string) (ImageProfile, error) {
+	rows, err := d.query(ctx, `SELECT `+imageProfileColumns+` FROM image_profiles WHERE name = ?`, name)
+	if err != nil {
+		return ImageProfile{}, err
+	}
+	return d.firstImageProfile(rows)
+}
+
+// CreateImageProfile stores a new profile and returns its id.
+func (d *DB) CreateImageProfile(ctx context.Context, p ImageProfile) (int64, error) {
+	cfg, err := d.sealGoldenImageConfig(p.Config)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	return d.insert(ctx, `INSERT INTO image_profiles (name, description, config, created_by, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		p.Name, p.Description, cfg, p.CreatedBy, now, now)
+}
+
+// UpdateImageProfile saves the editable fields of p.
+func (d *DB) UpdateImageProfile(ctx context.Context, p ImageProfile) error {
+	cfg, err := d.sealGoldenImageConfig(p.Config)
+	if err != nil {
+		return err
+	}
+	res, err := d.exec(ctx, `UPDATE image_profiles SET name = ?, description = ?, config = ?, updated_at = ? WHERE id = ?`,
+		p.Name, p.Description, cfg, time.Now().UTC(), p.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteImageProfile removes a profile. Its builds stay in the build
+// history.
+func (d *DB) DeleteImageProfile(ctx context.Context, id int64) error {
+	res, err := d.exec(ctx, `DELETE FROM image_profiles WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (d *DB) firstImageProfile(rows *sql.Rows) (ImageProfile, error) {
+	profiles, err := d.scanImageProfiles(rows)
+	if err != nil {
+		return ImageProfile{}, err
+	}
+	if len(profiles) == 0 {
+		return ImageProfile{}, sql.ErrNoRows
+	}
+	return profiles[0], nil
+}
+
+func (d *DB) scanImageProfiles(rows *sql.Rows) ([]ImageProfile, error) {
+	defer rows.Close()
+	profiles := []ImageProfile{}
+	for rows.Next() {
+		var p ImageProfile
+		var description, createdBy sql.NullString
+		var cfg string
+		if err := rows.Scan(&p.ID, &p.Name, &description, &cfg, &createdBy, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		p.Description = description.String
+		p.CreatedBy = createdBy.String
+		if err := d.openGoldenImageConfig(cfg, &p.Config); err != nil {
+			return nil, fmt.Errorf("image profile %s: %w", p.Name, err)
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, rows.Err()
+}
+
+// sealGoldenImageConfig encodes cfg with its passwords sealed.
+func (d *DB) sealGoldenImageConfig(cfg GoldenImageConfig) (string, error) {
+	var err error
+	if cfg.WifiPassword, err = d.sealSecret(cfg.WifiPassword); err != nil {
+		return "", err
+	}
+	if cfg.UbuntuPassword, err = d.sealSecret(cfg.UbuntuPassword); err != nil {
+		return "", err
+	}
+	// Sealed in a copy, as the slice is shared with the caller.
+	cfg.WifiNetworks = append([]WifiNetwork(nil), cfg.WifiNetworks...)
+	for i := range cfg.WifiNetworks {
+		if cfg.WifiNetworks[i].Password, err = d.sealSecret(cfg.WifiNetworks[i].Password); err != nil {
+			return "", err
+		}
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// openGoldenImageConfig decodes raw into cfg and opens its passwords.
+func (d *DB) openGoldenImageConfig(raw string, cfg *GoldenImageConfig) error {
+	if raw == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(raw), cfg); err != nil {
+		return err
+	}
+	var err error
+	if cfg.WifiPassword, err = d.openSecret(cfg.WifiPassword); err != nil {
+		return fmt.Errorf("wifi password: %w", err)
+	}
+	if cfg.UbuntuPassword, err = d.openSecret(cfg.UbuntuPassword); err != nil {
+		return fmt.Errorf("ubuntu password: %w", err)
+	}
+	for i := range cfg.WifiNetworks {
+		if cfg.WifiNetworks[i].Password, err = d.openSecret(cfg.WifiNetworks[i].Password); err != nil {
+			return fmt.Errorf("wifi password for %s: %w", cfg.WifiNetworks[i].SSID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,827 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// migration is one numbered schema change. Up and Down are run in a single
+// transaction each, so a failed step leaves the schema at the previous
+// version. Statements use SQLite syntax and go through the dialect like every
+// other query.
+//
+// Append new migrations to the end of the list and never edit one that has
+// shipped; add a new step that alters it instead. Data backfills are plain
+// UPDATE statements in Up.
+type migration struct {
+	Version int
+	Name    string
+	Up      []string
+	Down    []string
+}
+
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS robots (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL UNIQUE,
+				agent_id TEXT,
+				ip TEXT,
+				last_seen TIMESTAMP,
+				status TEXT,
+				notes TEXT,
+				last_scenario_id INTEGER,
+				ssh_address TEXT,
+				ssh_user TEXT,
+				ssh_key TEXT,
+				tags TEXT,
+				type TEXT DEFAULT 'robot',
+				boot_time TIMESTAMP,
+				boot_duration_sec INTEGER
+			)`,
+			`CREATE TABLE IF NOT EXISTS scenarios (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL UNIQUE,
+				description TEXT,
+				config_yaml TEXT
+			)`,
+			`CREATE TABLE IF NOT EXISTS jobs (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				type TEXT NOT NULL,
+				target_robot TEXT,
+				payload_json TEXT,
+				status TEXT,
+				issued_by TEXT,
+				on_behalf_of TEXT,
+				created_at TIMESTAMP,
+				updated_at TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS settings (
+				key TEXT PRIMARY KEY,
+				value TEXT
+			)`,
+			`CREATE TABLE IF NOT EXISTS login_events (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				timestamp TIMESTAMP,
+				ip TEXT,
+				user_agent TEXT
+			)`,
+			`CREATE TABLE IF NOT EXISTS speed_tests (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				robot_id INTEGER NOT NULL,
+				size_bytes INTEGER,
+				download_mbps REAL,
+				upload_mbps REAL,
+				created_at TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS audit_events (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				timestamp TIMESTAMP,
+				actor TEXT,
+				on_behalf_of TEXT,
+				action TEXT,
+				target TEXT,
+				detail TEXT
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE audit_events`,
+			`DROP TABLE speed_tests`,
+			`DROP TABLE login_events`,
+			`DROP TABLE settings`,
+			`DROP TABLE jobs`,
+			`DROP TABLE scenarios`,
+			`DROP TABLE robots`,
+		},
+	},
+	{
+		Version: 2,
+		Name:    "job priority",
+		Up:      []string{`ALTER TABLE jobs ADD COLUMN priority TEXT`},
+		Down:    []string{`ALTER TABLE jobs DROP COLUMN priority`},
+	},
+	{
+		Version: 3,
+		Name:    "telemetry",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS telemetry (
+				robot_id INTEGER NOT NULL,
+				metric TEXT NOT NULL,
+				resolution INTEGER NOT NULL,
+				ts TIMESTAMP NOT NULL,
+				value REAL,
+				min_value REAL,
+				max_value REAL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_telemetry_series ON telemetry (robot_id, metric, resolution, ts)`,
+		},
+		Down: []string{
+			`DROP INDEX idx_telemetry_series`,
+			`DROP TABLE telemetry`,
+		},
+	},
+	{
+		Version: 4,
+		Name:    "robot agent version",
+		Up:      []string{`ALTER TABLE robots ADD COLUMN agent_version TEXT`},
+		Down:    []string{`ALTER TABLE robots DROP COLUMN agent_version`},
+	},
+	{
+		Version: 5,
+		Name:    "archived robots",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS archived_robots (
+				id INTEGER PRIMARY KEY,
+				name TEXT NOT NULL,
+				agent_id TEXT,
+				type TEXT,
+				deleted_at TIMESTAMP
+			)`,
+			// Clear references left behind by robots and scenarios deleted
+			// before deletion cascaded.
+			`DELETE FROM speed_tests WHERE robot_id NOT IN (SELECT id FROM robots)`,
+			`DELETE FROM telemetry WHERE robot_id NOT IN (SELECT id FROM robots)`,
+			`UPDATE robots SET last_scenario_id = NULL WHERE last_scenario_id NOT IN (SELECT id FROM scenarios)`,
+		},
+		Down: []string{`DROP TABLE archived_robots`},
+	},
+	{
+		Version: 6,
+		Name:    "reporting indexes",
+		Up: []string{
+			`CREATE INDEX IF NOT EXISTS idx_jobs_target_created ON jobs (target_robot, created_at)`,
+			// Covers the report window counts, which group by robot and
+			// count by status.
+			`CREATE INDEX IF NOT EXISTS idx_jobs_created ON jobs (created_at, target_robot, status)`,
+			`CREATE INDEX IF NOT EXISTS idx_robots_agent_id ON robots (agent_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_login_events_timestamp ON login_events (timestamp)`,
+		},
+		Down: []string{
+			`DROP INDEX idx_login_events_timestamp`,
+			`DROP INDEX idx_robots_agent_id`,
+			`DROP INDEX idx_jobs_created`,
+			`DROP INDEX idx_jobs_target_created`,
+		},
+	},
+	{
+		Version: 7,
+		Name:    "robot payload keys",
+		Up: []string{
+			`ALTER TABLE robots ADD COLUMN payload_key TEXT`,
+		},
+		Down: []string{
+			`ALTER TABLE robots DROP COLUMN payload_key`,
+		},
+	},
+	{
+		Version: 8,
+		Name:    "soft-deleted robots",
+		Up: []string{
+			`ALTER TABLE robots ADD COLUMN archived_at TIMESTAMP`,
+			// Robots archived by version 5 come back as archived rows. Their
+			// jobs target 'archived:<id>', which becomes their agent ID; a
+			// name taken since gets the ID appended.
+			`INSERT INTO robots (id, name, agent_id, ip, status, type, archived_at)
+			SELECT a.id,
+				CASE WHEN a.name IN (SELECT name FROM robots) THEN a.name || ' (archived ' || a.id || ')' ELSE a.name END,
+				'archived:' || a.id, '', 'offline', COALESCE(a.type, 'robot'), a.deleted_at
+			FROM archived_robots a`,
+			`DROP TABLE archived_robots`,
+		},
+		Down: []string{
+			`CREATE TABLE archived_robots (
+				id INTEGER PRIMARY KEY,
+				name TEXT NOT NULL,
+				agent_id TEXT,
+				type TEXT,
+				deleted_at TIMESTAMP
+			)`,
+			`INSERT INTO archived_robots (id, name, agent_id, type, deleted_at)
+			SELECT id, name, agent_id, type, archived_at FROM robots WHERE archived_at IS NOT NULL`,
+			`UPDATE jobs SET target_robot = 'archived:' || (SELECT r.id FROM robots r WHERE r.agent_id = jobs.target_robot AND r.archived_at IS NOT NULL)
+			WHERE target_robot IN (SELECT agent_id FROM robots WHERE archived_at IS NOT NULL AND agent_id NOT LIKE 'archived:%')`,
+			`DELETE FROM robots WHERE archived_at IS NOT NULL`,
+			`ALTER TABLE robots DROP COLUMN archived_at`,
+		},
+	},
+	{
+		Version: 9,
+		Name:    "robot ROS container",
+		Up:      []string{`ALTER TABLE robots ADD COLUMN ros_container TEXT`},
+		Down:    []string{`ALTER TABLE robots DROP COLUMN ros_container`},
+	},
+	{
+		Version: 10,
+		Name:    "robot facts",
+		Up:      []string{`ALTER TABLE robots ADD COLUMN facts TEXT`},
+		Down:    []string{`ALTER TABLE robots DROP COLUMN facts`},
+	},
+	{
+		Version: 11,
+		Name:    "robot workspace and drift",
+		Up: []string{
+			`ALTER TABLE robots ADD COLUMN workspace TEXT`,
+			`ALTER TABLE robots ADD COLUMN drift TEXT`,
+		},
+		Down: []string{
+			`ALTER TABLE robots DROP COLUMN drift`,
+			`ALTER TABLE robots DROP COLUMN workspace`,
+		},
+	},
+	{
+		Version: 12,
+		Name:    "scenario apply history",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS scenario_applies (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				scenario_id INTEGER NOT NULL,
+				robot_id INTEGER NOT NULL,
+				robot_name TEXT NOT NULL,
+				job_id INTEGER,
+				applied_by TEXT,
+				applied_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_scenario_applies_scenario ON scenario_applies (scenario_id, applied_at)`,
+		},
+		Down: []string{
+			`DROP INDEX idx_scenario_applies_scenario`,
+			`DROP TABLE scenario_applies`,
+		},
+	},
+	{
+		Version: 13,
+		Name:    "job steps",
+		Up: []string{
+			`ALTER TABLE jobs ADD COLUMN steps TEXT`,
+		},
+		Down: []string{
+			`ALTER TABLE jobs DROP COLUMN steps`,
+		},
+	},
+	{
+		Version: 14,
+		Name:    "robot docker deployment",
+		Up:      []string{`ALTER TABLE robots ADD COLUMN docker TEXT`},
+		Down:    []string{`ALTER TABLE robots DROP COLUMN docker`},
+	},
+	{
+		Version: 15,
+		Name:    "git deploys",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS git_deploys (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				scenario_id INTEGER NOT NULL,
+				scenario_name TEXT NOT NULL,
+				repo TEXT NOT NULL,
+				branch TEXT NOT NULL,
+				commit_sha TEXT,
+				pusher TEXT,
+				robot_ids TEXT,
+				job_ids TEXT,
+				status TEXT NOT NULL,
+				error TEXT,
+				decided_by TEXT,
+				created_at TIMESTAMP NOT NULL,
+				decided_at TIMESTAMP
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_git_deploys_status ON git_deploys (status, created_at)`,
+		},
+		Down: []string{
+			`DROP INDEX idx_git_deploys_status`,
+			`DROP TABLE git_deploys`,
+		},
+	},
+	{
+		Version: 16,
+		Name:    "robot suspends",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS robot_suspends (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				robot_id INTEGER NOT NULL,
+				suspended_at TIMESTAMP NOT NULL,
+				resumed_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_robot_suspends_resumed ON robot_suspends (resumed_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_robot_suspends_robot ON robot_suspends (robot_id, suspended_at)`,
+		},
+		Down: []string{
+			`DROP INDEX idx_robot_suspends_robot`,
+			`DROP INDEX idx_robot_suspends_resumed`,
+			`DROP TABLE robot_suspends`,
+		},
+	},
+	{
+		Version: 17,
+		Name:    "scenario repo credentials",
+		Up:      []string{`ALTER TABLE scenarios ADD COLUMN repo_auth TEXT`},
+		Down:    []string{`ALTER TABLE scenarios DROP COLUMN repo_auth`},
+	},
+	{
+		Version: 18,
+		Name:    "job progress",
+		Up:      []string{`ALTER TABLE jobs ADD COLUMN progress TEXT`},
+		Down:    []string{`ALTER TABLE jobs DROP COLUMN progress`},
+	},
+	{
+		Version: 19,
+		Name:    "robot launches",
+		Up:      []string{`ALTER TABLE robots ADD COLUMN launches TEXT`},
+		Down:    []string{`ALTER TABLE robots DROP COLUMN launches`},
+	},
+	{
+		Version: 20,
+		Name:    "robot estop",
+		Up:      []string{`ALTER TABLE robots ADD COLUMN estop TEXT`},
+		Down:    []string{`ALTER TABLE robots DROP COLUMN estop`},
+	},
+	{
+		Version: 21,
+		Name:    "help topics",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS help_topics (
+				key TEXT PRIMARY KEY,
+				title TEXT NOT NULL,
+				body TEXT NOT NULL,
+				updated_at TIMESTAMP NOT NULL,
+				updated_by TEXT
+			)`,
+		},
+		Down: []string{`DROP TABLE IF EXISTS help_topics`},
+	},
+	{
+		Version: 22,
+		Name:    "snapshot schedules",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS snapshot_schedules (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL,
+				robots TEXT NOT NULL,
+				at TEXT NOT NULL,
+				days TEXT,
+				enabled INTEGER NOT NULL DEFAULT 1,
+				base_url TEXT NOT NULL,
+				created_by TEXT,
+				created_at TIMESTAMP NOT NULL,
+				last_run_at TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS snapshots (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				robot_id INTEGER NOT NULL,
+				schedule_id INTEGER,
+				job_id INTEGER,
+				token TEXT NOT NULL,
+				status TEXT NOT NULL,
+				error TEXT,
+				created_at TIMESTAMP NOT NULL,
+				completed_at TIMESTAMP
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_snapshots_robot ON snapshots (robot_id, created_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_snapshots_status ON snapshots (status)`,
+		},
+		Down: []string{
+			`DROP INDEX idx_snapshots_status`,
+			`DROP INDEX idx_snapshots_robot`,
+			`DROP TABLE snapshots`,
+			`DROP TABLE snapshot_schedules`,
+		},
+	},
+	{
+		Version: 23,
+		Name:    "robot onboarding",
+		// Robots already in the fleet count as onboarded, so defaults only
+		// reach robots enrolled from now on.
+		Up: []string{
+			`ALTER TABLE robots ADD COLUMN onboarded_at TIMESTAMP`,
+			`UPDATE robots SET onboarded_at = CURRENT_TIMESTAMP`,
+		},
+		Down: []string{`ALTER TABLE robots DROP COLUMN onboarded_at`},
+	},
+	{
+		Version: 24,
+		Name:    "missions",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS missions (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL UNIQUE,
+				description TEXT,
+				frame TEXT,
+				waypoints TEXT NOT NULL,
+				created_by TEXT,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL
+			)`,
+		},
+		Down: []string{`DROP TABLE IF EXISTS missions`},
+	},
+	{
+		Version: 25,
+		Name:    "robot power",
+		Up: []string{
+			`ALTER TABLE robots ADD COLUMN battery REAL`,
+			`ALTER TABLE robots ADD COLUMN dock TEXT`,
+		},
+		Down: []string{
+			`ALTER TABLE robots DROP COLUMN dock`,
+			`ALTER TABLE robots DROP COLUMN battery`,
+		},
+	},
+	{
+		Version: 26,
+		Name:    "image builds",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS image_builds (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				started_at TIMESTAMP NOT NULL,
+				finished_at TIMESTAMP,
+				status TEXT NOT NULL,
+				image_name TEXT,
+				error TEXT
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_image_builds_started ON image_builds (started_at)`,
+		},
+		Down: []string{`DROP TABLE IF EXISTS image_builds`},
+	},
+	{
+		Version: 27,
+		Name:    "bags",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS bags (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				robot_id INTEGER NOT NULL,
+				experiment TEXT,
+				topics TEXT,
+				duration_sec INTEGER NOT NULL,
+				job_id INTEGER,
+				token TEXT NOT NULL,
+				status TEXT NOT NULL,
+				error TEXT,
+				size_bytes INTEGER,
+				created_by TEXT,
+				created_at TIMESTAMP NOT NULL,
+				completed_at TIMESTAMP
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_bags_robot ON bags (robot_id, created_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_bags_experiment ON bags (experiment, created_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_bags_status ON bags (status)`,
+		},
+		Down: []string{`DROP TABLE IF EXISTS bags`},
+	},
+	{
+		Version: 28,
+		Name:    "enrollment_pool",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS enrollment_pool (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL UNIQUE,
+				mac TEXT,
+				serial TEXT,
+				type TEXT NOT NULL,
+				tags TEXT,
+				notes TEXT,
+				robot_id INTEGER,
+				enrolled_at TIMESTAMP,
+				created_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_enrollment_pool_mac ON enrollment_pool (mac)`,
+			`CREATE INDEX IF NOT EXISTS idx_enrollment_pool_serial ON enrollment_pool (serial)`,
+		},
+		Down: []string{`DROP TABLE IF EXISTS enrollment_pool`},
+	},
+	{
+		Version: 29,
+		Name:    "robot position",
+		Up:      []string{`ALTER TABLE robots ADD COLUMN position TEXT`},
+		Down:    []string{`ALTER TABLE robots DROP COLUMN position`},
+	},
+	{
+		Version: 30,
+		Name:    "semester batches",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS semester_batches (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				state TEXT NOT NULL,
+				request TEXT NOT NULL,
+				base_url TEXT,
+				total INTEGER NOT NULL,
+				completed INTEGER NOT NULL,
+				robots TEXT NOT NULL,
+				errors TEXT NOT NULL,
+				done TEXT NOT NULL,
+				created_by TEXT,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL
+			)`,
+		},
+		Down: []string{`DROP TABLE IF EXISTS semester_batches`},
+	},
+	{
+		Version: 31,
+		Name:    "semester templates",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS semester_templates (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL UNIQUE,
+				description TEXT,
+				steps TEXT NOT NULL,
+				created_by TEXT,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL
+			)`,
+		},
+		Down: []string{`DROP TABLE IF EXISTS semester_templates`},
+	},
+	{
+		Version: 32,
+		Name:    "semester batch steps",
+		Up: []string{
+			`ALTER TABLE semester_batches ADD COLUMN finished_at TIMESTAMP`,
+			`CREATE TABLE IF NOT EXISTS semester_batch_steps (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				batch_id INTEGER NOT NULL,
+				robot_id INTEGER NOT NULL,
+				robot_name TEXT,
+				step_index INTEGER NOT NULL,
+				step_type TEXT NOT NULL,
+				label TEXT,
+				status TEXT NOT NULL,
+				error TEXT,
+				started_at TIMESTAMP NOT NULL,
+				finished_at TIMESTAMP
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_semester_batch_steps_batch ON semester_batch_steps (batch_id, robot_id)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS semester_batch_steps`,
+			`ALTER TABLE semester_batches DROP COLUMN finished_at`,
+		},
+	},
+	{
+		Version: 33,
+		Name:    "image profiles",
+		// The single golden image config becomes the "default" profile. Its
+		// passwords are copied sealed as they are.
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS image_profiles (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL UNIQUE,
+				description TEXT,
+				config TEXT NOT NULL,
+				created_by TEXT,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL
+			)`,
+			`INSERT INTO image_profiles (name, config, created_at, updated_at)
+				SELECT 'default', value, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP FROM settings
+				WHERE key = 'golden_image_config' AND value IS NOT NULL AND value != ''`,
+			`DELETE FROM settings WHERE key = 'golden_image_config'`,
+			`ALTER TABLE image_builds ADD COLUMN profile_id INTEGER`,
+		},
+		Down: []string{
+			`ALTER TABLE image_builds DROP COLUMN profile_id`,
+			`INSERT INTO settings (key, value)
+				SELECT 'golden_image_config', config FROM image_profiles ORDER BY id LIMIT 1`,
+			`DROP TABLE IF EXISTS image_profiles`,
+		},
+	},
+	{
+		Version: 34,
+		Name:    "image build queue",
+		// A queued build's started_at is when it was queued until it starts,
+		// so it counts towards the month it was asked for.
+		Up: []string{
+			`ALTER TABLE image_builds ADD COLUMN profile_name TEXT`,
+			`ALTER TABLE image_builds ADD COLUMN queued_at TIMESTAMP`,
+			`ALTER TABLE image_builds ADD COLUMN requested_by TEXT`,
+			`ALTER TABLE image_builds ADD COLUMN from_cache INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE image_builds ADD COLUMN image_size INTEGER`,
+			`ALTER TABLE image_builds ADD COLUMN checksum TEXT`,
+			`ALTER TABLE image_builds ADD COLUMN log TEXT`,
+			`UPDATE image_builds SET queued_at = started_at`,
+			`UPDATE image_builds SET profile_name = (SELECT name FROM image_profiles WHERE image_profiles.id = image_builds.profile_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_image_builds_status ON image_builds (status, queued_at)`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS idx_image_builds_status`,
+			`ALTER TABLE image_builds DROP COLUMN log`,
+			`ALTER TABLE image_builds DROP COLUMN checksum`,
+			`ALTER TABLE image_builds DROP COLUMN image_size`,
+			`ALTER TABLE image_builds DROP COLUMN from_cache`,
+			`ALTER TABLE image_builds DROP COLUMN requested_by`,
+			`ALTER TABLE image_builds DROP COLUMN queued_at`,
+			`ALTER TABLE image_builds DROP COLUMN profile_name`,
+		},
+	},
+	{
+		Version: 35,
+		Name:    "image build smoke test",
+		Up: []string{
+			`ALTER TABLE image_builds ADD COLUMN smoke_test TEXT`,
+			`ALTER TABLE image_builds ADD COLUMN smoke_error TEXT`,
+		},
+		Down: []string{
+			`ALTER TABLE image_builds DROP COLUMN smoke_error`,
+			`ALTER TABLE image_builds DROP COLUMN smoke_test`,
+		},
+	},
+	{
+		Version: 36,
+		Name:    "image refresh",
+		Up: []string{
+			`ALTER TABLE image_builds ADD COLUMN refresh_of INTEGER`,
+		},
+		Down: []string{
+			`ALTER TABLE image_builds DROP COLUMN refresh_of`,
+		},
+	},
+	{
+		Version: 37,
+		Name:    "pending agents",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS pending_agents (
+				agent_id TEXT PRIMARY KEY,
+				name TEXT,
+				ip TEXT,
+				type TEXT,
+				reason TEXT,
+				rejected INTEGER NOT NULL DEFAULT 0,
+				first_seen TIMESTAMP NOT NULL,
+				last_seen TIMESTAMP NOT NULL
+			)`,
+		},
+		Down: []string{`DROP TABLE IF EXISTS pending_agents`},
+	},
+	{
+		Version: 38,
+		Name:    "ssh host keys",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS ssh_host_keys (
+				robot_id INTEGER PRIMARY KEY,
+				host_key TEXT NOT NULL,
+				first_seen TIMESTAMP NOT NULL
+			)`,
+		},
+		Down: []string{`DROP TABLE IF EXISTS ssh_host_keys`},
+	},
+	{
+		Version: 39,
+		Name:    "ssh key passphrase",
+		Up:      []string{`ALTER TABLE robots ADD COLUMN ssh_key_passphrase TEXT`},
+		Down:    []string{`ALTER TABLE robots DROP COLUMN ssh_key_passphrase`},
+	},
+}
+
+// legacyColumns were added with ALTER TABLE before migrations were versioned.
+// A database created back then may lack any of them, so they are added (if
+// missing) when such a database is first brought under version control.
+var legacyColumns = []struct{ table, column string }{
+	{"robots", "last_scenario_id INTEGER"},
+	{"robots", "ssh_address TEXT"},
+	{"robots", "ssh_user TEXT"},
+	{"robots", "ssh_key TEXT"},
+	{"robots", "tags TEXT"},
+	{"robots", "type TEXT DEFAULT 'robot'"},
+	{"robots", "boot_time TIMESTAMP"},
+	{"robots", "boot_duration_sec INTEGER"},
+	{"jobs", "issued_by TEXT"},
+	{"jobs", "on_behalf_of TEXT"},
+}
+
+// LatestSchemaVersion is the version Open migrates to.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// SchemaVersion returns the version the database is at, 0 for an empty one.
+func (d *DB) SchemaVersion(ctx context.Context) (int, error) {
+	if err := d.ensureVersionTable(ctx); err != nil {
+		return 0, err
+	}
+	var v sql.NullInt64
+	if err := d.queryRow(ctx, `SELECT MAX(version) FROM schema_version`).Scan(&v); err != nil {
+		return 0, err
+	}
+	return int(v.Int64), nil
+}
+
+// MigrateTo runs up or down steps until the schema is at target.
+func (d *DB) MigrateTo(ctx context.Context, target int) error {
+	if target < 0 || target > LatestSchemaVersion() {
+		return fmt.Errorf("unknown schema version %d (latest is %d)", target, LatestSchemaVersion())
+	}
+	legacy, err := d.isLegacySchema(ctx)
+	if err != nil {
+		return err
+	}
+	current, err := d.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if legacy {
+		if err := d.adoptLegacySchema(ctx); err != nil {
+			return err
+		}
+	}
+	for _, m := range migrations {
+		if m.Version > current && m.Version <= target {
+			if err := d.runMigration(ctx, m, true); err != nil {
+				return err
+			}
+		}
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version <= current && m.Version > target {
+			if err := d.runMigration(ctx, m, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *DB) runMigration(ctx context.Context, m migration, up bool) error {
+	stmts, dir := m.Up, "up"
+	if !up {
+		stmts, dir = m.Down, "down"
+	}
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, s := range stmts {
+		if _, err := tx.ExecContext(ctx, d.dialect.ddl(s)); err != nil {
+			return fmt.Errorf("migration %d (%s) %s: %w", m.Version, m.Name, dir, err)
+		}
+	}
+	if up {
+		_, err = tx.ExecContext(ctx, d.dialect.rebind(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)`), m.Version, m.Name, time.Now().UTC())
+	} else {
+		_, err = tx.ExecContext(ctx, d.dialect.rebind(`DELETE FROM schema_version WHERE version = ?`), m.Version)
+	}
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	slog.Info("schema migrated", "version", m.Version, "name", m.Name, "direction", dir)
+	return nil
+}
+
+func (d *DB) ensureVersionTable(ctx context.Context) error {
+	_, err := d.SQL.ExecContext(ctx, d.dialect.ddl(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT,
+		applied_at TIMESTAMP
+	)`))
+	return err
+}
+
+// isLegacySchema reports whether the database has tables but predates
+// schema_version.
+func (d *DB) isLegacySchema(ctx context.Context) (bool, error) {
+	var hasVersion, hasRobots bool
+	var err error
+	if hasVersion, err = d.tableExists(ctx, "schema_version"); err != nil || hasVersion {
+		return false, err
+	}
+	hasRobots, err = d.tableExists(ctx, "robots")
+	return hasRobots, err
+}
+
+func (d *DB) tableExists(ctx context.Context, table string) (bool, error) {
+	query := `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`
+	if d.Driver == DriverPostgres {
+		query = `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?`
+	}
+	var n int
+	err := d.queryRow(ctx, query, table).Scan(&n)
+	return n > 0, err
+}
+
+// adoptLegacySchema adds any columns an old database is missing so it matches
+// migration 1. The migration itself then only creates absent tables.
+func (d *DB) adoptLegacySchema(ctx context.Context) error {
+	slog.Info("bringing existing database under schema versioning")
+	for _, c := range legacyColumns {
+		_, err := d.SQL.ExecContext(ctx, d.dialect.ddl(`ALTER TABLE `+c.table+` ADD COLUMN `+c.column))
+		if err != nil && !isDuplicateColumnError(err) {
+			return fmt.Errorf("add %s.%s: %w", c.table, strings.Fields(c.column)[0], err)
+		}
+	}
+	return nil
+}
+
+// isDuplicateColumnError matches both SQLite's "duplicate column name" and
+// Postgres' "column ... already exists".
+func isDuplicateColumnError(err error) bool {
+	return err != nil && (strings.Contains(err.Error(), "duplicate column name") || strings.Contains(err.Error(), "already exists"))
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Waypoint actions, done once the robot reaches the waypoint.
+const (
+	WaypointWait     = "wait"
+	WaypointSnapshot = "snapshot"
+)
+
+// Waypoint is one stop on a mission: a pose in the mission's frame (x and y
+// in meters, yaw in radians) and an optional action to do there.
+type Waypoint struct {
+	Name string  `json:"name,omitempty"`
+	X    float64 `json:"x"`
+	Y    float64 `json:"y"`
+	Yaw  float64 `json:"yaw"`
+	// Action is empty, wait (pause for WaitSec) or snapshot (take a camera
+	// image).
+	Action  string `json:"action,omitempty"`
+	WaitSec int    `json:"wait_sec,omitempty"`
+}
+
+// Mission is a named route: waypoints a robot drives to in order with Nav2.
+// Frame is the frame of every waypoint, map when empty.
+type Mission struct {
+	ID          int64      `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Frame       string     `json:"frame,omitempty"`
+	Waypoints   []Waypoint `json:"waypoints"`
+	CreatedBy   string     `json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+const missionColumns = `id, name, description, frame, waypoints, created_by, created_at, updated_at`
+
+// ListMissions returns every mission by name.
+func (d *DB) ListMissions(ctx context.Context) ([]Mission, error) {
+	rows, err := d.query(ctx, `SELECT `+missionColumns+` FROM missions ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	return scanMissions(rows)
+}
+
+// GetMission returns one mission, or sql.ErrNoRows.
+func (d *DB) GetMission(ctx context.Context, id int64) (Mission, error) {
+	rows, err := d.query(ctx, `SELECT `+missionColumns+` FROM missions WHERE id = ?`, id)
+	if err != nil {
+		return Mission{}, err
+	}
+	return firstMission(rows)
+}
+
+// GetMissionByName returns the mission called name, or sql.ErrNoRows.
+func (d *DB) GetMissionByName(ctx context.Context, name string) (Mission, error) {
+	rows, err := d.query(ctx, `SELECT `+missionColumns+` FROM missions WHERE name = ?`, name)
+	if err != nil {
+		return Mission{}, err
+	}
+	return firstMission(rows)
+}
+
+// CreateMission stores a new mission and returns its id.
+func (d *DB) CreateMission(ctx context.Context, m Mission) (int64, error) {
+	raw, err := json.Marshal(m.Waypoints)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	return d.insert(ctx, `INSERT INTO missions (name, description, frame, waypoints, created_by, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		m.Name, m.Description, m.Frame, string(raw), m.CreatedBy, now, now)
+}
+
+// UpdateMission saves the editable fields of m.
+func (d *DB) UpdateMission(ctx context.Context, m Mission) error {
+	raw, err := json.Marshal(m.Waypoints)
+	if err != nil {
+		return err
+	}
+	res, err := d.exec(ctx, `UPDATE missions SET name = ?, description = ?, frame = ?, waypoints = ?, updated_at = ? WHERE id = ?`,
+		m.Name, m.Description, m.Frame, string(raw), time.Now().UTC(), m.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteMission removes a mission. Jobs already sent keep running.
+func (d *DB) DeleteMission(ctx context.Context, id int64) error {
+	res, err := d.exec(ctx, `DELETE FROM missions WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func firstMission(rows *sql.Rows) (Mission, error) {
+	missions, err := scanMissions(rows)
+	if err != nil {
+		return Mission{}, err
+	}
+	if len(missions) == 0 {
+		return Mission{}, sql.ErrNoRows
+	}
+	return missions[0], nil
+}
+
+func scanMissions(rows *sql.Rows) ([]Mission, error) {
+	defer rows.Close()
+	missions := []Mission{}
+	for rows.Next() {
+		var m Mission
+		var description, frame, createdBy sql.NullString
+		var waypoints string
+		if err := rows.Scan(&m.ID, &m.Name, &description, &frame, &waypoints, &createdBy, &m.CreatedAt, &m.UpdatedAt); err != nil {
+			return nil, err
+		}
+		m.Description = description.String
+		m.Frame = frame.String
+		m.CreatedBy = createdBy.String
+		if err := json.Unmarshal([]byte(waypoints), &m.Waypoints); err != nil {
+			return nil, fmt.Errorf("mission %s: invalid waypoints: %w", m.Name, err)
+		}
+		missions = append(missions, m)
+	}
+	return missions, rows.Err()
+}
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PendingAgent is a new agent AGENT_ENROLLMENT didn't let in: one without a
+// valid enrollment token when it is verified, any when it is approval. It
+// has no robot until an operator approves it; a rejected one is ignored.
+type PendingAgent struct {
+	AgentID string `json:"agent_id"`
+	Name    string `json:"name"`
+	IP      string `json:"ip,omitempty"`
+	Type    string `json:"type,omitempty"`
+	// Reason is why it wasn't let in, e.g. its token expired.
+	Reason    string    `json:"reason"`
+	Rejected  bool      `json:"rejected"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+const pendingAgentColumns = `agent_id, name, ip, type, reason, rejected, first_seen, last_seen`
+
+// RecordPendingAgent adds the agent to the pending list, or updates what it
+// last reported, and returns it as stored. created is set the first time it
+// is seen.
+func (d *DB) RecordPendingAgent(ctx context.Context, p PendingAgent) (stored PendingAgent, created bool, err error) {
+	now := time.Now().UTC()
+	res, err := d.exec(ctx, `UPDATE pending_agents SET name = ?, ip = ?, type = ?, reason = ?, last_seen = ? WHERE agent_id = ?`,
+		p.Name, p.IP, p.Type, p.Reason, now, p.AgentID)
+	if err != nil {
+		return p, false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if _, err := d.exec(ctx, `INSERT INTO pending_agents (agent_id, name, ip, type, reason, first_seen, last_seen) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			p.AgentID, p.Name, p.IP, p.Type, p.Reason, now, now); err != nil {
+			return p, false, err
+		}
+		created = true
+	}
+	stored, err = d.GetPendingAgent(ctx, p.AgentID)
+	return stored, created, err
+}
+
+// GetPendingAgent returns one pending agent, or sql.ErrNoRows.
+func (d *DB) GetPendingAgent(ctx context.Context, agentID string) (PendingAgent, error) {
+	rows, err := d.query(ctx, `SELECT `+pendingAgentColumns+` FROM pending_agents WHERE agent_id = ?`, agentID)
+	if err != nil {
+		return PendingAgent{}, err
+	}
+	agents, err := scanPendingAgents(rows)
+	if err != nil {
+		return PendingAgent{}, err
+	}
+	if len(agents) == 0 {
+		return PendingAgent{}, sql.ErrNoRows
+	}
+	return agents[0], nil
+}
+
+// ListPendingAgents returns the pending agents, most recently seen first.
+func (d *DB) ListPendingAgents(ctx context.Context) ([]PendingAgent, error) {
+	rows, err := d.query(ctx, `SELECT `+pendingAgentColumns+` FROM pending_agents ORDER BY last_seen DESC`)
+	if err != nil {
+		return nil, err
+	}
+	return scanPendingAgents(rows)
+}
+
+// RejectPendingAgent marks a pending agent rejected. It returns
+// sql.ErrNoRows if there is no such agent.
+func (d *DB) RejectPendingAgent(ctx context.Context, agentID string) error {
+	res, err := d.exec(ctx, `UPDATE pending_agents SET rejected = 1 WHERE agent_id = ?`, agentID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeletePendingAgent takes an agent off the pending list, e.g. once it has
+// been approved.
+func (d *DB) DeletePendingAgent(ctx context.Context, agentID string) error {
+	_, err := d.exec(ctx, `DELETE FROM pending_agents WHERE agent_id = ?`, agentID)
+	return err
+}
+
+func scanPendingAgents(rows *sql.Rows) ([]PendingAgent, error) {
+	defer rows.Close()
+	agents := []PendingAgent{}
+	for rows.Next() {
+		var p PendingAgent
+		var name, ip, rType, reason sql.NullString
+		var rejected int
+		if err := rows.Scan(&p.AgentID, &name, &ip, &rType, &reason, &rejected, &p.FirstSeen, &p.LastSeen); err != nil {
+			return nil, err
+		}
+		p.Name, p.IP, p.Type, p.Reason = name.String, ip.String, rType.String, reason.String
+		p.Rejected = rejected != 0
+		agents = append(agents, p)
+	}
+	return agents, rows.Err()
+}
@@ -0,0 +1,330 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// The queries behind job history, the weekly report and the fleet summary
+// read tables that grow without bound (jobs, login_events, telemetry). Each
+// one is written to be answered from an index, and ReportPlans checks that
+// with EXPLAIN so a schema or query change that falls back to a full table
+// scan is caught before the tables are large enough for anyone to notice.
+
+const jobColumns = `SELECT id, type, target_robot, payload_json, status, priority, issued_by, on_behalf_of, created_at, updated_at, steps, progress FROM jobs`
+
+const (
+	countJobsByStatusSQL = `SELECT status, COUNT(*) FROM jobs GROUP BY status`
+	topFailingRobotsSQL  = `SELECT target_robot, SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END) AS failed, COUNT(*)
+FROM jobs WHERE created_at >= ? AND created_at < ? GROUP BY target_robot HAVING SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END) > 0
+ORDER BY failed DESC, target_robot LIMIT ?`
+	jobCountsByRobotSQL = `SELECT target_robot, SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END), COUNT(*)
+FROM jobs WHERE created_at >= ? AND created_at < ? GROUP BY target_robot`
+	countLoginsSQL = `SELECT COUNT(*) FROM login_events WHERE timestamp >= ?`
+	queuedJobsSQL  = jobColumns + ` WHERE target_robot = ? AND status = 'queued' AND created_at >= ? ORDER BY created_at, id`
+)
+
+// JobFilter narrows ListJobs. Zero fields don't filter; Limit <= 0 returns
+// every matching job.
+type JobFilter struct {
+	// Target is the job's target_robot, i.e. the robot's agent ID.
+	Target string
+	Status string
+	// Since and Until bound created_at; Until is exclusive, so the oldest
+	// created_at of one page is the Until of the next.
+	Since time.Time
+	Until time.Time
+	Limit int
+}
+
+func (f JobFilter) query() (string, []interface{}) {
+	var where []string
+	var args []interface{}
+	if f.Target != "" {
+		where, args = append(where, "target_robot = ?"), append(args, f.Target)
+	}
+	if f.Status != "" {
+		where, args = append(where, "status = ?"), append(args, f.Status)
+	}
+	if !f.Since.IsZero() {
+		where, args = append(where, "created_at >= ?"), append(args, f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		where, args = append(where, "created_at < ?"), append(args, f.Until.UTC())
+	}
+	q := jobColumns
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	q += " ORDER BY created_at DESC, id DESC"
+	if f.Limit > 0 {
+		q, args = q+" LIMIT ?", append(args, f.Limit)
+	}
+	return q, args
+}
+
+// ListJobs returns the jobs matching f, newest first.
+func (d *DB) ListJobs(ctx context.Context, f JobFilter) ([]Job, error) {
+	q, args := f.query()
+	return d.queryJobs(ctx, q, args...)
+}
+
+// GetJob returns one job, or sql.ErrNoRows.
+func (d *DB) GetJob(ctx context.Context, id int64) (Job, error) {
+	jobs, err := d.queryJobs(ctx, jobColumns+" WHERE id = ?", id)
+	if err != nil {
+		return Job{}, err
+	}
+	if len(jobs) == 0 {
+		return Job{}, sql.ErrNoRows
+	}
+	return jobs[0], nil
+}
+
+// ListQueuedJobs returns the jobs for a robot (by agent ID) that are still
+// queued and were created at or after since, oldest first.
+func (d *DB) ListQueuedJobs(ctx context.Context, target string, since time.Time) ([]Job, error) {
+	return d.queryJobs(ctx, queuedJobsSQL, target, since.UTC())
+}
+
+func (d *DB) queryJobs(ctx context.Context, q string, args ...interface{}) ([]Job, error) {
+	rows, err := d.query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jobs := []Job{}
+	for rows.Next() {
+		var j Job
+		var target sql.NullString
+		var createdAt, updatedAt sql.NullTime
+		var priority, issuedBy, onBehalfOf, steps, progress sql.NullString
+		if err := rows.Scan(&j.ID, &j.Type, &target, &j.PayloadJSON, &j.Status, &priority, &issuedBy, &onBehalfOf, &createdAt, &updatedAt, &steps, &progress); err != nil {
+			return nil, err
+		}
+		if steps.String != "" {
+			if err := json.Unmarshal([]byte(steps.String), &j.Steps); err != nil {
+				return nil, fmt.Errorf("job %d steps: %w", j.ID, err)
+			}
+		}
+		j.TargetRobot = target.String
+		j.Priority = priority.String
+		j.IssuedBy = issuedBy.String
+		j.OnBehalfOf = onBehalfOf.String
+		j.Progress = progress.String
+		if createdAt.Valid {
+			j.CreatedAt = createdAt.Time
+		}
+		if updatedAt.Valid {
+			j.UpdatedAt = updatedAt.Time
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// CountJobsByStatus returns the number of jobs in each status.
+func (d *DB) CountJobsByStatus(ctx context.Context) (map[string]int, error) {
+	rows, err := d.query(ctx, countJobsByStatusSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+// JobFailureCount is the number of failed and total jobs for one robot.
+type JobFailureCount struct {
+	TargetRobot string `json:"target_robot"`
+	Failed      int    `json:"failed"`
+	Total       int    `json:"total"`
+}
+
+// TopFailingRobots returns the robots with the most failed jobs created in
+// [since, until), most failures first.
+func (d *DB) TopFailingRobots(ctx context.Context, since, until time.Time, limit int) ([]JobFailureCount, error) {
+	rows, err := d.query(ctx, topFailingRobotsSQL, since.UTC(), until.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := []JobFailureCount{}
+	for rows.Next() {
+		var c JobFailureCount
+		if err := rows.Scan(&c.TargetRobot, &c.Failed, &c.Total); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// JobCountsByRobot returns failed and total job counts for jobs created in
+// [since, until), keyed by target robot (agent ID).
+func (d *DB) JobCountsByRobot(ctx context.Context, since, until time.Time) (map[string]JobFailureCount, error) {
+	rows, err := d.query(ctx, jobCountsByRobotSQL, since.UTC(), until.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := map[string]JobFailureCount{}
+	for rows.Next() {
+		var c JobFailureCount
+		var target sql.NullString
+		if err := rows.Scan(&target, &c.Failed, &c.Total); err != nil {
+			return nil, err
+		}
+		c.TargetRobot = target.String
+		counts[c.TargetRobot] = c
+	}
+	return counts, rows.Err()
+}
+
+// CountLogins returns the number of dashboard logins since the given time.
+func (d *DB) CountLogins(ctx context.Context, since time.Time) (int, error) {
+	var n int
+	err := d.queryRow(ctx, countLoginsSQL, since.UTC()).Scan(&n)
+	return n, err
+}
+
+// reportQuery is one query ReportPlans checks. Args are sample values; only
+// their types matter to the planner.
+type reportQuery struct {
+	name  string
+	table string
+	sql   string
+	args  []interface{}
+}
+
+func reportQueries() []reportQuery {
+	now := time.Now().UTC()
+	week := now.Add(-7 * 24 * time.Hour)
+	byRobot, byRobotArgs := JobFilter{Target: "agent", Limit: 100}.query()
+	recent, recentArgs := JobFilter{Since: week, Limit: 100}.query()
+	page, pageArgs := JobFilter{Until: week, Limit: 100}.query()
+	return []reportQuery{
+		{"job history for a robot", "jobs", byRobot, byRobotArgs},
+		{"recent job history", "jobs", recent, recentArgs},
+		{"job history page", "jobs", page, pageArgs},
+		{"top failing robots", "jobs", topFailingRobotsSQL, []interface{}{week, now, 5}},
+		{"job counts by robot", "jobs", jobCountsByRobotSQL, []interface{}{week, now}},
+		{"robot by agent ID", "robots", robotSelect + "\nWHERE r.agent_id = ?", []interface{}{"agent"}},
+		{"logins this week", "login_events", countLoginsSQL, []interface{}{week}},
+		{"queued jobs to replay", "jobs", queuedJobsSQL, []interface{}{"agent", week}},
+		{"telemetry series", "telemetry", telemetrySeriesSQL, []interface{}{1, "battery", TelemetryRaw, week}},
+		{"suspends this week", "robot_suspends", robotSuspendsSQL, []interface{}{week}},
+		{"image builds this month", "image_builds", countImageBuildsSQL, []interface{}{week}},
+	}
+}
+
+// QueryPlan is the EXPLAIN output for one reporting query. FullScan is set
+// when the plan reads the whole table rather than going through an index.
+type QueryPlan struct {
+	Name     string   `json:"name"`
+	Table    string   `json:"table"`
+	Plan     []string `json:"plan"`
+	FullScan bool     `json:"full_scan"`
+}
+
+// ReportPlans explains every reporting query. On Postgres sequential scans
+// are disabled for the EXPLAIN, since the planner rightly prefers them on
+// small tables; what matters is that an index could serve the query once the
+// table is large.
+func (d *DB) ReportPlans(ctx context.Context) ([]QueryPlan, error) {
+	var plans []QueryPlan
+	for _, q := range reportQueries() {
+		lines, err := d.explain(ctx, q.sql, q.args)
+		if err != nil {
+			return nil, fmt.Errorf("explain %s: %w", q.name, err)
+		}
+		plans = append(plans, QueryPlan{Name: q.name, Table: q.table, Plan: lines, FullScan: d.fullScan(lines, q.table)})
+	}
+	return plans, nil
+}
+
+func (d *DB) explain(ctx context.Context, query string, args []interface{}) ([]string, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	prefix := "EXPLAIN QUERY PLAN "
+	if d.Driver == DriverPostgres {
+		prefix = "EXPLAIN "
+		if _, err := tx.ExecContext(ctx, "SET LOCAL enable_seqscan = off"); err != nil {
+			return nil, err
+		}
+	}
+	rows, err := tx.QueryContext(ctx, prefix+d.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	// SQLite returns (id, parent, notused, detail), Postgres one text column;
+	// the plan line is the last column either way.
+	var lines []string
+	vals := make([]interface{}, len(cols))
+	for rows.Next() {
+		var line string
+		for i := range vals {
+			vals[i] = new(interface{})
+		}
+		vals[len(vals)-1] = &line
+		if err := rows.Scan(vals...); err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, rows.Err()
+}
+
+func (d *DB) fullScan(plan []string, table string) bool {
+	for _, line := range plan {
+		if d.Driver == DriverPostgres {
+			if strings.Contains(line, "Seq Scan on "+table) {
+				return true
+			}
+			continue
+		}
+		// SEARCH looks rows up through an index. SCAN reads every row, of
+		// the table or of a whole index (e.g. one picked to avoid sorting
+		// for GROUP BY), which is just as slow on a large table.
+		if strings.HasPrefix(line, "SCAN ") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkReportPlans logs a warning for each reporting query that would scan
+// its whole table.
+func (d *DB) checkReportPlans(ctx context.Context) {
+	plans, err := d.ReportPlans(ctx)
+	if err != nil {
+		slog.Warn("could not check reporting query plans", "err", err)
+		return
+	}
+	for _, p := range plans {
+		if p.FullScan {
+			slog.Warn("reporting query scans the whole table", "query", p.Name, "table", p.Table, "plan", strings.Join(p.Plan, "; "))
+		}
+	}
+}
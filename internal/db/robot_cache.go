@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/openrobot-fleet/internal/metrics"
+)
+
+// defaultRobotListTTL is how long a robot list is served from memory. Writes
+// to robots or scenarios (the list joins the last applied scenario) drop it
+// sooner, so it mostly saves the queries of dashboards polling together.
+const defaultRobotListTTL = 2 * time.Second
+
+var robotListCacheReads = metrics.NewCounterVec("openrobot_robot_list_cache_reads_total",
+	"Robot list reads, by whether they were served from the cache.", "result")
+
+// robotWrite matches statements that change what the robot list returns.
+var robotWrite = regexp.MustCompile(`(?is)^\s*(UPDATE|INSERT\s+INTO|DELETE\s+FROM)\s+(robots|scenarios)\b`)
+
+// robotListCache holds recent robot lists by kind (see CachedRobotList).
+type robotListCache struct {
+	ttl time.Duration
+	// gen counts writes; entries loaded under an older one are stale.
+	gen atomic.Uint64
+	// mu is held across loads, so concurrent misses share one query.
+	mu      sync.Mutex
+	entries map[string]robotListEntry
+}
+
+type robotListEntry struct {
+	robots   []Robot
+	gen      uint64
+	loadedAt time.Time
+}
+
+// robotListTTLFromEnv reads ROBOT_LIST_CACHE_MS; 0 turns the cache off.
+func robotListTTLFromEnv() time.Duration {
+	raw := os.Getenv("ROBOT_LIST_CACHE_MS")
+	if raw == "" {
+		return defaultRobotListTTL
+	}
+	ms, err := strconv.Atoi(raw)
+	if err != nil || ms < 0 {
+		slog.Warn("invalid ROBOT_LIST_CACHE_MS, using the default", "value", raw, "default", defaultRobotListTTL)
+		return defaultRobotListTTL
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+func newRobotListCache(ttl time.Duration) *robotListCache {
+	return &robotListCache{ttl: ttl, entries: map[string]robotListEntry{}}
+}
+
+// invalidate drops every cached list.
+func (c *robotListCache) invalidate() {
+	c.gen.Add(1)
+}
+
+// wrote invalidates the cache if query changed robots or scenarios.
+func (c *robotListCache) wrote(query string) {
+	if robotWrite.MatchString(query) {
+		c.invalidate()
+	}
+}
+
+func (c *robotListCache) get(kind string, load func() ([]Robot, error)) ([]Robot, error) {
+	if c.ttl <= 0 {
+		return load()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	gen := c.gen.Load()
+	if e, ok := c.entries[kind]; ok && e.gen == gen && time.Since(e.loadedAt) < c.ttl {
+		robotListCacheReads.Inc("hit")
+		return slices.Clone(e.robots), nil
+	}
+	robotListCacheReads.Inc("miss")
+	robots, err := load()
+	if err != nil {
+		return nil, err
+	}
+	c.entries[kind] = robotListEntry{robots: robots, gen: gen, loadedAt: time.Now()}
+	return slices.Clone(robots), nil
+}
+
+// CachedRobotList is ListRobots, or with archived "include" ListAllRobots and
+// "only" ListArchivedRobots, served from a cache that lives for
+// ROBOT_LIST_CACHE_MS or until robots or scenarios change. The robots share
+// their facts, workspace and other pointed-to fields with the cache, so
+// callers must not modify those in place.
+func (d *DB) CachedRobotList(ctx context.Context, archived string) ([]Robot, error) {
+	return d.robotList.get(archived, func() ([]Robot, error) {
+		switch archived {
+		case "include":
+			return d.ListAllRobots(ctx)
+		case "only":
+			return d.ListArchivedRobots(ctx)
+		}
+		return d.ListRobots(ctx)
+	})
+}
@@ -0,0 +1,381 @@
+package db
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// sealedPrefix marks a value encrypted by secretBox. Values without it are
+// plaintext left over from before a master key was configured.
+const sealedPrefix = "enc:v1:"
+
+var errNoSecretsKey = errors.New("database holds encrypted secrets but no SECRETS_KEY or SECRETS_KEY_FILE is configured")
+
+// secretBox does envelope encryption of SSH keys and passwords: each value is
+// sealed with its own random data key, and the data key is sealed with the
+// controller's master key. Only the wrapped data key is stored, so the master
+// key never touches the database or its backups.
+type secretBox struct {
+	master cipher.AEAD
+}
+
+// secretBoxFromEnv loads the 32-byte master key, base64 encoded, from
+// SECRETS_KEY or from the file named by SECRETS_KEY_FILE. It returns nil when
+// neither is set.
+func secretBoxFromEnv() (*secretBox, error) {
+	encoded := os.Getenv("SECRETS_KEY")
+	if path := os.Getenv("SECRETS_KEY_FILE"); encoded == "" && path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read SECRETS_KEY_FILE: %w", err)
+		}
+		encoded = strings.TrimSpace(string(raw))
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("secrets key must be 32 bytes, base64 encoded (openssl rand -base64 32)")
+	}
+	master, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &secretBox{master: master}, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// gcmSeal returns nonce||ciphertext.
+func gcmSeal(aead cipher.AEAD, plain []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+func gcmOpen(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed value too short")
+	}
+	n := aead.NonceSize()
+	return aead.Open(nil, sealed[:n], sealed[n:], nil)
+}
+
+func (b *secretBox) seal(plain string) (string, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	body, err := gcmSeal(aead, []byte(plain))
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := gcmSeal(b.master, dataKey)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.StdEncoding
+	return sealedPrefix + enc.EncodeToString(wrapped) + ":" + enc.EncodeToString(body), nil
+}
+
+func (b *secretBox) open(stored string) (string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(stored, sealedPrefix), ":", 2)
+	if len(parts) != 2 {
+		return "", errors.New("malformed sealed value")
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", err
+	}
+	body, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := gcmOpen(b.master, wrapped)
+	if err != nil {
+		return "", errors.New("cannot unwrap data key; wrong SECRETS_KEY?")
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plain, err := gcmOpen(aead, body)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// SecretsEncrypted reports whether SSH keys and passwords are encrypted
+// before they are stored.
+func (d *DB) SecretsEncrypted() bool {
+	return d.secrets != nil
+}
+
+// sealSecret encrypts v when a master key is configured. Empty values stay
+// empty so "no key set" remains visible in queries.
+func (d *DB) sealSecret(v string) (string, error) {
+	if d.secrets == nil || v == "" || strings.HasPrefix(v, sealedPrefix) {
+		return v, nil
+	}
+	return d.secrets.seal(v)
+}
+
+// openSecret decrypts v if it was sealed and passes plaintext through.
+func (d *DB) openSecret(v string) (string, error) {
+	if !strings.HasPrefix(v, sealedPrefix) {
+		return v, nil
+	}
+	if d.secrets == nil {
+		return "", errNoSecretsKey
+	}
+	return d.secrets.open(v)
+}
+
+// secrets lists the config's passwords, sealed or not.
+func (cfg GoldenImageConfig) secrets() []string {
+	vals := []string{cfg.WifiPassword, cfg.UbuntuPassword}
+	for _, n := range cfg.WifiNetworks {
+		vals = append(vals, n.Password)
+	}
+	return vals
+}
+
+func unsealed(vals ...string) bool {
+	for _, v := range vals {
+		if v != "" && !strings.HasPrefix(v, sealedPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// sealStoredSecrets encrypts SSH keys and passwords written before a master
+// key was configured. It runs on every start and skips values already sealed.
+// Without a key it only checks that nothing is sealed, since those rows would
+// be unreadable.
+func (d *DB) sealStoredSecrets(ctx context.Context) error {
+	if d.secrets == nil {
+		var n int
+		if err := d.queryRow(ctx, `SELECT COUNT(*) FROM robots WHERE ssh_key LIKE ? OR ssh_key_passphrase LIKE ? OR payload_key LIKE ?`, sealedPrefix+"%", sealedPrefix+"%", sealedPrefix+"%").Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			if err := d.queryRow(ctx, `SELECT COUNT(*) FROM scenarios WHERE repo_auth LIKE ?`, sealedPrefix+"%").Scan(&n); err != nil {
+				return err
+			}
+		}
+		if n == 0 {
+			err := d.queryRow(ctx, `SELECT COUNT(*) FROM settings WHERE value LIKE ?`, "%"+sealedPrefix+"%").Scan(&n)
+			if err != nil {
+				return err
+			}
+		}
+		if n == 0 {
+			err := d.queryRow(ctx, `SELECT COUNT(*) FROM image_profiles WHERE config LIKE ?`, "%"+sealedPrefix+"%").Scan(&n)
+			if err != nil {
+				return err
+			}
+		}
+		if n > 0 {
+			return errNoSecretsKey
+		}
+		return nil
+	}
+
+	// Fail now rather than on first use if the key doesn't match the data.
+	var sample string
+	err := d.queryRow(ctx, `SELECT ssh_key FROM robots WHERE ssh_key LIKE ? LIMIT 1`, sealedPrefix+"%").Scan(&sample)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if _, err := d.openSecret(sample); err != nil {
+		return fmt.Errorf("robot ssh key: %w", err)
+	}
+	if _, err := d.GetDefaultInstallConfig(ctx); err != nil {
+		return err
+	}
+	profiles, err := d.ListImageProfiles(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, column := range []string{"ssh_key", "ssh_key_passphrase", "payload_key"} {
+		if err := d.sealColumn(ctx, "robots", column); err != nil {
+			return fmt.Errorf("robot %s: %w", column, err)
+		}
+	}
+	if err := d.sealColumn(ctx, "scenarios", "repo_auth"); err != nil {
+		return fmt.Errorf("scenario repo_auth: %w", err)
+	}
+
+	// Settings are re-saved through their normal accessors, which seal on write.
+	var install InstallConfig
+	if raw, err := d.GetSetting(ctx, defaultInstallConfigKey); err != nil {
+		return err
+	} else if raw != "" && json.Unmarshal([]byte(raw), &install) == nil && unsealed(install.SSHKey, install.Password, install.KeyPassphrase) {
+		if err := d.SaveDefaultInstallConfig(ctx, install); err != nil {
+			return err
+		}
+	}
+	for _, p := range profiles {
+		if err := d.sealImageProfile(ctx, p.ID); err != nil {
+			return fmt.Errorf("image profile %s: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// sealImageProfile seals the passwords a profile stored in plaintext.
+func (d *DB) sealImageProfile(ctx context.Context, id int64) error {
+	var raw string
+	if err := d.queryRow(ctx, `SELECT config FROM image_profiles WHERE id = ?`, id).Scan(&raw); err != nil {
+		return err
+	}
+	var cfg GoldenImageConfig
+	if json.Unmarshal([]byte(raw), &cfg) != nil || !unsealed(cfg.secrets()...) {
+		return nil
+	}
+	if err := d.openGoldenImageConfig(raw, &cfg); err != nil {
+		return err
+	}
+	sealed, err := d.sealGoldenImageConfig(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = d.exec(ctx, `UPDATE image_profiles SET config = ? WHERE id = ?`, sealed, id)
+	return err
+}
+
+// sealColumn seals the plaintext values of one column of table.
+func (d *DB) sealColumn(ctx context.Context, table, column string) error {
+	rows, err := d.query(ctx, `SELECT id, `+column+` FROM `+table+` WHERE `+column+` IS NOT NULL AND `+column+` != '' AND `+column+` NOT LIKE ?`, sealedPrefix+"%")
+	if err != nil {
+		return err
+	}
+	plain := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var v string
+		if err := rows.Scan(&id, &v); err != nil {
+			rows.Close()
+			return err
+		}
+		plain[id] = v
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, v := range plain {
+		sealed, err := d.sealSecret(v)
+		if err != nil {
+			return err
+		}
+		if _, err := d.exec(ctx, `UPDATE `+table+` SET `+column+` = ? WHERE id = ?`, sealed, id); err != nil {
+			return err
+		}
+	}
+	if len(plain) > 0 {
+		slog.Info("encrypted stored secrets", "table", table, "column", column, "rows", len(plain))
+	}
+	return nil
+}
+
+// SetRobotPayloadKey stores the key the robot's agent uses to decrypt
+// sensitive commands. Like SSH keys it is sealed when a master key is set.
+func (d *DB) SetRobotPayloadKey(ctx context.Context, id int64, key string) error {
+	sealed, err := d.sealSecret(key)
+	if err != nil {
+		return err
+	}
+	_, err = d.exec(ctx, `UPDATE robots SET payload_key = ? WHERE id = ?`, sealed, id)
+	return err
+}
+
+// RobotPayloadKey returns the robot's payload key, or "" if it was installed
+// without one.
+func (d *DB) RobotPayloadKey(ctx context.Context, id int64) (string, error) {
+	var key sql.NullString
+	if err := d.queryRow(ctx, `SELECT payload_key FROM robots WHERE id = ?`, id).Scan(&key); err != nil {
+		return "", err
+	}
+	return d.openSecret(key.String)
+}
+
+// SaveSecretSetting stores a setting that is itself a secret, such as a
+// signing key, sealed like the other secrets.
+func (d *DB) SaveSecretSetting(ctx context.Context, key, value string) error {
+	sealed, err := d.sealSecret(value)
+	if err != nil {
+		return err
+	}
+	return d.SaveSetting(ctx, key, sealed)
+}
+
+// GetSecretSetting returns a setting stored with SaveSecretSetting. One
+// saved before a master key was configured is sealed now.
+func (d *DB) GetSecretSetting(ctx context.Context, key string) (string, error) {
+	v, err := d.GetSetting(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if d.secrets != nil && unsealed(v) {
+		if err := d.SaveSecretSetting(ctx, key, v); err != nil {
+			return "", err
+		}
+		slog.Info("encrypted stored secrets", "setting", key)
+		return v, nil
+	}
+	return d.openSecret(v)
+}
+
+// SetScenarioRepoAuth stores the scenario's repo credentials, JSON encoded,
+// sealed like the other secrets. An empty auth removes them.
+func (d *DB) SetScenarioRepoAuth(ctx context.Context, id int64, auth string) error {
+	sealed, err := d.sealSecret(auth)
+	if err != nil {
+		return err
+	}
+	res, err := d.exec(ctx, `UPDATE scenarios SET repo_auth = ? WHERE id = ?`, sealed, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ScenarioRepoAuth returns the scenario's repo credentials, or "" if it has
+// none.
+func (d *DB) ScenarioRepoAuth(ctx context.Context, id int64) (string, error) {
+	var auth sql.NullString
+	if err := d.queryRow(ctx, `SELECT repo_auth FROM scenarios WHERE id = ?`, id).Scan(&auth); err != nil {
+		return "", err
+	}
+	return d.openSecret(auth.String)
+}
@@ -0,0 +1,322 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Semester batch states. A batch that is paused, or was running when the
+// controller stopped, can be resumed.
+const (
+	SemesterRunning   = "running"
+	SemesterPaused    = "paused"
+	SemesterCancelled = "cancelled"
+	SemesterCompleted = "completed"
+)
+
+// SemesterBatch is a semester reset batch and how far each robot got in it.
+type SemesterBatch struct {
+	ID    int64  `json:"id"`
+	State string `json:"state"`
+	// Request is the batch request as JSON, run again for the robots left
+	// when the batch is resumed.
+	Request   string           `json:"-"`
+	BaseURL   string           `json:"-"`
+	Total     int              `json:"total"`
+	Completed int              `json:"completed"`
+	Robots    map[int64]string `json:"robots"`
+	Errors    map[int64]string `json:"errors"`
+	// Done lists the steps each robot has finished, so a resumed batch
+	// doesn't repeat them.
+	Done      map[int64][]string `json:"done"`
+	CreatedBy string             `json:"created_by,omitempty"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+	// FinishedAt is when the batch completed or was cancelled.
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+const semesterBatchColumns = `id, state, request, base_url, total, completed, robots, errors, done, created_by, created_at, updated_at, finished_at`
+
+// CreateSemesterBatch stores a new batch and returns its id.
+func (d *DB) CreateSemesterBatch(ctx context.Context, b SemesterBatch) (int64, error) {
+	robots, errs, done, err := semesterProgressJSON(b)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	return d.insert(ctx, `INSERT INTO semester_batches (state, request, base_url, total, completed, robots, errors, done, created_by, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		b.State, b.Request, b.BaseURL, b.Total, b.Completed, robots, errs, done, b.CreatedBy, now, now)
+}
+
+// UpdateSemesterBatch saves the state and progress of b.
+func (d *DB) UpdateSemesterBatch(ctx context.Context, b SemesterBatch) error {
+	robots, errs, done, err := semesterProgressJSON(b)
+	if err != nil {
+		return err
+	}
+	_, err = d.exec(ctx, `UPDATE semester_batches SET state = ?, total = ?, completed = ?, robots = ?, errors = ?, done = ?, updated_at = ?, finished_at = ? WHERE id = ?`,
+		b.State, b.Total, b.Completed, robots, errs, done, time.Now().UTC(), b.FinishedAt, b.ID)
+	return err
+}
+
+// LatestSemesterBatch returns the most recent batch, or sql.ErrNoRows.
+func (d *DB) LatestSemesterBatch(ctx context.Context) (SemesterBatch, error) {
+	rows, err := d.query(ctx, `SELECT `+semesterBatchColumns+` FROM semester_batches ORDER BY id DESC LIMIT 1`)
+	if err != nil {
+		return SemesterBatch{}, err
+	}
+	return firstSemesterBatch(rows)
+}
+
+// GetSemesterBatch returns one batch, or sql.ErrNoRows.
+func (d *DB) GetSemesterBatch(ctx context.Context, id int64) (SemesterBatch, error) {
+	rows, err := d.query(ctx, `SELECT `+semesterBatchColumns+` FROM semester_batches WHERE id = ?`, id)
+	if err != nil {
+		return SemesterBatch{}, err
+	}
+	return firstSemesterBatch(rows)
+}
+
+// ListSemesterBatches returns the latest limit batches, newest first.
+func (d *DB) ListSemesterBatches(ctx context.Context, limit int) ([]SemesterBatch, error) {
+	rows, err := d.query(ctx, `SELECT `+semesterBatchColumns+` FROM semester_batches ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanSemesterBatches(rows)
+}
+
+func firstSemesterBatch(rows *sql.Rows) (SemesterBatch, error) {
+	batches, err := scanSemesterBatches(rows)
+	if err != nil {
+		return SemesterBatch{}, err
+	}
+	if len(batches) == 0 {
+		return SemesterBatch{}, sql.ErrNoRows
+	}
+	return batches[0], nil
+}
+
+func scanSemesterBatches(rows *sql.Rows) ([]SemesterBatch, error) {
+	defer rows.Close()
+	batches := []SemesterBatch{}
+	for rows.Next() {
+		var b SemesterBatch
+		var baseURL, createdBy sql.NullString
+		var robots, errs, done string
+		var finished sql.NullTime
+		if err := rows.Scan(&b.ID, &b.State, &b.Request, &baseURL, &b.Total, &b.Completed, &robots, &errs, &done, &createdBy, &b.CreatedAt, &b.UpdatedAt, &finished); err != nil {
+			return nil, err
+		}
+		b.BaseURL = baseURL.String
+		b.CreatedBy = createdBy.String
+		if finished.Valid {
+			t := finished.Time
+			b.FinishedAt = &t
+		}
+		for _, f := range []struct {
+			raw string
+			v   interface{}
+		}{{robots, &b.Robots}, {errs, &b.Errors}, {done, &b.Done}} {
+			if err := json.Unmarshal([]byte(f.raw), f.v); err != nil {
+				return nil, fmt.Errorf("semester batch %d: %w", b.ID, err)
+			}
+		}
+		batches = append(batches, b)
+	}
+	return batches, rows.Err()
+}
+
+func semesterProgressJSON(b SemesterBatch) (robots, errs, done string, err error) {
+	var raw []byte
+	if raw, err = json.Marshal(b.Robots); err != nil {
+		return
+	}
+	robots = string(raw)
+	if raw, err = json.Marshal(b.Errors); err != nil {
+		return
+	}
+	errs = string(raw)
+	if raw, err = json.Marshal(b.Done); err != nil {
+		return
+	}
+	done = string(raw)
+	return
+}
+
+// Outcomes of a semester step run; a step that was cut short by cancelling
+// the batch is cancelled.
+const (
+	SemesterStepRunning   = "running"
+	SemesterStepSucceeded = "success"
+	SemesterStepFailed    = "error"
+	SemesterStepCancelled = "cancelled"
+)
+
+// SemesterStepRun is one step of a batch run on one robot, kept so past
+// batches can be reviewed and compared.
+type SemesterStepRun struct {
+	ID      int64 `json:"id"`
+	BatchID int64 `json:"batch_id"`
+	RobotID int64 `json:"robot_id"`
+	// RobotName is the robot's name at the time, kept in case the robot is
+	// deleted.
+	RobotName  string     `json:"robot_name"`
+	Index      int        `json:"index"`
+	Type       string     `json:"type"`
+	Label      string     `json:"label"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+const semesterStepColumns = `id, batch_id, robot_id, robot_name, step_index, step_type, label, status, error, started_at, finished_at`
+
+// StartSemesterStep records that a robot started a step and returns the
+// record's id.
+func (d *DB) StartSemesterStep(ctx context.Context, s SemesterStepRun) (int64, error) {
+	return d.insert(ctx, `INSERT INTO semester_batch_steps (batch_id, robot_id, robot_name, step_index, step_type, label, status, started_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.BatchID, s.RobotID, s.RobotName, s.Index, s.Type, s.Label, SemesterStepRunning, time.Now().UTC())
+}
+
+// FinishSemesterStep records how a step ended.
+func (d *DB) FinishSemesterStep(ctx context.Context, id int64, status, errMsg string) error {
+	_, err := d.exec(ctx, `UPDATE semester_batch_steps SET status = ?, error = ?, finished_at = ? WHERE id = ?`,
+		status, errMsg, time.Now().UTC(), id)
+	return err
+}
+
+// ListSemesterSteps returns the steps run in a batch, by robot and then in
+// the order they started.
+func (d *DB) ListSemesterSteps(ctx context.Context, batchID int64) ([]SemesterStepRun, error) {
+	rows, err := d.query(ctx, `SELECT `+semesterStepColumns+` FROM semester_batch_steps WHERE batch_id = ? ORDER BY robot_id, id`, batchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	steps := []SemesterStepRun{}
+	for rows.Next() {
+		var s SemesterStepRun
+		var robotName, label, errMsg sql.NullString
+		var finished sql.NullTime
+		if err := rows.Scan(&s.ID, &s.BatchID, &s.RobotID, &robotName, &s.Index, &s.Type, &label, &s.Status, &errMsg, &s.StartedAt, &finished); err != nil {
+			return nil, err
+		}
+		s.RobotName = robotName.String
+		s.Label = label.String
+		s.Error = errMsg.String
+		if finished.Valid {
+			t := finished.Time
+			s.FinishedAt = &t
+		}
+		steps = append(steps, s)
+	}
+	return steps, rows.Err()
+}
+
+// SemesterTemplate is a saved, ordered list of semester batch steps. Steps
+// is JSON; the controller defines and checks the step format.
+type SemesterTemplate struct {
+	ID          int64
+	Name        string
+	Description string
+	Steps       string
+	CreatedBy   string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+const semesterTemplateColumns = `id, name, description, steps, created_by, created_at, updated_at`
+
+// ListSemesterTemplates returns every template by name.
+func (d *DB) ListSemesterTemplates(ctx context.Context) ([]SemesterTemplate, error) {
+	rows, err := d.query(ctx, `SELECT `+semesterTemplateColumns+` FROM semester_templates ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	return scanSemesterTemplates(rows)
+}
+
+// GetSemesterTemplate returns one template, or sql.ErrNoRows.
+func (d *DB) GetSemesterTemplate(ctx context.Context, id int64) (SemesterTemplate, error) {
+	rows, err := d.query(ctx, `SELECT `+semesterTemplateColumns+` FROM semester_templates WHERE id = ?`, id)
+	if err != nil {
+		return SemesterTemplate{}, err
+	}
+	return firstSemesterTemplate(rows)
+}
+
+// GetSemesterTemplateByName returns the template called name, or
+// sql.ErrNoRows.
+func (d *DB) GetSemesterTemplateByName(ctx context.Context, name string) (SemesterTemplate, error) {
+	rows, err := d.query(ctx, `SELECT `+semesterTemplateColumns+` FROM semester_templates WHERE name = ?`, name)
+	if err != nil {
+		return SemesterTemplate{}, err
+	}
+	return firstSemesterTemplate(rows)
+}
+
+// CreateSemesterTemplate stores a new template and returns its id.
+func (d *DB) CreateSemesterTemplate(ctx context.Context, t SemesterTemplate) (int64, error) {
+	now := time.Now().UTC()
+	return d.insert(ctx, `INSERT INTO semester_templates (name, description, steps, created_by, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		t.Name, t.Description, t.Steps, t.CreatedBy, now, now)
+}
+
+// UpdateSemesterTemplate saves the editable fields of t.
+func (d *DB) UpdateSemesterTemplate(ctx context.Context, t SemesterTemplate) error {
+	res, err := d.exec(ctx, `UPDATE semester_templates SET name = ?, description = ?, steps = ?, updated_at = ? WHERE id = ?`,
+		t.Name, t.Description, t.Steps, time.Now().UTC(), t.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteSemesterTemplate removes a template. Batches started from it keep
+// their own copy of the steps.
+func (d *DB) DeleteSemesterTemplate(ctx context.Context, id int64) error {
+	res, err := d.exec(ctx, `DELETE FROM semester_templates WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func firstSemesterTemplate(rows *sql.Rows) (SemesterTemplate, error) {
+	templates, err := scanSemesterTemplates(rows)
+	if err != nil {
+		return SemesterTemplate{}, err
+	}
+	if len(templates) == 0 {
+		return SemesterTemplate{}, sql.ErrNoRows
+	}
+	return templates[0], nil
+}
+
+func scanSemesterTemplates(rows *sql.Rows) ([]SemesterTemplate, error) {
+	defer rows.Close()
+	templates := []SemesterTemplate{}
+	for rows.Next() {
+		var t SemesterTemplate
+		var description, createdBy sql.NullString
+		if err := rows.Scan(&t.ID, &t.Name, &description, &t.Steps, &createdBy, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		t.Description = description.String
+		t.CreatedBy = createdBy.String
+		templates = append(templates, t)
+	}
+	return templates, rows.Err()
+}
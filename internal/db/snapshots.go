@@ -0,0 +1,293 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Snapshot statuses. A snapshot is pending from when capture_image is queued
+// until the robot uploads the image (stored) or the capture fails.
+const (
+	SnapshotPending = "pending"
+	SnapshotStored  = "stored"
+	SnapshotFailed  = "failed"
+)
+
+// SnapshotSchedule takes a camera snapshot on the robots a selector picks,
+// every day (or only on Days) at At, controller local time. BaseURL is how
+// robots reach the controller to upload, taken from the request that saved
+// the schedule.
+type SnapshotSchedule struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Robots string `json:"robots"`
+	// At is HH:MM.
+	At string `json:"at"`
+	// Days are lowercase three-letter weekdays, e.g. mon; empty means every
+	// day.
+	Days      []string   `json:"days"`
+	Enabled   bool       `json:"enabled"`
+	BaseURL   string     `json:"-"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	LastRunAt *time.Time `json:"last_run_at,omitempty"`
+}
+
+// Snapshot is one camera image a robot was asked for, kept with the robot's
+// history. ScheduleID is nil for snapshots taken on demand.
+type Snapshot struct {
+	ID          int64      `json:"id"`
+	RobotID     int64      `json:"robot_id"`
+	ScheduleID  *int64     `json:"schedule_id,omitempty"`
+	JobID       *int64     `json:"job_id,omitempty"`
+	Token       string     `json:"-"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	// JobStatus is the status of the capture_image job, filled in by
+	// ListPendingSnapshots.
+	JobStatus string `json:"-"`
+}
+
+const snapshotScheduleColumns = `id, name, robots, at, days, enabled, base_url, created_by, created_at, last_run_at`
+
+// ListSnapshotSchedules returns every schedule, oldest first.
+func (d *DB) ListSnapshotSchedules(ctx context.Context) ([]SnapshotSchedule, error) {
+	rows, err := d.query(ctx, `SELECT `+snapshotScheduleColumns+` FROM snapshot_schedules ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	return scanSnapshotSchedules(rows)
+}
+
+// GetSnapshotSchedule returns one schedule, or sql.ErrNoRows.
+func (d *DB) GetSnapshotSchedule(ctx context.Context, id int64) (SnapshotSchedule, error) {
+	rows, err := d.query(ctx, `SELECT `+snapshotScheduleColumns+` FROM snapshot_schedules WHERE id = ?`, id)
+	if err != nil {
+		return SnapshotSchedule{}, err
+	}
+	schedules, err := scanSnapshotSchedules(rows)
+	if err != nil {
+		return SnapshotSchedule{}, err
+	}
+	if len(schedules) == 0 {
+		return SnapshotSchedule{}, sql.ErrNoRows
+	}
+	return schedules[0], nil
+}
+
+// CreateSnapshotSchedule stores a new schedule and returns its id.
+func (d *DB) CreateSnapshotSchedule(ctx context.Context, s SnapshotSchedule) (int64, error) {
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = time.Now().UTC()
+	}
+	return d.insert(ctx, `INSERT INTO snapshot_schedules (name, robots, at, days, enabled, base_url, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.Name, s.Robots, s.At, strings.Join(s.Days, ","), boolInt(s.Enabled), s.BaseURL, s.CreatedBy, s.CreatedAt)
+}
+
+// UpdateSnapshotSchedule saves the editable fields of s.
+func (d *DB) UpdateSnapshotSchedule(ctx context.Context, s SnapshotSchedule) error {
+	res, err := d.exec(ctx, `UPDATE snapshot_schedules SET name = ?, robots = ?, at = ?, days = ?, enabled = ?, base_url = ? WHERE id = ?`,
+		s.Name, s.Robots, s.At, strings.Join(s.Days, ","), boolInt(s.Enabled), s.BaseURL, s.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteSnapshotSchedule removes a schedule. The snapshots it took are kept.
+func (d *DB) DeleteSnapshotSchedule(ctx context.Context, id int64) error {
+	res, err := d.exec(ctx, `DELETE FROM snapshot_schedules WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MarkSnapshotScheduleRun records that the schedule ran at t.
+func (d *DB) MarkSnapshotScheduleRun(ctx context.Context, id int64, t time.Time) error {
+	_, err := d.exec(ctx, `UPDATE snapshot_schedules SET last_run_at = ? WHERE id = ?`, t.UTC(), id)
+	return err
+}
+
+func scanSnapshotSchedules(rows *sql.Rows) ([]SnapshotSchedule, error) {
+	defer rows.Close()
+	schedules := []SnapshotSchedule{}
+	for rows.Next() {
+		var s SnapshotSchedule
+		var days, createdBy sql.NullString
+		var enabled int64
+		var lastRun sql.NullTime
+		if err := rows.Scan(&s.ID, &s.Name, &s.Robots, &s.At, &days, &enabled, &s.BaseURL, &createdBy, &s.CreatedAt, &lastRun); err != nil {
+			return nil, err
+		}
+		s.Days = []string{}
+		if days.String != "" {
+			s.Days = strings.Split(days.String, ",")
+		}
+		s.Enabled = enabled != 0
+		s.CreatedBy = createdBy.String
+		if lastRun.Valid {
+			t := lastRun.Time
+			s.LastRunAt = &t
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+const snapshotColumns = `s.id, s.robot_id, s.schedule_id, s.job_id, s.token, s.status, s.error, s.created_at, s.completed_at`
+
+// CreateSnapshot records a snapshot, pending unless s.Status says otherwise,
+// and returns its id.
+func (d *DB) CreateSnapshot(ctx context.Context, s Snapshot) (int64, error) {
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = time.Now().UTC()
+	}
+	if s.Status == "" {
+		s.Status = SnapshotPending
+	}
+	return d.insert(ctx, `INSERT INTO snapshots (robot_id, schedule_id, job_id, token, status, error, created_at, completed_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.RobotID, s.ScheduleID, s.JobID, s.Token, s.Status, s.Error, s.CreatedAt, s.CompletedAt)
+}
+
+// SetSnapshotJob records the capture_image job queued for a snapshot.
+func (d *DB) SetSnapshotJob(ctx context.Context, id, jobID int64) error {
+	_, err := d.exec(ctx, `UPDATE snapshots SET job_id = ? WHERE id = ?`, jobID, id)
+	return err
+}
+
+// GetSnapshot returns one snapshot, or sql.ErrNoRows.
+func (d *DB) GetSnapshot(ctx context.Context, id int64) (Snapshot, error) {
+	rows, err := d.query(ctx, `SELECT `+snapshotColumns+`, '' FROM snapshots s WHERE s.id = ?`, id)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snaps, err := scanSnapshots(rows)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if len(snaps) == 0 {
+		return Snapshot{}, sql.ErrNoRows
+	}
+	return snaps[0], nil
+}
+
+// ListSnapshots returns up to limit of a robot's snapshots, newest first.
+// A before id above zero pages back from that snapshot.
+func (d *DB) ListSnapshots(ctx context.Context, robotID, before int64, limit int) ([]Snapshot, error) {
+	q := `SELECT ` + snapshotColumns + `, '' FROM snapshots s WHERE s.robot_id = ?`
+	args := []interface{}{robotID}
+	if before > 0 {
+		q += ` AND s.id < ?`
+		args = append(args, before)
+	}
+	rows, err := d.query(ctx, q+` ORDER BY s.id DESC LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanSnapshots(rows)
+}
+
+// ListPendingSnapshots returns the snapshots still waiting for an upload,
+// with the status of their capture_image job.
+func (d *DB) ListPendingSnapshots(ctx context.Context) ([]Snapshot, error) {
+	rows, err := d.query(ctx, `SELECT `+snapshotColumns+`, COALESCE(j.status, '') FROM snapshots s LEFT JOIN jobs j ON j.id = s.job_id WHERE s.status = ? ORDER BY s.id`, SnapshotPending)
+	if err != nil {
+		return nil, err
+	}
+	return scanSnapshots(rows)
+}
+
+// FinishSnapshot moves a pending snapshot to status. It reports false if the
+// snapshot was no longer pending, so a late upload can't revive a snapshot
+// already reported as failed.
+func (d *DB) FinishSnapshot(ctx context.Context, id int64, status, errMsg string) (bool, error) {
+	res, err := d.exec(ctx, `UPDATE snapshots SET status = ?, error = ?, completed_at = ? WHERE id = ? AND status = ?`,
+		status, errMsg, time.Now().UTC(), id, SnapshotPending)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteSnapshotsBefore removes the finished snapshots taken before cutoff
+// and returns them, so the caller can remove the images.
+func (d *DB) DeleteSnapshotsBefore(ctx context.Context, cutoff time.Time) ([]Snapshot, error) {
+	rows, err := d.query(ctx, `SELECT `+snapshotColumns+`, '' FROM snapshots s WHERE s.created_at < ? AND s.status <> ?`, cutoff.UTC(), SnapshotPending)
+	if err != nil {
+		return nil, err
+	}
+	old, err := scanSnapshots(rows)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := d.exec(ctx, `DELETE FROM snapshots WHERE created_at < ? AND status <> ?`, cutoff.UTC(), SnapshotPending); err != nil {
+		return nil, err
+	}
+	return old, nil
+}
+
+// DeleteSnapshotsBeyond removes each robot's finished snapshots past its
+// newest keep and returns them, so the caller can remove the images.
+func (d *DB) DeleteSnapshotsBeyond(ctx context.Context, keep int) ([]Snapshot, error) {
+	rows, err := d.query(ctx, `SELECT `+snapshotColumns+`, '' FROM snapshots s WHERE s.status <> ?
+		AND (SELECT COUNT(*) FROM snapshots n WHERE n.robot_id = s.robot_id AND n.id > s.id) >= ?`, SnapshotPending, keep)
+	if err != nil {
+		return nil, err
+	}
+	old, err := scanSnapshots(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range old {
+		if _, err := d.exec(ctx, `DELETE FROM snapshots WHERE id = ?`, s.ID); err != nil {
+			return nil, err
+		}
+	}
+	return old, nil
+}
+
+func scanSnapshots(rows *sql.Rows) ([]Snapshot, error) {
+	defer rows.Close()
+	snaps := []Snapshot{}
+	for rows.Next() {
+		var s Snapshot
+		var scheduleID, jobID sql.NullInt64
+		var errMsg sql.NullString
+		var completed sql.NullTime
+		if err := rows.Scan(&s.ID, &s.RobotID, &scheduleID, &jobID, &s.Token, &s.Status, &errMsg, &s.CreatedAt, &completed, &s.JobStatus); err != nil {
+			return nil, err
+		}
+		if scheduleID.Valid {
+			s.ScheduleID = &scheduleID.Int64
+		}
+		if jobID.Valid {
+			s.JobID = &jobID.Int64
+		}
+		s.Error = errMsg.String
+		if completed.Valid {
+			t := completed.Time
+			s.CompletedAt = &t
+		}
+		snaps = append(snaps, s)
+	}
+	return snaps, rows.Err()
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
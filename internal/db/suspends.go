@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// RobotSuspend is one sleep of a laptop's host, reported by its agent after
+// it resumed.
+type RobotSuspend struct {
+	RobotID     int64     `json:"robot_id,omitempty"`
+	SuspendedAt time.Time `json:"suspended_at"`
+	ResumedAt   time.Time `json:"resumed_at"`
+}
+
+const robotSuspendsSQL = `SELECT robot_id, suspended_at, resumed_at FROM robot_suspends WHERE resumed_at >= ? ORDER BY resumed_at`
+
+// RecordRobotSuspend stores a suspend unless the robot already reported one
+// starting at the same time, which happens when a heartbeat is redelivered.
+func (d *DB) RecordRobotSuspend(ctx context.Context, s RobotSuspend) error {
+	var n int
+	if err := d.queryRow(ctx, `SELECT COUNT(*) FROM robot_suspends WHERE robot_id = ? AND suspended_at = ?`, s.RobotID, s.SuspendedAt.UTC()).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	_, err := d.exec(ctx, `INSERT INTO robot_suspends (robot_id, suspended_at, resumed_at) VALUES (?, ?, ?)`, s.RobotID, s.SuspendedAt.UTC(), s.ResumedAt.UTC())
+	return err
+}
+
+// ListRobotSuspends returns the suspends that ended at or after since, oldest
+// first.
+func (d *DB) ListRobotSuspends(ctx context.Context, since time.Time) ([]RobotSuspend, error) {
+	rows, err := d.query(ctx, robotSuspendsSQL, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	suspends := []RobotSuspend{}
+	for rows.Next() {
+		var s RobotSuspend
+		if err := rows.Scan(&s.RobotID, &s.SuspendedAt, &s.ResumedAt); err != nil {
+			return nil, err
+		}
+		suspends = append(suspends, s)
+	}
+	return suspends, rows.Err()
+}
@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Telemetry resolutions in seconds. Heartbeat samples are stored at
+// TelemetryRaw and rolled up into hourly averages once the hour is over.
+const (
+	TelemetryRaw    = 60
+	TelemetryHourly = 3600
+)
+
+// TelemetryPoint is one sample, or one rolled-up bucket with its range.
+type TelemetryPoint struct {
+	TS    time.Time `json:"ts"`
+	Value float64   `json:"value"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+}
+
+// RecordTelemetry stores raw samples for robotID taken at ts.
+func (d *DB) RecordTelemetry(ctx context.Context, robotID int64, ts time.Time, metrics map[string]float64) error {
+	ts = ts.UTC().Truncate(time.Second)
+	for metric, v := range metrics {
+		_, err := d.exec(ctx, `INSERT INTO telemetry (robot_id, metric, resolution, ts, value, min_value, max_value) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			robotID, metric, TelemetryRaw, ts, v, v, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const telemetrySeriesSQL = `SELECT ts, value, min_value, max_value FROM telemetry
+WHERE robot_id = ? AND metric = ? AND resolution = ? AND ts >= ? ORDER BY ts`
+
+// TelemetrySeries returns the points of one metric since the given time, in
+// time order, at the requested resolution.
+func (d *DB) TelemetrySeries(ctx context.Context, robotID int64, metric string, resolution int, since time.Time) ([]TelemetryPoint, error) {
+	rows, err := d.query(ctx, telemetrySeriesSQL, robotID, metric, resolution, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	points := []TelemetryPoint{}
+	for rows.Next() {
+		var p TelemetryPoint
+		if err := rows.Scan(&p.TS, &p.Value, &p.Min, &p.Max); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// LatestTelemetry returns each robot's most recent raw sample of metric taken
+// since the given time.
+func (d *DB) LatestTelemetry(ctx context.Context, metric string, since time.Time) (map[int64]float64, error) {
+	rows, err := d.query(ctx, `SELECT t.robot_id, t.value FROM telemetry t
+WHERE t.metric = ? AND t.resolution = ? AND t.ts >= ? AND t.ts = (
+	SELECT MAX(ts) FROM telemetry WHERE robot_id = t.robot_id AND metric = t.metric AND resolution = t.resolution)`,
+		metric, TelemetryRaw, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	latest := map[int64]float64{}
+	for rows.Next() {
+		var id int64
+		var v float64
+		if err := rows.Scan(&id, &v); err != nil {
+			return nil, err
+		}
+		latest[id] = v
+	}
+	return latest, rows.Err()
+}
+
+// TelemetryMetrics lists the metric names recorded for a robot.
+func (d *DB) TelemetryMetrics(ctx context.Context, robotID int64) ([]string, error) {
+	rows, err := d.query(ctx, `SELECT DISTINCT metric FROM telemetry WHERE robot_id = ? ORDER BY metric`, robotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	metrics := []string{}
+	for rows.Next() {
+		var m string
+		if err := rows.Scan(&m); err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, rows.Err()
+}
+
+// LastTelemetryRollup returns the end of the newest hourly bucket, or the
+// zero time when nothing has been rolled up yet.
+func (d *DB) LastTelemetryRollup(ctx context.Context) (time.Time, error) {
+	var ts sql.NullTime
+	err := d.queryRow(ctx, `SELECT MAX(ts) FROM telemetry WHERE resolution = ?`, TelemetryHourly).Scan(&ts)
+	if err != nil || !ts.Valid {
+		return time.Time{}, err
+	}
+	return ts.Time.Add(TelemetryHourly * time.Second), nil
+}
+
+// RollupTelemetry averages raw samples in [from, to) into hourly buckets.
+// from and to must be on hour boundaries.
+func (d *DB) RollupTelemetry(ctx context.Context, from, to time.Time) error {
+	rows, err := d.query(ctx, `SELECT robot_id, metric, ts, value FROM telemetry
+WHERE resolution = ? AND ts >= ? AND ts < ?`, TelemetryRaw, from.UTC(), to.UTC())
+	if err != nil {
+		return err
+	}
+	type key struct {
+		robotID int64
+		metric  string
+		hour    time.Time
+	}
+	type agg struct {
+		sum, min, max float64
+		n             int
+	}
+	buckets := map[key]*agg{}
+	for rows.Next() {
+		var k key
+		var ts time.Time
+		var v float64
+		if err := rows.Scan(&k.robotID, &k.metric, &ts, &v); err != nil {
+			rows.Close()
+			return err
+		}
+		k.hour = ts.UTC().Truncate(time.Hour)
+		a := buckets[k]
+		if a == nil {
+			a = &agg{min: v, max: v}
+			buckets[k] = a
+		}
+		a.sum += v
+		a.n++
+		a.min = min(a.min, v)
+		a.max = max(a.max, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, d.dialect.rebind(`INSERT INTO telemetry (robot_id, metric, resolution, ts, value, min_value, max_value) VALUES (?, ?, ?, ?, ?, ?, ?)`))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for k, a := range buckets {
+		if _, err := stmt.ExecContext(ctx, k.robotID, k.metric, TelemetryHourly, k.hour, a.sum/float64(a.n), a.min, a.max); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// PruneTelemetry drops samples of the given resolution older than before.
+func (d *DB) PruneTelemetry(ctx context.Context, resolution int, before time.Time) (int64, error) {
+	res, err := d.exec(ctx, `DELETE FROM telemetry WHERE resolution = ? AND ts < ?`, resolution, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
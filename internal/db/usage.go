@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	countRobotsSQL = `SELECT COUNT(*),
+	COALESCE(SUM(CASE WHEN agent_id != '' AND last_seen >= ? THEN 1 ELSE 0 END), 0),
+	COALESCE(SUM(CASE WHEN agent_id != '' AND last_seen >= ? THEN 1 ELSE 0 END), 0)
+FROM robots WHERE archived_at IS NULL`
+	countImageBuildsSQL = `SELECT COUNT(*) FROM image_builds WHERE started_at >= ?`
+)
+
+// UsageCounts is what a deployment has used, for sizing and billing hosted
+// installs.
+type UsageCounts struct {
+	// Robots counts every robot that isn't archived, managed or not.
+	Robots int
+	// ActiveAgents counts robots whose agent checked in since the start of
+	// the period, and OnlineAgents those online now.
+	ActiveAgents int
+	OnlineAgents int
+	// Builds counts golden image builds started in the period, whatever
+	// their outcome, and BuildsTotal every build ever started.
+	Builds      int
+	BuildsTotal int
+}
+
+// CountUsage returns usage for the period starting at since.
+func (d *DB) CountUsage(ctx context.Context, since time.Time) (UsageCounts, error) {
+	var u UsageCounts
+	err := d.queryRow(ctx, countRobotsSQL, since.UTC(), time.Now().UTC().Add(-OfflineAfter)).Scan(&u.Robots, &u.ActiveAgents, &u.OnlineAgents)
+	if err != nil {
+		return u, err
+	}
+	if err := d.queryRow(ctx, countImageBuildsSQL, since.UTC()).Scan(&u.Builds); err != nil {
+		return u, err
+	}
+	err = d.queryRow(ctx, countImageBuildsSQL, time.Time{}).Scan(&u.BuildsTotal)
+	return u, err
+}
+
+// LastProfileImage returns the image the profile's latest successful build
+// wrote and when it finished, or sql.ErrNoRows if it has none.
+func (d *DB) LastProfileImage(ctx context.Context, profileID int64) (string, time.Time, error) {
+	var image sql.NullString
+	var finished time.Time
+	err := d.queryRow(ctx, `SELECT image_name, finished_at FROM image_builds
+WHERE profile_id = ? AND status = 'success' AND image_name IS NOT NULL AND image_name != ''
+ORDER BY finished_at DESC LIMIT 1`, profileID).Scan(&image, &finished)
+	return image.String, finished, err
+}
+
+// FinishImageBuild records how a build ended: b's status, artifact,
+// checksum, error, smoke test and log.
+func (d *DB) FinishImageBuild(ctx context.Context, b ImageBuild) error {
+	_, err := d.exec(ctx, `UPDATE image_builds SET finished_at = ?, status = ?, image_name = ?, image_size = ?, checksum = ?, error = ?, smoke_test = ?, smoke_error = ?, log = ? WHERE id = ?`,
+		time.Now().UTC(), b.Status, b.ImageName, b.ImageSize, b.Checksum, b.Error, b.SmokeTest, b.SmokeError, b.Log, b.ID)
+	return err
+}
+
+// SetImageBuildImage records the image a build is writing, before it is
+// done.
+func (d *DB) SetImageBuildImage(ctx context.Context, id int64, imageName string) error {
+	_, err := d.exec(ctx, `UPDATE image_builds SET image_name = ? WHERE id = ?`, imageName, id)
+	return err
+}
+
+// InterruptImageBuilds marks builds still recorded as building, which can
+// only be left over from before the controller restarted, as interrupted.
+// It returns how many there were and the images they were writing.
+func (d *DB) InterruptImageBuilds(ctx context.Context, errMsg string) (int, []string, error) {
+	rows, err := d.query(ctx, `SELECT id, image_name FROM image_builds WHERE status = 'building'`)
+	if err != nil {
+		return 0, nil, err
+	}
+	var ids []int64
+	var images []string
+	for rows.Next() {
+		var id int64
+		var image sql.NullString
+		if err := rows.Scan(&id, &image); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		ids = append(ids, id)
+		if image.String != "" {
+			images = append(images, image.String)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+	for _, id := range ids {
+		if _, err := d.exec(ctx, `UPDATE image_builds SET finished_at = ?, status = 'interrupted', error = ? WHERE id = ?`,
+			time.Now().UTC(), errMsg, id); err != nil {
+			return 0, images, err
+		}
+	}
+	return len(ids), images, nil
+}
@@ -0,0 +1,161 @@
+// Package events is the controller's in-process event bus. Modules publish
+// what happened (a build step, a robot heartbeat, an alert) without knowing
+// who listens; the websocket hub and anything added later subscribe.
+package events
+
+import (
+	"log/slog"
+	"sync"
+
+	"example.com/openrobot-fleet/internal/metrics"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind by before
+// it misses new ones.
+const subscriberBuffer = 256
+
+var dropped = metrics.NewCounterVec("openrobot_events_dropped_total", "Events a subscriber missed because it fell behind.", "subscriber")
+
+// Event is something that happened in the controller. Type names it on the
+// wire, e.g. in websocket messages.
+type Event interface {
+	Type() string
+}
+
+// BuildUpdate is the progress of a golden image build.
+type BuildUpdate struct {
+	// BuildID tells apart builds running side by side.
+	BuildID  int64  `json:"build_id,omitempty"`
+	Status   string `json:"status"`
+	Progress int    `json:"progress"`
+	Step     string `json:"step"`
+	// ETASec is about how many seconds the current step has left, when
+	// that is known.
+	ETASec    int      `json:"eta_sec,omitempty"`
+	Logs      []string `json:"logs"`
+	Error     string   `json:"error"`
+	ImageName string   `json:"image_name"`
+	// ProfileID and ProfileName are the image profile being built.
+	ProfileID   int64  `json:"profile_id,omitempty"`
+	ProfileName string `json:"profile_name,omitempty"`
+}
+
+func (BuildUpdate) Type() string { return "build_update" }
+
+// Alert is a problem with a robot an operator should look at, such as a
+// slow boot or the robot going offline.
+type Alert struct {
+	Kind    string `json:"kind"`
+	RobotID int64  `json:"robot_id"`
+	Message string `json:"message"`
+}
+
+func (Alert) Type() string { return "alert" }
+
+// RobotStatus is a robot's heartbeat, after the controller recorded it.
+// Status is the heartbeat as the agent sent it.
+type RobotStatus struct {
+	AgentID string
+	RobotID int64
+	Status  any
+}
+
+func (RobotStatus) Type() string { return "status_update" }
+
+// ScanResult is a host found by a discovery scan.
+type ScanResult struct {
+	IP           string `json:"ip"`
+	Port         int    `json:"port"`
+	MAC          string `json:"mac"`
+	Manufacturer string `json:"manufacturer"`
+	Banner       string `json:"banner"`
+	// Status is "enrolled", "unenrolled", or "pending" or "rejected" for
+	// an agent waiting for approval.
+	Status string `json:"status"`
+}
+
+func (ScanResult) Type() string { return "scan_result" }
+
+// SemesterProgress is the semester batch after one of its robots moved on
+// to another step.
+type SemesterProgress struct {
+	ID        int64            `json:"id,omitempty"`
+	Active    bool             `json:"active"`
+	State     string           `json:"state,omitempty"`
+	Total     int              `json:"total"`
+	Completed int              `json:"completed"`
+	Robots    map[int64]string `json:"robots"`
+	Errors    map[int64]string `json:"errors"`
+	CreatedBy string           `json:"created_by,omitempty"`
+}
+
+func (SemesterProgress) Type() string { return "semester_update" }
+
+// Bus delivers each published event to every subscriber. The zero value is
+// not usable; create one with New.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[*subscription]struct{}
+}
+
+type subscription struct {
+	name string
+	ch   chan Event
+}
+
+func New() *Bus {
+	return &Bus{subs: make(map[*subscription]struct{})}
+}
+
+// Subscribe calls fn with every event published from now on, in order, on
+// a goroutine of its own so a slow subscriber never holds up a publisher.
+// One that falls too far behind misses events, counted by name in
+// openrobot_events_dropped_total. Call the returned func to unsubscribe.
+func (b *Bus) Subscribe(name string, fn func(Event)) (unsubscribe func()) {
+	s := &subscription{name: name, ch: make(chan Event, subscriberBuffer)}
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+	go func() {
+		for e := range s.ch {
+			fn(e)
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			// Once removed no publisher can be sending, so ch can close.
+			b.mu.Lock()
+			delete(b.subs, s)
+			b.mu.Unlock()
+			close(s.ch)
+		})
+	}
+}
+
+// On subscribes fn to the events of type T only.
+func On[T Event](b *Bus, name string, fn func(T)) (unsubscribe func()) {
+	return b.Subscribe(name, func(e Event) {
+		if t, ok := e.(T); ok {
+			fn(t)
+		}
+	})
+}
+
+// Publish hands e to every subscriber without waiting for them. A nil Bus
+// drops it, so modules can publish before one is wired up.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.subs {
+		select {
+		case s.ch <- e:
+		default:
+			dropped.Inc(s.name)
+			slog.Warn("event subscriber is behind, dropping event", "subscriber", s.name, "type", e.Type())
+		}
+	}
+}
@@ -0,0 +1,312 @@
+// Package fleet implements "fleet as code": a YAML description of robots,
+// groups, scenarios and install defaults that is diffed against the database
+// and reconciled.
+package fleet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"example.com/openrobot-fleet/internal/db"
+	"gopkg.in/yaml.v3"
+)
+
+// Spec is the desired state of the fleet.
+type Spec struct {
+	InstallDefaults *InstallDefaults `yaml:"install_defaults,omitempty"`
+	// Groups name sets of robots; every member is tagged with the group name.
+	Groups    map[string][]string `yaml:"groups,omitempty"`
+	Scenarios []Scenario          `yaml:"scenarios,omitempty"`
+	Robots    []Robot             `yaml:"robots,omitempty"`
+}
+
+type InstallDefaults struct {
+	User          string `yaml:"user"`
+	SSHKey        string `yaml:"ssh_key,omitempty"`
+	Password      string `yaml:"password,omitempty"`
+	KeyPassphrase string `yaml:"key_passphrase,omitempty"`
+}
+
+// Scenario takes its config either as a YAML string (config_yaml) or as an
+// inline mapping (config).
+type Scenario struct {
+	Name        string                 `yaml:"name"`
+	Description string                 `yaml:"description,omitempty"`
+	ConfigYAML  string                 `yaml:"config_yaml,omitempty"`
+	Config      map[string]interface{} `yaml:"config,omitempty"`
+}
+
+type Robot struct {
+	Name string   `yaml:"name"`
+	Type string   `yaml:"type,omitempty"` // left unmanaged if empty
+	Tags []string `yaml:"tags,omitempty"`
+	// Left unmanaged if omitted. An empty ssh_key keeps the stored key.
+	InstallConfig *RobotInstallConfig `yaml:"install_config,omitempty"`
+}
+
+type RobotInstallConfig struct {
+	Address string `yaml:"address"`
+	User    string `yaml:"user"`
+	SSHKey  string `yaml:"ssh_key,omitempty"`
+	// KeyPassphrase goes with SSHKey; it is kept too when SSHKey is empty.
+	KeyPassphrase string `yaml:"key_passphrase,omitempty"`
+}
+
+// Parse decodes and sanity-checks a fleet file.
+func Parse(raw string) (Spec, error) {
+	var spec Spec
+	dec := yaml.NewDecoder(strings.NewReader(raw))
+	dec.KnownFields(true)
+	if err := dec.Decode(&spec); err != nil {
+		return Spec{}, fmt.Errorf("parse fleet config: %w", err)
+	}
+
+	seen := map[string]bool{}
+	for i, s := range spec.Scenarios {
+		name := strings.TrimSpace(s.Name)
+		if name == "" {
+			return Spec{}, fmt.Errorf("scenarios[%d]: name required", i)
+		}
+		if seen[name] {
+			return Spec{}, fmt.Errorf("scenario %q listed twice", name)
+		}
+		seen[name] = true
+		if s.Config != nil {
+			if s.ConfigYAML != "" {
+				return Spec{}, fmt.Errorf("scenario %q: set config or config_yaml, not both", name)
+			}
+			var buf bytes.Buffer
+			enc := yaml.NewEncoder(&buf)
+			enc.SetIndent(2)
+			if err := enc.Encode(s.Config); err != nil {
+				return Spec{}, fmt.Errorf("scenario %q: %w", name, err)
+			}
+			spec.Scenarios[i].ConfigYAML = buf.String()
+			spec.Scenarios[i].Config = nil
+		}
+		spec.Scenarios[i].Name = name
+	}
+
+	seen = map[string]bool{}
+	for i, r := range spec.Robots {
+		name := strings.TrimSpace(r.Name)
+		if name == "" {
+			return Spec{}, fmt.Errorf("robots[%d]: name required", i)
+		}
+		if seen[name] {
+			return Spec{}, fmt.Errorf("robot %q listed twice", name)
+		}
+		seen[name] = true
+		spec.Robots[i].Name = name
+		if ic := r.InstallConfig; ic != nil && (strings.TrimSpace(ic.Address) == "" || strings.TrimSpace(ic.User) == "") {
+			return Spec{}, fmt.Errorf("robot %q: install_config needs address and user", name)
+		}
+	}
+	for group := range spec.Groups {
+		if strings.TrimSpace(group) == "" || strings.Contains(group, ",") {
+			return Spec{}, fmt.Errorf("invalid group name %q", group)
+		}
+	}
+	if d := spec.InstallDefaults; d != nil && strings.TrimSpace(d.User) == "" {
+		return Spec{}, errors.New("install_defaults: user required")
+	}
+	return spec, nil
+}
+
+// State is the current contents of the database relevant to a Spec.
+type State struct {
+	Robots          []db.Robot
+	Scenarios       []db.Scenario
+	InstallDefaults *db.InstallConfig
+}
+
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+
+	KindInstallDefaults = "install_defaults"
+	KindScenario        = "scenario"
+	KindRobot           = "robot"
+)
+
+// Change is one step of a plan. Diff holds human-readable "field: old -> new"
+// lines; secrets are reported as changed without their values.
+type Change struct {
+	Action string   `json:"action"`
+	Kind   string   `json:"kind"`
+	Name   string   `json:"name"`
+	Diff   []string `json:"diff,omitempty"`
+
+	// ID of the existing row for updates and deletes.
+	ID int64 `json:"-"`
+	// Desired is the *InstallDefaults, *Scenario or *Robot to write, with
+	// Robot.Tags already expanded with group membership.
+	Desired interface{} `json:"-"`
+}
+
+// Plan computes the changes that bring current in line with spec. Robots and
+// scenarios that exist only in the database are deleted when prune is set and
+// otherwise left alone.
+func Plan(spec Spec, current State, prune bool) ([]Change, error) {
+	var changes []Change
+
+	if d := spec.InstallDefaults; d != nil {
+		if ch, ok := planInstallDefaults(*d, current.InstallDefaults); ok {
+			changes = append(changes, ch)
+		}
+	}
+
+	existingScenarios := map[string]db.Scenario{}
+	for _, s := range current.Scenarios {
+		existingScenarios[s.Name] = s
+	}
+	wantScenarios := map[string]bool{}
+	for i := range spec.Scenarios {
+		s := &spec.Scenarios[i]
+		wantScenarios[s.Name] = true
+		cur, ok := existingScenarios[s.Name]
+		if !ok {
+			changes = append(changes, Change{Action: ActionCreate, Kind: KindScenario, Name: s.Name, Desired: s,
+				Diff: []string{fmt.Sprintf("config_yaml: %d lines", lineCount(s.ConfigYAML))}})
+			continue
+		}
+		var diff []string
+		diff = diffField(diff, "description", cur.Description, s.Description)
+		if strings.TrimSpace(cur.ConfigYAML) != strings.TrimSpace(s.ConfigYAML) {
+			diff = append(diff, "config_yaml: changed")
+		}
+		if len(diff) > 0 {
+			changes = append(changes, Change{Action: ActionUpdate, Kind: KindScenario, Name: s.Name, ID: cur.ID, Desired: s, Diff: diff})
+		}
+	}
+
+	existingRobots := map[string]db.Robot{}
+	for _, r := range current.Robots {
+		existingRobots[r.Name] = r
+	}
+	wantRobots := map[string]bool{}
+	for _, r := range spec.Robots {
+		wantRobots[r.Name] = true
+	}
+	groupsOf := map[string][]string{}
+	for group, members := range spec.Groups {
+		for _, m := range members {
+			m = strings.TrimSpace(m)
+			if _, exists := existingRobots[m]; !exists && !wantRobots[m] {
+				return nil, fmt.Errorf("group %q references unknown robot %q", group, m)
+			}
+			groupsOf[m] = append(groupsOf[m], group)
+		}
+	}
+
+	for i := range spec.Robots {
+		want := spec.Robots[i]
+		want.Tags = normalizeTags(append(append([]string{}, want.Tags...), groupsOf[want.Name]...))
+		cur, ok := existingRobots[want.Name]
+		if !ok {
+			diff := []string{fmt.Sprintf("tags: %s", formatTags(want.Tags))}
+			if want.Type != "" {
+				diff = append(diff, "type: "+want.Type)
+			}
+			if want.InstallConfig != nil {
+				diff = append(diff, fmt.Sprintf("install_config: %s@%s", want.InstallConfig.User, want.InstallConfig.Address))
+			}
+			changes = append(changes, Change{Action: ActionCreate, Kind: KindRobot, Name: want.Name, Desired: &want, Diff: diff})
+			continue
+		}
+		var diff []string
+		if want.Type != "" {
+			diff = diffField(diff, "type", cur.Type, want.Type)
+		}
+		if curTags := normalizeTags(cur.Tags); formatTags(curTags) != formatTags(want.Tags) {
+			diff = append(diff, fmt.Sprintf("tags: %s -> %s", formatTags(curTags), formatTags(want.Tags)))
+		}
+		if ic := want.InstallConfig; ic != nil {
+			var curAddr, curUser, curKey string
+			if cur.InstallConfig != nil {
+				curAddr, curUser, curKey = cur.InstallConfig.Address, cur.InstallConfig.User, cur.InstallConfig.SSHKey
+			}
+			diff = diffField(diff, "install_config.address", curAddr, ic.Address)
+			diff = diffField(diff, "install_config.user", curUser, ic.User)
+			if ic.SSHKey != "" && strings.TrimSpace(ic.SSHKey) != strings.TrimSpace(curKey) {
+				diff = append(diff, "install_config.ssh_key: changed")
+			}
+			if ic.SSHKey != "" && cur.InstallConfig != nil && ic.KeyPassphrase != cur.InstallConfig.KeyPassphrase {
+				diff = append(diff, "install_config.key_passphrase: changed")
+			}
+		}
+		if len(diff) > 0 {
+			changes = append(changes, Change{Action: ActionUpdate, Kind: KindRobot, Name: want.Name, ID: cur.ID, Desired: &want, Diff: diff})
+		}
+	}
+
+	if prune {
+		for _, s := range current.Scenarios {
+			if !wantScenarios[s.Name] {
+				changes = append(changes, Change{Action: ActionDelete, Kind: KindScenario, Name: s.Name, ID: s.ID})
+			}
+		}
+		for _, r := range current.Robots {
+			if !wantRobots[r.Name] {
+				changes = append(changes, Change{Action: ActionDelete, Kind: KindRobot, Name: r.Name, ID: r.ID})
+			}
+		}
+	}
+	return changes, nil
+}
+
+func planInstallDefaults(want InstallDefaults, cur *db.InstallConfig) (Change, bool) {
+	if cur == nil {
+		return Change{Action: ActionCreate, Kind: KindInstallDefaults, Name: "default", Desired: &want,
+			Diff: []string{"user: " + want.User}}, true
+	}
+	var diff []string
+	diff = diffField(diff, "user", cur.User, want.User)
+	if strings.TrimSpace(cur.SSHKey) != strings.TrimSpace(want.SSHKey) {
+		diff = append(diff, "ssh_key: changed")
+	}
+	if cur.Password != want.Password {
+		diff = append(diff, "password: changed")
+	}
+	if cur.KeyPassphrase != want.KeyPassphrase {
+		diff = append(diff, "key_passphrase: changed")
+	}
+	if len(diff) == 0 {
+		return Change{}, false
+	}
+	return Change{Action: ActionUpdate, Kind: KindInstallDefaults, Name: "default", Desired: &want, Diff: diff}, true
+}
+
+func diffField(diff []string, field, cur, want string) []string {
+	if cur == want {
+		return diff
+	}
+	return append(diff, fmt.Sprintf("%s: %q -> %q", field, cur, want))
+}
+
+func normalizeTags(tags []string) []string {
+	set := map[string]bool{}
+	out := []string{}
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" || set[t] {
+			continue
+		}
+		set[t] = true
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func formatTags(tags []string) string {
+	return "[" + strings.Join(tags, ", ") + "]"
+}
+
+func lineCount(s string) int {
+	return len(strings.Split(strings.TrimRight(s, "\n"), "\n"))
+}
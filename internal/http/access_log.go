@@ -0,0 +1,134 @@
+package httpserver
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/openrobot-fleet/internal/logging"
+)
+
+// accessLogConfig controls which requests are written to the access log.
+// Errors and slow requests are always logged; the rest are sampled.
+type accessLogConfig struct {
+	enabled bool
+	// sample is the fraction (0-1) of ordinary requests that are logged.
+	sample float64
+	slow   time.Duration
+	// skip lists path prefixes that are never logged, e.g. static assets.
+	skip []string
+}
+
+func accessLogConfigFromEnv() accessLogConfig {
+	cfg := accessLogConfig{
+		enabled: true,
+		sample:  1,
+		slow:    time.Second,
+		skip:    []string{"/assets/", "/metrics"},
+	}
+	switch strings.ToLower(os.Getenv("ACCESS_LOG")) {
+	case "false", "off", "0":
+		cfg.enabled = false
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("ACCESS_LOG_SAMPLE"), 64); err == nil && v >= 0 && v <= 1 {
+		cfg.sample = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("ACCESS_LOG_SLOW_MS")); err == nil && v > 0 {
+		cfg.slow = time.Duration(v) * time.Millisecond
+	}
+	if v, ok := os.LookupEnv("ACCESS_LOG_SKIP"); ok {
+		cfg.skip = nil
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				cfg.skip = append(cfg.skip, p)
+			}
+		}
+	}
+	return cfg
+}
+
+func (c accessLogConfig) skipped(path string) bool {
+	for _, p := range c.skip {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// accessLogUser is filled in by authMiddleware, which runs inside the access
+// log middleware and so cannot hand the identity back through the request.
+type accessLogUser struct {
+	actor      string
+	onBehalfOf string
+}
+
+type accessLogUserKey struct{}
+
+func setAccessLogUser(ctx context.Context, actor, onBehalfOf string) {
+	if u, ok := ctx.Value(accessLogUserKey{}).(*accessLogUser); ok {
+		u.actor, u.onBehalfOf = actor, onBehalfOf
+	}
+}
+
+// accessLogMiddleware writes one line per request with the method, path,
+// status, latency, response size and user. The query string is left out
+// because agent callbacks carry tokens in it.
+func accessLogMiddleware(cfg accessLogConfig, next http.Handler) http.Handler {
+	if !cfg.enabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.skipped(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		user := &accessLogUser{}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), accessLogUserKey{}, user)))
+		elapsed := time.Since(start)
+
+		slow := elapsed >= cfg.slow
+		if rec.status < 400 && !slow && (cfg.sample <= 0 || rand.Float64() >= cfg.sample) {
+			return
+		}
+		level := slog.LevelInfo
+		if rec.status >= 500 || slow {
+			level = slog.LevelWarn
+		}
+		attrs := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", routeLabel(routePattern(r.Context()), rec.status),
+			"status", rec.status,
+			"duration_ms", elapsed.Milliseconds(),
+			"bytes", rec.bytes,
+			"remote", clientIP(r),
+		}
+		if user.actor != "" {
+			attrs = append(attrs, "user", user.actor)
+		}
+		if user.onBehalfOf != "" {
+			attrs = append(attrs, "on_behalf_of", user.onBehalfOf)
+		}
+		if slow {
+			attrs = append(attrs, "slow", true)
+		}
+		logging.FromContext(r.Context()).Log(r.Context(), level, "http request", attrs...)
+	})
+}
+
+// clientIP prefers the first X-Forwarded-For hop when behind a proxy such as
+// Traefik.
+func clientIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		return strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+	return r.RemoteAddr
+}
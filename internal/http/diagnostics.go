@@ -0,0 +1,119 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"time"
+
+	mqttc "example.com/openrobot-fleet/internal/mqtt"
+)
+
+// startedAt is when the controller process started, for uptime.
+var startedAt = time.Now()
+
+// diagnostics is a snapshot of the controller's own health: what the Go
+// runtime is using and how far behind its queues are. It is cheap enough to
+// poll while reproducing a slowdown.
+type diagnostics struct {
+	GoVersion     string        `json:"go_version"`
+	UptimeSeconds int64         `json:"uptime_seconds"`
+	CPUs          int           `json:"cpus"`
+	Goroutines    int           `json:"goroutines"`
+	Memory        memoryStats   `json:"memory"`
+	Websocket     HubStats      `json:"websocket"`
+	MQTT          mqttc.Pending `json:"mqtt"`
+	Database      databaseStats `json:"database"`
+	Pprof         bool          `json:"pprof"`
+}
+
+type memoryStats struct {
+	// HeapAllocBytes is live heap; SysBytes is everything obtained from the OS.
+	HeapAllocBytes uint64 `json:"heap_alloc_bytes"`
+	HeapObjects    uint64 `json:"heap_objects"`
+	SysBytes       uint64 `json:"sys_bytes"`
+	NumGC          uint32 `json:"num_gc"`
+	// LastGCPauseMs is the most recent stop-the-world pause.
+	LastGCPauseMs float64 `json:"last_gc_pause_ms"`
+	GCCPUFraction float64 `json:"gc_cpu_fraction"`
+}
+
+type databaseStats struct {
+	OpenConnections int `json:"open_connections"`
+	InUse           int `json:"in_use"`
+	Idle            int `json:"idle"`
+	// WaitCount and WaitMs add up every wait for a free connection since
+	// start; growth between two reports means requests queue on the DB.
+	WaitCount int64 `json:"wait_count"`
+	WaitMs    int64 `json:"wait_ms"`
+}
+
+func (s *Server) handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	respondJSON(w, http.StatusOK, s.diagnostics())
+}
+
+func (s *Server) diagnostics() diagnostics {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	d := diagnostics{
+		GoVersion:     runtime.Version(),
+		UptimeSeconds: int64(time.Since(startedAt).Seconds()),
+		CPUs:          runtime.NumCPU(),
+		Goroutines:    runtime.NumGoroutine(),
+		Memory: memoryStats{
+			HeapAllocBytes: ms.HeapAlloc,
+			HeapObjects:    ms.HeapObjects,
+			SysBytes:       ms.Sys,
+			NumGC:          ms.NumGC,
+			LastGCPauseMs:  float64(ms.PauseNs[(ms.NumGC+255)%256]) / 1e6,
+			GCCPUFraction:  ms.GCCPUFraction,
+		},
+		Websocket: s.Hub.Stats(),
+		MQTT:      s.MQTT.Pending(),
+		Pprof:     pprofEnabled(),
+	}
+	db := s.DB.SQL.Stats()
+	d.Database = databaseStats{
+		OpenConnections: db.OpenConnections,
+		InUse:           db.InUse,
+		Idle:            db.Idle,
+		WaitCount:       db.WaitCount,
+		WaitMs:          db.WaitDuration.Milliseconds(),
+	}
+	return d
+}
+
+// pprofEnabled reports whether PPROF=true. Profiles expose memory contents
+// and a CPU profile costs a few percent while it runs, so they are off
+// unless asked for, and even then need the admin session like the rest of
+// /api/.
+func pprofEnabled() bool {
+	return os.Getenv("PPROF") == "true"
+}
+
+// pprofHandler serves net/http/pprof under /api/debug/pprof/, e.g.
+//
+//	curl -b auth_token=... https://fleet/api/debug/pprof/profile?seconds=30 > cpu.pprof
+//	go tool pprof cpu.pprof
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	// pprof.Index looks for the /debug/pprof/ prefix to find named profiles.
+	stripped := http.StripPrefix("/api", mux)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !pprofEnabled() {
+			respondError(w, http.StatusNotFound, "pprof is disabled; set PPROF=true on the controller")
+			return
+		}
+		stripped.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,18 @@
+package httpserver
+
+import "example.com/openrobot-fleet/internal/events"
+
+// forwardEvents sends controller events to websocket clients as
+// {"type": ..., "data": ...} messages. Status updates also carry the robot's
+// agent_id and id at the top level, which the pages match robots on.
+func (s *Server) forwardEvents() {
+	s.Controller.Events.Subscribe("websocket", func(e events.Event) {
+		msg := map[string]interface{}{"type": e.Type(), "data": e}
+		if st, ok := e.(events.RobotStatus); ok {
+			msg["agent_id"] = st.AgentID
+			msg["id"] = st.RobotID
+			msg["data"] = st.Status
+		}
+		s.Hub.Broadcast(msg)
+	})
+}
@@ -0,0 +1,162 @@
+package httpserver
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"example.com/openrobot-fleet/internal/metrics"
+)
+
+var (
+	// Extra buckets above the defaults cover image and agent downloads.
+	httpDuration = metrics.NewHistogramVec("openrobot_http_request_duration_seconds",
+		"HTTP request latency by method, route and status code.",
+		append(append([]float64{}, metrics.DefaultBuckets...), 30, 60, 300), "method", "route", "code")
+	httpResponseBytes = metrics.NewCounterVec("openrobot_http_response_bytes_total",
+		"Bytes written in HTTP response bodies by route.", "route")
+	scanDuration = metrics.NewHistogramVec("openrobot_discovery_scan_duration_seconds",
+		"Network discovery scan wall time.",
+		[]float64{1, 5, 10, 30, 60, 120, 300})
+)
+
+// registerScrapeMetrics adds gauges that are read from the database when
+// /metrics is scraped rather than tracked incrementally.
+func (s *Server) registerScrapeMetrics() {
+	metrics.Default.OnScrape(func(w io.Writer) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		robots, err := s.DB.ListRobots(ctx)
+		if err != nil {
+			slog.Error("metrics: list robots", "err", err)
+		} else {
+			byStatus := map[string]float64{"online": 0, "offline": 0}
+			for _, r := range robots {
+				byStatus[r.Status]++
+			}
+			metrics.WriteGauge(w, "openrobot_robots", "Robots by liveness status.", "status", byStatus)
+		}
+
+		jobs, err := s.DB.CountJobsByStatus(ctx)
+		if err != nil {
+			slog.Error("metrics: count jobs", "err", err)
+		} else {
+			byStatus := make(map[string]float64, len(jobs))
+			for status, n := range jobs {
+				byStatus[status] = float64(n)
+			}
+			metrics.WriteGauge(w, "openrobot_jobs", "Jobs by status.", "status", byStatus)
+		}
+
+		hub, mq := s.Hub.Stats(), s.MQTT.Pending()
+		metrics.WriteGauge(w, "openrobot_queue_depth", "Messages waiting in the controller's websocket and MQTT queues.", "queue", map[string]float64{
+			"websocket":     float64(hub.Queued),
+			"mqtt_publish":  float64(mq.Publishing),
+			"mqtt_handling": float64(mq.Handling),
+		})
+	})
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if token := os.Getenv("METRICS_TOKEN"); token != "" {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.Default.Render(w)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Hijack passes through so websocket upgrades keep working.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	r.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// metricsMiddleware records request latency and response size per route.
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		pattern := new(string)
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), routePatternKey{}, pattern)))
+		route := routeLabel(*pattern, rec.status)
+		httpDuration.Observe(time.Since(start).Seconds(), r.Method, route, strconv.Itoa(rec.status))
+		httpResponseBytes.Add(float64(rec.bytes), route)
+	})
+}
+
+type routePatternKey struct{}
+
+// recordRoutePattern wraps the mux and hands the pattern it matched back to
+// metricsMiddleware, which only sees its own copy of the request.
+func recordRoutePattern(mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r)
+		if p, ok := r.Context().Value(routePatternKey{}).(*string); ok {
+			*p = r.Pattern
+		}
+	})
+}
+
+// routePattern is the mux pattern the request matched, or "" before it is
+// routed or if it matched none.
+func routePattern(ctx context.Context) string {
+	if p, ok := ctx.Value(routePatternKey{}).(*string); ok {
+		return *p
+	}
+	return ""
+}
+
+// routeLabel is the registered mux pattern a request matched, so IDs and
+// made-up paths cannot add label series. Requests that matched nothing,
+// were not let in or were not found share one label.
+func routeLabel(pattern string, status int) string {
+	if pattern == "" || status == http.StatusUnauthorized || status == http.StatusNotFound {
+		return "other"
+	}
+	return pattern
+}
@@ -0,0 +1,264 @@
+package httpserver
+
+import (
+	"net/http"
+	"sync"
+
+	"example.com/openrobot-fleet/internal/controller"
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/openapi"
+)
+
+// apiVersion is bumped whenever an operation below changes shape.
+const apiVersion = "1.0.0"
+
+// apiOperations is the REST contract. Keep it in step with routes(); the
+// client package and the web UI types are generated from the document built
+// here (go generate ./client). Websocket endpoints, pprof and the agent's speed
+// test callbacks are not part of the public surface and are left out.
+func apiOperations() []openapi.Operation {
+	m := controller.APIModels
+	return []openapi.Operation{
+		{ID: "login", Method: "POST", Path: "/api/login", Tag: "auth", Summary: "Log in and receive the session cookie", Request: loginRequest{}, Public: true},
+		{ID: "getOpenAPI", Method: "GET", Path: "/api/openapi.json", Tag: "auth", Summary: "This document", Public: true, Response: map[string]interface{}{}},
+		{ID: "getAuthStatus", Method: "GET", Path: "/api/auth/status", Tag: "auth", Summary: "Check the session cookie", Response: map[string]bool{}},
+		{ID: "getSystemConfig", Method: "GET", Path: "/api/settings/system", Tag: "settings", Summary: "Controller feature flags", Response: map[string]bool{}},
+		{ID: "getInstallDefaults", Method: "GET", Path: "/api/settings/install-defaults", Tag: "settings", Summary: "Default SSH credentials for installs", Response: m.InstallDefaults},
+		{ID: "updateInstallDefaults", Method: "PUT", Path: "/api/settings/install-defaults", Tag: "settings", Summary: "Replace the default SSH credentials", Request: m.InstallDefaultsRequest, Response: m.InstallConfigEnvelope},
+		{ID: "generateSSHKey", Method: "POST", Path: "/api/settings/ssh-keygen", Tag: "settings", Summary: "Generate an ed25519 keypair, keep the private key (encrypted with SECRETS_KEY) as the default install key and return the public key", Request: m.SSHKeygenRequest, Response: m.SSHKeygenResponse, Status: http.StatusCreated},
+		{ID: "getBatteryPolicy", Method: "GET", Path: "/api/settings/battery-policy", Tag: "settings", Summary: "Battery level below which robots with a dock are sent back to it", Response: m.BatteryPolicy},
+		{ID: "updateBatteryPolicy", Method: "PUT", Path: "/api/settings/battery-policy", Tag: "settings", Summary: "Turn the low-battery docking policy on or off, or change its threshold", Request: m.BatteryPolicy, Response: m.BatteryPolicy},
+		{ID: "getOnboardingDefaults", Method: "GET", Path: "/api/settings/onboarding", Tag: "settings", Summary: "Scenario and tags each robot type gets when it first joins the fleet", Response: m.OnboardingDefaults},
+		{ID: "updateOnboardingDefaults", Method: "PUT", Path: "/api/settings/onboarding", Tag: "settings", Summary: "Replace the per-type onboarding defaults", Request: m.OnboardingDefaults, Response: m.OnboardingDefaults},
+
+		{ID: "listRobots", Method: "GET", Path: "/api/robots", Tag: "robots", Summary: "List robots", Response: []db.Robot{},
+			Query: []openapi.Param{
+				{Name: "selector", Type: "string", Description: `only robots matching a selector, e.g. name~"tb4-*" or tag in (classA, classB)`},
+				{Name: "status", Type: "string", Description: "comma-separated statuses; online matches anything not offline"},
+				{Name: "type", Type: "string", Description: "robot or laptop"},
+				{Name: "tag", Type: "string", Description: "comma-separated tags, any of which must be set"},
+				{Name: "q", Type: "string", Description: "case-insensitive search in name, agent ID and notes"},
+				{Name: "limit", Type: "integer", Description: "page size (the X-Total-Count header has the full count)"},
+				{Name: "offset", Type: "integer", Description: "robots to skip"},
+				{Name: "fields", Type: "string", Description: "comma-separated fields to return; SSH keys and passwords are only included when install_config is listed"},
+				{Name: "archived", Type: "string", Description: "include to list archived robots too, only for just those"},
+			}},
+		{ID: "createRobot", Method: "POST", Path: "/api/robots", Tag: "robots", Summary: "Add a robot by hand without installing an agent; it is unmanaged until an agent links to it", Request: m.CreateRobotRequest, Response: db.Robot{}, Status: http.StatusCreated},
+		{ID: "getRobot", Method: "GET", Path: "/api/robots/{id}", Tag: "robots", Summary: "Get a robot", Response: db.Robot{}},
+		{ID: "deleteRobot", Method: "DELETE", Path: "/api/robots/{id}", Tag: "robots", Summary: "Archive a robot, or delete it for good, and report what was removed or retained", Response: db.RobotDeletion{},
+			Query: []openapi.Param{{Name: "purge", Type: "boolean", Description: "delete the robot with its jobs, speed tests and telemetry instead of archiving it"}}},
+		{ID: "restoreRobot", Method: "POST", Path: "/api/robots/{id}/restore", Tag: "robots", Summary: "Bring an archived robot back", Response: db.Robot{}},
+		{ID: "listArchivedRobots", Method: "GET", Path: "/api/robots/archived", Tag: "robots", Summary: "Archived robots, most recently archived first", Response: []db.Robot{}},
+		{ID: "listPendingAgents", Method: "GET", Path: "/api/robots/pending", Tag: "robots", Summary: "Agents AGENT_ENROLLMENT held back until an operator approves them, and those rejected", Response: []db.PendingAgent{}},
+		{ID: "approvePendingAgent", Method: "POST", Path: "/api/robots/pending/{agent}/approve", Tag: "robots", Summary: "Let a pending agent in, optionally under another name", Request: m.ApproveAgentRequest, Response: db.Robot{}},
+		{ID: "rejectPendingAgent", Method: "POST", Path: "/api/robots/pending/{agent}/reject", Tag: "robots", Summary: "Keep a pending agent out; its heartbeats are dropped by the status subscriber"},
+		{ID: "sendRobotCommand", Method: "POST", Path: "/api/robots/{id}/command", Tag: "robots", Summary: "Queue a command for a robot", Request: m.CommandRequest, Response: db.Job{}, Status: http.StatusCreated},
+		{ID: "sendSelectorCommand", Method: "POST", Path: "/api/robots/command", Tag: "robots", Summary: "Queue a command for every robot matching a selector", Request: m.SelectorCommandRequest, Response: m.SelectorCommandResponse, Status: http.StatusCreated},
+		{ID: "broadcastCommand", Method: "POST", Path: "/api/robots/command/broadcast", Tag: "robots", Summary: "Send a command to every robot", Request: m.CommandRequest, Response: db.Job{}, Status: http.StatusCreated},
+		{ID: "updateRobotInstallConfig", Method: "PUT", Path: "/api/robots/{id}/install-config", Tag: "robots", Summary: "Set a robot's SSH credentials", Request: m.InstallConfigRequest, Response: db.Robot{}},
+		{ID: "updateRobotTags", Method: "PUT", Path: "/api/robots/{id}/tags", Tag: "robots", Summary: "Replace a robot's tags", Request: m.TagsRequest, Response: db.Robot{}},
+		{ID: "updateRobot", Method: "PATCH", Path: "/api/robots/{id}", Tag: "robots", Summary: "Edit a robot's name, notes, type or ROS container", Request: m.RobotPatchRequest, Response: db.Robot{}},
+		{ID: "updateRobotName", Method: "PUT", Path: "/api/robots/{id}/name", Tag: "robots", Summary: "Rename a robot", Request: m.NameRequest, Response: db.Robot{}},
+		{ID: "uploadRobotSnapshot", Method: "POST", Path: "/api/robots/{id}/upload", Tag: "robots", Summary: "Upload a camera snapshot (form fields image and optional job_id); it is kept in the robot's history", Multipart: true, Response: m.StatusMessage},
+		{ID: "listRobotSnapshots", Method: "GET", Path: "/api/robots/{id}/snapshots", Tag: "snapshots", Summary: "A robot's camera snapshot history with image and thumbnail URLs, newest first", Response: m.RobotSnapshots,
+			Query: []openapi.Param{
+				{Name: "limit", Type: "integer", Description: "maximum results (default 50, at most 500)"},
+				{Name: "before", Type: "integer", Description: "only snapshots older than this snapshot id, for paging"},
+			}},
+		{ID: "takeRobotSnapshot", Method: "POST", Path: "/api/robots/{id}/snapshots", Tag: "snapshots", Summary: "Ask a robot for a camera snapshot kept in its history", Response: m.RobotSnapshot, Status: http.StatusAccepted},
+		{ID: "identifyAllRobots", Method: "POST", Path: "/api/robots/identify-all", Tag: "robots", Summary: "Flash a distinct LED pattern on every robot", Response: m.IdentifyAssignments},
+		{ID: "rollbackRobotDocker", Method: "POST", Path: "/api/robots/{id}/docker/rollback", Tag: "robots", Summary: "Redeploy the image or compose project the robot ran before its current docker scenario", Response: db.Job{}, Status: http.StatusCreated},
+		{ID: "getSensorSnapshot", Method: "POST", Path: "/api/robots/{id}/sensors", Tag: "robots", Summary: "Read the lidar, camera and odometry once and return them together", Request: m.SensorSnapshotRequest, Response: m.SensorSnapshot},
+		{ID: "sendNavGoals", Method: "POST", Path: "/api/robots/nav-goal", Tag: "robots", Summary: "Send Nav2 navigation goals to one or many robots; each job reports the distance remaining as progress", Request: m.NavGoalRequest, Response: m.SelectorCommandResponse, Status: http.StatusCreated},
+		{ID: "startFormationTest", Method: "POST", Path: "/api/robots/formation-test", Tag: "robots", Summary: "Drive the selected robots forward together at a shared start time to check command latency and readiness", Request: m.FormationTestRequest, Response: m.FormationTest, Status: http.StatusCreated},
+		{ID: "getFormationTest", Method: "GET", Path: "/api/robots/formation-test/{test}", Tag: "robots", Summary: "Progress and result of a formation test", Response: m.FormationTest},
+		{ID: "startSpeedTest", Method: "POST", Path: "/api/robots/{id}/speedtest", Tag: "robots", Summary: "Run a network speed test", Request: m.SpeedTestRequest, Response: db.Job{}, Status: http.StatusCreated},
+		{ID: "listSpeedTests", Method: "GET", Path: "/api/robots/{id}/speedtest", Tag: "robots", Summary: "Recent speed test results", Response: []db.SpeedTest{},
+			Query: []openapi.Param{{Name: "limit", Type: "integer", Description: "maximum results"}}},
+		{ID: "getRobotCamera", Method: "GET", Path: "/api/robots/{id}/camera", Tag: "robots", Summary: "Live MJPEG view of the robot's camera, proxied from its agent", ContentType: "multipart/x-mixed-replace"},
+		{ID: "startTeleop", Method: "POST", Path: "/api/robots/{id}/teleop", Tag: "robots", Summary: "Relay a WebRTC offer to the robot and return its answer: video from its camera and a data channel for velocity commands", Request: m.TeleopRequest, Response: m.TeleopResponse},
+		{ID: "stopTeleop", Method: "DELETE", Path: "/api/robots/{id}/teleop", Tag: "robots", Summary: "End the robot's teleop session and stop it", Response: db.Job{}, Status: http.StatusAccepted,
+			Query: []openapi.Param{{Name: "session", Type: "string", Description: "only end this session, if it is still the open one"}}},
+		{ID: "getRobotHostKey", Method: "GET", Path: "/api/robots/{id}/host-key", Tag: "robots", Summary: "SSH host key recorded for the robot on first login, which later logins require", Response: m.HostKey},
+		{ID: "resetRobotHostKey", Method: "DELETE", Path: "/api/robots/{id}/host-key", Tag: "robots", Summary: "Forget the robot's SSH host key, e.g. after a reflash; the next login records the new one", Status: http.StatusNoContent},
+		{ID: "getRobotTelemetry", Method: "GET", Path: "/api/robots/{id}/telemetry", Tag: "robots", Summary: "Time series of one agent metric", Response: m.TelemetrySeries,
+			Query: []openapi.Param{
+				{Name: "metric", Type: "string", Description: "battery, cpu_load, memory, disk or cpu_temp", Required: true},
+				{Name: "range", Type: "string", Description: "how far back, e.g. 6h or 7d (default 24h)"},
+			}},
+		{ID: "installAgent", Method: "POST", Path: "/api/install-agent", Tag: "robots", Summary: "Install the agent over SSH", Request: m.InstallAgentRequest, Response: db.Robot{}, Status: http.StatusCreated},
+		{ID: "scanNetwork", Method: "POST", Path: "/api/discovery/scan", Tag: "robots", Summary: "Scan the local subnet for robots", Response: []enrichedCandidate{}},
+
+		{ID: "listJobs", Method: "GET", Path: "/api/jobs", Tag: "jobs", Summary: "List jobs, newest first", Response: []db.Job{},
+			Query: []openapi.Param{
+				{Name: "robot", Type: "string", Description: "only jobs for this agent ID"},
+				{Name: "status", Type: "string", Description: "only jobs in this status"},
+				{Name: "since", Type: "string", Description: "only jobs created at or after this RFC 3339 time"},
+				{Name: "until", Type: "string", Description: "only jobs created before this RFC 3339 time (X-Next-Until of the previous page)"},
+				{Name: "limit", Type: "integer", Description: "page size (default 500, at most 5000)"},
+			}},
+		{ID: "listAuditEvents", Method: "GET", Path: "/api/audit", Tag: "jobs", Summary: "Recent audit events", Response: []db.AuditEvent{}},
+
+		{ID: "listScenarios", Method: "GET", Path: "/api/scenarios", Tag: "scenarios", Summary: "List scenarios", Response: []db.Scenario{}},
+		{ID: "createScenario", Method: "POST", Path: "/api/scenarios", Tag: "scenarios", Summary: "Create a scenario", Request: m.ScenarioRequest, Response: db.Scenario{}, Status: http.StatusCreated},
+		{ID: "getScenario", Method: "GET", Path: "/api/scenarios/{id}", Tag: "scenarios", Summary: "Get a scenario", Response: db.Scenario{}},
+		{ID: "updateScenario", Method: "PUT", Path: "/api/scenarios/{id}", Tag: "scenarios", Summary: "Update a scenario", Request: m.ScenarioRequest, Response: db.Scenario{}},
+		{ID: "deleteScenario", Method: "DELETE", Path: "/api/scenarios/{id}", Tag: "scenarios", Summary: "Delete a scenario", Status: http.StatusNoContent},
+		{ID: "applyScenario", Method: "POST", Path: "/api/scenarios/{id}/apply", Tag: "scenarios", Summary: "Apply a scenario to robots", Request: m.ApplyScenarioRequest, Response: m.ApplyScenarioResponse, Status: http.StatusCreated},
+		{ID: "setScenarioRepoAuth", Method: "PUT", Path: "/api/scenarios/{id}/repo-auth", Tag: "scenarios", Summary: "Set the credentials agents clone the scenario's private repo with", Request: m.RepoAuthRequest, Response: db.Scenario{}},
+		{ID: "deleteScenarioRepoAuth", Method: "DELETE", Path: "/api/scenarios/{id}/repo-auth", Tag: "scenarios", Summary: "Remove the scenario's repo credentials", Response: db.Scenario{}},
+		{ID: "listScenarioHistory", Method: "GET", Path: "/api/scenarios/{id}/history", Tag: "scenarios", Summary: "Robots the scenario was applied to, newest first", Response: []db.ScenarioApply{}},
+		{ID: "exportScenarios", Method: "GET", Path: "/api/scenarios/export", Tag: "scenarios", Summary: "Export scenarios, with the ones they extend, as a bundle", Response: m.ScenarioBundle,
+			Query: []openapi.Param{
+				{Name: "ids", Type: "string", Description: "comma-separated scenario IDs (default all)"},
+				{Name: "history", Type: "boolean", Description: "include each scenario's apply history"},
+				{Name: "format", Type: "string", Description: "json (default) or yaml"},
+			}},
+		{ID: "gitHook", Method: "POST", Path: "/api/hooks/git", Tag: "scenarios", Summary: "GitHub or GitLab push webhook; redeploys the scenarios with auto_deploy for the pushed repo and branch", Public: true, Request: map[string]interface{}{}, Response: m.GitHookResponse},
+		{ID: "listGitDeploys", Method: "GET", Path: "/api/hooks/git/deploys", Tag: "scenarios", Summary: "Recent deploys from the git webhook, newest first", Response: []db.GitDeploy{},
+			Query: []openapi.Param{
+				{Name: "status", Type: "string", Description: "pending, applied, rejected, superseded or failed"},
+				{Name: "limit", Type: "integer", Description: "maximum results (default 50)"},
+			}},
+		{ID: "approveGitDeploy", Method: "POST", Path: "/api/hooks/git/deploys/{id}/approve", Tag: "scenarios", Summary: "Apply a deploy waiting for approval", Response: db.GitDeploy{}},
+		{ID: "rejectGitDeploy", Method: "POST", Path: "/api/hooks/git/deploys/{id}/reject", Tag: "scenarios", Summary: "Discard a deploy waiting for approval", Response: db.GitDeploy{}},
+		{ID: "importScenarios", Method: "POST", Path: "/api/scenarios/import", Tag: "scenarios", Summary: "Import a scenario bundle", Request: m.ScenarioImportRequest, Response: m.ScenarioImportResponse},
+
+		{ID: "getFleetSummary", Method: "GET", Path: "/api/fleet/summary", Tag: "fleet", Summary: "Fleet counts and per-robot health scores", Response: m.FleetSummary},
+		{ID: "applyFleet", Method: "POST", Path: "/api/fleet/apply", Tag: "fleet", Summary: "Reconcile robots, scenarios and install defaults against a fleet file", Request: m.FleetApplyRequest, Response: m.FleetApplyResponse},
+		{ID: "getFleetPositions", Method: "GET", Path: "/api/fleet/positions", Tag: "fleet", Summary: "Where every robot last reported being, from AMCL or odometry, for the fleet map", Response: m.FleetPositions,
+			Query: []openapi.Param{{Name: "frame", Type: "string", Description: "only positions in this frame, e.g. map"}}},
+		{ID: "getFleetEStop", Method: "GET", Path: "/api/fleet/estop", Tag: "fleet", Summary: "The fleet emergency stop and the robots that are stopped", Response: m.FleetEStop},
+		{ID: "engageFleetEStop", Method: "POST", Path: "/api/fleet/estop", Tag: "fleet", Summary: "Emergency stop every robot until cleared", Request: m.FleetEStopRequest, Response: m.FleetEStop},
+		{ID: "clearFleetEStop", Method: "DELETE", Path: "/api/fleet/estop", Tag: "fleet", Summary: "Clear the emergency stop on every robot", Response: m.FleetEStop},
+
+		{ID: "getWeeklyReport", Method: "GET", Path: "/api/reports/weekly", Tag: "reports", Summary: "Preview the weekly fleet report", Response: m.WeeklyReport,
+			Query: []openapi.Param{{Name: "format", Type: "string", Description: "text for the plain-text email body"}}},
+		{ID: "sendWeeklyReport", Method: "POST", Path: "/api/reports/weekly/send", Tag: "reports", Summary: "Email the weekly fleet report now", Request: m.SendReportRequest, Response: m.SendReportResponse},
+		{ID: "getUsage", Method: "GET", Path: "/api/usage", Tag: "reports", Summary: "Robots enrolled, active agents, golden image builds and storage this month, against any configured limits", Response: m.UsageReport},
+
+		{ID: "listMissions", Method: "GET", Path: "/api/missions", Tag: "missions", Summary: "Saved waypoint routes", Response: []db.Mission{}},
+		{ID: "createMission", Method: "POST", Path: "/api/missions", Tag: "missions", Summary: "Save a route of waypoints, each with an optional wait or snapshot", Request: m.MissionRequest, Response: db.Mission{}, Status: http.StatusCreated},
+		{ID: "getMission", Method: "GET", Path: "/api/missions/{id}", Tag: "missions", Summary: "Get a mission", Response: db.Mission{}},
+		{ID: "updateMission", Method: "PUT", Path: "/api/missions/{id}", Tag: "missions", Summary: "Replace a mission's route", Request: m.MissionRequest, Response: db.Mission{}},
+		{ID: "deleteMission", Method: "DELETE", Path: "/api/missions/{id}", Tag: "missions", Summary: "Delete a mission", Status: http.StatusNoContent},
+		{ID: "runMission", Method: "POST", Path: "/api/missions/{id}/run", Tag: "missions", Summary: "Send robots along a mission; each job's steps show the waypoints reached", Request: m.MissionRunRequest, Response: m.SelectorCommandResponse, Status: http.StatusCreated},
+		{ID: "listSnapshotSchedules", Method: "GET", Path: "/api/snapshot-schedules", Tag: "snapshots", Summary: "Schedules that take camera snapshots automatically", Response: []db.SnapshotSchedule{}},
+		{ID: "createSnapshotSchedule", Method: "POST", Path: "/api/snapshot-schedules", Tag: "snapshots", Summary: "Take snapshots of the selected robots every day, or on some weekdays, at a time", Request: m.SnapshotScheduleRequest, Response: db.SnapshotSchedule{}, Status: http.StatusCreated},
+		{ID: "getSnapshotSchedule", Method: "GET", Path: "/api/snapshot-schedules/{id}", Tag: "snapshots", Summary: "Get a snapshot schedule", Response: db.SnapshotSchedule{}},
+		{ID: "updateSnapshotSchedule", Method: "PUT", Path: "/api/snapshot-schedules/{id}", Tag: "snapshots", Summary: "Replace a snapshot schedule", Request: m.SnapshotScheduleRequest, Response: db.SnapshotSchedule{}},
+		{ID: "deleteSnapshotSchedule", Method: "DELETE", Path: "/api/snapshot-schedules/{id}", Tag: "snapshots", Summary: "Delete a snapshot schedule; the snapshots it took are kept", Status: http.StatusNoContent},
+		{ID: "runSnapshotSchedule", Method: "POST", Path: "/api/snapshot-schedules/{id}/run", Tag: "snapshots", Summary: "Take a schedule's snapshots now", Response: m.SnapshotRun, Status: http.StatusAccepted},
+		{ID: "listBags", Method: "GET", Path: "/api/bags", Tag: "bags", Summary: "Recorded ROS bags, newest first", Response: []db.Bag{},
+			Query: []openapi.Param{
+				{Name: "experiment", Type: "string", Description: "only one experiment's bags"},
+				{Name: "robot_id", Type: "integer", Description: "only one robot's bags"},
+			}},
+		{ID: "startBags", Method: "POST", Path: "/api/bags", Tag: "bags", Summary: "Record a ROS bag on each selected robot; it is uploaded when the recording ends", Request: m.BagStartRequest, Response: m.BagStartResponse, Status: http.StatusCreated},
+		{ID: "getBag", Method: "GET", Path: "/api/bags/{id}", Tag: "bags", Summary: "Get a bag", Response: db.Bag{}},
+		{ID: "deleteBag", Method: "DELETE", Path: "/api/bags/{id}", Tag: "bags", Summary: "Delete a bag that is no longer recording", Status: http.StatusNoContent},
+		{ID: "downloadBag", Method: "GET", Path: "/api/bags/{id}/download", Tag: "bags", Summary: "Download a stored bag as a gzipped tar", ContentType: "application/gzip"},
+		{ID: "stopBag", Method: "POST", Path: "/api/bags/{id}/stop", Tag: "bags", Summary: "End a recording early; what was recorded is uploaded", Response: db.Job{}, Status: http.StatusAccepted},
+		{ID: "listRobotBags", Method: "GET", Path: "/api/robots/{id}/bags", Tag: "bags", Summary: "A robot's ROS bags, newest first", Response: []db.Bag{},
+			Query: []openapi.Param{{Name: "experiment", Type: "string", Description: "only one experiment's bags"}}},
+		{ID: "listHelpTopics", Method: "GET", Path: "/api/help", Tag: "help", Summary: "Every feature's help, customized or built in", Response: m.HelpTopics},
+		{ID: "getHelpTopic", Method: "GET", Path: "/api/help/{key}", Tag: "help", Summary: "Help for one feature (golden-image, enrollment or scenarios)", Response: m.HelpTopic},
+		{ID: "updateHelpTopic", Method: "PUT", Path: "/api/help/{key}", Tag: "help", Summary: "Replace a feature's help with the lab's own markdown", Request: m.HelpTopicRequest, Response: m.HelpTopic},
+		{ID: "resetHelpTopic", Method: "DELETE", Path: "/api/help/{key}", Tag: "help", Summary: "Restore a feature's built-in help", Response: m.HelpTopic},
+
+		{ID: "startSemester", Method: "POST", Path: "/api/semester/start", Tag: "semester", Summary: "Start a semester reset batch", Request: m.SemesterRequest, Response: m.StatusMessage, Status: http.StatusAccepted},
+		{ID: "getSemesterStatus", Method: "GET", Path: "/api/semester/status", Tag: "semester", Summary: "Progress of the semester batch", Response: m.SemesterStatus},
+		{ID: "preflightSemester", Method: "POST", Path: "/api/semester/preflight", Tag: "semester", Summary: "Check the robots a semester batch would run on, without starting it", Request: m.SemesterRequest, Response: m.SemesterPreflight},
+		{ID: "pauseSemester", Method: "POST", Path: "/api/semester/pause", Tag: "semester", Summary: "Pause the running semester batch after each robot's current step", Response: m.SemesterStatus},
+		{ID: "resumeSemester", Method: "POST", Path: "/api/semester/resume", Tag: "semester", Summary: "Resume a paused semester batch for the robots left", Response: m.SemesterStatus},
+		{ID: "listSemesterBatches", Method: "GET", Path: "/api/semester/batches", Tag: "semester", Summary: "Past and current semester batches, newest first", Response: m.SemesterBatches,
+			Query: []openapi.Param{{Name: "limit", Type: "integer", Description: "how many batches to return (default 20, at most 200)"}}},
+		{ID: "getSemesterBatch", Method: "GET", Path: "/api/semester/batches/{id}", Tag: "semester", Summary: "A semester batch's request, per-robot steps and step timings", Response: m.SemesterBatch},
+		{ID: "listSemesterTemplates", Method: "GET", Path: "/api/semester/templates", Tag: "semester", Summary: "Saved semester step lists", Response: m.SemesterTemplates},
+		{ID: "createSemesterTemplate", Method: "POST", Path: "/api/semester/templates", Tag: "semester", Summary: "Save an ordered list of semester steps, including custom commands", Request: m.SemesterTemplateRequest, Response: m.SemesterTemplate, Status: http.StatusCreated},
+		{ID: "getSemesterTemplate", Method: "GET", Path: "/api/semester/templates/{id}", Tag: "semester", Summary: "Get a semester template", Response: m.SemesterTemplate},
+		{ID: "updateSemesterTemplate", Method: "PUT", Path: "/api/semester/templates/{id}", Tag: "semester", Summary: "Replace a semester template's steps", Request: m.SemesterTemplateRequest, Response: m.SemesterTemplate},
+		{ID: "deleteSemesterTemplate", Method: "DELETE", Path: "/api/semester/templates/{id}", Tag: "semester", Summary: "Delete a semester template", Status: http.StatusNoContent},
+		{ID: "cancelSemester", Method: "POST", Path: "/api/semester/cancel", Tag: "semester", Summary: "Cancel the running or paused semester batch", Response: m.SemesterStatus},
+
+		{ID: "listRecoveryAgents", Method: "GET", Path: "/api/recovery", Tag: "recovery", Summary: "Agents waiting in recovery mode", Response: m.RecoveryAgents},
+		{ID: "pushRecoveryConfig", Method: "POST", Path: "/api/recovery/{hostname}", Tag: "recovery", Summary: "Send a config to an agent in recovery mode", Request: m.RecoveryConfigRequest, Response: m.StatusMessage, Status: http.StatusAccepted},
+		{ID: "enroll", Method: "POST", Path: "/api/enroll", Tag: "enrollment", Summary: "Called by a freshly flashed agent with the image's provisioning token; enrolls it under the name its MAC address or serial number has in the enrollment pool", Public: true, Request: m.EnrollRequest, Response: m.EnrollResponse},
+		{ID: "downloadEnrollAgent", Method: "GET", Path: "/api/enroll/agent", Tag: "enrollment", Summary: "Called by a laptop installing from its profile's autoinstall file, with the provisioning token in the X-Provision-Token header; returns the agent binary", Public: true, ContentType: "application/octet-stream",
+			Query: []openapi.Param{{Name: "arch", Type: "string", Description: "GOARCH or uname -m, default amd64"}}},
+		{ID: "listEnrollmentPool", Method: "GET", Path: "/api/enrollment/pool", Tag: "enrollment", Summary: "Robots pre-registered for zero-touch enrollment", Response: []db.EnrollmentSlot{}},
+		{ID: "createEnrollmentSlot", Method: "POST", Path: "/api/enrollment/pool", Tag: "enrollment", Summary: "Pre-register a robot by MAC address or serial number", Request: m.EnrollmentSlotRequest, Response: db.EnrollmentSlot{}, Status: http.StatusCreated},
+		{ID: "resetEnrollmentSlot", Method: "POST", Path: "/api/enrollment/pool/{id}/reset", Tag: "enrollment", Summary: "Let a re-flashed robot enroll through its slot again; its payload key is replaced", Response: db.EnrollmentSlot{}},
+		{ID: "deleteEnrollmentSlot", Method: "DELETE", Path: "/api/enrollment/pool/{id}", Tag: "enrollment", Summary: "Remove a robot from the enrollment pool; a robot that already enrolled is kept", Status: http.StatusNoContent},
+		{ID: "getProvisioningToken", Method: "GET", Path: "/api/enrollment/token", Tag: "enrollment", Summary: "The provisioning token golden images are built with", Response: m.ProvisioningToken},
+		{ID: "rotateProvisioningToken", Method: "POST", Path: "/api/enrollment/token/rotate", Tag: "enrollment", Summary: "Replace the provisioning token; images built with the old one can no longer enroll", Response: m.ProvisioningToken},
+		{ID: "createEnrollmentToken", Method: "POST", Path: "/api/enrollment/agent-tokens", Tag: "enrollment", Summary: "Issue a signed token to put in an agent's config as enrollment_token; with AGENT_ENROLLMENT=verified only agents holding one are let in", Request: m.EnrollmentTokenRequest, Response: m.EnrollmentToken, Status: http.StatusCreated},
+		{ID: "rotateEnrollmentKey", Method: "POST", Path: "/api/enrollment/agent-tokens/rotate", Tag: "enrollment", Summary: "Replace the key enrollment tokens are signed with; tokens issued so far no longer let new agents in"},
+
+		{ID: "listImageProfiles", Method: "GET", Path: "/api/image-profiles", Tag: "images", Summary: "Golden image profiles, each with the image its last build wrote", Response: m.ImageProfiles},
+		{ID: "createImageProfile", Method: "POST", Path: "/api/image-profiles", Tag: "images", Summary: "Create a golden image profile", Request: m.ImageProfileRequest, Response: m.ImageProfile, Status: http.StatusCreated},
+		{ID: "getImageProfile", Method: "GET", Path: "/api/image-profiles/{id}", Tag: "images", Summary: "One golden image profile", Response: m.ImageProfile},
+		{ID: "updateImageProfile", Method: "PUT", Path: "/api/image-profiles/{id}", Tag: "images", Summary: "Replace a golden image profile's settings", Request: m.ImageProfileRequest, Response: m.ImageProfile},
+		{ID: "deleteImageProfile", Method: "DELETE", Path: "/api/image-profiles/{id}", Tag: "images", Summary: "Delete a golden image profile and its image", Status: http.StatusNoContent},
+		{ID: "downloadImageProfileUserData", Method: "GET", Path: "/api/image-profiles/{id}/user-data", Tag: "images", Summary: "cloud-init user-data for a profile's image, or the Ubuntu autoinstall file of a laptop profile", ContentType: "text/yaml"},
+		{ID: "downloadImageProfileImage", Method: "GET", Path: "/api/image-profiles/{id}/image", Tag: "images", Summary: "Download the image a profile's last successful build wrote", ContentType: "application/octet-stream"},
+		{ID: "flashImageProfileDevice", Method: "POST", Path: "/api/image-profiles/{id}/flash", Tag: "images", Summary: "Pre-register a robot and get user-data for a card flashed with the profile's image that boots under the robot's name (201 if the robot was created, 200 if it existed)", Request: m.FlashDeviceRequest, Response: m.FlashDeviceResponse, Status: http.StatusCreated},
+		{ID: "buildGoldenImage", Method: "POST", Path: "/api/golden-image/build", Tag: "images", Summary: "Queue a golden image build; it starts straight away unless another build is running", Response: m.BuildQueued, Status: http.StatusAccepted,
+			Query: []openapi.Param{
+				{Name: "profile_id", Type: "integer", Description: "image profile to build; may be left out when there is only one"},
+				{Name: "from_cache", Type: "boolean", Description: "check the cached base image against the hash recorded when it was downloaded instead of fetching the upstream hash, e.g. to retry an interrupted build"},
+			}},
+		{ID: "cancelBuild", Method: "POST", Path: "/api/golden-image/build/cancel", Tag: "images", Summary: "Cancel a running golden image build, cleaning up its mounts and partial image", Response: m.StatusMessage, Status: http.StatusAccepted,
+			Query: []openapi.Param{{Name: "build_id", Type: "integer", Description: "build to cancel; required while several are running"}}},
+		{ID: "getBuildStatus", Method: "GET", Path: "/api/golden-image/status", Tag: "images", Summary: "Golden image build progress", Response: m.BuildStatus,
+			Query: []openapi.Param{{Name: "build_id", Type: "integer", Description: "running build to report on; defaults to the last one started"}}},
+		{ID: "listImageBuilds", Method: "GET", Path: "/api/golden-image/builds", Tag: "images", Summary: "Recent golden image builds, newest first, with queued ones and download links for images still kept", Response: m.ImageBuilds,
+			Query: []openapi.Param{
+				{Name: "profile_id", Type: "integer", Description: "only builds of this image profile"},
+				{Name: "limit", Type: "integer", Description: "how many builds to return, 1-200 (default 20)"},
+			}},
+		{ID: "getImageBuild", Method: "GET", Path: "/api/golden-image/builds/{id}", Tag: "images", Summary: "One golden image build with its log", Response: m.ImageBuild},
+		{ID: "downloadImageBuildArtifact", Method: "GET", Path: "/api/golden-image/builds/{id}/artifact", Tag: "images", Summary: "Download the xz-compressed image a build wrote, if it hasn't been pruned; its SHA-256 and signature come in the X-Checksum-Sha256 and X-Signature-Ed25519 headers", ContentType: "application/octet-stream"},
+		{ID: "deleteImageBuildArtifact", Method: "DELETE", Path: "/api/golden-image/builds/{id}/artifact", Tag: "images", Summary: "Delete the image a build wrote, with its checksum and signature; the build stays in the history", Status: http.StatusNoContent},
+		{ID: "downloadImageBuildChecksum", Method: "GET", Path: "/api/golden-image/builds/{id}/artifact/checksum", Tag: "images", Summary: "The image's .sha256 file, for sha256sum -c", ContentType: "text/plain"},
+		{ID: "downloadImageBuildSignature", Method: "GET", Path: "/api/golden-image/builds/{id}/artifact/signature", Tag: "images", Summary: "The raw Ed25519 signature of the image's .sha256 file, if images are signed", ContentType: "application/octet-stream"},
+		{ID: "getImageStorage", Method: "GET", Path: "/api/golden-image/storage", Tag: "images", Summary: "Disk used by golden images, the base image cache and snapshots, with each profile's images and how many it keeps", Response: m.ImageStorage},
+		{ID: "pruneImages", Method: "POST", Path: "/api/golden-image/prune", Tag: "images", Summary: "Delete each profile's images beyond the number it keeps (keep_images, else BUILD_KEEP_IMAGES)", Response: m.PruneImagesResponse},
+		{ID: "clearImageCache", Method: "DELETE", Path: "/api/golden-image/cache", Tag: "images", Summary: "Delete the downloaded base images; refused while a build runs", Response: m.PruneImagesResponse},
+		{ID: "getImagerOSList", Method: "GET", Path: "/api/golden-image/os_list.json", Tag: "images", Summary: "The built images still kept, as a Raspberry Pi Imager custom repository (rpi-imager --repo URL)", Public: true, Response: m.ImagerOSList},
+		{ID: "getImageSigningKey", Method: "GET", Path: "/api/golden-image/signing-key", Tag: "images", Summary: "The public key image checksums are signed with, as PEM", ContentType: "application/x-pem-file"},
+		{ID: "refreshImageBuild", Method: "POST", Path: "/api/golden-image/builds/{id}/refresh", Tag: "images", Summary: "Queue a build that rewrites the image build {id} wrote with the current agent binary and user-data, without reinstalling ROS", Status: http.StatusAccepted, Response: m.BuildQueued},
+		{ID: "cancelImageBuild", Method: "POST", Path: "/api/golden-image/builds/{id}/cancel", Tag: "images", Summary: "Take a queued build off the queue, or cancel it if it is running", Response: m.StatusMessage},
+
+		{ID: "getAgentInfo", Method: "GET", Path: "/api/agent/info", Tag: "agent", Summary: "Agent builds available for install", Response: m.AgentBinaries},
+		{ID: "downloadAgent", Method: "GET", Path: "/api/agent/download", Tag: "agent", Summary: "Download the agent binary", ContentType: "application/octet-stream",
+			Query: []openapi.Param{{Name: "arch", Type: "string", Description: "GOARCH or uname -m, default arm64"}}},
+
+		{ID: "backupDatabase", Method: "GET", Path: "/api/db/backup", Tag: "admin", Summary: "Download the SQLite database", ContentType: "application/octet-stream",
+			Query: []openapi.Param{{Name: "encrypt", Type: "string", Description: "key to encrypt with the controller's SECRETS_KEY"}}},
+		{ID: "backupDatabaseEncrypted", Method: "POST", Path: "/api/db/backup", Tag: "admin", Summary: "Download the SQLite database encrypted with a passphrase or the controller key", Request: backupRequest{}, ContentType: "application/octet-stream"},
+		{ID: "getDiagnostics", Method: "GET", Path: "/api/debug/diagnostics", Tag: "admin", Summary: "Controller runtime stats, websocket clients and MQTT/database backlogs", Response: diagnostics{}},
+		{ID: "restoreDatabase", Method: "POST", Path: "/api/db/restore", Tag: "admin", Summary: "Replace the database (form fields db_file and, for encrypted backups, passphrase)", Multipart: true, Response: m.StatusMessage},
+	}
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  *openapi.Document
+)
+
+// OpenAPIDocument returns the controller's REST contract.
+func OpenAPIDocument() *openapi.Document {
+	openAPIOnce.Do(func() {
+		openAPIDoc = openapi.Build("OpenRobot Fleet Controller", apiVersion, apiOperations())
+	})
+	return openAPIDoc
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	respondJSON(w, http.StatusOK, OpenAPIDocument())
+}
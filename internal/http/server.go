@@ -1,21 +1,28 @@
 package httpserver
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
-
+	"sync"
 	"time"
 
+	"example.com/openrobot-fleet/internal/agent"
 	"example.com/openrobot-fleet/internal/controller"
 	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/events"
+	"example.com/openrobot-fleet/internal/logging"
 	mqttc "example.com/openrobot-fleet/internal/mqtt"
 	"example.com/openrobot-fleet/internal/scan"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -26,10 +33,18 @@ type Server struct {
 	MQTT       *mqttc.Client
 	Controller *controller.Controller
 	Hub        *Hub
+
+	// baseCtx is the parent of every request context; it is cancelled on
+	// shutdown so long-lived handlers (terminals, streams) unwind.
+	baseCtx    context.Context
+	cancelBase context.CancelFunc
+
+	mu      sync.Mutex
+	servers []*http.Server
 }
 
-func NewServer(dbPath string) (*Server, error) {
-	dbConn, err := db.Open(dbPath)
+func NewServer(dbDriver, dsn string) (*Server, error) {
+	dbConn, err := db.Open(dbDriver, dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -38,54 +53,114 @@ func NewServer(dbPath string) (*Server, error) {
 	hub := NewHub()
 	go hub.Run()
 
-	ctrl.OnBuildUpdate = func(status string, progress int, step string, logs []string, errorMsg string, imageName string) {
-		event := map[string]interface{}{
-			"type": "build_update",
-			"data": map[string]interface{}{
-				"status":     status,
-				"progress":   progress,
-				"step":       step,
-				"logs":       logs,
-				"error":      errorMsg,
-				"image_name": imageName,
-			},
-		}
-		hub.Broadcast(event)
-	}
-
 	s := &Server{DB: dbConn, MQTT: mqttClient, Controller: ctrl, Hub: hub}
+	s.baseCtx, s.cancelBase = context.WithCancel(context.Background())
+	s.registerScrapeMetrics()
+	s.forwardEvents()
+	ctrl.RecoverInterruptedBuild(s.baseCtx)
+	ctrl.StartQueuedBuilds()
+	ctrl.RecoverSemesterBatch(s.baseCtx)
 	go s.subscribeStatusUpdates()
+	go s.subscribeRecovery()
+	go ctrl.RunWeeklyReports(s.baseCtx)
+	go ctrl.RunOfflineWatch(s.baseCtx)
+	go ctrl.RunDriftWatch(s.baseCtx)
+	go ctrl.RunTelemetryMaintenance(s.baseCtx)
+	go ctrl.RunSnapshotSchedules(s.baseCtx)
+	go ctrl.RunBagWatch(s.baseCtx)
 	return s, nil
 }
 
 func (s *Server) routes() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", s.handleHealth)
+	mux.HandleFunc("/metrics", s.handleMetrics)
 	mux.HandleFunc("/api/login", s.handleLogin)
 	mux.HandleFunc("/api/auth/status", s.handleAuthStatus)
+	mux.HandleFunc("/api/openapi.json", s.handleOpenAPI)
 	mux.HandleFunc("/api/ws", s.Hub.ServeHTTP)
 
 	// Protected routes
 	mux.HandleFunc("/api/install-agent", s.handleInstallAgent)
 	mux.HandleFunc("/api/settings/install-defaults", s.handleInstallDefaults)
+	mux.HandleFunc("/api/settings/ssh-keygen", s.handleSSHKeygen)
 	mux.HandleFunc("/api/settings/system", s.handleSystemConfig)
+	mux.HandleFunc("/api/settings/battery-policy", s.handleBatteryPolicy)
+	mux.HandleFunc("/api/usage", s.handleUsage)
+	mux.HandleFunc("/api/settings/onboarding", s.handleOnboardingDefaults)
 	mux.HandleFunc("/api/robots", s.handleListRobots)
 	mux.HandleFunc("/api/robots/", s.handleRobotSubroutes)
+	mux.HandleFunc("/api/robots/command", s.handleSelectorCommand)
+	mux.HandleFunc("/api/robots/archived", s.handleArchivedRobots)
+	mux.HandleFunc("/api/robots/pending", s.handlePendingAgents)
+	mux.HandleFunc("/api/robots/pending/", s.handlePendingAgent)
+	mux.HandleFunc("/api/robots/nav-goal", s.handleNavGoals)
+	mux.HandleFunc("/api/robots/formation-test", s.handleFormationTests)
+	mux.HandleFunc("/api/robots/formation-test/", s.handleFormationTests)
 	mux.HandleFunc("/api/robots/command/broadcast", s.handleRobotCommandBroadcast)
 	mux.HandleFunc("/api/scenarios", s.handleScenariosCollection)
 	mux.HandleFunc("/api/scenarios/", s.handleScenarioItem)
+	mux.HandleFunc("/api/scenarios/export", s.handleExportScenarios)
+	mux.HandleFunc("/api/scenarios/import", s.handleImportScenarios)
 	mux.HandleFunc("/api/jobs", s.handleListJobs)
+	mux.HandleFunc("/api/audit", s.handleAuditEvents)
+	mux.HandleFunc("/api/recovery", s.handleRecoveryList)
+	mux.HandleFunc("/api/recovery/", s.handleRecoveryConfig)
+	mux.HandleFunc("/api/enroll", s.handleEnroll)
+	mux.HandleFunc("/api/enroll/agent", s.handleEnrollAgent)
+	mux.HandleFunc("/api/enrollment/pool", s.handleEnrollmentPool)
+	mux.HandleFunc("/api/enrollment/pool/", s.handleEnrollmentSlot)
+	mux.HandleFunc("/api/enrollment/token", s.handleProvisioningToken)
+	mux.HandleFunc("/api/enrollment/token/rotate", s.handleRotateProvisioningToken)
+	mux.HandleFunc("/api/enrollment/agent-tokens", s.handleEnrollmentTokens)
+	mux.HandleFunc("/api/enrollment/agent-tokens/rotate", s.handleRotateEnrollmentKey)
+	mux.HandleFunc("/api/fleet/apply", s.handleFleetApply)
+	mux.HandleFunc("/api/hooks/git", s.handleGitHook)
+	mux.HandleFunc("/api/hooks/git/deploys", s.handleGitDeploys)
+	mux.HandleFunc("/api/hooks/git/deploys/", s.handleGitDeploys)
+	mux.HandleFunc("/api/fleet/summary", s.handleFleetSummary)
+	mux.HandleFunc("/api/fleet/estop", s.handleFleetEStop)
+	mux.HandleFunc("/api/fleet/positions", s.handleFleetPositions)
+	mux.HandleFunc("/api/missions", s.handleMissions)
+	mux.HandleFunc("/api/missions/", s.handleMission)
+	mux.HandleFunc("/api/snapshot-schedules", s.handleSnapshotSchedules)
+	mux.HandleFunc("/api/snapshot-schedules/", s.handleSnapshotSchedule)
+	mux.HandleFunc("/api/bags", s.handleBags)
+	mux.HandleFunc("/api/bags/", s.handleBag)
+	mux.HandleFunc("/api/help", s.handleHelpTopics)
+	mux.HandleFunc("/api/help/", s.handleHelpTopic)
+	mux.HandleFunc("/api/reports/weekly", s.handleWeeklyReport)
+	mux.HandleFunc("/api/reports/weekly/send", s.handleSendWeeklyReport)
+	mux.HandleFunc("/api/semester/templates", s.handleSemesterTemplates)
+	mux.HandleFunc("/api/semester/templates/", s.handleSemesterTemplate)
+	mux.HandleFunc("/api/semester/batches", s.handleSemesterBatches)
+	mux.HandleFunc("/api/semester/batches/", s.handleSemesterBatch)
 	mux.HandleFunc("/api/semester/start", s.handleSemesterStart)
 	mux.HandleFunc("/api/semester/status", s.handleSemesterStatus)
+	mux.HandleFunc("/api/semester/preflight", s.handleSemesterPreflight)
+	mux.HandleFunc("/api/semester/pause", s.handleSemesterPause)
+	mux.HandleFunc("/api/semester/resume", s.handleSemesterResume)
+	mux.HandleFunc("/api/semester/cancel", s.handleSemesterCancel)
 	mux.HandleFunc("/api/db/backup", s.handleBackupDB)
 	mux.HandleFunc("/api/db/restore", s.handleRestoreDB)
 	mux.HandleFunc("/api/discovery/scan", s.handleDiscoveryScan)
-	mux.HandleFunc("/api/golden-image", s.handleGoldenImage)
+	mux.HandleFunc("/api/image-profiles", s.handleImageProfiles)
+	mux.HandleFunc("/api/image-profiles/", s.handleImageProfile)
 	mux.HandleFunc("/api/golden-image/build", s.handleGoldenImageBuild)
+	mux.HandleFunc("/api/golden-image/build/cancel", s.handleGoldenImageBuildCancel)
 	mux.HandleFunc("/api/golden-image/status", s.handleGoldenImageStatus)
-	mux.HandleFunc("/api/golden-image/download", s.handleGoldenImageDownload)
+	mux.HandleFunc("/api/golden-image/builds", s.handleImageBuilds)
+	mux.HandleFunc("/api/golden-image/builds/", s.handleImageBuild)
+	mux.HandleFunc("/api/golden-image/signing-key", s.handleImageSigningKey)
+	mux.HandleFunc("/api/golden-image/os_list.json", s.handleImagerOSList)
+	mux.HandleFunc("/api/golden-image/storage", s.handleImageStorage)
+	mux.HandleFunc("/api/golden-image/prune", s.handleImagePrune)
+	mux.HandleFunc("/api/golden-image/cache", s.handleImageCache)
 	mux.HandleFunc("/api/agent/download", s.handleAgentDownload)
+	mux.HandleFunc("/api/agent/info", s.handleAgentInfo)
 	mux.HandleFunc("/api/robots/identify-all", s.handleIdentifyAll)
+	mux.HandleFunc("/api/debug/diagnostics", s.handleDiagnostics)
+	mux.Handle("/api/debug/pprof/", pprofHandler())
 
 	// Static files
 	webRoot := os.Getenv("WEB_ROOT")
@@ -104,13 +179,45 @@ func (s *Server) routes() http.Handler {
 		fs.ServeHTTP(w, r)
 	})
 
-	return s.authMiddleware(mux)
+	return metricsMiddleware(requestIDMiddleware(accessLogMiddleware(accessLogConfigFromEnv(), s.authMiddleware(recordRoutePattern(mux)))))
+}
+
+// requestIDMiddleware tags each API request with an ID (reusing one supplied
+// by a proxy) that is echoed in the response and carried into MQTT commands
+// as their correlation ID.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id := r.Header.Get(logging.RequestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = logging.NewID()
+		}
+		w.Header().Set(logging.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
 }
 
 func (s *Server) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Allow public endpoints
-		if !strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/api/login" {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/api/login" || r.URL.Path == "/api/openapi.json" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The git webhook checks its own signature, and enrollment the
+		// provisioning token baked into the image. Raspberry Pi Imager reads
+		// the image list without logging in, as it downloads the images.
+		if r.URL.Path == "/api/hooks/git" || r.URL.Path == "/api/enroll" || r.URL.Path == "/api/enroll/agent" || r.URL.Path == "/api/golden-image/os_list.json" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Agent callbacks authenticate with their own per-request token
+		if s.Controller.AgentCallback(r) {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -122,19 +229,29 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		r, ok := controller.WithAttribution(r)
+		if !ok {
+			http.Error(w, "invalid "+controller.OnBehalfOfHeader+" header", http.StatusBadRequest)
+			return
+		}
+		actor, onBehalfOf := controller.Actor(r.Context())
+		setAccessLogUser(r.Context(), actor, onBehalfOf)
+
 		next.ServeHTTP(w, r)
 	})
 }
 
+type loginRequest struct {
+	Password string `json:"password"`
+}
+
 func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		methodNotAllowed(w)
 		return
 	}
 
-	var creds struct {
-		Password string `json:"password"`
-	}
+	var creds loginRequest
 	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
@@ -155,19 +272,16 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		Value:    "secret-admin-token",
 		Path:     "/",
 		HttpOnly: true,
+		Secure:   r.TLS != nil,
 		Expires:  time.Now().Add(24 * time.Hour),
 	})
 
 	// Log successful login
-	ip := r.RemoteAddr
-	// If behind a proxy (like Traefik), use X-Forwarded-For
-	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
-		ip = fwd
-	}
+	ip := clientIP(r)
 	userAgent := r.Header.Get("User-Agent")
 
 	if err := s.DB.RecordLogin(r.Context(), ip, userAgent); err != nil {
-		log.Printf("failed to record login: %v", err)
+		logging.FromContext(r.Context()).Error("failed to record login", "err", err)
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -185,8 +299,66 @@ func (s *Server) Start() error {
 	if v := os.Getenv("HTTP_ADDR"); v != "" {
 		addr = v
 	}
-	log.Printf("controller listening on %s", addr)
-	return http.ListenAndServe(addr, s.routes())
+	if m := tlsModeFromEnv(); m.enabled() {
+		return s.serveTLS(m, addr, s.routes())
+	}
+	slog.Info("controller listening", "addr", addr)
+	return s.newHTTPServer(addr, s.routes()).ListenAndServe()
+}
+
+// newHTTPServer builds a listener whose requests derive from the server's
+// base context, and tracks it so Shutdown can drain it.
+func (s *Server) newHTTPServer(addr string, handler http.Handler) *http.Server {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return s.baseCtx },
+	}
+	s.mu.Lock()
+	s.servers = append(s.servers, srv)
+	s.mu.Unlock()
+	return srv
+}
+
+// Shutdown stops accepting connections, waits for in-flight requests and any
+// running golden image build until ctx expires, then closes websocket
+// clients, MQTT and the database.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	servers := append([]*http.Server(nil), s.servers...)
+	s.mu.Unlock()
+
+	// Hijacked connections (websockets) are not tracked by http.Server, so
+	// close them ourselves while regular requests drain.
+	s.Hub.Close()
+	s.cancelBase()
+
+	var firstErr error
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+	for _, srv := range servers {
+		wg.Add(1)
+		go func(srv *http.Server) {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				errMu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMu.Unlock()
+			}
+		}(srv)
+	}
+	wg.Wait()
+
+	s.Controller.WaitForBuild(ctx)
+
+	s.MQTT.Disconnect(250 * time.Millisecond)
+	if err := s.DB.SQL.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -198,11 +370,14 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleListRobots(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+	switch r.Method {
+	case http.MethodGet:
+		s.Controller.ListRobots(w, r)
+	case http.MethodPost:
+		s.Controller.CreateRobot(w, r)
+	default:
 		methodNotAllowed(w)
-		return
 	}
-	s.Controller.ListRobots(w, r)
 }
 
 func (s *Server) handleRobotSubroutes(w http.ResponseWriter, r *http.Request) {
@@ -223,6 +398,22 @@ func (s *Server) handleRobotSubroutes(w http.ResponseWriter, r *http.Request) {
 		s.Controller.RobotCommand(w, r)
 		return
 	}
+	if strings.HasSuffix(trimmed, "/docker/rollback") {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.RollbackDocker(w, r)
+		return
+	}
+	if strings.HasSuffix(trimmed, "/restore") {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.RestoreRobot(w, r)
+		return
+	}
 	if strings.HasSuffix(trimmed, "/tags") {
 		if r.Method != http.MethodPut {
 			methodNotAllowed(w)
@@ -239,10 +430,92 @@ func (s *Server) handleRobotSubroutes(w http.ResponseWriter, r *http.Request) {
 		s.Controller.UpdateRobotName(w, r)
 		return
 	}
+	if strings.HasSuffix(trimmed, "/formation/result") {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.FormationResult(w, r)
+		return
+	}
+	if strings.HasSuffix(trimmed, "/sensors/result") {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.SensorSnapshotResult(w, r)
+		return
+	}
+	if strings.HasSuffix(trimmed, "/sensors") {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.SensorSnapshot(w, r)
+		return
+	}
+	if strings.Contains(trimmed, "/speedtest") {
+		s.handleRobotSpeedTest(w, r, trimmed)
+		return
+	}
+	if strings.HasSuffix(trimmed, "/teleop/answer") {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.TeleopAnswer(w, r)
+		return
+	}
+	if strings.HasSuffix(trimmed, "/host-key") {
+		switch r.Method {
+		case http.MethodGet:
+			s.Controller.GetRobotHostKey(w, r)
+		case http.MethodDelete:
+			s.Controller.ResetRobotHostKey(w, r)
+		default:
+			methodNotAllowed(w)
+		}
+		return
+	}
+	if strings.HasSuffix(trimmed, "/teleop") {
+		switch r.Method {
+		case http.MethodPost:
+			s.Controller.StartTeleop(w, r)
+		case http.MethodDelete:
+			s.Controller.StopTeleop(w, r)
+		default:
+			methodNotAllowed(w)
+		}
+		return
+	}
+	if strings.HasSuffix(trimmed, "/camera") {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.GetRobotCamera(w, r)
+		return
+	}
+	if strings.HasSuffix(trimmed, "/telemetry") {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.GetRobotTelemetry(w, r)
+		return
+	}
 	if strings.HasSuffix(trimmed, "/terminal") {
 		s.Controller.HandleTerminal(w, r)
 		return
 	}
+	if strings.Contains(trimmed, "/snapshots") {
+		s.handleRobotSnapshots(w, r, trimmed)
+		return
+	}
+	if strings.Contains(trimmed, "/bags") {
+		s.handleRobotBags(w, r, trimmed)
+		return
+	}
 	if strings.HasSuffix(trimmed, "/upload") {
 		if r.Method != http.MethodPost {
 			methodNotAllowed(w)
@@ -255,6 +528,10 @@ func (s *Server) handleRobotSubroutes(w http.ResponseWriter, r *http.Request) {
 		s.Controller.GetRobot(w, r)
 		return
 	}
+	if r.Method == http.MethodPatch {
+		s.Controller.PatchRobot(w, r)
+		return
+	}
 	if r.Method == http.MethodDelete {
 		s.Controller.DeleteRobot(w, r)
 		return
@@ -262,6 +539,150 @@ func (s *Server) handleRobotSubroutes(w http.ResponseWriter, r *http.Request) {
 	methodNotAllowed(w)
 }
 
+func (s *Server) handleRobotSnapshots(w http.ResponseWriter, r *http.Request, trimmed string) {
+	if strings.HasSuffix(trimmed, "/snapshots") {
+		switch r.Method {
+		case http.MethodGet:
+			s.Controller.ListRobotSnapshots(w, r)
+		case http.MethodPost:
+			s.Controller.TakeRobotSnapshot(w, r)
+		default:
+			methodNotAllowed(w)
+		}
+		return
+	}
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.UploadRobotSnapshot(w, r)
+}
+
+func (s *Server) handleRobotBags(w http.ResponseWriter, r *http.Request, trimmed string) {
+	if strings.HasSuffix(trimmed, "/bags") {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.ListRobotBags(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.UploadRobotBag(w, r)
+}
+
+func (s *Server) handleRobotSpeedTest(w http.ResponseWriter, r *http.Request, trimmed string) {
+	switch {
+	case strings.HasSuffix(trimmed, "/speedtest/payload"):
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.SpeedTestPayload(w, r)
+	case strings.HasSuffix(trimmed, "/speedtest/upload"):
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.SpeedTestUpload(w, r)
+	case strings.HasSuffix(trimmed, "/speedtest/result"):
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.SpeedTestResult(w, r)
+	case strings.HasSuffix(trimmed, "/speedtest"):
+		switch r.Method {
+		case http.MethodGet:
+			s.Controller.ListSpeedTests(w, r)
+		case http.MethodPost:
+			s.Controller.StartSpeedTest(w, r)
+		default:
+			methodNotAllowed(w)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) handleSelectorCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.SelectorCommand(w, r)
+}
+
+func (s *Server) handleNavGoals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.NavGoals(w, r)
+}
+
+func (s *Server) handleOnboardingDefaults(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.Controller.GetOnboardingDefaults(w, r)
+	case http.MethodPut:
+		s.Controller.UpdateOnboardingDefaults(w, r)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (s *Server) handleArchivedRobots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.ListArchivedRobots(w, r)
+}
+
+func (s *Server) handleGitHook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.GitHook(w, r)
+}
+
+func (s *Server) handleGitDeploys(w http.ResponseWriter, r *http.Request) {
+	if strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/hooks/git/deploys"), "/") == "" {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.ListGitDeploys(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.DecideGitDeploy(w, r)
+}
+
+func (s *Server) handleFormationTests(w http.ResponseWriter, r *http.Request) {
+	if strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/robots/formation-test"), "/") == "" {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.StartFormationTest(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.GetFormationTest(w, r)
+}
+
 func (s *Server) handleRobotCommandBroadcast(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		methodNotAllowed(w)
@@ -291,6 +712,22 @@ func (s *Server) handleScenarioItem(w http.ResponseWriter, r *http.Request) {
 		s.Controller.ApplyScenario(w, r)
 		return
 	}
+	if strings.HasSuffix(trimmed, "/history") {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.ScenarioHistory(w, r)
+		return
+	}
+	if strings.HasSuffix(trimmed, "/repo-auth") {
+		if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.SetScenarioRepoAuth(w, r)
+		return
+	}
 	switch r.Method {
 	case http.MethodGet:
 		s.Controller.GetScenario(w, r)
@@ -303,6 +740,22 @@ func (s *Server) handleScenarioItem(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (s *Server) handleExportScenarios(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.ExportScenarios(w, r)
+}
+
+func (s *Server) handleImportScenarios(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.ImportScenarios(w, r)
+}
+
 func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		methodNotAllowed(w)
@@ -311,6 +764,14 @@ func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
 	s.Controller.ListJobs(w, r)
 }
 
+func (s *Server) handleAuditEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.ListAuditEvents(w, r)
+}
+
 func (s *Server) handleInstallDefaults(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -322,6 +783,14 @@ func (s *Server) handleInstallDefaults(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (s *Server) handleSSHKeygen(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.GenerateSSHKey(w, r)
+}
+
 func (s *Server) handleInstallAgent(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		methodNotAllowed(w)
@@ -330,80 +799,371 @@ func (s *Server) handleInstallAgent(w http.ResponseWriter, r *http.Request) {
 	s.Controller.InstallAgent(w, r)
 }
 
-func (s *Server) handleSemesterStart(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleFleetApply(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		methodNotAllowed(w)
 		return
 	}
-	s.Controller.HandleSemesterStart(w, r)
+	s.Controller.ApplyFleet(w, r)
 }
 
-func (s *Server) handleSemesterStatus(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleFleetSummary(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		methodNotAllowed(w)
 		return
 	}
-	s.Controller.GetSemesterStatus(w, r)
+	s.Controller.FleetSummary(w, r)
 }
 
-func (s *Server) handleBackupDB(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleFleetPositions(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		methodNotAllowed(w)
 		return
 	}
-	if os.Getenv("DEMO_MODE") == "true" {
-		respondError(w, http.StatusForbidden, "backup disabled in demo mode")
-		return
+	s.Controller.FleetPositions(w, r)
+}
+
+func (s *Server) handleFleetEStop(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.Controller.GetFleetEStop(w, r)
+	case http.MethodPost:
+		s.Controller.EngageFleetEStop(w, r)
+	case http.MethodDelete:
+		s.Controller.ClearFleetEStop(w, r)
+	default:
+		methodNotAllowed(w)
 	}
-	w.Header().Set("Content-Disposition", "attachment; filename=controller.db")
-	http.ServeFile(w, r, s.DB.Path)
 }
 
-func (s *Server) handleRestoreDB(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
 		methodNotAllowed(w)
 		return
 	}
-	if os.Getenv("DEMO_MODE") == "true" {
-		respondError(w, http.StatusForbidden, "restore disabled in demo mode")
+	s.Controller.GetUsage(w, r)
+}
+
+func (s *Server) handleBatteryPolicy(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.Controller.GetBatteryPolicy(w, r)
+	case http.MethodPut:
+		s.Controller.UpdateBatteryPolicy(w, r)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (s *Server) handleMissions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.Controller.ListMissions(w, r)
+	case http.MethodPost:
+		s.Controller.CreateMission(w, r)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (s *Server) handleMission(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/run") {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.RunMission(w, r)
 		return
 	}
+	switch r.Method {
+	case http.MethodGet:
+		s.Controller.GetMission(w, r)
+	case http.MethodPut:
+		s.Controller.UpdateMission(w, r)
+	case http.MethodDelete:
+		s.Controller.DeleteMission(w, r)
+	default:
+		methodNotAllowed(w)
+	}
+}
 
-	file, _, err := r.FormFile("db_file")
-	if err != nil {
-		respondError(w, http.StatusBadRequest, "failed to get file")
+func (s *Server) handleSnapshotSchedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.Controller.ListSnapshotSchedules(w, r)
+	case http.MethodPost:
+		s.Controller.CreateSnapshotSchedule(w, r)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (s *Server) handleSnapshotSchedule(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/run") {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.RunSnapshotSchedule(w, r)
 		return
 	}
-	defer file.Close()
+	switch r.Method {
+	case http.MethodGet:
+		s.Controller.GetSnapshotSchedule(w, r)
+	case http.MethodPut:
+		s.Controller.UpdateSnapshotSchedule(w, r)
+	case http.MethodDelete:
+		s.Controller.DeleteSnapshotSchedule(w, r)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (s *Server) handleBags(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.Controller.ListBags(w, r)
+	case http.MethodPost:
+		s.Controller.StartBags(w, r)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (s *Server) handleBag(w http.ResponseWriter, r *http.Request) {
+	trimmed := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case strings.HasSuffix(trimmed, "/stop"):
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.StopBag(w, r)
+	case strings.HasSuffix(trimmed, "/download"):
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.DownloadBag(w, r)
+	default:
+		switch r.Method {
+		case http.MethodGet:
+			s.Controller.GetBag(w, r)
+		case http.MethodDelete:
+			s.Controller.DeleteBag(w, r)
+		default:
+			methodNotAllowed(w)
+		}
+	}
+}
 
-	// Close current DB connection to release lock
-	if err := s.DB.SQL.Close(); err != nil {
-		log.Printf("failed to close db: %v", err)
+func (s *Server) handleHelpTopics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
 	}
+	s.Controller.ListHelpTopics(w, r)
+}
 
-	// Create new file (overwrite)
-	out, err := os.Create(s.DB.Path)
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to create file")
+func (s *Server) handleHelpTopic(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.Controller.GetHelpTopic(w, r)
+	case http.MethodPut:
+		s.Controller.UpdateHelpTopic(w, r)
+	case http.MethodDelete:
+		s.Controller.ResetHelpTopic(w, r)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (s *Server) handleWeeklyReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
 		return
 	}
-	defer out.Close()
+	s.Controller.GetWeeklyReport(w, r)
+}
 
-	if _, err := io.Copy(out, file); err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to write file")
+func (s *Server) handleSendWeeklyReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
 		return
 	}
+	s.Controller.SendWeeklyReport(w, r)
+}
 
-	// Re-open DB
-	newDB, err := db.Open(s.DB.Path)
-	if err != nil {
-		log.Printf("failed to reopen db: %v", err)
-		os.Exit(1) // Fatal error, let container restart
+func (s *Server) handleSemesterStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
 	}
+	s.Controller.HandleSemesterStart(w, r)
+}
 
-	// Update the reference
-	s.DB.SQL = newDB.SQL
+func (s *Server) handleSemesterStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.GetSemesterStatus(w, r)
+}
 
+func (s *Server) handleSemesterPreflight(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.PreflightSemester(w, r)
+}
+
+func (s *Server) handleSemesterPause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.PauseSemester(w, r)
+}
+
+func (s *Server) handleSemesterResume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.ResumeSemester(w, r)
+}
+
+func (s *Server) handleSemesterCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.CancelSemester(w, r)
+}
+
+func (s *Server) handleSemesterBatches(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.ListSemesterBatches(w, r)
+}
+
+func (s *Server) handleSemesterBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.GetSemesterBatch(w, r)
+}
+
+func (s *Server) handleSemesterTemplates(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.Controller.ListSemesterTemplates(w, r)
+	case http.MethodPost:
+		s.Controller.CreateSemesterTemplate(w, r)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (s *Server) handleSemesterTemplate(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.Controller.GetSemesterTemplate(w, r)
+	case http.MethodPut:
+		s.Controller.UpdateSemesterTemplate(w, r)
+	case http.MethodDelete:
+		s.Controller.DeleteSemesterTemplate(w, r)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+// backupRequest is the body of POST /api/db/backup, which keeps the
+// passphrase out of URLs and access logs.
+type backupRequest struct {
+	Passphrase string `json:"passphrase,omitempty"`
+	// ControllerKey encrypts with the controller's SECRETS_KEY instead.
+	ControllerKey bool `json:"controller_key,omitempty"`
+}
+
+func (s *Server) handleBackupDB(w http.ResponseWriter, r *http.Request) {
+	var req backupRequest
+	switch r.Method {
+	case http.MethodGet:
+		req.ControllerKey = r.URL.Query().Get("encrypt") == "key"
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid backup request")
+			return
+		}
+		if req.Passphrase != "" && req.ControllerKey {
+			respondError(w, http.StatusBadRequest, "use either a passphrase or the controller key")
+			return
+		}
+	default:
+		methodNotAllowed(w)
+		return
+	}
+	if os.Getenv("DEMO_MODE") == "true" {
+		respondError(w, http.StatusForbidden, "backup disabled in demo mode")
+		return
+	}
+	if s.DB.Driver != db.DriverSQLite {
+		respondError(w, http.StatusNotImplemented, "backup is only available for SQLite; use pg_dump for Postgres")
+		return
+	}
+	filename := "controller.db"
+	if req.Passphrase != "" || req.ControllerKey {
+		filename += ".enc"
+	}
+	// Written to a buffer first so a failure can still be reported as JSON.
+	var buf bytes.Buffer
+	if err := s.DB.Backup(r.Context(), &buf, db.BackupEncryption{Passphrase: req.Passphrase, ControllerKey: req.ControllerKey}); err != nil {
+		logging.FromContext(r.Context()).Error("backup failed", "err", err)
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	w.Write(buf.Bytes())
+}
+
+func (s *Server) handleRestoreDB(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	if os.Getenv("DEMO_MODE") == "true" {
+		respondError(w, http.StatusForbidden, "restore disabled in demo mode")
+		return
+	}
+	if s.DB.Driver != db.DriverSQLite {
+		respondError(w, http.StatusNotImplemented, "restore is only available for SQLite; use pg_restore for Postgres")
+		return
+	}
+
+	file, _, err := r.FormFile("db_file")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "failed to get file")
+		return
+	}
+	defer file.Close()
+
+	err = s.DB.Restore(r.Context(), file, r.FormValue("passphrase"))
+	switch {
+	case err != nil && s.DB.SQL.PingContext(r.Context()) != nil:
+		// The old database was closed and the new one didn't open.
+		logging.FromContext(r.Context()).Error("failed to reopen db", "err", err)
+		os.Exit(1) // Fatal error, let container restart
+	case err != nil:
+		logging.FromContext(r.Context()).Warn("restore rejected", "err", err)
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	respondJSON(w, http.StatusOK, map[string]string{"status": "restored"})
 }
 
@@ -412,14 +1172,39 @@ func methodNotAllowed(w http.ResponseWriter) {
 }
 
 type statusPayload struct {
-	Status    string `json:"status"`
-	TS        string `json:"ts"`
-	IP        string `json:"ip"`
-	Name      string `json:"name"`
-	Type      string `json:"type"`
-	JobID     string `json:"job_id"`
-	JobStatus string `json:"job_status"`
-	JobError  string `json:"job_error"`
+	Status    string       `json:"status"`
+	TS        string       `json:"ts"`
+	IP        string       `json:"ip"`
+	Name      string       `json:"name"`
+	Type      string       `json:"type"`
+	JobID     string       `json:"job_id"`
+	JobStatus string       `json:"job_status"`
+	JobError  string       `json:"job_error"`
+	JobSteps  []db.JobStep `json:"job_steps,omitempty"`
+	// JobProgress is how far a build or similar long command has got.
+	JobProgress string `json:"job_progress,omitempty"`
+
+	CorrelationID string `json:"correlation_id,omitempty"`
+
+	BootTime         string `json:"boot_time,omitempty"`
+	BootToConnectSec int    `json:"boot_to_connect_sec,omitempty"`
+
+	Metrics      map[string]float64 `json:"metrics,omitempty"`
+	AgentVersion string             `json:"agent_version,omitempty"`
+	ROSContainer string             `json:"ros_container,omitempty"`
+	Facts        *db.RobotFacts     `json:"facts,omitempty"`
+	Workspace    *db.RobotWorkspace `json:"workspace,omitempty"`
+	Docker       *db.RobotDocker    `json:"docker,omitempty"`
+	// Launches is nil from agents too old to track launches, and empty once
+	// the last one is stopped.
+	Launches []db.RobotLaunch  `json:"launches"`
+	Suspends []db.RobotSuspend `json:"suspends,omitempty"`
+	EStop    *db.RobotEStop    `json:"estop,omitempty"`
+	Dock     *db.RobotDock     `json:"dock,omitempty"`
+	// Pose is nil from agents without ROS or too old to report one.
+	Pose *db.RobotPosition `json:"pose,omitempty"`
+	// Enrollment is sent by agents with an enrollment token.
+	Enrollment *agent.EnrollmentProof `json:"enrollment,omitempty"`
 }
 
 func (s *Server) subscribeStatusUpdates() {
@@ -427,39 +1212,97 @@ func (s *Server) subscribeStatusUpdates() {
 		return
 	}
 	topic := "lab/status/#"
-	log.Printf("controller subscribing to %s", topic)
+	slog.Info("controller subscribing", "topic", topic)
 	h := func(_ mqtt.Client, msg mqtt.Message) {
 		agentID := parseAgentIDFromTopic(msg.Topic())
 		if agentID == "" {
-			log.Printf("status: unable to parse agent id from topic %s", msg.Topic())
+			slog.Warn("status: unable to parse agent id", "topic", msg.Topic())
+			return
+		}
+		// Agents an operator rejected are dropped before anything is recorded.
+		if s.Controller.AgentRejected(context.Background(), agentID) {
+			slog.Debug("status: ignoring rejected agent", "agent_id", agentID)
 			return
 		}
 		var payload statusPayload
 		if err := json.Unmarshal(msg.Payload(), &payload); err != nil {
-			log.Printf("status: invalid payload for %s: %v", agentID, err)
+			slog.Warn("status: invalid payload", "agent_id", agentID, "err", err)
 			return
 		}
 		name := payload.Name
 		if name == "" {
 			name = agentID
 		}
-		log.Printf("status update from %s: status=%s ip=%s type=%s job=%s/%s", agentID, payload.Status, payload.IP, payload.Type, payload.JobID, payload.JobStatus)
+		slog.Debug("status update", "agent_id", agentID, "status", payload.Status, "ip", payload.IP, "type", payload.Type, "job_id", payload.JobID, "job_status", payload.JobStatus)
+
+		// Surface agent job failures once, tagged with the originating request
+		prev := s.Controller.GetRobotJobStatus(agentID)
+		if payload.JobStatus == "failed" && (prev.JobID != payload.JobID || prev.JobStatus != "failed") {
+			slog.Error("agent job failed", "agent_id", agentID, "job_id", payload.JobID, "correlation_id", payload.CorrelationID, "err", payload.JobError)
+		}
+		// Record the job's progress on its row: running (or deferred to the
+		// next boot), then the outcome
+		if (payload.JobStatus == "running" || payload.JobStatus == "deferred" || payload.JobStatus == "success" || payload.JobStatus == "failed") && (prev.JobID != payload.JobID || prev.JobStatus != payload.JobStatus) {
+			if jobID, err := strconv.ParseInt(payload.JobID, 10, 64); err == nil {
+				if err := s.DB.UpdateJobStatus(context.Background(), jobID, payload.JobStatus); err != nil {
+					slog.Error("status: failed to update job", "job_id", jobID, "err", err)
+				}
+			}
+		}
+
+		// Batch jobs also report each step as it runs
+		if len(payload.JobSteps) > 0 && !slices.Equal(prev.JobSteps, payload.JobSteps) {
+			if jobID, err := strconv.ParseInt(payload.JobID, 10, 64); err == nil {
+				if err := s.DB.UpdateJobSteps(context.Background(), jobID, payload.JobSteps); err != nil {
+					slog.Error("status: failed to update job steps", "job_id", jobID, "err", err)
+				}
+			}
+		}
+
+		// Long commands such as colcon_build report a progress line too
+		if payload.JobProgress != prev.JobProgress && (payload.JobID == prev.JobID || payload.JobProgress != "") {
+			if jobID, err := strconv.ParseInt(payload.JobID, 10, 64); err == nil {
+				if err := s.DB.UpdateJobProgress(context.Background(), jobID, payload.JobProgress); err != nil {
+					slog.Error("status: failed to update job progress", "job_id", jobID, "err", err)
+				}
+			}
+		}
 
 		// Update job status in controller memory
-		s.Controller.UpdateRobotJobStatus(agentID, payload.JobID, payload.JobStatus, payload.JobError)
+		s.Controller.UpdateRobotJobStatus(agentID, payload.JobID, payload.JobStatus, payload.JobError, payload.JobSteps, payload.JobProgress)
 
 		// Check if we have a pending rename (DB name != Agent name)
 		// We look up by AgentID because that's what the robot is currently using.
 		existing, err := s.DB.GetRobotByAgentID(context.Background(), agentID)
+		// A robot added by hand is claimed by the first agent to heartbeat
+		// from its IP, unless a robot already goes by the agent's name.
+		if err != nil && payload.IP != "" {
+			if _, nerr := s.DB.GetRobotByName(context.Background(), name); nerr != nil && s.Controller.EnrollmentVerified(context.Background(), agentID, payload.Enrollment) {
+				if m, merr := s.DB.GetUnmanagedRobotByIP(context.Background(), payload.IP); merr == nil {
+					slog.Info("status: linking agent to unmanaged robot", "agent_id", agentID, "robot", m.Name, "ip", payload.IP)
+					existing, err = m, nil
+				}
+			}
+		}
+
+		// New agents need an enrollment token in verified mode, and count
+		// against the robot limit of a hosted deployment.
+		if err != nil && !s.Controller.AdmitAgent(context.Background(), agentID, name, payload.IP, payload.Type, payload.Enrollment) {
+			return
+		}
 
 		var dbID int64
+		// A robot that was offline (or never seen) gets the jobs queued for
+		// it in the meantime once it is back.
+		var cameOnline bool
 		if err == nil {
 			dbID = existing.ID
+			cameOnline = existing.LastSeen.IsZero() || time.Since(existing.LastSeen) > db.OfflineAfter
 		}
 
 		targetName := name
 		if err == nil && existing.Name != "" && existing.Name != name {
-			log.Printf("status: robot %s (agent_id=%s) reports name %s, but DB has %s. Sending rename command.", existing.Name, agentID, name, existing.Name)
+			slog.Info("status: robot name mismatch, sending rename command", "agent_id", agentID, "reported", name, "db_name", existing.Name)
 
 			// Send configure_agent command to rename the robot
 			cmd := map[string]interface{}{
@@ -475,33 +1318,224 @@ func (s *Server) subscribeStatusUpdates() {
 		}
 
 		if err := s.DB.UpsertRobotStatus(context.Background(), agentID, targetName, payload.IP, payload.Status, payload.Type); err != nil {
-			log.Printf("status: failed to upsert robot %s: %v", agentID, err)
+			slog.Error("status: failed to upsert robot", "agent_id", agentID, "err", err)
 		}
 
 		// Update controller job state
 		if payload.JobID != "" {
-			s.Controller.UpdateRobotJobStatus(agentID, payload.JobID, payload.JobStatus, payload.JobError)
+			s.Controller.UpdateRobotJobStatus(agentID, payload.JobID, payload.JobStatus, payload.JobError, payload.JobSteps, payload.JobProgress)
 		}
 
 		// If new robot, fetch ID
 		if dbID == 0 {
 			if r, err := s.DB.GetRobotByAgentID(context.Background(), agentID); err == nil {
 				dbID = r.ID
+				existing = r
+			}
+		}
+
+		if payload.BootTime != "" && dbID != 0 {
+			if bootTime, err := time.Parse(time.RFC3339, payload.BootTime); err == nil {
+				s.Controller.RecordBoot(context.Background(), existing, bootTime, payload.BootToConnectSec)
+			}
+		}
+
+		if len(payload.Suspends) > 0 && dbID != 0 {
+			s.Controller.RecordSuspends(context.Background(), existing, payload.Suspends)
+		}
+
+		if payload.AgentVersion != "" && dbID != 0 && payload.AgentVersion != existing.AgentVersion {
+			if err := s.DB.UpdateRobotAgentVersion(context.Background(), dbID, payload.AgentVersion); err != nil {
+				slog.Error("status: failed to record agent version", "agent_id", agentID, "err", err)
+			}
+		}
+		if dbID != 0 && payload.ROSContainer != existing.ROSContainer {
+			if err := s.DB.UpdateRobotROSContainer(context.Background(), dbID, payload.ROSContainer); err != nil {
+				slog.Error("status: failed to record ROS container", "agent_id", agentID, "err", err)
+			}
+		}
+		if dbID != 0 && payload.Facts != nil && (existing.Facts == nil || !reflect.DeepEqual(*existing.Facts, *payload.Facts)) {
+			if err := s.DB.UpdateRobotFacts(context.Background(), dbID, *payload.Facts); err != nil {
+				slog.Error("status: failed to record robot facts", "agent_id", agentID, "err", err)
+			}
+		}
+		if dbID != 0 && payload.Workspace != nil && (existing.Workspace == nil || *existing.Workspace != *payload.Workspace) {
+			if err := s.DB.UpdateRobotWorkspace(context.Background(), dbID, *payload.Workspace); err != nil {
+				slog.Error("status: failed to record robot workspace", "agent_id", agentID, "err", err)
+			}
+		}
+		if dbID != 0 && payload.Docker != nil && (existing.Docker == nil || !reflect.DeepEqual(*existing.Docker, *payload.Docker)) {
+			if err := s.DB.UpdateRobotDocker(context.Background(), dbID, *payload.Docker); err != nil {
+				slog.Error("status: failed to record docker deployment", "agent_id", agentID, "err", err)
+			}
+		}
+		if dbID != 0 && payload.Launches != nil && (len(existing.Launches) > 0 || len(payload.Launches) > 0) && !reflect.DeepEqual(existing.Launches, payload.Launches) {
+			if err := s.DB.UpdateRobotLaunches(context.Background(), dbID, payload.Launches); err != nil {
+				slog.Error("status: failed to record launches", "agent_id", agentID, "err", err)
+			}
+		}
+		if dbID != 0 && !reflect.DeepEqual(existing.EStop, payload.EStop) {
+			if err := s.DB.UpdateRobotEStop(context.Background(), dbID, payload.EStop); err != nil {
+				slog.Error("status: failed to record e-stop", "agent_id", agentID, "err", err)
+			}
+		}
+		if dbID != 0 {
+			var battery *float64
+			if v, ok := payload.Metrics[agent.MetricBattery]; ok {
+				battery = &v
+			}
+			if !reflect.DeepEqual(existing.Battery, battery) || !reflect.DeepEqual(existing.Dock, payload.Dock) {
+				if err := s.DB.UpdateRobotPower(context.Background(), dbID, battery, payload.Dock); err != nil {
+					slog.Error("status: failed to record battery and dock", "agent_id", agentID, "err", err)
+				}
 			}
+			existing.ID, existing.Battery, existing.Dock = dbID, battery, payload.Dock
+			s.Controller.CheckBattery(context.Background(), existing)
 		}
+		// The pose is sampled less often than heartbeats are sent, so most
+		// repeat the last one.
+		if dbID != 0 && payload.Pose != nil && (existing.Position == nil || !existing.Position.At.Equal(payload.Pose.At)) {
+			if err := s.DB.UpdateRobotPosition(context.Background(), dbID, *payload.Pose); err != nil {
+				slog.Error("status: failed to record position", "agent_id", agentID, "err", err)
+			}
+		}
+		s.Controller.RecordHeartbeat(dbID, time.Now())
 
-		// Broadcast WS
-		event := map[string]interface{}{
-			"type":     "status_update",
-			"agent_id": agentID,
-			"id":       dbID,
-			"data":     payload,
+		// Facts are recorded above, so a new robot's defaults can go by
+		// its platform
+		s.Controller.OnboardRobot(context.Background(), dbID)
+
+		if len(payload.Metrics) > 0 && dbID != 0 {
+			s.Controller.RecordTelemetry(context.Background(), dbID, payload.Metrics)
+		}
+		if cameOnline {
+			go s.Controller.ReplayQueuedJobs(context.Background(), existing, existing.LastSeen)
 		}
-		s.Hub.Broadcast(event)
+
+		s.Controller.Events.Publish(events.RobotStatus{AgentID: agentID, RobotID: dbID, Status: payload})
 	}
 	s.MQTT.Subscribe(topic, h)
 }
 
+// subscribeRecovery listens for agents that started without a usable config.
+func (s *Server) subscribeRecovery() {
+	if s.MQTT == nil {
+		return
+	}
+	// Single-level wildcard so the controller's own .../config replies are not echoed back
+	s.MQTT.Subscribe(agent.RecoveryTopicPrefix+"+", func(_ mqtt.Client, msg mqtt.Message) {
+		s.Controller.RecordRecoveryAnnouncement(msg.Payload())
+	})
+}
+
+func (s *Server) handleRecoveryList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.ListRecoveryAgents(w, r)
+}
+
+func (s *Server) handleRecoveryConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.PushRecoveryConfig(w, r)
+}
+
+func (s *Server) handleEnroll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.Enroll(w, r)
+}
+
+func (s *Server) handleEnrollmentPool(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.Controller.ListEnrollmentPool(w, r)
+	case http.MethodPost:
+		s.Controller.CreateEnrollmentSlot(w, r)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (s *Server) handleEnrollmentSlot(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/reset") {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.ResetEnrollmentSlot(w, r)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.DeleteEnrollmentSlot(w, r)
+}
+
+func (s *Server) handleProvisioningToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.GetProvisioningToken(w, r)
+}
+
+func (s *Server) handleRotateProvisioningToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.RotateProvisioningToken(w, r)
+}
+
+func (s *Server) handleEnrollmentTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.CreateEnrollmentToken(w, r)
+}
+
+func (s *Server) handleRotateEnrollmentKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.RotateEnrollmentKey(w, r)
+}
+
+func (s *Server) handlePendingAgents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.ListPendingAgents(w, r)
+}
+
+// handlePendingAgent routes /api/robots/pending/{agent}/approve and
+// /reject.
+func (s *Server) handlePendingAgent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/approve"):
+		s.Controller.ApprovePendingAgent(w, r)
+	case strings.HasSuffix(r.URL.Path, "/reject"):
+		s.Controller.RejectPendingAgent(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
 func parseAgentIDFromTopic(topic string) string {
 	const prefix = "lab/status/"
 	if !strings.HasPrefix(topic, prefix) {
@@ -510,66 +1544,78 @@ func parseAgentIDFromTopic(topic string) string {
 	return strings.TrimPrefix(topic, prefix)
 }
 
+type enrichedCandidate struct {
+	scan.Candidate
+	Status string `json:"status"` // "enrolled", "unenrolled", "pending", "rejected"
+}
+
 func (s *Server) handleDiscoveryScan(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		methodNotAllowed(w)
 		return
 	}
 
-	// Enrich with enrollment status
-	robots, err := s.DB.ListRobots(r.Context())
+	// Enrich with enrollment status; archived robots are still enrolled.
+	robots, err := s.DB.ListAllRobots(r.Context())
 	if err != nil {
-		log.Printf("failed to list robots for discovery: %v", err)
+		logging.FromContext(r.Context()).Error("failed to list robots for discovery", "err", err)
 		// Continue without enrollment info
 	}
 
-	knownIPs := make(map[string]bool)
+	// Agents waiting for approval, or rejected, are flagged so a scan
+	// doesn't pass them off as devices to set up.
+	pending, err := s.DB.ListPendingAgents(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to list pending agents for discovery", "err", err)
+	}
+
+	ipStatus := make(map[string]string)
+	for _, p := range pending {
+		if p.IP != "" {
+			ipStatus[p.IP] = "pending"
+			if p.Rejected {
+				ipStatus[p.IP] = "rejected"
+			}
+		}
+	}
 	for _, r := range robots {
 		if r.IP != "" {
-			knownIPs[r.IP] = true
+			ipStatus[r.IP] = "enrolled"
 		}
 	}
+	statusOf := func(ip string) string {
+		if status, ok := ipStatus[ip]; ok {
+			return status
+		}
+		return "unenrolled"
+	}
 
 	onFound := func(c scan.Candidate) {
-		status := "unenrolled"
-		if knownIPs[c.IP] {
-			status = "enrolled"
-		}
-		event := map[string]interface{}{
-			"type": "scan_result",
-			"data": map[string]interface{}{
-				"ip":           c.IP,
-				"port":         c.Port,
-				"mac":          c.MAC,
-				"manufacturer": c.Manufacturer,
-				"banner":       c.Banner,
-				"status":       status,
-			},
-		}
-		s.Hub.Broadcast(event)
+		status := statusOf(c.IP)
+		s.Controller.Events.Publish(events.ScanResult{
+			IP:           c.IP,
+			Port:         c.Port,
+			MAC:          c.MAC,
+			Manufacturer: c.Manufacturer,
+			Banner:       c.Banner,
+			Status:       status,
+		})
 	}
 
+	scanStart := time.Now()
 	candidates, err := scan.ScanSubnet(onFound)
+	scanDuration.Observe(time.Since(scanStart).Seconds())
 	if err != nil {
-		log.Printf("scan failed: %v", err)
+		logging.FromContext(r.Context()).Error("scan failed", "err", err)
 		respondError(w, http.StatusInternalServerError, "scan failed")
 		return
 	}
 
-	type EnrichedCandidate struct {
-		scan.Candidate
-		Status string `json:"status"` // "enrolled", "unenrolled"
-	}
-
-	enriched := make([]EnrichedCandidate, len(candidates))
+	enriched := make([]enrichedCandidate, len(candidates))
 	for i, c := range candidates {
-		status := "unenrolled"
-		if knownIPs[c.IP] {
-			status = "enrolled"
-		}
-		enriched[i] = EnrichedCandidate{
+		enriched[i] = enrichedCandidate{
 			Candidate: c,
-			Status:    status,
+			Status:    statusOf(c.IP),
 		}
 	}
 
@@ -626,24 +1672,147 @@ func respondError(w http.ResponseWriter, status int, msg string) {
 	respondJSON(w, status, map[string]string{"error": msg})
 }
 
-func (s *Server) handleGoldenImage(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		s.Controller.GetGoldenImageConfig(w, r)
+func (s *Server) handleImageProfiles(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.Controller.ListImageProfiles(w, r)
+	case http.MethodPost:
+		s.Controller.CreateImageProfile(w, r)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (s *Server) handleImageProfile(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case strings.HasSuffix(path, "/user-data"):
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.DownloadProfileUserData(w, r)
+		return
+	case strings.HasSuffix(path, "/image"):
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.DownloadProfileImage(w, r)
+		return
+	case strings.HasSuffix(path, "/flash"):
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.FlashDevice(w, r)
 		return
 	}
-	if r.Method == http.MethodPut {
-		s.Controller.SaveGoldenImageConfig(w, r)
+	switch r.Method {
+	case http.MethodGet:
+		s.Controller.GetImageProfile(w, r)
+	case http.MethodPut:
+		s.Controller.UpdateImageProfile(w, r)
+	case http.MethodDelete:
+		s.Controller.DeleteImageProfile(w, r)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (s *Server) handleImageBuilds(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
 		return
 	}
-	methodNotAllowed(w)
+	s.Controller.ListImageBuilds(w, r)
 }
 
-func (s *Server) handleGoldenImageDownload(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleImageBuild(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case strings.HasSuffix(path, "/artifact"):
+		switch r.Method {
+		case http.MethodGet:
+			s.Controller.DownloadImageBuildArtifact(w, r)
+		case http.MethodDelete:
+			s.Controller.DeleteImageBuildArtifact(w, r)
+		default:
+			methodNotAllowed(w)
+		}
+	case strings.HasSuffix(path, "/artifact/checksum"), strings.HasSuffix(path, "/artifact/signature"):
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.DownloadImageBuildArtifact(w, r)
+	case strings.HasSuffix(path, "/cancel"):
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.CancelImageBuild(w, r)
+	case strings.HasSuffix(path, "/refresh"):
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.RefreshImageBuild(w, r)
+	default:
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+		s.Controller.GetImageBuild(w, r)
+	}
+}
+
+func (s *Server) handleImageStorage(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		methodNotAllowed(w)
 		return
 	}
-	s.Controller.DownloadGoldenImage(w, r)
+	s.Controller.GetImageStorage(w, r)
+}
+
+func (s *Server) handleImagePrune(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.PruneImages(w, r)
+}
+
+func (s *Server) handleImageCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.ClearImageCache(w, r)
+}
+
+func (s *Server) handleImagerOSList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.ImagerOSList(w, r)
+}
+
+func (s *Server) handleImageSigningKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.GetImageSigningKey(w, r)
+}
+
+func (s *Server) handleEnrollAgent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.DownloadEnrollAgent(w, r)
 }
 
 func (s *Server) handleAgentDownload(w http.ResponseWriter, r *http.Request) {
@@ -654,6 +1823,14 @@ func (s *Server) handleAgentDownload(w http.ResponseWriter, r *http.Request) {
 	s.Controller.DownloadAgentBinary(w, r)
 }
 
+func (s *Server) handleAgentInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.AgentInfo(w, r)
+}
+
 func (s *Server) handleGoldenImageBuild(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		methodNotAllowed(w)
@@ -662,6 +1839,14 @@ func (s *Server) handleGoldenImageBuild(w http.ResponseWriter, r *http.Request)
 	s.Controller.BuildGoldenImage(w, r)
 }
 
+func (s *Server) handleGoldenImageBuildCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	s.Controller.CancelBuild(w, r)
+}
+
 func (s *Server) handleGoldenImageStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		methodNotAllowed(w)
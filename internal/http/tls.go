@@ -0,0 +1,108 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsMode describes how the controller terminates TLS, based on environment:
+//
+//	TLS_CERT_FILE / TLS_KEY_FILE  serve HTTPS with the provided certificate
+//	TLS_DOMAIN                    obtain certificates via ACME (comma-separated hosts)
+//
+// With neither set the controller serves plain HTTP, which is how it runs
+// behind the bundled Traefik proxy.
+type tlsMode struct {
+	certFile string
+	keyFile  string
+	domains  []string
+}
+
+func tlsModeFromEnv() tlsMode {
+	m := tlsMode{
+		certFile: os.Getenv("TLS_CERT_FILE"),
+		keyFile:  os.Getenv("TLS_KEY_FILE"),
+	}
+	for _, d := range strings.Split(os.Getenv("TLS_DOMAIN"), ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			m.domains = append(m.domains, d)
+		}
+	}
+	return m
+}
+
+func (m tlsMode) enabled() bool {
+	return (m.certFile != "" && m.keyFile != "") || len(m.domains) > 0
+}
+
+// serveTLS starts the HTTPS listener and an HTTP listener on httpAddr that
+// redirects to it (and answers ACME HTTP-01 challenges when autocert is used).
+func (s *Server) serveTLS(m tlsMode, httpAddr string, handler http.Handler) error {
+	httpsAddr := os.Getenv("HTTPS_ADDR")
+	srv := s.newHTTPServer("", handler)
+	srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+
+	certMode := m.certFile != "" && m.keyFile != ""
+	if httpsAddr == "" {
+		// ACME answers TLS-ALPN challenges on the standard port; with a
+		// provided certificate the controller needn't bind a privileged one.
+		httpsAddr = ":443"
+		if certMode {
+			httpsAddr = ":8443"
+		}
+	}
+	srv.Addr = httpsAddr
+	var redirect http.Handler = http.HandlerFunc(redirectToHTTPS(httpsAddr))
+	if certMode {
+		go s.serveRedirect(httpAddr, redirect)
+		slog.Info("controller listening", "addr", httpsAddr, "tls", "certificate", "cert_file", m.certFile)
+		return srv.ListenAndServeTLS(m.certFile, m.keyFile)
+	}
+
+	cacheDir := os.Getenv("ACME_CACHE_DIR")
+	if cacheDir == "" {
+		cacheDir = "acme-cache"
+		if _, err := os.Stat("/data"); err == nil {
+			cacheDir = "/data/acme-cache"
+		}
+	}
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(m.domains...),
+		Cache:      autocert.DirCache(cacheDir),
+		Email:      os.Getenv("ACME_EMAIL"),
+	}
+	srv.TLSConfig = manager.TLSConfig()
+	srv.TLSConfig.MinVersion = tls.VersionTLS12
+	go s.serveRedirect(httpAddr, manager.HTTPHandler(redirect))
+	slog.Info("controller listening", "addr", httpsAddr, "tls", "acme", "domains", strings.Join(m.domains, ","))
+	return srv.ListenAndServeTLS("", "")
+}
+
+func (s *Server) serveRedirect(addr string, h http.Handler) {
+	slog.Info("controller redirecting HTTP to HTTPS", "addr", addr)
+	if err := s.newHTTPServer(addr, h).ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		slog.Error("http redirect listener", "err", err)
+	}
+}
+
+func redirectToHTTPS(httpsAddr string) func(w http.ResponseWriter, r *http.Request) {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	}
+}
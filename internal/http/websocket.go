@@ -2,8 +2,9 @@ package httpserver
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -46,7 +47,10 @@ type Client struct {
 // reads from this goroutine.
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		select {
+		case c.hub.unregister <- c:
+		case <-c.hub.quit:
+		}
 		c.conn.Close()
 	}()
 	c.conn.SetReadLimit(512)
@@ -56,7 +60,7 @@ func (c *Client) readPump() {
 		_, _, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("error: %v", err)
+				slog.Warn("websocket read", "err", err)
 			}
 			break
 		}
@@ -121,6 +125,13 @@ type Hub struct {
 
 	// Unregister requests from clients.
 	unregister chan *Client
+
+	// Stats requests, answered by Run so it stays the only reader of clients.
+	stats chan chan HubStats
+
+	// Closed when the hub shuts down.
+	quit     chan struct{}
+	quitOnce sync.Once
 }
 
 func NewHub() *Hub {
@@ -128,13 +139,22 @@ func NewHub() *Hub {
 		broadcast:  make(chan []byte),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		stats:      make(chan chan HubStats),
 		clients:    make(map[*Client]bool),
+		quit:       make(chan struct{}),
 	}
 }
 
 func (h *Hub) Run() {
 	for {
 		select {
+		case <-h.quit:
+			// Closing send makes each writePump emit a close frame and exit.
+			for client := range h.clients {
+				delete(h.clients, client)
+				close(client.send)
+			}
+			return
 		case client := <-h.register:
 			h.clients[client] = true
 		case client := <-h.unregister:
@@ -142,6 +162,12 @@ func (h *Hub) Run() {
 				delete(h.clients, client)
 				close(client.send)
 			}
+		case reply := <-h.stats:
+			st := HubStats{Clients: len(h.clients)}
+			for client := range h.clients {
+				st.Queued += len(client.send)
+			}
+			reply <- st
 		case message := <-h.broadcast:
 			for client := range h.clients {
 				select {
@@ -150,7 +176,7 @@ func (h *Hub) Run() {
 					// If the buffer is full, we drop the message instead of disconnecting the client.
 					// This prevents a burst of logs from disconnecting the user.
 					// Ideally we'd have a larger buffer or flow control, but dropping is better than disconnect.
-					log.Printf("Client buffer full, dropping message to %s", client.conn.RemoteAddr())
+					slog.Warn("websocket client buffer full, dropping message", "remote", client.conn.RemoteAddr().String())
 				}
 			}
 		}
@@ -160,12 +186,17 @@ func (h *Hub) Run() {
 func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println(err)
+		slog.Warn("websocket upgrade", "err", err)
 		return
 	}
 	// Increase buffer size to handle bursts of logs (e.g. apt-get install)
 	client := &Client{hub: h, conn: conn, send: make(chan []byte, 2048)}
-	client.hub.register <- client
+	select {
+	case client.hub.register <- client:
+	case <-h.quit:
+		conn.Close()
+		return
+	}
 
 	// Allow collection of memory referenced by the caller by doing all work in
 	// new goroutines.
@@ -176,8 +207,35 @@ func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (h *Hub) Broadcast(msg interface{}) {
 	bytes, err := json.Marshal(msg)
 	if err != nil {
-		log.Printf("failed to marshal broadcast message: %v", err)
+		slog.Error("failed to marshal broadcast message", "err", err)
 		return
 	}
-	h.broadcast <- bytes
+	select {
+	case h.broadcast <- bytes:
+	case <-h.quit:
+	}
+}
+
+// HubStats describe the connected websocket clients. Queued is the number of
+// messages waiting in their send buffers; a client that stays near its
+// buffer size is too slow and is dropping events.
+type HubStats struct {
+	Clients int `json:"clients"`
+	Queued  int `json:"queued"`
+}
+
+// Stats returns the hub's current clients and backlog.
+func (h *Hub) Stats() HubStats {
+	reply := make(chan HubStats, 1)
+	select {
+	case h.stats <- reply:
+		return <-reply
+	case <-h.quit:
+		return HubStats{}
+	}
+}
+
+// Close disconnects all websocket clients and stops the hub.
+func (h *Hub) Close() {
+	h.quitOnce.Do(func() { close(h.quit) })
 }
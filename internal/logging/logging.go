@@ -0,0 +1,72 @@
+// Package logging configures slog for the controller and agent and carries
+// request / correlation IDs through contexts so a failure on a robot can be
+// traced back to the API call that caused it.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// RequestIDHeader is accepted from callers (e.g. a reverse proxy) and echoed
+// on every API response.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// Setup installs a default slog logger tagged with component. LOG_FORMAT=json
+// switches to JSON output; LOG_LEVEL accepts debug, info, warn or error.
+// slog.SetDefault also redirects the standard log package, so output from
+// libraries that still use it goes through the same handler.
+func Setup(component string) {
+	level := slog.LevelInfo
+	switch strings.ToLower(os.Getenv("LOG_LEVEL")) {
+	case "debug":
+		level = slog.LevelDebug
+	case "warn", "warning":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "json") {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler).With("component", component))
+}
+
+// NewID returns a short random identifier for requests and commands.
+func NewID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID stores id on ctx.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID stored on ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// FromContext returns the default logger annotated with ctx's request ID.
+func FromContext(ctx context.Context) *slog.Logger {
+	if id := RequestID(ctx); id != "" {
+		return slog.Default().With("request_id", id)
+	}
+	return slog.Default()
+}
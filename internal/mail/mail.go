@@ -0,0 +1,113 @@
+// Package mail sends plain-text email through an SMTP relay.
+package mail
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config is the SMTP relay used for outgoing mail.
+type Config struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	From     string
+}
+
+// ConfigFromEnv reads SMTP_HOST, SMTP_PORT, SMTP_USER, SMTP_PASSWORD and
+// SMTP_FROM. Mail is disabled when SMTP_HOST is unset.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		User:     os.Getenv("SMTP_USER"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+	if cfg.Port == "" {
+		cfg.Port = "587"
+	}
+	if cfg.From == "" {
+		cfg.From = cfg.User
+	}
+	return cfg
+}
+
+// Enabled reports whether a relay is configured.
+func (c Config) Enabled() bool {
+	return c.Host != "" && c.From != ""
+}
+
+// Send delivers one message to every address in to. Port 465 uses implicit
+// TLS; any other port upgrades with STARTTLS when the server offers it.
+func (c Config) Send(to []string, subject, body string) error {
+	if !c.Enabled() {
+		return errors.New("SMTP is not configured")
+	}
+	if len(to) == 0 {
+		return errors.New("no recipients")
+	}
+	addr := net.JoinHostPort(c.Host, c.Port)
+	var auth smtp.Auth
+	if c.User != "" {
+		auth = smtp.PlainAuth("", c.User, c.Password, c.Host)
+	}
+	msg := c.message(to, subject, body)
+	if c.Port != "465" {
+		return smtp.SendMail(addr, auth, c.From, to, msg)
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: c.Host})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, c.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(c.From); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (c Config) message(to []string, subject, body string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", c.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,214 @@
+// Package metrics is a small registry that renders the Prometheus text
+// exposition format. It covers the handful of counters, gauges and
+// histograms the controller exports without pulling in the full client.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets suit HTTP handler latencies in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	collect []func(w io.Writer)
+}
+
+// Default is the registry served on /metrics.
+var Default = &Registry{}
+
+func (r *Registry) add(m metric) {
+	r.mu.Lock()
+	r.metrics = append(r.metrics, m)
+	r.mu.Unlock()
+}
+
+// OnScrape registers fn to emit metrics computed at scrape time, e.g. values
+// read from the database. Use WriteGauge from inside fn.
+func (r *Registry) OnScrape(fn func(w io.Writer)) {
+	r.mu.Lock()
+	r.collect = append(r.collect, fn)
+	r.mu.Unlock()
+}
+
+// Render writes every registered metric to w.
+func (r *Registry) Render(w io.Writer) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	collect := make([]func(w io.Writer), len(r.collect))
+	copy(collect, r.collect)
+	r.mu.Unlock()
+	for _, m := range metrics {
+		m.write(w)
+	}
+	for _, fn := range collect {
+		fn(w)
+	}
+}
+
+// WriteGauge emits a gauge family whose samples are keyed by a single label.
+func WriteGauge(w io.Writer, name, help, label string, values map[string]float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %s\n", name, label, k, formatFloat(values[k]))
+	}
+}
+
+type vec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func (v *vec) key(labelValues []string) string {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+func (v *vec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.kind)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, labelString(v.labels, splitKey(k, len(v.labels)), "", ""), formatFloat(v.values[k]))
+	}
+}
+
+// CounterVec is a monotonically increasing value per label set.
+type CounterVec struct{ vec }
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec{name: name, help: help, kind: "counter", labels: labels, values: map[string]float64{}}}
+	Default.add(c)
+	return c
+}
+
+func (c *CounterVec) Inc(labelValues ...string) { c.Add(1, labelValues...) }
+
+func (c *CounterVec) Add(n float64, labelValues ...string) {
+	k := c.key(labelValues)
+	c.mu.Lock()
+	c.values[k] += n
+	c.mu.Unlock()
+}
+
+type histogramData struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// HistogramVec tracks observations in cumulative buckets per label set.
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu   sync.Mutex
+	data map[string]*histogramData
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, data: map[string]*histogramData{}}
+	Default.add(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	if len(labelValues) != len(h.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", h.name, len(h.labels), len(labelValues)))
+	}
+	k := strings.Join(labelValues, "\xff")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	d, ok := h.data[k]
+	if !ok {
+		d = &histogramData{counts: make([]uint64, len(h.buckets))}
+		h.data[k] = d
+	}
+	for i, b := range h.buckets {
+		if v <= b {
+			d.counts[i]++
+		}
+	}
+	d.sum += v
+	d.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	keys := make([]string, 0, len(h.data))
+	for k := range h.data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		d := h.data[k]
+		values := splitKey(k, len(h.labels))
+		for i, b := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelString(h.labels, values, "le", formatFloat(b)), d.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelString(h.labels, values, "le", "+Inf"), d.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelString(h.labels, values, "", ""), formatFloat(d.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelString(h.labels, values, "", ""), d.count)
+	}
+}
+
+func splitKey(k string, n int) []string {
+	if n == 0 {
+		return nil
+	}
+	return strings.SplitN(k, "\xff", n)
+}
+
+func labelString(names, values []string, extraName, extraValue string) string {
+	var parts []string
+	for i, n := range names {
+		parts = append(parts, fmt.Sprintf("%s=%q", n, values[i]))
+	}
+	if extraName != "" {
+		parts = append(parts, fmt.Sprintf("%s=%q", extraName, extraValue))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -1,15 +1,46 @@
 package mqttc
 
 import (
-	"log"
+	"errors"
+	"log/slog"
 	"os"
+	"sync/atomic"
 	"time"
 
+	"example.com/openrobot-fleet/internal/metrics"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
+var publishFailures = metrics.NewCounterVec("openrobot_mqtt_publish_failures_total", "MQTT publishes that returned an error.")
+
 type Client struct {
 	Client mqtt.Client
+
+	// publishing and handling count publishes waiting for the broker's ack
+	// and received messages still in their handler. paho delivers messages
+	// one at a time, so a slow handler shows up as a growing backlog here.
+	publishing atomic.Int64
+	handling   atomic.Int64
+}
+
+// Pending is what the client has in flight: publishes not yet acknowledged
+// and messages being handled.
+type Pending struct {
+	Connected  bool  `json:"connected"`
+	Publishing int64 `json:"publishing"`
+	Handling   int64 `json:"handling"`
+}
+
+// Pending reports the client's in-flight work.
+func (c *Client) Pending() Pending {
+	if c == nil || c.Client == nil {
+		return Pending{}
+	}
+	return Pending{
+		Connected:  c.Client.IsConnected(),
+		Publishing: c.publishing.Load(),
+		Handling:   c.handling.Load(),
+	}
 }
 
 // NewClient creates a client using environment/default broker.
@@ -41,26 +72,48 @@ func NewClientWithHandler(clientID, broker string, onConnect mqtt.OnConnectHandl
 
 	c := mqtt.NewClient(opts)
 	if token := c.Connect(); token.Wait() && token.Error() != nil {
-		log.Printf("MQTT connect error: %v", token.Error())
+		slog.Error("MQTT connect failed", "broker", broker, "err", token.Error())
 	}
 	return &Client{Client: c}
 }
 
-func (c *Client) Publish(topic string, qos byte, retained bool, payload []byte) {
+// Publish sends payload and waits for it to go out (for QoS 0) or be
+// acknowledged. Failures are logged and counted as well as returned.
+func (c *Client) Publish(topic string, qos byte, retained bool, payload []byte) error {
 	if c == nil || c.Client == nil {
-		return
+		return errors.New("mqtt: no client")
 	}
+	c.publishing.Add(1)
 	token := c.Client.Publish(topic, qos, retained, payload)
 	token.Wait()
+	c.publishing.Add(-1)
+	if err := token.Error(); err != nil {
+		publishFailures.Inc()
+		slog.Error("MQTT publish failed", "topic", topic, "err", err)
+		return err
+	}
+	return nil
 }
 
 func (c *Client) Subscribe(topic string, handler mqtt.MessageHandler) {
 	if c == nil || c.Client == nil {
 		return
 	}
-	token := c.Client.Subscribe(topic, 0, handler)
+	token := c.Client.Subscribe(topic, 0, func(client mqtt.Client, msg mqtt.Message) {
+		c.handling.Add(1)
+		defer c.handling.Add(-1)
+		handler(client, msg)
+	})
 	token.Wait()
 	if token.Error() != nil {
-		log.Printf("MQTT subscribe error: %v", token.Error())
+		slog.Error("MQTT subscribe failed", "topic", topic, "err", token.Error())
+	}
+}
+
+// Disconnect waits up to quiesce for in-flight work and closes the connection.
+func (c *Client) Disconnect(quiesce time.Duration) {
+	if c == nil || c.Client == nil {
+		return
 	}
+	c.Client.Disconnect(uint(quiesce / time.Millisecond))
 }
@@ -0,0 +1,324 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// GenerateGo renders a Go client for doc: one struct per component schema
+// and one method per operation on *Client. The hand-written half of the
+// package supplies Client, doJSON and doRaw.
+func GenerateGo(doc *Document, pkg string) ([]byte, error) {
+	g := &goGen{doc: doc}
+	g.printf("// APIVersion is the controller API version this client was generated from.\n")
+	g.printf("const APIVersion = %q\n\n", doc.Info.Version)
+	for _, name := range sortedKeys(doc.Components.Schemas) {
+		g.printf("type %s %s\n\n", name, g.structType(doc.Components.Schemas[name]))
+	}
+	for _, o := range sortedOps(doc) {
+		g.operation(o.path, o.method, o.op)
+	}
+
+	body := g.buf.String()
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by openapi-gen from the controller's OpenAPI document. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\nimport (\n", pkg)
+	for _, imp := range []struct{ path, use string }{
+		{"context", "context.Context"},
+		{"encoding/json", "json."},
+		{"fmt", "fmt."},
+		{"io", "io.Read"},
+		{"net/url", "url."},
+		{"strconv", "strconv."},
+		{"time", "time.Time"},
+	} {
+		if strings.Contains(body, imp.use) {
+			fmt.Fprintf(&out, "\t%q\n", imp.path)
+		}
+	}
+	out.WriteString(")\n\n")
+	out.WriteString(body)
+	g.buf = out
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return g.buf.Bytes(), err
+	}
+	return src, nil
+}
+
+type goGen struct {
+	doc *Document
+	buf bytes.Buffer
+}
+
+func (g *goGen) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *goGen) structType(s *Schema) string {
+	if len(s.Properties) == 0 {
+		return "struct{}"
+	}
+	required := map[string]bool{}
+	for _, r := range s.Required {
+		required[r] = true
+	}
+	var b strings.Builder
+	b.WriteString("struct {\n")
+	for _, prop := range sortedKeys(s.Properties) {
+		tag := prop
+		typ := g.goType(s.Properties[prop])
+		if !required[prop] {
+			tag += ",omitempty"
+			// omitempty has no effect on structs; optional objects are pointers
+			if s.Properties[prop].Ref != "" {
+				typ = "*" + typ
+			}
+		}
+		fmt.Fprintf(&b, "\t%s %s `json:%q`\n", goName(prop), typ, tag)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func (g *goGen) goType(s *Schema) string {
+	if s.Ref != "" {
+		return s.RefName()
+	}
+	var t string
+	switch s.Type {
+	case "string":
+		switch s.Format {
+		case "date-time":
+			t = "time.Time"
+		case "byte", "binary":
+			return "[]byte"
+		default:
+			t = "string"
+		}
+	case "integer":
+		if s.Format == "int64" {
+			t = "int64"
+		} else {
+			t = "int"
+		}
+	case "number":
+		t = "float64"
+	case "boolean":
+		t = "bool"
+	case "array":
+		return "[]" + g.goType(s.Items)
+	case "object":
+		if s.AdditionalProperties != nil {
+			return "map[string]" + g.goType(s.AdditionalProperties)
+		}
+		if len(s.Properties) > 0 {
+			return g.structType(s)
+		}
+		return "map[string]interface{}"
+	default:
+		return "json.RawMessage"
+	}
+	if s.Nullable {
+		return "*" + t
+	}
+	return t
+}
+
+func (g *goGen) operation(path, method string, op *Op) {
+	name := goName(op.OperationID)
+	var args []string
+	var pathArgs []string
+	args = append(args, "ctx context.Context")
+
+	var query []Parameter
+	for _, p := range op.Parameters {
+		switch p.In {
+		case "path":
+			arg := p.Name
+			args = append(args, arg+" "+g.goType(p.Schema))
+			pathArgs = append(pathArgs, arg)
+		case "query":
+			query = append(query, p)
+		}
+	}
+	if len(query) > 0 {
+		g.printf("// %sParams holds the optional query parameters of %s.\n", name, name)
+		g.printf("type %sParams struct {\n", name)
+		for _, p := range query {
+			if p.Description != "" {
+				g.printf("\t// %s\n", p.Description)
+			}
+			g.printf("\t%s %s\n", goName(p.Name), g.goType(p.Schema))
+		}
+		g.printf("}\n\n")
+		args = append(args, "params "+name+"Params")
+	}
+
+	bodyExpr := "nil"
+	multipart := false
+	if op.RequestBody != nil {
+		if mt, ok := op.RequestBody.Content["application/json"]; ok {
+			args = append(args, "body "+g.goType(mt.Schema))
+			bodyExpr = "body"
+		} else {
+			multipart = true
+			args = append(args, "body io.Reader", "contentType string")
+		}
+	}
+
+	result, raw := "", false
+	for code, resp := range op.Responses {
+		if code == "default" {
+			continue
+		}
+		for ct, mt := range resp.Content {
+			if ct == "application/json" {
+				result = g.goType(mt.Schema)
+			} else {
+				raw = true
+			}
+		}
+	}
+
+	g.printf("// %s calls %s %s.\n", name, strings.ToUpper(method), path)
+	if op.Summary != "" {
+		g.printf("// %s.\n", op.Summary)
+	}
+	var returns string
+	switch {
+	case raw:
+		returns = "(io.ReadCloser, error)"
+	case result != "":
+		returns = "(" + result + ", error)"
+	default:
+		returns = "error"
+	}
+	g.printf("func (c *Client) %s(%s) %s {\n", name, strings.Join(args, ", "), returns)
+
+	// Path
+	pathExpr := fmt.Sprintf("%q", path)
+	if len(pathArgs) > 0 {
+		tmpl := path
+		var fmtArgs []string
+		for i, p := range PathParams(path) {
+			tmpl = strings.Replace(tmpl, "{"+p+"}", "%s", 1)
+			fmtArgs = append(fmtArgs, "url.PathEscape(fmt.Sprint("+pathArgs[i]+"))")
+		}
+		pathExpr = fmt.Sprintf("fmt.Sprintf(%q, %s)", tmpl, strings.Join(fmtArgs, ", "))
+	}
+	g.printf("\tpath := %s\n", pathExpr)
+
+	queryExpr := "nil"
+	if len(query) > 0 {
+		queryExpr = "q"
+		g.printf("\tq := url.Values{}\n")
+		for _, p := range query {
+			field := "params." + goName(p.Name)
+			switch p.Schema.Type {
+			case "integer":
+				g.printf("\tif %s != 0 {\n\t\tq.Set(%q, strconv.FormatInt(int64(%s), 10))\n\t}\n", field, p.Name, field)
+			case "boolean":
+				g.printf("\tif %s {\n\t\tq.Set(%q, \"true\")\n\t}\n", field, p.Name)
+			default:
+				g.printf("\tif %s != \"\" {\n\t\tq.Set(%q, %s)\n\t}\n", field, p.Name, field)
+			}
+		}
+	}
+
+	m := strings.ToUpper(method)
+	switch {
+	case raw && bodyExpr != "nil":
+		g.printf("\treturn c.doJSONRaw(ctx, %q, path, %s, %s)\n", m, queryExpr, bodyExpr)
+	case raw:
+		g.printf("\treturn c.doRaw(ctx, %q, path, %s, nil, \"\")\n", m, queryExpr)
+	case multipart && result != "":
+		g.printf("\tvar out %s\n", result)
+		g.printf("\trc, err := c.doRaw(ctx, %q, path, %s, body, contentType)\n", m, queryExpr)
+		g.printf("\tif err != nil {\n\t\treturn out, err\n\t}\n\tdefer rc.Close()\n")
+		g.printf("\terr = json.NewDecoder(rc).Decode(&out)\n\treturn out, err\n")
+	case multipart:
+		g.printf("\trc, err := c.doRaw(ctx, %q, path, %s, body, contentType)\n", m, queryExpr)
+		g.printf("\tif err != nil {\n\t\treturn err\n\t}\n\treturn rc.Close()\n")
+	case result != "":
+		g.printf("\tvar out %s\n", result)
+		g.printf("\terr := c.doJSON(ctx, %q, path, %s, %s, &out)\n", m, queryExpr, bodyExpr)
+		g.printf("\treturn out, err\n")
+	default:
+		g.printf("\treturn c.doJSON(ctx, %q, path, %s, %s, nil)\n", m, queryExpr, bodyExpr)
+	}
+	g.printf("}\n\n")
+}
+
+type pathOp struct {
+	path   string
+	method string
+	op     *Op
+}
+
+func sortedOps(doc *Document) []pathOp {
+	var ops []pathOp
+	for path, item := range doc.Paths {
+		for _, m := range []struct {
+			name string
+			op   *Op
+		}{{"get", item.Get}, {"post", item.Post}, {"put", item.Put}, {"patch", item.Patch}, {"delete", item.Delete}} {
+			if m.op != nil {
+				ops = append(ops, pathOp{path: path, method: m.name, op: m.op})
+			}
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].op.OperationID < ops[j].op.OperationID })
+	return ops
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Initialisms kept upper-case in generated Go names, per Go convention.
+var initialisms = map[string]bool{
+	"API": true, "HTTP": true, "ID": true, "IDS": true, "IP": true, "JPEG": true, "JSON": true, "MAC": true,
+	"MB": true, "MQTT": true, "SHA256": true, "SSH": true, "SSID": true, "URL": true, "YAML": true,
+}
+
+// goName converts snake_case or camelCase to an exported Go identifier.
+func goName(s string) string {
+	var words []string
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == '_' || r == '-' || r == '.' }) {
+		start := 0
+		runes := []rune(part)
+		for i := 1; i < len(runes); i++ {
+			if unicode.IsUpper(runes[i]) && !unicode.IsUpper(runes[i-1]) {
+				words = append(words, string(runes[start:i]))
+				start = i
+			}
+		}
+		words = append(words, string(runes[start:]))
+	}
+	var b strings.Builder
+	for _, w := range words {
+		up := strings.ToUpper(w)
+		if initialisms[up] {
+			if up == "IDS" {
+				up = "IDs"
+			}
+			b.WriteString(up)
+			continue
+		}
+		r := []rune(w)
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+	return b.String()
+}
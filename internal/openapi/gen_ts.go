@@ -0,0 +1,75 @@
+package openapi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GenerateTS renders the component schemas as TypeScript interfaces so the
+// web UI can type its API calls against the same contract as the Go client.
+func GenerateTS(doc *Document) []byte {
+	var b strings.Builder
+	b.WriteString("// Code generated by openapi-gen from the controller's OpenAPI document. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "export const API_VERSION = %q;\n", doc.Info.Version)
+	for _, name := range sortedKeys(doc.Components.Schemas) {
+		fmt.Fprintf(&b, "\nexport interface %s %s\n", name, tsObject(doc.Components.Schemas[name], ""))
+	}
+	return []byte(b.String())
+}
+
+func tsObject(s *Schema, indent string) string {
+	if len(s.Properties) == 0 {
+		return "{}"
+	}
+	required := map[string]bool{}
+	for _, r := range s.Required {
+		required[r] = true
+	}
+	var b strings.Builder
+	b.WriteString("{\n")
+	for _, prop := range sortedKeys(s.Properties) {
+		opt := "?"
+		if required[prop] {
+			opt = ""
+		}
+		fmt.Fprintf(&b, "%s  %s%s: %s;\n", indent, prop, opt, tsType(s.Properties[prop], indent+"  "))
+	}
+	b.WriteString(indent + "}")
+	return b.String()
+}
+
+func tsType(s *Schema, indent string) string {
+	if s.Ref != "" {
+		return s.RefName()
+	}
+	var t string
+	switch s.Type {
+	case "string":
+		t = "string"
+	case "integer", "number":
+		t = "number"
+	case "boolean":
+		t = "boolean"
+	case "array":
+		elem := tsType(s.Items, indent)
+		if strings.ContainsAny(elem, " |") {
+			elem = "(" + elem + ")"
+		}
+		t = elem + "[]"
+	case "object":
+		switch {
+		case s.AdditionalProperties != nil:
+			t = "Record<string, " + tsType(s.AdditionalProperties, indent) + ">"
+		case len(s.Properties) > 0:
+			t = tsObject(s, indent)
+		default:
+			t = "Record<string, unknown>"
+		}
+	default:
+		t = "unknown"
+	}
+	if s.Nullable {
+		t += " | null"
+	}
+	return t
+}
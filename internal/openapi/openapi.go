@@ -0,0 +1,336 @@
+// Package openapi builds an OpenAPI 3 document from a table of operations,
+// deriving JSON schemas from the Go types the handlers decode and encode.
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Operation describes one method on one path. Request and Response are
+// zero values of the body types (nil for none); their schemas are derived
+// by reflection.
+type Operation struct {
+	ID          string
+	Method      string
+	Path        string // e.g. /api/robots/{id}
+	Tag         string
+	Summary     string
+	Query       []Param
+	Request     interface{}
+	Response    interface{}
+	Status      int    // success status; defaults to 200
+	ContentType string // response content type when not JSON
+	Multipart   bool   // request is multipart/form-data
+	Public      bool   // no session cookie required
+}
+
+// Param is a query parameter.
+type Param struct {
+	Name        string
+	Type        string // string, integer or boolean
+	Description string
+	Required    bool
+}
+
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Paths      map[string]*PathItem  `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []map[string][]string `json:"security"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type string `json:"type"`
+	In   string `json:"in,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type PathItem struct {
+	Get    *Op `json:"get,omitempty"`
+	Post   *Op `json:"post,omitempty"`
+	Put    *Op `json:"put,omitempty"`
+	Patch  *Op `json:"patch,omitempty"`
+	Delete *Op `json:"delete,omitempty"`
+}
+
+type Op struct {
+	OperationID string                 `json:"operationId"`
+	Summary     string                 `json:"summary,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	Parameters  []Parameter            `json:"parameters,omitempty"`
+	RequestBody *RequestBody           `json:"requestBody,omitempty"`
+	Responses   map[string]*Response   `json:"responses"`
+	Security    *[]map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// RefName returns the component name a $ref points at.
+func (s *Schema) RefName() string {
+	return strings.TrimPrefix(s.Ref, "#/components/schemas/")
+}
+
+// Build assembles the document for ops.
+func Build(title, version string, ops []Operation) *Document {
+	b := &builder{schemas: map[string]*Schema{}, types: map[string]reflect.Type{}}
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info:    Info{Title: title, Version: version},
+		Paths:   map[string]*PathItem{},
+		Components: Components{
+			Schemas: b.schemas,
+			SecuritySchemes: map[string]SecurityScheme{
+				"cookieAuth": {Type: "apiKey", In: "cookie", Name: "auth_token"},
+			},
+		},
+		Security: []map[string][]string{{"cookieAuth": {}}},
+	}
+	for _, o := range ops {
+		item := doc.Paths[o.Path]
+		if item == nil {
+			item = &PathItem{}
+			doc.Paths[o.Path] = item
+		}
+		op := b.operation(o)
+		switch o.Method {
+		case "GET":
+			item.Get = op
+		case "POST":
+			item.Post = op
+		case "PUT":
+			item.Put = op
+		case "PATCH":
+			item.Patch = op
+		case "DELETE":
+			item.Delete = op
+		}
+	}
+	return doc
+}
+
+type builder struct {
+	schemas map[string]*Schema
+	types   map[string]reflect.Type
+}
+
+func (b *builder) operation(o Operation) *Op {
+	op := &Op{
+		OperationID: o.ID,
+		Summary:     o.Summary,
+		Responses:   map[string]*Response{},
+	}
+	if o.Tag != "" {
+		op.Tags = []string{o.Tag}
+	}
+	if o.Public {
+		op.Security = &[]map[string][]string{}
+	}
+	for _, name := range PathParams(o.Path) {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name: name, In: "path", Required: true,
+			Schema: PathParamSchema(name),
+		})
+	}
+	for _, q := range o.Query {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name: q.Name, In: "query", Description: q.Description, Required: q.Required,
+			Schema: &Schema{Type: q.Type},
+		})
+	}
+	if o.Multipart {
+		op.RequestBody = &RequestBody{Required: true, Content: map[string]*MediaType{
+			"multipart/form-data": {Schema: &Schema{Type: "object"}},
+		}}
+	} else if o.Request != nil {
+		op.RequestBody = &RequestBody{Required: true, Content: map[string]*MediaType{
+			"application/json": {Schema: b.schema(reflect.TypeOf(o.Request))},
+		}}
+	}
+
+	status := o.Status
+	if status == 0 {
+		status = 200
+	}
+	resp := &Response{Description: "OK"}
+	switch {
+	case o.ContentType != "":
+		resp.Content = map[string]*MediaType{o.ContentType: {Schema: &Schema{Type: "string", Format: "binary"}}}
+	case o.Response != nil:
+		resp.Content = map[string]*MediaType{"application/json": {Schema: b.schema(reflect.TypeOf(o.Response))}}
+	}
+	op.Responses[strconv.Itoa(status)] = resp
+	op.Responses["default"] = &Response{
+		Description: "Error",
+		Content: map[string]*MediaType{"application/json": {Schema: &Schema{
+			Type:       "object",
+			Properties: map[string]*Schema{"error": {Type: "string"}},
+		}}},
+	}
+	return op
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+func (b *builder) schema(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawType:
+		return &Schema{}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := b.schema(t.Elem())
+		if s.Ref != "" {
+			return s
+		}
+		s.Nullable = true
+		return s
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		name := componentName(t)
+		if prev, ok := b.types[name]; ok && prev != t {
+			panic("openapi: " + prev.String() + " and " + t.String() + " share a schema name")
+		}
+		if _, ok := b.schemas[name]; !ok {
+			// Reserve the name first so recursive types terminate
+			b.types[name] = t
+			b.schemas[name] = &Schema{}
+			*b.schemas[name] = *b.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	return &Schema{}
+}
+
+func (b *builder) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	b.addFields(s, t)
+	return s
+}
+
+func (b *builder) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				b.addFields(s, ft)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = b.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Ptr {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+func componentName(t reflect.Type) string {
+	r := []rune(t.Name())
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// PathParams returns the {name} segments of a path template in order.
+func PathParams(path string) []string {
+	var names []string
+	for _, seg := range strings.Split(path, "/") {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			names = append(names, strings.Trim(seg, "{}"))
+		}
+	}
+	return names
+}
+
+// PathParamSchema types a path parameter: database IDs are integers,
+// anything else (hostnames, names) is a string.
+func PathParamSchema(name string) *Schema {
+	if name == "id" || strings.HasSuffix(name, "_id") {
+		return &Schema{Type: "integer", Format: "int64"}
+	}
+	return &Schema{Type: "string"}
+}
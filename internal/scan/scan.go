@@ -2,7 +2,7 @@ package scan
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"os/exec"
@@ -58,7 +58,7 @@ func getARPTable() map[string]string {
 	cmd := exec.Command("arp", "-an")
 	output, err := cmd.Output()
 	if err != nil {
-		log.Printf("[scan] arp command failed: %v", err)
+		slog.Warn("scan: arp command failed", "err", err)
 		return arpTable
 	}
 
@@ -118,7 +118,7 @@ func ScanSubnet(onFound func(Candidate)) ([]Candidate, error) {
 				if !seen[base.String()] {
 					subnets = append(subnets, base)
 					seen[base.String()] = true
-					log.Printf("[scan] found local subnet: %s/24 (from %s)", base, ipv4)
+					slog.Info("scan: found local subnet", "subnet", base.String()+"/24", "from", ipv4.String())
 				}
 			}
 		}
@@ -134,7 +134,7 @@ func ScanSubnet(onFound func(Candidate)) ([]Candidate, error) {
 				// Try parsing as just an IP and assume /24
 				ip = net.ParseIP(s)
 				if ip == nil {
-					log.Printf("[scan] invalid manual subnet: %s", s)
+					slog.Warn("scan: invalid manual subnet", "subnet", s)
 					continue
 				}
 			}
@@ -146,7 +146,7 @@ func ScanSubnet(onFound func(Candidate)) ([]Candidate, error) {
 			if !seen[base.String()] {
 				subnets = append(subnets, base)
 				seen[base.String()] = true
-				log.Printf("[scan] added manual subnet: %s/24", base)
+				slog.Info("scan: added manual subnet", "subnet", base.String()+"/24")
 			}
 		}
 	}
@@ -168,7 +168,7 @@ func ScanSubnet(onFound func(Candidate)) ([]Candidate, error) {
 
 	// Scan each subnet
 	for _, baseIP := range subnets {
-		log.Printf("[scan] scanning subnet %s/24...", baseIP)
+		slog.Info("scan: scanning subnet", "subnet", baseIP.String()+"/24")
 		// Scan 1-254
 		for i := 1; i < 255; i++ {
 			// Reconstruct IP: baseIP is 16 bytes (IPv4-mapped), so bytes 12-15 are the IPv4 address
@@ -226,7 +226,7 @@ func ScanSubnet(onFound func(Candidate)) ([]Candidate, error) {
 					mu.Lock()
 					candidates = append(candidates, c)
 					mu.Unlock()
-					log.Printf("[scan] found candidate: %s (banner: %q)", targetIP, banner)
+					slog.Info("scan: found candidate", "ip", targetIP, "banner", banner)
 
 					if onFound != nil {
 						onFound(c)
@@ -238,6 +238,6 @@ func ScanSubnet(onFound func(Candidate)) ([]Candidate, error) {
 
 	wg.Wait()
 
-	log.Printf("[scan] complete. found %d candidates", len(candidates))
+	slog.Info("scan: complete", "candidates", len(candidates))
 	return candidates, nil
 }
@@ -0,0 +1,105 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
+	"example.com/openrobot-fleet/internal/selector"
+)
+
+// AutoDeploySpec re-applies the scenario when its repo is pushed to, through
+// the controller's git webhook:
+//
+//	auto_deploy:
+//	  robots: tag=classA
+//	  branches: [main, "lab-*"]
+//	  approval: true
+//
+// A robot is only redeployed by a push to the branch it checks out, so a
+// scenario whose branch is a template can serve a branch per team.
+type AutoDeploySpec struct {
+	// Robots is a selector for the robots to redeploy; by default those the
+	// scenario was last applied to.
+	Robots string `yaml:"robots,omitempty"`
+	// Branches are globs of the pushed branches that may deploy; by default
+	// any.
+	Branches []string `yaml:"branches,omitempty"`
+	// Approval holds each deploy until an admin approves it.
+	Approval bool `yaml:"approval,omitempty"`
+}
+
+func (s Spec) validateAutoDeploy() error {
+	a := s.AutoDeploy
+	if a == nil {
+		return nil
+	}
+	if strings.TrimSpace(s.Repo.URL) == "" {
+		return errors.New("auto_deploy needs a repo")
+	}
+	if s.Repo.Pinned() {
+		return errors.New("auto_deploy can't be used with a repo pinned to a tag or commit")
+	}
+	if strings.TrimSpace(a.Robots) != "" {
+		if _, err := selector.Parse(a.Robots); err != nil {
+			return fmt.Errorf("auto_deploy robots: %w", err)
+		}
+	}
+	for _, b := range a.Branches {
+		if strings.TrimSpace(b) == "" {
+			return errors.New("auto_deploy branches must not be empty")
+		}
+		if _, err := path.Match(b, ""); err != nil {
+			return fmt.Errorf("invalid auto_deploy branch pattern %q", b)
+		}
+	}
+	return nil
+}
+
+// MatchBranch reports whether a push to branch may deploy.
+func (a AutoDeploySpec) MatchBranch(branch string) bool {
+	if len(a.Branches) == 0 {
+		return true
+	}
+	for _, pattern := range a.Branches {
+		if ok, _ := path.Match(pattern, branch); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// RepoFor returns the repo, branch and path robot checks out for the
+// scenario, with templates rendered.
+func (s Spec) RepoFor(robot db.Robot) (agent.UpdateRepoData, error) {
+	s, err := s.forRobot(robot)
+	if err != nil {
+		return agent.UpdateRepoData{}, err
+	}
+	return s.Repo.ToUpdateRepo(), nil
+}
+
+// SameRepo reports whether two clone URLs name the same repository, whatever
+// the protocol: https://host/org/repo.git, ssh://git@host/org/repo and
+// git@host:org/repo all compare equal.
+func SameRepo(a, b string) bool {
+	x, y := repoKey(a), repoKey(b)
+	return x != "" && x == y
+}
+
+func repoKey(u string) string {
+	u = strings.TrimSpace(u)
+	if parsed, err := url.Parse(u); err == nil && parsed.Host != "" {
+		u = parsed.Hostname() + "/" + strings.TrimPrefix(parsed.Path, "/")
+	} else if at := strings.Index(u, "@"); at >= 0 && strings.Contains(u[at:], ":") {
+		// scp-like syntax: user@host:path
+		host, p, _ := strings.Cut(u[at+1:], ":")
+		u = host + "/" + strings.TrimPrefix(p, "/")
+	}
+	u = strings.TrimSuffix(strings.TrimSuffix(u, "/"), ".git")
+	return strings.ToLower(u)
+}
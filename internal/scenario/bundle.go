@@ -0,0 +1,100 @@
+package scenario
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"example.com/openrobot-fleet/internal/db"
+	"gopkg.in/yaml.v3"
+)
+
+// BundleVersion is the bundle format this controller writes and reads.
+const BundleVersion = 1
+
+// Bundle is a portable set of scenarios, exported from one controller and
+// imported into another (next semester's, or another school's). It is the
+// same in JSON and YAML.
+type Bundle struct {
+	Version    int              `json:"version" yaml:"version"`
+	ExportedAt time.Time        `json:"exported_at" yaml:"exported_at"`
+	Scenarios  []BundleScenario `json:"scenarios" yaml:"scenarios"`
+}
+
+// BundleScenario is one scenario in a bundle. History is only for reading:
+// its robot names mean nothing to another controller, so import ignores it.
+type BundleScenario struct {
+	Name        string        `json:"name" yaml:"name"`
+	Description string        `json:"description,omitempty" yaml:"description,omitempty"`
+	ConfigYAML  string        `json:"config_yaml" yaml:"config_yaml"`
+	History     []BundleApply `json:"history,omitempty" yaml:"history,omitempty"`
+}
+
+// BundleApply is one entry of a scenario's apply history.
+type BundleApply struct {
+	Robot     string    `json:"robot" yaml:"robot"`
+	Status    string    `json:"status,omitempty" yaml:"status,omitempty"`
+	AppliedBy string    `json:"applied_by,omitempty" yaml:"applied_by,omitempty"`
+	AppliedAt time.Time `json:"applied_at" yaml:"applied_at"`
+}
+
+// ParseBundle decodes a bundle written as YAML or JSON and checks its
+// version and scenario names. Configs are validated on import, where the
+// scenarios they extend can be looked up.
+func ParseBundle(raw string) (Bundle, error) {
+	var b Bundle
+	dec := yaml.NewDecoder(strings.NewReader(raw))
+	dec.KnownFields(true)
+	if err := dec.Decode(&b); err != nil {
+		return Bundle{}, fmt.Errorf("parse bundle: %w", err)
+	}
+	switch {
+	case b.Version == 0:
+		return Bundle{}, fmt.Errorf("not a scenario bundle (no version)")
+	case b.Version > BundleVersion:
+		return Bundle{}, fmt.Errorf("bundle version %d is newer than this controller supports (%d)", b.Version, BundleVersion)
+	}
+	seen := map[string]bool{}
+	for i, s := range b.Scenarios {
+		name := strings.TrimSpace(s.Name)
+		if name == "" {
+			return Bundle{}, fmt.Errorf("scenarios[%d]: name required", i)
+		}
+		if seen[name] {
+			return Bundle{}, fmt.Errorf("scenario %q listed twice", name)
+		}
+		seen[name] = true
+		b.Scenarios[i].Name = name
+	}
+	return b, nil
+}
+
+// WithParents returns selected and every scenario in all they extend,
+// directly or through others, with parents before the scenarios extending
+// them. An exported bundle then resolves on its own.
+func WithParents(selected, all []db.Scenario) []db.Scenario {
+	byName := make(map[string]db.Scenario, len(all))
+	for _, s := range all {
+		byName[s.Name] = s
+	}
+	var out []db.Scenario
+	added := map[string]bool{}
+	var add func(s db.Scenario)
+	add = func(s db.Scenario) {
+		if added[s.Name] {
+			return
+		}
+		// Marked before the parents so a cycle ends here.
+		added[s.Name] = true
+		if spec, err := decode(s.ConfigYAML); err == nil && spec.Extends != "" {
+			if parent, ok := byName[strings.TrimSpace(spec.Extends)]; ok {
+				add(parent)
+			}
+		}
+		out = append(out, s)
+	}
+	for _, s := range selected {
+		add(s)
+	}
+	return out
+}
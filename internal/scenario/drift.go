@@ -0,0 +1,70 @@
+package scenario
+
+import (
+	"fmt"
+	"strings"
+
+	"example.com/openrobot-fleet/internal/db"
+)
+
+// Drift lists how the workspace robot last reported differs from the repo
+// the spec clones for it. It returns nil when they match, when the spec has
+// no repo, or when the robot's agent doesn't report its workspace.
+func (s Spec) Drift(robot db.Robot) ([]string, error) {
+	ws := robot.Workspace
+	if ws == nil || strings.TrimSpace(s.Repo.URL) == "" {
+		return nil, nil
+	}
+	s, err := s.forRobot(robot)
+	if err != nil {
+		return nil, err
+	}
+	want := s.Repo.ToUpdateRepo()
+	switch {
+	case ws.Path == "":
+		return []string{"repo was never cloned"}, nil
+	case ws.Missing:
+		return []string{fmt.Sprintf("checkout %s is missing", ws.Path)}, nil
+	}
+	var reasons []string
+	if normalizeRepoURL(ws.Repo) != normalizeRepoURL(want.Repo) {
+		reasons = append(reasons, fmt.Sprintf("repo is %s, scenario wants %s", ws.Repo, want.Repo))
+	}
+	// A pinned checkout is on a detached HEAD; what matters is where.
+	switch {
+	case want.Commit != "":
+		if !strings.HasPrefix(strings.ToLower(ws.Commit), want.Commit) {
+			reasons = append(reasons, fmt.Sprintf("at commit %s, scenario pins %s", ShortCommit(ws.Commit), want.Commit))
+		}
+		if want.Tag != "" && ws.Tag != want.Tag {
+			reasons = append(reasons, fmt.Sprintf("not at tag %s", want.Tag))
+		}
+	case want.Tag != "":
+		if ws.Tag != want.Tag {
+			reasons = append(reasons, fmt.Sprintf("at commit %s, scenario pins tag %s", ShortCommit(ws.Commit), want.Tag))
+		}
+	case ws.Branch == "HEAD":
+		reasons = append(reasons, fmt.Sprintf("HEAD is detached at %s, scenario wants branch %s", ShortCommit(ws.Commit), want.Branch))
+	case ws.Branch != want.Branch:
+		reasons = append(reasons, fmt.Sprintf("on branch %s, scenario wants %s", ws.Branch, want.Branch))
+	}
+	if ws.Dirty {
+		reasons = append(reasons, "uncommitted changes in "+ws.Path)
+	}
+	return reasons, nil
+}
+
+// normalizeRepoURL ignores the differences git itself ignores, so
+// https://host/org/repo and https://host/org/repo.git compare equal.
+func normalizeRepoURL(u string) string {
+	u = strings.TrimSuffix(strings.TrimSpace(u), "/")
+	return strings.TrimSuffix(u, ".git")
+}
+
+// ShortCommit abbreviates a commit hash the way git log --oneline does.
+func ShortCommit(c string) string {
+	if len(c) > 7 {
+		return c[:7]
+	}
+	return c
+}
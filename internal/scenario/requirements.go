@@ -0,0 +1,114 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"example.com/openrobot-fleet/internal/db"
+	"gopkg.in/yaml.v3"
+)
+
+// Requirements describe the robots a scenario is meant for, checked against
+// the type and the facts their agents report. Platform and ROSDistro match
+// any of the listed values; every listed sensor must be present.
+type Requirements struct {
+	Type      string    `yaml:"type,omitempty"`
+	Platform  oneOrMany `yaml:"platform,omitempty"`
+	ROSDistro oneOrMany `yaml:"ros_distro,omitempty"`
+	Sensors   oneOrMany `yaml:"sensors,omitempty"`
+	MinDiskGB int       `yaml:"min_disk_gb,omitempty"`
+}
+
+// oneOrMany accepts a single value or a list, so "platform: turtlebot4"
+// reads as well as "platform: [turtlebot3, turtlebot4]".
+type oneOrMany []string
+
+func (o *oneOrMany) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*o = oneOrMany{node.Value}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*o = list
+	return nil
+}
+
+// merge fills any requirement r leaves unset from parent.
+func (r Requirements) merge(parent Requirements) Requirements {
+	if r.Type == "" {
+		r.Type = parent.Type
+	}
+	if len(r.Platform) == 0 {
+		r.Platform = parent.Platform
+	}
+	if len(r.ROSDistro) == 0 {
+		r.ROSDistro = parent.ROSDistro
+	}
+	if len(r.Sensors) == 0 {
+		r.Sensors = parent.Sensors
+	}
+	if r.MinDiskGB == 0 {
+		r.MinDiskGB = parent.MinDiskGB
+	}
+	return r
+}
+
+// Validate rejects requirements no robot could meet.
+func (r Requirements) Validate() error {
+	switch r.Type {
+	case "", "robot", "laptop":
+	default:
+		return fmt.Errorf("requires.type must be robot or laptop, not %q", r.Type)
+	}
+	if r.MinDiskGB < 0 {
+		return errors.New("requires.min_disk_gb must not be negative")
+	}
+	return nil
+}
+
+// needsFacts reports whether checking r needs the agent's facts.
+func (r Requirements) needsFacts() bool {
+	return len(r.Platform) > 0 || len(r.ROSDistro) > 0 || len(r.Sensors) > 0 || r.MinDiskGB > 0
+}
+
+// Unmet lists why robot doesn't meet r; empty means it does.
+func (r Requirements) Unmet(robot db.Robot) []string {
+	var reasons []string
+	if r.Type != "" && robot.Type != r.Type {
+		reasons = append(reasons, fmt.Sprintf("is a %s, needs a %s", robot.Type, r.Type))
+	}
+	if !r.needsFacts() {
+		return reasons
+	}
+	f := robot.Facts
+	if f == nil {
+		return append(reasons, "its agent hasn't reported platform, ROS distro, sensors or disk space")
+	}
+	if len(r.Platform) > 0 && !slices.Contains(r.Platform, f.Platform) {
+		reasons = append(reasons, fmt.Sprintf("platform is %s, needs %s", orUnknown(f.Platform), strings.Join(r.Platform, " or ")))
+	}
+	if len(r.ROSDistro) > 0 && !slices.Contains(r.ROSDistro, f.ROSDistro) {
+		reasons = append(reasons, fmt.Sprintf("ROS distro is %s, needs %s", orUnknown(f.ROSDistro), strings.Join(r.ROSDistro, " or ")))
+	}
+	for _, sensor := range r.Sensors {
+		if !slices.Contains(f.Sensors, sensor) {
+			reasons = append(reasons, "has no "+sensor)
+		}
+	}
+	if r.MinDiskGB > 0 && f.DiskFreeGB < r.MinDiskGB {
+		reasons = append(reasons, fmt.Sprintf("has %d GB free, needs %d GB", f.DiskFreeGB, r.MinDiskGB))
+	}
+	return reasons
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
@@ -1,29 +1,160 @@
 package scenario
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
 	"gopkg.in/yaml.v3"
 )
 
 // Spec describes declarative scenario instructions stored as YAML.
 type Spec struct {
-	Repo RepoSpec `yaml:"repo"`
+	// Extends names another scenario whose settings this one inherits.
+	Extends  string       `yaml:"extends,omitempty"`
+	Repo     RepoSpec     `yaml:"repo"`
+	Packages PackagesSpec `yaml:"packages,omitempty"`
+	// Env is exported to the build steps and the launch.
+	Env map[string]string `yaml:"env,omitempty"`
+	// Build are shell commands run in the ROS workspace after the clone,
+	// e.g. "colcon build --symlink-install".
+	Build  []string    `yaml:"build,omitempty"`
+	Launch *LaunchSpec `yaml:"launch,omitempty"`
+	// Docker deploys a container image or compose project instead of a repo.
+	Docker *DockerSpec `yaml:"docker,omitempty"`
+	// Steps, if set, replace the default order with a pipeline (see StepSpec).
+	Steps []StepSpec `yaml:"steps,omitempty"`
+	// AutoDeploy redeploys the scenario on a push to its repo. It is not
+	// inherited, so extending a scenario doesn't deploy the child too.
+	AutoDeploy *AutoDeploySpec `yaml:"auto_deploy,omitempty"`
+	// Requires limits which robots the scenario is applied to.
+	Requires Requirements `yaml:"requires,omitempty"`
+	// Vars are templates rendered for each robot (see forRobot) and usable
+	// in the other fields' templates.
+	Vars map[string]string `yaml:"vars,omitempty"`
+	// RepoAuth are the scenario's repo credentials. They are stored apart
+	// from the YAML and set by the controller before the commands are built.
+	RepoAuth *agent.RepoAuth `yaml:"-"`
+}
+
+// PackagesSpec lists packages to install before the repo is cloned. ROS
+// packages are named as in package.xml and installed from apt for the
+// robot's ROS distro.
+type PackagesSpec struct {
+	Apt []string `yaml:"apt,omitempty"`
+	ROS []string `yaml:"ros,omitempty"`
+}
+
+// LaunchSpec is the ros2 launch the robot keeps running for the scenario.
+type LaunchSpec struct {
+	Package string            `yaml:"package"`
+	File    string            `yaml:"file"`
+	Args    map[string]string `yaml:"args,omitempty"`
+}
+
+// DockerSpec is the image, or compose file, a docker scenario runs on the
+// robot. Env vars are passed to the container, or to the compose file for
+// ${VAR} interpolation.
+type DockerSpec struct {
+	Image   string `yaml:"image,omitempty"`
+	Compose string `yaml:"compose,omitempty"`
+	// Name is the container, or compose project; it defaults to
+	// defaultDockerName.
+	Name    string   `yaml:"name,omitempty"`
+	Volumes []string `yaml:"volumes,omitempty"`
+}
+
+const defaultDockerName = "openrobotfleet-app"
+
+// ToDockerDeploy builds the payload sent to agents.
+func (d DockerSpec) ToDockerDeploy(env map[string]string) agent.DockerDeployData {
+	name := d.Name
+	if name == "" {
+		name = defaultDockerName
+	}
+	return agent.DockerDeployData{Name: name, Image: d.Image, Compose: d.Compose, Env: env, Volumes: d.Volumes}
 }
 
 // RepoSpec declares which git repo/branch/path a scenario expects on a robot.
+// Tag or Commit pin the checkout to an exact version rather than the tip of
+// the branch; the agent fails the job if HEAD doesn't end up there.
 type RepoSpec struct {
 	URL    string `yaml:"url"`
 	Branch string `yaml:"branch"`
 	Path   string `yaml:"path"`
+	Tag    string `yaml:"tag,omitempty"`
+	// Commit is a full or abbreviated hash. With Branch or Tag it must be
+	// on that branch, or be what the tag points at.
+	Commit string `yaml:"commit,omitempty"`
 }
 
+// Pinned reports whether the repo is pinned to a tag or commit.
+func (r RepoSpec) Pinned() bool {
+	return strings.TrimSpace(r.Tag) != "" || strings.TrimSpace(r.Commit) != ""
+}
+
+// LookupFunc returns the raw config YAML of the scenario with the given name.
+type LookupFunc func(name string) (string, error)
+
 // Parse converts the scenario config YAML into a Spec.
 func Parse(raw string) (Spec, error) {
+	spec, err := decode(raw)
+	if err != nil {
+		return Spec{}, err
+	}
+	if err := spec.Validate(); err != nil {
+		return Spec{}, err
+	}
+	return spec, nil
+}
+
+// Resolve parses raw and merges in every scenario it extends, nearest first.
+// Fields set by a child override those inherited from its parent. A chain
+// that refers back to a scenario already visited is rejected as a cycle.
+func Resolve(name, raw string, lookup LookupFunc) (Spec, error) {
+	spec, err := decode(raw)
+	if err != nil {
+		return Spec{}, err
+	}
+	seen := map[string]bool{}
+	if name != "" {
+		seen[name] = true
+	}
+	current := spec
+	for current.Extends != "" {
+		parentName := strings.TrimSpace(current.Extends)
+		if seen[parentName] {
+			return Spec{}, fmt.Errorf("scenario inheritance cycle at %q", parentName)
+		}
+		seen[parentName] = true
+		if lookup == nil {
+			return Spec{}, fmt.Errorf("cannot resolve parent scenario %q", parentName)
+		}
+		parentRaw, err := lookup(parentName)
+		if err != nil {
+			return Spec{}, fmt.Errorf("load parent scenario %q: %w", parentName, err)
+		}
+		parent, err := decode(parentRaw)
+		if err != nil {
+			return Spec{}, fmt.Errorf("parent scenario %q: %w", parentName, err)
+		}
+		spec = spec.merge(parent)
+		current = parent
+	}
+	spec.Extends = ""
+	if err := spec.Validate(); err != nil {
+		return Spec{}, err
+	}
+	return spec, nil
+}
+
+func decode(raw string) (Spec, error) {
 	var spec Spec
 	if strings.TrimSpace(raw) == "" {
 		return spec, errors.New("scenario config is empty")
@@ -31,24 +162,178 @@ func Parse(raw string) (Spec, error) {
 	if err := yaml.Unmarshal([]byte(raw), &spec); err != nil {
 		return spec, fmt.Errorf("parse scenario config: %w", err)
 	}
-	if err := spec.Validate(); err != nil {
-		return Spec{}, err
-	}
 	return spec, nil
 }
 
+// merge fills any field left empty in s from parent. Packages add up and
+// env vars merge, with the child's value winning.
+func (s Spec) merge(parent Spec) Spec {
+	if s.Repo.URL == "" {
+		s.Repo.URL = parent.Repo.URL
+	}
+	// Branch, tag and commit say together which version to check out, so
+	// a child that sets any of them doesn't inherit the others.
+	if s.Repo.Branch == "" && !s.Repo.Pinned() {
+		s.Repo.Branch = parent.Repo.Branch
+		s.Repo.Tag = parent.Repo.Tag
+		s.Repo.Commit = parent.Repo.Commit
+	}
+	if s.Repo.Path == "" {
+		s.Repo.Path = parent.Repo.Path
+	}
+	s.Packages.Apt = union(parent.Packages.Apt, s.Packages.Apt)
+	s.Packages.ROS = union(parent.Packages.ROS, s.Packages.ROS)
+	s.Env = mergeMaps(parent.Env, s.Env)
+	s.Vars = mergeMaps(parent.Vars, s.Vars)
+	if len(s.Build) == 0 {
+		s.Build = parent.Build
+	}
+	if s.Launch == nil {
+		s.Launch = parent.Launch
+	}
+	if s.Docker == nil {
+		s.Docker = parent.Docker
+	}
+	if len(s.Steps) == 0 {
+		s.Steps = parent.Steps
+	}
+	s.Requires = s.Requires.merge(parent.Requires)
+	return s
+}
+
+// mergeMaps returns parent overlaid with child.
+func mergeMaps(parent, child map[string]string) map[string]string {
+	if len(parent) == 0 {
+		return child
+	}
+	out := maps.Clone(parent)
+	maps.Copy(out, child)
+	return out
+}
+
+func union(a, b []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, v := range append(append([]string{}, a...), b...) {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+var (
+	aptPackage = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]+$`)
+	rosPackage = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	envName    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	launchArg  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	launchName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_./-]*$`)
+	dockerName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	// dockerImage, gitTag and gitCommit are checked after templates are
+	// rendered.
+	dockerImage = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/:@-]*$`)
+	gitTag      = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._/+-]*$`)
+	gitCommit   = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+)
+
+// validateDocker checks the docker section. A docker scenario runs the
+// image as it is, so it can't also clone, build or launch.
+func (s Spec) validateDocker() error {
+	d := s.Docker
+	if s.Repo.URL != "" || len(s.Packages.Apt) > 0 || len(s.Packages.ROS) > 0 || len(s.Build) > 0 || s.Launch != nil {
+		return errors.New("a docker scenario can't also set repo, packages, build or launch")
+	}
+	if (strings.TrimSpace(d.Image) == "") == (strings.TrimSpace(d.Compose) == "") {
+		return errors.New("docker needs either an image or a compose file")
+	}
+	if d.Name != "" && !dockerName.MatchString(d.Name) {
+		return fmt.Errorf("invalid docker name %q: use lowercase letters, digits, - and _", d.Name)
+	}
+	for _, v := range d.Volumes {
+		if strings.TrimSpace(v) == "" || strings.HasPrefix(v, "-") || strings.ContainsAny(v, "\n\x00") {
+			return fmt.Errorf("invalid docker volume %q", v)
+		}
+	}
+	return nil
+}
+
 // Validate ensures required fields are populated.
 func (s Spec) Validate() error {
-	if strings.TrimSpace(s.Repo.URL) == "" {
+	if s.Docker != nil {
+		if err := s.validateDocker(); err != nil {
+			return err
+		}
+	} else if strings.TrimSpace(s.Repo.URL) == "" {
 		return errors.New("scenario repo url is required")
 	}
+	if strings.TrimSpace(s.Repo.Branch) != "" && strings.TrimSpace(s.Repo.Tag) != "" {
+		return errors.New("repo: set either a branch or a tag, not both")
+	}
+	for _, p := range s.Packages.Apt {
+		if !aptPackage.MatchString(p) {
+			return fmt.Errorf("invalid apt package %q", p)
+		}
+	}
+	for _, p := range s.Packages.ROS {
+		if !rosPackage.MatchString(p) {
+			return fmt.Errorf("invalid ROS package %q", p)
+		}
+	}
+	for k, v := range s.Env {
+		if !envName.MatchString(k) {
+			return fmt.Errorf("invalid env var name %q", k)
+		}
+		if strings.ContainsAny(v, "\n\x00") {
+			return fmt.Errorf("env var %s must be a single line", k)
+		}
+	}
+	for _, step := range s.Build {
+		if strings.TrimSpace(step) == "" {
+			return errors.New("build steps must not be empty")
+		}
+	}
+	if err := s.Requires.Validate(); err != nil {
+		return err
+	}
+	for name := range s.Vars {
+		if !envName.MatchString(name) || name == "add" || name == "mod" {
+			return fmt.Errorf("invalid var name %q", name)
+		}
+	}
+	if err := s.validateSteps(); err != nil {
+		return err
+	}
+	if err := s.validateAutoDeploy(); err != nil {
+		return err
+	}
+	if err := s.checkTemplates(); err != nil {
+		return err
+	}
+	if l := s.Launch; l != nil {
+		if l.Package == "" || l.File == "" {
+			return errors.New("launch needs a package and a file")
+		}
+		if !launchName.MatchString(l.Package) || !launchName.MatchString(l.File) {
+			return fmt.Errorf("invalid launch package %q or file %q", l.Package, l.File)
+		}
+		for k, v := range l.Args {
+			if !launchArg.MatchString(k) {
+				return fmt.Errorf("invalid launch argument %q", k)
+			}
+			if strings.ContainsAny(v, "\n\x00") {
+				return fmt.Errorf("launch argument %s must be a single line", k)
+			}
+		}
+	}
 	return nil
 }
 
-// ToUpdateRepo builds the payload sent to agents.
+// ToUpdateRepo builds the payload sent to agents. The branch defaults to
+// main unless the repo is pinned.
 func (r RepoSpec) ToUpdateRepo() agent.UpdateRepoData {
 	branch := strings.TrimSpace(r.Branch)
-	if branch == "" {
+	if branch == "" && !r.Pinned() {
 		branch = "main"
 	}
 	path := strings.TrimSpace(r.Path)
@@ -60,5 +345,27 @@ func (r RepoSpec) ToUpdateRepo() agent.UpdateRepoData {
 		Repo:   r.URL,
 		Branch: branch,
 		Path:   path,
+		Tag:    strings.TrimSpace(r.Tag),
+		Commit: strings.ToLower(strings.TrimSpace(r.Commit)),
+	}
+}
+
+// Commands builds the commands that set robot up for the scenario, in the
+// order the agent runs them (see Pipeline).
+func (s Spec) Commands(robot db.Robot) ([]agent.Command, error) {
+	cmds, _, err := s.Pipeline(robot)
+	return cmds, err
+}
+
+// BatchCommand wraps the scenario's pipeline in a single batch command.
+func (s Spec) BatchCommand(robot db.Robot) (agent.Command, error) {
+	cmds, steps, err := s.Pipeline(robot)
+	if err != nil {
+		return agent.Command{}, err
+	}
+	data, err := json.Marshal(agent.BatchData{Commands: cmds, Steps: steps})
+	if err != nil {
+		return agent.Command{}, err
 	}
+	return agent.Command{Type: "batch", Data: data}, nil
 }
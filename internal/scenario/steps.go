@@ -0,0 +1,246 @@
+package scenario
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"example.com/openrobot-fleet/internal/agent"
+	"example.com/openrobot-fleet/internal/db"
+	"gopkg.in/yaml.v3"
+)
+
+// StepSpec is one stage of a scenario pipeline. Without steps a scenario
+// runs its sections in the default order; with them it runs exactly these,
+// in this order:
+//
+//	steps:
+//	  - update_repo
+//	  - type: reset_logs
+//	    continue_on_error: true
+//	  - type: restart_ros
+//	    timeout: 2m
+//	    check: ros2 node list | grep -q /robot_state_publisher
+//	    retries: 2
+//	  - self_test
+//
+// install_packages, update_repo, build_workspace, ros_launch and
+// docker_deploy run the scenario's packages, repo, build, launch and docker
+// sections; every section the scenario sets needs its step. reset_logs,
+// restart_ros, rosdep_install, colcon_build and self_test (a two second test
+// drive) stand on their own.
+type StepSpec struct {
+	Type string `yaml:"type"`
+	// Name labels the step in the job's progress; it defaults to the type.
+	Name string `yaml:"name,omitempty"`
+	// Timeout fails the step, and the rest of the pipeline, when it runs
+	// longer, e.g. 90s or 5m.
+	Timeout string `yaml:"timeout,omitempty"`
+	// Retries is how many more times a failed step is tried.
+	Retries int `yaml:"retries,omitempty"`
+	// ContinueOnError runs the next steps even if this one fails.
+	ContinueOnError bool `yaml:"continue_on_error,omitempty"`
+	// Check is a shell command run in the ROS workspace after the step; the
+	// step only succeeds if it exits 0.
+	Check string `yaml:"check,omitempty"`
+	// Paths are the logs reset_logs clears, instead of the workspace's.
+	Paths []string `yaml:"paths,omitempty"`
+	// ParallelWorkers and PackagesSelect are passed to colcon_build.
+	ParallelWorkers int      `yaml:"parallel_workers,omitempty"`
+	PackagesSelect  []string `yaml:"packages_select,omitempty"`
+}
+
+// UnmarshalYAML accepts a bare step type as shorthand for {type: ...}.
+func (s *StepSpec) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*s = StepSpec{Type: n.Value}
+		return nil
+	}
+	type plain StepSpec
+	return n.Decode((*plain)(s))
+}
+
+const (
+	maxStepRetries = 5
+	maxStepTimeout = 2 * time.Hour
+	// maxParallelWorkers matches the agent's limit.
+	maxParallelWorkers = 64
+	// selfTestDriveSec matches the Semester Wizard's self test.
+	selfTestDriveSec = 2
+)
+
+// sectionSteps are the step types that run one of the scenario's sections.
+var sectionSteps = map[string]bool{"install_packages": true, "update_repo": true, "build_workspace": true, "ros_launch": true, "docker_deploy": true}
+
+// validateSteps checks the step list against the sections the scenario sets.
+func (s Spec) validateSteps() error {
+	if len(s.Steps) == 0 {
+		return nil
+	}
+	seen := map[string]bool{}
+	for i, st := range s.Steps {
+		label := fmt.Sprintf("steps[%d]", i)
+		switch st.Type {
+		case "install_packages", "update_repo", "build_workspace", "ros_launch", "docker_deploy", "reset_logs", "restart_ros", "rosdep_install", "colcon_build", "self_test":
+		case "":
+			return fmt.Errorf("%s: type is required", label)
+		default:
+			return fmt.Errorf("%s: unknown step type %q", label, st.Type)
+		}
+		if sectionSteps[st.Type] {
+			if seen[st.Type] {
+				return fmt.Errorf("%s: %s is listed twice", label, st.Type)
+			}
+			seen[st.Type] = true
+		}
+		if strings.ContainsAny(st.Name, "\n\x00") {
+			return fmt.Errorf("%s: name must be a single line", label)
+		}
+		if st.Timeout != "" {
+			d, err := time.ParseDuration(st.Timeout)
+			if err != nil || d <= 0 || d > maxStepTimeout {
+				return fmt.Errorf("%s: timeout must be a duration up to %s, e.g. 90s or 5m", label, maxStepTimeout)
+			}
+		}
+		if st.Retries < 0 || st.Retries > maxStepRetries {
+			return fmt.Errorf("%s: retries must be between 0 and %d", label, maxStepRetries)
+		}
+		if strings.Contains(st.Check, "\x00") {
+			return fmt.Errorf("%s: invalid check", label)
+		}
+		if len(st.Paths) > 0 && st.Type != "reset_logs" {
+			return fmt.Errorf("%s: only reset_logs takes paths", label)
+		}
+		if (st.ParallelWorkers != 0 || len(st.PackagesSelect) > 0) && st.Type != "colcon_build" {
+			return fmt.Errorf("%s: only colcon_build takes parallel_workers and packages_select", label)
+		}
+		if st.ParallelWorkers < 0 || st.ParallelWorkers > maxParallelWorkers {
+			return fmt.Errorf("%s: parallel_workers must be between 0 and %d", label, maxParallelWorkers)
+		}
+		for _, p := range st.PackagesSelect {
+			if !rosPackage.MatchString(p) {
+				return fmt.Errorf("%s: invalid package name %q", label, p)
+			}
+		}
+	}
+	for _, need := range []struct {
+		step string
+		set  bool
+	}{
+		{"install_packages", len(s.Packages.Apt) > 0 || len(s.Packages.ROS) > 0},
+		{"update_repo", s.Repo.URL != ""},
+		{"build_workspace", len(s.Build) > 0},
+		{"ros_launch", s.Launch != nil},
+		{"docker_deploy", s.Docker != nil},
+	} {
+		if need.set && !seen[need.step] {
+			return fmt.Errorf("steps must include %s", need.step)
+		}
+		if !need.set && seen[need.step] {
+			return fmt.Errorf("steps include %s, but the scenario has nothing for it to do", need.step)
+		}
+	}
+	return nil
+}
+
+// Pipeline builds the commands that set robot up for the scenario, with its
+// templates rendered for it, and how the agent should run each one. Without
+// steps it is the default order: install packages, export env vars, clone
+// the repo, build, then (re)start the launch; or, for a docker scenario,
+// deploy the image.
+func (s Spec) Pipeline(robot db.Robot) ([]agent.Command, []agent.BatchStep, error) {
+	s, err := s.forRobot(robot)
+	if err != nil {
+		return nil, nil, err
+	}
+	steps := s.Steps
+	if len(steps) == 0 {
+		for _, typ := range []string{"install_packages", "update_repo", "build_workspace", "ros_launch", "docker_deploy"} {
+			steps = append(steps, StepSpec{Type: typ})
+		}
+	}
+	// Env vars are sent whenever the build or launch could see them, even if
+	// empty, so a previous scenario's vars don't leak in. Repo-only scenarios
+	// leave them out and still work with agents that predate set_env.
+	needEnv := len(s.Env) > 0 || len(s.Build) > 0 || s.Launch != nil
+
+	var cmds []agent.Command
+	var opts []agent.BatchStep
+	add := func(typ string, data any, opt agent.BatchStep) error {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		cmds = append(cmds, agent.Command{Type: typ, Data: raw})
+		opts = append(opts, opt)
+		return nil
+	}
+	for _, st := range steps {
+		opt := agent.BatchStep{Name: st.Name, Retries: st.Retries, ContinueOnError: st.ContinueOnError, Check: st.Check}
+		if st.Timeout != "" {
+			d, _ := time.ParseDuration(st.Timeout)
+			opt.TimeoutSec = int(d.Round(time.Second) / time.Second)
+		}
+		if needEnv && (st.Type == "update_repo" || st.Type == "build_workspace" || st.Type == "rosdep_install" || st.Type == "colcon_build" || st.Type == "ros_launch") {
+			if err := add("set_env", agent.SetEnvData{Vars: s.Env}, agent.BatchStep{}); err != nil {
+				return nil, nil, err
+			}
+			needEnv = false
+		}
+		var typ string
+		var data any
+		switch st.Type {
+		case "install_packages":
+			if len(s.Packages.Apt) == 0 && len(s.Packages.ROS) == 0 {
+				continue
+			}
+			typ, data = st.Type, agent.InstallPackagesData{Apt: s.Packages.Apt, ROS: s.Packages.ROS}
+		case "update_repo":
+			if s.Repo.URL == "" {
+				continue
+			}
+			repo := s.Repo.ToUpdateRepo()
+			repo.Auth = s.RepoAuth
+			typ, data = st.Type, repo
+		case "build_workspace":
+			if len(s.Build) == 0 {
+				continue
+			}
+			typ, data = st.Type, agent.BuildWorkspaceData{Steps: s.Build}
+		case "ros_launch":
+			if s.Launch == nil {
+				continue
+			}
+			typ, data = st.Type, agent.ROSLaunchData{Package: s.Launch.Package, File: s.Launch.File, Args: s.Launch.Args}
+		case "docker_deploy":
+			if s.Docker == nil {
+				continue
+			}
+			typ, data = st.Type, s.Docker.ToDockerDeploy(s.Env)
+		case "reset_logs":
+			typ, data = st.Type, agent.ResetLogsData{Paths: st.Paths}
+		case "restart_ros":
+			typ, data = st.Type, struct{}{}
+		case "rosdep_install":
+			typ, data = st.Type, agent.RosdepInstallData{}
+		case "colcon_build":
+			typ, data = st.Type, agent.ColconBuildData{ParallelWorkers: st.ParallelWorkers, PackagesSelect: st.PackagesSelect}
+		case "self_test":
+			typ, data = "test_drive", agent.TestDriveData{DurationSec: selfTestDriveSec}
+			if opt.Name == "" {
+				opt.Name = "self_test"
+			}
+		default:
+			return nil, nil, fmt.Errorf("unknown step type %q", st.Type)
+		}
+		if err := add(typ, data, opt); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(s.Steps) == 0 {
+		// The default order needs no per-step options.
+		opts = nil
+	}
+	return cmds, opts, nil
+}
@@ -0,0 +1,198 @@
+package scenario
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"example.com/openrobot-fleet/internal/db"
+)
+
+// Scenario strings (repo fields, env values, build steps and launch
+// arguments) are Go templates rendered for each robot at apply time, so one
+// scenario can give 30 robots their own namespace or ROS domain:
+//
+//	env:
+//	  ROS_DOMAIN_ID: "{{ros_domain_id}}"
+//	launch:
+//	  args:
+//	    namespace: "/{{robot_name}}"
+//
+// Built-in variables are robot_name, robot_id, agent_id, robot_index and
+// ros_domain_id; a scenario's vars section adds its own or overrides them.
+
+// maxDomainID keeps ros_domain_id in the range every platform supports.
+const maxDomainID = 101
+
+var trailingNumber = regexp.MustCompile(`(\d+)$`)
+
+// robotIndex is the number the robot's name ends in (tb3-07 is 7), so it
+// stays the same whichever robots a scenario is applied to with it. Names
+// without one fall back to the robot's ID.
+func robotIndex(r db.Robot) int64 {
+	if m := trailingNumber.FindString(r.Name); m != "" {
+		if n, err := strconv.ParseInt(m, 10, 64); err == nil {
+			return n
+		}
+	}
+	return r.ID
+}
+
+// builtinVars are the values every template can use for r.
+func builtinVars(r db.Robot) map[string]string {
+	index := robotIndex(r)
+	return map[string]string{
+		"robot_name":    r.Name,
+		"robot_id":      strconv.FormatInt(r.ID, 10),
+		"agent_id":      r.AgentID,
+		"robot_index":   strconv.FormatInt(index, 10),
+		"ros_domain_id": strconv.FormatInt(index%(maxDomainID+1), 10),
+	}
+}
+
+// render expands one template with vars, each available as {{name}}.
+// add and mod help derive numbers, e.g. {{add robot_index 10}}.
+func render(text string, vars map[string]string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	funcs := template.FuncMap{
+		"add": func(a, b any) (int64, error) { return arith(a, b, func(x, y int64) int64 { return x + y }) },
+		"mod": func(a, b any) (int64, error) {
+			return arith(a, b, func(x, y int64) int64 {
+				if y == 0 {
+					return 0
+				}
+				return x % y
+			})
+		},
+	}
+	for name, value := range vars {
+		funcs[name] = func() string { return value }
+	}
+	tmpl, err := template.New("").Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, nil); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func arith(a, b any, op func(x, y int64) int64) (int64, error) {
+	x, err := toInt(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := toInt(b)
+	if err != nil {
+		return 0, err
+	}
+	return op(x, y), nil
+}
+
+func toInt(v any) (int64, error) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), nil
+	case int64:
+		return n, nil
+	case string:
+		return strconv.ParseInt(n, 10, 64)
+	}
+	return 0, fmt.Errorf("%v is not a number", v)
+}
+
+// forRobot returns the spec with its templates rendered for r. The scenario's
+// own vars are rendered first, from the built-in ones.
+func (s Spec) forRobot(r db.Robot) (Spec, error) {
+	vars := builtinVars(r)
+	declared := make(map[string]string, len(s.Vars))
+	for name, text := range s.Vars {
+		v, err := render(text, vars)
+		if err != nil {
+			return Spec{}, fmt.Errorf("var %s: %w", name, err)
+		}
+		declared[name] = v
+	}
+	maps.Copy(vars, declared)
+
+	out := s
+	var err error
+	field := func(name string, p *string) {
+		if err != nil {
+			return
+		}
+		var v string
+		if v, err = render(*p, vars); err != nil {
+			err = fmt.Errorf("%s: %w", name, err)
+			return
+		}
+		*p = v
+	}
+	field("repo.url", &out.Repo.URL)
+	field("repo.branch", &out.Repo.Branch)
+	field("repo.path", &out.Repo.Path)
+	field("repo.tag", &out.Repo.Tag)
+	field("repo.commit", &out.Repo.Commit)
+	if err == nil && out.Repo.Tag != "" && !gitTag.MatchString(out.Repo.Tag) {
+		err = fmt.Errorf("repo.tag: invalid tag %q", out.Repo.Tag)
+	}
+	if err == nil && out.Repo.Commit != "" && !gitCommit.MatchString(out.Repo.Commit) {
+		err = fmt.Errorf("repo.commit: %q is not a commit hash (7 to 40 hex digits)", out.Repo.Commit)
+	}
+	if s.Env != nil {
+		out.Env = maps.Clone(s.Env)
+		for k := range out.Env {
+			v := out.Env[k]
+			field("env."+k, &v)
+			out.Env[k] = v
+		}
+	}
+	out.Build = append([]string(nil), s.Build...)
+	for i := range out.Build {
+		field(fmt.Sprintf("build[%d]", i), &out.Build[i])
+	}
+	if s.Launch != nil {
+		l := *s.Launch
+		l.Args = maps.Clone(s.Launch.Args)
+		for k := range l.Args {
+			v := l.Args[k]
+			field("launch.args."+k, &v)
+			l.Args[k] = v
+		}
+		out.Launch = &l
+	}
+	if s.Docker != nil {
+		dk := *s.Docker
+		field("docker.image", &dk.Image)
+		dk.Volumes = append([]string(nil), s.Docker.Volumes...)
+		for i := range dk.Volumes {
+			field(fmt.Sprintf("docker.volumes[%d]", i), &dk.Volumes[i])
+		}
+		if err == nil && dk.Image != "" && !dockerImage.MatchString(dk.Image) {
+			err = fmt.Errorf("docker.image: invalid image %q", dk.Image)
+		}
+		out.Docker = &dk
+	}
+	out.Steps = append([]StepSpec(nil), s.Steps...)
+	for i := range out.Steps {
+		field(fmt.Sprintf("steps[%d].check", i), &out.Steps[i].Check)
+	}
+	if err != nil {
+		return Spec{}, err
+	}
+	return out, nil
+}
+
+// checkTemplates renders the spec for a sample robot, so a typo in a
+// template is reported when the scenario is saved, not when it is applied.
+func (s Spec) checkTemplates() error {
+	_, err := s.forRobot(db.Robot{ID: 1, Name: "robot-1", AgentID: "robot-1"})
+	return err
+}
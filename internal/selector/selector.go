@@ -0,0 +1,418 @@
+// Package selector parses robot selectors, a small query language for picking
+// robots by name, tag and status instead of listing IDs:
+//
+//	name~"tb4-room2-*"
+//	tag in (classA, classB) and status=online
+//	type=robot not name=~"^tb3-0[0-9]$"
+//
+// A condition is field op value. Operators are = and != (exact), ~ and !~
+// (glob with * and ?), =~ (regular expression) and in (...) for a list of
+// values, which may themselves be globs. Conditions combine with and, or, not
+// and parentheses; and binds tighter than or, and conditions written side by
+// side are and-ed. The single word all matches every robot.
+package selector
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"example.com/openrobot-fleet/internal/db"
+)
+
+// Fields lists the robot attributes a selector can test.
+var Fields = []string{"name", "id", "agent_id", "ip", "type", "status", "tag", "scenario", "version"}
+
+var fieldAliases = map[string]string{"agent": "agent_id", "tags": "tag", "agent_version": "version"}
+
+// Selector is a parsed expression.
+type Selector struct {
+	expr string
+	root node
+}
+
+// Parse compiles expr, reporting the position of the first syntax error.
+func Parse(expr string) (*Selector, error) {
+	toks, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	if p.peek().kind == tokEOF {
+		return nil, fmt.Errorf("selector is empty")
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s at position %d", t, t.pos)
+	}
+	return &Selector{expr: expr, root: root}, nil
+}
+
+func (s *Selector) String() string { return s.expr }
+
+// Match reports whether robot satisfies the selector.
+func (s *Selector) Match(robot db.Robot) bool {
+	return s.root.match(robot)
+}
+
+// Filter returns the robots that match, in their original order.
+func (s *Selector) Filter(robots []db.Robot) []db.Robot {
+	out := []db.Robot{}
+	for _, r := range robots {
+		if s.Match(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+type node interface {
+	match(db.Robot) bool
+}
+
+type andNode struct{ left, right node }
+type orNode struct{ left, right node }
+type notNode struct{ inner node }
+type allNode struct{}
+
+func (n andNode) match(r db.Robot) bool { return n.left.match(r) && n.right.match(r) }
+func (n orNode) match(r db.Robot) bool  { return n.left.match(r) || n.right.match(r) }
+func (n notNode) match(r db.Robot) bool { return !n.inner.match(r) }
+func (allNode) match(db.Robot) bool     { return true }
+
+// condNode tests one field. Multi-valued fields (tags) match when any value
+// does; negated operators hold when none does.
+type condNode struct {
+	field  string
+	negate bool
+	test   func(string) bool
+}
+
+func (n condNode) match(r db.Robot) bool {
+	hit := false
+	for _, v := range fieldValues(r, n.field) {
+		if n.test(v) {
+			hit = true
+			break
+		}
+	}
+	return hit != n.negate
+}
+
+func fieldValues(r db.Robot, field string) []string {
+	switch field {
+	case "name":
+		return []string{r.Name}
+	case "id":
+		return []string{strconv.FormatInt(r.ID, 10)}
+	case "agent_id":
+		return []string{r.AgentID}
+	case "ip":
+		return []string{r.IP}
+	case "type":
+		return []string{r.Type}
+	case "status":
+		// online is shorthand for any status other than offline/unknown.
+		if r.Status != "offline" && r.Status != "unknown" {
+			return []string{r.Status, "online"}
+		}
+		return []string{r.Status}
+	case "tag":
+		return r.Tags
+	case "scenario":
+		if r.LastScenario != nil {
+			return []string{r.LastScenario.Name}
+		}
+		return []string{""}
+	case "version":
+		return []string{r.AgentVersion}
+	}
+	return nil
+}
+
+// globRegexp turns a glob with * and ? into an anchored regular expression.
+func globRegexp(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of selector"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+func (t token) keyword(kw string) bool {
+	return t.kind == tokWord && strings.EqualFold(t.text, kw)
+}
+
+func isWordRune(r rune) bool {
+	return !unicode.IsSpace(r) && !strings.ContainsRune(`()=!~,"'`, r)
+}
+
+func lex(s string) ([]token, error) {
+	var toks []token
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			toks = append(toks, token{tokLParen, "(", i})
+			i++
+		case r == ')':
+			toks = append(toks, token{tokRParen, ")", i})
+			i++
+		case r == ',':
+			toks = append(toks, token{tokComma, ",", i})
+			i++
+		case r == '"' || r == '\'':
+			start := i
+			var b strings.Builder
+			i++
+			for i < len(runes) && runes[i] != r {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				b.WriteRune(runes[i])
+				i++
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", start)
+			}
+			i++
+			toks = append(toks, token{tokString, b.String(), start})
+		case r == '=' || r == '!' || r == '~':
+			start := i
+			op := string(r)
+			if i+1 < len(runes) && (runes[i+1] == '=' || runes[i+1] == '~') {
+				op += string(runes[i+1])
+			}
+			switch op {
+			case "=", "!=", "~", "!~", "=~":
+			default:
+				if op = string(r); op == "!" {
+					return nil, fmt.Errorf("unknown operator at position %d (use =, !=, ~, !~ or =~)", start)
+				}
+			}
+			i += len(op)
+			toks = append(toks, token{tokOp, op, start})
+		default:
+			start := i
+			for i < len(runes) && isWordRune(runes[i]) {
+				i++
+			}
+			toks = append(toks, token{tokWord, string(runes[start:i]), start})
+		}
+	}
+	return append(toks, token{tokEOF, "", len(runes)}), nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().keyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.keyword("and") {
+			p.next()
+		} else if t.keyword("or") || (t.kind != tokWord && t.kind != tokLParen) {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.peek().keyword("not") {
+		p.next()
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch {
+	case t.kind == tokLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != tokRParen {
+			return nil, fmt.Errorf("expected ) at position %d, got %s", c.pos, c)
+		}
+		return inner, nil
+	case t.keyword("all"):
+		return allNode{}, nil
+	case t.kind != tokWord:
+		return nil, fmt.Errorf("expected a field at position %d, got %s", t.pos, t)
+	}
+
+	field := strings.ToLower(t.text)
+	if alias, ok := fieldAliases[field]; ok {
+		field = alias
+	}
+	known := false
+	for _, f := range Fields {
+		known = known || f == field
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown field %q at position %d (fields: %s)", t.text, t.pos, strings.Join(Fields, ", "))
+	}
+
+	negate := false
+	if p.peek().keyword("not") {
+		p.next()
+		negate = true
+		if !p.peek().keyword("in") {
+			return nil, fmt.Errorf("expected in after not at position %d", p.peek().pos)
+		}
+	}
+	if p.peek().keyword("in") {
+		p.next()
+		return p.parseIn(field, negate)
+	}
+
+	op := p.next()
+	if op.kind != tokOp {
+		return nil, fmt.Errorf("expected an operator after %s at position %d, got %s", t.text, op.pos, op)
+	}
+	val := p.next()
+	if val.kind != tokWord && val.kind != tokString {
+		return nil, fmt.Errorf("expected a value after %s at position %d, got %s", op.text, val.pos, val)
+	}
+	switch op.text {
+	case "=":
+		return condNode{field: field, test: equals(val.text)}, nil
+	case "!=":
+		return condNode{field: field, negate: true, test: equals(val.text)}, nil
+	case "~":
+		return condNode{field: field, test: globRegexp(val.text).MatchString}, nil
+	case "!~":
+		return condNode{field: field, negate: true, test: globRegexp(val.text).MatchString}, nil
+	default: // =~
+		re, err := regexp.Compile(val.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression at position %d: %v", val.pos, err)
+		}
+		return condNode{field: field, test: re.MatchString}, nil
+	}
+}
+
+func (p *parser) parseIn(field string, negate bool) (node, error) {
+	if t := p.next(); t.kind != tokLParen {
+		return nil, fmt.Errorf("expected ( after in at position %d, got %s", t.pos, t)
+	}
+	var tests []func(string) bool
+	for {
+		v := p.next()
+		if v.kind != tokWord && v.kind != tokString {
+			return nil, fmt.Errorf("expected a value at position %d, got %s", v.pos, v)
+		}
+		if strings.ContainsAny(v.text, "*?") {
+			tests = append(tests, globRegexp(v.text).MatchString)
+		} else {
+			tests = append(tests, equals(v.text))
+		}
+		t := p.next()
+		if t.kind == tokRParen {
+			break
+		}
+		if t.kind != tokComma {
+			return nil, fmt.Errorf("expected , or ) at position %d, got %s", t.pos, t)
+		}
+	}
+	return condNode{field: field, negate: negate, test: func(s string) bool {
+		for _, test := range tests {
+			if test(s) {
+				return true
+			}
+		}
+		return false
+	}}, nil
+}
+
+func equals(want string) func(string) bool {
+	return func(s string) bool { return s == want }
+}
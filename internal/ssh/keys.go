@@ -0,0 +1,113 @@
+package sshc
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// ErrPassphraseRequired means a private key is encrypted and no passphrase
+// was given for it.
+var ErrPassphraseRequired = errors.New("private key is protected by a passphrase; set key_passphrase")
+
+// ErrWrongPassphrase means a private key's passphrase doesn't decrypt it.
+var ErrWrongPassphrase = errors.New("wrong passphrase for private key")
+
+// ParsePrivateKey parses a private key, decrypting it with passphrase if it
+// is protected by one.
+func ParsePrivateKey(key []byte, passphrase string) (ssh.Signer, error) {
+	key = bytes.TrimSpace(key)
+	signer, err := ssh.ParsePrivateKey(key)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		return signer, err
+	}
+	if passphrase == "" {
+		return nil, ErrPassphraseRequired
+	}
+	signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	if errors.Is(err, x509.IncorrectPasswordError) {
+		return nil, ErrWrongPassphrase
+	}
+	return signer, err
+}
+
+// PublicKey returns the public key of a private key in authorized_keys
+// format. Keys in OpenSSH format carry it unencrypted, so an encrypted key
+// only needs its passphrase if it is in another format.
+func PublicKey(key []byte, passphrase string) (string, error) {
+	signer, err := ParsePrivateKey(key, passphrase)
+	if err == nil {
+		return string(bytes.TrimSpace(ssh.MarshalAuthorizedKey(signer.PublicKey()))), nil
+	}
+	var missing *ssh.PassphraseMissingError
+	if _, rawErr := ssh.ParsePrivateKey(bytes.TrimSpace(key)); errors.As(rawErr, &missing) && missing.PublicKey != nil {
+		return string(bytes.TrimSpace(ssh.MarshalAuthorizedKey(missing.PublicKey))), nil
+	}
+	return "", err
+}
+
+// The controller can also sign with keys held by an SSH agent, so that key
+// material never touches the database. SSH_AGENT_SOCKET names the agent's
+// socket on the controller host; the connection is shared and redialed when
+// it breaks.
+var sshAgent struct {
+	sync.Mutex
+	conn   net.Conn
+	client agent.ExtendedAgent
+}
+
+// AgentSocket returns the SSH agent socket the controller uses, or "".
+func AgentSocket() string {
+	return os.Getenv("SSH_AGENT_SOCKET")
+}
+
+// agentSigners returns the keys the SSH agent holds, or none without one.
+func agentSigners() ([]ssh.Signer, error) {
+	sock := AgentSocket()
+	if sock == "" {
+		return nil, nil
+	}
+	sshAgent.Lock()
+	defer sshAgent.Unlock()
+	for attempt := 0; ; attempt++ {
+		if sshAgent.client == nil {
+			conn, err := net.Dial("unix", sock)
+			if err != nil {
+				return nil, fmt.Errorf("ssh agent: %w", err)
+			}
+			sshAgent.conn, sshAgent.client = conn, agent.NewClient(conn)
+		}
+		signers, err := sshAgent.client.Signers()
+		if err == nil || attempt > 0 {
+			if err != nil {
+				err = fmt.Errorf("ssh agent: %w", err)
+			}
+			return signers, err
+		}
+		// The agent may have restarted since the last login; redial once.
+		sshAgent.conn.Close()
+		sshAgent.conn, sshAgent.client = nil, nil
+	}
+}
+
+// AgentKeys returns the public keys the SSH agent holds in authorized_keys
+// format, or none without one.
+func AgentKeys() ([]string, error) {
+	signers, err := agentSigners()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(signers))
+	for _, s := range signers {
+		keys = append(keys, string(bytes.TrimSpace(ssh.MarshalAuthorizedKey(s.PublicKey()))))
+	}
+	return keys, nil
+}
@@ -0,0 +1,107 @@
+package sshc
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const agentUnit = "openrobotfleet-agent"
+
+// ProbeResult is what an SSH probe learned about a robot that stopped
+// heartbeating.
+type ProbeResult struct {
+	// Reachable is true when the host accepted a TCP connection on its SSH
+	// port, even if logging in then failed.
+	Reachable bool `json:"reachable"`
+	// LoginError is set when the host answered but authentication failed.
+	LoginError string `json:"login_error,omitempty"`
+	// HostKeyMismatch is set when the host's key isn't the one recorded for
+	// it, so it wasn't logged in to.
+	HostKeyMismatch bool `json:"host_key_mismatch,omitempty"`
+	// Uptime is the output of `uptime -p`, e.g. "up 2 hours, 5 minutes".
+	Uptime string `json:"uptime,omitempty"`
+	// AgentStatus is `systemctl is-active` for the agent unit: active,
+	// inactive, failed, activating...
+	AgentStatus string `json:"agent_status,omitempty"`
+}
+
+// Diagnosis summarises the probe for an alert, e.g. "host up 3 hours, agent
+// crashed (failed)" or "host unreachable".
+func (r ProbeResult) Diagnosis() string {
+	if !r.Reachable {
+		return "host unreachable"
+	}
+	if r.HostKeyMismatch {
+		return "host up, SSH host key changed (reset it if the robot was reflashed)"
+	}
+	if r.LoginError != "" {
+		return "host up, SSH login failed: " + r.LoginError
+	}
+	host := "host up"
+	if r.Uptime != "" {
+		host = "host " + r.Uptime
+	}
+	switch r.AgentStatus {
+	case "active":
+		return host + ", agent running but not reaching the broker (check network/MQTT)"
+	case "failed":
+		return host + ", agent crashed (failed)"
+	case "inactive":
+		return host + ", agent stopped"
+	case "activating":
+		return host + ", agent restarting"
+	case "":
+		return host + ", agent status unknown"
+	default:
+		return host + ", agent " + r.AgentStatus
+	}
+}
+
+// Probe connects to h and checks uptime and the agent service. A host that
+// refuses or drops the TCP connection is reported as unreachable with a nil
+// error; the error is only for bad input (no address, unusable key).
+func Probe(h HostSpec) (ProbeResult, error) {
+	var res ProbeResult
+	sshConfig, err := clientConfig(h)
+	if err != nil {
+		return res, err
+	}
+
+	// Dial TCP separately so "nothing listening" and "login refused" can be
+	// told apart.
+	conn, err := net.DialTimeout("tcp", h.Addr, 10*time.Second)
+	if err != nil {
+		return res, nil
+	}
+	res.Reachable = true
+	conn.SetDeadline(time.Now().Add(20 * time.Second))
+	c, chans, reqs, err := ssh.NewClientConn(conn, h.Addr, sshConfig)
+	if err != nil {
+		conn.Close()
+		res.LoginError = err.Error()
+		res.HostKeyMismatch = errors.Is(err, ErrHostKeyMismatch)
+		return res, nil
+	}
+	client := ssh.NewClient(c, chans, reqs)
+	defer client.Close()
+
+	res.Uptime = probeOutput(client, "uptime -p")
+	res.AgentStatus = probeOutput(client, "systemctl is-active "+agentUnit)
+	return res, nil
+}
+
+// probeOutput runs cmd and returns its trimmed stdout. systemctl is-active
+// exits non-zero for anything but active, so the exit status is ignored.
+func probeOutput(client *ssh.Client, cmd string) string {
+	session, err := client.NewSession()
+	if err != nil {
+		return ""
+	}
+	defer session.Close()
+	out, _ := session.Output(cmd)
+	return strings.TrimSpace(string(out))
+}
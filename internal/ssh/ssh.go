@@ -2,9 +2,11 @@ package sshc
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
@@ -17,58 +19,142 @@ import (
 )
 
 type HostSpec struct {
-	Addr         string
-	User         string
-	PrivateKey   []byte
-	Password     string
-	UseSudo      bool
-	SudoPassword string
+	Addr       string
+	User       string
+	PrivateKey []byte
+	// KeyPassphrase decrypts PrivateKey if it is protected by one.
+	KeyPassphrase string
+	Password      string
+	UseSudo       bool
+	SudoPassword  string
+	// HostKey, in authorized_keys format, is the key the host must present.
+	// Without it any key is accepted and passed to OnHostKey.
+	HostKey []byte
+	// OnHostKey, if set, is given the key of a host without a HostKey, in
+	// authorized_keys format, so that it can be required next time (trust
+	// on first use). An error from it aborts the connection.
+	OnHostKey func(key []byte) error
 }
 
-// InstallAgent uploads the agent binary/config/service and enables the unit remotely.
-func InstallAgent(h HostSpec, cfg agent.Config, agentBinary []byte) error {
+// ErrHostKeyMismatch means a host presented another key than its HostKey,
+// e.g. because it was reflashed or something else answers at its address.
+var ErrHostKeyMismatch = errors.New("ssh host key mismatch")
+
+// HostKeyFingerprint returns the SHA256 fingerprint of a key in
+// authorized_keys format, or "" if it can't be parsed.
+func HostKeyFingerprint(key []byte) string {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(key)
+	if err != nil {
+		return ""
+	}
+	return ssh.FingerprintSHA256(pub)
+}
+
+// clientConfig returns the config to log in to h with.
+func clientConfig(h HostSpec) (*ssh.ClientConfig, error) {
 	if h.Addr == "" || h.User == "" {
-		return fmt.Errorf("host addr and user required")
+		return nil, fmt.Errorf("host addr and user required")
 	}
 
+	// The client tries each method once, so the host's own key and the SSH
+	// agent's keys are offered by the same publickey method.
 	var authMethods []ssh.AuthMethod
+	var signer ssh.Signer
 	if len(h.PrivateKey) > 0 {
-		signer, err := ssh.ParsePrivateKey(bytes.TrimSpace(h.PrivateKey))
-		if err != nil {
-			return fmt.Errorf("parse private key: %w", err)
+		var err error
+		if signer, err = ParsePrivateKey(h.PrivateKey, h.KeyPassphrase); err != nil {
+			return nil, fmt.Errorf("parse private key: %w", err)
 		}
-		authMethods = append(authMethods, ssh.PublicKeys(signer))
+	}
+	if signer != nil || AgentSocket() != "" {
+		authMethods = append(authMethods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			signers, err := agentSigners()
+			if err != nil {
+				if signer == nil {
+					return nil, err
+				}
+				slog.Warn("ssh agent unavailable", "host", h.Addr, "err", err)
+			}
+			if signer != nil {
+				signers = append([]ssh.Signer{signer}, signers...)
+			}
+			return signers, nil
+		}))
 	}
 	if h.Password != "" {
 		authMethods = append(authMethods, ssh.Password(h.Password))
 	}
 	if len(authMethods) == 0 {
-		return fmt.Errorf("no auth methods provided")
+		return nil, fmt.Errorf("no auth methods provided (ssh key, password or SSH_AGENT_SOCKET)")
 	}
 
-	sshConfig := &ssh.ClientConfig{
+	hostKeyCallback, err := hostKeyCallback(h)
+	if err != nil {
+		return nil, err
+	}
+	return &ssh.ClientConfig{
 		User:            h.User,
 		Auth:            authMethods,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		HostKeyCallback: hostKeyCallback,
 		Timeout:         10 * time.Second,
+	}, nil
+}
+
+// hostKeyCallback checks the host's key against h.HostKey, or hands it to
+// h.OnHostKey if there is none yet.
+func hostKeyCallback(h HostSpec) (ssh.HostKeyCallback, error) {
+	if len(h.HostKey) == 0 {
+		return func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			if h.OnHostKey == nil {
+				return nil
+			}
+			return h.OnHostKey(ssh.MarshalAuthorizedKey(key))
+		}, nil
+	}
+	want, _, _, _, err := ssh.ParseAuthorizedKey(h.HostKey)
+	if err != nil {
+		return nil, fmt.Errorf("parse host key: %w", err)
+	}
+	return func(_ string, _ net.Addr, key ssh.PublicKey) error {
+		if !bytes.Equal(key.Marshal(), want.Marshal()) {
+			return fmt.Errorf("%w: %s presented %s, expected %s", ErrHostKeyMismatch, h.Addr, ssh.FingerprintSHA256(key), ssh.FingerprintSHA256(want))
+		}
+		return nil
+	}, nil
+}
+
+// Dial logs in to h.
+func Dial(h HostSpec) (*ssh.Client, error) {
+	sshConfig, err := clientConfig(h)
+	if err != nil {
+		return nil, err
 	}
 	client, err := ssh.Dial("tcp", h.Addr, sshConfig)
 	if err != nil {
-		return fmt.Errorf("ssh dial %s: %w", h.Addr, err)
+		return nil, fmt.Errorf("ssh dial %s: %w", h.Addr, err)
+	}
+	return client, nil
+}
+
+// InstallAgent uploads the agent binary/config/service and enables the unit remotely.
+func InstallAgent(h HostSpec, cfg agent.Config, agentBinary []byte) error {
+	client, err := Dial(h)
+	if err != nil {
+		return err
 	}
 	defer client.Close()
 
 	// If we have a private key, try to install it to authorized_keys
 	if len(h.PrivateKey) > 0 {
-		signer, err := ssh.ParsePrivateKey(bytes.TrimSpace(h.PrivateKey))
+		signer, err := ParsePrivateKey(h.PrivateKey, h.KeyPassphrase)
 		if err == nil {
 			pubKey := ssh.MarshalAuthorizedKey(signer.PublicKey())
 			// Ensure .ssh directory exists and append key
 			cmd := fmt.Sprintf("mkdir -p ~/.ssh && chmod 700 ~/.ssh && echo '%s' >> ~/.ssh/authorized_keys && chmod 600 ~/.ssh/authorized_keys", strings.TrimSpace(string(pubKey)))
 			if err := runRemote(client, cmd, "", false); err != nil {
-				log.Printf("warning: failed to install ssh key: %v", err)
+				slog.Warn("failed to install ssh key", "host", h.Addr, "err", err)
 			} else {
-				log.Printf("installed ssh key on %s", h.Addr)
+				slog.Info("installed ssh key", "host", h.Addr)
 			}
 		}
 	}
@@ -92,7 +178,7 @@ func InstallAgent(h HostSpec, cfg agent.Config, agentBinary []byte) error {
 	}
 	files := []remoteFile{
 		{dst: "/usr/local/bin/openrobotfleet-agent", mode: 0o755, data: agentBinary},
-		{dst: "/etc/openrobotfleet-agent/config.yaml", mode: 0o644, data: cfgBytes},
+		{dst: "/etc/openrobotfleet-agent/config.yaml", mode: 0o600, data: cfgBytes},
 		{dst: "/etc/systemd/system/openrobotfleet-agent.service", mode: 0o644, data: []byte(systemdUnit)},
 	}
 
@@ -134,7 +220,7 @@ func InstallAgent(h HostSpec, cfg agent.Config, agentBinary []byte) error {
 	if err := runRemote(client, script, h.SudoPassword, h.UseSudo); err != nil {
 		return fmt.Errorf("run remote command: %w", err)
 	}
-	log.Printf("installed openrobotfleet-agent on %s", h.Addr)
+	slog.Info("installed openrobotfleet-agent", "host", h.Addr)
 	return nil
 }
 
@@ -200,34 +286,9 @@ WantedBy=multi-user.target
 
 // DetectArch connects to the host and returns the architecture (amd64, arm64).
 func DetectArch(h HostSpec) (string, error) {
-	if h.Addr == "" || h.User == "" {
-		return "", fmt.Errorf("host addr and user required")
-	}
-
-	var authMethods []ssh.AuthMethod
-	if len(h.PrivateKey) > 0 {
-		signer, err := ssh.ParsePrivateKey(bytes.TrimSpace(h.PrivateKey))
-		if err != nil {
-			return "", fmt.Errorf("parse private key: %w", err)
-		}
-		authMethods = append(authMethods, ssh.PublicKeys(signer))
-	}
-	if h.Password != "" {
-		authMethods = append(authMethods, ssh.Password(h.Password))
-	}
-	if len(authMethods) == 0 {
-		return "", fmt.Errorf("no auth methods provided")
-	}
-
-	sshConfig := &ssh.ClientConfig{
-		User:            h.User,
-		Auth:            authMethods,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         10 * time.Second,
-	}
-	client, err := ssh.Dial("tcp", h.Addr, sshConfig)
+	client, err := Dial(h)
 	if err != nil {
-		return "", fmt.Errorf("ssh dial %s: %w", h.Addr, err)
+		return "", err
 	}
 	defer client.Close()
 
@@ -8,6 +8,7 @@ import { Laptops } from "./pages/Laptops";
 import { RobotDetail } from "./pages/RobotDetail";
 import { LaptopDetail } from "./pages/LaptopDetail";
 import { Scenarios } from "./pages/Scenarios";
+import { Missions } from "./pages/Missions";
 import { Settings } from "./pages/Settings";
 import { InstallAgent } from "./pages/InstallAgent";
 import { ScenarioEditor } from "./pages/ScenarioEditor";
@@ -40,6 +41,7 @@ export default function App() {
                                 <Route path="scenarios" element={<Scenarios />} />
                                 <Route path="scenarios/new" element={<ScenarioEditor />} />
                                 <Route path="scenarios/:id" element={<ScenarioEditor />} />
+                                <Route path="missions" element={<Missions />} />
                                 <Route path="settings" element={<Settings />} />
                                 <Route path="golden-image" element={<GoldenImage />} />
                             </Route>
@@ -1,4 +1,4 @@
-import { LayoutDashboard, Bot, Laptop, FileCode, Settings, Menu, GraduationCap, Disc, Languages, X } from "lucide-react";
+import { LayoutDashboard, Bot, Laptop, FileCode, Settings, Menu, GraduationCap, Disc, Languages, Route, X } from "lucide-react";
 import { useState, useEffect } from "react";
 import { Link, Outlet, useLocation } from "react-router-dom";
 import { clsx, type ClassValue } from "clsx";
@@ -6,6 +6,7 @@ import { twMerge } from "tailwind-merge";
 import { useTranslation } from "react-i18next";
 import { useKonamiCode } from "./hooks/useKonamiCode";
 import { MatrixRain } from "./components/MatrixRain";
+import { EStopBar } from "./components/EStopBar";
 
 function cn(...inputs: ClassValue[]) {
     return twMerge(clsx(inputs));
@@ -28,6 +29,7 @@ export function Layout() {
         { icon: Bot, label: t("common.robots"), path: "/robots" },
         { icon: Laptop, label: t("common.laptops"), path: "/laptops" },
         { icon: FileCode, label: t("common.scenarios"), path: "/scenarios" },
+        { icon: Route, label: t("common.missions"), path: "/missions" },
         { icon: GraduationCap, label: t("common.semesterWizard"), path: "/semester-wizard" },
         { icon: Disc, label: t("common.goldenImage"), path: "/golden-image" },
         { icon: Settings, label: t("common.settings"), path: "/settings" },
@@ -161,6 +163,7 @@ export function Layout() {
                     </button>
                 )}
                 <div className="p-4 md:p-8 max-w-7xl mx-auto relative z-10">
+                    <EStopBar />
                     <Outlet />
                 </div>
             </main>
@@ -1,14 +1,62 @@
 import {
   Robot,
   Scenario,
+  RepoAuthPayload,
   CommandRequest,
   InstallAgentPayload,
+  CreateRobotPayload,
   Job,
   InstallConfig,
   InstallDefaultsResponse,
   DiscoveryCandidate,
   GoldenImageConfig,
 } from './types';
+import type {
+  Bag,
+  BagStartRequest,
+  BagStartResponse,
+  BatteryPolicy,
+  EnrollmentSlot,
+  EnrollmentSlotRequest,
+  FleetEStopResponse,
+  FlashDeviceRequest,
+  FlashDeviceResponse,
+  FleetPositions,
+  FleetSummary,
+  HelpTopic,
+  HelpTopicRequest,
+  HostKeyResponse,
+  BuildQueuedResponse,
+  BuildStatusResponse,
+  IdentifyAssignment,
+  ImageBuild,
+  ImageProfile,
+  ImageStorage,
+  Mission,
+  MissionRequest,
+  MissionRunRequest,
+  OnboardingDefaultsRequest,
+  PendingAgent,
+  ProvisioningTokenResponse,
+  PruneImagesResponse,
+  RobotDeletion,
+  RobotSnapshot,
+  ScenarioImportRequest,
+  ScenarioImportResponse,
+  SelectorCommandResponse,
+  SemesterBatchDetail,
+  SemesterBatchSummary,
+  SemesterPreflight,
+  SemesterTemplate,
+  SensorSnapshotResponse,
+  SnapshotRunResponse,
+  SnapshotSchedule,
+  SnapshotScheduleRequest,
+  SshKeygenResponse,
+  TeleopRequest,
+  TeleopResponse,
+  UsageReport,
+} from './api.gen';
 
 const JSON_HEADERS = {
   'Content-Type': 'application/json',
@@ -62,10 +110,15 @@ export function updateRobotName(id: number | string, name: string): Promise<Robo
 export function sendCommand(
   robotId: number | string,
   command: CommandRequest,
+  onBehalfOf?: string,
 ): Promise<void> {
+  const headers: Record<string, string> = { ...JSON_HEADERS };
+  if (onBehalfOf) {
+    headers['X-On-Behalf-Of'] = onBehalfOf;
+  }
   return request<void>(`/api/robots/${robotId}/command`, {
     method: 'POST',
-    headers: JSON_HEADERS,
+    headers,
     body: JSON.stringify(command),
   });
 }
@@ -95,10 +148,19 @@ export type ScenarioPayload = Omit<Scenario, 'id'>;
 
 export interface ApplyScenarioPayload {
   robot_ids: number[];
+  force?: boolean;
+}
+
+export interface ScenarioMismatch {
+  robot_id: number;
+  name: string;
+  reasons: string[];
 }
 
 export interface ApplyScenarioResponse {
   jobs: Job[];
+  skipped?: ScenarioMismatch[];
+  warnings?: ScenarioMismatch[];
 }
 
 export function createScenario(payload: ScenarioPayload): Promise<Scenario> {
@@ -120,6 +182,23 @@ export function updateScenario(
   });
 }
 
+export function setScenarioRepoAuth(
+  id: number | string,
+  payload: RepoAuthPayload,
+): Promise<Scenario> {
+  return request<Scenario>(`/api/scenarios/${id}/repo-auth`, {
+    method: 'PUT',
+    headers: JSON_HEADERS,
+    body: JSON.stringify(payload),
+  });
+}
+
+export function deleteScenarioRepoAuth(id: number | string): Promise<Scenario> {
+  return request<Scenario>(`/api/scenarios/${id}/repo-auth`, {
+    method: 'DELETE',
+  });
+}
+
 export function deleteScenario(id: number | string): Promise<void> {
   return request<void>(`/api/scenarios/${id}`, {
     method: 'DELETE',
@@ -137,6 +216,14 @@ export function applyScenario(
   });
 }
 
+export function importScenarios(payload: ScenarioImportRequest): Promise<ScenarioImportResponse> {
+  return request<ScenarioImportResponse>('/api/scenarios/import', {
+    method: 'POST',
+    headers: JSON_HEADERS,
+    body: JSON.stringify(payload),
+  });
+}
+
 export function installAgent(payload: InstallAgentPayload): Promise<Robot> {
   return request<Robot>('/api/install-agent', {
     method: 'POST',
@@ -145,6 +232,14 @@ export function installAgent(payload: InstallAgentPayload): Promise<Robot> {
   });
 }
 
+export function createRobot(payload: CreateRobotPayload): Promise<Robot> {
+  return request<Robot>('/api/robots', {
+    method: 'POST',
+    headers: JSON_HEADERS,
+    body: JSON.stringify(payload),
+  });
+}
+
 export function saveInstallConfig(
   robotId: number | string,
   payload: InstallConfig,
@@ -160,6 +255,16 @@ export function getInstallDefaults(): Promise<InstallDefaultsResponse> {
   return request<InstallDefaultsResponse>('/api/settings/install-defaults');
 }
 
+// generateSSHKey has the controller generate the default install key; the
+// private key stays on the controller.
+export function generateSSHKey(replace: boolean): Promise<SshKeygenResponse> {
+  return request<SshKeygenResponse>('/api/settings/ssh-keygen', {
+    method: 'POST',
+    headers: JSON_HEADERS,
+    body: JSON.stringify({ replace }),
+  });
+}
+
 export function updateInstallDefaults(
   payload: InstallConfig,
 ): Promise<InstallDefaultsResponse> {
@@ -170,6 +275,36 @@ export function updateInstallDefaults(
   });
 }
 
+export function getOnboardingDefaults(): Promise<OnboardingDefaultsRequest> {
+  return request<OnboardingDefaultsRequest>('/api/settings/onboarding');
+}
+
+export function updateOnboardingDefaults(
+  payload: OnboardingDefaultsRequest,
+): Promise<OnboardingDefaultsRequest> {
+  return request<OnboardingDefaultsRequest>('/api/settings/onboarding', {
+    method: 'PUT',
+    headers: JSON_HEADERS,
+    body: JSON.stringify(payload),
+  });
+}
+
+export function getUsage(): Promise<UsageReport> {
+  return request<UsageReport>('/api/usage');
+}
+
+export function getBatteryPolicy(): Promise<BatteryPolicy> {
+  return request<BatteryPolicy>('/api/settings/battery-policy');
+}
+
+export function updateBatteryPolicy(policy: BatteryPolicy): Promise<BatteryPolicy> {
+  return request<BatteryPolicy>('/api/settings/battery-policy', {
+    method: 'PUT',
+    headers: JSON_HEADERS,
+    body: JSON.stringify(policy),
+  });
+}
+
 export function updateRobotTags(
   robotId: number | string,
   tags: string[],
@@ -200,6 +335,8 @@ export interface SemesterRequest {
   };
   apply_scenarios?: boolean;
   scenario_ids?: number[];
+  // template_id runs a saved template's steps instead of the flags above.
+  template_id?: number;
 }
 
 export function startSemesterBatch(req: SemesterRequest): Promise<void> {
@@ -211,38 +348,364 @@ export function startSemesterBatch(req: SemesterRequest): Promise<void> {
 }
 
 export interface SemesterStatus {
+  id?: number;
   active: boolean;
+  // state is running, paused, cancelled or completed; a paused batch is
+  // still active until its robots finish their current step.
+  state?: string;
   total: number;
   completed: number;
   robots: Record<number, string>;
   errors: Record<number, string>;
 }
 
+export function getFleetPositions(frame?: string): Promise<FleetPositions> {
+  const query = frame ? `?frame=${encodeURIComponent(frame)}` : '';
+  return request<FleetPositions>(`/api/fleet/positions${query}`);
+}
+
+export function getFleetSummary(): Promise<FleetSummary> {
+  return request<FleetSummary>('/api/fleet/summary');
+}
+
+export function getFleetEStop(): Promise<FleetEStopResponse> {
+  return request<FleetEStopResponse>('/api/fleet/estop');
+}
+
+export function engageFleetEStop(reason = ''): Promise<FleetEStopResponse> {
+  return request<FleetEStopResponse>('/api/fleet/estop', {
+    method: 'POST',
+    headers: JSON_HEADERS,
+    body: JSON.stringify({ reason }),
+  });
+}
+
+export function clearFleetEStop(): Promise<FleetEStopResponse> {
+  return request<FleetEStopResponse>('/api/fleet/estop', {
+    method: 'DELETE',
+  });
+}
+
+export function getHelpTopic(key: string): Promise<HelpTopic> {
+  return request<HelpTopic>(`/api/help/${encodeURIComponent(key)}`);
+}
+
+export function updateHelpTopic(key: string, payload: HelpTopicRequest): Promise<HelpTopic> {
+  return request<HelpTopic>(`/api/help/${encodeURIComponent(key)}`, {
+    method: 'PUT',
+    headers: JSON_HEADERS,
+    body: JSON.stringify(payload),
+  });
+}
+
+export function resetHelpTopic(key: string): Promise<HelpTopic> {
+  return request<HelpTopic>(`/api/help/${encodeURIComponent(key)}`, {
+    method: 'DELETE',
+  });
+}
+
+export function listMissions(): Promise<Mission[]> {
+  return request<Mission[]>('/api/missions');
+}
+
+export function createMission(payload: MissionRequest): Promise<Mission> {
+  return request<Mission>('/api/missions', {
+    method: 'POST',
+    headers: JSON_HEADERS,
+    body: JSON.stringify(payload),
+  });
+}
+
+export function updateMission(id: number, payload: MissionRequest): Promise<Mission> {
+  return request<Mission>(`/api/missions/${id}`, {
+    method: 'PUT',
+    headers: JSON_HEADERS,
+    body: JSON.stringify(payload),
+  });
+}
+
+export function deleteMission(id: number): Promise<void> {
+  return request<void>(`/api/missions/${id}`, {
+    method: 'DELETE',
+  });
+}
+
+export function runMission(id: number, payload: MissionRunRequest): Promise<SelectorCommandResponse> {
+  return request<SelectorCommandResponse>(`/api/missions/${id}/run`, {
+    method: 'POST',
+    headers: JSON_HEADERS,
+    body: JSON.stringify(payload),
+  });
+}
+
+export function listSnapshotSchedules(): Promise<SnapshotSchedule[]> {
+  return request<SnapshotSchedule[]>('/api/snapshot-schedules');
+}
+
+export function createSnapshotSchedule(payload: SnapshotScheduleRequest): Promise<SnapshotSchedule> {
+  return request<SnapshotSchedule>('/api/snapshot-schedules', {
+    method: 'POST',
+    headers: JSON_HEADERS,
+    body: JSON.stringify(payload),
+  });
+}
+
+export function updateSnapshotSchedule(id: number, payload: SnapshotScheduleRequest): Promise<SnapshotSchedule> {
+  return request<SnapshotSchedule>(`/api/snapshot-schedules/${id}`, {
+    method: 'PUT',
+    headers: JSON_HEADERS,
+    body: JSON.stringify(payload),
+  });
+}
+
+export function deleteSnapshotSchedule(id: number): Promise<void> {
+  return request<void>(`/api/snapshot-schedules/${id}`, {
+    method: 'DELETE',
+  });
+}
+
+export function runSnapshotSchedule(id: number): Promise<SnapshotRunResponse> {
+  return request<SnapshotRunResponse>(`/api/snapshot-schedules/${id}/run`, {
+    method: 'POST',
+  });
+}
+
+// listRobotSnapshots returns a robot's snapshots, newest first; pass the
+// oldest id shown as before to page back.
+export function listRobotSnapshots(robotId: number, before?: number): Promise<RobotSnapshot[]> {
+  const query = before ? `?before=${before}` : '';
+  return request<RobotSnapshot[]>(`/api/robots/${robotId}/snapshots${query}`);
+}
+
+export function takeRobotSnapshot(robotId: number): Promise<RobotSnapshot> {
+  return request<RobotSnapshot>(`/api/robots/${robotId}/snapshots`, {
+    method: 'POST',
+  });
+}
+
+export function listRobotBags(robotId: number): Promise<Bag[]> {
+  return request<Bag[]>(`/api/robots/${robotId}/bags`);
+}
+
+export function startBags(payload: BagStartRequest): Promise<BagStartResponse> {
+  return request<BagStartResponse>('/api/bags', {
+    method: 'POST',
+    headers: JSON_HEADERS,
+    body: JSON.stringify(payload),
+  });
+}
+
+export function stopBag(id: number): Promise<void> {
+  return request<void>(`/api/bags/${id}/stop`, {
+    method: 'POST',
+  });
+}
+
+export function deleteBag(id: number): Promise<void> {
+  return request<void>(`/api/bags/${id}`, {
+    method: 'DELETE',
+  });
+}
+
+export function listEnrollmentPool(): Promise<EnrollmentSlot[]> {
+  return request<EnrollmentSlot[]>('/api/enrollment/pool');
+}
+
+export function createEnrollmentSlot(payload: EnrollmentSlotRequest): Promise<EnrollmentSlot> {
+  return request<EnrollmentSlot>('/api/enrollment/pool', {
+    method: 'POST',
+    headers: JSON_HEADERS,
+    body: JSON.stringify(payload),
+  });
+}
+
+export function deleteEnrollmentSlot(id: number): Promise<void> {
+  return request<void>(`/api/enrollment/pool/${id}`, {
+    method: 'DELETE',
+  });
+}
+
+export function resetEnrollmentSlot(id: number): Promise<EnrollmentSlot> {
+  return request<EnrollmentSlot>(`/api/enrollment/pool/${id}/reset`, {
+    method: 'POST',
+  });
+}
+
+export function getProvisioningToken(): Promise<ProvisioningTokenResponse> {
+  return request<ProvisioningTokenResponse>('/api/enrollment/token');
+}
+
+export function rotateProvisioningToken(): Promise<ProvisioningTokenResponse> {
+  return request<ProvisioningTokenResponse>('/api/enrollment/token/rotate', {
+    method: 'POST',
+  });
+}
+
+export function listPendingAgents(): Promise<PendingAgent[]> {
+  return request<PendingAgent[]>('/api/robots/pending');
+}
+
+export function approvePendingAgent(agentId: string, name?: string): Promise<Robot> {
+  return request<Robot>(`/api/robots/pending/${encodeURIComponent(agentId)}/approve`, {
+    method: 'POST',
+    headers: JSON_HEADERS,
+    body: JSON.stringify({ name }),
+  });
+}
+
+export function rejectPendingAgent(agentId: string): Promise<void> {
+  return request<void>(`/api/robots/pending/${encodeURIComponent(agentId)}/reject`, {
+    method: 'POST',
+  });
+}
+
 export function getSemesterStatus(): Promise<SemesterStatus> {
   return request<SemesterStatus>('/api/semester/status');
 }
 
-export function getGoldenImageConfig(): Promise<{ config: GoldenImageConfig }> {
-  return request<{ config: GoldenImageConfig }>('/api/golden-image');
+export function preflightSemesterBatch(req: SemesterRequest): Promise<SemesterPreflight> {
+  return request<SemesterPreflight>('/api/semester/preflight', {
+    method: 'POST',
+    headers: JSON_HEADERS,
+    body: JSON.stringify(req),
+  });
+}
+
+export function listSemesterBatches(limit = 20): Promise<SemesterBatchSummary[]> {
+  return request<SemesterBatchSummary[]>(`/api/semester/batches?limit=${limit}`);
+}
+
+export function getSemesterBatch(id: number): Promise<SemesterBatchDetail> {
+  return request<SemesterBatchDetail>(`/api/semester/batches/${id}`);
+}
+
+export function listSemesterTemplates(): Promise<SemesterTemplate[]> {
+  return request<SemesterTemplate[]>('/api/semester/templates');
+}
+
+export function pauseSemesterBatch(): Promise<SemesterStatus> {
+  return request<SemesterStatus>('/api/semester/pause', {
+    method: 'POST',
+  });
+}
+
+export function resumeSemesterBatch(): Promise<SemesterStatus> {
+  return request<SemesterStatus>('/api/semester/resume', {
+    method: 'POST',
+  });
+}
+
+export function cancelSemesterBatch(): Promise<SemesterStatus> {
+  return request<SemesterStatus>('/api/semester/cancel', {
+    method: 'POST',
+  });
+}
+
+// ImageProfilePayload is an image profile as created or saved. The config
+// uses the dashboard's own GoldenImageConfig so the editor can bind to it.
+export interface ImageProfilePayload {
+  name: string;
+  description?: string;
+  config: GoldenImageConfig;
+}
+
+export function listImageProfiles(): Promise<ImageProfile[]> {
+  return request<ImageProfile[]>('/api/image-profiles');
+}
+
+export function createImageProfile(payload: ImageProfilePayload): Promise<ImageProfile> {
+  return request<ImageProfile>('/api/image-profiles', {
+    method: 'POST',
+    headers: JSON_HEADERS,
+    body: JSON.stringify(payload),
+  });
 }
 
-export function saveGoldenImageConfig(config: GoldenImageConfig): Promise<{ config: GoldenImageConfig }> {
-  return request<{ config: GoldenImageConfig }>('/api/golden-image', {
+export function updateImageProfile(id: number, payload: ImageProfilePayload): Promise<ImageProfile> {
+  return request<ImageProfile>(`/api/image-profiles/${id}`, {
     method: 'PUT',
     headers: JSON_HEADERS,
-    body: JSON.stringify(config),
+    body: JSON.stringify(payload),
+  });
+}
+
+export function deleteImageProfile(id: number): Promise<void> {
+  return request<void>(`/api/image-profiles/${id}`, {
+    method: 'DELETE',
   });
 }
 
-export function buildGoldenImage(): Promise<{ status: string }> {
-  return request<{ status: string }>('/api/golden-image/build', {
+// deleteImageBuildArtifact deletes the image a build wrote; the build stays
+// in the history.
+export function deleteImageBuildArtifact(id: number): Promise<void> {
+  return request<void>(`/api/golden-image/builds/${id}/artifact`, {
+    method: 'DELETE',
+  });
+}
+
+export function getImageStorage(): Promise<ImageStorage> {
+  return request<ImageStorage>('/api/golden-image/storage');
+}
+
+// pruneImages deletes each profile's images beyond the number it keeps.
+export function pruneImages(): Promise<PruneImagesResponse> {
+  return request<PruneImagesResponse>('/api/golden-image/prune', {
+    method: 'POST',
+  });
+}
+
+// flashImageProfileDevice registers a robot, unless it already is, and
+// returns user-data for a card that boots as that robot.
+export function flashImageProfileDevice(id: number, payload: FlashDeviceRequest): Promise<FlashDeviceResponse> {
+  return request<FlashDeviceResponse>(`/api/image-profiles/${id}/flash`, {
     method: 'POST',
     headers: JSON_HEADERS,
+    body: JSON.stringify(payload),
+  });
+}
+
+// buildGoldenImage queues a build of a profile, which starts straight away
+// unless another build is running. fromCache retries with the cached base
+// image, without checking the upstream hash.
+export function buildGoldenImage(profileId: number, fromCache = false): Promise<BuildQueuedResponse> {
+  return request<BuildQueuedResponse>(`/api/golden-image/build?profile_id=${profileId}${fromCache ? '&from_cache=true' : ''}`, {
+    method: 'POST',
+    headers: JSON_HEADERS,
+  });
+}
+
+// cancelBuild stops a running build, the only one if buildId is left out;
+// its status becomes cancelled once the controller has cleaned up.
+export function cancelBuild(buildId?: number): Promise<{ status: string }> {
+  const q = buildId ? `?build_id=${buildId}` : '';
+  return request<{ status: string }>(`/api/golden-image/build/cancel${q}`, {
+    method: 'POST',
+  });
+}
+
+export function getBuildStatus(buildId?: number): Promise<BuildStatusResponse> {
+  const q = buildId ? `?build_id=${buildId}` : '';
+  return request<BuildStatusResponse>(`/api/golden-image/status${q}`);
+}
+
+export function listImageBuilds(limit = 20): Promise<ImageBuild[]> {
+  return request<ImageBuild[]>(`/api/golden-image/builds?limit=${limit}`);
+}
+
+// refreshImageBuild queues a build that rewrites the image build id wrote
+// with the current agent binary and user-data, without reinstalling ROS.
+export function refreshImageBuild(id: number): Promise<BuildQueuedResponse> {
+  return request<BuildQueuedResponse>(`/api/golden-image/builds/${id}/refresh`, {
+    method: 'POST',
   });
 }
 
-export function getBuildStatus(): Promise<{ status: string; error?: string; progress?: number; step?: string; logs?: string[]; image_name?: string }> {
-  return request('/api/golden-image/status');
+// cancelImageBuild takes a queued build off the queue, or cancels the
+// running one.
+export function cancelImageBuild(id: number): Promise<{ status: string }> {
+  return request<{ status: string }>(`/api/golden-image/builds/${id}/cancel`, {
+    method: 'POST',
+  });
 }
 
 export interface SystemConfig {
@@ -253,15 +716,100 @@ export function getSystemConfig(): Promise<SystemConfig> {
   return request<SystemConfig>('/api/settings/system');
 }
 
-export function deleteRobot(id: number | string): Promise<void> {
-  return request<void>(`/api/robots/${id}`, {
+export function deleteRobot(id: number | string, purge = false): Promise<RobotDeletion> {
+  const query = purge ? '?purge=true' : '';
+  return request<RobotDeletion>(`/api/robots/${id}${query}`, {
     method: 'DELETE',
   });
 }
 
-export function identifyAll(): Promise<Record<number, string>> {
-  return request<Record<number, string>>('/api/robots/identify-all', {
+export function restoreRobot(id: number | string): Promise<Robot> {
+  return request<Robot>(`/api/robots/${id}/restore`, {
+    method: 'POST',
+  });
+}
+
+export function rollbackDocker(id: number | string): Promise<Job> {
+  return request<Job>(`/api/robots/${id}/docker/rollback`, {
+    method: 'POST',
+  });
+}
+
+export function identifyAll(): Promise<Record<number, IdentifyAssignment>> {
+  return request<Record<number, IdentifyAssignment>>('/api/robots/identify-all', {
+    method: 'POST',
+    headers: JSON_HEADERS,
+  });
+}
+
+export interface SpeedTest {
+  id: number;
+  robot_id: number;
+  size_bytes: number;
+  download_mbps: number;
+  upload_mbps: number;
+  created_at: string;
+}
+
+export function startSpeedTest(robotId: number | string, sizeMB?: number): Promise<Job> {
+  return request<Job>(`/api/robots/${robotId}/speedtest`, {
     method: 'POST',
     headers: JSON_HEADERS,
+    body: JSON.stringify({ size_mb: sizeMB ?? 0 }),
   });
 }
+
+export function getRobotHostKey(robotId: number | string): Promise<HostKeyResponse> {
+  return request<HostKeyResponse>(`/api/robots/${robotId}/host-key`);
+}
+
+export function resetRobotHostKey(robotId: number | string): Promise<void> {
+  return request<void>(`/api/robots/${robotId}/host-key`, {
+    method: 'DELETE',
+  });
+}
+
+export function getSpeedTests(robotId: number | string): Promise<SpeedTest[]> {
+  return request<SpeedTest[]>(`/api/robots/${robotId}/speedtest`);
+}
+
+// startTeleop hands the robot a WebRTC offer and resolves with its answer
+// once the robot's peer is up (up to ~40s).
+export function startTeleop(robotId: number | string, body: TeleopRequest): Promise<TeleopResponse> {
+  return request<TeleopResponse>(`/api/robots/${robotId}/teleop`, {
+    method: 'POST',
+    headers: JSON_HEADERS,
+    body: JSON.stringify(body),
+  });
+}
+
+export function stopTeleop(robotId: number | string, session?: string): Promise<Job> {
+  const query = session ? `?session=${encodeURIComponent(session)}` : '';
+  return request<Job>(`/api/robots/${robotId}/teleop${query}`, {
+    method: 'DELETE',
+  });
+}
+
+// getSensorSnapshot blocks until the robot reports one lidar scan, camera
+// frame and odometry reading (up to ~30s).
+export function getSensorSnapshot(robotId: number | string): Promise<SensorSnapshotResponse> {
+  return request<SensorSnapshotResponse>(`/api/robots/${robotId}/sensors`, {
+    method: 'POST',
+    headers: JSON_HEADERS,
+    body: JSON.stringify({}),
+  });
+}
+
+export interface AgentBinary {
+  arch: string;
+  filename: string;
+  version: string;
+  build_date: string;
+  go_version?: string;
+  sha256: string;
+  size: number;
+}
+
+export function getAgentInfo(): Promise<{ binaries: AgentBinary[] }> {
+  return request<{ binaries: AgentBinary[] }>('/api/agent/info');
+}
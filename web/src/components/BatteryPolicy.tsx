@@ -0,0 +1,74 @@
+import { useEffect, useState } from "react";
+import { BatteryLow, Loader2, Save } from "lucide-react";
+import { useTranslation } from "react-i18next";
+import { getBatteryPolicy, updateBatteryPolicy } from "../api";
+import type { BatteryPolicy as Policy } from "../api.gen";
+import { useNotification } from "../contexts/NotificationContext";
+
+// BatteryPolicy edits when robots that can dock themselves are sent back to
+// their dock.
+export function BatteryPolicy() {
+    const { t } = useTranslation();
+    const { success, error } = useNotification();
+    const [policy, setPolicy] = useState<Policy>({ enabled: false, low_pct: 20 });
+    const [saving, setSaving] = useState(false);
+
+    useEffect(() => {
+        getBatteryPolicy().then(setPolicy).catch(() => {});
+    }, []);
+
+    const handleSave = async () => {
+        setSaving(true);
+        try {
+            setPolicy(await updateBatteryPolicy(policy));
+            success(t("battery.saved"));
+        } catch (e: any) {
+            error(e.message);
+        } finally {
+            setSaving(false);
+        }
+    };
+
+    return (
+        <div className="bg-white rounded-xl border border-gray-200 overflow-hidden">
+            <div className="p-6 border-b border-gray-100">
+                <h2 className="text-lg font-semibold text-gray-900 flex items-center gap-2">
+                    <BatteryLow size={20} className="text-blue-500" />
+                    {t("battery.title")}
+                </h2>
+                <p className="text-sm text-gray-500 mt-1">{t("battery.description")}</p>
+            </div>
+            <div className="p-6 flex flex-col md:flex-row md:items-center gap-4">
+                <label className="flex items-center gap-2 text-sm text-gray-700">
+                    <input
+                        type="checkbox"
+                        checked={policy.enabled}
+                        onChange={e => setPolicy({ ...policy, enabled: e.target.checked })}
+                        className="rounded border-gray-300"
+                    />
+                    {t("battery.enabled")}
+                </label>
+                <label className="flex items-center gap-2 text-sm text-gray-700">
+                    {t("battery.lowPct")}
+                    <input
+                        type="number"
+                        min={5}
+                        max={90}
+                        value={policy.low_pct}
+                        onChange={e => setPolicy({ ...policy, low_pct: parseFloat(e.target.value) || 0 })}
+                        className="w-20 px-3 py-2 border border-gray-300 rounded-lg text-sm"
+                    />
+                    %
+                </label>
+                <button
+                    onClick={handleSave}
+                    disabled={saving}
+                    className="md:ml-auto flex items-center justify-center gap-2 bg-blue-600 text-white px-4 py-2 rounded-lg hover:bg-blue-700 transition-colors disabled:opacity-50"
+                >
+                    {saving ? <Loader2 className="animate-spin" size={18} /> : <Save size={18} />}
+                    {t("common.save")}
+                </button>
+            </div>
+        </div>
+    );
+}
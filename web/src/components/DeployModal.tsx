@@ -1,6 +1,6 @@
 import { useState, useEffect } from "react";
 import { useTranslation } from "react-i18next";
-import { getRobots, applyScenario } from "../api";
+import { getRobots, applyScenario, ScenarioMismatch } from "../api";
 import { Robot } from "../types";
 import { X, Play, Loader2, CheckCircle2 } from "lucide-react";
 
@@ -19,6 +19,8 @@ export function DeployModal({ scenarioId, scenarioName, onClose, onSuccess }: De
     const [deploying, setDeploying] = useState(false);
     const [error, setError] = useState<string | null>(null);
     const [filterTag, setFilterTag] = useState<string | null>(null);
+    const [force, setForce] = useState(false);
+    const [skipped, setSkipped] = useState<ScenarioMismatch[]>([]);
 
     useEffect(() => {
         getRobots()
@@ -54,8 +56,14 @@ export function DeployModal({ scenarioId, scenarioName, onClose, onSuccess }: De
         setDeploying(true);
         setError(null);
         try {
-            await applyScenario(scenarioId, { robot_ids: selectedIds });
+            const res = await applyScenario(scenarioId, { robot_ids: selectedIds, force });
             onSuccess();
+            if (res.skipped?.length) {
+                // Keep the modal open so the user sees which robots were left out.
+                setSkipped(res.skipped);
+                setDeploying(false);
+                return;
+            }
             onClose();
         } catch (err) {
             setError(err instanceof Error ? err.message : t("deployModal.deployError"));
@@ -79,6 +87,15 @@ export function DeployModal({ scenarioId, scenarioName, onClose, onSuccess }: De
                 <div className="p-6 overflow-y-auto flex-1">
                     {loading ? (
                         <div className="text-center py-8 text-gray-500">{t("deployModal.loading")}</div>
+                    ) : skipped.length > 0 ? (
+                        <div className="text-amber-800 bg-amber-50 p-4 rounded-lg space-y-2">
+                            <p className="font-medium">{t("deployModal.skipped", { count: skipped.length })}</p>
+                            <ul className="text-sm list-disc pl-5">
+                                {skipped.map((m) => (
+                                    <li key={m.robot_id}>{m.name}: {m.reasons.join(", ")}</li>
+                                ))}
+                            </ul>
+                        </div>
                     ) : error ? (
                         <div className="text-red-600 bg-red-50 p-4 rounded-lg">{error}</div>
                     ) : robots.length === 0 ? (
@@ -132,7 +149,11 @@ export function DeployModal({ scenarioId, scenarioName, onClose, onSuccess }: De
                     )}
                 </div>
 
-                <div className="p-6 border-t border-gray-100 bg-gray-50 flex justify-end gap-3">
+                <div className="p-6 border-t border-gray-100 bg-gray-50 flex justify-end items-center gap-3">
+                    <label className="mr-auto flex items-center gap-2 text-sm text-gray-600">
+                        <input type="checkbox" checked={force} onChange={(e) => setForce(e.target.checked)} />
+                        {t("deployModal.ignoreRequirements")}
+                    </label>
                     <button
                         onClick={onClose}
                         className="px-4 py-2 text-gray-700 hover:bg-gray-200 rounded-lg font-medium transition-colors"
@@ -141,7 +162,7 @@ export function DeployModal({ scenarioId, scenarioName, onClose, onSuccess }: De
                     </button>
                     <button
                         onClick={handleDeploy}
-                        disabled={deploying || selectedIds.length === 0}
+                        disabled={deploying || selectedIds.length === 0 || skipped.length > 0}
                         className="bg-blue-600 text-white px-6 py-2 rounded-lg hover:bg-blue-700 transition-colors font-medium flex items-center gap-2 disabled:opacity-50 disabled:cursor-not-allowed"
                     >
                         {deploying ? <Loader2 size={18} className="animate-spin" /> : <Play size={18} />}
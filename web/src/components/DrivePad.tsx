@@ -0,0 +1,53 @@
+import { useState } from "react";
+import { ArrowDown, ArrowLeft, ArrowRight, ArrowUp, Square } from "lucide-react";
+import { useTranslation } from "react-i18next";
+import { sendCommand } from "../api";
+
+// Each nudge is short and slow; the agent still checks it against the
+// robot's own limits.
+const NUDGE_SEC = 0.5;
+const NUDGE_LINEAR = 0.1;
+const NUDGE_ANGULAR = 0.5;
+
+// DrivePad nudges a robot with short drive commands, joystick style.
+export function DrivePad({ robotId }: { robotId: number }) {
+    const { t } = useTranslation();
+    const [error, setError] = useState("");
+
+    const send = (type: string, data: object = {}) => {
+        setError("");
+        sendCommand(robotId, { type, data }).catch((e: any) => setError(e.message));
+    };
+    const nudge = (linear: number, angular: number) => send("drive", { linear, angular, duration_sec: NUDGE_SEC });
+
+    const button = "flex items-center justify-center w-12 h-12 rounded-lg bg-gray-100 hover:bg-gray-200 text-gray-800";
+
+    return (
+        <div className="space-y-2">
+            <p className="text-sm font-medium text-gray-900">{t("robotDetail.nudge")}</p>
+            <div className="grid grid-cols-3 gap-2 w-fit mx-auto">
+                <span />
+                <button onClick={() => nudge(NUDGE_LINEAR, 0)} className={button} title={t("robotDetail.nudgeForward")}>
+                    <ArrowUp size={20} />
+                </button>
+                <span />
+                <button onClick={() => nudge(0, NUDGE_ANGULAR)} className={button} title={t("robotDetail.nudgeLeft")}>
+                    <ArrowLeft size={20} />
+                </button>
+                <button onClick={() => send("stop")} className="flex items-center justify-center w-12 h-12 rounded-lg bg-red-600 hover:bg-red-700 text-white" title={t("robotDetail.nudgeStop")}>
+                    <Square size={18} />
+                </button>
+                <button onClick={() => nudge(0, -NUDGE_ANGULAR)} className={button} title={t("robotDetail.nudgeRight")}>
+                    <ArrowRight size={20} />
+                </button>
+                <span />
+                <button onClick={() => nudge(-NUDGE_LINEAR, 0)} className={button} title={t("robotDetail.nudgeBack")}>
+                    <ArrowDown size={20} />
+                </button>
+                <span />
+            </div>
+            <p className="text-xs text-gray-500 text-center">{t("robotDetail.nudgeHint")}</p>
+            {error && <p className="text-sm text-red-600 text-center">{error}</p>}
+        </div>
+    );
+}
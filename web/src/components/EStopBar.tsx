@@ -0,0 +1,90 @@
+import { useEffect, useState } from "react";
+import { OctagonX } from "lucide-react";
+import { useTranslation } from "react-i18next";
+import { clearFleetEStop, engageFleetEStop, getFleetEStop } from "../api";
+import type { FleetEStopResponse } from "../api.gen";
+
+// EStopBar stops the whole fleet in one click. While the stop is engaged it
+// turns into a banner listing the robots that have acknowledged it.
+export function EStopBar() {
+    const { t } = useTranslation();
+    const [state, setState] = useState<FleetEStopResponse | null>(null);
+    const [busy, setBusy] = useState(false);
+    const [error, setError] = useState("");
+
+    useEffect(() => {
+        const load = () => getFleetEStop().then(setState).catch(() => {});
+        load();
+        const timer = setInterval(load, 5000);
+        return () => clearInterval(timer);
+    }, []);
+
+    const run = async (action: () => Promise<FleetEStopResponse>) => {
+        setBusy(true);
+        setError("");
+        try {
+            setState(await action());
+        } catch (e: any) {
+            setError(e.message);
+        } finally {
+            setBusy(false);
+        }
+    };
+
+    const handleClear = () => {
+        if (!confirm(t("estop.clearConfirm"))) return;
+        run(clearFleetEStop);
+    };
+
+    const stopped = state?.robots ?? [];
+
+    if (!state?.engaged && stopped.length === 0) {
+        return (
+            <div className="flex justify-end items-center gap-3 mb-4">
+                {error && <span className="text-sm text-red-600">{error}</span>}
+                <button
+                    onClick={() => run(() => engageFleetEStop())}
+                    disabled={busy}
+                    className="flex items-center gap-2 px-4 py-2 bg-red-600 hover:bg-red-700 text-white font-bold rounded-lg shadow disabled:opacity-50"
+                    title={t("estop.engageHint")}
+                >
+                    <OctagonX size={20} /> {t("estop.engage")}
+                </button>
+            </div>
+        );
+    }
+
+    return (
+        <div className="mb-4 p-4 bg-red-600 text-white rounded-xl shadow flex flex-col md:flex-row md:items-center gap-3">
+            <OctagonX size={28} className="shrink-0" />
+            <div className="flex-1 min-w-0">
+                <p className="font-bold">
+                    {state?.engaged ? t("estop.engaged") : t("estop.robotsStopped")}
+                    {state?.reason && <span className="font-normal">: {state.reason}</span>}
+                </p>
+                <p className="text-sm text-red-100 truncate">
+                    {stopped.length > 0
+                        ? t("estop.stoppedRobots", { count: stopped.length, names: stopped.map(r => r.name).join(", ") })
+                        : t("estop.waiting")}
+                </p>
+                {error && <p className="text-sm text-yellow-200">{error}</p>}
+            </div>
+            {!state?.engaged && (
+                <button
+                    onClick={() => run(() => engageFleetEStop())}
+                    disabled={busy}
+                    className="px-4 py-2 bg-white text-red-700 font-bold rounded-lg hover:bg-red-50 disabled:opacity-50"
+                >
+                    {t("estop.engage")}
+                </button>
+            )}
+            <button
+                onClick={handleClear}
+                disabled={busy}
+                className="px-4 py-2 border border-white font-medium rounded-lg hover:bg-red-700 disabled:opacity-50"
+            >
+                {t("estop.clear")}
+            </button>
+        </div>
+    );
+}
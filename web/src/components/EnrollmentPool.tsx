@@ -0,0 +1,176 @@
+import { type FormEvent, useEffect, useState } from "react";
+import { KeyRound, Loader2, Plus, RotateCcw, Trash2, UserCheck } from "lucide-react";
+import { useTranslation } from "react-i18next";
+import { createEnrollmentSlot, deleteEnrollmentSlot, listEnrollmentPool, resetEnrollmentSlot, rotateProvisioningToken } from "../api";
+import type { EnrollmentSlot } from "../api.gen";
+import { useNotification } from "../contexts/NotificationContext";
+
+// EnrollmentPool pre-registers robots by MAC address or serial number. A
+// robot flashed with the golden image enrolls itself on first boot under the
+// name its slot gives it.
+export function EnrollmentPool() {
+    const { t } = useTranslation();
+    const { success, error } = useNotification();
+    const [slots, setSlots] = useState<EnrollmentSlot[]>([]);
+    const [name, setName] = useState("");
+    const [mac, setMac] = useState("");
+    const [serial, setSerial] = useState("");
+    const [tags, setTags] = useState("");
+    const [adding, setAdding] = useState(false);
+
+    const load = () => listEnrollmentPool().then(setSlots).catch(() => {});
+
+    useEffect(() => {
+        load();
+        const timer = setInterval(load, 15000);
+        return () => clearInterval(timer);
+    }, []);
+
+    const handleAdd = async (e: FormEvent) => {
+        e.preventDefault();
+        setAdding(true);
+        try {
+            await createEnrollmentSlot({
+                name: name.trim(),
+                mac: mac.trim(),
+                serial: serial.trim(),
+                tags: tags.split(",").map(s => s.trim()).filter(Boolean),
+            });
+            setName("");
+            setMac("");
+            setSerial("");
+            setTags("");
+            load();
+        } catch (e: any) {
+            error(e.message);
+        } finally {
+            setAdding(false);
+        }
+    };
+
+    const handleDelete = async (slot: EnrollmentSlot) => {
+        if (!confirm(t("enrollment.confirmDelete", { name: slot.name }))) return;
+        try {
+            await deleteEnrollmentSlot(slot.id);
+            load();
+        } catch (e: any) {
+            error(e.message);
+        }
+    };
+
+    const handleReset = async (slot: EnrollmentSlot) => {
+        if (!confirm(t("enrollment.confirmReset", { name: slot.name }))) return;
+        try {
+            await resetEnrollmentSlot(slot.id);
+            load();
+        } catch (e: any) {
+            error(e.message);
+        }
+    };
+
+    const handleRotate = async () => {
+        if (!confirm(t("enrollment.confirmRotate"))) return;
+        try {
+            await rotateProvisioningToken();
+            success(t("enrollment.rotated"));
+        } catch (e: any) {
+            error(e.message);
+        }
+    };
+
+    return (
+        <div className="mt-8 bg-white rounded-xl border border-gray-200 p-6 space-y-4">
+            <div className="flex items-start justify-between gap-4">
+                <div>
+                    <h3 className="font-semibold text-gray-900 flex items-center gap-2">
+                        <UserCheck size={18} /> {t("enrollment.title")}
+                    </h3>
+                    <p className="text-sm text-gray-500 mt-1">{t("enrollment.description")}</p>
+                </div>
+                <button
+                    type="button"
+                    onClick={handleRotate}
+                    className="flex items-center gap-1 text-sm text-gray-600 hover:text-red-600 whitespace-nowrap"
+                >
+                    <KeyRound size={14} /> {t("enrollment.rotateToken")}
+                </button>
+            </div>
+            <form onSubmit={handleAdd} className="grid grid-cols-1 md:grid-cols-5 gap-3">
+                <input
+                    value={name}
+                    onChange={e => setName(e.target.value)}
+                    placeholder={t("enrollment.name")}
+                    className="px-3 py-2 border border-gray-300 rounded-lg text-sm"
+                />
+                <input
+                    value={mac}
+                    onChange={e => setMac(e.target.value)}
+                    placeholder={t("enrollment.mac")}
+                    className="px-3 py-2 border border-gray-300 rounded-lg text-sm font-mono"
+                />
+                <input
+                    value={serial}
+                    onChange={e => setSerial(e.target.value)}
+                    placeholder={t("enrollment.serial")}
+                    className="px-3 py-2 border border-gray-300 rounded-lg text-sm font-mono"
+                />
+                <input
+                    value={tags}
+                    onChange={e => setTags(e.target.value)}
+                    placeholder={t("enrollment.tags")}
+                    className="px-3 py-2 border border-gray-300 rounded-lg text-sm"
+                />
+                <button
+                    type="submit"
+                    disabled={adding || !name.trim() || (!mac.trim() && !serial.trim())}
+                    className="flex items-center justify-center gap-2 bg-blue-600 text-white px-4 py-2 rounded-lg hover:bg-blue-700 transition-colors text-sm font-medium disabled:opacity-50"
+                >
+                    {adding ? <Loader2 className="animate-spin" size={16} /> : <Plus size={16} />}
+                    {t("enrollment.add")}
+                </button>
+            </form>
+            {slots.length > 0 && (
+                <table className="w-full text-sm">
+                    <thead>
+                        <tr className="text-left text-gray-500 border-b border-gray-100">
+                            <th className="py-2 font-medium">{t("enrollment.name")}</th>
+                            <th className="py-2 font-medium">{t("enrollment.mac")}</th>
+                            <th className="py-2 font-medium">{t("enrollment.serial")}</th>
+                            <th className="py-2 font-medium">{t("enrollment.status")}</th>
+                            <th className="py-2" />
+                        </tr>
+                    </thead>
+                    <tbody>
+                        {slots.map(s => (
+                            <tr key={s.id} className="border-b border-gray-50 last:border-0">
+                                <td className="py-2 text-gray-900">
+                                    {s.name}
+                                    {s.tags.length > 0 && <span className="text-xs text-gray-400"> · {s.tags.join(", ")}</span>}
+                                </td>
+                                <td className="py-2 text-gray-700 font-mono text-xs">{s.mac || "-"}</td>
+                                <td className="py-2 text-gray-700 font-mono text-xs">{s.serial || "-"}</td>
+                                <td className="py-2">
+                                    {s.enrolled_at ? (
+                                        <span className="text-green-700">{t("enrollment.enrolledAt", { time: new Date(s.enrolled_at).toLocaleString() })}</span>
+                                    ) : (
+                                        <span className="text-gray-500">{t("enrollment.waiting")}</span>
+                                    )}
+                                </td>
+                                <td className="py-2 text-right">
+                                    {s.enrolled_at && (
+                                        <button onClick={() => handleReset(s)} title={t("enrollment.reset")} className="p-1 text-gray-500 hover:text-blue-600">
+                                            <RotateCcw size={16} />
+                                        </button>
+                                    )}
+                                    <button onClick={() => handleDelete(s)} title={t("common.delete")} className="p-1 text-gray-500 hover:text-red-600">
+                                        <Trash2 size={16} />
+                                    </button>
+                                </td>
+                            </tr>
+                        ))}
+                    </tbody>
+                </table>
+            )}
+        </div>
+    );
+}
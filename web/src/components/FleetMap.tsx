@@ -0,0 +1,89 @@
+import { useEffect, useState } from "react";
+import { Map as MapIcon } from "lucide-react";
+import { useTranslation } from "react-i18next";
+import { Link } from "react-router-dom";
+import { getFleetPositions } from "../api";
+import type { FleetPositions } from "../api.gen";
+
+// Robots report their pose every 30 seconds.
+const REFRESH_MS = 15000;
+const SIZE = 400;
+const PAD = 30;
+// The map never zooms in closer than this many meters across, so a lone
+// robot doesn't fill it.
+const MIN_SPAN = 4;
+
+// FleetMap plots where every robot last reported being, in one frame at a
+// time: map for robots localizing with AMCL, odom for the rest.
+export function FleetMap() {
+    const { t } = useTranslation();
+    const [data, setData] = useState<FleetPositions | null>(null);
+    const [frame, setFrame] = useState("");
+
+    useEffect(() => {
+        const load = () => getFleetPositions().then(setData).catch(() => {});
+        load();
+        const timer = setInterval(load, REFRESH_MS);
+        return () => clearInterval(timer);
+    }, []);
+
+    if (!data || data.frames.length === 0) return null;
+    const shown = frame && data.frames.includes(frame) ? frame : data.frames.includes("map") ? "map" : data.frames[0];
+    const robots = data.robots.filter(r => r.frame === shown);
+
+    const xs = robots.map(r => r.x);
+    const ys = robots.map(r => r.y);
+    const cx = (Math.min(...xs) + Math.max(...xs)) / 2;
+    const cy = (Math.min(...ys) + Math.max(...ys)) / 2;
+    const span = Math.max(MIN_SPAN, Math.max(...xs) - Math.min(...xs), Math.max(...ys) - Math.min(...ys)) * 1.2;
+    const scale = (SIZE - 2 * PAD) / span;
+    // Screen y grows downwards, map y upwards.
+    const px = (x: number) => SIZE / 2 + (x - cx) * scale;
+    const py = (y: number) => SIZE / 2 - (y - cy) * scale;
+    const grid = Math.pow(10, Math.floor(Math.log10(span / 2)));
+    const lines: number[] = [];
+    for (let v = Math.ceil((cx - span) / grid) * grid; v <= cx + span; v += grid) lines.push(v);
+    const hlines: number[] = [];
+    for (let v = Math.ceil((cy - span) / grid) * grid; v <= cy + span; v += grid) hlines.push(v);
+
+    return (
+        <div className="bg-white rounded-xl border border-gray-200 p-6">
+            <div className="flex items-center justify-between mb-4">
+                <h3 className="font-semibold text-gray-900 flex items-center gap-2">
+                    <MapIcon size={18} /> {t("fleetMap.title")}
+                </h3>
+                {data.frames.length > 1 && (
+                    <select value={shown} onChange={e => setFrame(e.target.value)} className="px-2 py-1 border border-gray-300 rounded-lg text-sm">
+                        {data.frames.map(f => (
+                            <option key={f} value={f}>{f || t("fleetMap.noFrame")}</option>
+                        ))}
+                    </select>
+                )}
+            </div>
+            <svg viewBox={`0 0 ${SIZE} ${SIZE}`} className="w-full max-w-xl mx-auto bg-gray-50 rounded-lg border border-gray-100">
+                {lines.map(v => (
+                    <line key={`x${v}`} x1={px(v)} x2={px(v)} y1={0} y2={SIZE} stroke="#e5e7eb" strokeWidth={1} />
+                ))}
+                {hlines.map(v => (
+                    <line key={`y${v}`} x1={0} x2={SIZE} y1={py(v)} y2={py(v)} stroke="#e5e7eb" strokeWidth={1} />
+                ))}
+                {robots.map(r => {
+                    const x = px(r.x);
+                    const y = py(r.y);
+                    const color = r.stale ? "#9ca3af" : "#2563eb";
+                    return (
+                        <Link key={r.robot_id} to={`/robots/${r.robot_id}`}>
+                            <g>
+                                <title>{t("fleetMap.tooltip", { name: r.name, x: r.x.toFixed(2), y: r.y.toFixed(2), source: r.source, time: new Date(r.at).toLocaleTimeString() })}</title>
+                                <circle cx={x} cy={y} r={8} fill={color} opacity={0.85} />
+                                <line x1={x} y1={y} x2={x + 14 * Math.cos(r.yaw)} y2={y - 14 * Math.sin(r.yaw)} stroke={color} strokeWidth={3} strokeLinecap="round" />
+                                <text x={x + 11} y={y - 10} fontSize={11} fill="#374151">{r.name}</text>
+                            </g>
+                        </Link>
+                    );
+                })}
+            </svg>
+            <p className="mt-2 text-xs text-gray-500 text-center">{t("fleetMap.legend", { meters: grid })}</p>
+        </div>
+    );
+}
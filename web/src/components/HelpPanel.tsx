@@ -0,0 +1,121 @@
+import { useEffect, useState } from "react";
+import { ChevronDown, ChevronRight, Edit2, HelpCircle, RotateCcw } from "lucide-react";
+import { useTranslation } from "react-i18next";
+import { getHelpTopic, resetHelpTopic, updateHelpTopic } from "../api";
+import type { HelpTopic } from "../api.gen";
+import { Markdown } from "./Markdown";
+
+// HelpPanel shows the guidance for a feature, which admins can rewrite for
+// their own lab.
+export function HelpPanel({ topic }: { topic: string }) {
+    const { t } = useTranslation();
+    const [help, setHelp] = useState<HelpTopic | null>(null);
+    const [open, setOpen] = useState(() => localStorage.getItem(`help.${topic}.closed`) !== "1");
+    const [editing, setEditing] = useState(false);
+    const [title, setTitle] = useState("");
+    const [body, setBody] = useState("");
+    const [saving, setSaving] = useState(false);
+    const [error, setError] = useState("");
+
+    useEffect(() => {
+        getHelpTopic(topic).then(setHelp).catch(() => {});
+    }, [topic]);
+
+    if (!help) return null;
+
+    const toggle = () => {
+        localStorage.setItem(`help.${topic}.closed`, open ? "1" : "0");
+        setOpen(!open);
+    };
+
+    const startEditing = () => {
+        setTitle(help.title);
+        setBody(help.body);
+        setError("");
+        setEditing(true);
+        setOpen(true);
+    };
+
+    const save = async (action: () => Promise<HelpTopic>) => {
+        setSaving(true);
+        setError("");
+        try {
+            setHelp(await action());
+            setEditing(false);
+        } catch (e: any) {
+            setError(e.message);
+        } finally {
+            setSaving(false);
+        }
+    };
+
+    const handleReset = () => {
+        if (!confirm(t("help.resetConfirm"))) return;
+        save(() => resetHelpTopic(topic));
+    };
+
+    return (
+        <div className="bg-blue-50 border border-blue-100 rounded-xl">
+            <div className="flex items-center justify-between px-4 py-3">
+                <button onClick={toggle} className="flex items-center gap-2 font-medium text-blue-900 text-left">
+                    {open ? <ChevronDown size={16} /> : <ChevronRight size={16} />}
+                    <HelpCircle size={18} className="text-blue-600" /> {help.title}
+                </button>
+                {!editing && (
+                    <div className="flex items-center gap-1">
+                        {help.customized && (
+                            <button onClick={handleReset} disabled={saving} className="p-1.5 text-blue-400 hover:text-blue-700" title={t("help.reset")}>
+                                <RotateCcw size={14} />
+                            </button>
+                        )}
+                        <button onClick={startEditing} className="p-1.5 text-blue-400 hover:text-blue-700" title={t("help.edit")}>
+                            <Edit2 size={14} />
+                        </button>
+                    </div>
+                )}
+            </div>
+            {open && (
+                <div className="px-4 pb-4">
+                    {editing ? (
+                        <div className="space-y-3">
+                            <input
+                                value={title}
+                                onChange={e => setTitle(e.target.value)}
+                                className="w-full px-3 py-2 border border-gray-300 rounded-lg text-sm bg-white"
+                            />
+                            <textarea
+                                value={body}
+                                onChange={e => setBody(e.target.value)}
+                                rows={12}
+                                className="w-full px-3 py-2 border border-gray-300 rounded-lg text-sm font-mono bg-white"
+                            />
+                            <p className="text-xs text-gray-500">{t("help.markdownHint")}</p>
+                            {error && <p className="text-sm text-red-600">{error}</p>}
+                            <div className="flex justify-end gap-2">
+                                <button onClick={() => setEditing(false)} className="px-3 py-1.5 text-sm text-gray-600 hover:bg-gray-100 rounded-lg">
+                                    {t("common.cancel")}
+                                </button>
+                                <button
+                                    onClick={() => save(() => updateHelpTopic(topic, { title, body }))}
+                                    disabled={saving}
+                                    className="px-3 py-1.5 text-sm bg-blue-600 text-white rounded-lg hover:bg-blue-700 disabled:opacity-50"
+                                >
+                                    {t("common.save")}
+                                </button>
+                            </div>
+                        </div>
+                    ) : (
+                        <>
+                            <Markdown source={help.body} />
+                            {help.customized && help.updated_at && (
+                                <p className="mt-3 text-xs text-blue-400">
+                                    {t("help.customized", { time: new Date(help.updated_at).toLocaleString(), user: help.updated_by || "admin" })}
+                                </p>
+                            )}
+                        </>
+                    )}
+                </div>
+            )}
+        </div>
+    );
+}
@@ -0,0 +1,62 @@
+import { useEffect, useState } from "react";
+import { KeyRound, RotateCcw } from "lucide-react";
+import { useTranslation } from "react-i18next";
+import { getRobotHostKey, resetRobotHostKey } from "../api";
+import type { HostKeyResponse } from "../api.gen";
+import { useNotification } from "../contexts/NotificationContext";
+
+// HostKeyInfo shows the SSH host key the controller recorded the first time
+// it logged in to the robot. Logins fail once the robot presents another
+// key, as it does after a reflash; resetting lets the next login record it.
+export function HostKeyInfo({ robotId }: { robotId: number }) {
+    const { t } = useTranslation();
+    const { success, error } = useNotification();
+    const [key, setKey] = useState<HostKeyResponse | null>(null);
+
+    const load = () => getRobotHostKey(robotId).then(setKey).catch(() => setKey(null));
+
+    useEffect(() => {
+        load();
+    }, [robotId]);
+
+    const handleReset = async () => {
+        if (!confirm(t("robotDetail.hostKeyConfirmReset"))) return;
+        try {
+            await resetRobotHostKey(robotId);
+            success(t("robotDetail.hostKeyReset"));
+            setKey(null);
+        } catch (e: any) {
+            error(e.message);
+        }
+    };
+
+    return (
+        <div className="bg-white rounded-xl border border-gray-200 p-6">
+            <div className="flex items-start justify-between gap-4">
+                <div>
+                    <h3 className="font-semibold text-gray-900 flex items-center gap-2">
+                        <KeyRound size={18} /> {t("robotDetail.hostKey")}
+                    </h3>
+                    <p className="text-sm text-gray-500 mt-1">{t("robotDetail.hostKeyDesc")}</p>
+                </div>
+                {key && (
+                    <button
+                        type="button"
+                        onClick={handleReset}
+                        className="flex items-center gap-1 text-sm text-gray-600 hover:text-red-600 whitespace-nowrap"
+                    >
+                        <RotateCcw size={14} /> {t("robotDetail.hostKeyResetButton")}
+                    </button>
+                )}
+            </div>
+            {key ? (
+                <p className="mt-3 text-sm text-gray-700">
+                    <span className="font-mono text-xs break-all">{key.fingerprint}</span>
+                    <span className="text-xs text-gray-400"> · {t("robotDetail.hostKeyFirstSeen", { time: new Date(key.first_seen).toLocaleString() })}</span>
+                </p>
+            ) : (
+                <p className="mt-3 text-sm text-gray-500">{t("robotDetail.hostKeyNone")}</p>
+            )}
+        </div>
+    );
+}
@@ -0,0 +1,221 @@
+import { useEffect, useState } from "react";
+import { Download, History, RefreshCw, Trash2, X } from "lucide-react";
+import { useTranslation } from "react-i18next";
+import { cancelImageBuild, deleteImageBuildArtifact, getImageStorage, listImageBuilds, pruneImages, refreshImageBuild } from "../api";
+import type { ImageBuild, ImageStorage } from "../api.gen";
+import { useNotification } from "../contexts/NotificationContext";
+import { useWebSocket, WSEvent } from "../contexts/WebSocketContext";
+
+const statusColors: Record<string, string> = {
+    queued: "bg-gray-100 text-gray-700",
+    building: "bg-purple-100 text-purple-700",
+    success: "bg-green-100 text-green-700",
+    error: "bg-red-100 text-red-700",
+    interrupted: "bg-amber-100 text-amber-800",
+    cancelled: "bg-gray-100 text-gray-500",
+};
+
+function gigabytes(bytes: number) {
+    return `${(bytes / (1 << 30)).toFixed(1)} GB`;
+}
+
+function duration(sec: number) {
+    const m = Math.floor(sec / 60);
+    return m > 0 ? `${m}m ${sec % 60}s` : `${sec}s`;
+}
+
+// ImageBuildHistory lists queued and past golden image builds, with a
+// download link for each image still kept and a way to take queued builds
+// off the queue, and shows the disk the images take.
+export function ImageBuildHistory() {
+    const { t } = useTranslation();
+    const { success, error } = useNotification();
+    const { addListener } = useWebSocket();
+    const [builds, setBuilds] = useState<ImageBuild[]>([]);
+    const [storage, setStorage] = useState<ImageStorage | null>(null);
+
+    const load = () => {
+        listImageBuilds().then(setBuilds).catch(() => {});
+        getImageStorage().then(setStorage).catch(() => {});
+    };
+
+    useEffect(() => {
+        load();
+        const timer = setInterval(load, 15000);
+        return () => clearInterval(timer);
+    }, []);
+
+    useEffect(() => {
+        let last = "";
+        return addListener((event: WSEvent) => {
+            // Log lines stream as build updates too; reload only when a
+            // build starts or ends.
+            if (event.type === "build_update" && event.data.status !== last) {
+                last = event.data.status;
+                load();
+            }
+        });
+    }, [addListener]);
+
+    const handleDeleteImage = async (b: ImageBuild) => {
+        if (!confirm(t("goldenImage.deleteImageConfirm", { name: b.image_name }))) return;
+        try {
+            await deleteImageBuildArtifact(b.id);
+            load();
+        } catch (e: any) {
+            error(e.message);
+        }
+    };
+
+    const handlePrune = async () => {
+        try {
+            const res = await pruneImages();
+            success(t("goldenImage.pruneDone", { count: res.removed.length, size: gigabytes(res.freed_bytes) }));
+            load();
+        } catch (e: any) {
+            error(e.message);
+        }
+    };
+
+    const handleRefresh = async (b: ImageBuild) => {
+        try {
+            const res = await refreshImageBuild(b.id);
+            success(t("goldenImage.refreshQueued", { id: res.build_id }));
+            load();
+        } catch (e: any) {
+            error(e.message);
+        }
+    };
+
+    const handleCancel = async (b: ImageBuild) => {
+        try {
+            await cancelImageBuild(b.id);
+            load();
+        } catch (e: any) {
+            error(e.message);
+        }
+    };
+
+    return (
+        <div className="mt-8 bg-white rounded-xl border border-gray-200 p-6 space-y-4">
+            <h3 className="font-semibold text-gray-900 flex items-center gap-2">
+                <History size={18} /> {t("goldenImage.history")}
+            </h3>
+            {storage && (
+                <div className="flex flex-wrap items-center gap-x-4 gap-y-1 text-xs text-gray-600">
+                    {storage.areas.map(a => (
+                        <span key={a.label} title={a.path}>
+                            {t(`goldenImage.storageArea.${a.label}`, a.label)}: <strong>{gigabytes(a.content_bytes)}</strong>
+                        </span>
+                    ))}
+                    {(storage.areas[0]?.total_bytes ?? 0) > 0 && (
+                        <span className="text-gray-400">
+                            {t("goldenImage.diskFree", { size: gigabytes(storage.areas[0].total_bytes - storage.areas[0].used_bytes) })}
+                        </span>
+                    )}
+                    <button type="button" onClick={handlePrune} className="text-blue-600 hover:text-blue-800">
+                        {t("goldenImage.pruneImages")}
+                    </button>
+                </div>
+            )}
+            <p className="text-xs text-gray-500">
+                {t("goldenImage.imagerRepo")}{" "}
+                <code className="font-mono text-gray-700 select-all">{`${window.location.origin}/api/golden-image/os_list.json`}</code>
+            </p>
+            {builds.length === 0 ? (
+                <p className="text-sm text-gray-500">{t("goldenImage.noBuilds")}</p>
+            ) : (
+                <table className="w-full text-sm">
+                    <thead>
+                        <tr className="text-left text-xs text-gray-500 border-b">
+                            <th className="py-2">#</th>
+                            <th>{t("goldenImage.profileName")}</th>
+                            <th>{t("goldenImage.buildStatus")}</th>
+                            <th>{t("goldenImage.queuedAt")}</th>
+                            <th>{t("goldenImage.duration")}</th>
+                            <th>{t("goldenImage.size")}</th>
+                            <th>SHA-256</th>
+                            <th></th>
+                        </tr>
+                    </thead>
+                    <tbody>
+                        {builds.map(b => (
+                            <tr key={b.id} className="border-b last:border-0">
+                                <td className="py-2 text-gray-500">{b.id}</td>
+                                <td>
+                                    {b.profile_name || "-"}
+                                    {b.refresh_of ? (
+                                        <span className="ml-1 text-xs text-gray-400">{t("goldenImage.refreshOf", { id: b.refresh_of })}</span>
+                                    ) : null}
+                                </td>
+                                <td>
+                                    <span className={`px-2 py-0.5 rounded text-xs ${statusColors[b.status] || ""}`} title={b.error}>
+                                        {t(`goldenImage.status.${b.status}`, b.status)}
+                                    </span>
+                                    {b.smoke_test && (
+                                        <span
+                                            className={`ml-1 px-2 py-0.5 rounded text-xs ${b.smoke_test === "passed" ? "bg-green-50 text-green-700" : "bg-red-50 text-red-700"}`}
+                                            title={b.smoke_error}
+                                        >
+                                            {b.smoke_test === "passed" ? t("goldenImage.smokePassed") : t("goldenImage.smokeFailed")}
+                                        </span>
+                                    )}
+                                </td>
+                                <td className="text-gray-500">{new Date(b.queued_at).toLocaleString()}</td>
+                                <td>{b.started_at ? duration(b.duration_sec) : "-"}</td>
+                                <td>{b.image_size ? `${(b.image_size / (1 << 30)).toFixed(1)} GB` : "-"}</td>
+                                <td className="font-mono text-xs" title={b.checksum}>{b.checksum ? b.checksum.slice(0, 12) : "-"}</td>
+                                <td className="text-right">
+                                    {b.download_url && (
+                                        <a href={b.download_url} className="text-blue-600 hover:text-blue-800 inline-flex items-center gap-1">
+                                            <Download size={14} /> {t("goldenImage.downloadImage")}
+                                        </a>
+                                    )}
+                                    {b.checksum_url && (
+                                        <a href={b.checksum_url} className="ml-3 text-xs text-gray-500 hover:text-gray-700">.sha256</a>
+                                    )}
+                                    {b.signature_url && (
+                                        <a href={b.signature_url} className="ml-2 text-xs text-gray-500 hover:text-gray-700" title={t("goldenImage.signatureHelp")}>.sig</a>
+                                    )}
+                                    {b.download_url && (
+                                        <button
+                                            type="button"
+                                            onClick={() => handleRefresh(b)}
+                                            className="ml-3 text-gray-400 hover:text-blue-600 align-middle"
+                                            title={t("goldenImage.refreshImage")}
+                                        >
+                                            <RefreshCw size={14} />
+                                        </button>
+                                    )}
+                                    {b.download_url && (
+                                        <button
+                                            type="button"
+                                            onClick={() => handleDeleteImage(b)}
+                                            className="ml-3 text-gray-400 hover:text-red-600 align-middle"
+                                            title={t("goldenImage.deleteImage")}
+                                        >
+                                            <Trash2 size={14} />
+                                        </button>
+                                    )}
+                                    {b.status === "success" && !b.download_url && (
+                                        <span className="text-xs text-gray-400">{t("goldenImage.pruned")}</span>
+                                    )}
+                                    {b.status === "queued" && (
+                                        <button
+                                            type="button"
+                                            onClick={() => handleCancel(b)}
+                                            className="text-gray-400 hover:text-red-600"
+                                            title={t("goldenImage.cancelBuild")}
+                                        >
+                                            <X size={16} />
+                                        </button>
+                                    )}
+                                </td>
+                            </tr>
+                        ))}
+                    </tbody>
+                </table>
+            )}
+        </div>
+    );
+}
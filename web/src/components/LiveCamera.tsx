@@ -0,0 +1,38 @@
+import { useState } from "react";
+import { Video, VideoOff } from "lucide-react";
+import { useTranslation } from "react-i18next";
+import { useNotification } from "../contexts/NotificationContext";
+
+// LiveCamera shows the robot's camera as it sees it, proxied by the
+// controller, for debugging remotely. The robot ends a view after 10
+// minutes; start it again to carry on.
+export function LiveCamera({ robotId }: { robotId: number }) {
+    const { t } = useTranslation();
+    const { error } = useNotification();
+    const [started, setStarted] = useState<number | null>(null);
+
+    return (
+        <div className="space-y-2">
+            <button
+                onClick={() => setStarted(started ? null : Date.now())}
+                className="w-full flex items-center justify-center gap-2 bg-gray-100 hover:bg-gray-200 text-gray-900 px-4 py-2 rounded-lg transition-colors"
+            >
+                {started ? <VideoOff size={18} /> : <Video size={18} />}
+                {started ? t("robotDetail.stopLiveView") : t("robotDetail.liveView")}
+            </button>
+            {started && (
+                <div className="rounded-lg overflow-hidden border border-gray-200 bg-black">
+                    <img
+                        src={`/api/robots/${robotId}/camera?t=${started}`}
+                        alt={t("robotDetail.liveView")}
+                        className="w-full h-auto"
+                        onError={() => {
+                            setStarted(null);
+                            error(t("robotDetail.liveViewFailed"));
+                        }}
+                    />
+                </div>
+            )}
+        </div>
+    );
+}
@@ -0,0 +1,76 @@
+import { useState } from "react";
+import { Bug } from "lucide-react";
+import { useTranslation } from "react-i18next";
+import { sendCommand } from "../api";
+import { useNotification } from "../contexts/NotificationContext";
+
+const LEVELS = ["debug", "info", "warn", "error", "fatal"];
+
+// LogLevelControl turns up the logging of a robot's ROS nodes for a while,
+// e.g. to debug with a student, without SSH. The agent puts the levels back
+// when the time is up.
+export function LogLevelControl({ robotId }: { robotId: number }) {
+    const { t } = useTranslation();
+    const { success, error } = useNotification();
+    const [nodes, setNodes] = useState("");
+    const [level, setLevel] = useState("debug");
+    const [minutes, setMinutes] = useState(15);
+    const [sending, setSending] = useState(false);
+
+    const handleApply = async () => {
+        setSending(true);
+        try {
+            await sendCommand(robotId, {
+                type: "set_log_level",
+                data: { nodes: nodes.split(/[\s,]+/).filter(Boolean), level, duration_sec: minutes * 60 },
+            });
+            success(t("robotDetail.logLevelQueued", { level, minutes }));
+        } catch (e: any) {
+            error(e.message);
+        } finally {
+            setSending(false);
+        }
+    };
+
+    return (
+        <div className="bg-white rounded-xl border border-gray-200 p-6 space-y-4">
+            <div>
+                <h3 className="font-semibold text-gray-900 flex items-center gap-2">
+                    <Bug size={18} /> {t("robotDetail.logLevel")}
+                </h3>
+                <p className="text-sm text-gray-500 mt-1">{t("robotDetail.logLevelDesc")}</p>
+            </div>
+            <div className="grid grid-cols-1 md:grid-cols-4 gap-3">
+                <input
+                    value={nodes}
+                    onChange={e => setNodes(e.target.value)}
+                    placeholder="/amcl /controller_server"
+                    className="md:col-span-2 px-3 py-2 border border-gray-300 rounded-lg text-sm font-mono"
+                />
+                <select value={level} onChange={e => setLevel(e.target.value)} className="px-3 py-2 border border-gray-300 rounded-lg text-sm">
+                    {LEVELS.map(l => (
+                        <option key={l} value={l}>{l}</option>
+                    ))}
+                </select>
+                <label className="flex items-center gap-2 text-sm text-gray-600">
+                    <input
+                        type="number"
+                        min={1}
+                        max={240}
+                        value={minutes}
+                        onChange={e => setMinutes(Number(e.target.value))}
+                        className="w-20 px-3 py-2 border border-gray-300 rounded-lg text-sm"
+                    />
+                    {t("robotDetail.logLevelMinutes")}
+                </label>
+            </div>
+            <button
+                onClick={handleApply}
+                disabled={sending || !nodes.trim() || minutes < 1}
+                className="bg-blue-600 text-white px-4 py-2 rounded-lg hover:bg-blue-700 transition-colors text-sm font-medium disabled:opacity-50"
+            >
+                {t("robotDetail.logLevelApply")}
+            </button>
+        </div>
+    );
+}
@@ -0,0 +1,87 @@
+import { Fragment, ReactNode } from "react";
+
+// Markdown renders the subset help topics use: headings, paragraphs, lists,
+// fenced code, and inline code, bold, italics and links. Text is never
+// injected as HTML, so an admin's help can't run script in the dashboard.
+export function Markdown({ source }: { source: string }) {
+    const blocks: ReactNode[] = [];
+    const lines = source.replace(/\r\n/g, "\n").split("\n");
+    let i = 0;
+    while (i < lines.length) {
+        const line = lines[i];
+        if (line.trim() === "") {
+            i++;
+            continue;
+        }
+        if (line.startsWith("```")) {
+            const code: string[] = [];
+            i++;
+            while (i < lines.length && !lines[i].startsWith("```")) {
+                code.push(lines[i++]);
+            }
+            i++;
+            blocks.push(
+                <pre key={blocks.length} className="bg-gray-900 text-gray-100 rounded-lg p-3 text-xs overflow-x-auto">
+                    <code>{code.join("\n")}</code>
+                </pre>
+            );
+            continue;
+        }
+        const heading = /^(#{1,3})\s+(.*)$/.exec(line);
+        if (heading) {
+            const size = ["text-lg", "text-base", "text-sm"][heading[1].length - 1];
+            blocks.push(<p key={blocks.length} className={`${size} font-semibold text-gray-900`}>{inline(heading[2])}</p>);
+            i++;
+            continue;
+        }
+        const listItem = /^\s*(?:[-*]|\d+\.)\s+/;
+        if (listItem.test(line)) {
+            const ordered = /^\s*\d+\./.test(line);
+            const items: string[] = [];
+            while (i < lines.length && listItem.test(lines[i])) {
+                items.push(lines[i++].replace(listItem, ""));
+            }
+            const List = ordered ? "ol" : "ul";
+            blocks.push(
+                <List key={blocks.length} className={`${ordered ? "list-decimal" : "list-disc"} pl-5 space-y-1`}>
+                    {items.map((item, j) => <li key={j}>{inline(item)}</li>)}
+                </List>
+            );
+            continue;
+        }
+        const para: string[] = [];
+        while (i < lines.length && lines[i].trim() !== "" && !lines[i].startsWith("```") && !/^#{1,3}\s/.test(lines[i]) && !listItem.test(lines[i])) {
+            para.push(lines[i++]);
+        }
+        blocks.push(<p key={blocks.length}>{inline(para.join(" "))}</p>);
+    }
+    return <div className="space-y-3 text-sm text-gray-700">{blocks}</div>;
+}
+
+function inline(text: string): ReactNode[] {
+    const parts: ReactNode[] = [];
+    const pattern = /`([^`]+)`|\*\*([^*]+)\*\*|\*([^*]+)\*|\[([^\]]+)\]\(([^)\s]+)\)/g;
+    let last = 0;
+    let m: RegExpExecArray | null;
+    while ((m = pattern.exec(text)) !== null) {
+        if (m.index > last) {
+            parts.push(<Fragment key={parts.length}>{text.slice(last, m.index)}</Fragment>);
+        }
+        if (m[1] !== undefined) {
+            parts.push(<code key={parts.length} className="px-1 py-0.5 bg-gray-100 rounded text-xs font-mono">{m[1]}</code>);
+        } else if (m[2] !== undefined) {
+            parts.push(<strong key={parts.length}>{m[2]}</strong>);
+        } else if (m[3] !== undefined) {
+            parts.push(<em key={parts.length}>{m[3]}</em>);
+        } else if (/^(https?:|mailto:|\/)/.test(m[5])) {
+            parts.push(<a key={parts.length} href={m[5]} target="_blank" rel="noreferrer" className="text-blue-600 hover:underline">{m[4]}</a>);
+        } else {
+            parts.push(<Fragment key={parts.length}>{m[4]}</Fragment>);
+        }
+        last = pattern.lastIndex;
+    }
+    if (last < text.length) {
+        parts.push(<Fragment key={parts.length}>{text.slice(last)}</Fragment>);
+    }
+    return parts;
+}
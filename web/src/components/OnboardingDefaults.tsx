@@ -0,0 +1,112 @@
+import { useEffect, useState } from "react";
+import { Loader2, Plus, Save, Trash2, UserPlus } from "lucide-react";
+import { useTranslation } from "react-i18next";
+import { getOnboardingDefaults, getScenarios, updateOnboardingDefaults } from "../api";
+import type { OnboardingDefault } from "../api.gen";
+import type { Scenario } from "../types";
+import { useNotification } from "../contexts/NotificationContext";
+
+// Suggested types: the platforms agents detect, then the robot types.
+const TYPES = ["turtlebot4", "turtlebot3", "robot", "laptop"];
+
+// OnboardingDefaults edits the scenario and tags each robot type gets when it
+// first joins the fleet.
+export function OnboardingDefaults() {
+    const { t } = useTranslation();
+    const { success, error } = useNotification();
+    const [defaults, setDefaults] = useState<OnboardingDefault[]>([]);
+    const [scenarios, setScenarios] = useState<Scenario[]>([]);
+    const [saving, setSaving] = useState(false);
+
+    useEffect(() => {
+        getOnboardingDefaults().then(r => setDefaults(r.defaults)).catch(() => {});
+        getScenarios().then(setScenarios).catch(() => {});
+    }, []);
+
+    const update = (i: number, patch: Partial<OnboardingDefault>) =>
+        setDefaults(defaults.map((d, j) => (j === i ? { ...d, ...patch } : d)));
+
+    const handleAdd = () => {
+        const type = TYPES.find(ty => !defaults.some(d => d.type === ty)) ?? "";
+        setDefaults([...defaults, { type, tags: [] }]);
+    };
+
+    const handleSave = async () => {
+        setSaving(true);
+        try {
+            const saved = await updateOnboardingDefaults({ defaults });
+            setDefaults(saved.defaults);
+            success(t("onboarding.saved"));
+        } catch (e: any) {
+            error(e.message);
+        } finally {
+            setSaving(false);
+        }
+    };
+
+    return (
+        <div className="bg-white rounded-xl border border-gray-200 overflow-hidden">
+            <div className="p-6 border-b border-gray-100">
+                <h2 className="text-lg font-semibold text-gray-900 flex items-center gap-2">
+                    <UserPlus size={20} className="text-blue-500" />
+                    {t("onboarding.title")}
+                </h2>
+                <p className="text-sm text-gray-500 mt-1">{t("onboarding.description")}</p>
+            </div>
+            <div className="p-6 space-y-3">
+                {defaults.map((d, i) => (
+                    <div key={i} className="grid grid-cols-1 md:grid-cols-[1fr_1fr_1fr_auto] gap-3 items-center">
+                        <input
+                            list="onboarding-types"
+                            value={d.type}
+                            onChange={e => update(i, { type: e.target.value })}
+                            placeholder={t("onboarding.type")}
+                            className="px-3 py-2 border border-gray-300 rounded-lg text-sm font-mono"
+                        />
+                        <select
+                            value={d.scenario ?? ""}
+                            onChange={e => update(i, { scenario: e.target.value || undefined })}
+                            className="px-3 py-2 border border-gray-300 rounded-lg text-sm"
+                        >
+                            <option value="">{t("onboarding.noScenario")}</option>
+                            {scenarios.map(s => (
+                                <option key={s.id} value={s.name}>{s.name}</option>
+                            ))}
+                        </select>
+                        <input
+                            value={(d.tags ?? []).join(", ")}
+                            onChange={e => update(i, { tags: e.target.value.split(",").map(tag => tag.trim()).filter(Boolean) })}
+                            placeholder={t("onboarding.tags")}
+                            className="px-3 py-2 border border-gray-300 rounded-lg text-sm"
+                        />
+                        <button
+                            onClick={() => setDefaults(defaults.filter((_, j) => j !== i))}
+                            className="p-2 text-gray-400 hover:text-red-600"
+                            title={t("onboarding.remove")}
+                        >
+                            <Trash2 size={16} />
+                        </button>
+                    </div>
+                ))}
+                <datalist id="onboarding-types">
+                    {TYPES.map(ty => (
+                        <option key={ty} value={ty} />
+                    ))}
+                </datalist>
+                <div className="flex items-center justify-between pt-2">
+                    <button onClick={handleAdd} className="flex items-center gap-2 text-sm text-blue-600 hover:text-blue-700">
+                        <Plus size={16} /> {t("onboarding.add")}
+                    </button>
+                    <button
+                        onClick={handleSave}
+                        disabled={saving}
+                        className="flex items-center gap-2 bg-blue-600 text-white px-4 py-2 rounded-lg hover:bg-blue-700 transition-colors disabled:opacity-50"
+                    >
+                        {saving ? <Loader2 className="animate-spin" size={18} /> : <Save size={18} />}
+                        {t("onboarding.save")}
+                    </button>
+                </div>
+            </div>
+        </div>
+    );
+}
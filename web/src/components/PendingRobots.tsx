@@ -0,0 +1,91 @@
+import { useEffect, useState } from "react";
+import { Check, ShieldQuestion, X } from "lucide-react";
+import { useTranslation } from "react-i18next";
+import { approvePendingAgent, listPendingAgents, rejectPendingAgent } from "../api";
+import type { PendingAgent } from "../api.gen";
+import { useNotification } from "../contexts/NotificationContext";
+
+// PendingRobots lists new agents the controller held back under
+// AGENT_ENROLLMENT=verified or approval. Approving one adds its robot;
+// rejecting one has its heartbeats ignored. Nothing is shown while none wait.
+export function PendingRobots() {
+    const { t } = useTranslation();
+    const { success, error } = useNotification();
+    const [pending, setPending] = useState<PendingAgent[]>([]);
+
+    const load = () => listPendingAgents().then(setPending).catch(() => {});
+
+    useEffect(() => {
+        load();
+        const timer = setInterval(load, 15000);
+        return () => clearInterval(timer);
+    }, []);
+
+    const handleApprove = async (a: PendingAgent) => {
+        const name = prompt(t("pendingRobots.approvePrompt", { agent: a.agent_id }), a.name);
+        if (name === null) return;
+        try {
+            const robot = await approvePendingAgent(a.agent_id, name.trim());
+            success(t("pendingRobots.approved", { name: robot.name }));
+            load();
+        } catch (e: any) {
+            error(e.message);
+        }
+    };
+
+    const handleReject = async (a: PendingAgent) => {
+        if (!confirm(t("pendingRobots.confirmReject", { agent: a.agent_id }))) return;
+        try {
+            await rejectPendingAgent(a.agent_id);
+            load();
+        } catch (e: any) {
+            error(e.message);
+        }
+    };
+
+    if (pending.length === 0) return null;
+
+    return (
+        <div className="bg-white rounded-xl border border-amber-200 p-6">
+            <h3 className="font-semibold text-gray-900 flex items-center gap-2">
+                <ShieldQuestion size={18} className="text-amber-600" /> {t("pendingRobots.title")}
+            </h3>
+            <p className="text-sm text-gray-500 mt-1">{t("pendingRobots.description")}</p>
+            <table className="w-full text-sm mt-3">
+                <thead>
+                    <tr className="text-left text-gray-500 border-b border-gray-100">
+                        <th className="py-2 font-medium">{t("pendingRobots.agent")}</th>
+                        <th className="py-2 font-medium">{t("common.ipAddress")}</th>
+                        <th className="py-2 font-medium">{t("pendingRobots.reason")}</th>
+                        <th className="py-2 font-medium">{t("common.lastSeen")}</th>
+                        <th className="py-2" />
+                    </tr>
+                </thead>
+                <tbody>
+                    {pending.map(a => (
+                        <tr key={a.agent_id} className={`border-b border-gray-50 last:border-0 ${a.rejected ? "text-gray-400" : "text-gray-700"}`}>
+                            <td className="py-2">
+                                <span className="font-mono text-xs">{a.agent_id}</span>
+                                {a.name && a.name !== a.agent_id && <span className="text-xs text-gray-400"> · {a.name}</span>}
+                                {a.rejected && <span className="ml-2 text-xs text-red-600">{t("pendingRobots.rejected")}</span>}
+                            </td>
+                            <td className="py-2 font-mono text-xs">{a.ip || "-"}</td>
+                            <td className="py-2 text-xs">{a.reason}</td>
+                            <td className="py-2 text-xs">{new Date(a.last_seen).toLocaleString()}</td>
+                            <td className="py-2 text-right whitespace-nowrap">
+                                <button onClick={() => handleApprove(a)} title={t("pendingRobots.approve")} className="p-1 text-gray-500 hover:text-green-600">
+                                    <Check size={16} />
+                                </button>
+                                {!a.rejected && (
+                                    <button onClick={() => handleReject(a)} title={t("pendingRobots.reject")} className="p-1 text-gray-500 hover:text-red-600">
+                                        <X size={16} />
+                                    </button>
+                                )}
+                            </td>
+                        </tr>
+                    ))}
+                </tbody>
+            </table>
+        </div>
+    );
+}
@@ -0,0 +1,156 @@
+import { useEffect, useState } from "react";
+import { Disc, Download, Loader2, Square, Trash2 } from "lucide-react";
+import { useTranslation } from "react-i18next";
+import { deleteBag, listRobotBags, startBags, stopBag } from "../api";
+import type { Bag } from "../api.gen";
+import { useNotification } from "../contexts/NotificationContext";
+
+const mb = (n: number) => `${(n / 2 ** 20).toFixed(1)} MB`;
+
+// RobotBags records ROS bags on a robot and lists the ones it recorded. The
+// robot uploads each bag when its recording ends, so a recording shows here
+// until the upload arrives.
+export function RobotBags({ robotId }: { robotId: number }) {
+    const { t } = useTranslation();
+    const { success, error } = useNotification();
+    const [bags, setBags] = useState<Bag[]>([]);
+    const [topics, setTopics] = useState("");
+    const [seconds, setSeconds] = useState(60);
+    const [experiment, setExperiment] = useState("");
+    const [starting, setStarting] = useState(false);
+
+    const load = () => listRobotBags(robotId).then(setBags).catch(() => {});
+
+    useEffect(() => {
+        load();
+        const timer = setInterval(load, 10000);
+        return () => clearInterval(timer);
+    }, [robotId]);
+
+    const handleStart = async () => {
+        setStarting(true);
+        try {
+            await startBags({
+                robot_ids: [robotId],
+                topics: topics.split(/[\s,]+/).filter(Boolean),
+                duration_sec: seconds,
+                experiment: experiment.trim(),
+            });
+            success(t("bags.started", { seconds }));
+            load();
+        } catch (e: any) {
+            error(e.message);
+        } finally {
+            setStarting(false);
+        }
+    };
+
+    const handleStop = async (id: number) => {
+        try {
+            await stopBag(id);
+            success(t("bags.stopping"));
+        } catch (e: any) {
+            error(e.message);
+        }
+    };
+
+    const handleDelete = async (id: number) => {
+        if (!confirm(t("bags.confirmDelete"))) return;
+        try {
+            await deleteBag(id);
+            load();
+        } catch (e: any) {
+            error(e.message);
+        }
+    };
+
+    return (
+        <div className="bg-white rounded-xl border border-gray-200 p-6 space-y-4">
+            <div>
+                <h3 className="font-semibold text-gray-900 flex items-center gap-2">
+                    <Disc size={18} /> {t("bags.title")}
+                </h3>
+                <p className="text-sm text-gray-500 mt-1">{t("bags.description")}</p>
+            </div>
+            <div className="grid grid-cols-1 md:grid-cols-4 gap-3">
+                <input
+                    value={topics}
+                    onChange={e => setTopics(e.target.value)}
+                    placeholder={t("bags.topicsPlaceholder")}
+                    className="md:col-span-2 px-3 py-2 border border-gray-300 rounded-lg text-sm font-mono"
+                />
+                <input
+                    value={experiment}
+                    onChange={e => setExperiment(e.target.value)}
+                    placeholder={t("bags.experimentPlaceholder")}
+                    className="px-3 py-2 border border-gray-300 rounded-lg text-sm"
+                />
+                <label className="flex items-center gap-2 text-sm text-gray-600">
+                    <input
+                        type="number"
+                        min={1}
+                        max={3600}
+                        value={seconds}
+                        onChange={e => setSeconds(Number(e.target.value))}
+                        className="w-24 px-3 py-2 border border-gray-300 rounded-lg text-sm"
+                    />
+                    {t("bags.seconds")}
+                </label>
+            </div>
+            <button
+                onClick={handleStart}
+                disabled={starting || seconds < 1 || seconds > 3600}
+                className="flex items-center gap-2 bg-blue-600 text-white px-4 py-2 rounded-lg hover:bg-blue-700 transition-colors text-sm font-medium disabled:opacity-50"
+            >
+                {starting && <Loader2 className="animate-spin" size={16} />}
+                {t("bags.record")}
+            </button>
+            {bags.length > 0 && (
+                <table className="w-full text-sm">
+                    <thead>
+                        <tr className="text-left text-gray-500 border-b border-gray-100">
+                            <th className="py-2 font-medium">{t("bags.startedAt")}</th>
+                            <th className="py-2 font-medium">{t("bags.experiment")}</th>
+                            <th className="py-2 font-medium">{t("bags.topics")}</th>
+                            <th className="py-2 font-medium">{t("bags.status")}</th>
+                            <th className="py-2" />
+                        </tr>
+                    </thead>
+                    <tbody>
+                        {bags.map(b => (
+                            <tr key={b.id} className="border-b border-gray-50 last:border-0 align-top">
+                                <td className="py-2 text-gray-700">{new Date(b.created_at).toLocaleString()}</td>
+                                <td className="py-2 text-gray-700">{b.experiment || "-"}</td>
+                                <td className="py-2 text-gray-700 font-mono text-xs">{b.topics.length ? b.topics.join(" ") : t("bags.allTopics")}</td>
+                                <td className="py-2">
+                                    <span className={b.status === "failed" ? "text-red-600" : b.status === "stored" ? "text-green-700" : "text-gray-500"}>
+                                        {t(`bags.${b.status}`)}
+                                    </span>
+                                    {b.status === "stored" && b.size_bytes ? <span className="text-gray-400"> · {mb(b.size_bytes)}</span> : null}
+                                    {b.error && <p className="text-xs text-red-600">{b.error}</p>}
+                                </td>
+                                <td className="py-2 text-right whitespace-nowrap">
+                                    {b.status === "recording" && (
+                                        <button onClick={() => handleStop(b.id)} title={t("bags.stop")} className="p-1 text-gray-500 hover:text-red-600">
+                                            <Square size={16} />
+                                        </button>
+                                    )}
+                                    {b.status === "stored" && (
+                                        <a href={`/api/bags/${b.id}/download`} title={t("bags.download")} className="inline-block p-1 text-gray-500 hover:text-blue-600">
+                                            <Download size={16} />
+                                        </a>
+                                    )}
+                                    {b.status !== "recording" && (
+                                        <button onClick={() => handleDelete(b.id)} title={t("common.delete")} className="p-1 text-gray-500 hover:text-red-600">
+                                            <Trash2 size={16} />
+                                        </button>
+                                    )}
+                                </td>
+                            </tr>
+                        ))}
+                    </tbody>
+                </table>
+            )}
+        </div>
+    );
+}
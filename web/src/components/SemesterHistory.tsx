@@ -0,0 +1,90 @@
+import { useEffect, useState } from "react";
+import { ChevronDown, ChevronRight, History } from "lucide-react";
+import { useTranslation } from "react-i18next";
+import { getSemesterBatch, listSemesterBatches } from "../api";
+import type { SemesterBatchDetail, SemesterBatchSummary } from "../api.gen";
+
+function duration(sec: number) {
+    if (sec < 60) return `${Math.round(sec)}s`;
+    if (sec < 3600) return `${Math.floor(sec / 60)}m ${Math.round(sec % 60)}s`;
+    return `${Math.floor(sec / 3600)}h ${Math.floor((sec % 3600) / 60)}m`;
+}
+
+// SemesterHistory lists past semester batches; opening one shows how long
+// each step took and which robots failed, to compare with earlier runs.
+export function SemesterHistory() {
+    const { t } = useTranslation();
+    const [batches, setBatches] = useState<SemesterBatchSummary[]>([]);
+    const [open, setOpen] = useState<SemesterBatchDetail | null>(null);
+
+    useEffect(() => {
+        listSemesterBatches().then(setBatches).catch(() => {});
+    }, []);
+
+    const toggle = (id: number) => {
+        if (open?.id === id) {
+            setOpen(null);
+            return;
+        }
+        getSemesterBatch(id).then(setOpen).catch(() => {});
+    };
+
+    if (batches.length === 0) return null;
+
+    return (
+        <div className="bg-white rounded-xl border border-gray-200 p-6">
+            <h3 className="font-semibold text-gray-900 mb-4 flex items-center gap-2">
+                <History size={18} /> {t("semesterHistory.title")}
+            </h3>
+            <div className="divide-y divide-gray-100 text-sm">
+                {batches.map(b => (
+                    <div key={b.id}>
+                        <button onClick={() => toggle(b.id)} className="w-full flex items-center gap-3 py-2 text-left hover:bg-gray-50">
+                            {open?.id === b.id ? <ChevronDown size={16} /> : <ChevronRight size={16} />}
+                            <span className="w-40 text-gray-900">{new Date(b.created_at).toLocaleString()}</span>
+                            <span className="w-24 text-gray-600">{b.state}</span>
+                            <span className="w-32 text-gray-600">
+                                {t("semesterHistory.done", { completed: b.completed, total: b.total })}
+                                {b.failed > 0 && <span className="text-red-600"> · {t("semesterHistory.failed", { count: b.failed })}</span>}
+                            </span>
+                            <span className="w-20 text-gray-600">{duration(b.duration_sec)}</span>
+                            <span className="flex-1 text-gray-500 truncate">{b.steps.map(s => s.replace(/_/g, " ")).join(" → ")}</span>
+                        </button>
+                        {open?.id === b.id && (
+                            <div className="pl-7 pb-3 space-y-3">
+                                <table className="w-full text-left">
+                                    <thead className="text-xs text-gray-500">
+                                        <tr>
+                                            <th className="py-1">{t("semesterHistory.step")}</th>
+                                            <th>{t("semesterHistory.succeeded")}</th>
+                                            <th>{t("semesterHistory.failedHeader")}</th>
+                                            <th>{t("semesterHistory.avg")}</th>
+                                            <th>{t("semesterHistory.max")}</th>
+                                        </tr>
+                                    </thead>
+                                    <tbody>
+                                        {open.step_stats.map(st => (
+                                            <tr key={st.index}>
+                                                <td className="py-1 capitalize">{st.label.replace(/_/g, " ")}</td>
+                                                <td>{st.succeeded}</td>
+                                                <td className={st.failed > 0 ? "text-red-600" : ""}>{st.failed}</td>
+                                                <td>{st.succeeded > 0 ? duration(st.avg_duration_sec) : "-"}</td>
+                                                <td>{st.succeeded > 0 ? duration(st.max_duration_sec) : "-"}</td>
+                                            </tr>
+                                        ))}
+                                    </tbody>
+                                </table>
+                                {open.robots.filter(r => r.error).map(r => (
+                                    <div key={r.robot_id} className="text-red-600">
+                                        <span className="font-medium">{r.name || r.robot_id}</span>: {r.error}
+                                    </div>
+                                ))}
+                                {open.created_by && <div className="text-xs text-gray-500">{t("semesterHistory.startedBy", { user: open.created_by })}</div>}
+                            </div>
+                        )}
+                    </div>
+                ))}
+            </div>
+        </div>
+    );
+}
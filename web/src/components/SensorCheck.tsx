@@ -0,0 +1,126 @@
+import { useState, type ReactNode } from "react";
+import { useTranslation } from "react-i18next";
+import { getSensorSnapshot } from "../api";
+import type { LidarScan, SensorSnapshotResponse } from "../api.gen";
+import { Radar, RefreshCw, AlertTriangle } from "lucide-react";
+
+interface SensorCheckProps {
+    robotId: number;
+}
+
+// SensorCheck shows one lidar scan, camera frame and odometry reading side by
+// side so a TA can confirm every sensor works in a single click.
+export function SensorCheck({ robotId }: SensorCheckProps) {
+    const { t } = useTranslation();
+    const [snapshot, setSnapshot] = useState<SensorSnapshotResponse | null>(null);
+    const [loading, setLoading] = useState(false);
+    const [error, setError] = useState<string | null>(null);
+
+    const handleCheck = async () => {
+        setLoading(true);
+        setError(null);
+        try {
+            setSnapshot(await getSensorSnapshot(robotId));
+        } catch (err) {
+            setSnapshot(null);
+            setError(err instanceof Error ? err.message : t("robotDetail.sensorCheckFailed"));
+        } finally {
+            setLoading(false);
+        }
+    };
+
+    return (
+        <div className="bg-white rounded-xl border border-gray-200 overflow-hidden">
+            <div className="p-6 border-b border-gray-100 flex items-start justify-between gap-4">
+                <div>
+                    <h2 className="text-lg font-semibold text-gray-900 flex items-center gap-2">
+                        <Radar size={20} className="text-blue-500" />
+                        {t("robotDetail.sensorCheck")}
+                    </h2>
+                    <p className="text-sm text-gray-500 mt-1">{t("robotDetail.sensorCheckDesc")}</p>
+                </div>
+                <button
+                    onClick={handleCheck}
+                    disabled={loading}
+                    className="flex items-center gap-2 bg-blue-600 text-white px-4 py-2 rounded-lg hover:bg-blue-700 transition-colors text-sm font-medium disabled:opacity-50"
+                >
+                    <RefreshCw size={16} className={loading ? "animate-spin" : ""} />
+                    {t("robotDetail.checkSensors")}
+                </button>
+            </div>
+            {error && <div className="p-6 text-sm text-red-600">{error}</div>}
+            {snapshot && (
+                <div className="p-6 grid grid-cols-1 md:grid-cols-3 gap-6">
+                    <SensorPanel title={t("robotDetail.lidar")} error={snapshot.scan_error}>
+                        {snapshot.scan && (
+                            <>
+                                <ScanPlot scan={snapshot.scan} />
+                                <p className="text-xs text-gray-500 mt-2">
+                                    {t("robotDetail.lidarPoints", { count: snapshot.scan.points, nearest: nearest(snapshot.scan) })}
+                                </p>
+                            </>
+                        )}
+                    </SensorPanel>
+                    <SensorPanel title={t("robotDetail.camera")} error={snapshot.camera_error}>
+                        {snapshot.camera && (
+                            <img
+                                src={`data:image/jpeg;base64,${snapshot.camera.jpeg}`}
+                                alt={t("robotDetail.camera")}
+                                className="w-full h-auto rounded-lg border border-gray-200"
+                            />
+                        )}
+                    </SensorPanel>
+                    <SensorPanel title={t("robotDetail.odometry")} error={snapshot.odom_error}>
+                        {snapshot.odom && (
+                            <dl className="grid grid-cols-2 gap-y-1 text-sm font-mono">
+                                <dt className="text-gray-500">x</dt><dd>{snapshot.odom.x.toFixed(3)} m</dd>
+                                <dt className="text-gray-500">y</dt><dd>{snapshot.odom.y.toFixed(3)} m</dd>
+                                <dt className="text-gray-500">yaw</dt><dd>{(snapshot.odom.yaw * 180 / Math.PI).toFixed(1)}°</dd>
+                                <dt className="text-gray-500">v</dt><dd>{snapshot.odom.linear_x.toFixed(2)} m/s</dd>
+                                <dt className="text-gray-500">ω</dt><dd>{snapshot.odom.angular_z.toFixed(2)} rad/s</dd>
+                            </dl>
+                        )}
+                    </SensorPanel>
+                </div>
+            )}
+        </div>
+    );
+}
+
+function SensorPanel({ title, error, children }: { title: string; error?: string; children: ReactNode }) {
+    return (
+        <div className="space-y-2">
+            <h3 className="font-medium text-gray-900">{title}</h3>
+            {error ? (
+                <p className="text-sm text-red-600 flex items-start gap-2">
+                    <AlertTriangle size={16} className="shrink-0 mt-0.5" /> {error}
+                </p>
+            ) : children}
+        </div>
+    );
+}
+
+function nearest(scan: LidarScan): string {
+    const valid = scan.ranges.filter((r): r is number => r !== null);
+    return valid.length ? Math.min(...valid).toFixed(2) : "-";
+}
+
+// ScanPlot draws the scan top-down with the robot at the centre facing up.
+function ScanPlot({ scan }: { scan: LidarScan }) {
+    const size = 200;
+    const scale = (size / 2 - 4) / (scan.range_max || 1);
+    const points = scan.ranges.flatMap((r, i) => {
+        if (r === null) return [];
+        const angle = scan.angle_min + i * scan.angle_increment;
+        return [[size / 2 - Math.sin(angle) * r * scale, size / 2 - Math.cos(angle) * r * scale]];
+    });
+    return (
+        <svg viewBox={`0 0 ${size} ${size}`} className="w-full h-auto bg-gray-50 rounded-lg border border-gray-200">
+            <circle cx={size / 2} cy={size / 2} r={size / 2 - 4} fill="none" stroke="#e5e7eb" />
+            {points.map(([x, y], i) => (
+                <circle key={i} cx={x} cy={y} r={1.5} fill="#2563eb" />
+            ))}
+            <polygon points={`${size / 2},${size / 2 - 6} ${size / 2 - 4},${size / 2 + 4} ${size / 2 + 4},${size / 2 + 4}`} fill="#111827" />
+        </svg>
+    );
+}
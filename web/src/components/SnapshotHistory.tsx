@@ -0,0 +1,81 @@
+import { useEffect, useState } from "react";
+import { AlertTriangle, Clock, Images } from "lucide-react";
+import { useTranslation } from "react-i18next";
+import { listRobotSnapshots } from "../api";
+import type { RobotSnapshot } from "../api.gen";
+
+// PAGE_SIZE is how many snapshots the controller returns at a time.
+const PAGE_SIZE = 50;
+
+// SnapshotHistory shows a robot's recent camera snapshots, scheduled or
+// taken on demand, so a camera that was knocked askew stands out. Bumping
+// refresh reloads it.
+export function SnapshotHistory({ robotId, refresh = 0 }: { robotId: number; refresh?: number }) {
+    const { t } = useTranslation();
+    const [snapshots, setSnapshots] = useState<RobotSnapshot[]>([]);
+    const [more, setMore] = useState(false);
+
+    useEffect(() => {
+        listRobotSnapshots(robotId).then(list => {
+            setSnapshots(list);
+            setMore(list.length >= PAGE_SIZE);
+        }).catch(() => {});
+    }, [robotId, refresh]);
+
+    const loadOlder = () => {
+        const oldest = snapshots[snapshots.length - 1];
+        if (!oldest) return;
+        listRobotSnapshots(robotId, oldest.id).then(list => {
+            setSnapshots(prev => [...prev, ...list]);
+            setMore(list.length >= PAGE_SIZE);
+        }).catch(() => {});
+    };
+
+    if (snapshots.length === 0) return null;
+
+    return (
+        <div className="bg-white rounded-xl border border-gray-200 p-6">
+            <h3 className="font-semibold text-gray-900 mb-4 flex items-center gap-2">
+                <Images size={18} /> {t("snapshots.history")}
+            </h3>
+            <div className="flex gap-3 overflow-x-auto pb-2">
+                {snapshots.map(s => (
+                    <div key={s.id} className="shrink-0 w-40">
+                        {s.url ? (
+                            <a href={s.url} target="_blank" rel="noreferrer">
+                                <img src={s.thumbnail_url || s.url} alt="" loading="lazy" className="w-40 h-28 object-cover rounded-lg border border-gray-200" />
+                            </a>
+                        ) : (
+                            <div className="w-40 h-28 rounded-lg border border-gray-200 bg-gray-50 flex flex-col items-center justify-center gap-1 p-2 text-center">
+                                {s.status === "failed" ? (
+                                    <>
+                                        <AlertTriangle size={18} className="text-red-500" />
+                                        <span className="text-xs text-red-600 line-clamp-3">{s.error}</span>
+                                    </>
+                                ) : (
+                                    <>
+                                        <Clock size={18} className="text-gray-400" />
+                                        <span className="text-xs text-gray-500">{t("snapshots.pending")}</span>
+                                    </>
+                                )}
+                            </div>
+                        )}
+                        <p className="mt-1 text-xs text-gray-500">
+                            {new Date(s.created_at).toLocaleString()}
+                            {s.schedule_id && <span className="text-gray-400"> · {t("snapshots.scheduled")}</span>}
+                            {!s.schedule_id && s.job_id && <span className="text-gray-400"> · {t("snapshots.job", { id: s.job_id })}</span>}
+                        </p>
+                    </div>
+                ))}
+                {more && (
+                    <button
+                        onClick={loadOlder}
+                        className="shrink-0 w-24 h-28 rounded-lg border border-dashed border-gray-300 text-sm text-gray-500 hover:bg-gray-50"
+                    >
+                        {t("snapshots.loadOlder")}
+                    </button>
+                )}
+            </div>
+        </div>
+    );
+}
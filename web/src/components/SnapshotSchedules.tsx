@@ -0,0 +1,161 @@
+import { useEffect, useState } from "react";
+import { Camera, Play, Plus, Trash2 } from "lucide-react";
+import { useTranslation } from "react-i18next";
+import { createSnapshotSchedule, deleteSnapshotSchedule, listSnapshotSchedules, runSnapshotSchedule, updateSnapshotSchedule } from "../api";
+import type { SnapshotSchedule } from "../api.gen";
+import { useNotification } from "../contexts/NotificationContext";
+
+const DAYS = ["mon", "tue", "wed", "thu", "fri", "sat", "sun"];
+
+// SnapshotSchedules lists the schedules that take camera snapshots on their
+// own, e.g. every morning before class, and adds new ones.
+export function SnapshotSchedules() {
+    const { t } = useTranslation();
+    const { success, error } = useNotification();
+    const [schedules, setSchedules] = useState<SnapshotSchedule[]>([]);
+    const [name, setName] = useState("");
+    const [robots, setRobots] = useState("all");
+    const [at, setAt] = useState("08:00");
+    const [days, setDays] = useState<string[]>([]);
+    const [saving, setSaving] = useState(false);
+
+    const load = () => listSnapshotSchedules().then(setSchedules).catch(() => {});
+    useEffect(() => {
+        load();
+    }, []);
+
+    const toggleDay = (day: string) => setDays(days.includes(day) ? days.filter(d => d !== day) : [...days, day]);
+
+    const handleAdd = async () => {
+        setSaving(true);
+        try {
+            await createSnapshotSchedule({ name, robots, at, days });
+            setName("");
+            setDays([]);
+            load();
+        } catch (e: any) {
+            error(e.message);
+        } finally {
+            setSaving(false);
+        }
+    };
+
+    const handleToggle = async (s: SnapshotSchedule) => {
+        try {
+            await updateSnapshotSchedule(s.id, { name: s.name, robots: s.robots, at: s.at, days: s.days, enabled: !s.enabled });
+            load();
+        } catch (e: any) {
+            error(e.message);
+        }
+    };
+
+    const handleRun = async (s: SnapshotSchedule) => {
+        try {
+            const run = await runSnapshotSchedule(s.id);
+            success(t("snapshots.runQueued", { count: run.snapshots.length }));
+            load();
+        } catch (e: any) {
+            error(e.message);
+        }
+    };
+
+    const handleDelete = async (s: SnapshotSchedule) => {
+        if (!confirm(t("snapshots.deleteConfirm", { name: s.name }))) return;
+        try {
+            await deleteSnapshotSchedule(s.id);
+            load();
+        } catch (e: any) {
+            error(e.message);
+        }
+    };
+
+    return (
+        <div className="bg-white rounded-xl border border-gray-200 overflow-hidden">
+            <div className="p-6 border-b border-gray-100">
+                <h2 className="text-lg font-semibold text-gray-900 flex items-center gap-2">
+                    <Camera size={20} className="text-blue-500" />
+                    {t("snapshots.schedules")}
+                </h2>
+                <p className="text-sm text-gray-500 mt-1">{t("snapshots.schedulesDesc")}</p>
+            </div>
+            <div className="p-6 space-y-4">
+                {schedules.length > 0 && (
+                    <table className="w-full text-sm">
+                        <thead>
+                            <tr className="text-left text-gray-500 border-b border-gray-100">
+                                <th className="py-2 font-medium">{t("snapshots.name")}</th>
+                                <th className="py-2 font-medium">{t("snapshots.robots")}</th>
+                                <th className="py-2 font-medium">{t("snapshots.when")}</th>
+                                <th className="py-2 font-medium">{t("snapshots.lastRun")}</th>
+                                <th />
+                            </tr>
+                        </thead>
+                        <tbody>
+                            {schedules.map(s => (
+                                <tr key={s.id} className={`border-b border-gray-50 ${s.enabled ? "" : "text-gray-400"}`}>
+                                    <td className="py-2">{s.name}</td>
+                                    <td className="py-2 font-mono text-xs">{s.robots}</td>
+                                    <td className="py-2">{s.at} {s.days.length > 0 ? s.days.map(d => t(`snapshots.day.${d}`)).join(", ") : t("snapshots.daily")}</td>
+                                    <td className="py-2">{s.last_run_at ? new Date(s.last_run_at).toLocaleString() : "-"}</td>
+                                    <td className="py-2">
+                                        <div className="flex items-center justify-end gap-1">
+                                            <label className="flex items-center gap-1 text-xs text-gray-500 mr-2">
+                                                <input type="checkbox" checked={s.enabled} onChange={() => handleToggle(s)} />
+                                                {t("snapshots.enabled")}
+                                            </label>
+                                            <button onClick={() => handleRun(s)} className="p-1.5 text-gray-400 hover:text-blue-600" title={t("snapshots.runNow")}>
+                                                <Play size={16} />
+                                            </button>
+                                            <button onClick={() => handleDelete(s)} className="p-1.5 text-gray-400 hover:text-red-600" title={t("snapshots.delete")}>
+                                                <Trash2 size={16} />
+                                            </button>
+                                        </div>
+                                    </td>
+                                </tr>
+                            ))}
+                        </tbody>
+                    </table>
+                )}
+                <div className="grid grid-cols-1 md:grid-cols-4 gap-3">
+                    <input
+                        value={name}
+                        onChange={e => setName(e.target.value)}
+                        placeholder={t("snapshots.namePlaceholder")}
+                        className="px-3 py-2 border border-gray-300 rounded-lg text-sm"
+                    />
+                    <input
+                        value={robots}
+                        onChange={e => setRobots(e.target.value)}
+                        placeholder="tag=classA"
+                        className="px-3 py-2 border border-gray-300 rounded-lg text-sm font-mono"
+                    />
+                    <input
+                        type="time"
+                        value={at}
+                        onChange={e => setAt(e.target.value)}
+                        className="px-3 py-2 border border-gray-300 rounded-lg text-sm"
+                    />
+                    <button
+                        onClick={handleAdd}
+                        disabled={saving || !name.trim() || !robots.trim()}
+                        className="flex items-center justify-center gap-2 bg-blue-600 text-white px-4 py-2 rounded-lg hover:bg-blue-700 transition-colors text-sm disabled:opacity-50"
+                    >
+                        <Plus size={16} /> {t("snapshots.add")}
+                    </button>
+                </div>
+                <div className="flex flex-wrap items-center gap-2 text-sm">
+                    {DAYS.map(day => (
+                        <button
+                            key={day}
+                            onClick={() => toggleDay(day)}
+                            className={`px-2.5 py-1 rounded-full border ${days.includes(day) ? "bg-blue-600 border-blue-600 text-white" : "border-gray-300 text-gray-600 hover:bg-gray-50"}`}
+                        >
+                            {t(`snapshots.day.${day}`)}
+                        </button>
+                    ))}
+                    <span className="text-xs text-gray-500">{t("snapshots.daysHint")}</span>
+                </div>
+            </div>
+        </div>
+    );
+}
@@ -0,0 +1,207 @@
+import { useEffect, useRef, useState } from "react";
+import { ArrowDown, ArrowLeft, ArrowRight, ArrowUp, Gamepad2, Loader2, Square } from "lucide-react";
+import { useTranslation } from "react-i18next";
+import { startTeleop, stopTeleop } from "../api";
+
+// Requested speeds; the robot clamps them to its own drive limits.
+const TELEOP_LINEAR = 0.2;
+const TELEOP_ANGULAR = 1.0;
+// The robot stops if no velocity arrives for half a second, so keep sending
+// while a key is held.
+const SEND_INTERVAL_MS = 100;
+// Without trickle ICE the offer is sent once its candidates are gathered.
+const GATHER_TIMEOUT_MS = 3000;
+
+type Keys = { up: boolean; down: boolean; left: boolean; right: boolean };
+const NO_KEYS: Keys = { up: false, down: false, left: false, right: false };
+
+const KEY_MAP: Record<string, keyof Keys> = {
+    ArrowUp: "up", w: "up", W: "up",
+    ArrowDown: "down", s: "down", S: "down",
+    ArrowLeft: "left", a: "left", A: "left",
+    ArrowRight: "right", d: "right", D: "right",
+};
+
+function gathered(pc: RTCPeerConnection): Promise<void> {
+    if (pc.iceGatheringState === "complete") return Promise.resolve();
+    return new Promise(resolve => {
+        const timer = setTimeout(resolve, GATHER_TIMEOUT_MS);
+        pc.addEventListener("icegatheringstatechange", () => {
+            if (pc.iceGatheringState === "complete") {
+                clearTimeout(timer);
+                resolve();
+            }
+        });
+    });
+}
+
+// Teleop drives a robot live over WebRTC: its camera plays in the video and
+// the arrow keys (or WASD) send velocities on a data channel, straight to
+// the robot with no round trip through the controller.
+export function Teleop({ robotId }: { robotId: number }) {
+    const { t } = useTranslation();
+    const [state, setState] = useState<"idle" | "connecting" | "connected">("idle");
+    const [error, setError] = useState("");
+    const [keys, setKeys] = useState<Keys>(NO_KEYS);
+    const pcRef = useRef<RTCPeerConnection | null>(null);
+    const channelRef = useRef<RTCDataChannel | null>(null);
+    const sessionRef = useRef("");
+    const keysRef = useRef<Keys>(NO_KEYS);
+    const videoRef = useRef<HTMLVideoElement>(null);
+
+    const close = (notify = true) => {
+        channelRef.current?.close();
+        pcRef.current?.close();
+        channelRef.current = null;
+        pcRef.current = null;
+        if (notify && sessionRef.current) {
+            stopTeleop(robotId, sessionRef.current).catch(() => {});
+        }
+        sessionRef.current = "";
+        keysRef.current = NO_KEYS;
+        setKeys(NO_KEYS);
+        setState("idle");
+    };
+
+    const start = async () => {
+        setError("");
+        setState("connecting");
+        const pc = new RTCPeerConnection();
+        pcRef.current = pc;
+        pc.addTransceiver("video", { direction: "recvonly" });
+        const channel = pc.createDataChannel("cmd_vel", { ordered: false, maxRetransmits: 0 });
+        channelRef.current = channel;
+        pc.ontrack = e => {
+            if (videoRef.current) videoRef.current.srcObject = e.streams[0] ?? new MediaStream([e.track]);
+        };
+        pc.onconnectionstatechange = () => {
+            if (pc.connectionState === "connected") setState("connected");
+            if (pc.connectionState === "failed") {
+                setError(t("teleop.connectionFailed"));
+                close();
+            }
+        };
+        channel.onclose = () => {
+            if (pcRef.current === pc) close();
+        };
+        try {
+            await pc.setLocalDescription(await pc.createOffer());
+            await gathered(pc);
+            const answer = await startTeleop(robotId, { sdp: pc.localDescription!.sdp, max_duration_sec: 0 });
+            if (pcRef.current !== pc) {
+                stopTeleop(robotId, answer.session).catch(() => {});
+                return;
+            }
+            sessionRef.current = answer.session;
+            await pc.setRemoteDescription({ type: "answer", sdp: answer.sdp });
+        } catch (e: any) {
+            setError(e.message);
+            close();
+        }
+    };
+
+    // Send the held keys as a velocity ten times a second.
+    useEffect(() => {
+        if (state !== "connected") return;
+        const timer = setInterval(() => {
+            const channel = channelRef.current;
+            if (!channel || channel.readyState !== "open") return;
+            const k = keysRef.current;
+            const linear = (k.up ? TELEOP_LINEAR : 0) - (k.down ? TELEOP_LINEAR : 0);
+            const angular = (k.left ? TELEOP_ANGULAR : 0) - (k.right ? TELEOP_ANGULAR : 0);
+            channel.send(JSON.stringify({ linear, angular }));
+        }, SEND_INTERVAL_MS);
+        return () => clearInterval(timer);
+    }, [state]);
+
+    useEffect(() => {
+        if (state !== "connected") return;
+        const set = (e: KeyboardEvent, down: boolean) => {
+            const key = KEY_MAP[e.key];
+            if (!key || (e.target as HTMLElement)?.closest("input, textarea, select")) return;
+            e.preventDefault();
+            keysRef.current = { ...keysRef.current, [key]: down };
+            setKeys(keysRef.current);
+        };
+        const onDown = (e: KeyboardEvent) => set(e, true);
+        const onUp = (e: KeyboardEvent) => set(e, false);
+        const onBlur = () => {
+            keysRef.current = NO_KEYS;
+            setKeys(NO_KEYS);
+        };
+        window.addEventListener("keydown", onDown);
+        window.addEventListener("keyup", onUp);
+        window.addEventListener("blur", onBlur);
+        return () => {
+            window.removeEventListener("keydown", onDown);
+            window.removeEventListener("keyup", onUp);
+            window.removeEventListener("blur", onBlur);
+        };
+    }, [state]);
+
+    useEffect(() => () => close(), [robotId]);
+
+    const hold = (key: keyof Keys) => ({
+        onPointerDown: () => {
+            keysRef.current = { ...keysRef.current, [key]: true };
+            setKeys(keysRef.current);
+        },
+        onPointerUp: () => {
+            keysRef.current = { ...keysRef.current, [key]: false };
+            setKeys(keysRef.current);
+        },
+        onPointerLeave: () => {
+            keysRef.current = { ...keysRef.current, [key]: false };
+            setKeys(keysRef.current);
+        },
+    });
+    const button = (active: boolean) =>
+        `flex items-center justify-center w-12 h-12 rounded-lg text-gray-800 select-none ${active ? "bg-blue-200" : "bg-gray-100 hover:bg-gray-200"}`;
+
+    return (
+        <div className="space-y-3">
+            <button
+                onClick={() => (state === "idle" ? start() : close())}
+                className="w-full flex items-center justify-center gap-2 bg-gray-100 hover:bg-gray-200 text-gray-900 px-4 py-2 rounded-lg transition-colors"
+            >
+                {state === "connecting" ? <Loader2 className="animate-spin" size={18} /> : <Gamepad2 size={18} />}
+                {state === "idle" ? t("teleop.start") : t("teleop.stop")}
+            </button>
+            {state !== "idle" && (
+                <>
+                    <div className="rounded-lg overflow-hidden border border-gray-200 bg-black aspect-video flex items-center justify-center">
+                        <video ref={videoRef} autoPlay playsInline muted className="w-full h-full object-contain" />
+                    </div>
+                    {state === "connected" && (
+                        <>
+                            <div className="grid grid-cols-3 gap-2 w-fit mx-auto">
+                                <span />
+                                <button className={button(keys.up)} title={t("robotDetail.nudgeForward")} {...hold("up")}>
+                                    <ArrowUp size={20} />
+                                </button>
+                                <span />
+                                <button className={button(keys.left)} title={t("robotDetail.nudgeLeft")} {...hold("left")}>
+                                    <ArrowLeft size={20} />
+                                </button>
+                                <button onClick={() => close()} className="flex items-center justify-center w-12 h-12 rounded-lg bg-red-600 hover:bg-red-700 text-white" title={t("teleop.stop")}>
+                                    <Square size={18} />
+                                </button>
+                                <button className={button(keys.right)} title={t("robotDetail.nudgeRight")} {...hold("right")}>
+                                    <ArrowRight size={20} />
+                                </button>
+                                <span />
+                                <button className={button(keys.down)} title={t("robotDetail.nudgeBack")} {...hold("down")}>
+                                    <ArrowDown size={20} />
+                                </button>
+                                <span />
+                            </div>
+                            <p className="text-xs text-gray-500 text-center">{t("teleop.hint")}</p>
+                        </>
+                    )}
+                    {state === "connecting" && <p className="text-xs text-gray-500 text-center">{t("teleop.connecting")}</p>}
+                </>
+            )}
+            {error && <p className="text-sm text-red-600 text-center">{error}</p>}
+        </div>
+    );
+}
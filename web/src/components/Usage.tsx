@@ -0,0 +1,61 @@
+import { useEffect, useState } from "react";
+import { Gauge } from "lucide-react";
+import { useTranslation } from "react-i18next";
+import { getUsage } from "../api";
+import type { UsageReport } from "../api.gen";
+
+const gib = (n: number) => `${(n / 2 ** 30).toFixed(1)} GiB`;
+
+// Usage shows this month's robots, builds and storage against the limits a
+// hosted deployment is configured with.
+export function Usage() {
+    const { t } = useTranslation();
+    const [usage, setUsage] = useState<UsageReport | null>(null);
+
+    useEffect(() => {
+        getUsage().then(setUsage).catch(() => {});
+    }, []);
+
+    if (!usage) return null;
+
+    const rows = [
+        { key: "robots", label: t("usage.robots"), value: `${usage.robots}`, limit: usage.limits.robots ? `${usage.limits.robots}` : "" },
+        { key: "agents", label: t("usage.activeAgents"), value: t("usage.agentsValue", { active: usage.active_agents, online: usage.online_agents }), limit: "" },
+        { key: "builds", label: t("usage.builds"), value: `${usage.builds}`, limit: usage.limits.builds_per_month ? `${usage.limits.builds_per_month}` : "" },
+        { key: "storage", label: t("usage.storage"), value: gib(usage.storage_bytes), limit: usage.limits.storage_bytes ? gib(usage.limits.storage_bytes) : "" },
+    ];
+
+    return (
+        <div className="bg-white rounded-xl border border-gray-200 overflow-hidden">
+            <div className="p-6 border-b border-gray-100">
+                <h2 className="text-lg font-semibold text-gray-900 flex items-center gap-2">
+                    <Gauge size={20} className="text-blue-500" />
+                    {t("usage.title")}
+                </h2>
+                <p className="text-sm text-gray-500 mt-1">
+                    {t("usage.description", { date: new Date(usage.period_start).toLocaleDateString() })}
+                </p>
+            </div>
+            <div className="p-6">
+                <table className="w-full text-sm">
+                    <tbody>
+                        {rows.map(row => (
+                            <tr key={row.key} className="border-b border-gray-50 last:border-0">
+                                <td className="py-2 text-gray-500">{row.label}</td>
+                                <td className={`py-2 font-medium ${usage.exceeded.includes(row.key) ? "text-red-600" : "text-gray-900"}`}>
+                                    {row.value}
+                                    {row.limit && <span className="text-gray-400 font-normal"> / {row.limit}</span>}
+                                </td>
+                            </tr>
+                        ))}
+                    </tbody>
+                </table>
+                {usage.exceeded.length > 0 && (
+                    <p className="mt-4 text-sm text-red-600">
+                        {usage.enforced ? t("usage.enforced") : t("usage.reported")}
+                    </p>
+                )}
+            </div>
+        </div>
+    );
+}
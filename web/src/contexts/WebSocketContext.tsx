@@ -33,12 +33,15 @@ export interface ScanResultEvent {
 }
 
 export interface BuildUpdatePayload {
+    build_id?: number;
     status: string;
     progress: number;
     step: string;
     logs: string[];
     error: string;
     image_name?: string;
+    profile_id?: number;
+    profile_name?: string;
 }
 
 export interface BuildUpdateEvent {
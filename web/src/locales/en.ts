@@ -5,6 +5,7 @@ export const en = {
       robots: "Robots",
       laptops: "Laptops",
       scenarios: "Scenarios",
+      missions: "Missions",
       semesterWizard: "Semester Wizard",
       goldenImage: "Golden Image",
       settings: "Settings",
@@ -40,6 +41,162 @@ export const en = {
       logs: "Logs",
       manage: "Manage",
     },
+    estop: {
+      engage: "E-STOP ALL",
+      engageHint: "Publish zero velocity on every robot until cleared",
+      engaged: "Fleet emergency stop engaged",
+      robotsStopped: "Robots are emergency stopped",
+      stoppedRobots: "{{count}} stopped: {{names}}",
+      waiting: "Waiting for robots to acknowledge",
+      clear: "Clear E-Stop",
+      clearConfirm: "Clear the emergency stop on every robot? Robots may resume moving.",
+    },
+    help: {
+      edit: "Edit this help for your lab",
+      reset: "Restore the built-in help",
+      resetConfirm: "Replace your lab's version of this help with the built-in text?",
+      markdownHint: "Markdown: # headings, lists, **bold**, `code`, ``` code blocks and [links](https://...).",
+      customized: "Edited for this lab by {{user}}, {{time}}",
+    },
+    snapshots: {
+      schedules: "Snapshot Schedules",
+      schedulesDesc: "Take a camera snapshot of the selected robots at a set time, e.g. every morning before class. Failed snapshots raise an alert.",
+      name: "Name",
+      namePlaceholder: "Morning camera check",
+      robots: "Robots",
+      when: "When",
+      lastRun: "Last run",
+      daily: "every day",
+      daysHint: "No days selected means every day.",
+      enabled: "On",
+      add: "Add Schedule",
+      runNow: "Take snapshots now",
+      runQueued: "Asked {{count}} robot(s) for a snapshot",
+      delete: "Delete schedule",
+      deleteConfirm: "Delete the schedule \"{{name}}\"? Its snapshots are kept.",
+      history: "Snapshot History",
+      pending: "Waiting for the robot",
+      scheduled: "scheduled",
+      requested: "Snapshot requested. It will appear below shortly.",
+      failed: "The snapshot failed",
+      loadOlder: "Older",
+      job: "job #{{id}}",
+      day: {
+        mon: "Mon",
+        tue: "Tue",
+        wed: "Wed",
+        thu: "Thu",
+        fri: "Fri",
+        sat: "Sat",
+        sun: "Sun",
+      },
+    },
+    onboarding: {
+      title: "New Robot Defaults",
+      description: "Give robots a scenario and tags when they first join the fleet, by type. A platform the agent detects (turtlebot4, turtlebot3) takes precedence over the robot type (robot, laptop). A robot that already has a scenario keeps it.",
+      type: "turtlebot4",
+      tags: "Tags, comma separated",
+      noScenario: "No scenario",
+      add: "Add type",
+      remove: "Remove",
+      save: "Save Defaults",
+      saved: "New robot defaults saved",
+    },
+    missions: {
+      subtitle: "Save waypoint routes and send robots along them with Nav2",
+      routes: "Routes",
+      new: "New mission",
+      empty: "No missions yet. Add waypoints on the right and save.",
+      waypointCount: "{{count}} waypoints",
+      name: "Mission name",
+      description: "Description",
+      framePlaceholder: "frame (default map)",
+      waypoint: "Waypoint",
+      action: "At the waypoint",
+      actionNone: "Drive on",
+      actionWait: "Wait",
+      actionSnapshot: "Take a snapshot",
+      waitSec: "Seconds to wait",
+      addWaypoint: "Add waypoint",
+      saved: "Saved {{name}}",
+      deleteConfirm: "Delete mission {{name}}? Robots already on it carry on.",
+      run: "Run {{name}}",
+      loops: "Loops",
+      start: "Start",
+      runHint: "Robot names or a selector, e.g. tag=classA, or all. A waypoint that can't be reached ends that robot's mission; an e-stop ends every one.",
+      sent: "Sent to {{count}} robots",
+      skipped: "Skipped (no agent): {{names}}",
+    },
+    battery: {
+      title: "Low Battery Docking",
+      description: "Send robots that can dock themselves (TurtleBot 4) back to their dock when their battery runs low. An alert is raised each time.",
+      enabled: "Dock robots automatically",
+      lowPct: "Below",
+      saved: "Battery policy saved",
+    },
+    usage: {
+      title: "Usage",
+      description: "Since {{date}}, against the limits set for this deployment.",
+      robots: "Robots enrolled",
+      activeAgents: "Active agents",
+      agentsValue: "{{active}} ({{online}} online now)",
+      builds: "Golden image builds",
+      storage: "Storage",
+      enforced: "A limit has been reached. New robots, builds or uploads over it are refused.",
+      reported: "A limit has been reached. It is reported but not enforced.",
+    },
+    enrollment: {
+      title: "Enrollment Pool",
+      description: "Robots flashed with the golden image enroll themselves on first boot under the name you give their MAC address or serial number here. While the pool is empty they keep a random name.",
+      name: "Name",
+      mac: "MAC address",
+      serial: "Serial number",
+      tags: "Tags (comma-separated)",
+      add: "Add",
+      status: "Status",
+      waiting: "Waiting for first boot",
+      enrolledAt: "Enrolled {{time}}",
+      confirmDelete: "Remove {{name}} from the enrollment pool? A robot that already enrolled stays in the fleet.",
+      reset: "Let it enroll again",
+      confirmReset: "Let {{name}} enroll again? Do this after re-flashing it. Its agent's payload key is replaced, so the agent running now stops receiving credentials.",
+      rotateToken: "Rotate token",
+      confirmRotate: "Rotate the provisioning token? Images built with the old token can no longer enroll until they are rebuilt.",
+      rotated: "Provisioning token rotated. Rebuild the golden image.",
+    },
+    teleop: {
+      start: "Drive live (WebRTC)",
+      stop: "End live drive",
+      connecting: "Connecting to the robot…",
+      connectionFailed: "The connection to the robot failed. Your browser must be able to reach the robot's network directly.",
+      hint: "Hold the arrow keys or WASD to drive. The robot stops half a second after you let go.",
+    },
+    fleetMap: {
+        title: "Fleet Map",
+        noFrame: "(no frame)",
+        tooltip: "{{name}} at ({{x}}, {{y}}) from {{source}}, {{time}}",
+        legend: "Grid lines every {{meters}} m. Grey robots are offline or haven't reported lately.",
+    },
+    bags: {
+      title: "ROS Bags",
+      description: "Record topics on this robot for later analysis. The bag is uploaded to the controller when the recording ends.",
+      topicsPlaceholder: "/scan /odom (all topics if empty)",
+      experimentPlaceholder: "Experiment (optional)",
+      seconds: "seconds",
+      record: "Record",
+      started: "Recording for {{seconds}}s",
+      stopping: "Stopping; the bag is uploaded once it stops",
+      confirmDelete: "Delete this bag?",
+      startedAt: "Started",
+      experiment: "Experiment",
+      topics: "Topics",
+      status: "Status",
+      allTopics: "all",
+      recording: "Recording",
+      stored: "Stored",
+      failed: "Failed",
+      stop: "Stop",
+      download: "Download",
+    },
     dashboard: {
       title: "Mission Control",
       subtitle: "Fleet status overview",
@@ -63,10 +220,21 @@ export const en = {
       buildingNewImage: "Building new image...",
       manageOSImages: "Manage OS images",
       progress: "Progress: {{progress}}",
+      fleetHealth: "Fleet Health",
+      averageScore: "Average score",
+      healthyCount: "{{count}} healthy",
+      degradedCount: "{{count}} degraded",
+      unhealthyCount: "{{count}} unhealthy",
     },
     robots: {
       subtitle: "Manage your autonomous fleet",
       loading: "Loading fleet data...",
+      drift: "Drift",
+      driftDetail: "Differs from {{scenario}}",
+      containers: "Containers",
+      containersDetail: "{{healthy}} of {{total}} healthy",
+      unmanaged: "Unmanaged",
+      unmanagedDetail: "No agent linked yet",
     },
     scenarios: {
       subtitle: "Define and deploy robot behaviors",
@@ -75,6 +243,14 @@ export const en = {
       emptyDescription: "Create your first scenario to define a sequence of actions for your robots to perform.",
       createButton: "Create Scenario",
       deleteConfirm: "Are you sure you want to delete this scenario?",
+      export: "Export",
+      exportTitle: "Download every scenario and where it was applied",
+      import: "Import",
+      importTitle: "Add scenarios from a bundle exported by another controller",
+      importConflicts: "{{count}} scenario(s) already exist with a different config: {{names}}. Replace them? Cancel keeps the existing ones.",
+      importNothing: "Every scenario in the bundle is already here.",
+      importDone: "Imported: {{created}} created, {{replaced}} replaced, {{skipped}} kept.",
+      importError: "Import failed: {{message}}",
     },
     login: {
       title: "OpenRobotFleet",
@@ -96,13 +272,21 @@ export const en = {
       sshKeyDesc: "Paste the private key content directly.",
       sshPublicKey: "Derived Public Key",
       sshPublicKeyDesc: "This public key is derived from the private key above and will be added to the robots' authorized_keys.",
+      keyPassphrase: "Private Key Passphrase",
+      keyPassphraseDesc: "Only needed if the key above is protected by a passphrase. Stored encrypted, like the key.",
+      sshAgentKeys: "SSH Agent Keys",
+      sshAgentKeysDesc: "The controller also logs in with these keys from its SSH agent (SSH_AGENT_SOCKET). Add them to the robots' authorized_keys; their private keys never reach the database.",
+      generateKey: "Generate key",
+      generateKeyConfirmReplace: "Replace the default SSH key with a new one? Robots that only trust the current key will refuse logins until the new public key is added to them.",
+      generateKeySuccess: "New default SSH key generated ({{fingerprint}}). Bake the public key below into your images.",
+      generateKeyPlaintext: "No SECRETS_KEY is configured, so the private key is stored unencrypted.",
       saveDefaults: "Save Defaults",
       dbManagement: "Database Management",
       dbManagementDesc: "Backup and restore the controller database.",
       backup: "Backup Database",
-      backupDesc: "Download current .db file",
+      backupDesc: "Download the database, optionally encrypted",
       restore: "Restore Database",
-      restoreDesc: "Upload .db file to replace current",
+      restoreDesc: "Upload a .db or encrypted backup to replace current",
       fleetMaintenance: "Fleet Maintenance",
       fleetMaintenanceDesc: "Dangerous operations that affect the entire fleet. Use with caution.",
       restartRos: "Restart All ROS",
@@ -119,11 +303,26 @@ export const en = {
       restoreConfirm: "WARNING: This will overwrite the current database and restart the controller. All current data will be replaced. Are you sure?",
       restoreSuccess: "Database restored successfully. The page will now reload.",
       restoreError: "Failed to restore database",
+      backupPassphrase: "Passphrase to encrypt the backup with (it contains SSH keys and passwords). Leave empty to download it unencrypted.",
+      backupError: "Failed to back up database",
+      restorePassphrase: "This backup is encrypted. Enter its passphrase:",
       restartConfirm: "Are you sure you want to restart ROS on ALL robots?",
       rebootConfirm: "Are you sure you want to REBOOT ALL robots? This will interrupt all operations.",
       classOverConfirm: "Are you sure you want to STOP all robots and play the end-of-session sound?",
       demoModeDisabled: "Database backup and restore are disabled in demo mode.",
     },
+    pendingRobots: {
+      title: "Waiting for approval",
+      description: "New agents that sent heartbeats but aren't let in on their own. They join the fleet once approved; rejected ones are ignored.",
+      agent: "Agent",
+      reason: "Reason",
+      approve: "Approve",
+      approvePrompt: "Name for the robot {{agent}} runs:",
+      approved: "{{name}} joined the fleet",
+      reject: "Reject",
+      confirmReject: "Reject {{agent}}? Its heartbeats are ignored until you approve it.",
+      rejected: "rejected",
+    },
     discovery: {
       title: "Network Discovery",
       subtitle: "Scan the local network for available robots",
@@ -138,6 +337,8 @@ export const en = {
       setupRobot: "Setup Robot",
       setupLaptop: "Setup Laptop",
       alreadyManaged: "Already Managed",
+      pending: "Waiting for Approval",
+      rejected: "Rejected",
     },
     goldenImage: {
       title: "Golden Image Builder",
@@ -146,6 +347,17 @@ export const en = {
       saveError: "Failed to save configuration",
       wifiSsid: "WiFi SSID",
       wifiPassword: "WiFi Password",
+      extraNetworks: "Backup Networks",
+      extraNetworksHelp: "Robots also join these, e.g. another building or a hotspot. With NetworkManager a higher priority is preferred; the network above always comes first.",
+      wifiPriority: "Priority",
+      anyBand: "Any band",
+      hiddenNetwork: "Hidden",
+      wifiSecurity: "Security",
+      wpaPersonal: "WPA2 Personal",
+      wpaEnterprise: "WPA2 Enterprise",
+      eapIdentity: "Identity (e.g. user@example.edu)",
+      eapAnonymousIdentity: "Anonymous identity (optional)",
+      addNetwork: "Add network",
       ubuntuPassword: "Ubuntu Password",
       ubuntuPasswordHelp: "Optional. If set, password login will work in addition to SSH key auth.",
       controllerUrl: "Controller URL",
@@ -154,6 +366,24 @@ export const en = {
       rosDomainId: "ROS Domain ID",
       robotModel: "Robot Model",
       rosVersion: "ROS Version",
+      profiles: "Image Profiles",
+      newProfile: "New profile",
+      noProfiles: "No profiles yet. Fill in the settings below and save them as a profile, e.g. TB3-Humble.",
+      notBuilt: "Not built",
+      profileName: "Profile Name",
+      profileDescription: "Description",
+      downloadUserData: "Download user-data",
+      flashName: "Robot name, e.g. tb3-07",
+      flashForRobot: "User-data for robot",
+      flashHelp: "Registers the robot and downloads user-data that boots a card as it. Flash the image, then replace user-data on the card's boot partition with this file.",
+      flashRegistered: "Registered {{name}}; copy user-data onto the card's boot partition",
+      flashExisting: "{{name}} is already registered; copy user-data onto the card's boot partition",
+      downloadAutoinstall: "Download autoinstall",
+      laptopModel: "Laptop (amd64)",
+      laptopHelp: "Laptops aren't built into an image. Install Ubuntu from a stock ISO with this profile's autoinstall file; it installs ROS desktop and the agent, which enrolls on first boot. Save the profile first.",
+      deleteProfile: "Delete profile",
+      deleteProfileConfirm: "Delete the profile {{name}} and its images?",
+      deleteProfileFailed: "Failed to delete profile",
       saveConfig: "Save Configuration",
       downloadImage: "Download Image",
       buildImage: "Build Image",
@@ -177,10 +407,59 @@ export const en = {
       step6: "The robot will automatically connect to WiFi, start the agent, and appear in the dashboard.",
       buildSuccess: "Image built successfully!",
       buildFailed: "Build failed:",
+      buildInterrupted: "The build was interrupted: {{error}}.",
+      cancelBuild: "Cancel build",
+      cancellingBuild: "Cancelling...",
+      cancelBuildConfirm: "Cancel the build? The partial image is deleted.",
+      cancelBuildFailed: "Failed to cancel build",
+      buildCancelled: "The build was cancelled.",
+      retryFromCache: "Retry from cached base image",
+      queueBuild: "Queue build",
+      buildQueued: "Build queued; {{count}} waiting",
+      history: "Build History",
+      noBuilds: "No builds yet.",
+      queuedAt: "Queued",
+      duration: "Duration",
+      size: "Size",
+      pruned: "Image pruned",
+      smokePassed: "Boots in QEMU",
+      smokeFailed: "QEMU boot failed",
+      keepImages: "Images to keep",
+      keepImagesHelp: "How many of this profile's newest images are kept; older ones are deleted after each build. 0 uses the controller default (BUILD_KEEP_IMAGES, 3).",
+      deleteImage: "Delete image",
+      deleteImageConfirm: "Delete {{name}}? The build stays in the history.",
+      pruneImages: "Delete old images",
+      pruneDone: "Deleted {{count}} images, freeing {{size}}",
+      refreshImage: "Refresh this image with the current agent and user-data, without reinstalling ROS",
+      refreshQueued: "Refresh queued as build {{id}}",
+      refreshOf: "refresh of #{{id}}",
+      diskFree: "{{size}} free",
+      storageArea: {
+        "golden images": "Images",
+        "base image cache": "Base image cache",
+        snapshots: "Snapshots",
+      },
+      imagerRepo: "To flash these images from Raspberry Pi Imager, set its custom repository to",
+      signatureHelp: "Ed25519 signature of the .sha256 file; check it with the key from /api/golden-image/signing-key",
+      status: {
+        queued: "Queued",
+        building: "Building",
+        success: "Success",
+        error: "Failed",
+        interrupted: "Interrupted",
+        cancelled: "Cancelled",
+      },
       startBuildFailed: "Failed to start build",
       saving: "Saving...",
       includeExtras: "Include navigation & SLAM packages",
       includeExtrasHelp: "Installs slam-toolbox, Nav2, Cartographer, and teleop packages. Adds ~2 GB to the image.",
+      labTooling: "Lab tooling",
+      aptPackages: "Extra apt packages",
+      pipPackages: "Extra pip packages",
+      packagesHelp: "Separate packages with spaces. Pin versions like ros-humble-foo=1.2-1 or numpy==1.26.4.",
+      writeFiles: "cloud-init write_files",
+      runCmd: "cloud-init runcmd",
+      cloudInitHelp: "YAML lists, added to the image's user-data after its own files and commands. They run on the robot's first boot.",
     },
     installAgent: {
       title: "Add New {{type}}",
@@ -191,12 +470,21 @@ export const en = {
       ipAddress: "IP Address",
       sshUser: "SSH User",
       sshKey: "SSH Key",
+      keyPassphrase: "SSH Key Passphrase (if the key has one)",
+      keyPassphraseDesc: "Kept with the robot's install settings, encrypted like the key, so the controller can log in again later.",
       enableSudo: "Enable Sudo",
       sudoPassword: "Sudo Password",
       sudoPlaceholder: "Required for sudo",
       install: "Install Agent",
       installing: "Installing...",
       installFailed: "Failed to install agent",
+      manualTitle: "Manual Entry",
+      manualDesc: "Track a machine provisioned by hand. It stays unmanaged until its agent connects under this name or from this IP.",
+      tags: "Tags",
+      tagsPlaceholder: "classA, room2",
+      notes: "Notes",
+      addManually: "Add Robot",
+      manualFailed: "Failed to add robot",
     },
     laptops: {
       title: "Laptops",
@@ -229,6 +517,17 @@ export const en = {
       snapshot: "Snapshot",
       cameraTestDesc: "Capture a single frame from the main camera to verify video feed.",
       testCamera: "Test Camera",
+      liveView: "Live view",
+      stopLiveView: "Stop live view",
+      liveViewFailed: "The live view could not be opened or has ended",
+      sensorCheck: "Sensor Check",
+      sensorCheckDesc: "Read the lidar, camera and odometry once to confirm every sensor is publishing.",
+      checkSensors: "Check Sensors",
+      lidar: "Lidar",
+      camera: "Camera",
+      odometry: "Odometry",
+      lidarPoints: "{{count}} points, nearest {{nearest}} m",
+      sensorCheckFailed: "Sensor check failed",
       snapshotRequested: "Snapshot requested. It should appear below shortly.",
       snapshotFailed: "Failed to request snapshot",
       robotNotFound: "Robot not found",
@@ -243,10 +542,36 @@ export const en = {
       reinstallAgentDesc: "Re-run the installation script via SSH",
       identifyMe: "Identify Me",
       identifyMeDesc: "Beep and flash LEDs",
+      docked: "On dock",
+      undocked: "Off dock",
+      dock: "Dock",
+      dockDesc: "Drive back onto the charging dock",
+      undock: "Undock",
+      undockDesc: "Back off the charging dock",
       identifySent: "Sent!",
       delete: "Delete",
       deleteDesc: "Remove this device from the fleet database",
-      deleteConfirm: "Are you sure you want to delete this device? This cannot be undone.",
+      deleteConfirm: "Are you sure you want to delete this device?",
+      archiveConfirm: "Archive it, keeping its history for reports so it can be restored later? Choose Cancel to delete it and its history permanently.",
+      purgeConfirm: "This device is archived. Delete it and its history permanently? This cannot be undone.",
+      archivedNotice: "Archived on {{date}}. It is hidden from the fleet and receives no commands.",
+      restore: "Restore",
+      restored: "Restored",
+      docker: "Containers",
+      dockerCompose: "Compose project {{name}}",
+      noContainers: "No containers are running.",
+      rollback: "Roll Back",
+      rollbackTo: "Redeploy {{image}}",
+      rollbackPreviousCompose: "Redeploy the previous compose project",
+      rollbackQueued: "Rollback queued",
+      launches: "Launches",
+      estopEngaged: "Emergency stop engaged",
+      estopSince: "Stopped since {{time}}",
+      launchRunning: "Running",
+      launchFailed: "Failed",
+      launchExited: "Exited",
+      stopLaunch: "Stop launch",
+      dismissLaunch: "Dismiss",
       updateRepo: "Update Repository",
       repoUrl: "Repo URL",
       branch: "Branch",
@@ -254,6 +579,25 @@ export const en = {
       updateCode: "Update Code",
       testDriveSnapshot: "Test Drive & Snapshot",
       startTestDrive: "Start Test Drive",
+      nudge: "Nudge",
+      nudgeHint: "Each press drives for half a second within this robot's speed limits.",
+      logLevel: "Debug Logging",
+      logLevelDesc: "Change the log level of ROS nodes for a while. The nodes go back to their previous level when the time is up. Nodes need ROS 2 Iron or later, started with enable_logger_service.",
+      logLevelMinutes: "minutes",
+      logLevelApply: "Set Level",
+      logLevelQueued: "Logging set to {{level}} for {{minutes}} minutes",
+      hostKey: "SSH Host Key",
+      hostKeyDesc: "Recorded the first time the controller logged in. Logins fail if the robot presents another key; reset it after reflashing the robot.",
+      hostKeyNone: "None recorded yet. The next SSH login records the key the robot presents.",
+      hostKeyFirstSeen: "first seen {{time}}",
+      hostKeyResetButton: "Reset",
+      hostKeyConfirmReset: "Forget this robot's host key? Only do this if the robot was reflashed.",
+      hostKeyReset: "Host key reset; the next login records the new one",
+      nudgeForward: "Forward",
+      nudgeBack: "Back",
+      nudgeLeft: "Turn left",
+      nudgeRight: "Turn right",
+      nudgeStop: "Stop",
       logsNotImplemented: "Logs are not yet implemented in the backend.",
       logsHelp: "To view logs, you would typically need a log aggregation service or an API endpoint that streams logs from the agent via MQTT or HTTP.",
       terminalDisabledDemo: "The terminal is unavailable in demo mode.",
@@ -271,6 +615,18 @@ export const en = {
       configHelp: "Define the repository source and ROS launch commands.",
       saveError: "Failed to save scenario",
       loading: "Loading scenario...",
+      repoAuthTitle: "Private Repository Access",
+      repoAuthDesc: "Robots use these credentials to clone the repo. They are stored encrypted and sent only to robots with a payload key.",
+      repoAuthSet: "Credentials are set",
+      repoAuthNone: "No credentials; the repo must be public",
+      repoAuthToken: "HTTPS token",
+      repoAuthSSHKey: "SSH deploy key",
+      repoAuthUsername: "Username (optional)",
+      repoAuthTokenLabel: "Access token",
+      repoAuthKeyLabel: "Private key",
+      repoAuthSave: "Save Credentials",
+      repoAuthRemove: "Remove",
+      repoAuthSaved: "Credentials saved",
     },
     semesterWizard: {
       title: "Semester Start Wizard",
@@ -303,10 +659,52 @@ export const en = {
       inProgress: "Batch Operation In Progress",
       complete: "Batch Operation Complete",
       processedCount: "Processed {{completed}} of {{total}} robots",
+      pausing: "Pausing Batch Operation...",
+      pausingHint: "Robots stop after the step they are on.",
+      paused: "Batch Operation Paused",
+      cancelled: "Batch Operation Cancelled",
+      pause: "Pause",
+      resume: "Resume",
+      cancel: "Cancel Batch",
+      cancelConfirm: "Cancel the batch? Robots that haven't finished are left as they are.",
+      checkRobots: "Check Robots",
+      checking: "Checking robots...",
+      readyCount: "{{ready}} of {{total}} robots ready",
+      notReadyConfirm: "Some robots failed the pre-flight checks. Start anyway?",
+      template: "Template",
+      noTemplate: "None: choose actions below",
+      step: {
+        reinstall: "Reinstall agent",
+        reset_logs: "Reset logs",
+        update_repo: "Update repository",
+        apply_scenarios: "Apply scenarios",
+        self_test: "Run self test",
+        command: "Run {{command}}",
+      },
+      check: {
+        robot: "Robot",
+        heartbeat: "Agent",
+        reachable: "Network",
+        ssh: "SSH",
+        install_config: "Install config",
+        disk: "Disk space",
+        estop: "E-stop",
+      },
       startAnother: "Start Another Batch",
       processing: "Processing...",
       startReset: "Start Semester Reset",
     },
+    semesterHistory: {
+      title: "Past Batches",
+      done: "{{completed}}/{{total}} done",
+      failed: "{{count}} failed",
+      step: "Step",
+      succeeded: "OK",
+      failedHeader: "Failed",
+      avg: "Average",
+      max: "Slowest",
+      startedBy: "Started by {{user}}",
+    },
     deployModal: {
       title: "Deploy Scenario",
       target: "Target: {{name}}",
@@ -316,6 +714,8 @@ export const en = {
       noIp: "No IP",
       deploy: "Deploy ({{count}})",
       deployError: "Failed to deploy scenario",
+      ignoreRequirements: "Ignore scenario requirements",
+      skipped: "{{count}} robot(s) don't meet the scenario's requirements and were skipped:",
     }
   }
 };
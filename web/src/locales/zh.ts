@@ -5,6 +5,7 @@ export const zh = {
       robots: "机器人",
       laptops: "笔记本",
       scenarios: "场景",
+      missions: "任务",
       semesterWizard: "学期向导",
       goldenImage: "黄金镜像",
       settings: "设置",
@@ -39,6 +40,162 @@ export const zh = {
       logs: "日志",
       manage: "管理",
     },
+    estop: {
+      engage: "全部急停",
+      engageHint: "让所有机器人持续发布零速度，直到解除",
+      engaged: "车队急停已启用",
+      robotsStopped: "有机器人处于急停状态",
+      stoppedRobots: "{{count}} 台已停止：{{names}}",
+      waiting: "等待机器人确认",
+      clear: "解除急停",
+      clearConfirm: "解除所有机器人的急停？机器人可能会恢复运动。",
+    },
+    help: {
+      edit: "为本实验室编辑此帮助",
+      reset: "恢复内置帮助",
+      resetConfirm: "用内置内容替换本实验室版本的帮助？",
+      markdownHint: "Markdown：# 标题、列表、**粗体**、`代码`、``` 代码块和 [链接](https://...)。",
+      customized: "由 {{user}} 于 {{time}} 为本实验室编辑",
+    },
+    snapshots: {
+      schedules: "定时快照",
+      schedulesDesc: "在设定时间为所选机器人拍摄相机快照，例如每天上课前。快照失败会触发警报。",
+      name: "名称",
+      namePlaceholder: "早间相机检查",
+      robots: "机器人",
+      when: "时间",
+      lastRun: "上次运行",
+      daily: "每天",
+      daysHint: "未选择日期表示每天。",
+      enabled: "启用",
+      add: "添加计划",
+      runNow: "立即拍摄快照",
+      runQueued: "已请求 {{count}} 台机器人拍摄快照",
+      delete: "删除计划",
+      deleteConfirm: "删除计划“{{name}}”？其快照将保留。",
+      history: "快照历史",
+      pending: "等待机器人上传",
+      scheduled: "定时",
+      requested: "已请求快照，稍后将显示在下方。",
+      failed: "快照失败",
+      loadOlder: "更早",
+      job: "任务 #{{id}}",
+      day: {
+        mon: "周一",
+        tue: "周二",
+        wed: "周三",
+        thu: "周四",
+        fri: "周五",
+        sat: "周六",
+        sun: "周日",
+      },
+    },
+    onboarding: {
+      title: "新机器人默认设置",
+      description: "按类型为首次加入机群的机器人分配场景和标签。代理检测到的平台（turtlebot4、turtlebot3）优先于机器人类型（robot、laptop）。已有场景的机器人保留其场景。",
+      type: "turtlebot4",
+      tags: "标签，用逗号分隔",
+      noScenario: "无场景",
+      add: "添加类型",
+      remove: "删除",
+      save: "保存默认设置",
+      saved: "新机器人默认设置已保存",
+    },
+    missions: {
+      subtitle: "保存航点路线，并通过 Nav2 让机器人沿路线行驶",
+      routes: "路线",
+      new: "新建任务",
+      empty: "还没有任务。在右侧添加航点后保存。",
+      waypointCount: "{{count}} 个航点",
+      name: "任务名称",
+      description: "描述",
+      framePlaceholder: "坐标系（默认 map）",
+      waypoint: "航点",
+      action: "到达后",
+      actionNone: "继续行驶",
+      actionWait: "等待",
+      actionSnapshot: "拍摄快照",
+      waitSec: "等待秒数",
+      addWaypoint: "添加航点",
+      saved: "已保存 {{name}}",
+      deleteConfirm: "删除任务 {{name}}？正在执行的机器人会继续完成。",
+      run: "运行 {{name}}",
+      loops: "圈数",
+      start: "开始",
+      runHint: "机器人名称或选择器，例如 tag=classA，或 all。无法到达的航点会结束该机器人的任务；急停会结束所有任务。",
+      sent: "已发送给 {{count}} 台机器人",
+      skipped: "已跳过（无代理）：{{names}}",
+    },
+    battery: {
+      title: "低电量自动回充",
+      description: "能够自行回充的机器人（TurtleBot 4）电量不足时自动返回充电座，每次都会发出告警。",
+      enabled: "自动回充",
+      lowPct: "低于",
+      saved: "电量策略已保存",
+    },
+    usage: {
+      title: "用量",
+      description: "自 {{date}} 起的用量，以及本部署的限额。",
+      robots: "已注册机器人",
+      activeAgents: "活跃代理",
+      agentsValue: "{{active}}（当前在线 {{online}}）",
+      builds: "黄金镜像构建",
+      storage: "存储",
+      enforced: "已达到限额，超出限额的新机器人、构建或上传将被拒绝。",
+      reported: "已达到限额，仅作提示，不会强制执行。",
+    },
+    enrollment: {
+      title: "自动注册池",
+      description: "使用黄金镜像刷写的机器人首次启动时会自动注册，并使用您在此为其 MAC 地址或序列号指定的名称。注册池为空时，机器人保留随机名称。",
+      name: "名称",
+      mac: "MAC 地址",
+      serial: "序列号",
+      tags: "标签（逗号分隔）",
+      add: "添加",
+      status: "状态",
+      waiting: "等待首次启动",
+      enrolledAt: "已于 {{time}} 注册",
+      confirmDelete: "将 {{name}} 从注册池中移除？已注册的机器人会保留在机队中。",
+      reset: "允许重新注册",
+      confirmReset: "允许 {{name}} 重新注册？请在重新烧录后执行。其代理的载荷密钥会被替换，当前运行的代理将无法再接收凭据。",
+      rotateToken: "更换令牌",
+      confirmRotate: "更换配置令牌？使用旧令牌构建的镜像在重新构建前将无法注册。",
+      rotated: "配置令牌已更换，请重新构建黄金镜像。",
+    },
+    teleop: {
+      start: "实时驾驶（WebRTC）",
+      stop: "结束实时驾驶",
+      connecting: "正在连接机器人…",
+      connectionFailed: "与机器人的连接失败。浏览器必须能直接访问机器人所在的网络。",
+      hint: "按住方向键或 WASD 驾驶。松开半秒后机器人会停下。",
+    },
+    fleetMap: {
+        title: "车队地图",
+        noFrame: "（无坐标系）",
+        tooltip: "{{name}} 位于 ({{x}}, {{y}})，来源 {{source}}，{{time}}",
+        legend: "网格间距 {{meters}} 米。灰色机器人已离线或近期未上报位置。",
+    },
+    bags: {
+      title: "ROS Bag 录制",
+      description: "在此机器人上录制话题以便后续分析。录制结束后 bag 会上传到控制器。",
+      topicsPlaceholder: "/scan /odom（留空录制全部话题）",
+      experimentPlaceholder: "实验（可选）",
+      seconds: "秒",
+      record: "录制",
+      started: "正在录制 {{seconds}} 秒",
+      stopping: "正在停止；停止后将上传 bag",
+      confirmDelete: "删除此 bag？",
+      startedAt: "开始时间",
+      experiment: "实验",
+      topics: "话题",
+      status: "状态",
+      allTopics: "全部",
+      recording: "录制中",
+      stored: "已保存",
+      failed: "失败",
+      stop: "停止",
+      download: "下载",
+    },
     dashboard: {
       title: "任务控制中心",
       subtitle: "车队状态概览",
@@ -62,10 +219,21 @@ export const zh = {
       buildingNewImage: "正在构建新镜像...",
       manageOSImages: "管理操作系统镜像",
       progress: "进度: {{progress}}",
+      fleetHealth: "车队健康",
+      averageScore: "平均分",
+      healthyCount: "{{count}} 台健康",
+      degradedCount: "{{count}} 台降级",
+      unhealthyCount: "{{count}} 台异常",
     },
     robots: {
       subtitle: "管理您的自主车队",
       loading: "正在加载车队数据...",
+      drift: "偏离",
+      driftDetail: "与 {{scenario}} 不一致",
+      containers: "容器",
+      containersDetail: "{{total}} 个中 {{healthy}} 个正常",
+      unmanaged: "未托管",
+      unmanagedDetail: "尚未关联代理",
     },
     scenarios: {
       subtitle: "定义和部署机器人行为",
@@ -74,6 +242,14 @@ export const zh = {
       emptyDescription: "创建您的第一个场景，定义机器人执行的动作序列。",
       createButton: "创建场景",
       deleteConfirm: "您确定要删除此场景吗？",
+      export: "导出",
+      exportTitle: "下载所有场景及其应用记录",
+      import: "导入",
+      importTitle: "从其他控制器导出的文件中添加场景",
+      importConflicts: "{{count}} 个场景已存在但配置不同：{{names}}。是否替换？取消则保留现有场景。",
+      importNothing: "文件中的场景均已存在。",
+      importDone: "导入完成：新建 {{created}} 个，替换 {{replaced}} 个，保留 {{skipped}} 个。",
+      importError: "导入失败：{{message}}",
     },
     login: {
       title: "OpenRobotFleet",
@@ -95,13 +271,21 @@ export const zh = {
       sshKeyDesc: "直接粘贴私钥内容。",
       sshPublicKey: "派生的公钥",
       sshPublicKeyDesc: "此公钥源自上方的私钥，并将添加到机器人的 authorized_keys 中。",
+      keyPassphrase: "私钥口令",
+      keyPassphraseDesc: "仅当上方密钥受口令保护时需要。与密钥一样加密存储。",
+      sshAgentKeys: "SSH Agent 密钥",
+      sshAgentKeysDesc: "控制器还会使用其 SSH agent（SSH_AGENT_SOCKET）中的这些密钥登录。请将其添加到机器人的 authorized_keys；其私钥不会进入数据库。",
+      generateKey: "生成密钥",
+      generateKeyConfirmReplace: "用新密钥替换默认 SSH 密钥？只信任当前密钥的机器人在添加新公钥之前会拒绝登录。",
+      generateKeySuccess: "已生成新的默认 SSH 密钥（{{fingerprint}}）。请将下方公钥写入镜像。",
+      generateKeyPlaintext: "未配置 SECRETS_KEY，私钥以未加密形式存储。",
       saveDefaults: "保存默认值",
       dbManagement: "数据库管理",
       dbManagementDesc: "备份和恢复控制器数据库。",
       backup: "备份数据库",
-      backupDesc: "下载当前 .db 文件",
+      backupDesc: "下载数据库，可选择加密",
       restore: "恢复数据库",
-      restoreDesc: "上传 .db 文件以替换当前文件",
+      restoreDesc: "上传 .db 文件或加密备份以替换当前数据库",
       fleetMaintenance: "车队维护",
       fleetMaintenanceDesc: "影响整个车队的危险操作。请谨慎使用。",
       restartRos: "重启所有 ROS",
@@ -118,11 +302,26 @@ export const zh = {
       restoreConfirm: "警告：这将覆盖当前数据库并重启控制器。所有当前数据将被替换。您确定吗？",
       restoreSuccess: "数据库恢复成功。页面即将重新加载。",
       restoreError: "恢复数据库失败",
+      backupPassphrase: "用于加密备份的口令（备份包含 SSH 密钥和密码）。留空则下载未加密的备份。",
+      backupError: "备份数据库失败",
+      restorePassphrase: "此备份已加密，请输入口令：",
       restartConfirm: "您确定要重启所有机器人的 ROS 吗？",
       rebootConfirm: "您确定要重启所有机器人吗？这将中断所有操作。",
       classOverConfirm: "您确定要停止所有机器人并播放结束会话的声音吗？",
       demoModeDisabled: "演示模式下禁用数据库备份和恢复。",
     },
+    pendingRobots: {
+      title: "等待批准",
+      description: "这些新代理发送了心跳，但未被自动接纳。批准后即加入机队；被拒绝的代理将被忽略。",
+      agent: "代理",
+      reason: "原因",
+      approve: "批准",
+      approvePrompt: "{{agent}} 所运行机器人的名称：",
+      approved: "{{name}} 已加入机队",
+      reject: "拒绝",
+      confirmReject: "拒绝 {{agent}}？在您批准之前，其心跳将被忽略。",
+      rejected: "已拒绝",
+    },
     discovery: {
       title: "网络发现",
       subtitle: "扫描本地网络以查找可用机器人",
@@ -136,6 +335,8 @@ export const zh = {
       portOpen: "端口 {{port}} 开启",
       setupRobot: "设置机器人",
       alreadyManaged: "已管理",
+      pending: "等待批准",
+      rejected: "已拒绝",
     },
     goldenImage: {
       title: "黄金镜像构建器",
@@ -144,6 +345,17 @@ export const zh = {
       saveError: "保存配置失败",
       wifiSsid: "WiFi SSID",
       wifiPassword: "WiFi 密码",
+      extraNetworks: "备用网络",
+      extraNetworksHelp: "机器人也会连接这些网络，例如其他楼宇或热点。使用 NetworkManager 时优先级高者优先；上方的网络始终最优先。",
+      wifiPriority: "优先级",
+      anyBand: "任意频段",
+      hiddenNetwork: "隐藏",
+      wifiSecurity: "安全类型",
+      wpaPersonal: "WPA2 个人",
+      wpaEnterprise: "WPA2 企业",
+      eapIdentity: "身份（如 user@example.edu）",
+      eapAnonymousIdentity: "匿名身份（可选）",
+      addNetwork: "添加网络",
       ubuntuPassword: "Ubuntu 密码",
       ubuntuPasswordHelp: "可选。设置后，除 SSH 密钥外还可使用密码登录。",
       controllerUrl: "控制器 URL",
@@ -152,6 +364,24 @@ export const zh = {
       rosDomainId: "ROS 域 ID",
       robotModel: "机器人型号",
       rosVersion: "ROS 版本",
+      profiles: "镜像配置方案",
+      newProfile: "新建方案",
+      noProfiles: "还没有方案。请在下方填写设置并保存为方案，例如 TB3-Humble。",
+      notBuilt: "未构建",
+      profileName: "方案名称",
+      profileDescription: "描述",
+      downloadUserData: "下载 user-data",
+      flashName: "机器人名称，如 tb3-07",
+      flashForRobot: "机器人专用 user-data",
+      flashHelp: "登记该机器人并下载让存储卡以其身份启动的 user-data。烧录镜像后，用此文件替换卡上 boot 分区中的 user-data。",
+      flashRegistered: "已登记 {{name}}；请将 user-data 复制到卡的 boot 分区",
+      flashExisting: "{{name}} 已登记；请将 user-data 复制到卡的 boot 分区",
+      downloadAutoinstall: "下载 autoinstall",
+      laptopModel: "笔记本 (amd64)",
+      laptopHelp: "笔记本不构建镜像。请用官方 ISO 和本配置的 autoinstall 文件安装 Ubuntu，安装时会装好 ROS desktop 和代理，代理首次启动时自动注册。请先保存配置。",
+      deleteProfile: "删除方案",
+      deleteProfileConfirm: "删除方案 {{name}} 及其所有镜像？",
+      deleteProfileFailed: "删除方案失败",
       saveConfig: "保存配置",
       downloadImage: "下载镜像",
       buildImage: "构建镜像",
@@ -175,10 +405,59 @@ export const zh = {
       step6: "机器人将自动连接 WiFi，启动代理，并出现在仪表盘中。",
       buildSuccess: "镜像构建成功！",
       buildFailed: "构建失败：",
+      buildInterrupted: "构建被中断：{{error}}。",
+      cancelBuild: "取消构建",
+      cancellingBuild: "正在取消...",
+      cancelBuildConfirm: "取消构建？未完成的镜像将被删除。",
+      cancelBuildFailed: "取消构建失败",
+      buildCancelled: "构建已取消。",
+      retryFromCache: "使用缓存的基础镜像重试",
+      queueBuild: "加入构建队列",
+      buildQueued: "已加入构建队列，共 {{count}} 个等待中",
+      history: "构建历史",
+      noBuilds: "还没有构建记录。",
+      queuedAt: "排队时间",
+      duration: "耗时",
+      size: "大小",
+      pruned: "镜像已清理",
+      smokePassed: "QEMU 启动通过",
+      smokeFailed: "QEMU 启动失败",
+      keepImages: "保留镜像数",
+      keepImagesHelp: "保留该配置最新的几个镜像；每次构建后删除更旧的。0 表示使用控制器默认值（BUILD_KEEP_IMAGES，3）。",
+      deleteImage: "删除镜像",
+      deleteImageConfirm: "删除 {{name}}？构建记录会保留。",
+      pruneImages: "删除旧镜像",
+      pruneDone: "已删除 {{count}} 个镜像，释放 {{size}}",
+      refreshImage: "用当前的 Agent 和 user-data 更新此镜像，无需重新安装 ROS",
+      refreshQueued: "更新已排队，构建 {{id}}",
+      refreshOf: "更新自 #{{id}}",
+      diskFree: "剩余 {{size}}",
+      storageArea: {
+        "golden images": "镜像",
+        "base image cache": "基础镜像缓存",
+        snapshots: "快照",
+      },
+      imagerRepo: "在 Raspberry Pi Imager 中将自定义仓库设为以下地址即可烧录这些镜像：",
+      signatureHelp: ".sha256 文件的 Ed25519 签名；可用 /api/golden-image/signing-key 提供的公钥校验",
+      status: {
+        queued: "排队中",
+        building: "构建中",
+        success: "成功",
+        error: "失败",
+        interrupted: "已中断",
+        cancelled: "已取消",
+      },
       startBuildFailed: "启动构建失败",
       saving: "正在保存...",
       includeExtras: "包含导航与 SLAM 软件包",
       includeExtrasHelp: "安装 slam-toolbox、Nav2、Cartographer 及遥控软件包，镜像约增加 2 GB。",
+      labTooling: "实验室工具",
+      aptPackages: "额外 apt 软件包",
+      pipPackages: "额外 pip 软件包",
+      packagesHelp: "软件包之间用空格分隔。可固定版本，如 ros-humble-foo=1.2-1 或 numpy==1.26.4。",
+      writeFiles: "cloud-init write_files",
+      runCmd: "cloud-init runcmd",
+      cloudInitHelp: "YAML 列表，追加在镜像 user-data 自带的文件和命令之后，于机器人首次启动时执行。",
     },
     installAgent: {
       title: "添加新 {{type}}",
@@ -189,12 +468,21 @@ export const zh = {
       ipAddress: "IP 地址",
       sshUser: "SSH 用户",
       sshKey: "SSH 密钥",
+      keyPassphrase: "SSH 密钥口令（如有）",
+      keyPassphraseDesc: "与机器人的安装设置一起保存，并像密钥一样加密，以便控制器之后再次登录。",
       enableSudo: "启用 Sudo",
       sudoPassword: "Sudo 密码",
       sudoPlaceholder: "Sudo 需要",
       install: "安装代理",
       installing: "正在安装...",
       installFailed: "安装代理失败",
+      manualTitle: "手动添加",
+      manualDesc: "登记手动配置的机器。在其代理以此名称或从此 IP 连接之前，它处于未托管状态。",
+      tags: "标签",
+      tagsPlaceholder: "classA, room2",
+      notes: "备注",
+      addManually: "添加机器人",
+      manualFailed: "添加机器人失败",
     },
     laptops: {
       title: "笔记本电脑",
@@ -227,6 +515,17 @@ export const zh = {
       snapshot: "快照",
       cameraTestDesc: "从主相机拍摄单帧以验证视频流。",
       testCamera: "测试相机",
+      liveView: "实时画面",
+      stopLiveView: "停止实时画面",
+      liveViewFailed: "无法打开实时画面或画面已结束",
+      sensorCheck: "传感器检查",
+      sensorCheckDesc: "读取一次激光雷达、相机和里程计，确认所有传感器都在发布数据。",
+      checkSensors: "检查传感器",
+      lidar: "激光雷达",
+      camera: "相机",
+      odometry: "里程计",
+      lidarPoints: "{{count}} 个点，最近 {{nearest}} 米",
+      sensorCheckFailed: "传感器检查失败",
       snapshotRequested: "已请求快照。它应该很快出现在下方。",
       snapshotFailed: "请求快照失败",
       robotNotFound: "未找到机器人",
@@ -241,10 +540,36 @@ export const zh = {
       reinstallAgentDesc: "通过 SSH 重新运行安装脚本",
       identifyMe: "识别我",
       identifyMeDesc: "发出蜂鸣声并闪烁 LED",
+      docked: "已在充电座",
+      undocked: "未在充电座",
+      dock: "回充",
+      dockDesc: "驶回充电座",
+      undock: "离开充电座",
+      undockDesc: "从充电座倒出",
       identifySent: "已发送！",
       delete: "删除",
       deleteDesc: "从车队数据库中移除此设备",
-      deleteConfirm: "您确定要删除此设备吗？此操作无法撤销。",
+      deleteConfirm: "您确定要删除此设备吗？",
+      archiveConfirm: "是否改为归档？其历史记录将保留在报告中，之后可以恢复。选择“取消”将永久删除设备及其历史记录。",
+      purgeConfirm: "此设备已归档。是否永久删除它及其历史记录？此操作无法撤销。",
+      archivedNotice: "已于 {{date}} 归档。它不再显示在车队中，也不会接收命令。",
+      restore: "恢复",
+      restored: "已恢复",
+      docker: "容器",
+      dockerCompose: "Compose 项目 {{name}}",
+      noContainers: "没有正在运行的容器。",
+      rollback: "回滚",
+      rollbackTo: "重新部署 {{image}}",
+      rollbackPreviousCompose: "重新部署上一个 Compose 项目",
+      rollbackQueued: "已排队回滚",
+      launches: "ROS 启动项",
+      estopEngaged: "急停已启用",
+      estopSince: "停止于 {{time}}",
+      launchRunning: "运行中",
+      launchFailed: "失败",
+      launchExited: "已退出",
+      stopLaunch: "停止",
+      dismissLaunch: "移除",
       updateRepo: "更新仓库",
       repoUrl: "仓库 URL",
       branch: "分支",
@@ -252,6 +577,25 @@ export const zh = {
       updateCode: "更新代码",
       testDriveSnapshot: "试驾与快照",
       startTestDrive: "开始试驾",
+      nudge: "微调移动",
+      nudgeHint: "每次点击在该机器人的限速内行驶半秒。",
+      logLevel: "调试日志",
+      logLevelDesc: "临时修改 ROS 节点的日志级别，时间到后自动恢复原级别。节点需为 ROS 2 Iron 或更高版本，并以 enable_logger_service 启动。",
+      logLevelMinutes: "分钟",
+      logLevelApply: "设置级别",
+      logLevelQueued: "日志级别已设为 {{level}}，持续 {{minutes}} 分钟",
+      hostKey: "SSH 主机密钥",
+      hostKeyDesc: "控制器首次登录时记录。机器人出示其他密钥时登录会失败；重新刷写机器人后请重置。",
+      hostKeyNone: "尚未记录。下次 SSH 登录时将记录机器人出示的密钥。",
+      hostKeyFirstSeen: "首次记录于 {{time}}",
+      hostKeyResetButton: "重置",
+      hostKeyConfirmReset: "忘记此机器人的主机密钥？仅在机器人已重新刷写时执行。",
+      hostKeyReset: "主机密钥已重置；下次登录将记录新密钥",
+      nudgeForward: "前进",
+      nudgeBack: "后退",
+      nudgeLeft: "左转",
+      nudgeRight: "右转",
+      nudgeStop: "停止",
       logsNotImplemented: "后端尚未实现日志功能。",
       logsHelp: "要查看日志，您通常需要一个日志聚合服务或通过 MQTT 或 HTTP 从代理流式传输日志的 API 端点。",
     },
@@ -267,6 +611,18 @@ export const zh = {
       configHelp: "定义仓库源和 ROS 启动命令。",
       saveError: "保存场景失败",
       loading: "正在加载场景...",
+      repoAuthTitle: "私有仓库访问",
+      repoAuthDesc: "机器人使用这些凭据克隆仓库。凭据加密存储，只发送给有载荷密钥的机器人。",
+      repoAuthSet: "已设置凭据",
+      repoAuthNone: "未设置凭据；仓库必须是公开的",
+      repoAuthToken: "HTTPS 令牌",
+      repoAuthSSHKey: "SSH 部署密钥",
+      repoAuthUsername: "用户名（可选）",
+      repoAuthTokenLabel: "访问令牌",
+      repoAuthKeyLabel: "私钥",
+      repoAuthSave: "保存凭据",
+      repoAuthRemove: "移除",
+      repoAuthSaved: "凭据已保存",
     },
     semesterWizard: {
       title: "学期启动向导",
@@ -296,10 +652,52 @@ export const zh = {
       inProgress: "批量操作进行中",
       complete: "批量操作完成",
       processedCount: "已处理 {{total}} 台机器人中的 {{completed}} 台",
+      pausing: "正在暂停批量操作...",
+      pausingHint: "机器人将在完成当前步骤后停止。",
+      paused: "批量操作已暂停",
+      cancelled: "批量操作已取消",
+      pause: "暂停",
+      resume: "继续",
+      cancel: "取消批量操作",
+      cancelConfirm: "取消此批量操作？尚未完成的机器人将保持当前状态。",
+      checkRobots: "检查机器人",
+      checking: "正在检查机器人...",
+      readyCount: "{{total}} 台机器人中 {{ready}} 台已就绪",
+      notReadyConfirm: "部分机器人未通过预检。仍要开始吗？",
+      template: "模板",
+      noTemplate: "无：在下方选择操作",
+      step: {
+        reinstall: "重新安装代理",
+        reset_logs: "重置日志",
+        update_repo: "更新代码仓库",
+        apply_scenarios: "应用场景",
+        self_test: "运行自检",
+        command: "运行 {{command}}",
+      },
+      check: {
+        robot: "机器人",
+        heartbeat: "代理",
+        reachable: "网络",
+        ssh: "SSH",
+        install_config: "安装配置",
+        disk: "磁盘空间",
+        estop: "急停",
+      },
       startAnother: "开始另一批次",
       processing: "处理中...",
       startReset: "开始学期重置",
     },
+    semesterHistory: {
+      title: "历史批次",
+      done: "已完成 {{completed}}/{{total}}",
+      failed: "{{count}} 台失败",
+      step: "步骤",
+      succeeded: "成功",
+      failedHeader: "失败",
+      avg: "平均",
+      max: "最慢",
+      startedBy: "由 {{user}} 启动",
+    },
     deployModal: {
       title: "部署场景",
       target: "目标：{{name}}",
@@ -309,6 +707,8 @@ export const zh = {
       noIp: "无 IP",
       deploy: "部署 ({{count}})",
       deployError: "部署场景失败",
+      ignoreRequirements: "忽略场景要求",
+      skipped: "{{count}} 台机器人不满足场景要求，已跳过：",
     }
   }
 };
@@ -1,9 +1,11 @@
 import { Activity, AlertCircle, CheckCircle2, Clock, Laptop, Bot, FileText, GraduationCap, Disc, Loader2 } from "lucide-react";
 import { useEffect, useState } from "react";
-import { getRobots, getScenarios, getSemesterStatus, getBuildStatus } from "../api";
+import { getRobots, getScenarios, getSemesterStatus, getBuildStatus, getFleetSummary } from "../api";
+import type { FleetSummary } from "../api.gen";
 import { Link } from "react-router-dom";
 import { useTranslation } from "react-i18next";
 import { Robot } from "../types";
+import { FleetMap } from "../components/FleetMap";
 import { useWebSocket, WSEvent } from "../contexts/WebSocketContext";
 
 export function Dashboard() {
@@ -14,6 +16,7 @@ export function Dashboard() {
     const [semesterStats, setSemesterStats] = useState({ active: false, progress: "0/0" });
     const [buildStatus, setBuildStatus] = useState("idle");
     const [loading, setLoading] = useState(true);
+    const [summary, setSummary] = useState<FleetSummary | null>(null);
 
     useEffect(() => {
         Promise.all([
@@ -31,6 +34,8 @@ export function Dashboard() {
             setBuildStatus(buildData.status || "idle");
             setLoading(false);
         }).catch(console.error);
+        // Health is extra detail; the dashboard still loads without it
+        getFleetSummary().then(setSummary).catch(console.error);
     }, []);
 
     useEffect(() => {
@@ -120,6 +125,10 @@ export function Dashboard() {
                 />
             </div>
 
+            {summary && <FleetHealthCard summary={summary} />}
+
+            <FleetMap />
+
             {/* Feature Status */}
             <div className="grid grid-cols-1 md:grid-cols-2 gap-4">
                 <FeatureCard
@@ -143,6 +152,54 @@ export function Dashboard() {
     );
 }
 
+function FleetHealthCard({ summary }: { summary: FleetSummary }) {
+    const { t } = useTranslation();
+    const healthy = summary.robots.healthy + summary.laptops.healthy;
+    const degraded = summary.robots.degraded + summary.laptops.degraded;
+    const unhealthy = summary.robots.unhealthy + summary.laptops.unhealthy;
+    const attention = summary.health.filter(h => h.grade !== "healthy").slice(0, 5);
+    const scoreColor = summary.average_score >= 80 ? "text-green-600" : summary.average_score >= 50 ? "text-orange-600" : "text-red-600";
+
+    return (
+        <div className="bg-white p-6 rounded-xl border border-gray-200 shadow-sm">
+            <div className="flex items-center justify-between mb-4">
+                <span className="text-gray-500 text-sm font-medium">{t("dashboard.fleetHealth")}</span>
+                <div className="p-2 bg-gray-50 rounded-lg">
+                    <Activity size={20} className="text-gray-700" />
+                </div>
+            </div>
+            <div className="flex flex-wrap items-end gap-6 mb-4">
+                <div>
+                    <div className={`text-3xl font-bold ${scoreColor}`}>{summary.average_score}</div>
+                    <div className="text-xs text-gray-500">{t("dashboard.averageScore")}</div>
+                </div>
+                <div className="flex gap-4 text-sm">
+                    <span className="flex items-center gap-1 text-green-600"><CheckCircle2 size={16} />{t("dashboard.healthyCount", { count: healthy })}</span>
+                    <span className="flex items-center gap-1 text-orange-600"><Clock size={16} />{t("dashboard.degradedCount", { count: degraded })}</span>
+                    <span className="flex items-center gap-1 text-red-600"><AlertCircle size={16} />{t("dashboard.unhealthyCount", { count: unhealthy })}</span>
+                </div>
+            </div>
+            {attention.length === 0 ? (
+                <div className="text-sm text-gray-500">{t("dashboard.noActiveAlerts")}</div>
+            ) : (
+                <ul className="divide-y divide-gray-100">
+                    {attention.map(h => (
+                        <li key={h.id}>
+                            <Link to={`/${h.type === "laptop" ? "laptops" : "robots"}/${h.id}`} className="flex items-center justify-between gap-4 py-2 hover:bg-gray-50 rounded">
+                                <div>
+                                    <div className="text-sm font-medium text-gray-900">{h.name}</div>
+                                    <div className="text-xs text-gray-500">{h.issues.join(" · ")}</div>
+                                </div>
+                                <span className={`text-sm font-semibold ${h.grade === "degraded" ? "text-orange-600" : "text-red-600"}`}>{h.score}</span>
+                            </Link>
+                        </li>
+                    ))}
+                </ul>
+            )}
+        </div>
+    );
+}
+
 function StatCard({ title, value, icon: Icon, trend, trendColor, to }: any) {
     return (
         <Link to={to} className="block group">
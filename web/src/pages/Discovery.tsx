@@ -97,6 +97,16 @@ export function Discovery() {
                                                     {t("discovery.enrolled")}
                                                 </span>
                                             )}
+                                            {c.status === 'pending' && (
+                                                <span className="text-xs px-2 py-0.5 bg-amber-100 text-amber-800 rounded-full">
+                                                    {t("discovery.pending")}
+                                                </span>
+                                            )}
+                                            {c.status === 'rejected' && (
+                                                <span className="text-xs px-2 py-0.5 bg-red-100 text-red-700 rounded-full">
+                                                    {t("discovery.rejected")}
+                                                </span>
+                                            )}
                                         </div>
                                         <div className="flex items-center gap-3 text-xs text-gray-500 mt-1">
                                             <span>{t("discovery.portOpen", { port: c.port })}</span>
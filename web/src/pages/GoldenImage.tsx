@@ -1,17 +1,17 @@
-import React, { useState, useEffect } from "react";
+import React, { useState, useEffect, useRef } from "react";
 import { useTranslation } from "react-i18next";
-import { buildGoldenImage, getBuildStatus, getGoldenImageConfig, saveGoldenImageConfig, getSystemConfig } from "../api";
-import { GoldenImageConfig } from "../types";
-import { Save, Download, Wifi, Server, Radio, Hash, HardDrive, ChevronDown, ChevronRight, Eye, EyeOff } from "lucide-react";
+import { buildGoldenImage, cancelBuild, getBuildStatus, listImageProfiles, createImageProfile, updateImageProfile, deleteImageProfile, flashImageProfileDevice, getSystemConfig } from "../api";
+import type { ImageProfile } from "../api.gen";
+import { GoldenImageConfig, WifiNetwork } from "../types";
+import { Save, Download, Wifi, Server, Radio, Hash, HardDrive, ChevronDown, ChevronRight, Eye, EyeOff, Plus, X, Trash2 } from "lucide-react";
 import { useNotification } from "../contexts/NotificationContext";
 import { useWebSocket, WSEvent } from "../contexts/WebSocketContext";
+import { HelpPanel } from "../components/HelpPanel";
+import { EnrollmentPool } from "../components/EnrollmentPool";
+import { ImageBuildHistory } from "../components/ImageBuildHistory";
 
-export function GoldenImage() {
-    const { t } = useTranslation();
-    const { success, error } = useNotification();
-    const { addListener } = useWebSocket();
-    const [showWifiPassword, setShowWifiPassword] = useState(false);
-    const [config, setConfig] = useState<GoldenImageConfig>({
+function defaultConfig(): GoldenImageConfig {
+    return {
         wifi_ssid: "",
         wifi_password: "",
         controller_url: window.location.origin,
@@ -22,45 +22,79 @@ export function GoldenImage() {
         ros_version: "Humble",
         ubuntu_password: "",
         include_extras: true
-    });
+    };
+}
+
+function imageSize(bytes: number) {
+    return `${(bytes / (1 << 30)).toFixed(1)} GB`;
+}
+
+export function GoldenImage() {
+    const { t } = useTranslation();
+    const { success, error } = useNotification();
+    const { addListener } = useWebSocket();
+    const [showWifiPassword, setShowWifiPassword] = useState(false);
+    const [profiles, setProfiles] = useState<ImageProfile[]>([]);
+    // selectedId is the profile being edited, or null for a new one.
+    const [selectedId, setSelectedId] = useState<number | null>(null);
+    const [name, setName] = useState("");
+    const [description, setDescription] = useState("");
+    const [config, setConfig] = useState<GoldenImageConfig>(defaultConfig);
     const [showUbuntuPassword, setShowUbuntuPassword] = useState(false);
+    // The package lists as typed, space separated.
+    const [aptText, setAptText] = useState("");
+    const [pipText, setPipText] = useState("");
+    const [flashName, setFlashName] = useState("");
+    const networks = config.wifi_networks || [];
+    const setNetwork = (i: number, n: WifiNetwork) =>
+        setConfig({ ...config, wifi_networks: networks.map((old, j) => j === i ? n : old) });
     const [loading, setLoading] = useState(true);
     const [saving, setSaving] = useState(false);
     const [buildStatus, setBuildStatus] = useState<string>("idle");
+    const [cancelling, setCancelling] = useState(false);
+    const [retryFromCache, setRetryFromCache] = useState(false);
     const [buildError, setBuildError] = useState<string | null>(null);
     const [buildProgress, setBuildProgress] = useState<number>(0);
     const [buildStep, setBuildStep] = useState<string>("");
     const [buildLogs, setBuildLogs] = useState<string[]>([]);
     const [buildImageName, setBuildImageName] = useState<string | null>(null);
+    const [buildProfileId, setBuildProfileId] = useState<number | null>(null);
+    const [buildProfileName, setBuildProfileName] = useState<string>("");
+    // The build shown below; other profiles may be building at the same
+    // time, and their updates are only followed once it has finished.
+    const [buildId, setBuildId] = useState<number | null>(null);
+    const shown = useRef<{ id: number | null; status: string }>({ id: null, status: "idle" });
+    const [buildingProfiles, setBuildingProfiles] = useState<Set<number>>(new Set());
     const [showLogs, setShowLogs] = useState(false);
     const [demoMode, setDemoMode] = useState(false);
 
     useEffect(() => {
         getSystemConfig().then(sys => setDemoMode(sys.demo_mode)).catch(console.error);
 
-        getGoldenImageConfig()
-            .then(data => {
-                if (data.config) {
-                    // Ensure defaults are set if missing from DB
-                    setConfig({
-                        ...data.config,
-                        robot_model: data.config.robot_model || "TB3",
-                        ros_version: data.config.ros_version || "Humble",
-                        include_extras: data.config.include_extras ?? true
-                    });
-                }
+        listImageProfiles()
+            .then(list => {
+                setProfiles(list);
+                if (list.length > 0) selectProfile(list[0]);
             })
             .catch(console.error)
             .finally(() => setLoading(false));
 
         // Check initial build status
         getBuildStatus().then(status => {
+            shown.current = { id: status.build_id || null, status: status.status };
+            setBuildId(status.build_id || null);
             setBuildStatus(status.status);
             if (status.error) setBuildError(status.error);
             if (status.progress) setBuildProgress(status.progress);
             if (status.step) setBuildStep(status.step);
             if (status.logs) setBuildLogs(status.logs);
             if (status.image_name) setBuildImageName(status.image_name);
+            if (status.profile_id) setBuildProfileId(status.profile_id);
+            if (status.profile_name) setBuildProfileName(status.profile_name);
+            setRetryFromCache(!!status.retry_from_cache);
+            const active = status.active?.map(b => b.profile_id) ??
+                (status.status === "building" && status.profile_id ? [status.profile_id] : []);
+            setBuildingProfiles(new Set(active));
         }).catch(console.error);
     }, []);
 
@@ -68,21 +102,86 @@ export function GoldenImage() {
         return addListener((event: WSEvent) => {
             if (event.type === 'build_update') {
                 const data = event.data;
+                if (data.profile_id) {
+                    const profileId = data.profile_id;
+                    setBuildingProfiles(prev => {
+                        const next = new Set(prev);
+                        if (data.status === "building") next.add(profileId);
+                        else next.delete(profileId);
+                        return next;
+                    });
+                }
+                const id = data.build_id || null;
+                if (shown.current.status === "building" && shown.current.id !== null && id !== shown.current.id) return;
+                shown.current = { id, status: data.status };
+                setBuildId(id);
                 setBuildStatus(data.status);
+                if (data.status !== "building") setCancelling(false);
                 setBuildProgress(data.progress);
                 setBuildStep(data.step);
                 setBuildLogs(data.logs);
                 if (data.error) setBuildError(data.error);
                 if (data.image_name) setBuildImageName(data.image_name);
+                if (data.profile_id) setBuildProfileId(data.profile_id);
+                if (data.profile_name) setBuildProfileName(data.profile_name);
+                if (data.status === "success") refreshProfiles();
+                if (data.status === "error" || data.status === "interrupted" || data.status === "cancelled") {
+                    getBuildStatus(id ?? undefined).then(status => setRetryFromCache(!!status.retry_from_cache)).catch(() => {});
+                }
             }
         });
     }, [addListener]);
 
+    const refreshProfiles = () => {
+        listImageProfiles().then(setProfiles).catch(console.error);
+    };
+
+    const selectProfile = (p: ImageProfile) => {
+        const cfg = p.config as GoldenImageConfig;
+        setSelectedId(p.id);
+        setName(p.name);
+        setDescription(p.description || "");
+        // Ensure defaults are set if missing from DB
+        setConfig({
+            ...cfg,
+            robot_model: cfg.robot_model || "TB3",
+            ros_version: cfg.ros_version || "Humble",
+            include_extras: cfg.include_extras ?? true
+        });
+        setAptText((cfg.apt_packages || []).join(" "));
+        setPipText((cfg.pip_packages || []).join(" "));
+    };
+
+    const newProfile = () => {
+        setSelectedId(null);
+        setName("");
+        setDescription("");
+        setConfig(defaultConfig());
+        setAptText("");
+        setPipText("");
+    };
+
+    // saveProfile saves the profile being edited and returns its id.
+    const saveProfile = async () => {
+        const words = (s: string) => s.split(/\s+/).filter(Boolean);
+        const payload = {
+            name,
+            description,
+            config: { ...config, apt_packages: words(aptText), pip_packages: words(pipText) },
+        };
+        const saved = selectedId === null
+            ? await createImageProfile(payload)
+            : await updateImageProfile(selectedId, payload);
+        setSelectedId(saved.id);
+        refreshProfiles();
+        return saved.id;
+    };
+
     const handleSave = async (e: React.FormEvent) => {
         e.preventDefault();
         setSaving(true);
         try {
-            await saveGoldenImageConfig(config);
+            await saveProfile();
             success(t("goldenImage.saveSuccess"));
         } catch (err) {
             error(err instanceof Error ? err.message : t("goldenImage.saveError"));
@@ -91,23 +190,85 @@ export function GoldenImage() {
         }
     };
 
+    const handleDelete = async () => {
+        if (selectedId === null || !confirm(t("goldenImage.deleteProfileConfirm", { name }))) return;
+        try {
+            await deleteImageProfile(selectedId);
+            const list = await listImageProfiles();
+            setProfiles(list);
+            if (list.length > 0) selectProfile(list[0]);
+            else newProfile();
+        } catch (err) {
+            error(err instanceof Error ? err.message : t("goldenImage.deleteProfileFailed"));
+        }
+    };
+
+    // Laptop profiles aren't built; their user-data is an autoinstall file.
+    const isLaptop = config.robot_model === "laptop";
+
     const handleDownload = () => {
-        window.location.href = "/api/golden-image/download";
+        if (selectedId !== null) window.location.href = `/api/image-profiles/${selectedId}/user-data`;
     };
 
-    const handleBuild = async () => {
+    // handleFlash registers the robot named on the card's label and saves
+    // user-data that boots the card as that robot.
+    const handleFlash = async () => {
+        if (selectedId === null || !flashName.trim()) return;
         try {
-            // Save configuration before building to ensure backend has latest settings
-            setSaving(true);
-            await saveGoldenImageConfig(config);
-            setSaving(false);
+            const res = await flashImageProfileDevice(selectedId, { name: flashName.trim() });
+            const url = URL.createObjectURL(new Blob([res.user_data], { type: "text/yaml" }));
+            const link = document.createElement("a");
+            link.href = url;
+            link.download = "user-data";
+            link.click();
+            URL.revokeObjectURL(url);
+            success(t(res.created ? "goldenImage.flashRegistered" : "goldenImage.flashExisting", { name: res.robot.name }));
+            setFlashName("");
+        } catch (e: any) {
+            error(e.message);
+        }
+    };
 
-            await buildGoldenImage();
+    const handleBuild = async (fromCache = false) => {
+        try {
+            let id: number;
+            if (fromCache && buildProfileId !== null) {
+                // Retry the profile whose build failed.
+                id = buildProfileId;
+            } else {
+                // Save the profile before building to ensure backend has latest settings
+                setSaving(true);
+                id = await saveProfile();
+                setSaving(false);
+            }
+
+            const res = await buildGoldenImage(id, fromCache);
+            if (res.status === "queued") {
+                // Other builds are running; this one starts after them.
+                success(t("goldenImage.buildQueued", { count: res.position }));
+                return;
+            }
+            setRetryFromCache(false);
+            shown.current = { id: res.build_id, status: "building" };
+            setBuildId(res.build_id);
             setBuildStatus("building");
+            setBuildProfileId(id);
+            setBuildProfileName(fromCache ? buildProfileName : name);
             setBuildError(null);
         } catch (err) {
             setSaving(false);
-            error(t("goldenImage.startBuildFailed"));
+            error(err instanceof Error ? err.message : t("goldenImage.startBuildFailed"));
+        }
+    };
+
+    const handleCancelBuild = async () => {
+        if (!confirm(t("goldenImage.cancelBuildConfirm"))) return;
+        setCancelling(true);
+        try {
+            await cancelBuild(buildId ?? undefined);
+        } catch (err) {
+            setCancelling(false);
+            error(err instanceof Error ? err.message : t("goldenImage.cancelBuildFailed"));
         }
     };
 
@@ -120,6 +281,10 @@ export function GoldenImage() {
                 <p className="text-gray-500">{t("goldenImage.explanation")}</p>
             </div>
 
+            <div className="mb-6">
+                <HelpPanel topic="golden-image" />
+            </div>
+
             <div className="bg-white rounded-xl border border-gray-200 overflow-hidden">
                 <div className="p-6 border-b border-gray-100 bg-gray-50">
                     <h3 className="font-semibold text-gray-900">{t("goldenImage.title")}</h3>
@@ -128,8 +293,72 @@ export function GoldenImage() {
                     </p>
                 </div>
 
+                <div className="p-6 border-b border-gray-100">
+                    <div className="flex items-center justify-between mb-3">
+                        <h4 className="text-sm font-medium text-gray-900">{t("goldenImage.profiles")}</h4>
+                        <button
+                            type="button"
+                            onClick={newProfile}
+                            className="text-sm text-blue-600 hover:text-blue-700 flex items-center gap-1"
+                        >
+                            <Plus size={14} /> {t("goldenImage.newProfile")}
+                        </button>
+                    </div>
+                    {profiles.length === 0 ? (
+                        <p className="text-sm text-gray-500">{t("goldenImage.noProfiles")}</p>
+                    ) : (
+                        <div className="divide-y divide-gray-100 text-sm">
+                            {profiles.map(p => (
+                                <div
+                                    key={p.id}
+                                    className={`flex items-center gap-3 py-2 px-2 rounded ${p.id === selectedId ? "bg-blue-50" : "hover:bg-gray-50"}`}
+                                >
+                                    <button type="button" onClick={() => selectProfile(p)} className="flex-1 text-left">
+                                        <span className="font-medium text-gray-900">{p.name}</span>
+                                        <span className="ml-2 text-gray-500">{p.config.robot_model || "TB3"} · {p.config.ros_version || "Humble"}</span>
+                                        {buildingProfiles.has(p.id) && (
+                                            <span className="ml-2 text-purple-600">{t("goldenImage.building")}</span>
+                                        )}
+                                    </button>
+                                    {p.image_name ? (
+                                        <a href={`/api/image-profiles/${p.id}/image`} className="text-blue-600 hover:underline flex items-center gap-1">
+                                            <Download size={14} /> {imageSize(p.image_size || 0)}
+                                            {p.built_at && <span className="text-gray-500">· {new Date(p.built_at).toLocaleDateString()}</span>}
+                                        </a>
+                                    ) : (
+                                        <span className="text-gray-400">{t("goldenImage.notBuilt")}</span>
+                                    )}
+                                </div>
+                            ))}
+                        </div>
+                    )}
+                </div>
+
                 <form onSubmit={handleSave} className="p-6 space-y-6">
                     <div className="grid grid-cols-1 md:grid-cols-2 gap-6">
+                        {/* Profile */}
+                        <div>
+                            <label className="block text-xs font-medium text-gray-700 mb-1">{t("goldenImage.profileName")}</label>
+                            <input
+                                required
+                                type="text"
+                                value={name}
+                                onChange={e => setName(e.target.value)}
+                                className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 outline-none"
+                                placeholder="TB3-Humble"
+                            />
+                        </div>
+                        <div>
+                            <label className="block text-xs font-medium text-gray-700 mb-1">{t("goldenImage.profileDescription")}</label>
+                            <input
+                                type="text"
+                                value={description}
+                                onChange={e => setDescription(e.target.value)}
+                                className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 outline-none"
+                                placeholder={t("common.optional") || "optional"}
+                            />
+                        </div>
+
                         {/* Robot & ROS */}
                         <div className="col-span-2">
                             <h4 className="text-sm font-medium text-gray-900 mb-4 flex items-center gap-2">
@@ -145,6 +374,7 @@ export function GoldenImage() {
                                     >
                                         <option value="TB3">Turtlebot 3</option>
                                         <option value="TB4">Turtlebot 4</option>
+                                        <option value="laptop">{t("goldenImage.laptopModel")}</option>
                                     </select>
                                 </div>
                                 <div>
@@ -159,6 +389,7 @@ export function GoldenImage() {
                                     </select>
                                 </div>
                             </div>
+                            {isLaptop && <p className="text-xs text-gray-500 mt-2">{t("goldenImage.laptopHelp")}</p>}
                         </div>
 
                         {/* WiFi */}
@@ -219,6 +450,96 @@ export function GoldenImage() {
                                     <p className="text-xs text-gray-500 mt-1">{t("goldenImage.ubuntuPasswordHelp")}</p>
                                 </div>
                             </div>
+                            <div className="mt-4">
+                                <label className="block text-xs font-medium text-gray-700 mb-1">{t("goldenImage.extraNetworks")}</label>
+                                <p className="text-xs text-gray-500 mb-2">{t("goldenImage.extraNetworksHelp")}</p>
+                                {networks.map((n, i) => (
+                                    <div key={i} className="grid grid-cols-12 gap-2 mb-2 items-center">
+                                        <input
+                                            type="text"
+                                            value={n.ssid}
+                                            onChange={e => setNetwork(i, { ...n, ssid: e.target.value })}
+                                            className="col-span-3 px-3 py-2 border border-gray-300 rounded-lg text-sm"
+                                            placeholder="SSID"
+                                        />
+                                        <input
+                                            type={showWifiPassword ? "text" : "password"}
+                                            value={n.password || ""}
+                                            onChange={e => setNetwork(i, { ...n, password: e.target.value })}
+                                            className="col-span-3 px-3 py-2 border border-gray-300 rounded-lg text-sm"
+                                            placeholder={t("goldenImage.wifiPassword")}
+                                        />
+                                        <input
+                                            type="number"
+                                            min={0}
+                                            max={999}
+                                            value={n.priority ?? 0}
+                                            onChange={e => setNetwork(i, { ...n, priority: parseInt(e.target.value) || 0 })}
+                                            className="col-span-2 px-3 py-2 border border-gray-300 rounded-lg text-sm"
+                                            title={t("goldenImage.wifiPriority")}
+                                        />
+                                        <select
+                                            value={n.band || ""}
+                                            onChange={e => setNetwork(i, { ...n, band: e.target.value as WifiNetwork["band"] })}
+                                            className="col-span-2 px-2 py-2 border border-gray-300 rounded-lg text-sm"
+                                        >
+                                            <option value="">{t("goldenImage.anyBand")}</option>
+                                            <option value="2.4GHz">2.4 GHz</option>
+                                            <option value="5GHz">5 GHz</option>
+                                        </select>
+                                        <label className="col-span-1 flex items-center gap-1 text-xs text-gray-600">
+                                            <input
+                                                type="checkbox"
+                                                checked={!!n.hidden}
+                                                onChange={e => setNetwork(i, { ...n, hidden: e.target.checked })}
+                                            />
+                                            {t("goldenImage.hiddenNetwork")}
+                                        </label>
+                                        <button
+                                            type="button"
+                                            onClick={() => setConfig({ ...config, wifi_networks: networks.filter((_, j) => j !== i) })}
+                                            className="col-span-1 text-gray-400 hover:text-red-600"
+                                        >
+                                            <X size={16} />
+                                        </button>
+                                        <select
+                                            value={n.eap || ""}
+                                            onChange={e => setNetwork(i, { ...n, eap: e.target.value as WifiNetwork["eap"] })}
+                                            className="col-span-3 px-2 py-2 border border-gray-300 rounded-lg text-sm"
+                                            title={t("goldenImage.wifiSecurity")}
+                                        >
+                                            <option value="">{t("goldenImage.wpaPersonal")}</option>
+                                            <option value="peap">{t("goldenImage.wpaEnterprise")} (PEAP)</option>
+                                            <option value="ttls">{t("goldenImage.wpaEnterprise")} (TTLS)</option>
+                                        </select>
+                                        {n.eap && (
+                                            <>
+                                                <input
+                                                    type="text"
+                                                    value={n.identity || ""}
+                                                    onChange={e => setNetwork(i, { ...n, identity: e.target.value })}
+                                                    className="col-span-4 px-3 py-2 border border-gray-300 rounded-lg text-sm"
+                                                    placeholder={t("goldenImage.eapIdentity")}
+                                                />
+                                                <input
+                                                    type="text"
+                                                    value={n.anonymous_identity || ""}
+                                                    onChange={e => setNetwork(i, { ...n, anonymous_identity: e.target.value })}
+                                                    className="col-span-4 px-3 py-2 border border-gray-300 rounded-lg text-sm"
+                                                    placeholder={t("goldenImage.eapAnonymousIdentity")}
+                                                />
+                                            </>
+                                        )}
+                                    </div>
+                                ))}
+                                <button
+                                    type="button"
+                                    onClick={() => setConfig({ ...config, wifi_networks: [...networks, { ssid: "", password: "", priority: 0 }] })}
+                                    className="text-sm text-blue-600 hover:text-blue-700 flex items-center gap-1"
+                                >
+                                    <Plus size={14} /> {t("goldenImage.addNetwork")}
+                                </button>
+                            </div>
                         </div>
 
                         {/* Controller */}
@@ -258,17 +579,19 @@ export function GoldenImage() {
                                 <Radio size={16} /> {t("goldenImage.robotConfig")}
                             </h4>
                             <div className="grid grid-cols-1 md:grid-cols-2 gap-4">
-                                <div>
-                                    <label className="block text-xs font-medium text-gray-700 mb-1">{t("goldenImage.ldsModel")}</label>
-                                    <select
-                                        value={config.lds_model}
-                                        onChange={e => setConfig({ ...config, lds_model: e.target.value })}
-                                        className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 outline-none"
-                                    >
-                                        <option value="LDS-01">LDS-01</option>
-                                        <option value="LDS-02">LDS-02</option>
-                                    </select>
-                                </div>
+                                {!isLaptop && (
+                                    <div>
+                                        <label className="block text-xs font-medium text-gray-700 mb-1">{t("goldenImage.ldsModel")}</label>
+                                        <select
+                                            value={config.lds_model}
+                                            onChange={e => setConfig({ ...config, lds_model: e.target.value })}
+                                            className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 outline-none"
+                                        >
+                                            <option value="LDS-01">LDS-01</option>
+                                            <option value="LDS-02">LDS-02</option>
+                                        </select>
+                                    </div>
+                                )}
                                 <div>
                                     <label className="block text-xs font-medium text-gray-700 mb-1 flex items-center gap-1">
                                         {t("goldenImage.rosDomainId")} <Hash size={12} />
@@ -285,7 +608,7 @@ export function GoldenImage() {
                         </div>
 
                         {/* Extras */}
-                        {config.robot_model !== "TB4" && (
+                        {config.robot_model !== "TB4" && !isLaptop && (
                             <div className="col-span-2">
                                 <label className="flex items-center gap-3 cursor-pointer">
                                     <input
@@ -301,13 +624,80 @@ export function GoldenImage() {
                                 </label>
                             </div>
                         )}
+
+                        {/* Lab tooling */}
+                        <div className="col-span-2 space-y-4">
+                            <h3 className="font-semibold text-gray-900">{t("goldenImage.labTooling")}</h3>
+                            <div className="grid grid-cols-1 md:grid-cols-2 gap-4">
+                                <div>
+                                    <label className="block text-sm font-medium text-gray-700 mb-1">{t("goldenImage.aptPackages")}</label>
+                                    <input
+                                        type="text"
+                                        value={aptText}
+                                        onChange={e => setAptText(e.target.value)}
+                                        placeholder="htop tmux"
+                                        className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 outline-none font-mono text-sm"
+                                    />
+                                </div>
+                                <div>
+                                    <label className="block text-sm font-medium text-gray-700 mb-1">{t("goldenImage.pipPackages")}</label>
+                                    <input
+                                        type="text"
+                                        value={pipText}
+                                        onChange={e => setPipText(e.target.value)}
+                                        placeholder="pyserial numpy==1.26.4"
+                                        className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 outline-none font-mono text-sm"
+                                    />
+                                </div>
+                            </div>
+                            <p className="text-xs text-gray-500">{t("goldenImage.packagesHelp")}</p>
+                            <div className="grid grid-cols-1 md:grid-cols-2 gap-4">
+                                <div>
+                                    <label className="block text-sm font-medium text-gray-700 mb-1">{t("goldenImage.writeFiles")}</label>
+                                    <textarea
+                                        rows={5}
+                                        value={config.write_files || ""}
+                                        onChange={e => setConfig({ ...config, write_files: e.target.value })}
+                                        placeholder={"- path: /etc/lab.conf\n  content: |\n    room=B12"}
+                                        className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 outline-none font-mono text-xs"
+                                    />
+                                </div>
+                                <div>
+                                    <label className="block text-sm font-medium text-gray-700 mb-1">{t("goldenImage.runCmd")}</label>
+                                    <textarea
+                                        rows={5}
+                                        value={config.runcmd || ""}
+                                        onChange={e => setConfig({ ...config, runcmd: e.target.value })}
+                                        placeholder={"- timedatectl set-timezone Europe/London"}
+                                        className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 outline-none font-mono text-xs"
+                                    />
+                                </div>
+                            </div>
+                            <p className="text-xs text-gray-500">{t("goldenImage.cloudInitHelp")}</p>
+                        </div>
+
+                        {/* Retention */}
+                        {!isLaptop && (
+                            <div className="col-span-2">
+                                <label className="block text-sm font-medium text-gray-700 mb-1">{t("goldenImage.keepImages")}</label>
+                                <input
+                                    type="number"
+                                    min={0}
+                                    max={100}
+                                    value={config.keep_images ?? 0}
+                                    onChange={e => setConfig({ ...config, keep_images: parseInt(e.target.value) || 0 })}
+                                    className="w-32 px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 outline-none"
+                                />
+                                <p className="text-xs text-gray-500 mt-1">{t("goldenImage.keepImagesHelp")}</p>
+                            </div>
+                        )}
                     </div>
 
                     <div className="pt-4 border-t border-gray-100">
                         {buildStatus === "building" ? (
                             <div className="space-y-2">
                                 <div className="flex justify-between text-sm text-gray-600">
-                                    <span>{buildStep || t("goldenImage.building")}</span>
+                                    <span>{buildProfileName && <strong className="mr-2">{buildProfileName}</strong>}{buildStep || t("goldenImage.building")}</span>
                                     <span>{buildProgress}%</span>
                                 </div>
                                 <div className="w-full bg-gray-200 rounded-full h-2.5">
@@ -319,6 +709,26 @@ export function GoldenImage() {
                                 <p className="text-xs text-gray-400 text-center">
                                     {t("goldenImage.navigateAway")}
                                 </p>
+                                <div className="flex justify-center gap-4">
+                                    <button
+                                        type="button"
+                                        onClick={handleCancelBuild}
+                                        disabled={cancelling}
+                                        className="text-sm text-red-600 hover:text-red-800 underline disabled:opacity-50"
+                                    >
+                                        {cancelling ? t("goldenImage.cancellingBuild") : t("goldenImage.cancelBuild")}
+                                    </button>
+                                    {!demoMode && (
+                                        <button
+                                            type="button"
+                                            onClick={() => handleBuild()}
+                                            disabled={saving}
+                                            className="text-sm text-purple-700 hover:text-purple-900 underline disabled:opacity-50"
+                                        >
+                                            {t("goldenImage.queueBuild")}
+                                        </button>
+                                    )}
+                                </div>
                             </div>
                         ) : (
                             <div className="flex items-center justify-between">
@@ -331,28 +741,63 @@ export function GoldenImage() {
                                     {saving ? t("goldenImage.saving") : t("goldenImage.saveConfig")}
                                 </button>
 
-                                <button
-                                    type="button"
-                                    onClick={handleBuild}
-                                    disabled={demoMode}
-                                    className={`px-6 py-2 rounded-lg transition-colors flex items-center gap-2 ${demoMode
-                                            ? "bg-gray-300 text-gray-500 cursor-not-allowed"
-                                            : "bg-purple-600 text-white hover:bg-purple-700"
-                                        }`}
-                                    title={demoMode ? "Disabled in Demo Mode" : ""}
-                                >
-                                    <HardDrive size={18} />
-                                    {t("goldenImage.buildImage")}
-                                </button>
+                                {!isLaptop && (
+                                    <button
+                                        type="button"
+                                        onClick={() => handleBuild()}
+                                        disabled={demoMode}
+                                        className={`px-6 py-2 rounded-lg transition-colors flex items-center gap-2 ${demoMode
+                                                ? "bg-gray-300 text-gray-500 cursor-not-allowed"
+                                                : "bg-purple-600 text-white hover:bg-purple-700"
+                                            }`}
+                                        title={demoMode ? "Disabled in Demo Mode" : ""}
+                                    >
+                                        <HardDrive size={18} />
+                                        {t("goldenImage.buildImage")}
+                                    </button>
+                                )}
 
                                 <button
                                     type="button"
                                     onClick={handleDownload}
-                                    className="bg-gray-100 text-gray-700 px-6 py-2 rounded-lg hover:bg-gray-200 transition-colors flex items-center gap-2 border border-gray-300"
+                                    disabled={selectedId === null}
+                                    className="bg-gray-100 text-gray-700 px-6 py-2 rounded-lg hover:bg-gray-200 transition-colors flex items-center gap-2 border border-gray-300 disabled:opacity-50"
                                 >
                                     <Download size={18} />
-                                    {t("goldenImage.downloadImage")}
+                                    {isLaptop ? t("goldenImage.downloadAutoinstall") : t("goldenImage.downloadUserData")}
                                 </button>
+
+                                {selectedId !== null && !isLaptop && (
+                                    <div className="flex items-center gap-2" title={t("goldenImage.flashHelp")}>
+                                        <input
+                                            type="text"
+                                            value={flashName}
+                                            onChange={e => setFlashName(e.target.value)}
+                                            placeholder={t("goldenImage.flashName")}
+                                            className="w-40 px-3 py-2 border border-gray-300 rounded-lg text-sm"
+                                        />
+                                        <button
+                                            type="button"
+                                            onClick={handleFlash}
+                                            disabled={!flashName.trim()}
+                                            className="bg-gray-100 text-gray-700 px-4 py-2 rounded-lg hover:bg-gray-200 transition-colors flex items-center gap-2 border border-gray-300 disabled:opacity-50"
+                                        >
+                                            <Download size={18} />
+                                            {t("goldenImage.flashForRobot")}
+                                        </button>
+                                    </div>
+                                )}
+
+                                {selectedId !== null && (
+                                    <button
+                                        type="button"
+                                        onClick={handleDelete}
+                                        className="text-gray-400 hover:text-red-600"
+                                        title={t("goldenImage.deleteProfile")}
+                                    >
+                                        <Trash2 size={18} />
+                                    </button>
+                                )}
                             </div>
                         )}
                     </div>
@@ -378,8 +823,10 @@ export function GoldenImage() {
 
                     {buildStatus === "success" && (
                         <div className="mt-4 p-4 bg-green-50 text-green-700 rounded-lg text-sm flex items-center justify-between">
-                            <span>Image built successfully! {buildImageName && <strong>{buildImageName}</strong>}</span>
-                            <a href={`/images/${buildImageName || 'turtlebot-golden.img'}`} className="underline font-bold">Download Image</a>
+                            <span>{t("goldenImage.buildSuccess")} {buildImageName && <strong>{buildImageName}</strong>}</span>
+                            {buildProfileId !== null && (
+                                <a href={`/api/image-profiles/${buildProfileId}/image`} className="underline font-bold">{t("goldenImage.downloadImage")}</a>
+                            )}
                         </div>
                     )}
                     {buildStatus === "error" && (
@@ -387,9 +834,32 @@ export function GoldenImage() {
                             Build failed: {buildError}
                         </div>
                     )}
+                    {buildStatus === "interrupted" && (
+                        <div className="mt-4 p-4 bg-amber-50 text-amber-800 rounded-lg text-sm">
+                            {t("goldenImage.buildInterrupted", { error: buildError })}
+                        </div>
+                    )}
+                    {buildStatus === "cancelled" && (
+                        <div className="mt-4 p-4 bg-gray-50 text-gray-700 rounded-lg text-sm">
+                            {t("goldenImage.buildCancelled")}
+                        </div>
+                    )}
+                    {(buildStatus === "error" || buildStatus === "interrupted" || buildStatus === "cancelled") && retryFromCache && !demoMode && (
+                        <button
+                            type="button"
+                            onClick={() => handleBuild(true)}
+                            className="mt-2 text-sm text-purple-700 hover:text-purple-900 underline"
+                        >
+                            {t("goldenImage.retryFromCache")}
+                        </button>
+                    )}
                 </form>
             </div>
 
+            <ImageBuildHistory />
+
+            <EnrollmentPool />
+
             <div className="mt-8 bg-blue-50 border border-blue-100 rounded-xl p-6">
                 <h3 className="font-semibold text-blue-900 mb-2">{t("goldenImage.howToUse")}</h3>
                 <ol className="list-decimal list-inside space-y-2 text-sm text-blue-800">
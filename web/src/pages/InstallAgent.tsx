@@ -1,9 +1,10 @@
 import { useState, useEffect, useRef } from "react";
 import { useNavigate, useLocation } from "react-router-dom";
 import { useTranslation } from "react-i18next";
-import { installAgent, getInstallDefaults } from "../api";
-import { Loader2, Terminal, Eye, EyeOff, Usb, Network } from "lucide-react";
+import { installAgent, getInstallDefaults, createRobot } from "../api";
+import { Loader2, Terminal, Eye, EyeOff, Usb, Network, ClipboardList } from "lucide-react";
 import { SerialTerminal, SerialTerminalRef } from "../components/SerialTerminal";
+import { HelpPanel } from "../components/HelpPanel";
 
 export function InstallAgent() {
     const { t } = useTranslation();
@@ -13,7 +14,8 @@ export function InstallAgent() {
     const [error, setError] = useState<string | null>(null);
     const [showSudoPassword, setShowSudoPassword] = useState(false);
     const [showPassword, setShowPassword] = useState(false);
-    const [mode, setMode] = useState<'ssh' | 'usb'>('ssh');
+    const [hasAgent, setHasAgent] = useState(false);
+    const [mode, setMode] = useState<'ssh' | 'usb' | 'manual'>('ssh');
     const serialRef = useRef<SerialTerminalRef>(null);
     const [serialConnected, setSerialConnected] = useState(false);
 
@@ -23,9 +25,12 @@ export function InstallAgent() {
         address: "",
         user: "ubuntu",
         ssh_key: "",
+        key_passphrase: "",
         password: "",
         sudo: true,
         sudo_password: "",
+        tags: "",
+        notes: "",
     });
 
     useEffect(() => {
@@ -39,7 +44,9 @@ export function InstallAgent() {
                     type,
                     user: data.install_config?.user || prev.user,
                     ssh_key: data.install_config?.ssh_key || prev.ssh_key,
+                    key_passphrase: data.install_config?.key_passphrase || prev.key_passphrase,
                 }));
+                setHasAgent(!!data.install_config.ssh_agent_keys?.length);
             } else {
                 setFormData(prev => ({ ...prev, type }));
             }
@@ -70,6 +77,27 @@ export function InstallAgent() {
         }
     };
 
+    const handleManualSubmit = async (e: React.FormEvent) => {
+        e.preventDefault();
+        setLoading(true);
+        setError(null);
+
+        try {
+            await createRobot({
+                name: formData.name,
+                type: formData.type,
+                ip: formData.address,
+                tags: formData.tags.split(",").map(tag => tag.trim()).filter(Boolean),
+                notes: formData.notes,
+            });
+            navigate(formData.type === 'laptop' ? "/laptops" : "/robots");
+        } catch (err) {
+            setError(err instanceof Error ? err.message : t("installAgent.manualFailed"));
+        } finally {
+            setLoading(false);
+        }
+    };
+
     const handleSerialConnect = async () => {
         if (serialRef.current) {
             await serialRef.current.connect();
@@ -158,17 +186,23 @@ export function InstallAgent() {
                 <p className="text-gray-500">{t("installAgent.subtitle")}</p>
             </div>
 
+            <div className="mb-6">
+                <HelpPanel topic="enrollment" />
+            </div>
+
             <div className="bg-white rounded-xl border border-gray-200 overflow-hidden">
                 <div className="p-6 border-b border-gray-100 bg-gray-50">
                     <div className="flex items-center justify-between mb-4">
                         <div className="flex items-start gap-3">
-                            {mode === 'ssh' ? <Network className="text-blue-600 mt-1" size={20} /> : <Usb className="text-blue-600 mt-1" size={20} />}
+                            {mode === 'ssh' ? <Network className="text-blue-600 mt-1" size={20} /> : mode === 'usb' ? <Usb className="text-blue-600 mt-1" size={20} /> : <ClipboardList className="text-blue-600 mt-1" size={20} />}
                             <div>
-                                <h3 className="font-semibold text-gray-900">{mode === 'ssh' ? "Network Installation (SSH)" : "USB Provisioning (Serial)"}</h3>
+                                <h3 className="font-semibold text-gray-900">{mode === 'ssh' ? "Network Installation (SSH)" : mode === 'usb' ? "USB Provisioning (Serial)" : t("installAgent.manualTitle")}</h3>
                                 <p className="text-sm text-gray-500">
                                     {mode === 'ssh'
                                         ? t("installAgent.detailsDesc")
-                                        : "Connect via USB cable to provision the agent directly."}
+                                        : mode === 'usb'
+                                            ? "Connect via USB cable to provision the agent directly."
+                                            : t("installAgent.manualDesc")}
                                 </p>
                             </div>
                         </div>
@@ -185,6 +219,12 @@ export function InstallAgent() {
                             >
                                 USB
                             </button>
+                            <button
+                                onClick={() => setMode('manual')}
+                                className={`px-3 py-1.5 rounded-md text-sm font-medium transition-all ${mode === 'manual' ? 'bg-white shadow text-gray-900' : 'text-gray-600 hover:text-gray-900'}`}
+                            >
+                                {t("installAgent.manualTitle")}
+                            </button>
                         </div>
                     </div>
                 </div>
@@ -267,7 +307,7 @@ export function InstallAgent() {
                                     {t("installAgent.sshKey")} (Optional if Password provided)
                                 </label>
                                 <textarea
-                                    required={!formData.password}
+                                    required={!formData.password && !hasAgent}
                                     value={formData.ssh_key}
                                     onChange={(e) => setFormData({ ...formData, ssh_key: e.target.value })}
                                     className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 outline-none font-mono text-sm h-32"
@@ -278,6 +318,20 @@ export function InstallAgent() {
                                 </p>
                             </div>
 
+                            <div className="col-span-2">
+                                <label className="block text-sm font-medium text-gray-700 mb-1">
+                                    {t("installAgent.keyPassphrase")}
+                                </label>
+                                <input
+                                    type="password"
+                                    value={formData.key_passphrase}
+                                    onChange={(e) => setFormData({ ...formData, key_passphrase: e.target.value })}
+                                    className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 outline-none"
+                                    autoComplete="off"
+                                />
+                                <p className="mt-1 text-xs text-gray-500">{t("installAgent.keyPassphraseDesc")}</p>
+                            </div>
+
                             <div>
                                 <label className="flex items-center gap-2 text-sm font-medium text-gray-700 mb-1">
                                     <input
@@ -333,6 +387,85 @@ export function InstallAgent() {
                             </button>
                         </div>
                     </form>
+                ) : mode === 'manual' ? (
+                    <form onSubmit={handleManualSubmit} className="p-6 space-y-6">
+                        {error && (
+                            <div className="p-4 bg-red-50 text-red-700 rounded-lg text-sm">
+                                {error}
+                            </div>
+                        )}
+
+                        <div className="grid grid-cols-1 md:grid-cols-2 gap-6">
+                            <div className="col-span-2">
+                                <label className="block text-sm font-medium text-gray-700 mb-1">
+                                    {t("installAgent.robotName")}
+                                </label>
+                                <input
+                                    required
+                                    type="text"
+                                    value={formData.name}
+                                    onChange={(e) => setFormData({ ...formData, name: e.target.value })}
+                                    className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 outline-none"
+                                    placeholder="e.g., openrobot-01"
+                                />
+                            </div>
+
+                            <div>
+                                <label className="block text-sm font-medium text-gray-700 mb-1">
+                                    {t("installAgent.ipAddress")}
+                                </label>
+                                <input
+                                    type="text"
+                                    value={formData.address}
+                                    onChange={(e) => setFormData({ ...formData, address: e.target.value })}
+                                    className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 outline-none"
+                                    placeholder="192.168.1.x"
+                                />
+                            </div>
+
+                            <div>
+                                <label className="block text-sm font-medium text-gray-700 mb-1">
+                                    {t("installAgent.tags")}
+                                </label>
+                                <input
+                                    type="text"
+                                    value={formData.tags}
+                                    onChange={(e) => setFormData({ ...formData, tags: e.target.value })}
+                                    className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 outline-none"
+                                    placeholder={t("installAgent.tagsPlaceholder")}
+                                />
+                            </div>
+
+                            <div className="col-span-2">
+                                <label className="block text-sm font-medium text-gray-700 mb-1">
+                                    {t("installAgent.notes")}
+                                </label>
+                                <textarea
+                                    value={formData.notes}
+                                    onChange={(e) => setFormData({ ...formData, notes: e.target.value })}
+                                    className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 outline-none text-sm h-24"
+                                />
+                            </div>
+                        </div>
+
+                        <div className="pt-4 flex justify-end gap-3">
+                            <button
+                                type="button"
+                                onClick={() => navigate("/robots")}
+                                className="px-4 py-2 text-gray-700 hover:bg-gray-100 rounded-lg font-medium transition-colors"
+                            >
+                                {t("common.cancel")}
+                            </button>
+                            <button
+                                type="submit"
+                                disabled={loading}
+                                className="bg-blue-600 text-white px-6 py-2 rounded-lg hover:bg-blue-700 transition-colors font-medium flex items-center gap-2 disabled:opacity-50"
+                            >
+                                {loading && <Loader2 size={18} className="animate-spin" />}
+                                {t("installAgent.addManually")}
+                            </button>
+                        </div>
+                    </form>
                 ) : (
                     <div className="p-6 space-y-6">
                         <div className="grid grid-cols-1 md:grid-cols-2 gap-6">
@@ -1,7 +1,7 @@
 import { useEffect, useState } from "react";
 import { useParams, useNavigate, useLocation } from "react-router-dom";
 import { useTranslation } from "react-i18next";
-import { getRobot, sendCommand, updateRobotTags, getSystemConfig, deleteRobot, updateRobotName } from "../api";
+import { getRobot, sendCommand, updateRobotTags, getSystemConfig, deleteRobot, restoreRobot, updateRobotName } from "../api";
 import { Robot } from "../types";
 import { ArrowLeft, Terminal, RefreshCw, Power, GitBranch, Save, Activity, Plus, X, Lightbulb, Trash2, Edit2 } from "lucide-react";
 import { Terminal as TerminalView } from "../components/Terminal";
@@ -116,9 +116,15 @@ export function LaptopDetail() {
 
     const handleDelete = async () => {
         if (!robot) return;
-        if (!confirm(t("robotDetail.deleteConfirm"))) return;
+        let purge = true;
+        if (robot.archived_at) {
+            if (!confirm(t("robotDetail.purgeConfirm"))) return;
+        } else {
+            if (!confirm(t("robotDetail.deleteConfirm"))) return;
+            purge = !confirm(t("robotDetail.archiveConfirm"));
+        }
         try {
-            await deleteRobot(robot.id);
+            await deleteRobot(robot.id, purge);
             navigate("/laptops");
         } catch (err) {
             console.error("Failed to delete laptop", err);
@@ -126,11 +132,29 @@ export function LaptopDetail() {
         }
     };
 
+    const handleRestore = async () => {
+        if (!robot) return;
+        try {
+            setRobot(await restoreRobot(robot.id));
+            success(t("robotDetail.restored"));
+        } catch (err) {
+            error(err instanceof Error ? err.message : "Failed to restore laptop");
+        }
+    };
+
     if (loading) return <div className="p-8 text-gray-500">{t("robots.loading")}</div>;
     if (!robot) return <div className="p-8 text-red-500">Laptop not found</div>;
 
     return (
         <div className="max-w-4xl mx-auto space-y-6">
+            {robot.archived_at && (
+                <div className="flex items-center justify-between gap-4 p-4 bg-amber-50 border border-amber-200 rounded-lg text-amber-800">
+                    <span>{t("robotDetail.archivedNotice", { date: new Date(robot.archived_at).toLocaleString() })}</span>
+                    <button onClick={handleRestore} className="px-3 py-1.5 bg-amber-600 text-white rounded-lg hover:bg-amber-700">
+                        {t("robotDetail.restore")}
+                    </button>
+                </div>
+            )}
             {/* Header */}
             <div className="flex items-center gap-4">
                 <button onClick={() => navigate("/laptops")} className="p-2 hover:bg-gray-100 rounded-lg">
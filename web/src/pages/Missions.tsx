@@ -0,0 +1,311 @@
+import { useEffect, useState } from "react";
+import { Plus, Play, Route, Save, Trash2, X } from "lucide-react";
+import { useTranslation } from "react-i18next";
+import { createMission, deleteMission, getJobs, listMissions, runMission, updateMission } from "../api";
+import type { Mission, Waypoint } from "../api.gen";
+import type { Job } from "../types";
+import { useNotification } from "../contexts/NotificationContext";
+
+const emptyWaypoint = (): Waypoint => ({ name: "", x: 0, y: 0, yaw: 0 });
+
+const stepColor: Record<string, string> = {
+    success: "bg-green-500",
+    running: "bg-blue-500 animate-pulse",
+    failed: "bg-red-500",
+    skipped: "bg-gray-300",
+    pending: "bg-gray-200",
+};
+
+// Missions edits waypoint routes and sends robots along them, following
+// each robot's progress from waypoint to waypoint.
+export function Missions() {
+    const { t } = useTranslation();
+    const { success, error } = useNotification();
+    const [missions, setMissions] = useState<Mission[]>([]);
+    const [editing, setEditing] = useState<Mission | null>(null);
+    const [name, setName] = useState("");
+    const [description, setDescription] = useState("");
+    const [frame, setFrame] = useState("");
+    const [waypoints, setWaypoints] = useState<Waypoint[]>([emptyWaypoint()]);
+    const [saving, setSaving] = useState(false);
+    const [targets, setTargets] = useState("all");
+    const [loops, setLoops] = useState(1);
+    const [runIDs, setRunIDs] = useState<number[]>([]);
+    const [runJobs, setRunJobs] = useState<Job[]>([]);
+
+    const load = () => listMissions().then(setMissions).catch(() => {});
+    useEffect(() => {
+        load();
+    }, []);
+
+    // Follow the jobs of the last run until they all finish.
+    useEffect(() => {
+        if (runIDs.length === 0) return;
+        const poll = () =>
+            getJobs()
+                .then(jobs => {
+                    const mine = jobs.filter(j => runIDs.includes(j.id));
+                    setRunJobs(mine);
+                    if (mine.length > 0 && mine.every(j => j.status === "success" || j.status === "failed")) {
+                        setRunIDs([]);
+                    }
+                })
+                .catch(() => {});
+        poll();
+        const timer = setInterval(poll, 2000);
+        return () => clearInterval(timer);
+    }, [runIDs]);
+
+    const edit = (m: Mission | null) => {
+        setEditing(m);
+        setName(m?.name ?? "");
+        setDescription(m?.description ?? "");
+        setFrame(m?.frame ?? "");
+        setWaypoints(m ? m.waypoints.map(wp => ({ ...wp })) : [emptyWaypoint()]);
+    };
+
+    const setWaypoint = (i: number, change: Partial<Waypoint>) =>
+        setWaypoints(waypoints.map((wp, j) => (j === i ? { ...wp, ...change } : wp)));
+
+    const setAction = (i: number, action: string) =>
+        setWaypoint(i, { action: action || undefined, wait_sec: action === "wait" ? waypoints[i].wait_sec || 5 : undefined });
+
+    const handleSave = async () => {
+        setSaving(true);
+        try {
+            const payload = { name, description, frame, waypoints };
+            const saved = editing ? await updateMission(editing.id, payload) : await createMission(payload);
+            success(t("missions.saved", { name: saved.name }));
+            edit(saved);
+            load();
+        } catch (e: any) {
+            error(e.message);
+        } finally {
+            setSaving(false);
+        }
+    };
+
+    const handleDelete = async (m: Mission) => {
+        if (!confirm(t("missions.deleteConfirm", { name: m.name }))) return;
+        try {
+            await deleteMission(m.id);
+            if (editing?.id === m.id) edit(null);
+            load();
+        } catch (e: any) {
+            error(e.message);
+        }
+    };
+
+    const handleRun = async () => {
+        if (!editing) return;
+        try {
+            const resp = await runMission(editing.id, { selector: targets.trim(), loops });
+            if (resp.skipped.length > 0) {
+                error(t("missions.skipped", { names: resp.skipped.join(", ") }));
+            }
+            success(t("missions.sent", { count: resp.jobs.length }));
+            setRunJobs([]);
+            setRunIDs(resp.jobs.map(j => j.id));
+        } catch (e: any) {
+            error(e.message);
+        }
+    };
+
+    const input = "px-2 py-1.5 border border-gray-300 rounded-lg text-sm";
+
+    return (
+        <div className="space-y-6">
+            <div>
+                <h1 className="text-2xl font-bold text-gray-900">{t("common.missions")}</h1>
+                <p className="text-gray-500">{t("missions.subtitle")}</p>
+            </div>
+
+            <div className="grid grid-cols-1 lg:grid-cols-3 gap-6">
+                <div className="bg-white rounded-xl border border-gray-200 overflow-hidden">
+                    <div className="p-4 border-b border-gray-100 flex items-center justify-between">
+                        <h2 className="font-semibold text-gray-900 flex items-center gap-2">
+                            <Route size={18} className="text-blue-500" />
+                            {t("missions.routes")}
+                        </h2>
+                        <button onClick={() => edit(null)} className="p-1.5 text-gray-400 hover:text-blue-600" title={t("missions.new")}>
+                            <Plus size={18} />
+                        </button>
+                    </div>
+                    {missions.length === 0 ? (
+                        <p className="p-4 text-sm text-gray-500">{t("missions.empty")}</p>
+                    ) : (
+                        <ul className="divide-y divide-gray-50">
+                            {missions.map(m => (
+                                <li
+                                    key={m.id}
+                                    onClick={() => edit(m)}
+                                    className={`px-4 py-3 flex items-center justify-between cursor-pointer hover:bg-gray-50 ${editing?.id === m.id ? "bg-blue-50" : ""}`}
+                                >
+                                    <div>
+                                        <div className="font-medium text-gray-900">{m.name}</div>
+                                        <div className="text-xs text-gray-500">{t("missions.waypointCount", { count: m.waypoints.length })}</div>
+                                    </div>
+                                    <button
+                                        onClick={e => {
+                                            e.stopPropagation();
+                                            handleDelete(m);
+                                        }}
+                                        className="p-1.5 text-gray-400 hover:text-red-600"
+                                        title={t("common.delete")}
+                                    >
+                                        <Trash2 size={16} />
+                                    </button>
+                                </li>
+                            ))}
+                        </ul>
+                    )}
+                </div>
+
+                <div className="lg:col-span-2 space-y-6">
+                    <div className="bg-white rounded-xl border border-gray-200 p-6 space-y-4">
+                        <div className="grid grid-cols-1 md:grid-cols-3 gap-3">
+                            <input value={name} onChange={e => setName(e.target.value)} placeholder={t("missions.name")} className={input} />
+                            <input value={frame} onChange={e => setFrame(e.target.value)} placeholder={t("missions.framePlaceholder")} className={`${input} font-mono`} />
+                            <input value={description} onChange={e => setDescription(e.target.value)} placeholder={t("missions.description")} className={input} />
+                        </div>
+                        <table className="w-full text-sm">
+                            <thead>
+                                <tr className="text-left text-gray-500 border-b border-gray-100">
+                                    <th className="py-2 font-medium">#</th>
+                                    <th className="py-2 font-medium">{t("missions.waypoint")}</th>
+                                    <th className="py-2 font-medium">x (m)</th>
+                                    <th className="py-2 font-medium">y (m)</th>
+                                    <th className="py-2 font-medium">yaw (rad)</th>
+                                    <th className="py-2 font-medium">{t("missions.action")}</th>
+                                    <th />
+                                </tr>
+                            </thead>
+                            <tbody>
+                                {waypoints.map((wp, i) => (
+                                    <tr key={i} className="border-b border-gray-50">
+                                        <td className="py-1.5 text-gray-400">{i + 1}</td>
+                                        <td className="py-1.5 pr-2">
+                                            <input value={wp.name ?? ""} onChange={e => setWaypoint(i, { name: e.target.value })} className={`${input} w-full`} />
+                                        </td>
+                                        {(["x", "y", "yaw"] as const).map(k => (
+                                            <td key={k} className="py-1.5 pr-2">
+                                                <input
+                                                    type="number"
+                                                    step="0.1"
+                                                    value={wp[k]}
+                                                    onChange={e => setWaypoint(i, { [k]: parseFloat(e.target.value) || 0 })}
+                                                    className={`${input} w-20`}
+                                                />
+                                            </td>
+                                        ))}
+                                        <td className="py-1.5 pr-2">
+                                            <div className="flex items-center gap-1">
+                                                <select value={wp.action ?? ""} onChange={e => setAction(i, e.target.value)} className={input}>
+                                                    <option value="">{t("missions.actionNone")}</option>
+                                                    <option value="wait">{t("missions.actionWait")}</option>
+                                                    <option value="snapshot">{t("missions.actionSnapshot")}</option>
+                                                </select>
+                                                {wp.action === "wait" && (
+                                                    <input
+                                                        type="number"
+                                                        min={1}
+                                                        max={600}
+                                                        value={wp.wait_sec ?? 5}
+                                                        onChange={e => setWaypoint(i, { wait_sec: parseInt(e.target.value) || 1 })}
+                                                        className={`${input} w-16`}
+                                                        title={t("missions.waitSec")}
+                                                    />
+                                                )}
+                                            </div>
+                                        </td>
+                                        <td className="py-1.5 text-right">
+                                            <button
+                                                onClick={() => setWaypoints(waypoints.filter((_, j) => j !== i))}
+                                                disabled={waypoints.length === 1}
+                                                className="p-1 text-gray-400 hover:text-red-600 disabled:opacity-30"
+                                            >
+                                                <X size={16} />
+                                            </button>
+                                        </td>
+                                    </tr>
+                                ))}
+                            </tbody>
+                        </table>
+                        <div className="flex items-center justify-between">
+                            <button
+                                onClick={() => setWaypoints([...waypoints, emptyWaypoint()])}
+                                className="flex items-center gap-1 text-sm text-blue-600 hover:text-blue-700"
+                            >
+                                <Plus size={16} /> {t("missions.addWaypoint")}
+                            </button>
+                            <button
+                                onClick={handleSave}
+                                disabled={saving || !name.trim()}
+                                className="flex items-center gap-2 bg-blue-600 text-white px-4 py-2 rounded-lg hover:bg-blue-700 transition-colors text-sm disabled:opacity-50"
+                            >
+                                <Save size={16} /> {t("common.save")}
+                            </button>
+                        </div>
+                    </div>
+
+                    {editing && (
+                        <div className="bg-white rounded-xl border border-gray-200 p-6 space-y-4">
+                            <h2 className="font-semibold text-gray-900">{t("missions.run", { name: editing.name })}</h2>
+                            <div className="flex flex-col md:flex-row gap-3">
+                                <input
+                                    value={targets}
+                                    onChange={e => setTargets(e.target.value)}
+                                    placeholder="tag=classA"
+                                    className={`${input} font-mono flex-1`}
+                                />
+                                <label className="flex items-center gap-2 text-sm text-gray-600">
+                                    {t("missions.loops")}
+                                    <input
+                                        type="number"
+                                        min={1}
+                                        max={20}
+                                        value={loops}
+                                        onChange={e => setLoops(parseInt(e.target.value) || 1)}
+                                        className={`${input} w-16`}
+                                    />
+                                </label>
+                                <button
+                                    onClick={handleRun}
+                                    disabled={!targets.trim()}
+                                    className="flex items-center justify-center gap-2 bg-green-600 text-white px-4 py-2 rounded-lg hover:bg-green-700 transition-colors text-sm disabled:opacity-50"
+                                >
+                                    <Play size={16} /> {t("missions.start")}
+                                </button>
+                            </div>
+                            <p className="text-xs text-gray-500">{t("missions.runHint")}</p>
+                            {runJobs.length > 0 && (
+                                <div className="space-y-3">
+                                    {runJobs.map(job => (
+                                        <div key={job.id} className="space-y-1">
+                                            <div className="flex items-center justify-between text-sm">
+                                                <span className="font-medium text-gray-900">{job.target_robot}</span>
+                                                <span className="text-gray-500">
+                                                    {job.status}
+                                                    {job.progress && job.status === "running" ? ` · ${job.progress}` : ""}
+                                                </span>
+                                            </div>
+                                            <div className="flex gap-1">
+                                                {(job.steps ?? []).map((step, i) => (
+                                                    <div
+                                                        key={i}
+                                                        className={`h-2 flex-1 rounded ${stepColor[step.status] ?? "bg-gray-200"}`}
+                                                        title={step.error ? `${step.name}: ${step.error}` : step.name}
+                                                    />
+                                                ))}
+                                            </div>
+                                        </div>
+                                    ))}
+                                </div>
+                            )}
+                        </div>
+                    )}
+                </div>
+            </div>
+        </div>
+    );
+}
@@ -1,10 +1,18 @@
 import { useEffect, useState } from "react";
 import { useParams, useNavigate, useLocation } from "react-router-dom";
 import { useTranslation } from "react-i18next";
-import { getRobot, sendCommand, updateRobotTags, getSystemConfig, deleteRobot, updateRobotName } from "../api";
+import { getRobot, sendCommand, updateRobotTags, getSystemConfig, deleteRobot, restoreRobot, updateRobotName, rollbackDocker, takeRobotSnapshot, listRobotSnapshots } from "../api";
 import { Robot } from "../types";
-import { ArrowLeft, Terminal, RefreshCw, Power, GitBranch, Save, Activity, Tag, Plus, X, Camera, Play, Lightbulb, Trash2, Edit2 } from "lucide-react";
+import { ArrowLeft, Terminal, RefreshCw, Power, GitBranch, Save, Activity, Tag, Plus, X, Camera, Play, Lightbulb, Trash2, Edit2, Box, RotateCcw, Square, OctagonX, BatteryMedium, PlugZap, LogOut } from "lucide-react";
 import { Terminal as TerminalView } from "../components/Terminal";
+import { SensorCheck } from "../components/SensorCheck";
+import { DrivePad } from "../components/DrivePad";
+import { SnapshotHistory } from "../components/SnapshotHistory";
+import { LiveCamera } from "../components/LiveCamera";
+import { Teleop } from "../components/Teleop";
+import { RobotBags } from "../components/RobotBags";
+import { LogLevelControl } from "../components/LogLevelControl";
+import { HostKeyInfo } from "../components/HostKeyInfo";
 import { useNotification } from "../contexts/NotificationContext";
 import { useWebSocket, WSEvent } from "../contexts/WebSocketContext";
 
@@ -26,6 +34,7 @@ export function RobotDetail() {
     const [path, setPath] = useState("");
     const [cmdLoading, setCmdLoading] = useState(false);
     const [snapshotUrl, setSnapshotUrl] = useState<string | null>(null);
+    const [snapshotVersion, setSnapshotVersion] = useState(0);
 
     // Tag state
     const [newTag, setNewTag] = useState("");
@@ -79,6 +88,19 @@ export function RobotDetail() {
         }
     };
 
+    const handleRollback = async () => {
+        if (!robot) return;
+        setCmdLoading(true);
+        try {
+            await rollbackDocker(robot.id);
+            success(t("robotDetail.rollbackQueued"));
+        } catch (err) {
+            error(err instanceof Error ? err.message : t("robotDetail.commandFailed"));
+        } finally {
+            setCmdLoading(false);
+        }
+    };
+
     const handleAddTag = async () => {
         if (!robot || !newTag.trim()) return;
         const updatedTags = [...(robot.tags || []), newTag.trim()];
@@ -126,38 +148,30 @@ export function RobotDetail() {
         setCmdLoading(true);
         setSnapshotUrl(null);
         try {
-            // The agent will upload to /api/robots/:id/upload
-            // We need to tell the agent where to upload.
-            // Since we are on the same network, we can use window.location.origin or a configured URL.
-            // But the agent is on the robot, it needs to reach the controller.
-            // The controller URL is not known by the frontend easily unless we assume relative to current page if agent can reach it.
-            // Actually, the agent config has MQTT broker, but maybe not HTTP controller.
-            // Let's assume the agent can reach the controller at the same IP as the browser is using, or we pass it.
-            // For now, let's try passing the origin + /api/robots/:id/upload
-            const uploadUrl = `${window.location.origin}/api/robots/${robot.id}/upload`;
-            await sendCommand(robot.id, { type: "capture_image", data: { upload_url: uploadUrl } });
-
-            // Poll for the image or just wait a bit and show it
-            // Since the command is async (MQTT), we don't know when it's done.
-            // We can just show a "Check back soon" or try to load the image with retries.
-            success('Snapshot requested. It should appear below shortly.');
-
-            // Simple retry mechanism to show the image
+            // The robot uploads to the controller address this page was
+            // loaded from; the snapshot is filed in its history.
+            const snap = await takeRobotSnapshot(robot.id);
+            setSnapshotVersion(v => v + 1);
+            if (snap.status === "failed") {
+                error(snap.error || t("snapshots.failed"));
+                return;
+            }
+            success(t("snapshots.requested"));
+
             let retries = 0;
-            const checkImage = setInterval(() => {
-                const url = `/snapshots/${robot.id}.jpg?t=${Date.now()}`;
-                const img = new Image();
-                img.onload = () => {
-                    setSnapshotUrl(url);
-                    clearInterval(checkImage);
-                };
-                img.src = url;
+            const checkImage = setInterval(async () => {
                 retries++;
-                if (retries > 10) clearInterval(checkImage);
-            }, 1000);
-
-        } catch (err) {
-            error("Failed to request snapshot");
+                const latest = await listRobotSnapshots(robot.id).catch(() => []);
+                const s = latest.find(l => l.id === snap.id);
+                if (s?.status === "stored" || s?.status === "failed" || retries > 20) {
+                    clearInterval(checkImage);
+                    setSnapshotVersion(v => v + 1);
+                    if (s?.status === "stored" && s.url) setSnapshotUrl(s.url);
+                    if (s?.status === "failed") error(s.error || t("snapshots.failed"));
+                }
+            }, 1500);
+        } catch (err: any) {
+            error(err.message || t("snapshots.failed"));
         } finally {
             setCmdLoading(false);
         }
@@ -165,9 +179,15 @@ export function RobotDetail() {
 
     const handleDelete = async () => {
         if (!robot) return;
-        if (!confirm(t("robotDetail.deleteConfirm"))) return;
+        let purge = true;
+        if (robot.archived_at) {
+            if (!confirm(t("robotDetail.purgeConfirm"))) return;
+        } else {
+            if (!confirm(t("robotDetail.deleteConfirm"))) return;
+            purge = !confirm(t("robotDetail.archiveConfirm"));
+        }
         try {
-            await deleteRobot(robot.id);
+            await deleteRobot(robot.id, purge);
             navigate("/robots");
         } catch (err) {
             console.error("Failed to delete robot", err);
@@ -175,11 +195,47 @@ export function RobotDetail() {
         }
     };
 
+    const handleRestore = async () => {
+        if (!robot) return;
+        try {
+            setRobot(await restoreRobot(robot.id));
+            success(t("robotDetail.restored"));
+        } catch (err) {
+            error(err instanceof Error ? err.message : "Failed to restore robot");
+        }
+    };
+
     if (loading) return <div className="p-8 text-gray-500">{t("robots.loading")}</div>;
     if (!robot) return <div className="p-8 text-red-500">Robot not found</div>;
 
     return (
         <div className="max-w-4xl mx-auto space-y-6">
+            {robot.archived_at && (
+                <div className="flex items-center justify-between gap-4 p-4 bg-amber-50 border border-amber-200 rounded-lg text-amber-800">
+                    <span>{t("robotDetail.archivedNotice", { date: new Date(robot.archived_at).toLocaleString() })}</span>
+                    <button onClick={handleRestore} className="px-3 py-1.5 bg-amber-600 text-white rounded-lg hover:bg-amber-700">
+                        {t("robotDetail.restore")}
+                    </button>
+                </div>
+            )}
+            {robot.estop && (
+                <div className="flex items-center justify-between gap-4 p-4 bg-red-600 text-white rounded-lg">
+                    <div className="flex items-center gap-3 min-w-0">
+                        <OctagonX size={24} className="shrink-0" />
+                        <div className="min-w-0">
+                            <p className="font-bold">{t("robotDetail.estopEngaged")}{robot.estop.reason && <span className="font-normal">: {robot.estop.reason}</span>}</p>
+                            <p className="text-sm text-red-100">{t("robotDetail.estopSince", { time: new Date(robot.estop.since).toLocaleString() })}</p>
+                        </div>
+                    </div>
+                    <button
+                        onClick={() => handleCommand("estop_clear", {})}
+                        disabled={cmdLoading}
+                        className="px-3 py-1.5 border border-white rounded-lg hover:bg-red-700 disabled:opacity-50"
+                    >
+                        {t("estop.clear")}
+                    </button>
+                </div>
+            )}
             {/* Header */}
             <div className="flex items-center gap-4">
                 <button onClick={() => navigate("/robots")} className="p-2 hover:bg-gray-100 rounded-lg">
@@ -258,6 +314,20 @@ export function RobotDetail() {
                         <span className="capitalize">{t(`common.${robot.status}`) || robot.status || t("common.unknown")}</span>
                         <span>•</span>
                         <span className="font-mono">{robot.ip}</span>
+                        {robot.battery !== undefined && (
+                            <>
+                                <span>•</span>
+                                <span className={`flex items-center gap-1 ${robot.battery < 20 ? "text-red-600" : ""}`}>
+                                    <BatteryMedium size={14} /> {Math.round(robot.battery)}%
+                                </span>
+                            </>
+                        )}
+                        {robot.dock && (
+                            <>
+                                <span>•</span>
+                                <span>{robot.dock.docked ? t("robotDetail.docked") : t("robotDetail.undocked")}</span>
+                            </>
+                        )}
                     </div>
                 </div>
             </div>
@@ -334,6 +404,21 @@ export function RobotDetail() {
                                 </div>
                                 <p className="text-xs text-gray-500 group-hover:text-yellow-600">{t("robotDetail.identifyMeDesc")}</p>
                             </button>
+                            {robot.dock && (
+                                <button
+                                    onClick={() => handleCommand(robot.dock?.docked ? "undock" : "dock")}
+                                    disabled={cmdLoading || !!robot.estop}
+                                    className="p-3 border border-gray-200 rounded-lg hover:bg-green-50 hover:border-green-100 text-left transition-colors group disabled:opacity-50"
+                                >
+                                    <div className="flex items-center gap-2 font-medium text-gray-700 group-hover:text-green-700 mb-1">
+                                        {robot.dock.docked ? <LogOut size={16} /> : <PlugZap size={16} />}
+                                        {robot.dock.docked ? t("robotDetail.undock") : t("robotDetail.dock")}
+                                    </div>
+                                    <p className="text-xs text-gray-500 group-hover:text-green-600">
+                                        {robot.dock.docked ? t("robotDetail.undockDesc") : t("robotDetail.dockDesc")}
+                                    </p>
+                                </button>
+                            )}
                             <button
                                 onClick={handleDelete}
                                 disabled={cmdLoading}
@@ -347,6 +432,74 @@ export function RobotDetail() {
                         </div>
                     </div>
 
+                    {robot.docker && (
+                        <div className="bg-white rounded-xl border border-gray-200 p-6">
+                            <h3 className="font-semibold text-gray-900 mb-1 flex items-center gap-2">
+                                <Box size={18} /> {t("robotDetail.docker")}
+                            </h3>
+                            <p className="text-xs text-gray-500 font-mono mb-4 truncate">
+                                {robot.docker.compose ? t("robotDetail.dockerCompose", { name: robot.docker.name }) : robot.docker.image}
+                            </p>
+                            {robot.docker.containers.length === 0 ? (
+                                <p className="text-sm text-gray-500 mb-4">{t("robotDetail.noContainers")}</p>
+                            ) : (
+                                <ul className="space-y-2 mb-4">
+                                    {robot.docker.containers.map(c => (
+                                        <li key={c.name} className="flex items-center justify-between text-sm">
+                                            <span className="font-mono text-gray-700 truncate" title={c.image}>{c.name}</span>
+                                            <span className={`font-medium ${c.state !== "running" || c.health === "unhealthy" ? "text-red-600" : c.health === "starting" ? "text-amber-600" : "text-green-600"}`}>
+                                                {c.health || c.state}
+                                            </span>
+                                        </li>
+                                    ))}
+                                </ul>
+                            )}
+                            {robot.docker.can_rollback && (
+                                <button
+                                    onClick={handleRollback}
+                                    disabled={cmdLoading}
+                                    className="w-full p-3 border border-gray-200 rounded-lg hover:bg-amber-50 hover:border-amber-100 text-left transition-colors group"
+                                >
+                                    <div className="flex items-center gap-2 font-medium text-gray-700 group-hover:text-amber-700 mb-1">
+                                        <RotateCcw size={16} /> {t("robotDetail.rollback")}
+                                    </div>
+                                    <p className="text-xs text-gray-500 group-hover:text-amber-600 truncate">
+                                        {robot.docker.previous_image ? t("robotDetail.rollbackTo", { image: robot.docker.previous_image }) : t("robotDetail.rollbackPreviousCompose")}
+                                    </p>
+                                </button>
+                            )}
+                        </div>
+                    )}
+
+                    {robot.launches && robot.launches.length > 0 && (
+                        <div className="bg-white rounded-xl border border-gray-200 p-6">
+                            <h3 className="font-semibold text-gray-900 mb-4 flex items-center gap-2">
+                                <Play size={18} /> {t("robotDetail.launches")}
+                            </h3>
+                            <ul className="space-y-3">
+                                {robot.launches.map(l => (
+                                    <li key={l.name} className="text-sm">
+                                        <div className="flex items-center justify-between gap-2">
+                                            <span className="font-mono text-gray-700 truncate" title={`ros2 launch ${l.package} ${l.file}`}>{l.name}</span>
+                                            <span className={`font-medium ${l.running ? "text-green-600" : l.error ? "text-red-600" : "text-gray-500"}`}>
+                                                {l.running ? t("robotDetail.launchRunning") : l.error ? t("robotDetail.launchFailed") : t("robotDetail.launchExited")}
+                                            </span>
+                                            <button
+                                                onClick={() => handleCommand("ros_launch_stop", { name: l.name })}
+                                                disabled={cmdLoading}
+                                                className="p-1 text-gray-400 hover:text-red-600"
+                                                title={l.running ? t("robotDetail.stopLaunch") : t("robotDetail.dismissLaunch")}
+                                            >
+                                                {l.running ? <Square size={14} /> : <X size={14} />}
+                                            </button>
+                                        </div>
+                                        {l.error && <p className="text-xs text-red-600 font-mono mt-1 break-all">{l.error}</p>}
+                                    </li>
+                                ))}
+                            </ul>
+                        </div>
+                    )}
+
                     {/* Update Repo */}
                     <div className="bg-white rounded-xl border border-gray-200 p-6">
                         <h3 className="font-semibold text-gray-900 mb-4 flex items-center gap-2">
@@ -412,6 +565,8 @@ export function RobotDetail() {
                             >
                                 <Camera size={16} /> {t("robotDetail.captureImage")}
                             </button>
+                            {robot.type !== "laptop" && <DrivePad robotId={robot.id} />}
+                            {robot.type !== "laptop" && <Teleop robotId={robot.id} />}
                         </div>
                     </div>
 
@@ -463,6 +618,7 @@ export function RobotDetail() {
                                     {cmdLoading ? <RefreshCw className="animate-spin" size={18} /> : <Camera size={18} />}
                                     {t("robotDetail.testCamera")}
                                 </button>
+                                <LiveCamera robotId={robot.id} />
                                 {snapshotUrl && (
                                     <div className="mt-4 rounded-lg overflow-hidden border border-gray-200">
                                         <img src={snapshotUrl} alt="Robot Snapshot" className="w-full h-auto" />
@@ -472,6 +628,16 @@ export function RobotDetail() {
                         </div>
                     </div>
 
+                    {robot.type !== "laptop" && <SensorCheck robotId={robot.id} />}
+
+                    {robot.type !== "laptop" && <LogLevelControl robotId={robot.id} />}
+
+                    {robot.type !== "laptop" && <RobotBags robotId={robot.id} />}
+
+                    <HostKeyInfo robotId={robot.id} />
+
+                    <SnapshotHistory robotId={robot.id} refresh={snapshotVersion} />
+
                     {snapshotUrl && (
                         <div className="col-span-full">
                             <h4 className="font-semibold text-gray-900 mb-2">{t("robotDetail.snapshot")}</h4>
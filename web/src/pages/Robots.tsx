@@ -2,11 +2,13 @@ import { useEffect, useState } from "react";
 import { useNavigate } from "react-router-dom";
 import { getRobots, identifyAll } from "../api";
 import { Robot } from "../types";
-import { Signal, Wifi, Clock, Eye, Settings, Activity } from "lucide-react";
+import type { IdentifyAssignment } from "../api.gen";
+import { Signal, Wifi, Clock, Eye, Settings, Activity, GitBranch, Box } from "lucide-react";
 import { formatDistanceToNow } from "date-fns";
 import { zhCN } from "date-fns/locale";
 import { useTranslation } from "react-i18next";
 import { FleetActionsModal } from "../components/FleetActionsModal";
+import { PendingRobots } from "../components/PendingRobots";
 import { useWebSocket, WSEvent } from "../contexts/WebSocketContext";
 import { getRobotMood } from "../utils/mood";
 
@@ -16,7 +18,7 @@ export function Robots() {
     const [robots, setRobots] = useState<Robot[]>([]);
     const [loading, setLoading] = useState(true);
     const [error, setError] = useState<string | null>(null);
-    const [patterns, setPatterns] = useState<Record<number, string>>({});
+    const [patterns, setPatterns] = useState<Record<number, IdentifyAssignment>>({});
     const [showFleetActions, setShowFleetActions] = useState(false);
     const { addListener } = useWebSocket();
 
@@ -122,6 +124,8 @@ export function Robots() {
                 </div>
             </div>
 
+            <PendingRobots />
+
             <div className="grid grid-cols-1 md:grid-cols-2 lg:grid-cols-3 gap-6">
                 {robots.map((robot) => (
                     <RobotCard key={robot.id} robot={robot} pattern={patterns[robot.id]} />
@@ -157,7 +161,7 @@ function BlinkStatus({ pattern }: { pattern: string }) {
     );
 }
 
-function RobotCard({ robot, pattern }: { robot: Robot, pattern?: string }) {
+function RobotCard({ robot, pattern }: { robot: Robot, pattern?: IdentifyAssignment }) {
     const navigate = useNavigate();
     const { t, i18n } = useTranslation();
     const isOnline = robot.status !== "offline" && robot.status !== "unknown";
@@ -169,8 +173,9 @@ function RobotCard({ robot, pattern }: { robot: Robot, pattern?: string }) {
     return (
         <div className="bg-white rounded-xl border border-gray-200 overflow-hidden hover:shadow-md transition-shadow relative">
             {pattern && (
-                <div className="absolute top-4 right-4 z-10">
-                    <BlinkStatus pattern={pattern} />
+                <div className="absolute top-4 right-4 z-10 flex flex-col items-end gap-1">
+                    <BlinkStatus pattern={pattern.pattern} />
+                    <span className="text-xs text-gray-500">{pattern.description}</span>
                 </div>
             )}
             <div className="p-6">
@@ -188,6 +193,14 @@ function RobotCard({ robot, pattern }: { robot: Robot, pattern?: string }) {
                                 {t(`common.${(robot.status || '').toLowerCase()}`) || robot.status || t("common.unknown")}
                             </span>
                             <span className="ml-2" title="Robot Mood">{getRobotMood(robot)}</span>
+                            {robot.unmanaged && (
+                                <span
+                                    className="ml-1 px-2 py-0.5 text-xs font-medium rounded-full bg-amber-100 text-amber-800"
+                                    title={t("robots.unmanagedDetail")}
+                                >
+                                    {t("robots.unmanaged")}
+                                </span>
+                            )}
                         </div>
                     </div>
                     {!pattern && (
@@ -225,6 +238,30 @@ function RobotCard({ robot, pattern }: { robot: Robot, pattern?: string }) {
                             </span>
                         </div>
                     )}
+                    {robot.drift && (
+                        <div className="flex items-center justify-between text-sm" title={robot.drift.reasons.join("\n")}>
+                            <span className="text-gray-500 flex items-center gap-2">
+                                <GitBranch size={16} /> {t("robots.drift")}
+                            </span>
+                            <span className="font-medium text-amber-600 truncate ml-2">
+                                {t("robots.driftDetail", { scenario: robot.last_scenario?.name })}
+                            </span>
+                        </div>
+                    )}
+                    {robot.docker && (() => {
+                        const containers = robot.docker.containers;
+                        const healthy = containers.filter(c => c.state === "running" && c.health !== "unhealthy" && c.health !== "starting").length;
+                        return (
+                            <div className="flex items-center justify-between text-sm" title={containers.map(c => `${c.name}: ${c.state}${c.health ? ` (${c.health})` : ""}`).join("\n")}>
+                                <span className="text-gray-500 flex items-center gap-2">
+                                    <Box size={16} /> {t("robots.containers")}
+                                </span>
+                                <span className={`font-medium ${containers.length > 0 && healthy === containers.length ? "text-green-600" : "text-red-600"}`}>
+                                    {t("robots.containersDetail", { healthy, total: containers.length })}
+                                </span>
+                            </div>
+                        );
+                    })()}
                 </div>
             </div>
 
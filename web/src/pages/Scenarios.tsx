@@ -1,9 +1,10 @@
-import { FileCode, Play, Plus, Trash2, Edit } from "lucide-react";
-import { useEffect, useState } from "react";
+import { FileCode, Play, Plus, Trash2, Edit, Download, Upload } from "lucide-react";
+import { useEffect, useRef, useState } from "react";
 import { useNavigate } from "react-router-dom";
-import { getScenarios, deleteScenario } from "../api";
+import { getScenarios, deleteScenario, importScenarios } from "../api";
 import { Scenario } from "../types";
 import { DeployModal } from "../components/DeployModal";
+import { HelpPanel } from "../components/HelpPanel";
 import { useTranslation } from "react-i18next";
 
 export function Scenarios() {
@@ -12,6 +13,7 @@ export function Scenarios() {
     const [scenarios, setScenarios] = useState<Scenario[]>([]);
     const [loading, setLoading] = useState(true);
     const [deployTarget, setDeployTarget] = useState<Scenario | null>(null);
+    const fileInputRef = useRef<HTMLInputElement>(null);
 
     const loadScenarios = () => {
         setLoading(true);
@@ -31,6 +33,32 @@ export function Scenarios() {
         }
     };
 
+    const handleExport = () => {
+        window.location.href = "/api/scenarios/export?history=true";
+    };
+
+    const handleImport = async (e: React.ChangeEvent<HTMLInputElement>) => {
+        const file = e.target.files?.[0];
+        if (fileInputRef.current) fileInputRef.current.value = "";
+        if (!file) return;
+        try {
+            const bundle = await file.text();
+            const plan = await importScenarios({ bundle, dry_run: true, on_conflict: "replace" });
+            if (plan.created.length === 0 && plan.replaced.length === 0) {
+                alert(t("scenarios.importNothing"));
+                return;
+            }
+            const replace =
+                plan.replaced.length > 0 &&
+                confirm(t("scenarios.importConflicts", { count: plan.replaced.length, names: plan.replaced.join(", ") }));
+            const res = await importScenarios({ bundle, on_conflict: replace ? "replace" : "skip" });
+            alert(t("scenarios.importDone", { created: res.created.length, replaced: res.replaced.length, skipped: res.skipped.length }));
+            loadScenarios();
+        } catch (err) {
+            alert(t("scenarios.importError", { message: err instanceof Error ? err.message : String(err) }));
+        }
+    };
+
     return (
         <div className="space-y-6">
             <div className="flex flex-col md:flex-row md:items-center justify-between gap-4">
@@ -38,14 +66,39 @@ export function Scenarios() {
                     <h1 className="text-2xl font-bold text-gray-900">{t("common.scenarios")}</h1>
                     <p className="text-gray-500">{t("scenarios.subtitle")}</p>
                 </div>
-                <button
-                    onClick={() => navigate("/scenarios/new")}
-                    className="w-full md:w-auto justify-center bg-blue-600 text-white px-4 py-2 rounded-lg hover:bg-blue-700 transition-colors font-medium flex items-center gap-2"
-                >
-                    <Plus size={18} /> {t("common.newScenario")}
-                </button>
+                <div className="flex flex-col md:flex-row gap-2">
+                    <button
+                        onClick={handleExport}
+                        title={t("scenarios.exportTitle")}
+                        className="w-full md:w-auto justify-center border border-gray-200 text-gray-700 px-4 py-2 rounded-lg hover:bg-gray-50 transition-colors font-medium flex items-center gap-2"
+                    >
+                        <Download size={18} /> {t("scenarios.export")}
+                    </button>
+                    <button
+                        onClick={() => fileInputRef.current?.click()}
+                        title={t("scenarios.importTitle")}
+                        className="w-full md:w-auto justify-center border border-gray-200 text-gray-700 px-4 py-2 rounded-lg hover:bg-gray-50 transition-colors font-medium flex items-center gap-2"
+                    >
+                        <Upload size={18} /> {t("scenarios.import")}
+                    </button>
+                    <input
+                        type="file"
+                        ref={fileInputRef}
+                        onChange={handleImport}
+                        className="hidden"
+                        accept=".json,.yaml,.yml"
+                    />
+                    <button
+                        onClick={() => navigate("/scenarios/new")}
+                        className="w-full md:w-auto justify-center bg-blue-600 text-white px-4 py-2 rounded-lg hover:bg-blue-700 transition-colors font-medium flex items-center gap-2"
+                    >
+                        <Plus size={18} /> {t("common.newScenario")}
+                    </button>
+                </div>
             </div>
 
+            <HelpPanel topic="scenarios" />
+
             {loading ? (
                 <div className="text-center py-12 text-gray-500">{t("scenarios.loading")}</div>
             ) : scenarios.length === 0 ? (
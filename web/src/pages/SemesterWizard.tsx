@@ -1,8 +1,10 @@
 import { useEffect, useState } from "react";
 import { useTranslation } from "react-i18next";
-import { getRobots, getInstallDefaults, startSemesterBatch, getSemesterStatus, getScenarios } from "../api";
+import { getRobots, getInstallDefaults, startSemesterBatch, getSemesterStatus, getScenarios, pauseSemesterBatch, resumeSemesterBatch, cancelSemesterBatch, preflightSemesterBatch, listSemesterTemplates } from "../api";
+import type { SemesterPreflight, SemesterTemplate } from "../api.gen";
 import { Robot, InstallConfig, SemesterStatus, Scenario } from "../types";
-import { Check, RefreshCw, GitBranch, Trash2, AlertTriangle, ArrowRight, Clock, Terminal, XCircle, Activity, FileText } from "lucide-react";
+import { SemesterHistory } from "../components/SemesterHistory";
+import { Check, RefreshCw, GitBranch, Trash2, AlertTriangle, ArrowRight, Clock, Terminal, XCircle, Activity, FileText, Pause, Play, Ban, ClipboardCheck, ListOrdered } from "lucide-react";
 
 export function SemesterWizard() {
     const { t } = useTranslation();
@@ -13,6 +15,8 @@ export function SemesterWizard() {
     const [executing, setExecuting] = useState(false);
     const [batchStarted, setBatchStarted] = useState(false);
     const [status, setStatus] = useState<SemesterStatus | null>(null);
+    const [checking, setChecking] = useState(false);
+    const [preflight, setPreflight] = useState<SemesterPreflight | null>(null);
 
     // Actions
     const [doResetLogs, setDoResetLogs] = useState(false);
@@ -22,16 +26,20 @@ export function SemesterWizard() {
     const [doReinstall, setDoReinstall] = useState(false);
     const [doSelfTest, setDoSelfTest] = useState(false);
     const [repoUrl, setRepoUrl] = useState("https://github.com/openrobot-fleet/openrobotfleet-agent.git");
+    // A saved template replaces the actions below with its own steps.
+    const [templates, setTemplates] = useState<SemesterTemplate[]>([]);
+    const [templateId, setTemplateId] = useState(0);
 
     // Global install defaults
     const [installDefaults, setInstallDefaults] = useState<InstallConfig | null>(null);
     const [isDemoMode, setIsDemoMode] = useState(false);
 
     useEffect(() => {
-        Promise.all([getRobots(), getInstallDefaults(), getScenarios()])
-            .then(([robotsData, defaultsData, scenariosData]) => {
+        Promise.all([getRobots(), getInstallDefaults(), getScenarios(), listSemesterTemplates().catch(() => [])])
+            .then(([robotsData, defaultsData, scenariosData, templatesData]) => {
                 setRobots(robotsData);
                 setScenarios(scenariosData);
+                setTemplates(templatesData);
                 setSelectedIds(new Set(robotsData.map(r => r.id)));
                 if (defaultsData.install_config) {
                     setInstallDefaults(defaultsData.install_config);
@@ -47,7 +55,9 @@ export function SemesterWizard() {
         const poll = async () => {
             try {
                 const s = await getSemesterStatus();
-                if (s.active) {
+                // A paused batch, including one a restart interrupted,
+                // waits here to be resumed or cancelled.
+                if (s.active || s.state === "paused") {
                     setBatchStarted(true);
                     setStatus(s);
                 } else if (batchStarted) {
@@ -78,26 +88,44 @@ export function SemesterWizard() {
         }
     };
 
+    const batchRequest = () => ({
+        robot_ids: Array.from(selectedIds),
+        reinstall: doReinstall,
+        reset_logs: doResetLogs,
+        update_repo: doUpdateRepo,
+        run_self_test: doSelfTest,
+        repo_config: {
+            repo: repoUrl,
+            branch: "main",
+            path: ""
+        },
+        apply_scenarios: doApplyScenario,
+        scenario_ids: doApplyScenario ? Array.from(selectedScenarioIds) : [],
+        template_id: templateId || undefined
+    });
+
+    const template = templates.find(tpl => tpl.id === templateId);
+    const hasActions = !!template || doResetLogs || doUpdateRepo || doReinstall || doSelfTest || doApplyScenario;
+
+    const handlePreflight = async () => {
+        setChecking(true);
+        try {
+            setPreflight(await preflightSemesterBatch(batchRequest()));
+        } catch (err: any) {
+            alert(err.message);
+        } finally {
+            setChecking(false);
+        }
+    };
+
     const handleExecute = async () => {
         if (selectedIds.size === 0) return;
-        if (!doResetLogs && !doUpdateRepo && !doReinstall && !doSelfTest && !doApplyScenario) return;
+        if (!hasActions) return;
+        if (preflight && !preflight.ready && !confirm(t("semesterWizard.notReadyConfirm"))) return;
 
         setExecuting(true);
         try {
-            await startSemesterBatch({
-                robot_ids: Array.from(selectedIds),
-                reinstall: doReinstall,
-                reset_logs: doResetLogs,
-                update_repo: doUpdateRepo,
-                run_self_test: doSelfTest,
-                repo_config: {
-                    repo: repoUrl,
-                    branch: "main",
-                    path: ""
-                },
-                apply_scenarios: doApplyScenario,
-                scenario_ids: doApplyScenario ? Array.from(selectedScenarioIds) : []
-            });
+            await startSemesterBatch(batchRequest());
             setBatchStarted(true);
         } catch (err) {
             console.error("Failed to start batch", err);
@@ -107,6 +135,14 @@ export function SemesterWizard() {
         }
     };
 
+    const batchAction = async (action: () => Promise<SemesterStatus>) => {
+        try {
+            setStatus(await action());
+        } catch (err: any) {
+            alert(err.message);
+        }
+    };
+
     if (loading) return <div className="p-8">{t("common.loading")}</div>;
 
     if (batchStarted && !status) {
@@ -119,18 +155,45 @@ export function SemesterWizard() {
     }
 
     if (batchStarted && status) {
+        const paused = status.state === "paused";
+        const cancelled = status.state === "cancelled";
+        const heading = paused
+            ? (status.active ? t("semesterWizard.pausing") : t("semesterWizard.paused"))
+            : cancelled ? t("semesterWizard.cancelled")
+            : status.active ? t("semesterWizard.inProgress") : t("semesterWizard.complete");
         return (
             <div className="max-w-4xl mx-auto space-y-8">
                 <div className="text-center py-8">
-                    <div className={`w-16 h-16 rounded-full flex items-center justify-center mx-auto mb-4 ${status.active ? 'bg-blue-100 text-blue-600' : 'bg-green-100 text-green-600'}`}>
-                        {status.active ? <RefreshCw className="animate-spin" size={32} /> : <Check size={32} />}
+                    <div className={`w-16 h-16 rounded-full flex items-center justify-center mx-auto mb-4 ${paused ? 'bg-yellow-100 text-yellow-600' : cancelled ? 'bg-gray-100 text-gray-600' : status.active ? 'bg-blue-100 text-blue-600' : 'bg-green-100 text-green-600'}`}>
+                        {paused ? <Pause size={32} /> : cancelled ? <Ban size={32} /> : status.active ? <RefreshCw className="animate-spin" size={32} /> : <Check size={32} />}
                     </div>
                     <h2 className="text-2xl font-bold text-gray-900 mb-2">
-                        {status.active ? t("semesterWizard.inProgress") : t("semesterWizard.complete")}
+                        {heading}
                     </h2>
                     <p className="text-gray-500">
                         {t("semesterWizard.processedCount", { completed: status.completed, total: status.total })}
                     </p>
+                    {paused && status.active && <p className="text-sm text-gray-500 mt-1">{t("semesterWizard.pausingHint")}</p>}
+                    {(status.state === "running" || paused) && (
+                        <div className="flex justify-center gap-3 mt-4">
+                            {status.state === "running" && (
+                                <button onClick={() => batchAction(pauseSemesterBatch)} className="flex items-center gap-2 px-4 py-2 rounded-lg bg-gray-100 hover:bg-gray-200 text-gray-900">
+                                    <Pause size={16} /> {t("semesterWizard.pause")}
+                                </button>
+                            )}
+                            {paused && !status.active && (
+                                <button onClick={() => batchAction(resumeSemesterBatch)} className="flex items-center gap-2 px-4 py-2 rounded-lg bg-blue-600 hover:bg-blue-700 text-white">
+                                    <Play size={16} /> {t("semesterWizard.resume")}
+                                </button>
+                            )}
+                            <button
+                                onClick={() => confirm(t("semesterWizard.cancelConfirm")) && batchAction(cancelSemesterBatch)}
+                                className="flex items-center gap-2 px-4 py-2 rounded-lg bg-red-50 hover:bg-red-100 text-red-700"
+                            >
+                                <Ban size={16} /> {t("semesterWizard.cancel")}
+                            </button>
+                        </div>
+                    )}
                 </div>
 
                 <div className="bg-white border border-gray-200 rounded-lg overflow-hidden">
@@ -148,6 +211,8 @@ export function SemesterWizard() {
                                 {status.robots[robot.id.toString()] === 'error' && <XCircle className="text-red-500" size={20} />}
                                 {status.robots[robot.id.toString()] === 'processing' && <RefreshCw className="text-blue-500 animate-spin" size={20} />}
                                 {status.robots[robot.id.toString()] === 'pending' && <Clock className="text-gray-400" size={20} />}
+                                {status.robots[robot.id.toString()] === 'paused' && <Pause className="text-yellow-500" size={20} />}
+                                {status.robots[robot.id.toString()] === 'cancelled' && <Ban className="text-gray-400" size={20} />}
                             </div>
                             {status.errors[robot.id.toString()] && (
                                 <div className="ml-4 text-sm text-red-600 max-w-xs truncate" title={status.errors[robot.id.toString()]}>
@@ -158,7 +223,7 @@ export function SemesterWizard() {
                     ))}
                 </div>
 
-                {!status.active && (
+                {!status.active && !paused && (
                     <div className="text-center">
                         <button
                             onClick={() => window.location.reload()}
@@ -221,6 +286,35 @@ export function SemesterWizard() {
                 <div className="space-y-6">
                     <div>
                         <h2 className="text-lg font-semibold mb-4">{t("semesterWizard.configureActions")}</h2>
+                        {templates.length > 0 && (
+                            <div className="mb-4">
+                                <label className="block text-sm font-medium text-gray-700 mb-1">{t("semesterWizard.template")}</label>
+                                <select
+                                    value={templateId}
+                                    onChange={e => setTemplateId(Number(e.target.value))}
+                                    className="w-full border border-gray-300 rounded px-3 py-2 text-sm"
+                                >
+                                    <option value={0}>{t("semesterWizard.noTemplate")}</option>
+                                    {templates.map(tpl => (
+                                        <option key={tpl.id} value={tpl.id}>{tpl.name}</option>
+                                    ))}
+                                </select>
+                            </div>
+                        )}
+                        {template ? (
+                            <div className="bg-white border border-gray-200 rounded-lg p-4">
+                                {template.description && <p className="text-sm text-gray-500 mb-3">{template.description}</p>}
+                                <ol className="space-y-2">
+                                    {template.steps.map((step, i) => (
+                                        <li key={i} className="flex items-center gap-2 text-sm text-gray-900">
+                                            <ListOrdered size={16} className="text-gray-400" />
+                                            <span className="font-medium">{i + 1}.</span>
+                                            {step.name || t(`semesterWizard.step.${step.type}`, { command: step.command })}
+                                        </li>
+                                    ))}
+                                </ol>
+                            </div>
+                        ) : (
                         <div className="bg-white border border-gray-200 rounded-lg p-4 space-y-4">
 
                             {/* Reset Logs */}
@@ -366,12 +460,47 @@ export function SemesterWizard() {
                                 </div>
                             </label>
                         </div>
+                        )}
                     </div>
 
+                    <button
+                        onClick={handlePreflight}
+                        disabled={checking || selectedIds.size === 0}
+                        className="w-full mb-3 py-2 rounded-lg font-medium flex items-center justify-center gap-2 bg-gray-100 text-gray-900 hover:bg-gray-200 disabled:opacity-50"
+                    >
+                        {checking ? <RefreshCw className="animate-spin" size={18} /> : <ClipboardCheck size={18} />}
+                        {checking ? t("semesterWizard.checking") : t("semesterWizard.checkRobots")}
+                    </button>
+
+                    {preflight && (
+                        <div className="mb-4 border border-gray-200 rounded-lg divide-y divide-gray-100 text-sm">
+                            <div className={`px-3 py-2 font-medium ${preflight.ready ? "text-green-700" : "text-red-700"}`}>
+                                {t("semesterWizard.readyCount", { ready: preflight.robots.filter(r => r.ready).length, total: preflight.robots.length })}
+                            </div>
+                            {preflight.robots.map(r => {
+                                const problems = r.checks.filter(c => c.status !== "ok");
+                                return (
+                                    <div key={r.robot_id} className="px-3 py-2">
+                                        <div className="flex items-center gap-2 font-medium text-gray-900">
+                                            {r.ready ? <Check className="text-green-500" size={16} /> : <XCircle className="text-red-500" size={16} />}
+                                            {r.name}
+                                        </div>
+                                        {problems.map(c => (
+                                            <div key={c.name} className={`ml-6 flex items-start gap-1 ${c.status === "fail" ? "text-red-600" : "text-yellow-700"}`}>
+                                                <AlertTriangle size={14} className="mt-0.5 shrink-0" />
+                                                <span><span className="font-medium">{t(`semesterWizard.check.${c.name}`, { defaultValue: c.name })}</span>: {c.detail}</span>
+                                            </div>
+                                        ))}
+                                    </div>
+                                );
+                            })}
+                        </div>
+                    )}
+
                     <button
                         onClick={handleExecute}
-                        disabled={executing || selectedIds.size === 0 || (!doResetLogs && !doUpdateRepo && !doReinstall && !doSelfTest && !doApplyScenario)}
-                        className={`w-full py-3 rounded-lg font-medium flex items-center justify-center gap-2 ${executing || selectedIds.size === 0 || (!doResetLogs && !doUpdateRepo && !doReinstall && !doSelfTest && !doApplyScenario)
+                        disabled={executing || selectedIds.size === 0 || !hasActions}
+                        className={`w-full py-3 rounded-lg font-medium flex items-center justify-center gap-2 ${executing || selectedIds.size === 0 || !hasActions
                             ? "bg-gray-100 text-gray-400 cursor-not-allowed"
                             : "bg-blue-600 text-white hover:bg-blue-700 shadow-sm"
                             }`}
@@ -388,6 +517,8 @@ export function SemesterWizard() {
                     </button>
                 </div>
             </div>
+
+            <SemesterHistory />
         </div>
     );
 }
@@ -1,9 +1,13 @@
-import { Save, Loader2, Download, Upload, Database, Eye, EyeOff } from "lucide-react";
+import { Save, Loader2, Download, Upload, Database, Eye, EyeOff, KeyRound } from "lucide-react";
 import { useEffect, useState, useRef } from "react";
-import { getInstallDefaults, updateInstallDefaults, getSystemConfig } from "../api";
+import { getInstallDefaults, updateInstallDefaults, getSystemConfig, generateSSHKey } from "../api";
 import { InstallConfig } from "../types";
 import { useTranslation } from "react-i18next";
 import { useNotification } from "../contexts/NotificationContext";
+import { SnapshotSchedules } from "../components/SnapshotSchedules";
+import { OnboardingDefaults } from "../components/OnboardingDefaults";
+import { BatteryPolicy } from "../components/BatteryPolicy";
+import { Usage } from "../components/Usage";
 
 export function Settings() {
     const { t } = useTranslation();
@@ -44,8 +48,56 @@ export function Settings() {
         }
     };
 
-    const handleBackup = () => {
-        window.location.href = '/api/settings/backup';
+    const handleGenerateKey = async () => {
+        const replace = !!config.ssh_key;
+        if (replace && !confirm(t("settings.generateKeyConfirmReplace"))) return;
+        setSaving(true);
+        try {
+            const res = await generateSSHKey(replace);
+            const data = await getInstallDefaults();
+            if (data.install_config) {
+                setConfig(data.install_config);
+            }
+            success(t("settings.generateKeySuccess", { fingerprint: res.fingerprint }));
+            if (!res.encrypted) {
+                error(t("settings.generateKeyPlaintext"));
+            }
+        } catch (err) {
+            error(err instanceof Error ? err.message : String(err));
+        } finally {
+            setSaving(false);
+        }
+    };
+
+    const handleBackup = async () => {
+        const passphrase = prompt(t("settings.backupPassphrase"));
+        if (passphrase === null) return;
+        if (passphrase === "") {
+            window.location.href = '/api/db/backup';
+            return;
+        }
+        try {
+            const res = await fetch('/api/db/backup', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ passphrase }),
+            });
+            if (!res.ok) throw new Error(await res.text());
+            const url = URL.createObjectURL(await res.blob());
+            const link = document.createElement('a');
+            link.href = url;
+            link.download = 'controller.db.enc';
+            link.click();
+            URL.revokeObjectURL(url);
+        } catch (err) {
+            error(t("settings.backupError"));
+        }
+    };
+
+    // Backups encrypted with a passphrase start with this magic and mode 1.
+    const needsPassphrase = async (file: File) => {
+        const head = new Uint8Array(await file.slice(0, 9).arrayBuffer());
+        return new TextDecoder().decode(head.slice(0, 8)) === "ORFBAK01" && head[8] === 1;
     };
 
     const handleRestore = async (e: React.ChangeEvent<HTMLInputElement>) => {
@@ -59,18 +111,29 @@ export function Settings() {
 
         const formData = new FormData();
         formData.append('db_file', file);
+        if (await needsPassphrase(file)) {
+            const passphrase = prompt(t("settings.restorePassphrase"));
+            if (!passphrase) {
+                if (fileInputRef.current) fileInputRef.current.value = '';
+                return;
+            }
+            formData.append('passphrase', passphrase);
+        }
 
         setSaving(true);
         try {
-            const res = await fetch('/api/settings/restore', {
+            const res = await fetch('/api/db/restore', {
                 method: 'POST',
                 body: formData,
             });
-            if (!res.ok) throw new Error("Restore failed");
+            if (!res.ok) {
+                const body = await res.json().catch(() => null);
+                throw new Error(body?.error || "Restore failed");
+            }
             alert(t("settings.restoreSuccess"));
             window.location.reload();
         } catch (err) {
-            error(t("settings.restoreError"));
+            error(`${t("settings.restoreError")}: ${err instanceof Error ? err.message : err}`);
         } finally {
             setSaving(false);
             if (fileInputRef.current) fileInputRef.current.value = '';
@@ -129,9 +192,19 @@ export function Settings() {
                         </div>
                     </div>
                     <div>
-                        <label className="block text-sm font-medium text-gray-700 mb-1">
-                            {t("settings.sshKey")} (Optional if Password provided)
-                        </label>
+                        <div className="flex items-center justify-between mb-1">
+                            <label className="block text-sm font-medium text-gray-700">
+                                {t("settings.sshKey")} (Optional if Password provided)
+                            </label>
+                            <button
+                                type="button"
+                                onClick={handleGenerateKey}
+                                disabled={saving}
+                                className="flex items-center gap-1 text-sm text-blue-600 hover:text-blue-700 disabled:opacity-50"
+                            >
+                                <KeyRound size={14} /> {t("settings.generateKey")}
+                            </button>
+                        </div>
                         <textarea
                             value={config.ssh_key}
                             onChange={(e) => setConfig({ ...config, ssh_key: e.target.value })}
@@ -143,6 +216,22 @@ export function Settings() {
                         </p>
                     </div>
 
+                    <div>
+                        <label className="block text-sm font-medium text-gray-700 mb-1">
+                            {t("settings.keyPassphrase")}
+                        </label>
+                        <input
+                            type="password"
+                            value={config.key_passphrase || ""}
+                            onChange={(e) => setConfig({ ...config, key_passphrase: e.target.value })}
+                            className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 focus:border-blue-500"
+                            autoComplete="off"
+                        />
+                        <p className="mt-1 text-xs text-gray-500">
+                            {t("settings.keyPassphraseDesc")}
+                        </p>
+                    </div>
+
                     {config.ssh_public_key && (
                         <div>
                             <label className="block text-sm font-medium text-gray-700 mb-1">
@@ -160,6 +249,22 @@ export function Settings() {
                             </p>
                         </div>
                     )}
+
+                    {config.ssh_agent_keys && config.ssh_agent_keys.length > 0 && (
+                        <div>
+                            <label className="block text-sm font-medium text-gray-700 mb-1">
+                                {t("settings.sshAgentKeys")}
+                            </label>
+                            <textarea
+                                readOnly
+                                value={config.ssh_agent_keys.join("\n")}
+                                className="w-full px-3 py-2 border border-gray-300 rounded-lg bg-gray-50 text-gray-600 font-mono text-xs h-24 resize-none focus:outline-none"
+                            />
+                            <p className="mt-1 text-xs text-gray-500">
+                                {t("settings.sshAgentKeysDesc")}
+                            </p>
+                        </div>
+                    )}
                 </div>
                 <div className="px-6 py-4 bg-gray-50 border-t border-gray-100 flex justify-end">
                     <button
@@ -173,6 +278,14 @@ export function Settings() {
                 </div>
             </div>
 
+            <OnboardingDefaults />
+
+            <BatteryPolicy />
+
+            <SnapshotSchedules />
+
+            <Usage />
+
             {/* Database Management */}
             <div className="bg-white rounded-xl border border-gray-200 overflow-hidden">
                 <div className="p-6 border-b border-gray-100">
@@ -217,7 +330,7 @@ export function Settings() {
                                 ref={fileInputRef}
                                 onChange={handleRestore}
                                 className="hidden"
-                                accept=".db"
+                                accept=".db,.enc"
                             />
                         </>
                     )}
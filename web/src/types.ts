@@ -13,6 +13,86 @@ export interface Robot {
   job_id?: string;
   job_status?: string;
   job_error?: string;
+  boot_time?: string;
+  boot_duration_sec?: number;
+  archived_at?: string;
+  facts?: RobotFacts;
+  workspace?: RobotWorkspace;
+  drift?: RobotDrift;
+  docker?: RobotDocker;
+  launches?: RobotLaunch[];
+  estop?: RobotEStop;
+  unmanaged?: boolean;
+  battery?: number;
+  dock?: RobotDock;
+  position?: RobotPosition;
+}
+
+export interface RobotDocker {
+  name: string;
+  image?: string;
+  compose?: boolean;
+  previous_image?: string;
+  can_rollback?: boolean;
+  containers: RobotContainer[];
+}
+
+export interface RobotContainer {
+  name: string;
+  image: string;
+  state: string;
+  health?: string;
+}
+
+export interface RobotLaunch {
+  name: string;
+  package: string;
+  file: string;
+  pid?: number;
+  started_at: string;
+  running: boolean;
+  exited_at?: string;
+  error?: string;
+}
+
+export interface RobotDock {
+  docked: boolean;
+  dock_visible: boolean;
+}
+
+export interface RobotPosition {
+  x: number;
+  y: number;
+  yaw: number;
+  frame: string;
+  source: string;
+  at: string;
+}
+
+export interface RobotEStop {
+  since: string;
+  reason?: string;
+}
+
+export interface RobotWorkspace {
+  path: string;
+  repo?: string;
+  branch?: string;
+  commit?: string;
+  dirty?: boolean;
+  missing?: boolean;
+}
+
+export interface RobotDrift {
+  reasons: string[];
+  since: string;
+}
+
+export interface RobotFacts {
+  platform?: string;
+  ros_distro?: string;
+  sensors?: string[];
+  disk_free_gb: number;
 }
 
 export interface ScenarioRef {
@@ -25,6 +105,13 @@ export interface Scenario {
   name: string;
   description?: string;
   config_yaml: string;
+  has_repo_auth?: boolean;
+}
+
+export interface RepoAuthPayload {
+  username?: string;
+  token?: string;
+  ssh_key?: string;
 }
 
 export interface Job {
@@ -33,8 +120,21 @@ export interface Job {
   target_robot: string;
   payload_json: string;
   status: string;
+  issued_by?: string;
+  on_behalf_of?: string;
   created_at?: string;
   updated_at?: string;
+  steps?: JobStep[];
+  progress?: string;
+}
+
+export interface JobStep {
+  name: string;
+  type: string;
+  status: string;
+  attempts?: number;
+  error?: string;
+  seconds?: number;
 }
 
 export interface CommandRequest {
@@ -48,17 +148,28 @@ export interface InstallAgentPayload {
   address: string;
   user: string;
   ssh_key: string;
+  key_passphrase?: string;
   password?: string;
   sudo?: boolean;
   sudo_password?: string;
 }
 
+export interface CreateRobotPayload {
+  name: string;
+  type?: string;
+  ip?: string;
+  tags?: string[];
+  notes?: string;
+}
+
 export interface InstallConfig {
   address: string;
   user: string;
   ssh_key: string;
   password?: string;
+  key_passphrase?: string;
   ssh_public_key?: string;
+  ssh_agent_keys?: string[];
 }
 
 export interface InstallDefaultsResponse {
@@ -75,16 +186,30 @@ export interface DiscoveryCandidate {
 }
 
 export interface SemesterStatus {
+  id?: number;
   active: boolean;
+  state?: string;
   total: number;
   completed: number;
   robots: Record<string, string>;
   errors: Record<string, string>;
 }
 
+export interface WifiNetwork {
+    ssid: string;
+    password?: string;
+    priority?: number;
+    hidden?: boolean;
+    band?: "" | "2.4GHz" | "5GHz";
+    eap?: "" | "peap" | "ttls";
+    identity?: string;
+    anonymous_identity?: string;
+}
+
 export interface GoldenImageConfig {
     wifi_ssid: string;
     wifi_password: string;
+    wifi_networks?: WifiNetwork[];
     controller_url: string;
     mqtt_broker: string;
     lds_model: string;
@@ -93,4 +218,9 @@ export interface GoldenImageConfig {
     ros_version?: string;
     ubuntu_password?: string;
     include_extras?: boolean;
+    apt_packages?: string[];
+    pip_packages?: string[];
+    write_files?: string;
+    runcmd?: string;
+    keep_images?: number;
 }
\ No newline at end of file